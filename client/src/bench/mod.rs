@@ -0,0 +1,251 @@
+//! Benchmark a CnosDB server with a generated workload:
+//!
+//! - the points of a schema of [`crate::datagen`] are written in batches by
+//!   concurrent writers, all the series of a timestamp before the next one.
+//! - the queries of the mix of kinds are run by concurrent workers against
+//!   the points written.
+//! - the throughput and the latency percentiles of the writes and of each
+//!   kind of queries are reported, and saved as json to compare between
+//!   releases.
+//!
+//! The points and the queries are generated from a seed, so a benchmark
+//! can be reproduced with the same options.
+
+use std::collections::BTreeMap;
+use std::path::PathBuf;
+use std::time::{Duration, Instant};
+
+use futures_util::{stream, StreamExt};
+use serde::Serialize;
+
+pub use self::stats::{Latencies, LatencySummary};
+pub use self::workload::{QueryKind, QueryWeight, Workload};
+use crate::ctx::DEFAULT_DATABASE;
+use crate::v2::{Client, ClientOptions};
+use crate::Result;
+
+mod stats;
+mod workload;
+
+pub struct BenchOptions {
+    /// Options of the database benchmarked.
+    pub cnosdb: ClientOptions,
+    pub workload: Workload,
+    /// Do not write the points, query the points written before.
+    pub skip_write: bool,
+    /// Max number of points in a write request.
+    pub batch_size: usize,
+    pub write_workers: usize,
+    pub queries: usize,
+    pub query_mix: Vec<QueryWeight>,
+    /// Length of the time ranges queried in nanoseconds.
+    pub query_range: i64,
+    pub query_workers: usize,
+    /// File the report is saved to as json.
+    pub report_file: Option<PathBuf>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct Report {
+    pub write: Option<PhaseReport>,
+    /// Reports of the queries of each kind, and of all the queries.
+    pub queries: BTreeMap<String, PhaseReport>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct PhaseReport {
+    pub requests: usize,
+    pub errors: usize,
+    /// Number of the points written, 0 for the queries.
+    pub points: usize,
+    pub elapsed_secs: f64,
+    /// Requests succeeded per second.
+    pub requests_per_sec: f64,
+    pub points_per_sec: f64,
+    /// Latencies of the requests succeeded in milliseconds.
+    pub latency_ms: LatencySummary,
+}
+
+impl PhaseReport {
+    fn new(latencies: &Latencies, points: usize, elapsed: Duration) -> Self {
+        let secs = elapsed.as_secs_f64().max(f64::EPSILON);
+        let succeeded = latencies.requests() - latencies.errors();
+        Self {
+            requests: latencies.requests(),
+            errors: latencies.errors(),
+            points,
+            elapsed_secs: elapsed.as_secs_f64(),
+            requests_per_sec: succeeded as f64 / secs,
+            points_per_sec: points as f64 / secs,
+            latency_ms: latencies.summary(),
+        }
+    }
+
+    fn print(&self, name: &str) {
+        let l = &self.latency_ms;
+        println!(
+            "{:<10} requests={} errors={} points={} elapsed={:.2}s requests/s={:.1} \
+             points/s={:.1} latency(ms): min={:.2} mean={:.2} p50={:.2} p90={:.2} \
+             p95={:.2} p99={:.2} max={:.2}",
+            name,
+            self.requests,
+            self.errors,
+            self.points,
+            self.elapsed_secs,
+            self.requests_per_sec,
+            self.points_per_sec,
+            l.min,
+            l.mean,
+            l.p50,
+            l.p90,
+            l.p95,
+            l.p99,
+            l.max,
+        );
+    }
+}
+
+pub struct Bencher {
+    options: BenchOptions,
+    client: Client,
+}
+
+impl Bencher {
+    pub fn new(options: BenchOptions) -> Result<Self> {
+        options.workload.generator.validate()?;
+        let client = Client::new(options.cnosdb.clone())?;
+        Ok(Self { options, client })
+    }
+
+    pub async fn run(&self) -> Result<Report> {
+        let write = if self.options.skip_write {
+            None
+        } else {
+            self.create_database().await?;
+            Some(self.write().await)
+        };
+        let queries = if self.options.queries > 0 {
+            self.query().await?
+        } else {
+            BTreeMap::new()
+        };
+
+        let report = Report { write, queries };
+        if let Some(write) = &report.write {
+            write.print("write");
+        }
+        for (name, query) in &report.queries {
+            query.print(name);
+        }
+        if let Some(path) = &self.options.report_file {
+            std::fs::write(path, serde_json::to_vec_pretty(&report)?)?;
+            println!("Saved the report to {}", path.display());
+        }
+        Ok(report)
+    }
+
+    async fn create_database(&self) -> Result<()> {
+        let database = &self.options.cnosdb.database;
+        if database == DEFAULT_DATABASE {
+            return Ok(());
+        }
+        let client = Client::new(self.options.cnosdb.clone().with_database(DEFAULT_DATABASE))?;
+        let sql = format!(
+            "CREATE DATABASE IF NOT EXISTS \"{}\"",
+            database.replace('"', "\"\"")
+        );
+        client.query(&sql).await?;
+        Ok(())
+    }
+
+    async fn write(&self) -> PhaseReport {
+        let generator = &self.options.workload.generator;
+        println!(
+            "Writing {} points of {} series of {} in batches of {} by {} writers",
+            generator.points(),
+            generator.series,
+            generator.schema.kind,
+            self.options.batch_size,
+            self.options.write_workers
+        );
+
+        let started = Instant::now();
+        let (latencies, points) = stream::iter(generator.batches(self.options.batch_size))
+            .map(|(points, body)| async move {
+                let begin = Instant::now();
+                let result = self.client.write_line_protocol(body.into_bytes()).await;
+                (points, begin.elapsed(), result)
+            })
+            .buffer_unordered(self.options.write_workers.max(1))
+            .fold(
+                (Latencies::default(), 0),
+                |(mut latencies, mut written), (points, latency, result)| async move {
+                    match result {
+                        Ok(()) => {
+                            latencies.record(latency);
+                            written += points;
+                        }
+                        Err(e) => {
+                            if latencies.errors() == 0 {
+                                eprintln!("Failed to write: {}", e);
+                            }
+                            latencies.record_error();
+                        }
+                    }
+                    (latencies, written)
+                },
+            )
+            .await;
+        PhaseReport::new(&latencies, points, started.elapsed())
+    }
+
+    /// Reports of each kind of queries, and of all the queries as `all`.
+    async fn query(&self) -> Result<BTreeMap<String, PhaseReport>> {
+        let queries = self.options.workload.queries(
+            self.options.queries,
+            &self.options.query_mix,
+            self.options.query_range,
+        )?;
+        println!(
+            "Running {} queries by {} workers",
+            queries.len(),
+            self.options.query_workers
+        );
+
+        let started = Instant::now();
+        let results = stream::iter(queries)
+            .map(|(kind, sql)| async move {
+                let begin = Instant::now();
+                let result = self.client.query(&sql).await;
+                if let Err(e) = &result {
+                    eprintln!("Failed to query {}: {}", sql, e);
+                }
+                (kind, begin.elapsed(), result.is_ok())
+            })
+            .buffer_unordered(self.options.query_workers.max(1))
+            .collect::<Vec<_>>()
+            .await;
+        let elapsed = started.elapsed();
+
+        let mut all = Latencies::default();
+        let mut by_kind = BTreeMap::<QueryKind, Latencies>::new();
+        for (kind, latency, ok) in results {
+            for latencies in [&mut all, by_kind.entry(kind).or_default()] {
+                if ok {
+                    latencies.record(latency);
+                } else {
+                    latencies.record_error();
+                }
+            }
+        }
+
+        // the queries of a kind run along with the others, the throughput
+        // is of the whole mix
+        let mut reports = by_kind
+            .into_iter()
+            .map(|(kind, latencies)| (kind.to_string(), PhaseReport::new(&latencies, 0, elapsed)))
+            .collect::<BTreeMap<_, _>>();
+        reports.insert("all".to_string(), PhaseReport::new(&all, 0, elapsed));
+        Ok(reports)
+    }
+}
@@ -0,0 +1,97 @@
+use std::time::Duration;
+
+use serde::Serialize;
+
+/// Latencies of the requests of a kind.
+#[derive(Debug, Default)]
+pub struct Latencies {
+    samples: Vec<Duration>,
+    errors: usize,
+}
+
+impl Latencies {
+    pub fn record(&mut self, latency: Duration) {
+        self.samples.push(latency);
+    }
+
+    pub fn record_error(&mut self) {
+        self.errors += 1;
+    }
+
+    pub fn requests(&self) -> usize {
+        self.samples.len() + self.errors
+    }
+
+    pub fn errors(&self) -> usize {
+        self.errors
+    }
+
+    /// Latencies of the requests succeeded, in milliseconds.
+    pub fn summary(&self) -> LatencySummary {
+        let mut samples = self.samples.clone();
+        samples.sort_unstable();
+        let millis = |d: Duration| d.as_secs_f64() * 1000.0;
+        let percentile = |p: f64| {
+            if samples.is_empty() {
+                return 0.0;
+            }
+            // nearest rank
+            let rank = (p / 100.0 * samples.len() as f64).ceil() as usize;
+            millis(samples[rank.clamp(1, samples.len()) - 1])
+        };
+        let mean = if samples.is_empty() {
+            0.0
+        } else {
+            millis(samples.iter().sum::<Duration>()) / samples.len() as f64
+        };
+
+        LatencySummary {
+            min: samples.first().copied().map_or(0.0, millis),
+            mean,
+            p50: percentile(50.0),
+            p90: percentile(90.0),
+            p95: percentile(95.0),
+            p99: percentile(99.0),
+            max: samples.last().copied().map_or(0.0, millis),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct LatencySummary {
+    pub min: f64,
+    pub mean: f64,
+    pub p50: f64,
+    pub p90: f64,
+    pub p95: f64,
+    pub p99: f64,
+    pub max: f64,
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use super::Latencies;
+
+    #[test]
+    fn test_latency_summary() {
+        let mut latencies = Latencies::default();
+        assert_eq!(latencies.summary().p99, 0.0);
+
+        for ms in (1..=100).rev() {
+            latencies.record(Duration::from_millis(ms));
+        }
+        latencies.record_error();
+        assert_eq!(latencies.requests(), 101);
+        assert_eq!(latencies.errors(), 1);
+
+        let summary = latencies.summary();
+        assert_eq!(summary.min, 1.0);
+        assert_eq!(summary.mean, 50.5);
+        assert_eq!(summary.p50, 50.0);
+        assert_eq!(summary.p90, 90.0);
+        assert_eq!(summary.p99, 99.0);
+        assert_eq!(summary.max, 100.0);
+    }
+}
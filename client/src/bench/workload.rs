@@ -0,0 +1,221 @@
+use std::fmt::{self, Display};
+use std::str::FromStr;
+
+use anyhow::anyhow;
+use rand::rngs::StdRng;
+use rand::{Rng, SeedableRng};
+
+use crate::datagen::Generator;
+use crate::Result;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, PartialOrd, Ord)]
+pub enum QueryKind {
+    /// The last point of a series.
+    Last,
+    /// The points of a series in a time range.
+    Range,
+    /// Aggregations of all the series in a time range.
+    Agg,
+    /// Aggregations of a time range grouped by a tag.
+    GroupBy,
+}
+
+impl FromStr for QueryKind {
+    type Err = String;
+
+    fn from_str(s: &str) -> std::result::Result<Self, Self::Err> {
+        match s.to_ascii_lowercase().as_str() {
+            "last" => Ok(Self::Last),
+            "range" => Ok(Self::Range),
+            "agg" => Ok(Self::Agg),
+            "group_by" => Ok(Self::GroupBy),
+            _ => Err(format!(
+                "invalid query kind {}, expected last, range, agg or group_by",
+                s
+            )),
+        }
+    }
+}
+
+impl Display for QueryKind {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Last => write!(f, "last"),
+            Self::Range => write!(f, "range"),
+            Self::Agg => write!(f, "agg"),
+            Self::GroupBy => write!(f, "group_by"),
+        }
+    }
+}
+
+/// A query kind and its share of the queries, `kind:weight`, e.g. `last:3`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct QueryWeight {
+    pub kind: QueryKind,
+    pub weight: u32,
+}
+
+impl FromStr for QueryWeight {
+    type Err = String;
+
+    fn from_str(s: &str) -> std::result::Result<Self, Self::Err> {
+        let (kind, weight) = match s.split_once(':') {
+            Some((kind, weight)) => (
+                kind,
+                weight
+                    .parse::<u32>()
+                    .map_err(|_| format!("invalid weight of query {}: {}", kind, weight))?,
+            ),
+            None => (s, 1),
+        };
+        Ok(Self {
+            kind: kind.parse()?,
+            weight,
+        })
+    }
+}
+
+/// The points written and the queries run by the benchmark, the same
+/// options and seed always generate the same points and queries.
+#[derive(Debug, Clone)]
+pub struct Workload {
+    pub generator: Generator,
+}
+
+impl Workload {
+    pub fn new(generator: Generator) -> Self {
+        Self { generator }
+    }
+
+    /// `n` queries of the kinds chosen by the weights, the time ranges
+    /// queried are `range` nanoseconds long.
+    pub fn queries(
+        &self,
+        n: usize,
+        mix: &[QueryWeight],
+        range: i64,
+    ) -> Result<Vec<(QueryKind, String)>> {
+        let total = mix.iter().map(|w| w.weight as u64).sum::<u64>();
+        if total == 0 {
+            return Err(anyhow!(
+                "at least one query kind must have a positive weight"
+            ));
+        }
+        let mut rng = StdRng::seed_from_u64(self.generator.seed);
+        Ok((0..n)
+            .map(|_| {
+                let mut choice = rng.gen_range(0..total);
+                let kind = mix
+                    .iter()
+                    .find(|w| {
+                        let found = choice < w.weight as u64;
+                        choice = choice.saturating_sub(w.weight as u64);
+                        found
+                    })
+                    .map_or(QueryKind::Last, |w| w.kind);
+                (kind, self.query(kind, &mut rng, range))
+            })
+            .collect())
+    }
+
+    fn query(&self, kind: QueryKind, rng: &mut StdRng, range: i64) -> String {
+        let generator = &self.generator;
+        let schema = &generator.schema;
+        let table = quote_ident(&schema.measurement);
+        let series = schema
+            .tag_values(rng.gen_range(0..generator.series))
+            .into_iter()
+            .map(|(key, value)| format!("{} = '{}'", quote_ident(key), value))
+            .collect::<Vec<_>>();
+        let range = range.clamp(1, generator.end() - generator.start);
+        let from = rng.gen_range(generator.start..=generator.end() - range);
+        let time = format!("time >= {} AND time < {}", from, from + range);
+        let field = quote_ident(&schema.fields[0].name);
+        let aggs = format!("count({0}), avg({0}), max({0})", field);
+
+        match kind {
+            QueryKind::Last if series.is_empty() => {
+                format!("SELECT * FROM {} ORDER BY time DESC LIMIT 1", table)
+            }
+            QueryKind::Last => format!(
+                "SELECT * FROM {} WHERE {} ORDER BY time DESC LIMIT 1",
+                table,
+                series.join(" AND ")
+            ),
+            QueryKind::Range => {
+                let filters = series.into_iter().chain([time]).collect::<Vec<_>>();
+                format!("SELECT * FROM {} WHERE {}", table, filters.join(" AND "))
+            }
+            QueryKind::GroupBy if schema.group_by_tag().is_some() => {
+                let tag = quote_ident(schema.group_by_tag().unwrap_or_default());
+                format!(
+                    "SELECT {}, {} FROM {} WHERE {} GROUP BY {}",
+                    tag, aggs, table, time, tag
+                )
+            }
+            QueryKind::Agg | QueryKind::GroupBy => {
+                format!("SELECT {} FROM {} WHERE {}", aggs, table, time)
+            }
+        }
+    }
+}
+
+fn quote_ident(ident: &str) -> String {
+    format!("\"{}\"", ident.replace('"', "\"\""))
+}
+
+#[cfg(test)]
+mod test {
+    use super::{QueryKind, QueryWeight, Workload};
+    use crate::datagen::{Generator, Schema};
+
+    fn workload_of(schema: Schema) -> Workload {
+        Workload::new(Generator {
+            schema,
+            series: 5,
+            points_per_series: 4,
+            start: 0,
+            interval: 10,
+            seed: 0,
+        })
+    }
+
+    #[test]
+    fn test_parse_specs() {
+        let weight = "group_by:3".parse::<QueryWeight>().unwrap();
+        assert_eq!(weight.kind, QueryKind::GroupBy);
+        assert_eq!(weight.weight, 3);
+        assert_eq!("last".parse::<QueryWeight>().unwrap().weight, 1);
+        assert!("x:1".parse::<QueryWeight>().is_err());
+    }
+
+    #[test]
+    fn test_queries() {
+        let tags = vec!["host:3".parse().unwrap(), "region:2".parse().unwrap()];
+        let workload = workload_of(Schema::generic(tags, 2));
+        let mix = ["last:1", "range:1", "agg:1", "group_by:1"].map(|w| w.parse().unwrap());
+        let queries = workload.queries(100, &mix, 20).unwrap();
+        assert_eq!(queries.len(), 100);
+        assert_eq!(queries, workload.queries(100, &mix, 20).unwrap());
+        for (kind, sql) in &queries {
+            match kind {
+                QueryKind::Last => assert!(sql.ends_with("ORDER BY time DESC LIMIT 1")),
+                QueryKind::Range => assert!(sql.contains("\"host\" = 'host_")),
+                QueryKind::Agg => assert!(sql.starts_with("SELECT count(\"f0\")")),
+                QueryKind::GroupBy => assert!(sql.ends_with("GROUP BY \"host\"")),
+            }
+        }
+
+        let only_agg = ["agg:1".parse().unwrap(), "last:0".parse().unwrap()];
+        let queries = workload.queries(10, &only_agg, 20).unwrap();
+        assert!(queries.iter().all(|(kind, _)| *kind == QueryKind::Agg));
+        assert!(workload.queries(1, &only_agg[1..], 20).is_err());
+
+        let workload = workload_of(Schema::devops());
+        let group_by = ["group_by:1".parse().unwrap()];
+        for (_, sql) in workload.queries(10, &group_by, 20).unwrap() {
+            assert!(sql.starts_with("SELECT \"region\", count(\"usage_user\")"));
+            assert!(sql.contains("FROM \"cpu\""));
+        }
+    }
+}
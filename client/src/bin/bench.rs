@@ -0,0 +1,186 @@
+//! Benchmark a CnosDB server with a generated workload, reports the
+//! throughput and the latency percentiles of the writes and the queries.
+
+use std::path::PathBuf;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+use chrono::DateTime;
+use clap::Parser;
+use client::bench::{BenchOptions, Bencher, QueryWeight, Workload};
+use client::datagen::{Generator, Schema, SchemaKind, TagSpec};
+use client::v2::ClientOptions;
+use config::VERSION;
+
+#[derive(Debug, Parser)]
+#[command(name = "cnosdb-bench", author, version = & VERSION[..], about, long_about = None)]
+struct Args {
+    /// CnosDB server host
+    #[arg(short = 'H', long, default_value = "localhost")]
+    host: String,
+
+    /// CnosDB server port
+    #[arg(short = 'P', long, default_value_t = 8902)]
+    port: u16,
+
+    #[arg(short, long, default_value = "root")]
+    user: String,
+
+    #[arg(short, long)]
+    password: Option<String>,
+
+    #[arg(short, long, default_value = "cnosdb")]
+    tenant: String,
+
+    /// Database written and queried, created if not exists
+    #[arg(short, long, default_value = "bench")]
+    database: String,
+
+    /// Schema of the points, generic, devops, iot or finance
+    #[arg(long, default_value = "generic")]
+    schema: SchemaKind,
+
+    /// Table written and queried, defaults to the one of the schema
+    #[arg(short, long)]
+    measurement: Option<String>,
+
+    /// Tags of the series of the generic schema as key:cardinality
+    #[arg(long, value_delimiter = ',', default_value = "host:100,region:10")]
+    tags: Vec<TagSpec>,
+
+    /// Number of the series, defaults to all the combinations of the tag
+    /// values of the generic schema, and 100 of the others
+    #[arg(short, long)]
+    series: Option<usize>,
+
+    /// Number of the float fields of a point of the generic schema
+    #[arg(long, default_value_t = 4)]
+    fields: usize,
+
+    /// Number of the points of a series
+    #[arg(long, default_value_t = 100)]
+    points: usize,
+
+    /// Interval of the points of a series
+    #[arg(long, default_value = "10s", value_parser = parse_duration)]
+    interval: Duration,
+
+    /// Timestamp of the first points, RFC3339 or nanoseconds, defaults to
+    /// the time the points written end at now
+    #[arg(long, value_parser = parse_time)]
+    start: Option<i64>,
+
+    /// Seed of the generated points and queries
+    #[arg(long, default_value_t = 0)]
+    seed: u64,
+
+    /// Do not write the points, query the points written before with the
+    /// same options and start
+    #[arg(long, default_value_t = false)]
+    skip_write: bool,
+
+    /// Max number of points in a write request
+    #[arg(long, default_value_t = 5000)]
+    batch_size: usize,
+
+    /// Number of the concurrent write requests
+    #[arg(long, default_value_t = 4)]
+    write_workers: usize,
+
+    /// Number of the queries, 0 to skip the queries
+    #[arg(long, default_value_t = 1000)]
+    queries: usize,
+
+    /// Kinds of the queries and their weights as kind:weight, the kinds are
+    /// last, range, agg and group_by
+    #[arg(
+        long,
+        value_delimiter = ',',
+        default_value = "last:1,range:1,agg:1,group_by:1"
+    )]
+    query_mix: Vec<QueryWeight>,
+
+    /// Length of the time ranges queried
+    #[arg(long, default_value = "1h", value_parser = parse_duration)]
+    query_range: Duration,
+
+    /// Number of the concurrent queries
+    #[arg(long, default_value_t = 4)]
+    query_workers: usize,
+
+    /// File the report is saved to as json
+    #[arg(long)]
+    report_file: Option<PathBuf>,
+}
+
+fn parse_time(s: &str) -> Result<i64, String> {
+    if let Ok(ts) = s.parse::<i64>() {
+        return Ok(ts);
+    }
+    DateTime::parse_from_rfc3339(s)
+        .map_err(|e| e.to_string())?
+        .timestamp_nanos_opt()
+        .ok_or_else(|| format!("{} is out of range", s))
+}
+
+fn parse_duration(s: &str) -> Result<Duration, String> {
+    duration_str::parse_std(s).map_err(|e| e.to_string())
+}
+
+#[tokio::main]
+async fn main() -> Result<(), anyhow::Error> {
+    env_logger::init();
+    let args = Args::parse();
+
+    let mut schema = Schema::new(args.schema, args.tags, args.fields);
+    if let Some(measurement) = args.measurement {
+        schema.measurement = measurement;
+    }
+    let series = args.series.unwrap_or(match args.schema {
+        SchemaKind::Generic => schema.max_series(),
+        _ => 100,
+    });
+    let interval = args.interval.as_nanos() as i64;
+    let start = args.start.unwrap_or_else(|| {
+        let now = SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .map_or(0, |d| d.as_nanos() as i64);
+        let start = now - args.points as i64 * interval;
+        start - start.rem_euclid(interval.max(1))
+    });
+
+    let options = BenchOptions {
+        cnosdb: ClientOptions::default()
+            .with_host(args.host)
+            .with_port(args.port)
+            .with_user(args.user, args.password)
+            .with_tenant(args.tenant)
+            .with_database(args.database),
+        workload: Workload::new(Generator {
+            schema,
+            series,
+            points_per_series: args.points,
+            start,
+            interval,
+            seed: args.seed,
+        }),
+        skip_write: args.skip_write,
+        batch_size: args.batch_size.max(1),
+        write_workers: args.write_workers.max(1),
+        queries: args.queries,
+        query_mix: args.query_mix,
+        query_range: args.query_range.as_nanos() as i64,
+        query_workers: args.query_workers.max(1),
+        report_file: args.report_file,
+    };
+    let report = Bencher::new(options)?.run().await?;
+
+    let failed = report
+        .write
+        .iter()
+        .chain(report.queries.values())
+        .any(|r| r.errors > 0);
+    if failed {
+        std::process::exit(1);
+    }
+    Ok(())
+}
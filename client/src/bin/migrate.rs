@@ -0,0 +1,125 @@
+//! Migrate the databases, users and data of an InfluxDB 1.x instance to
+//! CnosDB.
+
+use std::path::PathBuf;
+use std::time::Duration;
+
+use chrono::DateTime;
+use clap::Parser;
+use client::migrate::{MigrateOptions, Migrator};
+use client::v2::ClientOptions;
+use config::VERSION;
+
+#[derive(Debug, Parser)]
+#[command(name = "cnosdb-migrate", author, version = & VERSION[..], about, long_about = None)]
+struct Args {
+    /// Url of the InfluxDB 1.x instance
+    #[arg(long, default_value = "http://localhost:8086")]
+    influx_url: String,
+
+    #[arg(long)]
+    influx_user: Option<String>,
+
+    #[arg(long)]
+    influx_password: Option<String>,
+
+    /// CnosDB server host
+    #[arg(short = 'H', long, default_value = "localhost")]
+    host: String,
+
+    /// CnosDB server port
+    #[arg(short = 'P', long, default_value_t = 8902)]
+    port: u16,
+
+    #[arg(short, long, default_value = "root")]
+    user: String,
+
+    #[arg(short, long)]
+    password: Option<String>,
+
+    /// Tenant the databases created in
+    #[arg(short, long, default_value = "cnosdb")]
+    tenant: String,
+
+    /// Databases to migrate, all but `_internal` if not set
+    #[arg(short, long, value_delimiter = ',')]
+    database: Vec<String>,
+
+    /// Password of the users created, users are not migrated if not set
+    #[arg(long)]
+    user_password: Option<String>,
+
+    /// Do not migrate the databases and users
+    #[arg(long, default_value_t = false)]
+    skip_meta: bool,
+
+    /// Do not copy the data
+    #[arg(long, default_value_t = false)]
+    skip_data: bool,
+
+    /// Start of the data copied, RFC3339 or nanoseconds, defaults to the first point
+    #[arg(long, value_parser = parse_time)]
+    start: Option<i64>,
+
+    /// Time range of the data copied in a query
+    #[arg(long, default_value = "1h", value_parser = parse_duration)]
+    window: Duration,
+
+    /// File saving the progress, the migration resumes from it
+    #[arg(long, default_value = "cnosdb-migrate.checkpoint")]
+    checkpoint: PathBuf,
+
+    /// Max number of points in a write request
+    #[arg(long, default_value_t = 5000)]
+    batch_size: usize,
+
+    /// Keep copying the new writes after the data copied, until Ctrl-C
+    #[arg(long, default_value_t = false)]
+    follow: bool,
+
+    /// Interval of copying the new writes
+    #[arg(long, default_value = "10s", value_parser = parse_duration)]
+    follow_interval: Duration,
+}
+
+fn parse_time(s: &str) -> Result<i64, String> {
+    if let Ok(ts) = s.parse::<i64>() {
+        return Ok(ts);
+    }
+    DateTime::parse_from_rfc3339(s)
+        .map_err(|e| e.to_string())?
+        .timestamp_nanos_opt()
+        .ok_or_else(|| format!("{} is out of range", s))
+}
+
+fn parse_duration(s: &str) -> Result<Duration, String> {
+    duration_str::parse_std(s).map_err(|e| e.to_string())
+}
+
+#[tokio::main]
+async fn main() -> Result<(), anyhow::Error> {
+    env_logger::init();
+    let args = Args::parse();
+
+    let options = MigrateOptions {
+        influx_url: args.influx_url,
+        influx_user: args.influx_user,
+        influx_password: args.influx_password,
+        cnosdb: ClientOptions::default()
+            .with_host(args.host)
+            .with_port(args.port)
+            .with_user(args.user, args.password)
+            .with_tenant(args.tenant),
+        databases: args.database,
+        user_password: args.user_password,
+        skip_meta: args.skip_meta,
+        skip_data: args.skip_data,
+        start: args.start,
+        window: args.window,
+        checkpoint: args.checkpoint,
+        batch_size: args.batch_size.max(1),
+        follow: args.follow,
+        follow_interval: args.follow_interval,
+    };
+    Migrator::new(options)?.run().await
+}
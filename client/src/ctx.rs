@@ -285,6 +285,12 @@ impl SessionContext {
     }
 
     pub async fn sql(&self, sql: String) -> Result<Response> {
+        self.sql_with_accept(sql, self.session_config.fmt.get_http_content_type())
+            .await
+    }
+
+    /// Execute the sql, asks for the result in the `accept` content type.
+    pub async fn sql_with_accept(&self, sql: String, accept: &str) -> Result<Response> {
         let mut sql = sql.into_bytes();
         let user_info = &self.session_config.user_info;
 
@@ -306,7 +312,7 @@ impl SessionContext {
             .http_client
             .post(API_V1_SQL_PATH)
             .basic_auth::<&str, &str>(&user_info.user, user_info.password.as_deref())
-            .header(ACCEPT, self.session_config.fmt.get_http_content_type());
+            .header(ACCEPT, accept);
 
         if let Some(encoding) = self.session_config.accept_encoding {
             builder = builder.header(ACCEPT_ENCODING, encoding.to_header_value());
@@ -415,6 +421,12 @@ impl SessionContext {
             precision: Some(precision),
             tenant: Some(tenant),
             db: Some(db),
+            partial_write: None,
+            non_finite_float: None,
+            unicode_escape: None,
+            format: None,
+            field_label: None,
+            ttl: None,
         };
 
         let mut builder = self
@@ -0,0 +1,248 @@
+//! Generators of time series data for the tests and the benchmarks, the
+//! schemas are of the use cases of TSBS:
+//!
+//! - `generic`: tags of the given cardinalities and float fields.
+//! - `devops`: CPU metrics of hosts.
+//! - `iot`: readings of trucks.
+//! - `finance`: quotes of stocks.
+//!
+//! A value is computed from the seed, the series, the field and the
+//! timestamp, so the same options always generate the same points, and
+//! the points can be generated in any order, e.g. by concurrent writers.
+//!
+//! The points are generated as [`Point`]s, as line protocol, or written to
+//! the server directly by a [`BatchWriter`].
+
+use std::f64::consts::TAU;
+
+use anyhow::anyhow;
+
+pub use self::schema::{FieldDef, FieldKind, Schema, SchemaKind, TagDef, TagSpec, TagValues};
+use crate::v2::{BatchWriter, Point};
+use crate::Result;
+
+mod schema;
+
+#[derive(Debug, Clone)]
+pub struct Generator {
+    pub schema: Schema,
+    pub series: usize,
+    pub points_per_series: usize,
+    /// Timestamp of the first points in nanoseconds.
+    pub start: i64,
+    /// Interval of the points of a series in nanoseconds.
+    pub interval: i64,
+    pub seed: u64,
+}
+
+impl Generator {
+    /// Checks the series can be told apart by the tags.
+    pub fn validate(&self) -> Result<()> {
+        let max_series = self.schema.max_series();
+        if self.series == 0 || self.series > max_series {
+            return Err(anyhow!(
+                "number of series must be in [1, {}] of the tags, but found {}",
+                max_series,
+                self.series
+            ));
+        }
+        if self.schema.fields.is_empty() || self.points_per_series == 0 || self.interval <= 0 {
+            return Err(anyhow!("fields, points and interval must be positive"));
+        }
+        Ok(())
+    }
+
+    pub fn points(&self) -> usize {
+        self.series * self.points_per_series
+    }
+
+    /// Timestamp after the last points.
+    pub fn end(&self) -> i64 {
+        self.start + self.points_per_series as i64 * self.interval
+    }
+
+    /// The `n`th point, all the series of a timestamp are before the next
+    /// timestamp, as the collectors write.
+    pub fn point(&self, n: usize) -> Point {
+        let (ts, series) = (n / self.series, n % self.series);
+        let mut point =
+            Point::new(&self.schema.measurement).timestamp(self.start + ts as i64 * self.interval);
+        for (key, value) in self.schema.tag_values(series) {
+            point = point.tag(key, value);
+        }
+        for (i, field) in self.schema.fields.iter().enumerate() {
+            let words = [self.seed, series as u64, i as u64, ts as u64];
+            point = match field.kind {
+                FieldKind::Float { min, max, period } => {
+                    let phase = unit(hash(&words[..3]));
+                    let wave = (TAU * (ts as f64 / period.max(1) as f64 + phase)).sin();
+                    let noise = unit(hash(&words)) * 2.0 - 1.0;
+                    let value = 0.5 + 0.4 * wave + 0.1 * noise;
+                    point.field(&field.name, min + (max - min) * value)
+                }
+                FieldKind::Integer { min, max } => {
+                    let range = max.abs_diff(min).saturating_add(1);
+                    let offset = hash(&words) % range;
+                    point.field(&field.name, min.wrapping_add(offset as i64))
+                }
+            };
+        }
+        point
+    }
+
+    pub fn iter(&self) -> impl Iterator<Item = Point> + '_ {
+        (0..self.points()).map(|n| self.point(n))
+    }
+
+    /// Line protocol bodies of the write requests with their numbers of
+    /// points.
+    pub fn batches(&self, batch_size: usize) -> impl Iterator<Item = (usize, String)> + '_ {
+        let batch_size = batch_size.max(1);
+        let points = self.points();
+        (0..points).step_by(batch_size).map(move |from| {
+            let to = (from + batch_size).min(points);
+            let mut body = String::new();
+            for n in from..to {
+                self.point(n).write_line_protocol(&mut body);
+                body.push('\n');
+            }
+            (to - from, body)
+        })
+    }
+
+    /// Writes all the points by the writer, returns the number of the
+    /// points written.
+    pub async fn write(&self, writer: &BatchWriter) -> Result<usize> {
+        for point in self.iter() {
+            writer.write(point).await?;
+        }
+        writer.flush().await?;
+        Ok(self.points())
+    }
+}
+
+/// Mixes the words into a hash, splitmix64 of each word.
+fn hash(words: &[u64]) -> u64 {
+    words.iter().fold(0x9E37_79B9_7F4A_7C15, |h, w| {
+        let mut z = (h ^ w).wrapping_add(0x9E37_79B9_7F4A_7C15);
+        z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+        z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+        z ^ (z >> 31)
+    })
+}
+
+/// The hash as a float in `[0, 1)`.
+fn unit(hash: u64) -> f64 {
+    (hash >> 11) as f64 / (1_u64 << 53) as f64
+}
+
+#[cfg(test)]
+mod test {
+    use super::{FieldKind, Generator, Schema, SchemaKind};
+
+    fn generator(schema: Schema, series: usize) -> Generator {
+        Generator {
+            schema,
+            series,
+            points_per_series: 4,
+            start: 0,
+            interval: 10,
+            seed: 0,
+        }
+    }
+
+    #[test]
+    fn test_parse_specs() {
+        assert_eq!("IoT".parse::<SchemaKind>().unwrap(), SchemaKind::Iot);
+        assert!("tsbs".parse::<SchemaKind>().is_err());
+        assert!("host".parse::<super::TagSpec>().is_err());
+        assert!("host:0".parse::<super::TagSpec>().is_err());
+        assert_eq!(
+            "host:100".parse::<super::TagSpec>().unwrap().cardinality,
+            100
+        );
+    }
+
+    #[test]
+    fn test_generic_batches() {
+        let tags = vec!["host:3".parse().unwrap(), "region:2".parse().unwrap()];
+        let generator = generator(Schema::generic(tags, 2), 5);
+        generator.validate().unwrap();
+        let mut too_many = generator.clone();
+        too_many.series = 7;
+        assert!(too_many.validate().is_err());
+
+        let batches = generator.batches(6).collect::<Vec<_>>();
+        assert_eq!(
+            batches.iter().map(|(n, _)| *n).collect::<Vec<_>>(),
+            vec![6, 6, 6, 2]
+        );
+        let lines = batches
+            .iter()
+            .flat_map(|(_, body)| body.lines())
+            .collect::<Vec<_>>();
+        assert_eq!(lines.len(), 20);
+        assert!(lines[0].starts_with("bench,host=host_0,region=region_0 f0="));
+        assert!(lines[4].starts_with("bench,host=host_1,region=region_1 f0="));
+        assert!(lines[5].starts_with("bench,host=host_0,region=region_0 f0="));
+        assert!(lines[5].ends_with(" 10"));
+
+        // reproducible, and the same as the points
+        assert_eq!(batches, generator.batches(6).collect::<Vec<_>>());
+        let points = generator
+            .iter()
+            .map(|p| p.to_line_protocol())
+            .collect::<Vec<_>>();
+        assert_eq!(lines, points);
+
+        let mut reseeded = generator.clone();
+        reseeded.seed = 1;
+        assert_ne!(batches, reseeded.batches(6).collect::<Vec<_>>());
+    }
+
+    #[test]
+    fn test_schemas() {
+        for kind in [SchemaKind::Devops, SchemaKind::Iot, SchemaKind::Finance] {
+            let schema = Schema::new(kind, vec![], 0);
+            let generator = generator(schema.clone(), 1000);
+            generator.validate().unwrap();
+            let lines = generator.batches(1000).next().unwrap().1;
+            let first = lines.lines().next().unwrap();
+            let prefix = format!(
+                "{},{}={}_0,",
+                schema.measurement, schema.tags[0].key, schema.tags[0].key
+            );
+            assert!(first.starts_with(&prefix), "{first}");
+            assert_eq!(lines.lines().count(), 1000);
+
+            // the tags of a series are the same at all the timestamps
+            let tags = |line: &str| line.split(' ').next().unwrap().to_string();
+            assert_eq!(tags(first), tags(&generator.point(1000).to_line_protocol()));
+            assert!(schema.group_by_tag().is_some());
+        }
+
+        let generator = generator(Schema::finance(), 100);
+        for point in generator.iter() {
+            let line = point.to_line_protocol();
+            let fields = line.split(' ').nth(1).unwrap();
+            for (field, value) in fields.split(',').filter_map(|f| f.split_once('=')) {
+                let def = generator
+                    .schema
+                    .fields
+                    .iter()
+                    .find(|d| d.name == field)
+                    .unwrap();
+                match def.kind {
+                    FieldKind::Float { min, max, .. } => {
+                        let value = value.parse::<f64>().unwrap();
+                        assert!(value >= min && value <= max, "{line}");
+                    }
+                    FieldKind::Integer { min, max } => {
+                        let value = value.trim_end_matches('i').parse::<i64>().unwrap();
+                        assert!(value >= min && value <= max, "{line}");
+                    }
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,320 @@
+use std::fmt::{self, Display};
+use std::str::FromStr;
+
+/// A tag and the number of its values, `key:cardinality`, e.g. `host:100`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TagSpec {
+    pub key: String,
+    pub cardinality: usize,
+}
+
+impl FromStr for TagSpec {
+    type Err = String;
+
+    fn from_str(s: &str) -> std::result::Result<Self, Self::Err> {
+        let (key, cardinality) = s
+            .split_once(':')
+            .ok_or_else(|| format!("expected key:cardinality, but found {}", s))?;
+        let cardinality = cardinality
+            .parse::<usize>()
+            .ok()
+            .filter(|c| *c > 0)
+            .ok_or_else(|| format!("invalid cardinality of tag {}: {}", key, cardinality))?;
+        Ok(Self {
+            key: key.to_string(),
+            cardinality,
+        })
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum SchemaKind {
+    /// Tags of the given cardinalities and float fields `f0`, `f1`, ...
+    Generic,
+    /// CPU metrics of hosts, as the cpu-only use case of TSBS.
+    Devops,
+    /// Readings of trucks, as the iot use case of TSBS.
+    Iot,
+    /// Quotes of stocks.
+    Finance,
+}
+
+impl FromStr for SchemaKind {
+    type Err = String;
+
+    fn from_str(s: &str) -> std::result::Result<Self, Self::Err> {
+        match s.to_ascii_lowercase().as_str() {
+            "generic" => Ok(Self::Generic),
+            "devops" => Ok(Self::Devops),
+            "iot" => Ok(Self::Iot),
+            "finance" => Ok(Self::Finance),
+            _ => Err(format!(
+                "invalid schema {}, expected generic, devops, iot or finance",
+                s
+            )),
+        }
+    }
+}
+
+impl Display for SchemaKind {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Generic => write!(f, "generic"),
+            Self::Devops => write!(f, "devops"),
+            Self::Iot => write!(f, "iot"),
+            Self::Finance => write!(f, "finance"),
+        }
+    }
+}
+
+#[derive(Debug, Clone)]
+pub enum TagValues {
+    /// `{key}_{n}` for n in `[0, cardinality)`, the series are numbered by
+    /// these tags like digits, the first tag changes the fastest.
+    Numbered { cardinality: usize },
+    /// One of the values chosen by the series, does not tell the series
+    /// apart.
+    Choice(&'static [&'static str]),
+}
+
+#[derive(Debug, Clone)]
+pub struct TagDef {
+    pub key: String,
+    pub values: TagValues,
+}
+
+#[derive(Debug, Clone, Copy)]
+pub enum FieldKind {
+    /// Waves between `min` and `max` with noise, one wave per `period`
+    /// points.
+    Float { min: f64, max: f64, period: usize },
+    /// Random between `min` and `max`, both inclusive.
+    Integer { min: i64, max: i64 },
+}
+
+#[derive(Debug, Clone)]
+pub struct FieldDef {
+    pub name: String,
+    pub kind: FieldKind,
+}
+
+/// Measurement, tags and fields of the points generated.
+#[derive(Debug, Clone)]
+pub struct Schema {
+    pub kind: SchemaKind,
+    pub measurement: String,
+    pub tags: Vec<TagDef>,
+    pub fields: Vec<FieldDef>,
+}
+
+/// The cardinality of the tags telling the series apart in the schemas of
+/// the use cases, the number of the series is only limited by the options.
+const UNLIMITED: usize = usize::MAX;
+
+impl Schema {
+    pub fn new(kind: SchemaKind, tags: Vec<TagSpec>, fields: usize) -> Self {
+        match kind {
+            SchemaKind::Generic => Self::generic(tags, fields),
+            SchemaKind::Devops => Self::devops(),
+            SchemaKind::Iot => Self::iot(),
+            SchemaKind::Finance => Self::finance(),
+        }
+    }
+
+    pub fn generic(tags: Vec<TagSpec>, fields: usize) -> Self {
+        Self {
+            kind: SchemaKind::Generic,
+            measurement: "bench".to_string(),
+            tags: tags
+                .into_iter()
+                .map(|t| TagDef {
+                    key: t.key,
+                    values: TagValues::Numbered {
+                        cardinality: t.cardinality,
+                    },
+                })
+                .collect(),
+            fields: (0..fields)
+                .map(|i| float(&format!("f{}", i), 0.0, 100.0, 360))
+                .collect(),
+        }
+    }
+
+    pub fn devops() -> Self {
+        const REGIONS: &[&str] = &[
+            "us-east-1",
+            "us-west-1",
+            "us-west-2",
+            "eu-west-1",
+            "eu-central-1",
+            "ap-southeast-1",
+            "ap-southeast-2",
+            "ap-northeast-1",
+            "sa-east-1",
+        ];
+        const OS: &[&str] = &["Ubuntu16.10", "Ubuntu16.04LTS", "Ubuntu15.10"];
+        const ARCH: &[&str] = &["x64", "x86"];
+        const TEAMS: &[&str] = &["SF", "NYC", "LON", "CHI"];
+        const SERVICES: &[&str] = &["1", "2", "3", "4", "5", "6", "7", "8", "9", "10"];
+
+        let cpu_fields = [
+            "usage_user",
+            "usage_system",
+            "usage_idle",
+            "usage_nice",
+            "usage_iowait",
+            "usage_irq",
+            "usage_softirq",
+            "usage_steal",
+            "usage_guest",
+            "usage_guest_nice",
+        ];
+        Self {
+            kind: SchemaKind::Devops,
+            measurement: "cpu".to_string(),
+            tags: vec![
+                numbered("hostname"),
+                choice("region", REGIONS),
+                choice("os", OS),
+                choice("arch", ARCH),
+                choice("team", TEAMS),
+                choice("service", SERVICES),
+            ],
+            fields: cpu_fields
+                .iter()
+                .map(|f| float(f, 0.0, 100.0, 360))
+                .collect(),
+        }
+    }
+
+    pub fn iot() -> Self {
+        const FLEETS: &[&str] = &["South", "West", "East", "North", "Central"];
+        const DRIVERS: &[&str] = &[
+            "Derek", "Rodney", "Albert", "Andy", "Seth", "Trish", "Zack", "Ling",
+        ];
+        const MODELS: &[&str] = &["F-150", "G-2000", "H-2"];
+        const DEVICE_VERSIONS: &[&str] = &["v1.0", "v1.5", "v2.0", "v2.3"];
+
+        Self {
+            kind: SchemaKind::Iot,
+            measurement: "readings".to_string(),
+            tags: vec![
+                numbered("name"),
+                choice("fleet", FLEETS),
+                choice("driver", DRIVERS),
+                choice("model", MODELS),
+                choice("device_version", DEVICE_VERSIONS),
+            ],
+            fields: vec![
+                float("latitude", -90.0, 90.0, 3600),
+                float("longitude", -180.0, 180.0, 3600),
+                float("elevation", 0.0, 5000.0, 720),
+                float("velocity", 0.0, 100.0, 120),
+                float("heading", 0.0, 360.0, 240),
+                float("grade", 0.0, 100.0, 240),
+                float("fuel_consumption", 0.0, 50.0, 120),
+            ],
+        }
+    }
+
+    pub fn finance() -> Self {
+        const EXCHANGES: &[&str] = &["NYSE", "NASDAQ", "LSE", "SSE", "HKEX", "TSE"];
+        const SECTORS: &[&str] = &[
+            "technology",
+            "finance",
+            "energy",
+            "healthcare",
+            "consumer",
+            "industrials",
+        ];
+
+        Self {
+            kind: SchemaKind::Finance,
+            measurement: "quotes".to_string(),
+            tags: vec![
+                numbered("symbol"),
+                choice("exchange", EXCHANGES),
+                choice("sector", SECTORS),
+            ],
+            fields: vec![
+                float("price", 10.0, 500.0, 600),
+                float("bid", 10.0, 500.0, 600),
+                float("ask", 10.0, 500.0, 600),
+                FieldDef {
+                    name: "volume".to_string(),
+                    kind: FieldKind::Integer {
+                        min: 100,
+                        max: 100_000,
+                    },
+                },
+            ],
+        }
+    }
+
+    /// The number of the series the tags can tell apart.
+    pub fn max_series(&self) -> usize {
+        self.tags
+            .iter()
+            .filter_map(|t| match t.values {
+                TagValues::Numbered { cardinality } => Some(cardinality),
+                TagValues::Choice(_) => None,
+            })
+            .try_fold(1_usize, |n, c| n.checked_mul(c))
+            .unwrap_or(UNLIMITED)
+    }
+
+    /// The tag the queries group by, the first tag of a few values.
+    pub fn group_by_tag(&self) -> Option<&str> {
+        self.tags
+            .iter()
+            .find(|t| matches!(t.values, TagValues::Choice(_)))
+            .or_else(|| self.tags.first())
+            .map(|t| t.key.as_str())
+    }
+
+    /// Tag values of the `series`th series.
+    pub fn tag_values(&self, mut series: usize) -> Vec<(&str, String)> {
+        let id = series;
+        self.tags
+            .iter()
+            .enumerate()
+            .map(|(i, t)| {
+                let value = match &t.values {
+                    TagValues::Numbered { cardinality } => {
+                        let value = series % cardinality;
+                        series /= cardinality;
+                        format!("{}_{}", t.key, value)
+                    }
+                    TagValues::Choice(values) => {
+                        let choice = super::hash(&[id as u64, i as u64]);
+                        values[choice as usize % values.len()].to_string()
+                    }
+                };
+                (t.key.as_str(), value)
+            })
+            .collect()
+    }
+}
+
+fn numbered(key: &str) -> TagDef {
+    TagDef {
+        key: key.to_string(),
+        values: TagValues::Numbered {
+            cardinality: UNLIMITED,
+        },
+    }
+}
+
+fn choice(key: &str, values: &'static [&'static str]) -> TagDef {
+    TagDef {
+        key: key.to_string(),
+        values: TagValues::Choice(values),
+    }
+}
+
+fn float(name: &str, min: f64, max: f64, period: usize) -> FieldDef {
+    FieldDef {
+        name: name.to_string(),
+        kind: FieldKind::Float { min, max, period },
+    }
+}
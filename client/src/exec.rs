@@ -3,6 +3,7 @@
 use std::fs::File;
 use std::io::prelude::*;
 use std::io::BufReader;
+use std::path::PathBuf;
 use std::time::Instant;
 
 use anyhow::bail;
@@ -107,11 +108,37 @@ pub async fn exec_from_files(
     Ok(())
 }
 
+/// run and execute the SQL statements given by the command line, stops at the first failure
+pub async fn exec_from_commands(
+    commands: Vec<String>,
+    ctx: &mut SessionContext,
+    print_options: &PrintOptions,
+) -> Result<()> {
+    for sql in commands {
+        if let Some(db) = parse_use_database(&sql) {
+            connect_database(&db, ctx).await?;
+            continue;
+        }
+        exec_and_print(ctx, print_options, sql).await?;
+    }
+    Ok(())
+}
+
+/// The history is kept in the home directory, so it's shared by the sessions
+/// started from any directory.
+fn history_path() -> PathBuf {
+    match dirs::home_dir() {
+        Some(home) => home.join(".cnosdb_history"),
+        None => PathBuf::from(".history"),
+    }
+}
+
 /// run and execute SQL statements and commands against a context with the given print options
 pub async fn exec_from_repl(ctx: &mut SessionContext, print_options: &PrintOptions) {
     let mut rl = Editor::<CliHelper, DefaultHistory>::new().unwrap();
     rl.set_helper(Some(CliHelper::default()));
-    rl.load_history(".history").ok();
+    let history_path = history_path();
+    rl.load_history(&history_path).ok();
 
     let mut print_options = print_options.clone();
 
@@ -177,7 +204,7 @@ pub async fn exec_from_repl(ctx: &mut SessionContext, print_options: &PrintOptio
         }
     }
 
-    rl.save_history(".history").ok();
+    rl.save_history(&history_path).ok();
 }
 
 async fn exec_and_print(
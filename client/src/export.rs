@@ -0,0 +1,41 @@
+//! Export the query results as parquet files, which can be read by the
+//! analytical tools directly, and imported back by the `import` command.
+
+use std::fs;
+use std::path::PathBuf;
+use std::time::Instant;
+
+use anyhow::bail;
+use http_protocol::header::APPLICATION_PARQUET;
+
+use crate::ctx::{ResultSet, SessionContext};
+use crate::Result;
+
+pub struct ExportOptions {
+    pub sql: String,
+    pub output: PathBuf,
+}
+
+pub async fn export(ctx: &SessionContext, options: &ExportOptions) -> Result<()> {
+    let start = Instant::now();
+    let resp = ctx
+        .sql_with_accept(options.sql.clone(), APPLICATION_PARQUET)
+        .await?;
+    let ResultSet::Bytes((body, _)) = SessionContext::parse_response(resp).await? else {
+        bail!("unexpected result of the query")
+    };
+    // an empty result has no schema to write
+    if body.is_empty() {
+        println!("Query returned no rows, nothing exported");
+        return Ok(());
+    }
+    fs::write(&options.output, &body)?;
+
+    println!(
+        "Exported {} bytes to {}, in {:?}",
+        body.len(),
+        options.output.display(),
+        start.elapsed()
+    );
+    Ok(())
+}
@@ -1,5 +1,5 @@
 //! Helper that helps with interactive editing, including multi-line parsing and validation,
-//! and auto-completion for file name during creating external table.
+//! auto-completion for sql keywords and commands, and for file name during creating external table.
 
 use datafusion::sql::parser::{DFParser, Statement};
 use rustyline::completion::{Completer, FilenameCompleter, Pair};
@@ -33,6 +33,129 @@ fn is_open_quote_for_location(line: &str, pos: usize) -> bool {
     false
 }
 
+const KEYWORDS: &[&str] = &[
+    "ALTER",
+    "AND",
+    "AS",
+    "ASC",
+    "BETWEEN",
+    "BY",
+    "COPY",
+    "CREATE",
+    "DATABASE",
+    "DATABASES",
+    "DELETE",
+    "DESC",
+    "DESCRIBE",
+    "DISTINCT",
+    "DROP",
+    "EXPLAIN",
+    "EXTERNAL",
+    "FIELD",
+    "FROM",
+    "FULL",
+    "GRANT",
+    "GROUP",
+    "HAVING",
+    "IF",
+    "IN",
+    "INNER",
+    "INSERT",
+    "INTO",
+    "IS",
+    "JOIN",
+    "KILL",
+    "LEFT",
+    "LIKE",
+    "LIMIT",
+    "NOT",
+    "NULL",
+    "OFFSET",
+    "ON",
+    "OR",
+    "ORDER",
+    "OUTER",
+    "PRECISION",
+    "QUERIES",
+    "REPLICA",
+    "REVOKE",
+    "RIGHT",
+    "ROLE",
+    "SELECT",
+    "SERIES",
+    "SET",
+    "SHARD",
+    "SHOW",
+    "STREAM",
+    "TABLE",
+    "TABLES",
+    "TAG",
+    "TAGS",
+    "TENANT",
+    "TIME",
+    "TTL",
+    "UNION",
+    "UPDATE",
+    "USE",
+    "USER",
+    "VALUES",
+    "VNODE_DURATION",
+    "WHERE",
+    "WITH",
+];
+
+const COMMANDS: &[&str] = &[
+    "\\?", "\\c", "\\d", "\\db", "\\h", "\\pset", "\\q", "\\quiet", "\\w",
+];
+
+/// Complete the word before `pos` with the sql keywords, or with the
+/// commands if the line is a command.
+fn complete_word(line: &str, pos: usize) -> (usize, Vec<Pair>) {
+    let start = line[..pos]
+        .rfind(|c: char| !(c.is_ascii_alphanumeric() || c == '_' || c == '\\'))
+        .map(|i| i + 1)
+        .unwrap_or(0);
+    let word = &line[start..pos];
+    if word.is_empty() {
+        return (pos, vec![]);
+    }
+
+    let candidates = if word.starts_with('\\') {
+        if start != 0 {
+            return (pos, vec![]);
+        }
+        COMMANDS
+            .iter()
+            .filter(|c| c.starts_with(word))
+            .map(|c| c.to_string())
+            .collect::<Vec<_>>()
+    } else {
+        let upper = word.to_ascii_uppercase();
+        // keep the case the user is typing in
+        let lower = word.chars().all(|c| !c.is_ascii_uppercase());
+        KEYWORDS
+            .iter()
+            .filter(|k| k.starts_with(&upper))
+            .map(|k| {
+                if lower {
+                    k.to_ascii_lowercase()
+                } else {
+                    k.to_string()
+                }
+            })
+            .collect()
+    };
+
+    let pairs = candidates
+        .into_iter()
+        .map(|c| Pair {
+            display: c.clone(),
+            replacement: c,
+        })
+        .collect();
+    (start, pairs)
+}
+
 impl Completer for CliHelper {
     type Candidate = Pair;
 
@@ -45,7 +168,7 @@ impl Completer for CliHelper {
         if is_open_quote_for_location(line, pos) {
             self.completer.complete(line, pos, ctx)
         } else {
-            Ok((0, Vec::with_capacity(0)))
+            Ok(complete_word(line, pos))
         }
     }
 }
@@ -71,3 +194,29 @@ impl Validator for CliHelper {
 }
 
 impl Helper for CliHelper {}
+
+#[cfg(test)]
+mod test {
+    use super::complete_word;
+
+    fn replacements(line: &str) -> (usize, Vec<String>) {
+        let (start, pairs) = complete_word(line, line.len());
+        (start, pairs.into_iter().map(|p| p.replacement).collect())
+    }
+
+    #[test]
+    fn test_complete_word() {
+        assert_eq!(replacements("SEL"), (0, vec!["SELECT".to_string()]));
+        assert_eq!(replacements("select * fr"), (9, vec!["from".to_string()]));
+        assert_eq!(
+            replacements("show datab"),
+            (5, vec!["database".to_string(), "databases".to_string()])
+        );
+        assert_eq!(
+            replacements("\\q"),
+            (0, vec!["\\q".to_string(), "\\quiet".to_string()])
+        );
+        assert!(replacements("select ").1.is_empty());
+        assert!(replacements("select \\q").1.is_empty());
+    }
+}
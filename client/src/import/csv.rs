@@ -0,0 +1,327 @@
+//! Convert the rows of a CSV file to points, the columns are mapped by the
+//! annotations in the header, e.g.
+//!
+//! ```text
+//! station|tag,temperature|double,visibility|long,time|dateTime:RFC3339
+//! XiaoMaiDao,20.5,50,2023-11-14T22:13:20Z
+//! ```
+//!
+//! The annotation follows the column name after a `|`:
+//!
+//! - `measurement`: the measurement of the row.
+//! - `tag`: a tag.
+//! - `double`, `long`, `unsignedLong`, `boolean`, `string`: a field of the type.
+//! - `field`: a field, a boolean, a float or a string as the value looks like.
+//! - `dateTime`, `dateTime:number`, `dateTime:RFC3339`: the timestamp, numbers
+//!   are in the session precision.
+//! - `ignore`: the column is skipped.
+//!
+//! Columns without annotation are fields, the one named `time` is the
+//! timestamp and the ones in [`CsvOptions::tags`] are tags.
+
+use std::io::Read;
+use std::str::FromStr;
+
+use anyhow::{anyhow, bail};
+use chrono::DateTime;
+use csv::{ReaderBuilder, StringRecord};
+
+use super::Importer;
+use crate::v2::{FieldValue, Point};
+use crate::Result;
+
+const TIME_COLUMN: &str = "time";
+
+#[derive(Debug, Clone, Default)]
+pub struct CsvOptions {
+    /// Measurement of the rows without a measurement column.
+    pub measurement: Option<String>,
+    /// Columns written as tags, besides the ones annotated.
+    pub tags: Vec<String>,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum FieldType {
+    Infer,
+    Double,
+    Long,
+    UnsignedLong,
+    Boolean,
+    String,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum TimeFormat {
+    Auto,
+    Number,
+    Rfc3339,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum ColumnType {
+    Measurement,
+    Tag,
+    Field(FieldType),
+    Time(TimeFormat),
+    Ignore,
+}
+
+impl FromStr for ColumnType {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        let column_type = match s {
+            "measurement" => Self::Measurement,
+            "tag" => Self::Tag,
+            "field" => Self::Field(FieldType::Infer),
+            "double" => Self::Field(FieldType::Double),
+            "long" => Self::Field(FieldType::Long),
+            "unsignedLong" => Self::Field(FieldType::UnsignedLong),
+            "boolean" => Self::Field(FieldType::Boolean),
+            "string" => Self::Field(FieldType::String),
+            "dateTime" => Self::Time(TimeFormat::Auto),
+            "dateTime:number" => Self::Time(TimeFormat::Number),
+            "dateTime:RFC3339" => Self::Time(TimeFormat::Rfc3339),
+            "ignore" | "ignored" => Self::Ignore,
+            _ => bail!("unknown column annotation '{}'", s),
+        };
+        Ok(column_type)
+    }
+}
+
+#[derive(Debug)]
+struct Column {
+    name: String,
+    column_type: ColumnType,
+}
+
+/// Converts the records of a CSV file to points.
+#[derive(Debug)]
+pub struct CsvConverter {
+    columns: Vec<Column>,
+    measurement: Option<String>,
+    precision: String,
+}
+
+impl CsvConverter {
+    /// Build the converter from the header, `precision` is the precision
+    /// of the timestamps written.
+    pub fn new(header: &StringRecord, options: &CsvOptions, precision: &str) -> Result<Self> {
+        let mut columns = Vec::with_capacity(header.len());
+        for title in header {
+            let column = match title.rsplit_once('|') {
+                Some((name, annotation)) => Column {
+                    name: name.trim().to_string(),
+                    column_type: annotation.trim().parse()?,
+                },
+                None => {
+                    let name = title.trim();
+                    let column_type = if options.tags.iter().any(|t| t == name) {
+                        ColumnType::Tag
+                    } else if name == TIME_COLUMN {
+                        ColumnType::Time(TimeFormat::Auto)
+                    } else {
+                        ColumnType::Field(FieldType::Infer)
+                    };
+                    Column {
+                        name: name.to_string(),
+                        column_type,
+                    }
+                }
+            };
+            columns.push(column);
+        }
+
+        let has_measurement = columns
+            .iter()
+            .any(|c| c.column_type == ColumnType::Measurement);
+        if !has_measurement && options.measurement.is_none() {
+            bail!("no measurement column in the header and no measurement given");
+        }
+        if columns
+            .iter()
+            .filter(|c| matches!(c.column_type, ColumnType::Time(_)))
+            .count()
+            > 1
+        {
+            bail!("more than one timestamp column in the header");
+        }
+
+        Ok(Self {
+            columns,
+            measurement: options.measurement.clone(),
+            precision: precision.to_ascii_uppercase(),
+        })
+    }
+
+    pub fn convert(&self, record: &StringRecord) -> Result<Point> {
+        let measurement = self
+            .columns
+            .iter()
+            .zip(record.iter())
+            .find(|(c, v)| c.column_type == ColumnType::Measurement && !v.is_empty())
+            .map(|(_, v)| v.to_string())
+            .or_else(|| self.measurement.clone())
+            .ok_or_else(|| anyhow!("measurement is empty"))?;
+
+        let mut point = Point::new(measurement);
+        for (column, value) in self.columns.iter().zip(record.iter()) {
+            // empty cells are missing values
+            if value.is_empty() {
+                continue;
+            }
+            point = match column.column_type {
+                ColumnType::Measurement | ColumnType::Ignore => point,
+                ColumnType::Tag => point.tag(&column.name, value),
+                ColumnType::Field(field_type) => {
+                    let value = parse_field(field_type, value)
+                        .map_err(|e| anyhow!("invalid value of '{}': {}", column.name, e))?;
+                    point.field(&column.name, value)
+                }
+                ColumnType::Time(format) => {
+                    let ts = self
+                        .parse_time(format, value)
+                        .map_err(|e| anyhow!("invalid timestamp '{}': {}", value, e))?;
+                    point.timestamp(ts)
+                }
+            };
+        }
+        if !point.has_fields() {
+            bail!("no field");
+        }
+        Ok(point)
+    }
+
+    fn parse_time(&self, format: TimeFormat, value: &str) -> Result<i64> {
+        let number = match format {
+            TimeFormat::Number => return Ok(value.parse()?),
+            TimeFormat::Auto => value.parse::<i64>().ok(),
+            TimeFormat::Rfc3339 => None,
+        };
+        if let Some(ts) = number {
+            return Ok(ts);
+        }
+
+        let time = DateTime::parse_from_rfc3339(value)?;
+        let ts = match self.precision.as_str() {
+            "MS" => Some(time.timestamp_millis()),
+            "US" => Some(time.timestamp_micros()),
+            _ => time.timestamp_nanos_opt(),
+        };
+        ts.ok_or_else(|| anyhow!("out of range"))
+    }
+}
+
+pub(super) async fn import_csv(
+    importer: &mut Importer<'_>,
+    reader: impl Read,
+    options: &CsvOptions,
+) -> Result<()> {
+    let mut reader = ReaderBuilder::new()
+        .comment(Some(b'#'))
+        .flexible(true)
+        .from_reader(reader);
+    let precision = importer.ctx.get_session_config().precision.clone();
+    let converter = CsvConverter::new(reader.headers()?, options, &precision)?;
+
+    let mut record = StringRecord::new();
+    while reader.read_record(&mut record)? {
+        let line_number = record.position().map_or(0, |p| p.line());
+        match converter.convert(&record) {
+            Ok(point) => importer.push_line(&point.to_line_protocol()).await?,
+            Err(e) => importer.skip_line(line_number, e)?,
+        }
+    }
+    Ok(())
+}
+
+fn parse_field(field_type: FieldType, value: &str) -> Result<FieldValue> {
+    let value = match field_type {
+        FieldType::Infer => {
+            if let Ok(b) = parse_bool(value) {
+                FieldValue::Bool(b)
+            } else if let Ok(f) = value.parse::<f64>() {
+                FieldValue::F64(f)
+            } else {
+                FieldValue::Str(value.to_string())
+            }
+        }
+        FieldType::Double => FieldValue::F64(value.parse()?),
+        FieldType::Long => FieldValue::I64(value.parse()?),
+        FieldType::UnsignedLong => FieldValue::U64(value.parse()?),
+        FieldType::Boolean => FieldValue::Bool(parse_bool(value)?),
+        FieldType::String => FieldValue::Str(value.to_string()),
+    };
+    Ok(value)
+}
+
+fn parse_bool(value: &str) -> Result<bool> {
+    match value {
+        "true" | "TRUE" | "True" | "t" | "T" => Ok(true),
+        "false" | "FALSE" | "False" | "f" | "F" => Ok(false),
+        _ => bail!("not a boolean"),
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use csv::StringRecord;
+
+    use super::{CsvConverter, CsvOptions};
+
+    #[test]
+    fn test_csv_converter() {
+        let header = StringRecord::from(vec![
+            "station|tag",
+            "city",
+            "temperature|double",
+            "visibility|long",
+            "status",
+            "alarm",
+            "note|ignore",
+            "time|dateTime:RFC3339",
+        ]);
+        let options = CsvOptions {
+            measurement: Some("air".to_string()),
+            tags: vec!["city".to_string()],
+        };
+        let converter = CsvConverter::new(&header, &options, "ms").unwrap();
+
+        let record = StringRecord::from(vec![
+            "XiaoMaiDao",
+            "",
+            "20",
+            "50",
+            "ok",
+            "false",
+            "x",
+            "2023-11-14T22:13:20Z",
+        ]);
+        assert_eq!(
+            converter.convert(&record).unwrap().to_line_protocol(),
+            "air,station=XiaoMaiDao temperature=20,visibility=50i,status=\"ok\",alarm=false 1700000000000"
+        );
+
+        let record = StringRecord::from(vec!["a", "b", "", "", "", "", "", ""]);
+        assert!(converter.convert(&record).is_err());
+        let record = StringRecord::from(vec!["a", "b", "x", "", "", "", "", ""]);
+        assert!(converter.convert(&record).is_err());
+    }
+
+    #[test]
+    fn test_csv_header() {
+        let options = CsvOptions::default();
+        let header = StringRecord::from(vec!["m|measurement", "f", "time"]);
+        let converter = CsvConverter::new(&header, &options, "ns").unwrap();
+        let record = StringRecord::from(vec!["cpu", "1.5", "1"]);
+        assert_eq!(
+            converter.convert(&record).unwrap().to_line_protocol(),
+            "cpu f=1.5 1"
+        );
+
+        let header = StringRecord::from(vec!["f", "time"]);
+        assert!(CsvConverter::new(&header, &options, "ns").is_err());
+        let header = StringRecord::from(vec!["m|measurement", "f|int"]);
+        assert!(CsvConverter::new(&header, &options, "ns").is_err());
+    }
+}
@@ -0,0 +1,301 @@
+//! Import the line protocol export files, e.g. the files exported by
+//! `influx_inspect export`, which look like
+//!
+//! ```text
+//! # DDL
+//! CREATE DATABASE db0 WITH NAME autogen
+//! # DML
+//! # CONTEXT-DATABASE:db0
+//! # CONTEXT-RETENTION-POLICY:autogen
+//! cpu,host=a value=1 1700000000000000000
+//! ```
+//!
+//! or CSV files, see [`csv`], or parquet files, see [`parquet`].
+
+use std::fs::File;
+use std::io::{BufRead, BufReader, Read};
+use std::path::PathBuf;
+use std::time::{Duration, Instant};
+
+use anyhow::bail;
+use flate2::read::GzDecoder;
+use indicatif::ProgressBar;
+
+use self::csv::CsvOptions;
+use self::parquet::ParquetOptions;
+use crate::ctx::SessionContext;
+use crate::{progress_bar, Result};
+
+pub mod csv;
+pub mod parquet;
+
+pub enum ImportFormat {
+    LineProtocol,
+    Csv(CsvOptions),
+    Parquet(ParquetOptions),
+}
+
+pub struct ImportOptions {
+    pub path: PathBuf,
+    /// Whether the file is gzipped, files ending with `.gz` are always.
+    pub compressed: bool,
+    /// Max number of lines in a write request.
+    pub batch_size: usize,
+    /// Max number of points written per second.
+    pub points_per_second: Option<u64>,
+    pub format: ImportFormat,
+}
+
+#[derive(Debug, PartialEq, Eq)]
+enum ExportLine<'a> {
+    Ddl,
+    Dml,
+    Database(&'a str),
+    Comment,
+    Statement(&'a str),
+}
+
+fn parse_export_line(line: &str) -> ExportLine<'_> {
+    let line = line.trim();
+    if line.is_empty() {
+        return ExportLine::Comment;
+    }
+    match line.strip_prefix('#').map(str::trim) {
+        Some("DDL") => ExportLine::Ddl,
+        Some("DML") => ExportLine::Dml,
+        Some(comment) => match comment.strip_prefix("CONTEXT-DATABASE:") {
+            Some(db) => ExportLine::Database(db.trim()),
+            None => ExportLine::Comment,
+        },
+        None => ExportLine::Statement(line),
+    }
+}
+
+/// Translate an InfluxQL DDL to sql, returns `None` if CnosDB has no
+/// counterpart of it, e.g. retention policies.
+fn translate_ddl(ddl: &str) -> Option<String> {
+    const CREATE_DATABASE: &str = "CREATE DATABASE";
+
+    let upper = ddl.to_ascii_uppercase();
+    if upper.starts_with("CREATE RETENTION POLICY") {
+        return None;
+    }
+    if upper.starts_with(CREATE_DATABASE) {
+        let rest = ddl[CREATE_DATABASE.len()..].trim_start();
+        let name = match rest.strip_prefix('"') {
+            Some(quoted) => quoted.split('"').next().unwrap_or_default(),
+            None => rest.split_whitespace().next().unwrap_or_default(),
+        };
+        return Some(format!("CREATE DATABASE IF NOT EXISTS \"{}\"", name));
+    }
+    Some(ddl.to_string())
+}
+
+/// Counts the bytes read from the file in the progress bar.
+struct ProgressReader<R> {
+    inner: R,
+    pb: ProgressBar,
+}
+
+impl<R: Read> Read for ProgressReader<R> {
+    fn read(&mut self, buf: &mut [u8]) -> std::io::Result<usize> {
+        let n = self.inner.read(buf)?;
+        self.pb.inc(n as u64);
+        Ok(n)
+    }
+}
+
+struct Importer<'a> {
+    ctx: &'a mut SessionContext,
+    options: &'a ImportOptions,
+    batch: Vec<u8>,
+    batch_lines: usize,
+    start: Instant,
+    written: u64,
+    failed: u64,
+}
+
+impl<'a> Importer<'a> {
+    async fn exec_ddl(&mut self, ddl: &str) -> Result<()> {
+        let Some(sql) = translate_ddl(ddl) else {
+            eprintln!("Skip unsupported statement: {}", ddl);
+            return Ok(());
+        };
+        let res = match self.ctx.sql(sql.clone()).await {
+            Ok(resp) => SessionContext::parse_response(resp).await.map(|_| ()),
+            Err(e) => Err(e),
+        };
+        if let Err(e) = res {
+            eprintln!("Failed to execute {}: {}", sql, e);
+            if self.ctx.get_session_config().error_stop {
+                bail!("{} execute fail, STOP!", sql);
+            }
+        }
+        Ok(())
+    }
+
+    /// Count the line failed to convert.
+    fn skip_line(&mut self, line_number: u64, e: anyhow::Error) -> Result<()> {
+        self.failed += 1;
+        eprintln!("Skip line {}: {}", line_number, e);
+        if self.ctx.get_session_config().error_stop {
+            bail!("line {} convert fail, STOP!", line_number);
+        }
+        Ok(())
+    }
+
+    async fn push_line(&mut self, line: &str) -> Result<()> {
+        self.batch.extend_from_slice(line.as_bytes());
+        self.batch.push(b'\n');
+        self.batch_lines += 1;
+        if self.batch_lines >= self.options.batch_size {
+            self.flush().await?;
+        }
+        Ok(())
+    }
+
+    async fn flush(&mut self) -> Result<()> {
+        if self.batch_lines == 0 {
+            return Ok(());
+        }
+        let body = std::mem::take(&mut self.batch);
+        let lines = std::mem::take(&mut self.batch_lines) as u64;
+
+        match self.ctx.write_line_protocol(body).await {
+            Ok(_) => self.written += lines,
+            Err(e) => {
+                self.failed += lines;
+                eprintln!(
+                    "Failed to write {} lines into {}: {}",
+                    lines,
+                    self.ctx.get_database(),
+                    e
+                );
+                if self.ctx.get_session_config().error_stop {
+                    bail!("write fail, STOP!");
+                }
+            }
+        }
+
+        if let Some(pps) = self.options.points_per_second.filter(|pps| *pps > 0) {
+            let expected =
+                Duration::from_secs_f64((self.written + self.failed) as f64 / pps as f64);
+            let elapsed = self.start.elapsed();
+            if expected > elapsed {
+                tokio::time::sleep(expected - elapsed).await;
+            }
+        }
+        Ok(())
+    }
+}
+
+/// Open the text file, counting the bytes read in the progress bar.
+fn open_text_file(options: &ImportOptions) -> Result<(Box<dyn BufRead>, ProgressBar)> {
+    let file = File::open(&options.path)?;
+    let pb = progress_bar::new_with_size(file.metadata()?.len());
+    let file = ProgressReader {
+        inner: file,
+        pb: pb.clone(),
+    };
+    let compressed = options.compressed || options.path.extension().is_some_and(|ext| ext == "gz");
+    let reader: Box<dyn BufRead> = if compressed {
+        Box::new(BufReader::new(GzDecoder::new(file)))
+    } else {
+        Box::new(BufReader::new(file))
+    };
+    Ok((reader, pb))
+}
+
+pub async fn import(ctx: &mut SessionContext, options: &ImportOptions) -> Result<()> {
+    let mut importer = Importer {
+        ctx,
+        options,
+        batch: vec![],
+        batch_lines: 0,
+        start: Instant::now(),
+        written: 0,
+        failed: 0,
+    };
+    match &options.format {
+        ImportFormat::LineProtocol => {
+            let (reader, pb) = open_text_file(options)?;
+            import_line_protocol(&mut importer, reader).await?;
+            pb.finish();
+        }
+        ImportFormat::Csv(csv_options) => {
+            let (reader, pb) = open_text_file(options)?;
+            csv::import_csv(&mut importer, reader, csv_options).await?;
+            pb.finish();
+        }
+        ImportFormat::Parquet(parquet_options) => {
+            parquet::import_parquet(&mut importer, parquet_options).await?;
+        }
+    }
+    importer.flush().await?;
+
+    println!(
+        "Imported {} lines, {} failed, in {:?}",
+        importer.written,
+        importer.failed,
+        importer.start.elapsed()
+    );
+    Ok(())
+}
+
+async fn import_line_protocol(importer: &mut Importer<'_>, reader: Box<dyn BufRead>) -> Result<()> {
+    // plain line protocol files have no sections
+    let mut in_ddl = false;
+    for line in reader.lines() {
+        let line = line?;
+        match parse_export_line(&line) {
+            ExportLine::Ddl => in_ddl = true,
+            ExportLine::Dml => in_ddl = false,
+            ExportLine::Database(db) => {
+                importer.flush().await?;
+                importer.ctx.set_database(db);
+            }
+            ExportLine::Comment => {}
+            ExportLine::Statement(ddl) if in_ddl => importer.exec_ddl(ddl).await?,
+            ExportLine::Statement(line) => importer.push_line(line).await?,
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod test {
+    use super::{parse_export_line, translate_ddl, ExportLine};
+
+    #[test]
+    fn test_parse_export_line() {
+        assert_eq!(parse_export_line("# DDL"), ExportLine::Ddl);
+        assert_eq!(parse_export_line("# DML"), ExportLine::Dml);
+        assert_eq!(
+            parse_export_line("# CONTEXT-DATABASE:db0"),
+            ExportLine::Database("db0")
+        );
+        assert_eq!(
+            parse_export_line("# CONTEXT-RETENTION-POLICY:autogen"),
+            ExportLine::Comment
+        );
+        assert_eq!(parse_export_line("  "), ExportLine::Comment);
+        assert_eq!(
+            parse_export_line("cpu,host=a value=1 1\r"),
+            ExportLine::Statement("cpu,host=a value=1 1")
+        );
+    }
+
+    #[test]
+    fn test_translate_ddl() {
+        assert_eq!(
+            translate_ddl("CREATE DATABASE db0 WITH NAME autogen").unwrap(),
+            "CREATE DATABASE IF NOT EXISTS \"db0\""
+        );
+        assert_eq!(
+            translate_ddl("create database \"db 1\" WITH DURATION 1d").unwrap(),
+            "CREATE DATABASE IF NOT EXISTS \"db 1\""
+        );
+        assert!(translate_ddl("CREATE RETENTION POLICY rp ON db0 DURATION 1d").is_none());
+        assert_eq!(translate_ddl("SHOW DATABASES").unwrap(), "SHOW DATABASES");
+    }
+}
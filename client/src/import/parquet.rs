@@ -0,0 +1,219 @@
+//! Convert the rows of a parquet file, e.g. exported by the `export`
+//! command, to points.
+//!
+//! The timestamp column is the time of the points, the columns in
+//! [`ParquetOptions::tags`] are tags and the others are fields.
+
+use std::fs::File;
+
+use anyhow::{anyhow, bail};
+use datafusion::arrow::array::{Array, ArrayRef, AsArray};
+use datafusion::arrow::compute::cast;
+use datafusion::arrow::datatypes::{DataType, Float64Type, Int64Type, TimeUnit, UInt64Type};
+use datafusion::arrow::record_batch::RecordBatch;
+use datafusion::parquet::arrow::arrow_reader::ParquetRecordBatchReaderBuilder;
+use indicatif::ProgressBar;
+
+use super::Importer;
+use crate::v2::{FieldValue, Point};
+use crate::Result;
+
+#[derive(Debug, Clone, Default)]
+pub struct ParquetOptions {
+    /// Measurement of the rows, defaults to the file name without extension.
+    pub measurement: Option<String>,
+    /// Columns written as tags.
+    pub tags: Vec<String>,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum ColumnKind {
+    Tag,
+    Field,
+    Time,
+}
+
+struct Column {
+    name: String,
+    kind: ColumnKind,
+    /// Casted to the type of the values of point.
+    array: ArrayRef,
+}
+
+fn prepare_columns(
+    batch: &RecordBatch,
+    tags: &[String],
+    time_unit: TimeUnit,
+) -> Result<Vec<Column>> {
+    let schema = batch.schema();
+    let mut has_time = false;
+    let mut columns = Vec::with_capacity(batch.num_columns());
+    for (field, array) in schema.fields().iter().zip(batch.columns()) {
+        let name = field.name().to_string();
+        let (kind, data_type) = if tags.contains(&name) {
+            (ColumnKind::Tag, DataType::Utf8)
+        } else {
+            match array.data_type() {
+                DataType::Timestamp(_, _) if !has_time => {
+                    has_time = true;
+                    (ColumnKind::Time, DataType::Timestamp(time_unit, None))
+                }
+                DataType::Float16 | DataType::Float32 | DataType::Float64 => {
+                    (ColumnKind::Field, DataType::Float64)
+                }
+                DataType::Int8 | DataType::Int16 | DataType::Int32 | DataType::Int64 => {
+                    (ColumnKind::Field, DataType::Int64)
+                }
+                DataType::UInt8 | DataType::UInt16 | DataType::UInt32 | DataType::UInt64 => {
+                    (ColumnKind::Field, DataType::UInt64)
+                }
+                DataType::Boolean => (ColumnKind::Field, DataType::Boolean),
+                DataType::Utf8 | DataType::LargeUtf8 => (ColumnKind::Field, DataType::Utf8),
+                other => bail!("unsupported type {} of column '{}'", other, name),
+            }
+        };
+
+        let mut array = cast(array, &data_type)?;
+        if kind == ColumnKind::Time {
+            array = cast(&array, &DataType::Int64)?;
+        }
+        columns.push(Column { name, kind, array });
+    }
+    Ok(columns)
+}
+
+fn field_value(array: &ArrayRef, row: usize) -> FieldValue {
+    match array.data_type() {
+        DataType::Float64 => FieldValue::F64(array.as_primitive::<Float64Type>().value(row)),
+        DataType::Int64 => FieldValue::I64(array.as_primitive::<Int64Type>().value(row)),
+        DataType::UInt64 => FieldValue::U64(array.as_primitive::<UInt64Type>().value(row)),
+        DataType::Boolean => FieldValue::Bool(array.as_boolean().value(row)),
+        _ => FieldValue::Str(array.as_string::<i32>().value(row).to_string()),
+    }
+}
+
+/// Convert the rows of the batch to points, the points without fields
+/// are kept to tell the rows to skip.
+fn batch_to_points(
+    batch: &RecordBatch,
+    measurement: &str,
+    tags: &[String],
+    time_unit: TimeUnit,
+) -> Result<Vec<Point>> {
+    let columns = prepare_columns(batch, tags, time_unit)?;
+    let mut points = Vec::with_capacity(batch.num_rows());
+    for row in 0..batch.num_rows() {
+        let mut point = Point::new(measurement);
+        for column in &columns {
+            if column.array.is_null(row) {
+                continue;
+            }
+            point = match column.kind {
+                ColumnKind::Tag => {
+                    point.tag(&column.name, column.array.as_string::<i32>().value(row))
+                }
+                ColumnKind::Field => point.field(&column.name, field_value(&column.array, row)),
+                ColumnKind::Time => {
+                    point.timestamp(column.array.as_primitive::<Int64Type>().value(row))
+                }
+            };
+        }
+        points.push(point);
+    }
+    Ok(points)
+}
+
+pub(super) async fn import_parquet(
+    importer: &mut Importer<'_>,
+    options: &ParquetOptions,
+) -> Result<()> {
+    let import_options = importer.options;
+    let measurement = match &options.measurement {
+        Some(measurement) => measurement.clone(),
+        None => import_options
+            .path
+            .file_stem()
+            .map(|stem| stem.to_string_lossy().to_string())
+            .ok_or_else(|| anyhow!("no measurement given"))?,
+    };
+    let time_unit = match importer
+        .ctx
+        .get_session_config()
+        .precision
+        .to_ascii_uppercase()
+        .as_str()
+    {
+        "MS" => TimeUnit::Millisecond,
+        "US" => TimeUnit::Microsecond,
+        _ => TimeUnit::Nanosecond,
+    };
+
+    let builder = ParquetRecordBatchReaderBuilder::try_new(File::open(&import_options.path)?)?;
+    let pb = ProgressBar::new(builder.metadata().file_metadata().num_rows() as u64);
+    let reader = builder.with_batch_size(import_options.batch_size).build()?;
+
+    let mut row_number = 0;
+    for batch in reader {
+        let batch = batch?;
+        for point in batch_to_points(&batch, &measurement, &options.tags, time_unit)? {
+            row_number += 1;
+            if point.has_fields() {
+                importer.push_line(&point.to_line_protocol()).await?;
+            } else {
+                importer.skip_line(row_number, anyhow!("no field"))?;
+            }
+        }
+        pb.inc(batch.num_rows() as u64);
+    }
+    pb.finish();
+    Ok(())
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use datafusion::arrow::array::{
+        ArrayRef, BooleanArray, Float64Array, Int32Array, StringArray, TimestampNanosecondArray,
+    };
+    use datafusion::arrow::datatypes::TimeUnit;
+    use datafusion::arrow::record_batch::RecordBatch;
+
+    use super::batch_to_points;
+
+    #[test]
+    fn test_batch_to_points() {
+        let batch = RecordBatch::try_from_iter(vec![
+            (
+                "time",
+                Arc::new(TimestampNanosecondArray::from(vec![1_000_000, 2_000_000])) as ArrayRef,
+            ),
+            (
+                "station",
+                Arc::new(StringArray::from(vec![Some("a b"), None])) as ArrayRef,
+            ),
+            (
+                "temperature",
+                Arc::new(Float64Array::from(vec![Some(20.5), None])) as ArrayRef,
+            ),
+            (
+                "visibility",
+                Arc::new(Int32Array::from(vec![Some(50), None])) as ArrayRef,
+            ),
+            (
+                "alarm",
+                Arc::new(BooleanArray::from(vec![Some(true), None])) as ArrayRef,
+            ),
+        ])
+        .unwrap();
+
+        let tags = vec!["station".to_string()];
+        let points = batch_to_points(&batch, "air", &tags, TimeUnit::Millisecond).unwrap();
+        assert_eq!(points.len(), 2);
+        assert_eq!(
+            points[0].to_line_protocol(),
+            "air,station=a\\ b temperature=20.5,visibility=50i,alarm=true 1"
+        );
+        assert!(!points[1].has_fields());
+    }
+}
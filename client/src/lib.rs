@@ -1,15 +1,21 @@
 #![doc = include_str!("../README.md")]
 pub const CNOSDB_CLI_VERSION: &str = env!("CARGO_PKG_VERSION");
 
+pub mod bench;
 pub mod command;
 pub mod config;
 pub mod ctx;
+pub mod datagen;
 pub mod exec;
+pub mod export;
 pub mod functions;
 pub mod helper;
+pub mod import;
+pub mod migrate;
 pub mod print_format;
 pub mod print_options;
 pub mod progress_bar;
+pub mod v2;
 
 pub type Result<T> = std::result::Result<T, anyhow::Error>;
 
@@ -4,9 +4,13 @@ use std::{env, fs};
 use clap::builder::PossibleValuesParser;
 use clap::{value_parser, Args, Parser, Subcommand};
 use client::ctx::{SessionConfig, SessionContext};
+use client::export::ExportOptions;
+use client::import::csv::CsvOptions;
+use client::import::parquet::ParquetOptions;
+use client::import::{ImportFormat, ImportOptions};
 use client::print_format::PrintFormat;
 use client::print_options::PrintOptions;
-use client::{exec, CNOSDB_CLI_VERSION};
+use client::{exec, export, import, CNOSDB_CLI_VERSION};
 use config::VERSION;
 use http_protocol::encoding::Encoding;
 
@@ -84,6 +88,14 @@ struct CliArgs {
     )]
     file: Vec<String>,
 
+    /// Execute the SQL statements, then exit
+    #[arg(
+        short, long,
+        num_args = 1..,
+        conflicts_with = "file",
+    )]
+    execute: Vec<String>,
+
     /// Run the provided files on startup instead of ~/.cnosdbrc
     #[arg(
         long,
@@ -163,6 +175,10 @@ enum CliCommand {
     DumpDDL(DumpDDL),
 
     RestoreDumpDDL(RestoreDumpDDL),
+
+    Import(Import),
+
+    Export(Export),
 }
 
 /// Dump ddl to files, Support multi tenants
@@ -185,12 +201,60 @@ struct RestoreDumpDDL {
     files: Vec<String>,
 }
 
+/// Import line protocol file, e.g. exported by `influx_inspect export`, CSV or parquet file
+#[derive(Debug, Clone, Args, PartialOrd, PartialEq)]
+struct Import {
+    /// File to import
+    #[arg()]
+    path: PathBuf,
+
+    /// Format of the file, columns of CSV file are mapped by the header like `station|tag,temperature|double`
+    #[arg(long, default_value = "line_protocol", value_parser = PossibleValuesParser::new(["line_protocol", "csv", "parquet"]))]
+    format: String,
+
+    /// Whether the file is gzipped
+    #[arg(long, default_value_t = false)]
+    compressed: bool,
+
+    /// Max number of lines in a write request
+    #[arg(long, default_value_t = 5000)]
+    batch_size: usize,
+
+    /// Max number of points written per second
+    #[arg(long)]
+    pps: Option<u64>,
+
+    /// Measurement of the CSV rows without a measurement column, or of the parquet rows
+    #[arg(long)]
+    measurement: Option<String>,
+
+    /// Columns of the CSV or parquet file imported as tags
+    #[arg(long, value_delimiter = ',')]
+    tag: Vec<String>,
+}
+
+/// Export query result to parquet file
+#[derive(Debug, Clone, Args, PartialOrd, PartialEq)]
+struct Export {
+    /// Parquet file to write
+    #[arg()]
+    output: PathBuf,
+
+    /// Query to export
+    #[arg(long, conflicts_with = "table")]
+    sql: Option<String>,
+
+    /// Table to export, all the rows
+    #[arg(long, required_unless_present = "sql")]
+    table: Option<String>,
+}
+
 #[tokio::main]
 pub async fn main() -> Result<(), anyhow::Error> {
     env_logger::init();
     let args = CliArgs::parse();
 
-    if !args.quiet && args.subcommand.is_none() {
+    if !args.quiet && args.subcommand.is_none() && args.execute.is_empty() {
         println!("CnosDB CLI v{}", CNOSDB_CLI_VERSION);
         println!("Input arguments: {:?}", args);
     }
@@ -241,9 +305,46 @@ pub async fn main() -> Result<(), anyhow::Error> {
             let files = r.files;
             return exec::exec_from_files(files, &mut ctx, &print_options).await;
         }
+        Some(CliCommand::Import(i)) => {
+            let format = match i.format.as_str() {
+                "csv" => ImportFormat::Csv(CsvOptions {
+                    measurement: i.measurement,
+                    tags: i.tag,
+                }),
+                "parquet" => ImportFormat::Parquet(ParquetOptions {
+                    measurement: i.measurement,
+                    tags: i.tag,
+                }),
+                _ => ImportFormat::LineProtocol,
+            };
+            let options = ImportOptions {
+                path: i.path,
+                compressed: i.compressed,
+                batch_size: i.batch_size.max(1),
+                points_per_second: i.pps,
+                format,
+            };
+            return import::import(&mut ctx, &options).await;
+        }
+        Some(CliCommand::Export(e)) => {
+            let sql = match (e.sql, e.table) {
+                (Some(sql), _) => sql,
+                (None, Some(table)) => format!("SELECT * FROM \"{}\"", table),
+                (None, None) => unreachable!("--sql or --table is required"),
+            };
+            let options = ExportOptions {
+                sql,
+                output: e.output,
+            };
+            return export::export(&ctx, &options).await;
+        }
         None => {}
     }
 
+    if !args.execute.is_empty() {
+        return exec::exec_from_commands(args.execute, &mut ctx, &print_options).await;
+    }
+
     let files = args.file.clone();
     let rc = match args.rc {
         Some(file) => file,
@@ -0,0 +1,81 @@
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::PathBuf;
+
+use serde::{Deserialize, Serialize};
+
+use super::influx::quote_ident;
+use crate::Result;
+
+/// Progress of the data migration, the end time of the data copied of
+/// each measurement, saved in a file to resume from.
+#[derive(Debug, Default, Serialize, Deserialize)]
+pub struct Checkpoint {
+    #[serde(skip)]
+    path: PathBuf,
+    /// `"db"."rp"."measurement"` to the end time in nanoseconds, exclusive.
+    progress: BTreeMap<String, i64>,
+}
+
+impl Checkpoint {
+    pub fn load(path: PathBuf) -> Result<Self> {
+        let mut checkpoint = if path.exists() {
+            serde_json::from_slice::<Checkpoint>(&fs::read(&path)?)?
+        } else {
+            Checkpoint::default()
+        };
+        checkpoint.path = path;
+        Ok(checkpoint)
+    }
+
+    fn key(db: &str, rp: &str, measurement: &str) -> String {
+        format!(
+            "{}.{}.{}",
+            quote_ident(db),
+            quote_ident(rp),
+            quote_ident(measurement)
+        )
+    }
+
+    pub fn get(&self, db: &str, rp: &str, measurement: &str) -> Option<i64> {
+        self.progress.get(&Self::key(db, rp, measurement)).copied()
+    }
+
+    /// Record the data before `end` is copied, and save the checkpoint.
+    pub fn set(&mut self, db: &str, rp: &str, measurement: &str, end: i64) -> Result<()> {
+        self.progress.insert(Self::key(db, rp, measurement), end);
+        self.save()
+    }
+
+    fn save(&self) -> Result<()> {
+        // a crash while writing must not lose the previous checkpoint
+        let tmp = self.path.with_extension("tmp");
+        fs::write(&tmp, serde_json::to_vec_pretty(self)?)?;
+        fs::rename(&tmp, &self.path)?;
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::Checkpoint;
+
+    #[test]
+    fn test_checkpoint() {
+        let dir = std::env::temp_dir().join("cnosdb_migrate_test_checkpoint");
+        let _ = std::fs::remove_dir_all(&dir);
+        std::fs::create_dir_all(&dir).unwrap();
+        let path = dir.join("checkpoint.json");
+
+        let mut checkpoint = Checkpoint::load(path.clone()).unwrap();
+        assert_eq!(checkpoint.get("db0", "autogen", "cpu"), None);
+        checkpoint.set("db0", "autogen", "cpu", 100).unwrap();
+        checkpoint.set("db0", "autogen", "cpu", 200).unwrap();
+        checkpoint.set("db0", "autogen", "mem", 300).unwrap();
+
+        let checkpoint = Checkpoint::load(path).unwrap();
+        assert_eq!(checkpoint.get("db0", "autogen", "cpu"), Some(200));
+        assert_eq!(checkpoint.get("db0", "autogen", "mem"), Some(300));
+        assert_eq!(checkpoint.get("db0", "rp", "mem"), None);
+    }
+}
@@ -0,0 +1,168 @@
+//! A minimal client of the InfluxDB 1.x http api.
+
+use anyhow::{anyhow, bail};
+use serde::Deserialize;
+use serde_json::Value;
+
+use crate::Result;
+
+#[derive(Debug, Default, Deserialize)]
+pub struct Series {
+    #[serde(default)]
+    pub name: String,
+    #[serde(default)]
+    pub columns: Vec<String>,
+    #[serde(default)]
+    pub values: Vec<Vec<Value>>,
+}
+
+impl Series {
+    pub fn column_index(&self, column: &str) -> Option<usize> {
+        self.columns.iter().position(|c| c == column)
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct StatementResult {
+    #[serde(default)]
+    series: Vec<Series>,
+    error: Option<String>,
+}
+
+#[derive(Debug, Deserialize)]
+struct QueryResponse {
+    #[serde(default)]
+    results: Vec<StatementResult>,
+    error: Option<String>,
+}
+
+pub struct InfluxClient {
+    http_client: reqwest::Client,
+    url: String,
+    user: Option<String>,
+    password: Option<String>,
+}
+
+impl InfluxClient {
+    pub fn new(url: &str, user: Option<String>, password: Option<String>) -> Self {
+        Self {
+            http_client: reqwest::Client::new(),
+            url: url.trim_end_matches('/').to_string(),
+            user,
+            password,
+        }
+    }
+
+    /// Run the InfluxQL, the timestamps are answered in nanoseconds.
+    pub async fn query(&self, db: Option<&str>, q: &str) -> Result<Vec<Series>> {
+        let mut params = vec![("q", q), ("epoch", "ns")];
+        if let Some(db) = db {
+            params.push(("db", db));
+        }
+        let mut builder = self
+            .http_client
+            .get(format!("{}/query", self.url))
+            .query(&params);
+        if let Some(user) = &self.user {
+            builder = builder.basic_auth(user, self.password.as_deref());
+        }
+
+        let resp = builder.send().await?;
+        let status = resp.status();
+        let body = resp.text().await?;
+        let resp = serde_json::from_str::<QueryResponse>(&body)
+            .map_err(|_| anyhow!("{}, details: {}", status, body))?;
+        if let Some(e) = resp.error {
+            bail!("{}: {}", q, e);
+        }
+
+        let mut series = vec![];
+        for result in resp.results {
+            if let Some(e) = result.error {
+                bail!("{}: {}", q, e);
+            }
+            series.extend(result.series);
+        }
+        Ok(series)
+    }
+
+    /// Run the InfluxQL, returns the first column of the rows as strings,
+    /// e.g. the names of `SHOW DATABASES`.
+    pub async fn query_names(&self, db: Option<&str>, q: &str) -> Result<Vec<String>> {
+        let names = self
+            .query(db, q)
+            .await?
+            .into_iter()
+            .flat_map(|s| s.values)
+            .filter_map(|row| row.first().and_then(Value::as_str).map(str::to_string))
+            .collect();
+        Ok(names)
+    }
+}
+
+/// Quote the identifier of InfluxQL.
+pub fn quote_ident(ident: &str) -> String {
+    format!("\"{}\"", ident.replace('"', "\\\""))
+}
+
+/// Parse the durations answered by InfluxDB, e.g. `168h0m0s`, to seconds,
+/// the sub-second parts are ignored.
+pub fn parse_influx_duration(s: &str) -> Option<u64> {
+    let mut secs = 0_u64;
+    let mut rest = s;
+    while !rest.is_empty() {
+        let digits = rest.find(|c: char| !c.is_ascii_digit())?;
+        if digits == 0 {
+            return None;
+        }
+        let n = rest[..digits].parse::<u64>().ok()?;
+        rest = &rest[digits..];
+
+        let unit_len = rest
+            .find(|c: char| c.is_ascii_digit())
+            .unwrap_or(rest.len());
+        let factor = match &rest[..unit_len] {
+            "w" => 7 * 24 * 3600,
+            "d" => 24 * 3600,
+            "h" => 3600,
+            "m" => 60,
+            "s" => 1,
+            "ms" | "u" | "us" | "µs" | "ns" => 0,
+            _ => return None,
+        };
+        secs = secs.checked_add(n.checked_mul(factor)?)?;
+        rest = &rest[unit_len..];
+    }
+    Some(secs)
+}
+
+#[cfg(test)]
+mod test {
+    use super::{parse_influx_duration, quote_ident, QueryResponse};
+
+    #[test]
+    fn test_parse_influx_duration() {
+        assert_eq!(parse_influx_duration("0s"), Some(0));
+        assert_eq!(parse_influx_duration("168h0m0s"), Some(168 * 3600));
+        assert_eq!(parse_influx_duration("1h30m15s"), Some(5415));
+        assert_eq!(parse_influx_duration("2w"), Some(14 * 24 * 3600));
+        assert_eq!(parse_influx_duration("1s500ms"), Some(1));
+        assert_eq!(parse_influx_duration("10"), None);
+        assert_eq!(parse_influx_duration("h"), None);
+        assert_eq!(parse_influx_duration("1y"), None);
+    }
+
+    #[test]
+    fn test_query_response() {
+        let body = r#"{"results":[{"statement_id":0,"series":[{"name":"databases","columns":["name"],"values":[["_internal"],["db0"]]}]}]}"#;
+        let resp = serde_json::from_str::<QueryResponse>(body).unwrap();
+        assert_eq!(resp.results[0].series[0].values.len(), 2);
+        assert_eq!(resp.results[0].series[0].column_index("name"), Some(0));
+
+        let body = r#"{"results":[{"statement_id":0,"error":"database not found: db1"}]}"#;
+        let resp = serde_json::from_str::<QueryResponse>(body).unwrap();
+        assert!(resp.results[0].error.is_some());
+
+        assert_eq!(quote_ident("a\"b"), "\"a\\\"b\"");
+    }
+}
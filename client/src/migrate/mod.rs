@@ -0,0 +1,541 @@
+//! Migrate an InfluxDB 1.x instance to CnosDB:
+//!
+//! - databases are created with the TTL of their default retention policy,
+//!   the data of all the retention policies is copied into them.
+//! - users are created with the given password, admins are the owners of
+//!   the tenant, the others get a role with their grants.
+//! - continuous queries are reported to be rewritten as stream tables.
+//! - the data is copied in time windows, the progress is saved in a
+//!   checkpoint file to resume from, and the new writes can be followed
+//!   until the cutover.
+
+use std::collections::{HashMap, HashSet};
+use std::path::PathBuf;
+use std::sync::Arc;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+use serde_json::Value;
+
+use self::checkpoint::Checkpoint;
+use self::influx::{parse_influx_duration, quote_ident, InfluxClient, Series};
+use crate::v2::{BatchWriter, Client, ClientOptions, FieldValue, Point, WriterOptions};
+use crate::Result;
+
+mod checkpoint;
+mod influx;
+
+const INFLUX_INTERNAL_DATABASE: &str = "_internal";
+
+pub struct MigrateOptions {
+    pub influx_url: String,
+    pub influx_user: Option<String>,
+    pub influx_password: Option<String>,
+    pub cnosdb: ClientOptions,
+    /// Databases to migrate, all but `_internal` if empty.
+    pub databases: Vec<String>,
+    /// Password of the users created, InfluxDB does not tell the passwords,
+    /// users are not migrated if not set.
+    pub user_password: Option<String>,
+    pub skip_meta: bool,
+    pub skip_data: bool,
+    /// Start of the data copied in nanoseconds, defaults to the first point
+    /// of each measurement.
+    pub start: Option<i64>,
+    /// Length of the time range copied in a query.
+    pub window: Duration,
+    pub checkpoint: PathBuf,
+    pub batch_size: usize,
+    /// Keep copying the new writes until interrupted.
+    pub follow: bool,
+    pub follow_interval: Duration,
+}
+
+/// Tags and field types of a measurement.
+#[derive(Debug, Default)]
+struct MeasurementSchema {
+    tags: HashSet<String>,
+    fields: HashMap<String, String>,
+}
+
+impl MeasurementSchema {
+    /// Convert a row of `SELECT *` to a point, returns `None` if the row
+    /// has no field.
+    fn to_point(&self, measurement: &str, columns: &[String], row: &[Value]) -> Option<Point> {
+        let mut point = Point::new(measurement);
+        for (column, value) in columns.iter().zip(row) {
+            if value.is_null() {
+                continue;
+            }
+            if column == "time" {
+                if let Some(ts) = value.as_i64() {
+                    point = point.timestamp(ts);
+                }
+            } else if self.tags.contains(column) {
+                if let Some(tag) = value.as_str() {
+                    point = point.tag(column, tag);
+                }
+            } else if let Some(field_type) = self.fields.get(column) {
+                if let Some(field) = field_value(field_type, value) {
+                    point = point.field(column, field);
+                }
+            }
+        }
+        point.has_fields().then_some(point)
+    }
+}
+
+fn field_value(field_type: &str, value: &Value) -> Option<FieldValue> {
+    match field_type {
+        "float" => value.as_f64().map(FieldValue::F64),
+        "integer" => value.as_i64().map(FieldValue::I64),
+        "unsigned" => value.as_u64().map(FieldValue::U64),
+        "boolean" => value.as_bool().map(FieldValue::Bool),
+        "string" => value.as_str().map(FieldValue::from),
+        _ => None,
+    }
+}
+
+/// Convert the duration of a retention policy to the TTL of a database.
+fn ttl(secs: u64) -> String {
+    const DAY: u64 = 24 * 3600;
+    match secs {
+        0 => "INF".to_string(),
+        s if s % DAY == 0 => format!("{}d", s / DAY),
+        s if s % 3600 == 0 => format!("{}h", s / 3600),
+        s if s % 60 == 0 => format!("{}m", s / 60),
+        s => format!("{}s", s),
+    }
+}
+
+fn quote_sql_ident(ident: &str) -> String {
+    format!("\"{}\"", ident.replace('"', "\"\""))
+}
+
+fn quote_sql_string(s: &str) -> String {
+    format!("'{}'", s.replace('\'', "''"))
+}
+
+fn now_nanos() -> i64 {
+    SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map_or(0, |d| d.as_nanos() as i64)
+}
+
+pub struct Migrator {
+    options: MigrateOptions,
+    influx: InfluxClient,
+    cnosdb: Client,
+    checkpoint: Checkpoint,
+}
+
+impl Migrator {
+    pub fn new(options: MigrateOptions) -> Result<Self> {
+        let influx = InfluxClient::new(
+            &options.influx_url,
+            options.influx_user.clone(),
+            options.influx_password.clone(),
+        );
+        let cnosdb = Client::new(options.cnosdb.clone())?;
+        let checkpoint = Checkpoint::load(options.checkpoint.clone())?;
+        Ok(Self {
+            options,
+            influx,
+            cnosdb,
+            checkpoint,
+        })
+    }
+
+    pub async fn run(&mut self) -> Result<()> {
+        let databases = self.databases().await?;
+        if !self.options.skip_meta {
+            for db in &databases {
+                self.migrate_database(db).await?;
+            }
+            self.migrate_users(&databases).await?;
+            self.report_continuous_queries(&databases).await?;
+        }
+
+        if !self.options.skip_data {
+            let end = now_nanos();
+            for db in &databases {
+                self.migrate_data(db, end).await?;
+            }
+            if self.options.follow {
+                self.follow(&databases).await?;
+            }
+        }
+        Ok(())
+    }
+
+    async fn databases(&self) -> Result<Vec<String>> {
+        if !self.options.databases.is_empty() {
+            return Ok(self.options.databases.clone());
+        }
+        let mut databases = self.influx.query_names(None, "SHOW DATABASES").await?;
+        databases.retain(|db| db != INFLUX_INTERNAL_DATABASE);
+        Ok(databases)
+    }
+
+    /// Execute the ddl, the failures are reported but not stop the
+    /// migration, e.g. the user is already added in the tenant.
+    async fn execute(&self, sql: &str) {
+        if let Err(e) = self.cnosdb.query(sql).await {
+            eprintln!("Failed to execute {}: {}", sql, e);
+        }
+    }
+
+    async fn retention_policies(&self, db: &str) -> Result<Vec<String>> {
+        let q = format!("SHOW RETENTION POLICIES ON {}", quote_ident(db));
+        self.influx.query_names(Some(db), &q).await
+    }
+
+    async fn migrate_database(&self, db: &str) -> Result<()> {
+        let q = format!("SHOW RETENTION POLICIES ON {}", quote_ident(db));
+        let series = self.influx.query(Some(db), &q).await?;
+        let mut duration = 0;
+        for s in &series {
+            let (Some(name), Some(dur), Some(default)) = (
+                s.column_index("name"),
+                s.column_index("duration"),
+                s.column_index("default"),
+            ) else {
+                continue;
+            };
+            for row in &s.values {
+                if row[default].as_bool() == Some(true) {
+                    duration = row[dur]
+                        .as_str()
+                        .and_then(parse_influx_duration)
+                        .unwrap_or_default();
+                } else {
+                    println!(
+                        "Data of retention policy {}.{} is copied into database {}",
+                        db,
+                        row[name].as_str().unwrap_or_default(),
+                        db
+                    );
+                }
+            }
+        }
+
+        let ttl = ttl(duration);
+        let sql = format!(
+            "CREATE DATABASE IF NOT EXISTS {} WITH TTL '{}'",
+            quote_sql_ident(db),
+            ttl
+        );
+        self.execute(&sql).await;
+        println!("Created database {} with TTL {}", db, ttl);
+        Ok(())
+    }
+
+    async fn migrate_users(&self, databases: &[String]) -> Result<()> {
+        let Some(password) = &self.options.user_password else {
+            println!("Skip the users, give the password of the users created to migrate them");
+            return Ok(());
+        };
+        let tenant = quote_sql_ident(&self.options.cnosdb.tenant);
+
+        let series = self.influx.query(None, "SHOW USERS").await?;
+        for s in &series {
+            let (Some(user), Some(admin)) = (s.column_index("user"), s.column_index("admin"))
+            else {
+                continue;
+            };
+            for row in &s.values {
+                let Some(name) = row[user].as_str() else {
+                    continue;
+                };
+                let user = quote_sql_ident(name);
+                self.execute(&format!(
+                    "CREATE USER IF NOT EXISTS {} WITH PASSWORD={}, MUST_CHANGE_PASSWORD=true",
+                    user,
+                    quote_sql_string(password)
+                ))
+                .await;
+
+                if row[admin].as_bool() == Some(true) {
+                    self.execute(&format!(
+                        "ALTER TENANT {} ADD USER {} AS owner",
+                        tenant, user
+                    ))
+                    .await;
+                    println!("Created user {} as owner of the tenant", name);
+                    continue;
+                }
+
+                let grants = self.grants(name, databases).await?;
+                if grants.is_empty() {
+                    println!("Created user {} without privileges", name);
+                    continue;
+                }
+                let role = quote_sql_ident(&format!("{}_role", name));
+                self.execute(&format!(
+                    "CREATE ROLE IF NOT EXISTS {} INHERIT member",
+                    role
+                ))
+                .await;
+                for (db, privilege) in &grants {
+                    self.execute(&format!(
+                        "GRANT {} ON DATABASE {} TO ROLE {}",
+                        privilege,
+                        quote_sql_ident(db),
+                        role
+                    ))
+                    .await;
+                }
+                self.execute(&format!(
+                    "ALTER TENANT {} ADD USER {} AS {}",
+                    tenant, user, role
+                ))
+                .await;
+                println!("Created user {} with role {}", name, role);
+            }
+        }
+        Ok(())
+    }
+
+    /// Privileges of the user on the databases migrated, as `READ`, `WRITE`
+    /// or `ALL`.
+    async fn grants(&self, user: &str, databases: &[String]) -> Result<Vec<(String, String)>> {
+        let q = format!("SHOW GRANTS FOR {}", quote_ident(user));
+        let mut grants = vec![];
+        for s in self.influx.query(None, &q).await? {
+            let (Some(database), Some(privilege)) =
+                (s.column_index("database"), s.column_index("privilege"))
+            else {
+                continue;
+            };
+            for row in &s.values {
+                let (Some(db), Some(privilege)) = (row[database].as_str(), row[privilege].as_str())
+                else {
+                    continue;
+                };
+                if !databases.iter().any(|d| d == db) {
+                    continue;
+                }
+                let privilege = match privilege {
+                    "READ" => "READ",
+                    "WRITE" => "WRITE",
+                    "ALL PRIVILEGES" => "ALL",
+                    _ => continue,
+                };
+                grants.push((db.to_string(), privilege.to_string()));
+            }
+        }
+        Ok(grants)
+    }
+
+    async fn report_continuous_queries(&self, databases: &[String]) -> Result<()> {
+        for s in self.influx.query(None, "SHOW CONTINUOUS QUERIES").await? {
+            if !databases.contains(&s.name) {
+                continue;
+            }
+            let (Some(name), Some(query)) = (s.column_index("name"), s.column_index("query"))
+            else {
+                continue;
+            };
+            for row in &s.values {
+                println!(
+                    "Continuous query {} on {} is not migrated, rewrite it as a stream table: {}",
+                    row[name].as_str().unwrap_or_default(),
+                    s.name,
+                    row[query].as_str().unwrap_or_default()
+                );
+            }
+        }
+        Ok(())
+    }
+
+    async fn measurement_schema(
+        &self,
+        db: &str,
+        rp: &str,
+        measurement: &str,
+    ) -> Result<MeasurementSchema> {
+        let from = format!("{}.{}", quote_ident(rp), quote_ident(measurement));
+        let mut schema = MeasurementSchema::default();
+
+        let q = format!("SHOW TAG KEYS FROM {}", from);
+        schema.tags = self
+            .influx
+            .query_names(Some(db), &q)
+            .await?
+            .into_iter()
+            .collect();
+
+        let q = format!("SHOW FIELD KEYS FROM {}", from);
+        for row in self
+            .influx
+            .query(Some(db), &q)
+            .await?
+            .into_iter()
+            .flat_map(|s| s.values)
+        {
+            if let [Value::String(key), Value::String(field_type), ..] = row.as_slice() {
+                schema.fields.insert(key.clone(), field_type.clone());
+            }
+        }
+        Ok(schema)
+    }
+
+    /// Time of the first point of the measurement, `None` if it is empty.
+    async fn first_time(&self, db: &str, rp: &str, measurement: &str) -> Result<Option<i64>> {
+        let q = format!(
+            "SELECT * FROM {}.{}.{} ORDER BY time ASC LIMIT 1",
+            quote_ident(db),
+            quote_ident(rp),
+            quote_ident(measurement)
+        );
+        let series = self.influx.query(Some(db), &q).await?;
+        let time = series.first().and_then(|s| {
+            let time = s.column_index("time")?;
+            s.values.first()?.get(time)?.as_i64()
+        });
+        Ok(time)
+    }
+
+    /// Copy the data of the database before `end`, from the checkpoint.
+    async fn migrate_data(&mut self, db: &str, end: i64) -> Result<()> {
+        let client = Client::new(self.options.cnosdb.clone().with_database(db))?;
+        let writer = BatchWriter::new(
+            Arc::new(client),
+            WriterOptions::default().with_batch_size(self.options.batch_size),
+        )?;
+
+        for rp in self.retention_policies(db).await? {
+            let q = format!("SHOW MEASUREMENTS ON {}", quote_ident(db));
+            for measurement in self.influx.query_names(Some(db), &q).await? {
+                let start = match self.checkpoint.get(db, &rp, &measurement) {
+                    Some(start) => start,
+                    None => match self.options.start {
+                        Some(start) => start,
+                        None => match self.first_time(db, &rp, &measurement).await? {
+                            Some(start) => start,
+                            None => continue,
+                        },
+                    },
+                };
+                self.copy_range(&writer, db, &rp, &measurement, start, end)
+                    .await?;
+            }
+        }
+        writer.close().await
+    }
+
+    async fn copy_range(
+        &mut self,
+        writer: &BatchWriter,
+        db: &str,
+        rp: &str,
+        measurement: &str,
+        start: i64,
+        end: i64,
+    ) -> Result<()> {
+        if start >= end {
+            return Ok(());
+        }
+        let schema = self.measurement_schema(db, rp, measurement).await?;
+        let window = self.options.window.as_nanos().clamp(1, i64::MAX as u128) as i64;
+
+        let mut window_start = start;
+        while window_start < end {
+            let window_end = window_start.saturating_add(window).min(end);
+            let q = format!(
+                "SELECT * FROM {}.{}.{} WHERE time >= {} AND time < {}",
+                quote_ident(db),
+                quote_ident(rp),
+                quote_ident(measurement),
+                window_start,
+                window_end
+            );
+
+            let mut points = 0;
+            for Series {
+                columns, values, ..
+            } in self.influx.query(Some(db), &q).await?
+            {
+                for row in &values {
+                    if let Some(point) = schema.to_point(measurement, &columns, row) {
+                        writer.write(point).await?;
+                        points += 1;
+                    }
+                }
+            }
+            // the checkpoint moves on only if the data is written
+            writer.flush().await?;
+            self.checkpoint.set(db, rp, measurement, window_end)?;
+            if points > 0 {
+                println!(
+                    "Copied {} points of {}.{}.{} before {}",
+                    points, db, rp, measurement, window_end
+                );
+            }
+            window_start = window_end;
+        }
+        Ok(())
+    }
+
+    /// Copy the new writes periodically until Ctrl-C, the points written
+    /// with timestamps older than a interval may be missed.
+    async fn follow(&mut self, databases: &[String]) -> Result<()> {
+        let interval = self.options.follow_interval;
+        println!(
+            "Copying the new writes every {:?}, press Ctrl-C to stop after the cutover",
+            interval
+        );
+        loop {
+            tokio::select! {
+                _ = tokio::signal::ctrl_c() => break,
+                _ = tokio::time::sleep(interval) => {}
+            }
+            let end = now_nanos().saturating_sub(interval.as_nanos() as i64);
+            for db in databases {
+                self.migrate_data(db, end).await?;
+            }
+        }
+        println!("Stopped following the new writes");
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use serde_json::json;
+
+    use super::{ttl, MeasurementSchema};
+
+    #[test]
+    fn test_ttl() {
+        assert_eq!(ttl(0), "INF");
+        assert_eq!(ttl(7 * 24 * 3600), "7d");
+        assert_eq!(ttl(25 * 3600), "25h");
+        assert_eq!(ttl(90), "90s");
+        assert_eq!(ttl(120), "2m");
+    }
+
+    #[test]
+    fn test_row_to_point() {
+        let schema = MeasurementSchema {
+            tags: ["host".to_string()].into_iter().collect(),
+            fields: [
+                ("usage".to_string(), "float".to_string()),
+                ("count".to_string(), "integer".to_string()),
+                ("ok".to_string(), "boolean".to_string()),
+            ]
+            .into_iter()
+            .collect(),
+        };
+        let columns = ["time", "count", "host", "ok", "usage"].map(String::from);
+
+        let row = [json!(1), json!(3), json!("a"), json!(true), json!(2)];
+        let point = schema.to_point("cpu", &columns, &row).unwrap();
+        assert_eq!(
+            point.to_line_protocol(),
+            "cpu,host=a count=3i,ok=true,usage=2 1"
+        );
+
+        let row = [json!(1), json!(null), json!("a"), json!(null), json!(null)];
+        assert!(schema.to_point("cpu", &columns, &row).is_none());
+    }
+}
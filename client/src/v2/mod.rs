@@ -0,0 +1,271 @@
+//! Client library of CnosDB, writes [`Point`]s, in batches with retries by
+//! [`BatchWriter`], and runs queries decoding the rows from JSON.
+
+use std::fmt::{self, Display};
+
+use anyhow::anyhow;
+use http_protocol::header::{ACCEPT, APPLICATION_JSON};
+use http_protocol::http_client::HttpClient;
+use http_protocol::parameter::{SqlParam, WriteParam};
+use http_protocol::status_code::OK;
+use reqwest::StatusCode;
+use serde::de::DeserializeOwned;
+use serde_json::{Map, Value};
+
+pub use self::point::{FieldValue, Point};
+pub use self::writer::{BatchWriter, WriterOptions};
+use crate::ctx::{API_V1_SQL_PATH, API_V1_WRITE_PATH, DEFAULT_DATABASE, DEFAULT_PRECISION};
+use crate::Result;
+
+mod point;
+mod writer;
+
+pub const DEFAULT_HOST: &str = "localhost";
+pub const DEFAULT_PORT: u16 = 8902;
+pub const DEFAULT_USER: &str = "root";
+pub const DEFAULT_TENANT: &str = "cnosdb";
+
+/// A row of query result, column name to value.
+pub type Row = Map<String, Value>;
+
+#[derive(Debug, Clone)]
+pub struct ClientOptions {
+    pub host: String,
+    pub port: u16,
+    pub use_ssl: bool,
+    pub ca_cert_files: Vec<String>,
+    pub user: String,
+    pub password: Option<String>,
+    pub tenant: String,
+    pub database: String,
+    /// Precision of the timestamps written, ns, us or ms.
+    pub precision: String,
+}
+
+impl Default for ClientOptions {
+    fn default() -> Self {
+        Self {
+            host: DEFAULT_HOST.to_string(),
+            port: DEFAULT_PORT,
+            use_ssl: false,
+            ca_cert_files: vec![],
+            user: DEFAULT_USER.to_string(),
+            password: None,
+            tenant: DEFAULT_TENANT.to_string(),
+            database: DEFAULT_DATABASE.to_string(),
+            precision: DEFAULT_PRECISION.to_string(),
+        }
+    }
+}
+
+impl ClientOptions {
+    pub fn with_host(mut self, host: impl Into<String>) -> Self {
+        self.host = host.into();
+        self
+    }
+
+    pub fn with_port(mut self, port: u16) -> Self {
+        self.port = port;
+        self
+    }
+
+    pub fn with_ssl(mut self, use_ssl: bool, ca_cert_files: Vec<String>) -> Self {
+        self.use_ssl = use_ssl;
+        self.ca_cert_files = ca_cert_files;
+        self
+    }
+
+    pub fn with_user(mut self, user: impl Into<String>, password: Option<String>) -> Self {
+        self.user = user.into();
+        self.password = password;
+        self
+    }
+
+    pub fn with_tenant(mut self, tenant: impl Into<String>) -> Self {
+        self.tenant = tenant.into();
+        self
+    }
+
+    pub fn with_database(mut self, database: impl Into<String>) -> Self {
+        self.database = database.into();
+        self
+    }
+
+    pub fn with_precision(mut self, precision: impl Into<String>) -> Self {
+        self.precision = precision.into();
+        self
+    }
+}
+
+/// Error of a write request.
+#[derive(Debug)]
+pub struct WriteError {
+    /// None if the request was not answered.
+    pub status: Option<StatusCode>,
+    pub message: String,
+    /// Whether the write may succeed if sent again.
+    pub retryable: bool,
+}
+
+impl WriteError {
+    /// Build the error from a failed response, the write apis answer with
+    /// a json telling if the error is retryable, the status code is used
+    /// for the older servers.
+    fn from_response(status: StatusCode, body: &str) -> Self {
+        let retryable = serde_json::from_str::<Value>(body)
+            .ok()
+            .and_then(|v| v.get("retryable").and_then(Value::as_bool))
+            .unwrap_or_else(|| status.is_server_error() || status == StatusCode::TOO_MANY_REQUESTS);
+        Self {
+            status: Some(status),
+            message: body.to_string(),
+            retryable,
+        }
+    }
+}
+
+impl Display for WriteError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self.status {
+            Some(status) => write!(f, "{}, body: {}", status, self.message),
+            None => write!(f, "{}", self.message),
+        }
+    }
+}
+
+impl std::error::Error for WriteError {}
+
+pub struct Client {
+    options: ClientOptions,
+    http_client: HttpClient,
+}
+
+impl Client {
+    pub fn new(options: ClientOptions) -> Result<Self> {
+        let http_client = HttpClient::new(
+            &options.host,
+            options.port,
+            options.use_ssl,
+            false,
+            &options.ca_cert_files,
+        )?;
+        Ok(Self {
+            options,
+            http_client,
+        })
+    }
+
+    pub fn options(&self) -> &ClientOptions {
+        &self.options
+    }
+
+    /// Write the points in one request, see [`BatchWriter`] to write them
+    /// in batches.
+    pub async fn write_points(&self, points: &[Point]) -> std::result::Result<(), WriteError> {
+        let mut body = String::new();
+        for point in points {
+            point.write_line_protocol(&mut body);
+            body.push('\n');
+        }
+        self.write_line_protocol(body.into_bytes()).await
+    }
+
+    pub async fn write_line_protocol(&self, body: Vec<u8>) -> std::result::Result<(), WriteError> {
+        let param = WriteParam {
+            precision: Some(self.options.precision.clone()),
+            tenant: Some(self.options.tenant.clone()),
+            db: Some(self.options.database.clone()),
+            partial_write: None,
+            non_finite_float: None,
+            unicode_escape: None,
+            format: None,
+            field_label: None,
+            ttl: None,
+        };
+
+        let resp = self
+            .http_client
+            .post(API_V1_WRITE_PATH)
+            .basic_auth::<&str, &str>(&self.options.user, self.options.password.as_deref())
+            .query(&param)
+            .body(body)
+            .send()
+            .await
+            .map_err(|e| WriteError {
+                status: None,
+                message: e.to_string(),
+                retryable: true,
+            })?;
+
+        let status = resp.status();
+        if status == OK {
+            return Ok(());
+        }
+        let body = resp.text().await.unwrap_or_default();
+        Err(WriteError::from_response(status, &body))
+    }
+
+    /// Run the sql, returns the rows.
+    pub async fn query(&self, sql: &str) -> Result<Vec<Row>> {
+        self.query_as(sql).await
+    }
+
+    /// Run the sql, decodes the rows to `T`.
+    pub async fn query_as<T: DeserializeOwned>(&self, sql: &str) -> Result<Vec<T>> {
+        let param = SqlParam {
+            tenant: Some(self.options.tenant.clone()),
+            db: Some(self.options.database.clone()),
+            chunked: None,
+            target_partitions: None,
+            stream_trigger_interval: None,
+        };
+
+        let resp = self
+            .http_client
+            .post(API_V1_SQL_PATH)
+            .basic_auth::<&str, &str>(&self.options.user, self.options.password.as_deref())
+            .header(ACCEPT, APPLICATION_JSON)
+            .query(&param)
+            .body(sql.to_string())
+            .send()
+            .await?;
+
+        let status = resp.status();
+        let body = resp.bytes().await?;
+        if status != OK {
+            return Err(anyhow!(
+                "{}, details: {}",
+                status,
+                String::from_utf8_lossy(&body)
+            ));
+        }
+        // statements without result, e.g. ddl, answer an empty body
+        if body.iter().all(u8::is_ascii_whitespace) {
+            return Ok(vec![]);
+        }
+        Ok(serde_json::from_slice(&body)?)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use reqwest::StatusCode;
+
+    use super::WriteError;
+
+    #[test]
+    fn test_write_error_retryable() {
+        let body = r#"{"error_type":"parse_error","retryable":false}"#;
+        let e = WriteError::from_response(StatusCode::UNPROCESSABLE_ENTITY, body);
+        assert!(!e.retryable);
+
+        let body = r#"{"error_type":"overloaded","retryable":true}"#;
+        let e = WriteError::from_response(StatusCode::UNPROCESSABLE_ENTITY, body);
+        assert!(e.retryable);
+
+        let e = WriteError::from_response(StatusCode::SERVICE_UNAVAILABLE, "unavailable");
+        assert!(e.retryable);
+        let e = WriteError::from_response(StatusCode::BAD_REQUEST, "bad request");
+        assert!(!e.retryable);
+    }
+}
@@ -0,0 +1,177 @@
+use std::fmt::Write;
+
+/// Value of a field.
+#[derive(Debug, Clone, PartialEq)]
+pub enum FieldValue {
+    F64(f64),
+    I64(i64),
+    U64(u64),
+    Bool(bool),
+    Str(String),
+}
+
+impl From<f64> for FieldValue {
+    fn from(v: f64) -> Self {
+        Self::F64(v)
+    }
+}
+
+impl From<i64> for FieldValue {
+    fn from(v: i64) -> Self {
+        Self::I64(v)
+    }
+}
+
+impl From<u64> for FieldValue {
+    fn from(v: u64) -> Self {
+        Self::U64(v)
+    }
+}
+
+impl From<bool> for FieldValue {
+    fn from(v: bool) -> Self {
+        Self::Bool(v)
+    }
+}
+
+impl From<String> for FieldValue {
+    fn from(v: String) -> Self {
+        Self::Str(v)
+    }
+}
+
+impl From<&str> for FieldValue {
+    fn from(v: &str) -> Self {
+        Self::Str(v.to_string())
+    }
+}
+
+/// A point to write, encoded as a line of line protocol.
+///
+/// ```
+/// use client::v2::Point;
+///
+/// let point = Point::new("air")
+///     .tag("station", "XiaoMaiDao")
+///     .field("temperature", 20.5)
+///     .field("visibility", 50_i64)
+///     .timestamp(1700000000000000000);
+/// assert_eq!(
+///     point.to_line_protocol(),
+///     "air,station=XiaoMaiDao temperature=20.5,visibility=50i 1700000000000000000"
+/// );
+/// ```
+#[derive(Debug, Clone, PartialEq)]
+pub struct Point {
+    measurement: String,
+    tags: Vec<(String, String)>,
+    fields: Vec<(String, FieldValue)>,
+    timestamp: Option<i64>,
+}
+
+impl Point {
+    pub fn new(measurement: impl Into<String>) -> Self {
+        Self {
+            measurement: measurement.into(),
+            tags: vec![],
+            fields: vec![],
+            timestamp: None,
+        }
+    }
+
+    pub fn tag(mut self, key: impl Into<String>, value: impl Into<String>) -> Self {
+        self.tags.push((key.into(), value.into()));
+        self
+    }
+
+    pub fn field(mut self, key: impl Into<String>, value: impl Into<FieldValue>) -> Self {
+        self.fields.push((key.into(), value.into()));
+        self
+    }
+
+    /// Timestamp in the precision of the client, the server uses the
+    /// current time if not set.
+    pub fn timestamp(mut self, timestamp: i64) -> Self {
+        self.timestamp = Some(timestamp);
+        self
+    }
+
+    pub fn has_fields(&self) -> bool {
+        !self.fields.is_empty()
+    }
+
+    pub fn to_line_protocol(&self) -> String {
+        let mut line = String::with_capacity(64);
+        self.write_line_protocol(&mut line);
+        line
+    }
+
+    /// Append the point to `buf` as a line of line protocol, without the
+    /// trailing newline.
+    pub fn write_line_protocol(&self, buf: &mut String) {
+        escape_into(buf, &self.measurement, &[',', ' ']);
+        for (key, value) in &self.tags {
+            buf.push(',');
+            escape_into(buf, key, &[',', '=', ' ']);
+            buf.push('=');
+            escape_into(buf, value, &[',', '=', ' ']);
+        }
+        for (i, (key, value)) in self.fields.iter().enumerate() {
+            buf.push(if i == 0 { ' ' } else { ',' });
+            escape_into(buf, key, &[',', '=', ' ']);
+            buf.push('=');
+            match value {
+                FieldValue::F64(v) => {
+                    let _ = write!(buf, "{}", v);
+                }
+                FieldValue::I64(v) => {
+                    let _ = write!(buf, "{}i", v);
+                }
+                FieldValue::U64(v) => {
+                    let _ = write!(buf, "{}u", v);
+                }
+                FieldValue::Bool(v) => {
+                    let _ = write!(buf, "{}", v);
+                }
+                FieldValue::Str(v) => {
+                    buf.push('"');
+                    escape_into(buf, v, &['"', '\\']);
+                    buf.push('"');
+                }
+            }
+        }
+        if let Some(ts) = self.timestamp {
+            let _ = write!(buf, " {}", ts);
+        }
+    }
+}
+
+fn escape_into(buf: &mut String, s: &str, special: &[char]) {
+    for c in s.chars() {
+        if special.contains(&c) {
+            buf.push('\\');
+        }
+        buf.push(c);
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::Point;
+
+    #[test]
+    fn test_point_to_line_protocol() {
+        let point = Point::new("m a,b")
+            .tag("t=1", "v 1")
+            .field("f", 1.0)
+            .field("s", "say \"hi\" \\")
+            .field("u", 2_u64)
+            .field("b", true);
+        assert_eq!(
+            point.to_line_protocol(),
+            r#"m\ a\,b,t\=1=v\ 1 f=1,s="say \"hi\" \\",u=2u,b=true"#
+        );
+        assert!(point.has_fields());
+        assert!(!Point::new("m").has_fields());
+    }
+}
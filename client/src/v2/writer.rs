@@ -0,0 +1,241 @@
+use std::sync::Arc;
+use std::time::Duration;
+
+use anyhow::anyhow;
+use tokio::sync::{mpsc, oneshot};
+use tokio::task::JoinHandle;
+use tokio::time::MissedTickBehavior;
+
+use super::{Client, Point, WriteError};
+use crate::Result;
+
+#[derive(Debug, Clone)]
+pub struct WriterOptions {
+    /// Max number of points in a write request.
+    pub batch_size: usize,
+    /// Write the buffered points at least once per interval, must not be zero.
+    pub flush_interval: Duration,
+    /// Times to resend a batch failed with a retryable error.
+    pub max_retries: usize,
+    /// Delay before the first retry, doubled on each retry.
+    pub retry_interval: Duration,
+    pub max_retry_interval: Duration,
+    /// Max number of points waiting to be buffered.
+    pub channel_size: usize,
+}
+
+impl Default for WriterOptions {
+    fn default() -> Self {
+        Self {
+            batch_size: 5000,
+            flush_interval: Duration::from_secs(1),
+            max_retries: 3,
+            retry_interval: Duration::from_millis(200),
+            max_retry_interval: Duration::from_secs(10),
+            channel_size: 10000,
+        }
+    }
+}
+
+impl WriterOptions {
+    pub fn with_batch_size(mut self, batch_size: usize) -> Self {
+        self.batch_size = batch_size.max(1);
+        self
+    }
+
+    pub fn with_flush_interval(mut self, flush_interval: Duration) -> Self {
+        self.flush_interval = flush_interval;
+        self
+    }
+
+    pub fn with_retry(mut self, max_retries: usize, retry_interval: Duration) -> Self {
+        self.max_retries = max_retries;
+        self.retry_interval = retry_interval;
+        self
+    }
+
+    /// Delay before the `retry`th retry, starts from 0.
+    fn backoff(&self, retry: usize) -> Duration {
+        let factor = 1_u32.checked_shl(retry as u32).unwrap_or(u32::MAX);
+        self.retry_interval
+            .saturating_mul(factor)
+            .min(self.max_retry_interval)
+    }
+}
+
+enum Command {
+    Write(Point),
+    /// Write the buffered points, answer the errors since the last flush.
+    Flush(oneshot::Sender<Option<String>>),
+}
+
+/// Buffers the points and writes them in batches in the background,
+/// batches failed with retryable errors are resent with backoff.
+///
+/// The batches failed at last are dropped, [`BatchWriter::flush`] returns
+/// the error of them.
+pub struct BatchWriter {
+    sender: mpsc::Sender<Command>,
+    handle: JoinHandle<()>,
+}
+
+impl BatchWriter {
+    pub fn new(client: Arc<Client>, options: WriterOptions) -> Result<Self> {
+        if options.flush_interval.is_zero() {
+            return Err(anyhow!("flush interval of batch writer must not be zero"));
+        }
+        let (sender, receiver) = mpsc::channel(options.channel_size.max(1));
+        let handle = tokio::spawn(run_writer(client, options, receiver));
+        Ok(Self { sender, handle })
+    }
+
+    pub async fn write(&self, point: Point) -> Result<()> {
+        if !point.has_fields() {
+            return Err(anyhow!("point has no field: {}", point.to_line_protocol()));
+        }
+        self.sender
+            .send(Command::Write(point))
+            .await
+            .map_err(|_| anyhow!("batch writer is closed"))
+    }
+
+    /// Write the buffered points, returns an error if some batches failed
+    /// since the last flush.
+    pub async fn flush(&self) -> Result<()> {
+        let (tx, rx) = oneshot::channel();
+        self.sender
+            .send(Command::Flush(tx))
+            .await
+            .map_err(|_| anyhow!("batch writer is closed"))?;
+        match rx.await? {
+            Some(e) => Err(anyhow!(e)),
+            None => Ok(()),
+        }
+    }
+
+    /// Flush and stop the background task.
+    pub async fn close(self) -> Result<()> {
+        let res = self.flush().await;
+        drop(self.sender);
+        self.handle.await?;
+        res
+    }
+}
+
+async fn run_writer(
+    client: Arc<Client>,
+    options: WriterOptions,
+    mut receiver: mpsc::Receiver<Command>,
+) {
+    let mut ticker = tokio::time::interval(options.flush_interval);
+    ticker.set_missed_tick_behavior(MissedTickBehavior::Delay);
+
+    let mut batch = Batch::default();
+    loop {
+        tokio::select! {
+            cmd = receiver.recv() => match cmd {
+                Some(Command::Write(point)) => {
+                    batch.push(&point);
+                    if batch.points >= options.batch_size {
+                        batch.write(&client, &options).await;
+                    }
+                }
+                Some(Command::Flush(tx)) => {
+                    batch.write(&client, &options).await;
+                    let _ = tx.send(batch.take_failure());
+                }
+                None => {
+                    batch.write(&client, &options).await;
+                    break;
+                }
+            },
+            _ = ticker.tick() => batch.write(&client, &options).await,
+        }
+    }
+}
+
+#[derive(Default)]
+struct Batch {
+    buffer: String,
+    points: usize,
+    /// The first error since the last flush.
+    failure: Option<String>,
+    /// The number of points failed since the last flush.
+    failed_points: usize,
+}
+
+impl Batch {
+    fn push(&mut self, point: &Point) {
+        point.write_line_protocol(&mut self.buffer);
+        self.buffer.push('\n');
+        self.points += 1;
+    }
+
+    async fn write(&mut self, client: &Client, options: &WriterOptions) {
+        if self.points == 0 {
+            return;
+        }
+        let body = std::mem::take(&mut self.buffer).into_bytes();
+        let points = std::mem::take(&mut self.points);
+
+        if let Err(e) = write_with_retry(client, options, body).await {
+            self.failure.get_or_insert_with(|| e.to_string());
+            self.failed_points += points;
+        }
+    }
+
+    fn take_failure(&mut self) -> Option<String> {
+        let failure = self.failure.take()?;
+        let points = std::mem::take(&mut self.failed_points);
+        Some(format!("failed to write {} points: {}", points, failure))
+    }
+}
+
+async fn write_with_retry(
+    client: &Client,
+    options: &WriterOptions,
+    body: Vec<u8>,
+) -> std::result::Result<(), WriteError> {
+    let mut retry = 0;
+    loop {
+        match client.write_line_protocol(body.clone()).await {
+            Err(e) if e.retryable && retry < options.max_retries => {
+                tokio::time::sleep(options.backoff(retry)).await;
+                retry += 1;
+            }
+            res => return res,
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use super::{Batch, WriterOptions};
+
+    #[test]
+    fn test_backoff() {
+        let options = WriterOptions::default().with_retry(10, Duration::from_millis(100));
+        assert_eq!(options.backoff(0), Duration::from_millis(100));
+        assert_eq!(options.backoff(1), Duration::from_millis(200));
+        assert_eq!(options.backoff(3), Duration::from_millis(800));
+        assert_eq!(options.backoff(8), options.max_retry_interval);
+        assert_eq!(options.backoff(100), options.max_retry_interval);
+    }
+
+    #[test]
+    fn test_take_failure() {
+        let mut batch = Batch::default();
+        assert_eq!(batch.take_failure(), None);
+
+        batch.failure = Some("timeout".to_string());
+        batch.failed_points = 10;
+        assert_eq!(
+            batch.take_failure().as_deref(),
+            Some("failed to write 10 points: timeout")
+        );
+        assert_eq!(batch.take_failure(), None);
+        assert_eq!(batch.failed_points, 0);
+    }
+}
@@ -4,6 +4,26 @@ pub use reqwest::header::{HeaderValue, ACCEPT, AUTHORIZATION, CONTENT_TYPE};
 // header
 // privateKey
 pub const PRIVATE_KEY: &str = "X-CnosDB-PrivateKey";
+// the cookie of the session token issued by the login
+pub const SESSION_COOKIE: &str = "cnosdb_session";
+// skips the check of query.max_query_time_range
+pub const UNBOUNDED_TIME_RANGE: &str = "X-CnosDB-Unbounded-Time-Range";
+// returned by the writes, the queries passing it back read the written points
+pub const WRITE_TOKEN: &str = "x-cnosdb-write-token";
+// the queries passing it read the series page by page, see query.max_select_series
+pub const SERIES_CURSOR: &str = "x-cnosdb-series-cursor";
+// the queries passing it widen the time buckets to return at most so many points per series
+pub const MAX_POINTS: &str = "x-cnosdb-max-points";
+// the queries passing it align the series of the cross joined tables by time and tags
+pub const ALIGN_SERIES: &str = "x-cnosdb-align-series";
+// the INSERT INTO ... SELECT passing it runs as a job, see information_schema.queries
+pub const ASYNC_JOB: &str = "x-cnosdb-async-job";
+// version of the server, in lower case to build the header names
+pub const CNOSDB_VERSION: &str = "x-cnosdb-version";
+pub const CNOSDB_BUILD: &str = "x-cnosdb-build";
+// version of the server for the tools of InfluxDB
+pub const INFLUXDB_VERSION: &str = "x-influxdb-version";
+pub const INFLUXDB_BUILD: &str = "x-influxdb-build";
 
 // value
 pub const APPLICATION_PREFIX: &str = "application/";
@@ -13,6 +33,10 @@ pub const APPLICATION_TSV: &str = "text/tsv";
 pub const APPLICATION_JSON: &str = "application/json";
 pub const APPLICATION_NDJSON: &str = "application/nd-json";
 pub const APPLICATION_TABLE: &str = "text/table";
+pub const APPLICATION_PARQUET: &str = "application/parquet";
+pub const TEXT_PLAIN: &str = "text/plain; charset=utf-8";
+pub const APPLICATION_PROM_STREAMED: &str =
+    "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse";
 pub const APPLICATION_STAR: &str = "application/*";
 pub const STAR_STAR: &str = "*/*";
 
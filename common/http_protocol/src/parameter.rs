@@ -17,6 +17,76 @@ pub struct WriteParam {
     pub precision: Option<String>,
     pub tenant: Option<String>,
     pub db: Option<String>,
+    // Write the lines could be parsed and report the rejected ones, instead of failing the whole request.
+    pub partial_write: Option<bool>,
+    // How to handle the float field values inf and NaN: keep, reject, null or a finite number as the sentinel.
+    pub non_finite_float: Option<String>,
+    // Decode the \uXXXX escapes in string field values.
+    pub unicode_escape: Option<bool>,
+    // Format of the body: line_protocol (default) or json.
+    pub format: Option<String>,
+    // The label of the prometheus remote write whose value is the field name of the samples,
+    // instead of `value`.
+    pub field_label: Option<String>,
+    // The ttl of the written points, like "1h", set as the tag `_ttl` of the points without it.
+    pub ttl: Option<String>,
+}
+
+#[derive(Debug, Deserialize, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub struct ExportParam {
+    pub tenant: Option<String>,
+    pub db: Option<String>,
+    // The table to export, all the tables of the database if not set.
+    pub table: Option<String>,
+    // The time range [start, end) of the exported rows, in nanoseconds.
+    pub start: Option<i64>,
+    pub end: Option<i64>,
+}
+
+#[derive(Debug, Deserialize, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub struct AnnotationParam {
+    pub tenant: Option<String>,
+    pub db: Option<String>,
+    // The time range [start, end) of the listed annotations, in milliseconds.
+    pub start: Option<i64>,
+    pub end: Option<i64>,
+    // The tags the listed annotations have, like "service:api,env:prod".
+    pub tags: Option<String>,
+}
+
+#[derive(Debug, Deserialize, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub struct ChangesParam {
+    pub tenant: Option<String>,
+    pub db: Option<String>,
+    // Read the changes after the checkpoint, from the oldest change if not set.
+    pub checkpoint: Option<String>,
+    // Max number of changes to read.
+    pub limit: Option<usize>,
+    // Seconds to wait for new changes if there is none.
+    pub wait: Option<u64>,
+}
+
+#[derive(Debug, Deserialize, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub struct BackupParam {
+    pub tenant: Option<String>,
+    // The databases to back up separated by commas, all the databases of the tenant if not set.
+    pub db: Option<String>,
+    // The name of the backup, the directory under `storage.backup_path` of the node
+    // handling the request the backup is written to.
+    pub name: String,
+}
+
+#[derive(Debug, Deserialize, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub struct LogLevelParam {
+    pub level: String,
+    // The levels of the modules overriding the level, `<module>=<level>`.
+    #[serde(default)]
+    pub modules: Vec<String>,
 }
 
 #[derive(Debug, Deserialize, Serialize)]
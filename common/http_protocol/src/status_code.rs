@@ -1,6 +1,8 @@
 use reqwest::StatusCode;
 
 pub const OK: StatusCode = StatusCode::OK;
+/// 请求成功，没有消息体
+pub const NO_CONTENT: StatusCode = StatusCode::NO_CONTENT;
 /// 请求参数非法
 pub const BAD_REQUEST: StatusCode = StatusCode::BAD_REQUEST;
 /// 用户密码错误 或 用户不存在
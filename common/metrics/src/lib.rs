@@ -51,6 +51,7 @@ pub mod metric_register;
 pub mod metric_type;
 pub mod metric_value;
 pub mod prom_reporter;
+pub mod rate;
 pub mod reporter;
 
 use std::any::Any;
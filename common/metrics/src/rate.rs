@@ -0,0 +1,159 @@
+use std::borrow::Cow;
+use std::collections::BTreeMap;
+use std::time::{Duration, Instant};
+
+use crate::label::Labels;
+use crate::metric_register::MetricsRegister;
+use crate::metric_type::MetricType;
+use crate::metric_value::MetricValue;
+use crate::reporter::Reporter;
+
+type CounterKey = (Cow<'static, str>, Labels);
+
+/// Per second rate of a counter between the last two samples.
+#[derive(Debug, Clone, PartialEq)]
+pub struct MetricRate {
+    pub name: Cow<'static, str>,
+    pub labels: Labels,
+    /// Value of the counter at the last sample, in seconds for the
+    /// duration counters.
+    pub value: f64,
+    pub rate: f64,
+}
+
+/// Computes the per second rates of the counters from two consecutive
+/// samples of a register, the counters only grow so their rates tell more.
+#[derive(Debug, Default)]
+pub struct MetricRates {
+    last: Option<(Instant, BTreeMap<CounterKey, f64>)>,
+    interval: Option<Duration>,
+    rates: Vec<MetricRate>,
+}
+
+impl MetricRates {
+    pub fn sample(&mut self, register: &MetricsRegister) {
+        let mut reporter = CounterReporter::default();
+        register.report(&mut reporter);
+        self.update(Instant::now(), reporter.values);
+    }
+
+    fn update(&mut self, now: Instant, values: BTreeMap<CounterKey, f64>) {
+        if let Some((last_time, last_values)) = self.last.take() {
+            let interval = now.saturating_duration_since(last_time);
+            let secs = interval.as_secs_f64();
+            if secs > 0.0 {
+                self.interval = Some(interval);
+                self.rates = values
+                    .iter()
+                    .map(|((name, labels), value)| {
+                        // a counter new or reset since the last sample grew from 0
+                        let delta = match last_values.get(&(name.clone(), labels.clone())) {
+                            Some(last) if last <= value => value - last,
+                            _ => *value,
+                        };
+                        MetricRate {
+                            name: name.clone(),
+                            labels: labels.clone(),
+                            value: *value,
+                            rate: delta / secs,
+                        }
+                    })
+                    .collect();
+            }
+        }
+        self.last = Some((now, values));
+    }
+
+    /// Time between the two samples of the rates, `None` before the second
+    /// sample.
+    pub fn interval(&self) -> Option<Duration> {
+        self.interval
+    }
+
+    pub fn rates(&self) -> &[MetricRate] {
+        &self.rates
+    }
+}
+
+/// Collects the values of the counters.
+#[derive(Debug, Default)]
+struct CounterReporter {
+    current: Option<Cow<'static, str>>,
+    values: BTreeMap<CounterKey, f64>,
+}
+
+impl Reporter for CounterReporter {
+    fn start(
+        &mut self,
+        name: Cow<'static, str>,
+        _description: Cow<'static, str>,
+        metrics_type: MetricType,
+    ) {
+        self.current = match metrics_type {
+            MetricType::U64Counter | MetricType::DurationCounter => Some(name),
+            _ => None,
+        };
+    }
+
+    fn report(&mut self, labels: &Labels, metrics_value: MetricValue) {
+        let name = match self.current.as_ref() {
+            Some(name) => name.clone(),
+            None => return,
+        };
+        let value = match metrics_value {
+            MetricValue::U64Counter(c) => c as f64,
+            MetricValue::DurationCounter(d) => d.as_secs_f64(),
+            _ => return,
+        };
+        self.values.insert((name, labels.clone()), value);
+    }
+
+    fn stop(&mut self) {
+        self.current = None;
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::collections::BTreeMap;
+    use std::time::{Duration, Instant};
+
+    use super::MetricRates;
+    use crate::label::Labels;
+
+    #[test]
+    fn test_rates() {
+        let labels = Labels::from(&[("db", "public")]);
+        let values = |pairs: &[(&'static str, f64)]| {
+            pairs
+                .iter()
+                .map(|(name, value)| ((name.to_string().into(), labels.clone()), *value))
+                .collect::<BTreeMap<_, _>>()
+        };
+
+        let mut rates = MetricRates::default();
+        let now = Instant::now();
+        rates.update(now, values(&[("writes", 100.0), ("reset", 50.0)]));
+        assert!(rates.interval().is_none());
+        assert!(rates.rates().is_empty());
+
+        rates.update(
+            now + Duration::from_secs(10),
+            values(&[("writes", 300.0), ("reset", 20.0), ("new", 5.0)]),
+        );
+        assert_eq!(rates.interval(), Some(Duration::from_secs(10)));
+        let got = rates
+            .rates()
+            .iter()
+            .map(|r| (r.name.to_string(), r.rate))
+            .collect::<Vec<_>>();
+        assert_eq!(
+            got,
+            vec![
+                ("new".to_string(), 0.5),
+                ("reset".to_string(), 2.0),
+                ("writes".to_string(), 20.0),
+            ]
+        );
+    }
+}
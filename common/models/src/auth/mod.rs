@@ -1,6 +1,6 @@
 use bcrypt::BcryptError;
 use openssl::error::ErrorStack;
-pub use password::{bcrypt_hash, bcrypt_verify};
+pub use password::{bcrypt_hash, bcrypt_verify, check_password, set_password_policy};
 use snafu::{Backtrace, Location, Snafu};
 
 use crate::auth::privilege::DatabasePrivilege;
@@ -10,6 +10,7 @@ mod password;
 pub mod privilege;
 pub mod role;
 pub mod rsa_utils;
+pub mod session;
 pub mod user;
 
 pub type AuthResult<T> = std::result::Result<T, AuthError>;
@@ -25,6 +26,12 @@ pub enum AuthError {
     #[snafu(display("Password not set"))]
     PasswordNotSet,
 
+    #[snafu(display("Sessions are disabled, the session secret is not set"))]
+    SessionSecretNotSet,
+
+    #[snafu(display("Weak password: {}", reason))]
+    WeakPassword { reason: String },
+
     #[snafu(display("Access denied for user '{}' (using {}) {}", user_name, auth_type, err))]
     AccessDenied {
         user_name: String,
@@ -1,9 +1,84 @@
+use config::tskv::PasswordPolicyConfig;
+use parking_lot::RwLock;
+
 use crate::auth::AuthError;
 
+static PASSWORD_POLICY: RwLock<Option<PasswordPolicyConfig>> = RwLock::new(None);
+
+/// Sets the policy of the passwords hashed in this process,
+/// the default policy is used if it's never set.
+pub fn set_password_policy(policy: PasswordPolicyConfig) {
+    *PASSWORD_POLICY.write() = Some(policy);
+}
+
+fn password_policy() -> PasswordPolicyConfig {
+    PASSWORD_POLICY.read().clone().unwrap_or_default()
+}
+
+/// Checks whether the password meets the requirements of the policy.
+pub fn check_password(password: &str) -> Result<(), AuthError> {
+    check_password_with_policy(password, &password_policy())
+}
+
+fn check_password_with_policy(
+    password: &str,
+    policy: &PasswordPolicyConfig,
+) -> Result<(), AuthError> {
+    let mut unmet = vec![];
+    if password.chars().count() < policy.min_length {
+        unmet.push(format!("at least {} characters", policy.min_length));
+    }
+    if policy.require_digit && !password.chars().any(|c| c.is_ascii_digit()) {
+        unmet.push("a digit".to_string());
+    }
+    if policy.require_mixed_case
+        && !(password.chars().any(char::is_lowercase) && password.chars().any(char::is_uppercase))
+    {
+        unmet.push("both lowercase and uppercase letters".to_string());
+    }
+    if policy.require_special && password.chars().all(char::is_alphanumeric) {
+        unmet.push("a special character".to_string());
+    }
+
+    if unmet.is_empty() {
+        Ok(())
+    } else {
+        Err(AuthError::WeakPassword {
+            reason: format!("the password must contain {}", unmet.join(", ")),
+        })
+    }
+}
+
 pub fn bcrypt_hash(password: &str) -> Result<String, AuthError> {
-    Ok(bcrypt::hash(password, bcrypt::DEFAULT_COST)?)
+    Ok(bcrypt::hash(password, password_policy().bcrypt_cost)?)
 }
 
 pub fn bcrypt_verify(password: &str, hash_password: &str) -> Result<bool, AuthError> {
     Ok(bcrypt::verify(password, hash_password)?)
 }
+
+#[cfg(test)]
+mod test {
+    use config::tskv::PasswordPolicyConfig;
+
+    use super::check_password_with_policy;
+
+    #[test]
+    fn test_check_password() {
+        let default = PasswordPolicyConfig::default();
+        assert!(check_password_with_policy("", &default).is_ok());
+
+        let policy = PasswordPolicyConfig {
+            min_length: 8,
+            require_digit: true,
+            require_mixed_case: true,
+            require_special: true,
+            ..Default::default()
+        };
+        assert!(check_password_with_policy("Abcdef1!", &policy).is_ok());
+        assert!(check_password_with_policy("Abcde1!", &policy).is_err());
+        assert!(check_password_with_policy("Abcdefg!", &policy).is_err());
+        assert!(check_password_with_policy("abcdef1!", &policy).is_err());
+        assert!(check_password_with_policy("Abcdefg1", &policy).is_err());
+    }
+}
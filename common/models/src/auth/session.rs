@@ -0,0 +1,196 @@
+use std::time::Duration;
+
+use base64::prelude::{Engine, BASE64_URL_SAFE_NO_PAD};
+use openssl::hash::MessageDigest;
+use openssl::memcmp;
+use openssl::pkey::PKey;
+use openssl::sha::sha256;
+use openssl::sign::Signer;
+use serde::{Deserialize, Serialize};
+use snafu::ResultExt;
+
+use super::user::UserOptions;
+use super::{AuthError, AuthResult, InternalSnafu, RsaSnafu};
+
+/// A session issued by the login of a user, it's used as a bearer token
+/// instead of the password of the user.
+///
+/// The token is signed by the session secret of the server, which all the
+/// nodes of the cluster share and is never stored in meta. The digest of the
+/// hashed password of the user is signed with the session, so that it
+/// becomes invalid once the password is changed.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SessionToken {
+    pub user: String,
+    /// Unix timestamp in milliseconds
+    pub issued_at: i64,
+    /// Unix timestamp in milliseconds
+    pub expires_at: i64,
+    /// The digest of the hashed password when the session is issued.
+    pub credential: String,
+}
+
+impl SessionToken {
+    pub fn new(
+        user: impl Into<String>,
+        options: &UserOptions,
+        issued_at: i64,
+        ttl: Duration,
+    ) -> AuthResult<Self> {
+        let ttl = i64::try_from(ttl.as_millis()).unwrap_or(i64::MAX);
+        Ok(Self {
+            user: user.into(),
+            issued_at,
+            expires_at: issued_at.saturating_add(ttl),
+            credential: credential(options)?,
+        })
+    }
+
+    /// Encodes the session as `<payload>.<signature>` in url safe base64.
+    pub fn sign(&self, secret: &str) -> AuthResult<String> {
+        if secret.is_empty() {
+            return Err(AuthError::SessionSecretNotSet);
+        }
+        let payload =
+            serde_json::to_vec(self).map_err(|e| InternalSnafu { err: e.to_string() }.build())?;
+        let payload = BASE64_URL_SAFE_NO_PAD.encode(payload);
+        let signature = BASE64_URL_SAFE_NO_PAD.encode(hmac(secret, &payload)?);
+        Ok(format!("{}.{}", payload, signature))
+    }
+
+    /// Decodes the session without verifying it.
+    pub fn decode(token: &str) -> AuthResult<Self> {
+        let invalid = || AuthError::AccessDenied {
+            user_name: String::new(),
+            auth_type: "session".to_string(),
+            err: "malformed session token".to_string(),
+        };
+        let (payload, _) = token.split_once('.').ok_or_else(invalid)?;
+        let payload = BASE64_URL_SAFE_NO_PAD
+            .decode(payload)
+            .map_err(|_| invalid())?;
+        serde_json::from_slice(&payload).map_err(|_| invalid())
+    }
+
+    /// Verifies the signature of the token with the secret, and checks
+    /// whether the session is expired or revoked at `now`, or the password of
+    /// the user is changed.
+    pub fn verify(
+        token: &str,
+        user_name: &str,
+        options: &UserOptions,
+        secret: &str,
+        now: i64,
+    ) -> AuthResult<Self> {
+        let denied = |err: &str| AuthError::AccessDenied {
+            user_name: user_name.to_string(),
+            auth_type: "session".to_string(),
+            err: err.to_string(),
+        };
+
+        if secret.is_empty() {
+            return Err(AuthError::SessionSecretNotSet);
+        }
+        let (payload, signature) = token
+            .split_once('.')
+            .ok_or_else(|| denied("malformed session token"))?;
+        let signature = BASE64_URL_SAFE_NO_PAD
+            .decode(signature)
+            .map_err(|_| denied("malformed session token"))?;
+        let expected = hmac(secret, payload)?;
+        if signature.len() != expected.len() || !memcmp::eq(&signature, &expected) {
+            return Err(denied("invalid session token"));
+        }
+
+        let session = Self::decode(token)?;
+        if session.user != user_name {
+            return Err(denied("invalid session token"));
+        }
+        if session.credential != credential(options)? {
+            return Err(denied("password changed"));
+        }
+        if session.expires_at <= now {
+            return Err(denied("session expired"));
+        }
+        if options
+            .sessions_revoked_at()
+            .is_some_and(|revoked_at| session.issued_at <= revoked_at)
+        {
+            return Err(denied("session revoked"));
+        }
+
+        Ok(session)
+    }
+}
+
+/// The digest of the hashed password, the hash itself is never put in the
+/// tokens.
+fn credential(options: &UserOptions) -> AuthResult<String> {
+    let hash = options.hash_password().ok_or(AuthError::PasswordNotSet)?;
+    Ok(BASE64_URL_SAFE_NO_PAD.encode(sha256(hash.as_bytes())))
+}
+
+fn hmac(key: &str, payload: &str) -> AuthResult<Vec<u8>> {
+    let key = PKey::hmac(key.as_bytes()).context(RsaSnafu)?;
+    let mut signer = Signer::new(MessageDigest::sha256(), &key).context(RsaSnafu)?;
+    signer.update(payload.as_bytes()).context(RsaSnafu)?;
+    signer.sign_to_vec().context(RsaSnafu)
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use super::SessionToken;
+    use crate::auth::user::UserOptionsBuilder;
+
+    const SECRET: &str = "secret";
+
+    #[test]
+    fn test_session_token() {
+        let options = UserOptionsBuilder::default()
+            .hash_password("hash")
+            .build()
+            .unwrap();
+        let session = SessionToken::new("user", &options, 1000, Duration::from_secs(60)).unwrap();
+        let token = session.sign(SECRET).unwrap();
+        assert!(!token.contains("hash"));
+
+        assert_eq!(SessionToken::decode(&token).unwrap(), session);
+        assert_eq!(
+            SessionToken::verify(&token, "user", &options, SECRET, 2000).unwrap(),
+            session
+        );
+        // expired
+        assert!(SessionToken::verify(&token, "user", &options, SECRET, 61_000).is_err());
+        // another user
+        assert!(SessionToken::verify(&token, "other", &options, SECRET, 2000).is_err());
+        // the password is changed
+        let changed = UserOptionsBuilder::default()
+            .hash_password("changed")
+            .build()
+            .unwrap();
+        assert!(SessionToken::verify(&token, "user", &changed, SECRET, 2000).is_err());
+        // signed by the hashed password instead of the secret
+        let forged = SessionToken::new("user", &options, 1000, Duration::from_secs(3600))
+            .unwrap()
+            .sign("hash")
+            .unwrap();
+        assert!(SessionToken::verify(&forged, "user", &options, SECRET, 2000).is_err());
+        // tampered
+        let (_, signature) = token.split_once('.').unwrap();
+        let (payload, _) = forged.split_once('.').unwrap();
+        let tampered = format!("{}.{}", payload, signature);
+        assert!(SessionToken::verify(&tampered, "user", &options, SECRET, 2000).is_err());
+        // revoked
+        let revoked = UserOptionsBuilder::default()
+            .hash_password("hash")
+            .sessions_revoked_at(1500)
+            .build()
+            .unwrap();
+        assert!(SessionToken::verify(&token, "user", &revoked, SECRET, 2000).is_err());
+        // no secret
+        assert!(session.sign("").is_err());
+        assert!(SessionToken::verify(&token, "user", &options, "", 2000).is_err());
+    }
+}
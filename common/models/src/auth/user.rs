@@ -1,16 +1,18 @@
 use std::collections::HashSet;
 use std::fmt::Display;
+use std::str::FromStr;
 
 use base64::prelude::{Engine, BASE64_STANDARD};
 use derive_builder::Builder;
 use serde::{Deserialize, Serialize};
+use utils::duration::CnosDuration;
 
 use super::privilege::{
     DatabasePrivilege, GlobalPrivilege, Privilege, PrivilegeChecker, TenantObjectPrivilege,
 };
 use super::role::{TenantRoleIdentifier, UserRole};
 use super::{rsa_utils, AuthError, AuthResult};
-use crate::auth::{bcrypt_hash, bcrypt_verify};
+use crate::auth::{bcrypt_hash, bcrypt_verify, check_password};
 use crate::oid::{Identifier, Oid};
 
 pub const ROOT: &str = "root";
@@ -118,6 +120,10 @@ impl UserDesc {
         self.name = new_name;
         self
     }
+
+    pub fn hidden_password(&mut self) {
+        self.options.hidden_password();
+    }
 }
 
 impl Eq for UserDesc {}
@@ -150,6 +156,21 @@ pub struct UserOptions {
     comment: Option<String>,
     #[serde(skip_serializing_if = "Option::is_none")]
     granted_admin: Option<bool>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    denied_statements: Option<DeniedStatements>,
+    /// The sessions issued before it are revoked, unix timestamp in milliseconds.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    sessions_revoked_at: Option<i64>,
+    /// The password must be changed again once it's older than it.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    password_max_age: Option<CnosDuration>,
+    /// Set by meta when the password is changed, unix timestamp in milliseconds.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    password_changed_at: Option<i64>,
+    /// Created by the external identity provider on the first login, only
+    /// these users are authenticated by the provider.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    external: Option<bool>,
 }
 
 impl UserOptions {
@@ -168,6 +189,38 @@ impl UserOptions {
     pub fn granted_admin(&self) -> Option<bool> {
         self.granted_admin
     }
+    pub fn denied_statements(&self) -> Option<&DeniedStatements> {
+        self.denied_statements.as_ref()
+    }
+    pub fn sessions_revoked_at(&self) -> Option<i64> {
+        self.sessions_revoked_at
+    }
+    pub fn password_max_age(&self) -> Option<&CnosDuration> {
+        self.password_max_age.as_ref()
+    }
+    pub fn password_changed_at(&self) -> Option<i64> {
+        self.password_changed_at
+    }
+    pub fn external(&self) -> bool {
+        self.external.unwrap_or_default()
+    }
+
+    /// Whether the password is older than `password_max_age` at `now`,
+    /// the passwords changed before the time is recorded never expire.
+    pub fn password_expired(&self, now: i64) -> bool {
+        match (&self.password_max_age, self.password_changed_at) {
+            (Some(max_age), Some(changed_at)) => {
+                let max_age = max_age.to_nanoseconds() / 1_000_000;
+                changed_at.saturating_add(max_age) <= now
+            }
+            _ => false,
+        }
+    }
+
+    /// The user can only change its password, until it's changed.
+    pub fn need_change_password(&self, now: i64) -> bool {
+        self.must_change_password.is_some_and(|x| x) || self.password_expired(now)
+    }
 
     pub fn merge(self, other: Self) -> Self {
         Self {
@@ -176,16 +229,30 @@ impl UserOptions {
             rsa_public_key: self.rsa_public_key.or(other.rsa_public_key),
             comment: self.comment.or(other.comment),
             granted_admin: self.granted_admin.or(other.granted_admin),
+            denied_statements: self.denied_statements.or(other.denied_statements),
+            sessions_revoked_at: self.sessions_revoked_at.or(other.sessions_revoked_at),
+            password_max_age: self.password_max_age.or(other.password_max_age),
+            password_changed_at: self.password_changed_at.or(other.password_changed_at),
+            external: self.external.or(other.external),
         }
     }
     pub fn hidden_password(&mut self) {
         self.hash_password.replace("*****".to_string());
+        // shown by SHOW USERS
+        self.password_changed_at.take();
     }
 
     // when user change password, turn must_change_password to false
     pub fn change_password(&mut self) {
         self.must_change_password = Some(false);
     }
+
+    /// Records the time of the password change if the password is set.
+    pub fn stamp_password_changed_at(&mut self, now: i64) {
+        if self.hash_password.is_some() {
+            self.password_changed_at = Some(now);
+        }
+    }
 }
 
 impl UserOptionsBuilder {
@@ -193,8 +260,10 @@ impl UserOptionsBuilder {
         &mut self,
         password: impl Into<String>,
     ) -> Result<&mut Self, UserOptionsBuilderError> {
-        let hash_password = bcrypt_hash(&password.into())
-            .map_err(|e| UserOptionsBuilderError::from(e.to_string()))?;
+        let password = password.into();
+        check_password(&password).map_err(|e| UserOptionsBuilderError::from(e.to_string()))?;
+        let hash_password =
+            bcrypt_hash(&password).map_err(|e| UserOptionsBuilderError::from(e.to_string()))?;
         self.hash_password(hash_password);
         Ok(self)
     }
@@ -214,10 +283,97 @@ impl Display for UserOptions {
             write!(f, "granted_admin={},", e)?;
         }
 
+        if let Some(ref e) = self.denied_statements {
+            write!(f, "denied_statements={},", e)?;
+        }
+
+        if let Some(ref e) = self.password_max_age {
+            write!(f, "password_max_age={},", e)?;
+        }
+
+        if let Some(ref e) = self.external {
+            write!(f, "external={},", e)?;
+        }
+
         Ok(())
     }
 }
 
+/// The kinds of statements which can be denied for a user, to prevent
+/// the accidental destructive operations, e.g. from the dashboards.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum DeniedStatement {
+    /// DROP of any object
+    Drop,
+    /// DELETE FROM
+    Delete,
+    /// SELECT * without a condition on the time column
+    UnboundedSelect,
+}
+
+impl FromStr for DeniedStatement {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.trim().to_ascii_lowercase().as_str() {
+            "drop" => Ok(Self::Drop),
+            "delete" => Ok(Self::Delete),
+            "unbounded_select" => Ok(Self::UnboundedSelect),
+            _ => Err(format!(
+                "Expected denied statement [drop | delete | unbounded_select], found [{}]",
+                s
+            )),
+        }
+    }
+}
+
+impl Display for DeniedStatement {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Drop => write!(f, "drop"),
+            Self::Delete => write!(f, "delete"),
+            Self::UnboundedSelect => write!(f, "unbounded_select"),
+        }
+    }
+}
+
+/// The statements separated by ',', an empty string denies nothing.
+#[derive(Debug, Default, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct DeniedStatements(Vec<DeniedStatement>);
+
+impl DeniedStatements {
+    pub fn contains(&self, statement: DeniedStatement) -> bool {
+        self.0.contains(&statement)
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.0.is_empty()
+    }
+}
+
+impl FromStr for DeniedStatements {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let mut statements = vec![];
+        for e in s.split(',').filter(|e| !e.trim().is_empty()) {
+            let statement = e.parse::<DeniedStatement>()?;
+            if !statements.contains(&statement) {
+                statements.push(statement);
+            }
+        }
+        Ok(Self(statements))
+    }
+}
+
+impl Display for DeniedStatements {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let statements = self.0.iter().map(|e| e.to_string()).collect::<Vec<_>>();
+        write!(f, "{}", statements.join(","))
+    }
+}
+
 pub enum AuthType<'a> {
     HashPassword(Option<&'a str>),
     Rsa(&'a str),
@@ -287,10 +443,16 @@ pub struct UserInfo {
     pub user: String,
     pub password: String,
     pub private_key: Option<String>,
+    /// Authenticated by the session token instead of the password
+    #[serde(default)]
+    pub session_token: Option<String>,
 }
 
 impl UserInfo {
     pub fn to_authorization(&self) -> String {
+        if let Some(token) = &self.session_token {
+            return format!("Bearer {}", token);
+        }
         let auth = match &self.password {
             password if password.is_empty() => format!("{}:", self.user),
             password => format!("{}:{}", self.user, password),
@@ -1,3 +1,9 @@
+use std::collections::BTreeMap;
+use std::fmt::{self, Display};
+use std::str::FromStr;
+
+use crate::meta_data::{ReplicationSetId, VnodeId};
+
 #[allow(dead_code)]
 #[derive(Debug)]
 pub enum ConsistencyLevel {
@@ -10,3 +16,82 @@ pub enum ConsistencyLevel {
     /// requires all data nodes to acknowledge a write or read.
     All,
 }
+
+/// Returned by the writes for the read-your-writes consistency, the vnode
+/// acknowledged the write of each replication set, which has applied the write.
+///
+/// The queries passing the token back read these replication sets from these
+/// vnodes. It is encoded as `replica_id:vnode_id` separated by commas, so the
+/// concatenation of the tokens of several writes is also a token.
+#[derive(Debug, Default, Clone, PartialEq, Eq)]
+pub struct WriteToken {
+    vnodes: BTreeMap<ReplicationSetId, VnodeId>,
+}
+
+impl WriteToken {
+    pub fn insert(&mut self, replica_id: ReplicationSetId, vnode_id: VnodeId) {
+        self.vnodes.insert(replica_id, vnode_id);
+    }
+
+    pub fn vnode_for(&self, replica_id: ReplicationSetId) -> Option<VnodeId> {
+        self.vnodes.get(&replica_id).copied()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.vnodes.is_empty()
+    }
+}
+
+impl Display for WriteToken {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let vnodes = self
+            .vnodes
+            .iter()
+            .map(|(replica_id, vnode_id)| format!("{}:{}", replica_id, vnode_id))
+            .collect::<Vec<_>>();
+        write!(f, "{}", vnodes.join(","))
+    }
+}
+
+impl FromStr for WriteToken {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let mut token = WriteToken::default();
+        for item in s.split(',').map(str::trim).filter(|item| !item.is_empty()) {
+            let (replica_id, vnode_id) = item
+                .split_once(':')
+                .and_then(|(r, v)| Some((r.parse().ok()?, v.parse().ok()?)))
+                .ok_or_else(|| format!("invalid write token '{}'", s))?;
+            // the later write wins
+            token.insert(replica_id, vnode_id);
+        }
+        Ok(token)
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::str::FromStr;
+
+    use super::WriteToken;
+
+    #[test]
+    fn test_write_token() {
+        let mut token = WriteToken::default();
+        token.insert(12, 13);
+        token.insert(3, 5);
+        assert_eq!(token.to_string(), "3:5,12:13");
+        assert_eq!(WriteToken::from_str("3:5,12:13").unwrap(), token);
+
+        // the token of a later write overrides the replication sets of the former
+        let merged = WriteToken::from_str(&format!("{},{}", token, "12:14")).unwrap();
+        assert_eq!(merged.vnode_for(12), Some(14));
+        assert_eq!(merged.vnode_for(3), Some(5));
+        assert_eq!(merged.vnode_for(4), None);
+
+        assert!(WriteToken::from_str("").unwrap().is_empty());
+        assert!(WriteToken::from_str("3").is_err());
+        assert!(WriteToken::from_str("a:b").is_err());
+    }
+}
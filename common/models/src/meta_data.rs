@@ -1,5 +1,6 @@
 use std::collections::HashMap;
 use std::sync::Arc;
+use std::time::Duration;
 
 use serde::{Deserialize, Serialize};
 
@@ -21,6 +22,68 @@ pub enum MetaModifyType {
     ResourceInfo(Box<ResourceInfo>),
 }
 
+/// Typed meta data change, published to subscribers after the local
+/// meta cache has applied it.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum MetaChangeEvent {
+    DatabaseCreated {
+        tenant: String,
+        database: String,
+    },
+    /// Database options (ttl, shard, vnode duration ...) changed.
+    DatabaseAltered {
+        tenant: String,
+        database: String,
+    },
+    DatabaseDropped {
+        tenant: String,
+        database: String,
+    },
+    BucketCreated {
+        tenant: String,
+        database: String,
+        bucket_id: u32,
+    },
+    BucketUpdated {
+        tenant: String,
+        database: String,
+        bucket_id: u32,
+    },
+    BucketDropped {
+        tenant: String,
+        database: String,
+        bucket_id: u32,
+    },
+    TableChanged {
+        tenant: String,
+        database: String,
+        table: String,
+    },
+    TableDropped {
+        tenant: String,
+        database: String,
+        table: String,
+    },
+    DataNodeAdded {
+        node_id: NodeId,
+    },
+    DataNodeUpdated {
+        node_id: NodeId,
+    },
+    DataNodeRemoved {
+        node_id: NodeId,
+    },
+    UserChanged {
+        name: String,
+    },
+    UserDropped {
+        name: String,
+    },
+    RuntimeLimitsChanged,
+    /// The local cache was reloaded from meta, events may have been missed.
+    FullSync,
+}
+
 #[derive(Serialize, Deserialize, Debug, Default, Clone)]
 pub struct SysInfo {
     pub cpu_load: f64,
@@ -40,6 +103,8 @@ pub struct ExpiredBucketInfo {
     pub tenant: String,
     pub database: String,
     pub bucket: BucketInfo,
+    /// the min timestamp the database allowed to store when the bucket expired
+    pub expired_before: i64,
 }
 
 #[derive(Serialize, Deserialize, Debug, Default, Clone)]
@@ -53,6 +118,10 @@ pub struct UserInfo {
 pub struct NodeInfo {
     pub id: NodeId,
     pub grpc_addr: String,
+    #[serde(default)]
+    pub zone: String,
+    #[serde(default)]
+    pub tags: Vec<String>,
 }
 
 #[derive(Serialize, Deserialize, Debug, Default, Clone)]
@@ -69,6 +138,55 @@ impl NodeMetrics {
     }
 }
 
+/// Cluster wide limits adjusted at runtime by `SET <limit> = <value>`,
+/// a limit that is not set falls back to the value in the config file.
+#[derive(Serialize, Deserialize, Debug, Default, Clone, PartialEq, Eq)]
+pub struct RuntimeLimits {
+    pub max_concurrent_queries: Option<u32>,
+    pub write_timeout: Option<Duration>,
+}
+
+impl RuntimeLimits {
+    pub fn apply(&mut self, limit: RuntimeLimit) {
+        match limit {
+            RuntimeLimit::MaxConcurrentQueries(val) => self.max_concurrent_queries = Some(val),
+            RuntimeLimit::WriteTimeout(val) => self.write_timeout = Some(val),
+        }
+    }
+}
+
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq)]
+pub enum RuntimeLimit {
+    MaxConcurrentQueries(u32),
+    WriteTimeout(Duration),
+}
+
+/// Resource usage of a database on one data node
+#[derive(Serialize, Deserialize, Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub struct DatabaseUsage {
+    pub disk_size: u64,
+    pub series: u64,
+}
+
+impl DatabaseUsage {
+    pub fn merge(&mut self, other: &DatabaseUsage) {
+        self.disk_size += other.disk_size;
+        self.series += other.series;
+    }
+}
+
+/// Storage state of a vnode on its data node
+#[derive(Serialize, Deserialize, Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub struct VnodeSummary {
+    pub vnode_id: VnodeId,
+    pub disk_size: u64,
+    pub series: u64,
+    /// Unix timestamp in nanoseconds of the last flush, None if never written
+    pub last_write_time: Option<i64>,
+    /// No data is written for `compact_trigger_cold_duration`
+    pub cold: bool,
+}
+
 #[derive(Serialize, Deserialize, Debug, Default, Clone)]
 pub struct BucketInfo {
     pub id: u32,
@@ -79,9 +197,13 @@ pub struct BucketInfo {
 
 impl BucketInfo {
     pub fn vnode_for(&self, id: u64) -> ReplicationSet {
+        self.replication_set_for(id).clone()
+    }
+
+    pub fn replication_set_for(&self, id: u64) -> &ReplicationSet {
         let index = id as usize % self.shard_group.len();
 
-        self.shard_group[index].clone()
+        &self.shard_group[index]
     }
 }
 
@@ -153,6 +275,8 @@ pub enum VnodeStatus {
     Running,
     Copying,
     Broken,
+    /// Read-only, rejecting writes and compactions
+    Frozen,
 }
 
 #[derive(Serialize, Deserialize, Debug, Default, Clone)]
@@ -275,10 +399,12 @@ impl TenantMetaData {
 
     pub fn bucket_by_timestamp(&self, db_name: &str, ts: i64) -> Option<&BucketInfo> {
         if let Some(db) = self.dbs.get(db_name) {
+            // a bucket being split overlaps with the new buckets, prefer the newer one
             if let Some(bucket) = db
                 .buckets
                 .iter()
-                .find(|bucket| (ts >= bucket.start_time) && (ts < bucket.end_time))
+                .filter(|bucket| (ts >= bucket.start_time) && (ts < bucket.end_time))
+                .max_by_key(|bucket| bucket.id)
             {
                 return Some(bucket);
             }
@@ -367,7 +493,13 @@ pub fn allocation_replication_set(
     (group, incr_id - begin_seq)
 }
 
+/// Returns the available bytes of the disk of the path.
 pub fn get_disk_info(path: &str) -> std::io::Result<u64> {
+    get_disk_space(path).map(|(_, available)| available)
+}
+
+/// Returns the total and the available bytes of the disk of the path.
+pub fn get_disk_space(path: &str) -> std::io::Result<(u64, u64)> {
     use std::mem::MaybeUninit;
 
     #[cfg(unix)]
@@ -387,7 +519,10 @@ pub fn get_disk_info(path: &str) -> std::io::Result<u64> {
 
         let statfs = unsafe { statfs.assume_init() };
 
-        Ok(statfs.f_bsize as u64 * statfs.f_bavail)
+        Ok((
+            statfs.f_bsize as u64 * statfs.f_blocks,
+            statfs.f_bsize as u64 * statfs.f_bavail,
+        ))
     }
 
     #[cfg(windows)]
@@ -407,23 +542,26 @@ pub fn get_disk_info(path: &str) -> std::io::Result<u64> {
 
         let lp_directory_name = HSTRING::from(OsStr::new(path));
         let mut lp_free_bytes_available_to_caller = MaybeUninit::<u64>::zeroed();
-        let free_bytes_available_to_caller = unsafe {
+        let mut lp_total_number_of_bytes = MaybeUninit::<u64>::zeroed();
+        unsafe {
             GetDiskFreeSpaceExW(
                 &lp_directory_name,
                 Some(lp_free_bytes_available_to_caller.as_mut_ptr()),
-                None, // lp_total_number_of_bytes
+                Some(lp_total_number_of_bytes.as_mut_ptr()),
                 None, // lp_total_number_of_free_bytes
             )
             .map_err(|e| std::io::Error::new(std::io::ErrorKind::Other, e.to_string()))?;
-            lp_free_bytes_available_to_caller.assume_init()
-        };
-        Ok(free_bytes_available_to_caller)
+            Ok((
+                lp_total_number_of_bytes.assume_init(),
+                lp_free_bytes_available_to_caller.assume_init(),
+            ))
+        }
     }
 }
 
 #[cfg(test)]
 mod test {
-    use super::get_disk_info;
+    use super::{get_disk_info, get_disk_space};
 
     #[test]
     fn test_get_disk_info() {
@@ -438,4 +576,12 @@ mod test {
         let pe = std::io::Error::last_os_error();
         println!("disk info error: {}", pe);
     }
+
+    #[test]
+    fn test_get_disk_space() {
+        let (total, available) = get_disk_space(".").unwrap();
+        assert!(available <= total);
+
+        assert!(get_disk_space("/not_existed").is_err());
+    }
 }
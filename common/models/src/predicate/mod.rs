@@ -8,9 +8,10 @@ use self::domain::{ColumnDomains, PredicateRef, TimeRange, TimeRanges};
 use crate::meta_data::{ReplicationSet, ReplicationSetId, VnodeInfo};
 use crate::predicate::domain::{ResolvedPredicate, ResolvedPredicateRef};
 use crate::schema::tskv_table_schema::{ColumnType, TskvTableSchemaRef};
-use crate::ModelResult;
+use crate::{ModelResult, SeriesId};
 
 pub mod domain;
+pub mod series_cursor;
 pub mod transformation;
 pub mod utils;
 
@@ -20,6 +21,14 @@ pub struct Split {
     id: usize,
     predicate: ResolvedPredicateRef,
     limit: Option<usize>,
+    // only the latest rows of each series are needed
+    last_rows: Option<usize>,
+    // only a page of the series are needed
+    series_range: Option<SeriesRange>,
+    // only the top rows of the split are needed
+    top_k: Option<TopK>,
+    // only a sample of the rows are needed
+    sample: Option<Sample>,
 }
 
 impl Split {
@@ -51,6 +60,10 @@ impl Split {
             id,
             predicate,
             limit,
+            last_rows: None,
+            series_range: None,
+            top_k: None,
+            sample: None,
         })
     }
 
@@ -73,6 +86,81 @@ impl Split {
     pub fn limit(&self) -> Option<usize> {
         self.limit
     }
+
+    pub fn last_rows(&self) -> Option<usize> {
+        self.last_rows
+    }
+
+    pub fn series_range(&self) -> Option<SeriesRange> {
+        self.series_range
+    }
+
+    pub fn top_k(&self) -> Option<&TopK> {
+        self.top_k.as_ref()
+    }
+
+    pub fn sample(&self) -> Option<&Sample> {
+        self.sample.as_ref()
+    }
+}
+
+/// The column of the series ids, the tag scan projecting only it returns
+/// the series ids instead of the tags of the series.
+pub const SERIES_ID_COLUMN: &str = "_series_id";
+
+/// A page of the series of a shard, at most `limit` series after the series
+/// id `after` in the order of series id. The new series are appended to the
+/// end as the series ids are increasing, and the series deleted don't move
+/// the page.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SeriesRange {
+    pub after: Option<SeriesId>,
+    pub limit: usize,
+}
+
+impl SeriesRange {
+    /// Returns the series ids in the page.
+    pub fn apply(&self, mut series_ids: Vec<SeriesId>) -> Vec<SeriesId> {
+        if let Some(after) = self.after {
+            series_ids.retain(|id| *id > after);
+        }
+        series_ids.sort_unstable();
+        series_ids.truncate(self.limit);
+        series_ids
+    }
+}
+
+/// The first `k` rows of a split ordered by `column`, e.g. the candidates of
+/// `ORDER BY column DESC LIMIT k` read from each vnode.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct TopK {
+    pub column: String,
+    pub descending: bool,
+    pub nulls_first: bool,
+    pub k: usize,
+}
+
+/// The sample of the rows of a split, taken while the rows are read, e.g.
+/// `WHERE sample_percent(10) AND sample_series(100)`.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Serialize, Deserialize)]
+pub struct Sample {
+    /// Each row is kept with the probability `percent / 100`.
+    pub percent: Option<f64>,
+    /// Only the series of which the hash of the series key modulo `n` is 0
+    /// are read, so the same series are sampled every time.
+    pub series_modulus: Option<u64>,
+}
+
+impl Sample {
+    pub fn is_empty(&self) -> bool {
+        self.percent.is_none() && self.series_modulus.is_none()
+    }
+
+    /// Whether the series of the hash of the series key is sampled.
+    pub fn contains_series(&self, series_hash: u64) -> bool {
+        self.series_modulus
+            .map_or(true, |n| n == 0 || series_hash % n == 0)
+    }
 }
 
 impl From<PlacedSplit> for Split {
@@ -100,6 +188,10 @@ impl PlacedSplit {
             id,
             predicate,
             limit,
+            last_rows: None,
+            series_range: None,
+            top_k: None,
+            sample: None,
         };
 
         Self { split, repl_set }
@@ -129,6 +221,52 @@ impl PlacedSplit {
         self.split.limit
     }
 
+    /// Number of the latest rows of each series that are needed,
+    /// `None` means all rows are needed.
+    pub fn last_rows(&self) -> Option<usize> {
+        self.split.last_rows
+    }
+
+    pub fn with_last_rows(mut self, last_rows: Option<usize>) -> Self {
+        self.split.last_rows = last_rows;
+        self
+    }
+
+    /// Page of the series to read, `None` means all series are read.
+    pub fn series_range(&self) -> Option<SeriesRange> {
+        self.split.series_range
+    }
+
+    pub fn with_series_range(mut self, series_range: Option<SeriesRange>) -> Self {
+        self.split.series_range = series_range;
+        self
+    }
+
+    /// The first rows of the split to read, `None` means all rows are read.
+    pub fn top_k(&self) -> Option<&TopK> {
+        self.split.top_k.as_ref()
+    }
+
+    pub fn with_top_k(mut self, top_k: Option<TopK>) -> Self {
+        self.split.top_k = top_k;
+        self
+    }
+
+    /// The sample of the rows to read, `None` means all rows are read.
+    pub fn sample(&self) -> Option<&Sample> {
+        self.split.sample.as_ref()
+    }
+
+    pub fn with_sample(mut self, sample: Option<Sample>) -> Self {
+        self.split.sample = sample;
+        self
+    }
+
+    pub fn without_limit(mut self) -> Self {
+        self.split.limit = None;
+        self
+    }
+
     pub fn pop_front(&mut self) -> Option<VnodeInfo> {
         if self.repl_set.vnodes.is_empty() {
             None
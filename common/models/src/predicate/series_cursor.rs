@@ -0,0 +1,157 @@
+//! The cursor of the query selecting more series than
+//! `query.max_select_series`, the series of a table are returned page by
+//! page instead of rejecting the query.
+//!
+//! The shards of a table are paged in the order of replication set id, and
+//! the series of a shard in the order of series id, see [`SeriesRange`]. The
+//! cursor records the last series id of each shard read by the former pages,
+//! it is encoded as url safe base64 of json, so it is opaque for the client.
+
+use std::collections::BTreeMap;
+use std::fmt::{self, Display};
+use std::str::FromStr;
+
+use base64::prelude::{Engine, BASE64_URL_SAFE_NO_PAD};
+use serde::{Deserialize, Serialize};
+
+use super::SeriesRange;
+use crate::meta_data::ReplicationSetId;
+use crate::SeriesId;
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SeriesCursor {
+    // table => replication set id => the last series id read
+    tables: BTreeMap<String, BTreeMap<ReplicationSetId, SeriesId>>,
+}
+
+impl SeriesCursor {
+    /// Splits the next page of at most `max_series` series of the table,
+    /// `series` is the ids of the series of each shard after
+    /// [`SeriesCursor::after`], in the order of series id.
+    ///
+    /// Returns the series range of each shard, and whether there are series
+    /// left after the page.
+    pub fn page(
+        &self,
+        table: &str,
+        series: &[(ReplicationSetId, Vec<SeriesId>)],
+        max_series: usize,
+    ) -> (Vec<SeriesRange>, bool) {
+        let mut order = (0..series.len()).collect::<Vec<_>>();
+        order.sort_by_key(|i| series[*i].0);
+
+        let mut budget = max_series;
+        let mut ranges = vec![SeriesRange::default(); series.len()];
+        let mut has_more = false;
+        for i in order {
+            let (replica_id, ids) = &series[i];
+            let limit = ids.len().min(budget);
+            budget -= limit;
+            ranges[i] = SeriesRange {
+                after: self.after(table, *replica_id),
+                limit,
+            };
+            has_more |= limit < ids.len();
+        }
+        (ranges, has_more)
+    }
+
+    /// Moves the shards of the table to the last series of the page.
+    pub fn advance(
+        &mut self,
+        table: &str,
+        series: &[(ReplicationSetId, Vec<SeriesId>)],
+        ranges: &[SeriesRange],
+    ) {
+        let last_ids = self.tables.entry(table.to_string()).or_default();
+        for ((replica_id, ids), range) in series.iter().zip(ranges) {
+            if let Some(last) = range.limit.checked_sub(1).and_then(|i| ids.get(i)) {
+                last_ids.insert(*replica_id, *last);
+            }
+        }
+    }
+
+    /// The last series id of the shard read by the former pages.
+    pub fn after(&self, table: &str, replica_id: ReplicationSetId) -> Option<SeriesId> {
+        self.tables
+            .get(table)
+            .and_then(|last_ids| last_ids.get(&replica_id))
+            .copied()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.tables.is_empty()
+    }
+}
+
+impl Display for SeriesCursor {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        if self.tables.is_empty() {
+            return Ok(());
+        }
+        let json = serde_json::to_vec(self).map_err(|_| fmt::Error)?;
+        write!(f, "{}", BASE64_URL_SAFE_NO_PAD.encode(json))
+    }
+}
+
+impl FromStr for SeriesCursor {
+    type Err = String;
+
+    /// The empty string is the cursor of the first page.
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let s = s.trim();
+        if s.is_empty() {
+            return Ok(Self::default());
+        }
+        let invalid = || format!("invalid series cursor '{}'", s);
+        let json = BASE64_URL_SAFE_NO_PAD.decode(s).map_err(|_| invalid())?;
+        serde_json::from_slice(&json).map_err(|_| invalid())
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::str::FromStr;
+
+    use super::SeriesCursor;
+    use crate::predicate::SeriesRange;
+
+    fn range(after: Option<u32>, limit: usize) -> SeriesRange {
+        SeriesRange { after, limit }
+    }
+
+    #[test]
+    fn test_series_cursor() {
+        let series = vec![(3, vec![2, 5, 7, 9]), (1, vec![1, 4, 6])];
+
+        let mut cursor = SeriesCursor::from_str("").unwrap();
+        assert!(cursor.is_empty());
+        let (ranges, has_more) = cursor.page("db.air", &series, 5);
+        assert_eq!(ranges, vec![range(None, 2), range(None, 3)]);
+        assert!(has_more);
+        cursor.advance("db.air", &series, &ranges);
+        assert_eq!(cursor.after("db.air", 3), Some(5));
+        assert_eq!(cursor.after("db.air", 1), Some(6));
+
+        // the cursor is opaque to the client, the series 5 of shard 3 is
+        // deleted and the series 10 is added after the first page
+        let mut cursor = SeriesCursor::from_str(&cursor.to_string()).unwrap();
+        let series = vec![(3, vec![7, 9, 10]), (1, vec![])];
+        let (ranges, has_more) = cursor.page("db.air", &series, 5);
+        assert_eq!(ranges, vec![range(Some(5), 3), range(Some(6), 0)]);
+        assert!(!has_more);
+        cursor.advance("db.air", &series, &ranges);
+        assert_eq!(cursor.after("db.air", 3), Some(10));
+        assert_eq!(cursor.after("db.air", 1), Some(6));
+
+        // the other tables start from the first page
+        let series = vec![(3, vec![2, 5]), (1, vec![1, 4])];
+        let (ranges, has_more) = cursor.page("db.wind", &series, 2);
+        assert_eq!(ranges, vec![range(None, 0), range(None, 2)]);
+        assert!(has_more);
+
+        assert_eq!(range(Some(3), 2).apply(vec![5, 3, 9, 1, 4]), vec![4, 5]);
+        assert_eq!(range(None, 2).apply(vec![5, 3, 9]), vec![3, 5]);
+        assert!(SeriesCursor::from_str("not a cursor").is_err());
+    }
+}
@@ -6,6 +6,10 @@ use serde::{Deserialize, Serialize};
 use utils::duration::{CnosDuration, YEAR_SECOND};
 use utils::precision::Precision;
 
+use super::ingest_rule::IngestRules;
+use super::materialized_view::MaterializedView;
+use crate::meta_data::{NodeId, NodeInfo};
+
 #[derive(Serialize, Deserialize, Debug, Clone, Default, PartialEq, Eq, Hash)]
 pub struct DatabaseSchema {
     tenant: String,
@@ -15,6 +19,8 @@ pub struct DatabaseSchema {
     pub options: DatabaseOptions,
     // unmodifiable config
     pub config: Arc<DatabaseConfig>,
+    #[serde(default)]
+    materialized_views: Vec<MaterializedView>,
 }
 
 impl DatabaseSchema {
@@ -30,6 +36,7 @@ impl DatabaseSchema {
             is_hidden: false,
             options,
             config,
+            materialized_views: vec![],
         }
     }
 
@@ -84,9 +91,67 @@ impl DatabaseSchema {
         now - ttl
     }
 
+    // return the min and max timestamp value database allowed to write
+    pub fn time_range_to_write(&self) -> (i64, i64) {
+        let precision = *self.config().precision();
+        let now = match precision {
+            Precision::MS => crate::utils::now_timestamp_millis(),
+            Precision::US => crate::utils::now_timestamp_micros(),
+            Precision::NS => crate::utils::now_timestamp_nanos(),
+        };
+        let past = self.options.past_limit().to_precision(precision);
+        let future = self.options.future_limit().to_precision(precision);
+        (now.saturating_sub(past), now.saturating_add(future))
+    }
+
     pub fn set_db_is_hidden(&mut self, is_hidden: bool) {
         self.is_hidden = is_hidden;
     }
+
+    pub fn materialized_views(&self) -> &[MaterializedView] {
+        &self.materialized_views
+    }
+
+    pub fn materialized_view(&self, name: &str) -> Option<&MaterializedView> {
+        self.materialized_views
+            .iter()
+            .find(|view| view.name == name)
+    }
+
+    /// The views aggregating the table.
+    pub fn materialized_views_of<'a>(
+        &'a self,
+        table: &'a str,
+    ) -> impl Iterator<Item = &'a MaterializedView> {
+        self.materialized_views
+            .iter()
+            .filter(move |view| view.source == table)
+    }
+
+    pub fn add_materialized_view(&mut self, view: MaterializedView) {
+        self.materialized_views.push(view);
+    }
+
+    pub fn remove_materialized_view(&mut self, name: &str) -> Option<MaterializedView> {
+        let idx = self
+            .materialized_views
+            .iter()
+            .position(|view| view.name == name)?;
+        Some(self.materialized_views.remove(idx))
+    }
+
+    pub fn materialized_view_mut(&mut self, name: &str) -> Option<&mut MaterializedView> {
+        self.materialized_views
+            .iter_mut()
+            .find(|view| view.name == name)
+    }
+
+    /// Keeps the views of the stored schema, the views are only changed by
+    /// their own commands so that the stale ranges marked concurrently are
+    /// not lost.
+    pub fn keep_materialized_views(&mut self, stored: &DatabaseSchema) {
+        self.materialized_views = stored.materialized_views.clone();
+    }
 }
 
 pub fn make_owner(tenant_name: &str, database_name: &str) -> String {
@@ -111,6 +176,14 @@ pub struct DatabaseOptionsBuilder {
     shard_num: Option<u64>,
     vnode_duration: Option<CnosDuration>,
     replica: Option<u64>,
+    max_disk_size: Option<u64>,
+    max_series: Option<u64>,
+    max_writes_per_sec: Option<u64>,
+    future_limit: Option<CnosDuration>,
+    past_limit: Option<CnosDuration>,
+    max_bucket_size: Option<u64>,
+    ingest_rules: Option<IngestRules>,
+    placement: Option<DatabasePlacement>,
 }
 
 impl Default for DatabaseOptionsBuilder {
@@ -126,6 +199,14 @@ impl DatabaseOptionsBuilder {
             shard_num: None,
             vnode_duration: None,
             replica: None,
+            max_disk_size: None,
+            max_series: None,
+            max_writes_per_sec: None,
+            future_limit: None,
+            past_limit: None,
+            max_bucket_size: None,
+            ingest_rules: None,
+            placement: None,
         }
     }
 
@@ -149,14 +230,82 @@ impl DatabaseOptionsBuilder {
         self
     }
 
+    /// 0 means no limit
+    pub fn with_max_disk_size(&mut self, max_disk_size: u64) -> &mut Self {
+        self.max_disk_size = Some(max_disk_size);
+        self
+    }
+
+    /// 0 means no limit
+    pub fn with_max_series(&mut self, max_series: u64) -> &mut Self {
+        self.max_series = Some(max_series);
+        self
+    }
+
+    /// 0 means no limit
+    pub fn with_max_writes_per_sec(&mut self, max_writes_per_sec: u64) -> &mut Self {
+        self.max_writes_per_sec = Some(max_writes_per_sec);
+        self
+    }
+
+    pub fn with_future_limit(&mut self, future_limit: CnosDuration) -> &mut Self {
+        self.future_limit = Some(future_limit);
+        self
+    }
+
+    pub fn with_past_limit(&mut self, past_limit: CnosDuration) -> &mut Self {
+        self.past_limit = Some(past_limit);
+        self
+    }
+
+    /// 0 means the duration of buckets is fixed to vnode_duration
+    pub fn with_max_bucket_size(&mut self, max_bucket_size: u64) -> &mut Self {
+        self.max_bucket_size = Some(max_bucket_size);
+        self
+    }
+
+    /// Empty rules remove the rules of the database
+    pub fn with_ingest_rules(&mut self, ingest_rules: IngestRules) -> &mut Self {
+        self.ingest_rules = Some(ingest_rules);
+        self
+    }
+
+    pub fn with_placement(&mut self, placement: DatabasePlacement) -> &mut Self {
+        self.placement = Some(placement);
+        self
+    }
+
+    pub fn has_placement(&self) -> bool {
+        self.placement.is_some()
+    }
+
+    pub fn has_quota(&self) -> bool {
+        self.max_disk_size.is_some()
+            || self.max_series.is_some()
+            || self.max_writes_per_sec.is_some()
+    }
+
     pub fn build(self) -> DatabaseOptions {
+        let mut quota = DatabaseQuota::default();
+        quota.apply_builder(&self);
         let ttl = self.ttl.unwrap_or(DatabaseOptions::DEFAULT_TTL);
         let shard_num = self.shard_num.unwrap_or(DatabaseOptions::DEFAULT_SHARD_NUM);
         let vnode_duration = self
             .vnode_duration
             .unwrap_or(DatabaseOptions::DEFAULT_VNODE_DURATION);
         let replica = self.replica.unwrap_or(DatabaseOptions::DEFAULT_REPLICA);
-        DatabaseOptions::new(ttl, shard_num, vnode_duration, replica)
+        let mut options = DatabaseOptions::new(ttl, shard_num, vnode_duration, replica);
+        options.quota = quota;
+        if let Some(future_limit) = self.future_limit {
+            options.future_limit = future_limit;
+        }
+        if let Some(past_limit) = self.past_limit {
+            options.past_limit = past_limit;
+        }
+        options.max_bucket_size = self.max_bucket_size.filter(|size| *size > 0);
+        options.ingest_rules = self.ingest_rules.unwrap_or_default();
+        options.placement = self.placement.unwrap_or_default();
+        options
     }
 }
 
@@ -166,6 +315,23 @@ pub struct DatabaseOptions {
     shard_num: u64,
     vnode_duration: CnosDuration,
     replica: u64,
+    #[serde(default)]
+    quota: DatabaseQuota,
+    // how far a written timestamp can be ahead of now
+    #[serde(default = "CnosDuration::new_inf")]
+    future_limit: CnosDuration,
+    // how far a written timestamp can be behind now
+    #[serde(default = "CnosDuration::new_inf")]
+    past_limit: CnosDuration,
+    // shrink the duration of new buckets to keep their size under it
+    #[serde(default)]
+    max_bucket_size: Option<u64>,
+    // rewrite the tables and tags of the written points
+    #[serde(default)]
+    ingest_rules: IngestRules,
+    // the nodes allowed to hold the vnodes of the database
+    #[serde(default)]
+    placement: DatabasePlacement,
 }
 
 impl DatabaseOptions {
@@ -185,6 +351,12 @@ impl DatabaseOptions {
             shard_num,
             vnode_duration,
             replica,
+            quota: DatabaseQuota::default(),
+            future_limit: CnosDuration::new_inf(),
+            past_limit: CnosDuration::new_inf(),
+            max_bucket_size: None,
+            ingest_rules: IngestRules::default(),
+            placement: DatabasePlacement::default(),
         }
     }
 
@@ -220,6 +392,30 @@ impl DatabaseOptions {
         self.replica = replica;
     }
 
+    pub fn quota(&self) -> &DatabaseQuota {
+        &self.quota
+    }
+
+    pub fn future_limit(&self) -> &CnosDuration {
+        &self.future_limit
+    }
+
+    pub fn past_limit(&self) -> &CnosDuration {
+        &self.past_limit
+    }
+
+    pub fn max_bucket_size(&self) -> Option<u64> {
+        self.max_bucket_size
+    }
+
+    pub fn ingest_rules(&self) -> &IngestRules {
+        &self.ingest_rules
+    }
+
+    pub fn placement(&self) -> &DatabasePlacement {
+        &self.placement
+    }
+
     pub fn apply_builder(&mut self, builder: &DatabaseOptionsBuilder) {
         if let Some(ref ttl) = builder.ttl {
             self.ttl = ttl.clone();
@@ -233,6 +429,22 @@ impl DatabaseOptions {
         if let Some(replica) = builder.replica {
             self.replica = replica;
         }
+        self.quota.apply_builder(builder);
+        if let Some(ref future_limit) = builder.future_limit {
+            self.future_limit = future_limit.clone();
+        }
+        if let Some(ref past_limit) = builder.past_limit {
+            self.past_limit = past_limit.clone();
+        }
+        if let Some(max_bucket_size) = builder.max_bucket_size {
+            self.max_bucket_size = (max_bucket_size > 0).then_some(max_bucket_size);
+        }
+        if let Some(ref ingest_rules) = builder.ingest_rules {
+            self.ingest_rules = ingest_rules.clone();
+        }
+        if let Some(ref placement) = builder.placement {
+            self.placement = placement.clone();
+        }
     }
 }
 
@@ -243,6 +455,76 @@ impl Default for DatabaseOptions {
             shard_num: DatabaseOptions::DEFAULT_SHARD_NUM,
             vnode_duration: DatabaseOptions::DEFAULT_VNODE_DURATION,
             replica: DatabaseOptions::DEFAULT_REPLICA,
+            quota: DatabaseQuota::default(),
+            future_limit: CnosDuration::new_inf(),
+            past_limit: CnosDuration::new_inf(),
+            max_bucket_size: None,
+            ingest_rules: IngestRules::default(),
+            placement: DatabasePlacement::default(),
+        }
+    }
+}
+
+/// The data nodes allowed to hold the vnodes of a database, for the data
+/// residency and the hardware class requirements, empty means all nodes.
+#[derive(Serialize, Deserialize, Debug, Clone, Default, PartialEq, Eq, Hash)]
+pub struct DatabasePlacement {
+    /// ids of the nodes, `ON NODES (1, 2)`
+    pub nodes: Vec<NodeId>,
+    /// zone of the nodes, `ON ZONE 'eu-west'`
+    pub zone: Option<String>,
+    /// tags the nodes must all have, `TAGS ('ssd')`
+    pub tags: Vec<String>,
+}
+
+impl DatabasePlacement {
+    pub fn is_empty(&self) -> bool {
+        self.nodes.is_empty() && self.zone.is_none() && self.tags.is_empty()
+    }
+
+    pub fn contains(&self, node: &NodeInfo) -> bool {
+        (self.nodes.is_empty() || self.nodes.contains(&node.id))
+            && self.zone.as_ref().map_or(true, |zone| *zone == node.zone)
+            && self.tags.iter().all(|tag| node.tags.contains(tag))
+    }
+
+    /// Keeps the nodes in the placement.
+    pub fn filter_nodes(&self, nodes: Vec<NodeInfo>) -> Vec<NodeInfo> {
+        nodes
+            .into_iter()
+            .filter(|node| self.contains(node))
+            .collect()
+    }
+}
+
+/// Resource quotas of a database, `None` means no limit.
+#[derive(Serialize, Deserialize, Debug, Clone, Default, PartialEq, Eq, Hash)]
+pub struct DatabaseQuota {
+    /// max bytes of tsm files on disk, sum of all vnodes
+    pub max_disk_size: Option<u64>,
+    /// max number of series, sum of all vnodes
+    pub max_series: Option<u64>,
+    /// max number of points written per second on each node
+    pub max_writes_per_sec: Option<u64>,
+}
+
+impl DatabaseQuota {
+    pub fn is_empty(&self) -> bool {
+        self.max_disk_size.is_none()
+            && self.max_series.is_none()
+            && self.max_writes_per_sec.is_none()
+    }
+
+    fn apply_builder(&mut self, builder: &DatabaseOptionsBuilder) {
+        let limit = |val: u64| (val > 0).then_some(val);
+        if let Some(max_disk_size) = builder.max_disk_size {
+            self.max_disk_size = limit(max_disk_size);
+        }
+        if let Some(max_series) = builder.max_series {
+            self.max_series = limit(max_series);
+        }
+        if let Some(max_writes_per_sec) = builder.max_writes_per_sec {
+            self.max_writes_per_sec = limit(max_writes_per_sec);
         }
     }
 }
@@ -0,0 +1,466 @@
+use std::borrow::Cow;
+use std::fmt::{self, Display};
+use std::str::FromStr;
+
+use protos::FieldValue;
+use regex::Regex;
+use serde::{Deserialize, Serialize};
+
+/// A rule rewriting the points written to a database, before they are stored.
+///
+/// The text form of a rule is an action followed by its arguments separated
+/// by whitespaces:
+/// - `rename_table <from> <to>`
+/// - `drop_table <name>`
+/// - `rename_tag <from> <to>`
+/// - `drop_tag <name>`
+/// - `replace_tag <tag> <regex> <replacement>`, the replacement may refer to
+///   the groups of the regex like `$1`.
+/// - `derive_field <table> <field> <operand> <+|-|*|/> <operand>`, the operands
+///   are fields or numbers, like `derive_field meter power voltage * current`.
+///   The field is written as a float if both operands are numeric.
+/// - `sequence_tag <table> <tag>`, the points of the table sharing the series
+///   and the timestamp of a stored point, or of an earlier point of the same
+///   write, are tagged with the smallest free sequence `1`, `2`, ..., so that
+///   they are not overwritten. Each sequence is a new series.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Hash)]
+pub enum IngestRule {
+    RenameTable {
+        from: String,
+        to: String,
+    },
+    DropTable {
+        name: String,
+    },
+    RenameTag {
+        from: String,
+        to: String,
+    },
+    DropTag {
+        name: String,
+    },
+    ReplaceTag {
+        tag: String,
+        pattern: String,
+        replacement: String,
+    },
+    DeriveField {
+        table: String,
+        field: String,
+        left: Operand,
+        op: ArithOp,
+        right: Operand,
+    },
+    SequenceTag {
+        table: String,
+        tag: String,
+    },
+}
+
+impl FromStr for IngestRule {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let args = s.split_whitespace().collect::<Vec<_>>();
+        let rule = match args.as_slice() {
+            ["rename_table", from, to] => IngestRule::RenameTable {
+                from: from.to_string(),
+                to: to.to_string(),
+            },
+            ["drop_table", name] => IngestRule::DropTable {
+                name: name.to_string(),
+            },
+            ["rename_tag", from, to] => IngestRule::RenameTag {
+                from: from.to_string(),
+                to: to.to_string(),
+            },
+            ["drop_tag", name] => IngestRule::DropTag {
+                name: name.to_string(),
+            },
+            ["replace_tag", tag, pattern, replacement] => {
+                Regex::new(pattern).map_err(|e| format!("invalid regex {}: {}", pattern, e))?;
+                IngestRule::ReplaceTag {
+                    tag: tag.to_string(),
+                    pattern: pattern.to_string(),
+                    replacement: replacement.to_string(),
+                }
+            }
+            ["derive_field", table, field, left, op, right] => IngestRule::DeriveField {
+                table: table.to_string(),
+                field: field.to_string(),
+                left: Operand::from(*left),
+                op: ArithOp::from_str(op)?,
+                right: Operand::from(*right),
+            },
+            ["sequence_tag", table, tag] => IngestRule::SequenceTag {
+                table: table.to_string(),
+                tag: tag.to_string(),
+            },
+            _ => {
+                return Err(format!(
+                    "invalid ingest rule '{}', expected one of: rename_table <from> <to>, \
+                     drop_table <name>, rename_tag <from> <to>, drop_tag <name>, \
+                     replace_tag <tag> <regex> <replacement>, \
+                     derive_field <table> <field> <operand> <op> <operand>, \
+                     sequence_tag <table> <tag>",
+                    s.trim()
+                ))
+            }
+        };
+        Ok(rule)
+    }
+}
+
+impl Display for IngestRule {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            IngestRule::RenameTable { from, to } => write!(f, "rename_table {} {}", from, to),
+            IngestRule::DropTable { name } => write!(f, "drop_table {}", name),
+            IngestRule::RenameTag { from, to } => write!(f, "rename_tag {} {}", from, to),
+            IngestRule::DropTag { name } => write!(f, "drop_tag {}", name),
+            IngestRule::ReplaceTag {
+                tag,
+                pattern,
+                replacement,
+            } => write!(f, "replace_tag {} {} {}", tag, pattern, replacement),
+            IngestRule::DeriveField {
+                table,
+                field,
+                left,
+                op,
+                right,
+            } => write!(
+                f,
+                "derive_field {} {} {} {} {}",
+                table, field, left, op, right
+            ),
+            IngestRule::SequenceTag { table, tag } => write!(f, "sequence_tag {} {}", table, tag),
+        }
+    }
+}
+
+/// An operand of a derived field, a field of the point or a number.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Hash)]
+pub enum Operand {
+    Field(String),
+    // kept as the text, f64 is not Eq
+    Number(String),
+}
+
+impl Operand {
+    fn value(&self, fields: &[(Cow<'_, str>, FieldValue)]) -> Option<f64> {
+        match self {
+            Operand::Number(n) => n.parse().ok(),
+            Operand::Field(name) => fields
+                .iter()
+                .find(|(k, _)| k.as_ref() == name.as_str())
+                .and_then(|(_, v)| match v {
+                    FieldValue::F64(v) => Some(*v),
+                    FieldValue::I64(v) => Some(*v as f64),
+                    FieldValue::U64(v) => Some(*v as f64),
+                    _ => None,
+                }),
+        }
+    }
+}
+
+impl From<&str> for Operand {
+    fn from(s: &str) -> Self {
+        if s.parse::<f64>().is_ok() {
+            Operand::Number(s.to_string())
+        } else {
+            Operand::Field(s.to_string())
+        }
+    }
+}
+
+impl Display for Operand {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Operand::Field(s) | Operand::Number(s) => write!(f, "{}", s),
+        }
+    }
+}
+
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum ArithOp {
+    Add,
+    Sub,
+    Mul,
+    Div,
+}
+
+impl ArithOp {
+    fn eval(&self, left: f64, right: f64) -> f64 {
+        match self {
+            ArithOp::Add => left + right,
+            ArithOp::Sub => left - right,
+            ArithOp::Mul => left * right,
+            ArithOp::Div => left / right,
+        }
+    }
+}
+
+impl FromStr for ArithOp {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "+" => Ok(ArithOp::Add),
+            "-" => Ok(ArithOp::Sub),
+            "*" => Ok(ArithOp::Mul),
+            "/" => Ok(ArithOp::Div),
+            _ => Err(format!("invalid operator {}, expected +, -, * or /", s)),
+        }
+    }
+}
+
+impl Display for ArithOp {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let op = match self {
+            ArithOp::Add => "+",
+            ArithOp::Sub => "-",
+            ArithOp::Mul => "*",
+            ArithOp::Div => "/",
+        };
+        write!(f, "{}", op)
+    }
+}
+
+/// The rules of a database, applied in order, separated by `;` in the text form.
+#[derive(Serialize, Deserialize, Debug, Clone, Default, PartialEq, Eq, Hash)]
+pub struct IngestRules(Vec<IngestRule>);
+
+impl IngestRules {
+    pub fn is_empty(&self) -> bool {
+        self.0.is_empty()
+    }
+
+    pub fn rules(&self) -> &[IngestRule] {
+        &self.0
+    }
+
+    /// The sequence tag of the points of the table, see [`IngestRule::SequenceTag`].
+    pub fn sequence_tag(&self, table: &str) -> Option<&str> {
+        self.0.iter().find_map(|rule| match rule {
+            IngestRule::SequenceTag { table: t, tag } if t == table => Some(tag.as_str()),
+            _ => None,
+        })
+    }
+
+    pub fn rewriter(&self) -> IngestRewriter {
+        let rules = self
+            .0
+            .iter()
+            .map(|rule| {
+                let regex = match rule {
+                    // the pattern is checked when the rule is parsed
+                    IngestRule::ReplaceTag { pattern, .. } => Regex::new(pattern).ok(),
+                    _ => None,
+                };
+                (rule.clone(), regex)
+            })
+            .collect();
+        IngestRewriter { rules }
+    }
+}
+
+impl FromStr for IngestRules {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let rules = s
+            .split(';')
+            .filter(|rule| !rule.trim().is_empty())
+            .map(IngestRule::from_str)
+            .collect::<Result<Vec<_>, _>>()?;
+        Ok(Self(rules))
+    }
+}
+
+impl Display for IngestRules {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        for (i, rule) in self.0.iter().enumerate() {
+            if i > 0 {
+                write!(f, "; ")?;
+            }
+            write!(f, "{}", rule)?;
+        }
+        Ok(())
+    }
+}
+
+/// The ingest rules with the regexes compiled.
+pub struct IngestRewriter {
+    rules: Vec<(IngestRule, Option<Regex>)>,
+}
+
+impl IngestRewriter {
+    /// Rewrites the table, the tags and the fields of a point, returns false
+    /// if the point is dropped.
+    pub fn rewrite<'a>(
+        &self,
+        table: &mut Cow<'a, str>,
+        tags: &mut Vec<(Cow<'a, str>, Cow<'a, str>)>,
+        fields: &mut Vec<(Cow<'a, str>, FieldValue)>,
+    ) -> bool {
+        for (rule, regex) in self.rules.iter() {
+            match rule {
+                IngestRule::RenameTable { from, to } => {
+                    if table.as_ref() == from.as_str() {
+                        *table = Cow::Owned(to.clone());
+                    }
+                }
+                IngestRule::DropTable { name } => {
+                    if table.as_ref() == name.as_str() {
+                        return false;
+                    }
+                }
+                IngestRule::RenameTag { from, to } => {
+                    if tags.iter().any(|(k, _)| k.as_ref() == from.as_str()) {
+                        // the renamed tag takes the place of the existing one
+                        tags.retain(|(k, _)| k.as_ref() != to.as_str());
+                        for (k, _) in tags.iter_mut() {
+                            if k.as_ref() == from.as_str() {
+                                *k = Cow::Owned(to.clone());
+                            }
+                        }
+                    }
+                }
+                IngestRule::DropTag { name } => tags.retain(|(k, _)| k.as_ref() != name.as_str()),
+                IngestRule::ReplaceTag {
+                    tag, replacement, ..
+                } => {
+                    let regex = match regex {
+                        Some(regex) => regex,
+                        None => continue,
+                    };
+                    for (k, v) in tags.iter_mut() {
+                        if k.as_ref() != tag.as_str() {
+                            continue;
+                        }
+                        let new = match regex.replace_all(v.as_ref(), replacement.as_str()) {
+                            Cow::Owned(new) => new,
+                            Cow::Borrowed(_) => continue,
+                        };
+                        *v = Cow::Owned(new);
+                    }
+                }
+                IngestRule::DeriveField {
+                    table: derived_table,
+                    field,
+                    left,
+                    op,
+                    right,
+                } => {
+                    if table.as_ref() != derived_table.as_str() {
+                        continue;
+                    }
+                    let value = match (left.value(fields), right.value(fields)) {
+                        (Some(l), Some(r)) => op.eval(l, r),
+                        _ => continue,
+                    };
+                    if !value.is_finite() {
+                        continue;
+                    }
+                    fields.retain(|(k, _)| k.as_ref() != field.as_str());
+                    fields.push((Cow::Owned(field.clone()), FieldValue::F64(value)));
+                }
+                // applied to all the points of a write, not a single point
+                IngestRule::SequenceTag { .. } => {}
+            }
+        }
+        true
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::borrow::Cow;
+    use std::str::FromStr;
+
+    use protos::FieldValue;
+
+    use super::IngestRules;
+
+    #[test]
+    fn test_parse_ingest_rules() {
+        let text = "rename_table cpu0 cpu; drop_table tmp; rename_tag hostname host; \
+                    drop_tag dc; replace_tag host ^(.*)\\.local$ $1; \
+                    derive_field meter power voltage * current; sequence_tag trades seq";
+        let rules = IngestRules::from_str(text).unwrap();
+        assert_eq!(rules.rules().len(), 7);
+        assert_eq!(rules.sequence_tag("trades"), Some("seq"));
+        assert_eq!(rules.sequence_tag("cpu"), None);
+        assert_eq!(IngestRules::from_str(&rules.to_string()).unwrap(), rules);
+
+        assert!(IngestRules::from_str("").unwrap().is_empty());
+        assert!(IngestRules::from_str("rename_table cpu").is_err());
+        assert!(IngestRules::from_str("replace_tag host ( x").is_err());
+        assert!(IngestRules::from_str("derive_field meter power voltage % 2").is_err());
+    }
+
+    #[test]
+    fn test_rewrite() {
+        let rules = IngestRules::from_str(
+            "rename_table cpu0 cpu; drop_table tmp; rename_tag hostname host; \
+             drop_tag dc; replace_tag host ^(.*)\\.local$ $1",
+        )
+        .unwrap();
+        let rewriter = rules.rewriter();
+
+        let mut table = Cow::Borrowed("cpu0");
+        let mut tags = vec![
+            (Cow::Borrowed("hostname"), Cow::Borrowed("a.local")),
+            (Cow::Borrowed("dc"), Cow::Borrowed("x")),
+            (Cow::Borrowed("zone"), Cow::Borrowed("z")),
+        ];
+        assert!(rewriter.rewrite(&mut table, &mut tags, &mut vec![]));
+        assert_eq!(table, "cpu");
+        assert_eq!(
+            tags,
+            vec![
+                (Cow::Borrowed("host"), Cow::Borrowed("a")),
+                (Cow::Borrowed("zone"), Cow::Borrowed("z")),
+            ]
+        );
+
+        let mut table = Cow::Borrowed("tmp");
+        assert!(!rewriter.rewrite(&mut table, &mut vec![], &mut vec![]));
+    }
+
+    #[test]
+    fn test_derive_field() {
+        let rules = IngestRules::from_str(
+            "derive_field meter power voltage * current; derive_field meter half power / 2",
+        )
+        .unwrap();
+        let rewriter = rules.rewriter();
+
+        let mut table = Cow::Borrowed("meter");
+        let mut fields = vec![
+            (Cow::Borrowed("voltage"), FieldValue::F64(220.0)),
+            (Cow::Borrowed("current"), FieldValue::I64(2)),
+        ];
+        assert!(rewriter.rewrite(&mut table, &mut vec![], &mut fields));
+        assert_eq!(
+            fields[2..],
+            [
+                (Cow::Borrowed("power"), FieldValue::F64(440.0)),
+                (Cow::Borrowed("half"), FieldValue::F64(220.0)),
+            ]
+        );
+
+        // not derived without the operands, or for other tables
+        let mut fields = vec![(Cow::Borrowed("voltage"), FieldValue::F64(220.0))];
+        assert!(rewriter.rewrite(&mut table, &mut vec![], &mut fields));
+        assert_eq!(fields.len(), 1);
+        let mut table = Cow::Borrowed("other");
+        let mut fields = vec![
+            (Cow::Borrowed("voltage"), FieldValue::F64(220.0)),
+            (Cow::Borrowed("current"), FieldValue::I64(2)),
+        ];
+        assert!(rewriter.rewrite(&mut table, &mut vec![], &mut fields));
+        assert_eq!(fields.len(), 2);
+    }
+}
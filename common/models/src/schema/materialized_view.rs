@@ -0,0 +1,232 @@
+use std::fmt::{self, Display};
+
+use serde::{Deserialize, Serialize};
+
+/// An aggregation of a table grouped by a fixed time bucket and some tags of
+/// the table, stored in a table named after the view.
+///
+/// The rows of the view are `(time, tags..., aggregates...)`, the time is the
+/// start of the bucket, aligned to the unix epoch like `date_bin`.
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Hash)]
+pub struct MaterializedView {
+    pub name: String,
+    /// The table aggregated, in the database of the view.
+    pub source: String,
+    /// The width of the time bucket, in nanoseconds.
+    pub interval: i64,
+    pub tags: Vec<String>,
+    pub aggregates: Vec<ViewAggregate>,
+    /// The user maintaining the view, whose privileges the view is refreshed
+    /// with.
+    pub owner: String,
+    /// The time ranges written or deleted since they were refreshed, the
+    /// queries on them are not answered by the view. A view created is stale
+    /// for all the time until it is populated.
+    #[serde(default)]
+    pub stale: Vec<StaleRange>,
+}
+
+impl MaterializedView {
+    /// The start of the bucket of the timestamp in nanoseconds.
+    pub fn bucket(&self, ts: i64) -> i64 {
+        ts - ts.rem_euclid(self.interval)
+    }
+
+    /// The range of the buckets of the timestamps from `start` to `end`
+    /// inclusive, in nanoseconds.
+    pub fn bucket_range(&self, start: i64, end: i64, marked_at: i64) -> StaleRange {
+        let start = match start {
+            i64::MIN => i64::MIN,
+            start => self.bucket(start),
+        };
+        let end = match end {
+            i64::MAX => i64::MAX,
+            end => self.bucket(end).saturating_add(self.interval),
+        };
+        StaleRange {
+            start,
+            end,
+            marked_at,
+        }
+    }
+
+    /// Marks the range stale, a range marked again is kept with the latest
+    /// mark.
+    pub fn mark_stale(&mut self, range: StaleRange) {
+        match self
+            .stale
+            .iter_mut()
+            .find(|r| r.start == range.start && r.end == range.end)
+        {
+            Some(r) => r.marked_at = r.marked_at.max(range.marked_at),
+            None => self.stale.push(range),
+        }
+    }
+
+    /// Clears the ranges refreshed, unless they are marked again after the
+    /// marks refreshed.
+    pub fn clear_stale(&mut self, refreshed: &[StaleRange]) {
+        self.stale.retain(|r| {
+            !refreshed.iter().any(|refreshed| {
+                r.start == refreshed.start
+                    && r.end == refreshed.end
+                    && r.marked_at <= refreshed.marked_at
+            })
+        });
+    }
+
+    /// Whether the points from `start` to `end` exclusive are all aggregated
+    /// by the view.
+    pub fn is_fresh(&self, start: i64, end: i64) -> bool {
+        !self.stale.iter().any(|r| r.start < end && start < r.end)
+    }
+
+    pub fn aggregate(&self, func: ViewAggregateFunction, field: Option<&str>) -> Option<&str> {
+        self.aggregates
+            .iter()
+            .find(|agg| agg.func == func && agg.field.as_deref() == field)
+            .map(|agg| agg.column.as_str())
+    }
+}
+
+/// The time range from `start` to `end` exclusive in nanoseconds of a view
+/// to be refreshed, `marked_at` is the unix time in nanoseconds of the
+/// latest write or delete marking it.
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub struct StaleRange {
+    pub start: i64,
+    pub end: i64,
+    pub marked_at: i64,
+}
+
+impl StaleRange {
+    /// All the time, e.g. of a view not populated yet.
+    pub fn all(marked_at: i64) -> Self {
+        Self {
+            start: i64::MIN,
+            end: i64::MAX,
+            marked_at,
+        }
+    }
+}
+
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq, Hash)]
+pub struct ViewAggregate {
+    pub func: ViewAggregateFunction,
+    /// The field aggregated, `None` for `count(*)`.
+    pub field: Option<String>,
+    /// The column of the view storing the aggregate.
+    pub column: String,
+}
+
+/// The aggregates that can be merged from the aggregates of the buckets.
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum ViewAggregateFunction {
+    Count,
+    Sum,
+    Min,
+    Max,
+}
+
+impl Display for ViewAggregateFunction {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            ViewAggregateFunction::Count => "count",
+            ViewAggregateFunction::Sum => "sum",
+            ViewAggregateFunction::Min => "min",
+            ViewAggregateFunction::Max => "max",
+        })
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::{MaterializedView, StaleRange, ViewAggregate, ViewAggregateFunction};
+
+    #[test]
+    fn test_materialized_view() {
+        let view = MaterializedView {
+            name: "cpu_1m".to_string(),
+            source: "cpu".to_string(),
+            interval: 60_000_000_000,
+            tags: vec!["host".to_string()],
+            aggregates: vec![
+                ViewAggregate {
+                    func: ViewAggregateFunction::Count,
+                    field: None,
+                    column: "cnt".to_string(),
+                },
+                ViewAggregate {
+                    func: ViewAggregateFunction::Max,
+                    field: Some("usage".to_string()),
+                    column: "max_usage".to_string(),
+                },
+            ],
+            owner: "root".to_string(),
+            stale: vec![],
+        };
+
+        assert_eq!(view.bucket(0), 0);
+        assert_eq!(view.bucket(60_000_000_001), 60_000_000_000);
+        assert_eq!(view.bucket(-1), -60_000_000_000);
+
+        assert_eq!(
+            view.aggregate(ViewAggregateFunction::Count, None),
+            Some("cnt")
+        );
+        assert_eq!(
+            view.aggregate(ViewAggregateFunction::Max, Some("usage")),
+            Some("max_usage")
+        );
+        assert_eq!(
+            view.aggregate(ViewAggregateFunction::Min, Some("usage")),
+            None
+        );
+        assert_eq!(
+            view.aggregate(ViewAggregateFunction::Count, Some("usage")),
+            None
+        );
+    }
+
+    #[test]
+    fn test_stale_ranges() {
+        let minute = 60_000_000_000;
+        let mut view = MaterializedView {
+            name: "cpu_1m".to_string(),
+            source: "cpu".to_string(),
+            interval: minute,
+            tags: vec![],
+            aggregates: vec![],
+            owner: "root".to_string(),
+            stale: vec![StaleRange::all(1)],
+        };
+        assert!(!view.is_fresh(0, minute));
+
+        view.clear_stale(&[StaleRange::all(1)]);
+        assert!(view.is_fresh(i64::MIN, i64::MAX));
+
+        let range = view.bucket_range(minute + 1, 2 * minute, 2);
+        assert_eq!((range.start, range.end), (minute, 3 * minute));
+        let unbounded = view.bucket_range(i64::MIN, 1, 2);
+        assert_eq!((unbounded.start, unbounded.end), (i64::MIN, minute));
+
+        view.mark_stale(range);
+        assert!(view.is_fresh(0, minute));
+        assert!(view.is_fresh(3 * minute, 4 * minute));
+        assert!(!view.is_fresh(0, minute + 1));
+
+        // marked again while refreshed
+        view.mark_stale(StaleRange {
+            marked_at: 3,
+            ..range
+        });
+        assert_eq!(view.stale.len(), 1);
+        view.clear_stale(&[range]);
+        assert!(!view.is_fresh(minute, 2 * minute));
+        view.clear_stale(&[StaleRange {
+            marked_at: 3,
+            ..range
+        }]);
+        assert!(view.stale.is_empty());
+    }
+}
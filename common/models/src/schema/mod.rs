@@ -9,6 +9,8 @@
 
 pub mod database_schema;
 pub mod external_table_schema;
+pub mod ingest_rule;
+pub mod materialized_view;
 pub mod query_info;
 pub mod resource_info;
 pub mod stream_table_schema;
@@ -17,6 +19,9 @@ pub mod tenant;
 pub mod tskv_table_schema;
 
 pub const TIME_FIELD_NAME: &str = "time";
+/// The tag whose value is a duration, like "1h", after which the points of
+/// the series are deleted, regardless of the ttl of the database.
+pub const POINT_TTL_TAG: &str = "_ttl";
 pub const IS_TAG: &str = "_is_tag";
 pub const DEFAULT_DATABASE: &str = "public";
 pub const USAGE_SCHEMA: &str = "usage_schema";
@@ -2,6 +2,7 @@ use std::str::FromStr;
 
 use datafusion::datasource::file_format::file_type::{FileCompressionType, FileType};
 use utils::byte_nums::CnosByteNumber;
+use utils::duration::CnosDuration;
 
 use crate::arrow::arrow_data_type_to_sql_data_type;
 use crate::auth::role::CustomTenantRole;
@@ -114,6 +115,12 @@ impl ToDDLSql for UserDesc {
         let granted_admin = option
             .granted_admin()
             .map(|v| ("granted_admin", SqlParserValue::Boolean(v)));
+        let password_max_age = option.password_max_age().map(|v| {
+            (
+                "password_max_age",
+                SqlParserValue::SingleQuotedString(v.to_string()),
+            )
+        });
 
         let sql_opts = vec![
             hash_password,
@@ -121,6 +128,7 @@ impl ToDDLSql for UserDesc {
             must_change_password,
             rsa_public_key,
             granted_admin,
+            password_max_age,
         ];
         let opt_sql = sql_option_to_sql_str(sql_opts);
         if !opt_sql.is_empty() {
@@ -174,12 +182,72 @@ impl ToDDLSql for DatabaseSchema {
         res.push_str(format!("shard {} ", self.options.shard_num()).as_str());
         res.push_str(format!("replica {} ", self.options.replica()).as_str());
         res.push_str(format!("vnode_duration '{}' ", self.options.vnode_duration()).as_str());
+        if *self.options.future_limit() != CnosDuration::new_inf() {
+            res.push_str(format!("future_limit '{}' ", self.options.future_limit()).as_str());
+        }
+        if *self.options.past_limit() != CnosDuration::new_inf() {
+            res.push_str(format!("past_limit '{}' ", self.options.past_limit()).as_str());
+        }
+        if let Some(max_bucket_size) = self.options.max_bucket_size() {
+            res.push_str(
+                format!(
+                    "max_bucket_size '{}' ",
+                    CnosByteNumber::format_bytes(max_bucket_size)
+                )
+                .as_str(),
+            );
+        }
+        if !self.options.ingest_rules().is_empty() {
+            res.push_str(format!("ingest_rules '{}' ", self.options.ingest_rules()).as_str());
+        }
+        let quota = self.options.quota();
+        if let Some(max_disk_size) = quota.max_disk_size {
+            res.push_str(
+                format!(
+                    "max_disk_size '{}' ",
+                    CnosByteNumber::format_bytes(max_disk_size)
+                )
+                .as_str(),
+            );
+        }
+        if let Some(max_series) = quota.max_series {
+            res.push_str(format!("max_series {} ", max_series).as_str());
+        }
+        if let Some(max_writes_per_sec) = quota.max_writes_per_sec {
+            res.push_str(format!("max_writes_per_sec {} ", max_writes_per_sec).as_str());
+        }
 
         if res.trim().ends_with("with") {
             res = res.trim().trim_end_matches("with").trim().to_string();
         }
         res = res.trim().to_string();
 
+        let placement = self.options.placement();
+        if !placement.is_empty() {
+            res.push_str(" on");
+            if !placement.nodes.is_empty() {
+                let nodes = placement
+                    .nodes
+                    .iter()
+                    .map(|id| id.to_string())
+                    .collect::<Vec<_>>();
+                res.push_str(format!(" nodes ({})", nodes.join(", ")).as_str());
+            }
+            if let Some(zone) = &placement.zone {
+                res.push_str(
+                    format!(" zone {}", SqlParserValue::SingleQuotedString(zone.clone())).as_str(),
+                );
+            }
+            if !placement.tags.is_empty() {
+                let tags = placement
+                    .tags
+                    .iter()
+                    .map(|tag| SqlParserValue::SingleQuotedString(tag.clone()).to_string())
+                    .collect::<Vec<_>>();
+                res.push_str(format!(" tags ({})", tags.join(", ")).as_str());
+            }
+        }
+
         res.push(';');
         Ok(res)
     }
@@ -0,0 +1,197 @@
+use std::borrow::Cow;
+use std::collections::BTreeMap;
+
+use protos::FieldValue;
+use serde::Deserialize;
+use serde_json::Value;
+use snafu::Snafu;
+
+use crate::Line;
+
+#[derive(Debug, Snafu)]
+pub enum Error {
+    #[snafu(display("invalid json: {}", source))]
+    Json { source: serde_json::Error },
+
+    #[snafu(display("invalid point at {}: {}", index, reason))]
+    InvalidPoint { index: usize, reason: String },
+}
+
+impl Error {
+    /// Index of the point failed to convert, if known.
+    pub fn index(&self) -> Option<usize> {
+        match self {
+            Error::InvalidPoint { index, .. } => Some(*index),
+            Error::Json { .. } => None,
+        }
+    }
+}
+
+pub type Result<T, E = Error> = std::result::Result<T, E>;
+
+/// A point of the JSON write body, e.g.
+///
+/// ```json
+/// {
+///     "measurement": "air",
+///     "tags": {"station": "XiaoMaiDao"},
+///     "fields": {"temperature": 20.5, "visibility": {"i64": 50}, "status": "ok"},
+///     "time": 1700000000000000000
+/// }
+/// ```
+///
+/// Numbers are written as floats like the untyped numbers of line protocol,
+/// `{"i64": n}`, `{"u64": n}` and `{"f64": n}` give the type explicitly.
+/// Fields with null value are skipped, `time` is in the request precision
+/// and defaults to now.
+#[derive(Debug, Deserialize)]
+pub struct JsonPoint<'a> {
+    #[serde(borrow)]
+    pub measurement: Cow<'a, str>,
+    #[serde(default)]
+    pub tags: BTreeMap<Cow<'a, str>, Cow<'a, str>>,
+    pub fields: BTreeMap<Cow<'a, str>, Value>,
+    #[serde(default)]
+    pub time: Option<i64>,
+}
+
+impl<'a> JsonPoint<'a> {
+    fn into_line(self, index: usize, default_time: i64) -> Result<Line<'a>> {
+        if self.measurement.is_empty() {
+            return Err(Error::InvalidPoint {
+                index,
+                reason: "measurement is empty".to_string(),
+            });
+        }
+
+        let mut fields = Vec::with_capacity(self.fields.len());
+        for (key, value) in self.fields {
+            if value.is_null() {
+                continue;
+            }
+            let value = json_to_field_value(&value).ok_or_else(|| Error::InvalidPoint {
+                index,
+                reason: format!("invalid value of field '{}': {}", key, value),
+            })?;
+            fields.push((key, value));
+        }
+        if fields.is_empty() {
+            return Err(Error::InvalidPoint {
+                index,
+                reason: "no field".to_string(),
+            });
+        }
+
+        let mut line = Line {
+            hash_id: 0,
+            table: self.measurement,
+            tags: self.tags.into_iter().collect(),
+            fields,
+            timestamp: self.time.unwrap_or(default_time),
+        };
+        line.sort_dedup_and_hash();
+        Ok(line)
+    }
+}
+
+fn json_to_field_value(value: &Value) -> Option<FieldValue> {
+    match value {
+        Value::Bool(b) => Some(FieldValue::Bool(*b)),
+        Value::Number(n) => n.as_f64().map(FieldValue::F64),
+        Value::String(s) => Some(FieldValue::Str(s.as_bytes().to_vec())),
+        Value::Object(typed) if typed.len() == 1 => {
+            let (data_type, v) = typed.iter().next()?;
+            match data_type.as_str() {
+                "i64" => v.as_i64().map(FieldValue::I64),
+                "u64" => v.as_u64().map(FieldValue::U64),
+                "f64" => v.as_f64().map(FieldValue::F64),
+                _ => None,
+            }
+        }
+        _ => None,
+    }
+}
+
+/// Convert a JSON array of [`JsonPoint`], or a single one, to lines.
+pub fn json_points_to_lines(body: &str, default_time: i64) -> Result<Vec<Line>> {
+    let points = if body.trim_start().starts_with('[') {
+        serde_json::from_str::<Vec<JsonPoint>>(body).map_err(|source| Error::Json { source })?
+    } else {
+        vec![serde_json::from_str::<JsonPoint>(body).map_err(|source| Error::Json { source })?]
+    };
+
+    points
+        .into_iter()
+        .enumerate()
+        .map(|(index, point)| point.into_line(index, default_time))
+        .collect()
+}
+
+#[cfg(test)]
+mod test {
+    use std::borrow::Cow;
+
+    use protos::FieldValue;
+
+    use super::{json_points_to_lines, Error};
+
+    #[test]
+    fn test_json_points_to_lines() {
+        let body = r#"[
+            {"measurement": "air", "tags": {"station": "b", "city": "a"},
+             "fields": {"temperature": 20, "visibility": {"i64": 50}, "status": "ok", "x": null},
+             "time": 1},
+            {"measurement": "air", "fields": {"pressure": {"u64": 7}, "alarm": true}}
+        ]"#;
+        let lines = json_points_to_lines(body, 100).unwrap();
+        assert_eq!(lines.len(), 2);
+
+        assert_eq!(lines[0].table, "air");
+        assert_eq!(
+            lines[0].tags,
+            vec![
+                (Cow::Borrowed("city"), Cow::Borrowed("a")),
+                (Cow::Borrowed("station"), Cow::Borrowed("b"))
+            ]
+        );
+        assert_eq!(
+            lines[0].fields,
+            vec![
+                (Cow::Borrowed("status"), FieldValue::Str(b"ok".to_vec())),
+                (Cow::Borrowed("temperature"), FieldValue::F64(20.0)),
+                (Cow::Borrowed("visibility"), FieldValue::I64(50)),
+            ]
+        );
+        assert_eq!(lines[0].timestamp, 1);
+
+        assert!(lines[1].tags.is_empty());
+        assert_eq!(
+            lines[1].fields,
+            vec![
+                (Cow::Borrowed("alarm"), FieldValue::Bool(true)),
+                (Cow::Borrowed("pressure"), FieldValue::U64(7)),
+            ]
+        );
+        assert_eq!(lines[1].timestamp, 100);
+
+        let lines = json_points_to_lines(r#"{"measurement": "m", "fields": {"f": 1}}"#, 1).unwrap();
+        assert_eq!(lines.len(), 1);
+    }
+
+    #[test]
+    fn test_invalid_json_points() {
+        let err = json_points_to_lines(r#"[{"measurement": "m"}]"#, 1).unwrap_err();
+        assert!(matches!(err, Error::Json { .. }));
+        assert_eq!(err.index(), None);
+
+        let body = r#"[
+            {"measurement": "m", "fields": {"f": 1}},
+            {"measurement": "m", "fields": {"f": {"i32": 1}}}
+        ]"#;
+        let err = json_points_to_lines(body, 1).unwrap_err();
+        assert_eq!(err.index(), Some(1));
+
+        let body = r#"[{"measurement": "m", "fields": {"f": null}}]"#;
+        assert_eq!(json_points_to_lines(body, 1).unwrap_err().index(), Some(0));
+    }
+}
@@ -11,11 +11,13 @@ use utils::BkdrHasher;
 
 pub type Result<T, E = Error> = std::result::Result<T, E>;
 pub use json_protocol::parser::Error as JsonLogError;
+pub use json_write::Error as JsonWriteError;
 pub use line_protocol::parser::Error as LineProtocolError;
 
 type NextTagRes<'a> = Result<Option<(Vec<(Cow<'a, str>, Cow<'a, str>)>, usize)>>;
 
 pub mod json_protocol;
+pub mod json_write;
 pub mod line_protocol;
 pub mod lines_convert;
 pub mod open_tsdb;
@@ -117,9 +119,26 @@ impl<'a> Line<'_> {
         res
     }
 
+    /// An empty line with room for `tags` tags and `fields` fields.
+    pub fn with_capacity(tags: usize, fields: usize) -> Line<'a> {
+        Line {
+            hash_id: 0,
+            table: Cow::Borrowed(""),
+            tags: Vec::with_capacity(tags),
+            fields: Vec::with_capacity(fields),
+            timestamp: 0,
+        }
+    }
+
     pub fn sort_dedup_and_hash(&mut self) {
-        self.tags.sort_by(|a, b| a.0.cmp(&b.0));
-        self.fields.sort_by(|a, b| a.0.cmp(&b.0));
+        // the keys are mostly written in order already, skip the sort
+        // (and the buffer of the stable sort) for them
+        if !self.tags.windows(2).all(|w| w[0].0 <= w[1].0) {
+            self.tags.sort_by(|a, b| a.0.cmp(&b.0));
+        }
+        if !self.fields.windows(2).all(|w| w[0].0 <= w[1].0) {
+            self.fields.sort_by(|a, b| a.0.cmp(&b.0));
+        }
         self.tags.dedup_by(|a, b| a.0 == b.0);
         self.fields.dedup_by(|a, b| a.0 == b.0);
         self.init_ordered_hash_id();
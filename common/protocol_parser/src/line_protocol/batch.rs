@@ -0,0 +1,187 @@
+//! Encodes the record batches of the tables as line protocol, e.g. to
+//! export the rows or to forward the writes.
+
+use std::borrow::Cow;
+
+use datafusion::arrow::array::{Array, ArrayRef, AsArray};
+use datafusion::arrow::compute::cast;
+use datafusion::arrow::datatypes::{DataType, Float64Type, Int64Type, TimeUnit, UInt64Type};
+use datafusion::arrow::error::ArrowError;
+use datafusion::arrow::record_batch::RecordBatch;
+use models::schema::tskv_table_schema::{ColumnType, TskvTableSchema};
+use protos::FieldValue;
+
+use super::lines_to_line_protocol;
+use crate::Line;
+
+/// Appends the rows of a batch of the table to `buf` as line protocol, the
+/// null tags and fields are omitted, and the rows without any field are
+/// skipped. The timestamps are encoded in nanoseconds.
+pub fn batch_to_line_protocol(
+    table: &TskvTableSchema,
+    batch: &RecordBatch,
+    buf: &mut Vec<u8>,
+) -> Result<(), ArrowError> {
+    let schema = batch.schema();
+    let mut timestamps = None;
+    let mut tag_arrays = vec![];
+    let mut fields = vec![];
+    for (field, array) in schema.fields().iter().zip(batch.columns()) {
+        match table.column(field.name()).map(|c| &c.column_type) {
+            Some(ColumnType::Time(_)) => timestamps = Some(timestamps_nanos(array)?),
+            Some(ColumnType::Tag) => {
+                tag_arrays.push((field.name().as_str(), cast(array, &DataType::Utf8)?))
+            }
+            Some(ColumnType::Field(_)) => fields.push((field.name().as_str(), array)),
+            None => {}
+        }
+    }
+    let timestamps = timestamps.ok_or_else(|| {
+        ArrowError::SchemaError(format!("the time column of {} is not queried", table.name))
+    })?;
+    let tags = tag_arrays
+        .iter()
+        .map(|(name, array)| (*name, array.as_string::<i32>()))
+        .collect::<Vec<_>>();
+
+    let mut lines = Vec::with_capacity(batch.num_rows());
+    for (row, timestamp) in timestamps.into_iter().enumerate() {
+        let mut line = Line::with_capacity(tags.len(), fields.len());
+        for (name, array) in &fields {
+            if let Some(value) = field_value(array, row)? {
+                line.fields.push((Cow::Borrowed(*name), value));
+            }
+        }
+        if line.fields.is_empty() {
+            continue;
+        }
+        for (name, array) in &tags {
+            if array.is_valid(row) {
+                line.tags
+                    .push((Cow::Borrowed(*name), Cow::Borrowed(array.value(row))));
+            }
+        }
+        line.table = Cow::Borrowed(&table.name);
+        line.timestamp = timestamp;
+        lines.push(line);
+    }
+    lines_to_line_protocol(&lines, buf);
+
+    Ok(())
+}
+
+fn timestamps_nanos(array: &ArrayRef) -> Result<Vec<i64>, ArrowError> {
+    let factor = match array.data_type() {
+        DataType::Timestamp(TimeUnit::Second, _) => 1_000_000_000,
+        DataType::Timestamp(TimeUnit::Millisecond, _) => 1_000_000,
+        DataType::Timestamp(TimeUnit::Microsecond, _) => 1_000,
+        DataType::Timestamp(TimeUnit::Nanosecond, _) => 1,
+        other => {
+            return Err(ArrowError::SchemaError(format!(
+                "the time column is {other}, expect a timestamp"
+            )))
+        }
+    };
+    let values = cast(array, &DataType::Int64)?;
+    Ok(values
+        .as_primitive::<Int64Type>()
+        .values()
+        .iter()
+        .map(|v| v.saturating_mul(factor))
+        .collect())
+}
+
+fn field_value(array: &ArrayRef, row: usize) -> Result<Option<FieldValue>, ArrowError> {
+    if array.is_null(row) {
+        return Ok(None);
+    }
+    let value = match array.data_type() {
+        DataType::Float64 => FieldValue::F64(array.as_primitive::<Float64Type>().value(row)),
+        DataType::Int64 => FieldValue::I64(array.as_primitive::<Int64Type>().value(row)),
+        DataType::UInt64 => FieldValue::U64(array.as_primitive::<UInt64Type>().value(row)),
+        DataType::Boolean => FieldValue::Bool(array.as_boolean().value(row)),
+        DataType::Utf8 => {
+            let value = array.as_string::<i32>().value(row);
+            FieldValue::Str(value.as_bytes().to_vec())
+        }
+        other => {
+            return Err(ArrowError::NotYetImplemented(format!(
+                "export the field of type {other}"
+            )))
+        }
+    };
+    Ok(Some(value))
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use datafusion::arrow::array::{
+        Float64Array, Int64Array, StringArray, TimestampNanosecondArray,
+    };
+    use datafusion::arrow::datatypes::TimeUnit;
+    use datafusion::arrow::record_batch::RecordBatch;
+    use models::schema::tskv_table_schema::{ColumnType, TableColumn, TskvTableSchema};
+    use models::ValueType;
+
+    use super::batch_to_line_protocol;
+
+    fn table() -> TskvTableSchema {
+        TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            "air".to_string(),
+            vec![
+                TableColumn::new_time_column(0, TimeUnit::Nanosecond),
+                TableColumn::new_tag_column(1, "station".to_string()),
+                TableColumn::new(
+                    2,
+                    "visibility".to_string(),
+                    ColumnType::Field(ValueType::Float),
+                    Default::default(),
+                ),
+                TableColumn::new(
+                    3,
+                    "pressure".to_string(),
+                    ColumnType::Field(ValueType::Integer),
+                    Default::default(),
+                ),
+                TableColumn::new(
+                    4,
+                    "note".to_string(),
+                    ColumnType::Field(ValueType::String),
+                    Default::default(),
+                ),
+            ],
+        )
+    }
+
+    #[test]
+    fn test_batch_to_line_protocol() {
+        let table = table();
+        let batch = RecordBatch::try_new(
+            table.to_arrow_schema(),
+            vec![
+                Arc::new(TimestampNanosecondArray::from(vec![1, 2, 3])),
+                Arc::new(StringArray::from(vec![
+                    Some("XiaoMaiDao"),
+                    None,
+                    Some("a b"),
+                ])),
+                Arc::new(Float64Array::from(vec![Some(56.5), Some(1.0), None])),
+                Arc::new(Int64Array::from(vec![Some(-2), None, None])),
+                Arc::new(StringArray::from(vec![Some("say \"hi\""), None, None])),
+            ],
+        )
+        .unwrap();
+
+        let mut buf = vec![];
+        batch_to_line_protocol(&table, &batch, &mut buf).unwrap();
+        assert_eq!(
+            String::from_utf8(buf).unwrap(),
+            "air,station=XiaoMaiDao visibility=56.5,pressure=-2i,note=\"say \\\"hi\\\"\" 1\n\
+             air visibility=1 2\n"
+        );
+    }
+}
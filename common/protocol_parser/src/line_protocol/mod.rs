@@ -1,9 +1,71 @@
+use protos::FieldValue;
+
+pub use self::batch::batch_to_line_protocol;
 use self::parser::{Parser, Result};
+pub use self::points::points_to_line_protocol;
 use crate::Line;
 
+mod batch;
 pub mod parser;
+mod points;
 
 pub fn line_protocol_to_lines(lines: &str, default_time: i64) -> Result<Vec<Line>> {
     let parser = Parser::new(default_time);
     parser.parse(lines)
 }
+
+/// Encode the lines to line protocol, one line per row.
+pub fn lines_to_line_protocol(lines: &[Line], buf: &mut Vec<u8>) {
+    for line in lines {
+        escape_into(buf, line.table.as_bytes(), b", ");
+        for (key, value) in &line.tags {
+            buf.push(b',');
+            escape_into(buf, key.as_bytes(), b",= ");
+            buf.push(b'=');
+            escape_into(buf, value.as_bytes(), b",= ");
+        }
+        for (i, (key, value)) in line.fields.iter().enumerate() {
+            buf.push(if i == 0 { b' ' } else { b',' });
+            escape_into(buf, key.as_bytes(), b",= ");
+            buf.push(b'=');
+            match value {
+                FieldValue::U64(v) => buf.extend_from_slice(format!("{}u", v).as_bytes()),
+                FieldValue::I64(v) => buf.extend_from_slice(format!("{}i", v).as_bytes()),
+                FieldValue::F64(v) => buf.extend_from_slice(v.to_string().as_bytes()),
+                FieldValue::Bool(v) => buf.extend_from_slice(v.to_string().as_bytes()),
+                FieldValue::Str(v) => {
+                    buf.push(b'"');
+                    escape_into(buf, v, b"\"\\");
+                    buf.push(b'"');
+                }
+            }
+        }
+        buf.extend_from_slice(format!(" {}\n", line.timestamp).as_bytes());
+    }
+}
+
+fn escape_into(buf: &mut Vec<u8>, s: &[u8], special: &[u8]) {
+    for c in s {
+        if special.contains(c) {
+            buf.push(b'\\');
+        }
+        buf.push(*c);
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::{line_protocol_to_lines, lines_to_line_protocol};
+
+    #[test]
+    fn test_lines_to_line_protocol() {
+        let data =
+            "m\\ a\\,b,t\\=1=v\\ 1,t2=v2 f=1.5,i=-2i,u=3u,b=true,s=\"say \\\"hi\\\" \\\\\" 1\n\
+                    m f=1 2\n";
+        let lines = line_protocol_to_lines(data, 0).unwrap();
+        let mut buf = vec![];
+        lines_to_line_protocol(&lines, &mut buf);
+        let encoded = String::from_utf8(buf).unwrap();
+        assert_eq!(line_protocol_to_lines(&encoded, 0).unwrap(), lines);
+    }
+}
@@ -1,4 +1,5 @@
 use std::borrow::Cow;
+use std::str::FromStr;
 
 use itertools::Itertools;
 use protos::FieldValue;
@@ -22,6 +23,22 @@ pub enum Error {
 
     #[snafu(display("fail to parse timestamp at {}", pos))]
     Timestamp { pos: usize },
+
+    #[snafu(display("no valid field in the line start at {}", pos))]
+    EmptyFields { pos: usize },
+}
+
+impl Error {
+    /// Byte offset in the request where the error occurred, if known.
+    pub fn pos(&self) -> Option<usize> {
+        match self {
+            Error::UnexpectedToken { pos, .. }
+            | Error::UnexpectedEnd { pos }
+            | Error::Timestamp { pos }
+            | Error::EmptyFields { pos } => Some(*pos),
+            Error::InvaildSyntax | Error::FieldValue { .. } => None,
+        }
+    }
 }
 
 pub type Result<T, E = Error> = std::result::Result<T, E>;
@@ -37,18 +54,109 @@ enum ParseStatus {
     Timestamp,
 }
 
+/// How to handle the float field values `inf` and `NaN`.
+#[derive(Debug, Clone, Copy, PartialEq, Default)]
+pub enum NonFiniteFloat {
+    /// Write the value as is.
+    #[default]
+    Keep,
+    /// Reject the line.
+    Reject,
+    /// Skip the field, so it's null in the written row.
+    Null,
+    /// Write the sentinel instead.
+    Sentinel(f64),
+}
+
+impl FromStr for NonFiniteFloat {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_ascii_lowercase().as_str() {
+            "keep" => Ok(Self::Keep),
+            "reject" => Ok(Self::Reject),
+            "null" => Ok(Self::Null),
+            _ => match s.parse::<f64>() {
+                Ok(v) if v.is_finite() => Ok(Self::Sentinel(v)),
+                _ => Err(format!(
+                    "invalid non-finite float handling '{}', expect keep, reject, null or a finite number",
+                    s
+                )),
+            },
+        }
+    }
+}
+
 pub struct Parser {
     default_time: i64,
+    non_finite_float: NonFiniteFloat,
+    unicode_escape: bool,
 }
 
 impl Parser {
     pub fn new(default_time: i64) -> Self {
-        Self { default_time }
+        Self {
+            default_time,
+            non_finite_float: NonFiniteFloat::default(),
+            unicode_escape: false,
+        }
+    }
+
+    pub fn with_non_finite_float(mut self, non_finite_float: NonFiniteFloat) -> Self {
+        self.non_finite_float = non_finite_float;
+        self
+    }
+
+    /// Decode the `\uXXXX` escapes in string field values.
+    pub fn with_unicode_escape(mut self, unicode_escape: bool) -> Self {
+        self.unicode_escape = unicode_escape;
+        self
     }
 
     pub fn parse<'a>(&self, data: &'a str) -> Result<Vec<Line<'a>>> {
-        let mut lines = vec![];
+        // one line at most per '\n', saves the reallocations of big requests
+        let mut lines = Vec::with_capacity(count_lines(data));
+        self.parse_into(data, &mut lines, &mut 0)?;
+        Ok(lines)
+    }
+
+    /// Parse the lines could be parsed and skip the others, return the
+    /// parsed lines, and the errors with the byte offset of the lines failed.
+    pub fn parse_lenient<'a>(&self, data: &'a str) -> (Vec<Line<'a>>, Vec<(usize, Error)>) {
+        let mut lines = Vec::with_capacity(count_lines(data));
+        let mut errors = vec![];
+
+        let mut offset = 0;
+        while offset < data.len() {
+            let mut line_start = 0;
+            match self.parse_into(&data[offset..], &mut lines, &mut line_start) {
+                Ok(()) => break,
+                Err(e) => {
+                    let line_start = offset + line_start;
+                    errors.push((line_start, e));
+                    // continue with the next line
+                    offset = match data.as_bytes()[line_start..]
+                        .iter()
+                        .position(|b| *b == b'\n')
+                    {
+                        Some(len) => line_start + len + 1,
+                        None => data.len(),
+                    };
+                }
+            }
+        }
+
+        (lines, errors)
+    }
 
+    /// Parse the data into `lines`, `line_start` is set to the byte offset
+    /// of the line being parsed, so it points to the bad line on error.
+    fn parse_into<'a>(
+        &self,
+        data: &'a str,
+        lines: &mut Vec<Line<'a>>,
+        line_start: &mut usize,
+    ) -> Result<()> {
         let mut line = Line::default();
 
         let mut comment = false;
@@ -80,6 +188,7 @@ impl Parser {
                         continue;
                     }
 
+                    *line_start = index;
                     key_idx = (index, 0, false);
                     status = ParseStatus::Table;
                 }
@@ -203,7 +312,9 @@ impl Parser {
                     }
 
                     if next_escape {
-                        if !matches!(char, b'\'' | b'\"' | b'\\') {
+                        if !matches!(char, b'\'' | b'\"' | b'\\')
+                            && !(self.unicode_escape && char == b'u')
+                        {
                             return Err(Error::UnexpectedToken {
                                 pos: index,
                                 token: char as char,
@@ -218,28 +329,42 @@ impl Parser {
                         val_idx.2 = true;
                     } else if char == b',' && !inside_quotes {
                         let key = escape(&data_bytes[key_idx.0..key_idx.1], key_idx.2)?;
-                        let val = parse_field_value(&data_bytes[val_idx.0..index], val_idx.2)?;
-                        line.fields.push((key, val));
+                        if let Some(val) =
+                            self.parse_field_value(&data_bytes[val_idx.0..index], val_idx.2)?
+                        {
+                            line.fields.push((key, val));
+                        }
 
                         key_idx = (index + 1, 0, false);
                         status = ParseStatus::FieldKey;
                     } else if char == b' ' && !inside_quotes {
                         let key = escape(&data_bytes[key_idx.0..key_idx.1], key_idx.2)?;
-                        let val = parse_field_value(&data_bytes[val_idx.0..index], val_idx.2)?;
-                        line.fields.push((key, val));
+                        if let Some(val) =
+                            self.parse_field_value(&data_bytes[val_idx.0..index], val_idx.2)?
+                        {
+                            line.fields.push((key, val));
+                        }
 
                         key_idx = (index, 0, false);
                         skip_space = true;
                     } else if (char == b'\r' || char == b'\n') && !inside_quotes {
                         let key = escape(&data_bytes[key_idx.0..key_idx.1], key_idx.2)?;
-                        let val = parse_field_value(&data_bytes[val_idx.0..index], val_idx.2)?;
-                        line.fields.push((key, val));
+                        if let Some(val) =
+                            self.parse_field_value(&data_bytes[val_idx.0..index], val_idx.2)?
+                        {
+                            line.fields.push((key, val));
+                        }
 
+                        if line.fields.is_empty() {
+                            return Err(Error::EmptyFields { pos: *line_start });
+                        }
                         line.timestamp = self.default_time;
+                        // lines of a request mostly have the same tags and
+                        // fields, size the next line by this one
+                        let next = Line::with_capacity(line.tags.len(), line.fields.len());
                         line.sort_dedup_and_hash();
-                        lines.push(line);
+                        lines.push(std::mem::replace(&mut line, next));
 
-                        line = Line::default();
                         key_idx = (0, 0, false);
                         status = ParseStatus::LineBegin;
                     }
@@ -253,11 +378,16 @@ impl Parser {
                             atoi_simd::parse(&data_bytes[key_idx.0..index])
                                 .map_err(|_| Error::Timestamp { pos: index })?
                         };
+                        if line.fields.is_empty() {
+                            return Err(Error::EmptyFields { pos: *line_start });
+                        }
                         line.timestamp = timestamp;
+                        // lines of a request mostly have the same tags and
+                        // fields, size the next line by this one
+                        let next = Line::with_capacity(line.tags.len(), line.fields.len());
                         line.sort_dedup_and_hash();
-                        lines.push(line);
+                        lines.push(std::mem::replace(&mut line, next));
 
-                        line = Line::default();
                         key_idx = (index + 1, 0, false);
                         status = ParseStatus::LineBegin;
                     }
@@ -274,6 +404,9 @@ impl Parser {
                 timestamp
             };
 
+            if line.fields.is_empty() {
+                return Err(Error::EmptyFields { pos: *line_start });
+            }
             line.timestamp = timestamp;
             line.sort_dedup_and_hash();
             lines.push(line);
@@ -286,10 +419,14 @@ impl Parser {
 
             if key_idx.1 > key_idx.0 && data_bytes.len() > val_idx.0 {
                 let key = escape(&data_bytes[key_idx.0..key_idx.1], key_idx.2)?;
-                let val = parse_field_value(&data_bytes[val_idx.0..], val_idx.2)?;
-                line.fields.push((key, val));
+                if let Some(val) = self.parse_field_value(&data_bytes[val_idx.0..], val_idx.2)? {
+                    line.fields.push((key, val));
+                }
             }
 
+            if line.fields.is_empty() {
+                return Err(Error::EmptyFields { pos: *line_start });
+            }
             line.timestamp = self.default_time;
             line.sort_dedup_and_hash();
             lines.push(line);
@@ -298,11 +435,32 @@ impl Parser {
         }
 
         if let ParseStatus::LineBegin = status {
-            return Ok(lines);
+            return Ok(());
         }
 
         Err(Error::UnexpectedEnd { pos: key_idx.0 })
     }
+
+    /// Parse the field value, returns `None` if the field should be skipped.
+    fn parse_field_value(&self, buf: &[u8], need_unescape: bool) -> Result<Option<FieldValue>> {
+        let val = parse_field_value(buf, need_unescape, self.unicode_escape)?;
+        match val {
+            FieldValue::F64(v) if !v.is_finite() => match self.non_finite_float {
+                NonFiniteFloat::Keep => Ok(Some(val)),
+                NonFiniteFloat::Reject => Err(Error::FieldValue {
+                    content: u8_slice_to_str_unchecked(buf).to_owned(),
+                }),
+                NonFiniteFloat::Null => Ok(None),
+                NonFiniteFloat::Sentinel(sentinel) => Ok(Some(FieldValue::F64(sentinel))),
+            },
+            _ => Ok(Some(val)),
+        }
+    }
+}
+
+/// The number of lines in the data, at least the number of lines parsed.
+fn count_lines(data: &str) -> usize {
+    data.bytes().filter(|b| *b == b'\n').count() + 1
 }
 
 fn escape(s: &[u8], need_unescape: bool) -> Result<Cow<str>> {
@@ -325,12 +483,13 @@ fn escape(s: &[u8], need_unescape: bool) -> Result<Cow<str>> {
     }))
 }
 
-fn parse_field_value(buf: &[u8], need_unescape: bool) -> Result<FieldValue> {
+fn parse_field_value(buf: &[u8], need_unescape: bool, unicode_escape: bool) -> Result<FieldValue> {
     match buf[0] {
         b't' | b'T' => parse_boolean_field(buf, true),
         b'f' | b'F' => parse_boolean_field(buf, false),
-        b'"' => parse_string_field(buf, need_unescape),
-        b'+' | b'-' | b'0'..=b'9' => parse_numeric_field(buf),
+        b'"' => parse_string_field(buf, need_unescape, unicode_escape),
+        // inf, infinity and nan
+        b'+' | b'-' | b'0'..=b'9' | b'i' | b'I' | b'n' | b'N' => parse_numeric_field(buf),
         _ => Err(Error::FieldValue {
             content: u8_slice_to_str_unchecked(buf).to_owned(),
         }),
@@ -376,13 +535,16 @@ fn parse_boolean_field(buf: &[u8], boolean: bool) -> Result<FieldValue> {
     }
 }
 
-fn parse_string_field(buf: &[u8], need_unescape: bool) -> Result<FieldValue> {
+fn parse_string_field(buf: &[u8], need_unescape: bool, unicode_escape: bool) -> Result<FieldValue> {
     if buf.len() < 2 {
         return Err(Error::FieldValue {
             content: u8_slice_to_str_unchecked(buf).to_owned(),
         });
     }
     match (buf[0], buf[buf.len() - 1]) {
+        (b'"', b'"') if need_unescape && unicode_escape => Ok(FieldValue::Str(
+            unicode_escaped_field_value(&buf[1..buf.len() - 1])?,
+        )),
         (b'"', b'"') => Ok(FieldValue::Str(escaped_field_value(
             &buf[1..buf.len() - 1],
             need_unescape,
@@ -418,6 +580,60 @@ fn escaped_field_value(buf: &[u8], need_unescape: bool) -> Result<Vec<u8>> {
     Ok(ownd_bytes)
 }
 
+/// Like [`escaped_field_value`], but also decodes the `\uXXXX` escapes,
+/// characters outside the BMP are expected as surrogate pairs.
+fn unicode_escaped_field_value(buf: &[u8]) -> Result<Vec<u8>> {
+    let invalid = || Error::FieldValue {
+        content: u8_slice_to_str_unchecked(buf).to_owned(),
+    };
+
+    let mut ownd_bytes = Vec::with_capacity(buf.len());
+    let mut i = 0;
+    while i < buf.len() {
+        if buf[i] == b'\\' && i + 1 < buf.len() {
+            match buf[i + 1] {
+                b'"' | b'\\' => {
+                    ownd_bytes.push(buf[i + 1]);
+                    i += 2;
+                    continue;
+                }
+                b'u' => {
+                    let high = parse_utf16_escape(&buf[i..]).ok_or_else(invalid)?;
+                    i += 6;
+                    let code = if (0xD800..0xDC00).contains(&high) {
+                        let low = parse_utf16_escape(&buf[i..])
+                            .filter(|low| (0xDC00..0xE000).contains(low))
+                            .ok_or_else(invalid)?;
+                        i += 6;
+                        0x10000 + ((high - 0xD800) << 10) + (low - 0xDC00)
+                    } else {
+                        high
+                    };
+                    let c = char::from_u32(code).ok_or_else(invalid)?;
+                    ownd_bytes.extend_from_slice(c.encode_utf8(&mut [0; 4]).as_bytes());
+                    continue;
+                }
+                _ => {}
+            }
+        }
+        ownd_bytes.push(buf[i]);
+        i += 1;
+    }
+    Ok(ownd_bytes)
+}
+
+/// Parse the UTF-16 code unit of a `\uXXXX` at the beginning of `buf`.
+fn parse_utf16_escape(buf: &[u8]) -> Option<u32> {
+    if buf.len() < 6
+        || buf[0] != b'\\'
+        || buf[1] != b'u'
+        || !buf[2..6].iter().all(u8::is_ascii_hexdigit)
+    {
+        return None;
+    }
+    u32::from_str_radix(u8_slice_to_str_unchecked(&buf[2..6]), 16).ok()
+}
+
 fn u8_slice_to_str_unchecked(slice: &[u8]) -> &str {
     unsafe { std::str::from_utf8_unchecked(slice) }
 }
@@ -430,7 +646,7 @@ mod test {
 
     use protos::FieldValue;
 
-    use crate::line_protocol::parser::Parser;
+    use crate::line_protocol::parser::{Error, NonFiniteFloat, Parser};
     use crate::line_protocol::Line;
 
     // Some of the tests are from https://github.com/influxdata/line-protocol/blob/v2/lineprotocol/decoder_test.go
@@ -651,6 +867,83 @@ comma\,1,equals\==e\,x,two=val2 field\=x="fir\"
         assert!(res.is_err())
     }
 
+    #[test]
+    fn test_parse_lenient() {
+        let parser = Parser::new(-1);
+        let data = "ma fa=1 1\nm\\x fa=1 2\nmc fa=1 12x\nmd fa=1i 4";
+        let (lines, errors) = parser.parse_lenient(data);
+        assert_eq!(
+            lines.iter().map(|l| l.table.as_ref()).collect::<Vec<_>>(),
+            vec!["ma", "md"]
+        );
+        assert_eq!(
+            errors.iter().map(|(pos, _)| *pos).collect::<Vec<_>>(),
+            vec![10, 20]
+        );
+        assert_eq!(errors[1].1, Error::Timestamp { pos: 11 });
+
+        let (lines, errors) = parser.parse_lenient("ma fa=1 1\n");
+        assert_eq!(lines.len(), 1);
+        assert!(errors.is_empty());
+    }
+
+    #[test]
+    fn test_non_finite_float() {
+        let data = "m fa=inf,fb=1 1\nm fa=-inf,fb=2 2";
+
+        let lines = Parser::new(-1).parse(data).unwrap();
+        assert_eq!(lines[0].fields[0].1, FieldValue::F64(f64::INFINITY));
+        assert_eq!(lines[1].fields[0].1, FieldValue::F64(f64::NEG_INFINITY));
+
+        let parser = Parser::new(-1).with_non_finite_float(NonFiniteFloat::Reject);
+        assert_eq!(
+            parser.parse(data).unwrap_err(),
+            Error::FieldValue {
+                content: "inf".to_string()
+            }
+        );
+
+        let parser = Parser::new(-1).with_non_finite_float(NonFiniteFloat::Null);
+        let lines = parser.parse(data).unwrap();
+        assert_eq!(
+            lines[0].fields,
+            vec![(Cow::Borrowed("fb"), FieldValue::F64(1.0))]
+        );
+        assert_eq!(
+            lines[1].fields,
+            vec![(Cow::Borrowed("fb"), FieldValue::F64(2.0))]
+        );
+        assert_eq!(
+            parser.parse("m fa=NaN 3").unwrap_err(),
+            Error::EmptyFields { pos: 0 }
+        );
+
+        let parser = Parser::new(-1).with_non_finite_float(NonFiniteFloat::Sentinel(0.0));
+        let lines = parser.parse(data).unwrap();
+        assert_eq!(lines[0].fields[0].1, FieldValue::F64(0.0));
+        assert_eq!(lines[1].fields[0].1, FieldValue::F64(0.0));
+
+        assert_eq!("null".parse(), Ok(NonFiniteFloat::Null));
+        assert_eq!("-1".parse(), Ok(NonFiniteFloat::Sentinel(-1.0)));
+        assert!("inf".parse::<NonFiniteFloat>().is_err());
+    }
+
+    #[test]
+    fn test_unicode_escape() {
+        let data = r#"m f="\u4e2d\ud83d\ude00\\u0041\"" 1"#;
+        assert!(Parser::new(-1).parse(data).is_err());
+
+        let parser = Parser::new(-1).with_unicode_escape(true);
+        let lines = parser.parse(data).unwrap();
+        assert_eq!(
+            lines[0].fields[0].1,
+            FieldValue::Str("中😀\\u0041\"".as_bytes().to_vec())
+        );
+
+        assert!(parser.parse(r#"m f="\ud83d" 1"#).is_err());
+        assert!(parser.parse(r#"m f="\u4e2" 1"#).is_err());
+    }
+
     #[test]
     fn test_simple_parse() {
         let parser = crate::line_protocol::parser::Parser::new(10000);
@@ -661,4 +954,26 @@ comma\,1,equals\==e\,x,two=val2 field\=x="fir\"
             println!("--- {:?}", line);
         }
     }
+
+    #[test]
+    fn test_line_capacity() {
+        let parser = Parser::new(-1);
+        let data = "m,tb=2,ta=1 fb=2,fa=1 1\nm,ta=3,tb=4 fa=3,fb=4 2\nm,ta=5 fa=5 3";
+        let lines = parser.parse(data).unwrap();
+        assert_eq!(lines.len(), 3);
+        assert_eq!(lines.capacity(), 3);
+        // sized by the previous line
+        assert_eq!(lines[1].tags.capacity(), 2);
+        assert_eq!(lines[1].fields.capacity(), 2);
+        assert_eq!(lines[2].tags.capacity(), 2);
+
+        // sorted the same whether the keys are in order or not
+        assert_eq!(lines[0].tags[0], (Cow::Borrowed("ta"), Cow::Borrowed("1")));
+        assert_eq!(lines[0].fields[0].0, "fa");
+        assert_eq!(lines[1].tags[0], (Cow::Borrowed("ta"), Cow::Borrowed("3")));
+        assert_eq!(
+            lines[0].hash_id,
+            parser.parse("m,ta=1,tb=2 fa=1 1").unwrap()[0].hash_id
+        );
+    }
 }
@@ -0,0 +1,139 @@
+//! Decodes the flatbuffers points written to the vnodes as line protocol,
+//! e.g. to read the changes logged.
+
+use std::borrow::Cow;
+
+use protos::models::{Column, ColumnType, FieldType, Points};
+use protos::FieldValue;
+
+use super::lines_to_line_protocol;
+use crate::{Error, Line, Result};
+
+/// Appends the rows of the points to `buf` as line protocol, the null tags
+/// and fields are omitted, and the rows without any field are skipped. The
+/// timestamps are in the precision the points are written in.
+pub fn points_to_line_protocol(points: &[u8], buf: &mut Vec<u8>) -> Result<()> {
+    let points = flatbuffers::root::<Points>(points).map_err(|e| Error::Common {
+        content: format!("invalid flatbuffers points: {}", e),
+    })?;
+    let tables = points.tables().ok_or_else(|| missing("tables"))?;
+    for table in tables {
+        let table_name = table.tab().ok_or_else(|| missing("table name"))?;
+        let columns = table
+            .columns()
+            .ok_or_else(|| missing("columns"))?
+            .iter()
+            .collect::<Vec<_>>();
+
+        let mut lines = Vec::with_capacity(table.num_rows() as usize);
+        for row in 0..table.num_rows() as usize {
+            let mut line = Line::with_capacity(0, 0);
+            line.table = Cow::Borrowed(table_name);
+            for column in &columns {
+                if !is_valid(column, row) {
+                    continue;
+                }
+                let name = column.name().ok_or_else(|| missing("column name"))?;
+                let values = column.col_values().ok_or_else(|| missing("values"))?;
+                match column.column_type() {
+                    ColumnType::Time => {
+                        line.timestamp = values
+                            .int_value()
+                            .filter(|v| row < v.len())
+                            .ok_or_else(|| missing("timestamps"))?
+                            .get(row);
+                    }
+                    ColumnType::Tag => {
+                        let value = values
+                            .string_value()
+                            .filter(|v| row < v.len())
+                            .ok_or_else(|| missing("tag values"))?
+                            .get(row);
+                        line.tags.push((Cow::Borrowed(name), Cow::Borrowed(value)));
+                    }
+                    ColumnType::Field => {
+                        if let Some(value) = field_value(column, row) {
+                            line.fields.push((Cow::Borrowed(name), value));
+                        }
+                    }
+                    _ => {}
+                }
+            }
+            if !line.fields.is_empty() {
+                lines.push(line);
+            }
+        }
+        lines_to_line_protocol(&lines, buf);
+    }
+
+    Ok(())
+}
+
+fn missing(what: &str) -> Error {
+    Error::Common {
+        content: format!("flatbuffers points missing {}", what),
+    }
+}
+
+/// The bits of the valid rows are set, in the order of arrow.
+fn is_valid(column: &Column, row: usize) -> bool {
+    column
+        .nullbits()
+        .filter(|bits| row / 8 < bits.len())
+        .map_or(false, |bits| bits.get(row / 8) & (1 << (row % 8)) != 0)
+}
+
+fn field_value(column: &Column, row: usize) -> Option<FieldValue> {
+    let values = column.col_values()?;
+    let value = match column.field_type() {
+        FieldType::Float => {
+            FieldValue::F64(values.float_value().filter(|v| row < v.len())?.get(row))
+        }
+        FieldType::Integer => {
+            FieldValue::I64(values.int_value().filter(|v| row < v.len())?.get(row))
+        }
+        FieldType::Unsigned => {
+            FieldValue::U64(values.uint_value().filter(|v| row < v.len())?.get(row))
+        }
+        FieldType::Boolean => {
+            FieldValue::Bool(values.bool_value().filter(|v| row < v.len())?.get(row))
+        }
+        FieldType::String => {
+            let value = values.string_value().filter(|v| row < v.len())?.get(row);
+            FieldValue::Str(value.as_bytes().to_vec())
+        }
+        _ => return None,
+    };
+    Some(value)
+}
+
+#[cfg(test)]
+mod test {
+    use super::points_to_line_protocol;
+    use crate::line_protocol::line_protocol_to_lines;
+    use crate::lines_convert::{line_to_batches, mutable_batches_to_point};
+
+    #[test]
+    fn test_points_to_line_protocol() {
+        let data = "m,t1=a f1=1.5,f2=2i 1\nm,t2=b f3=\"x y\" 2\n";
+        let lines = line_protocol_to_lines(data, 0).unwrap();
+        let batches = line_to_batches(&lines).unwrap();
+        let points = mutable_batches_to_point("db", batches);
+
+        let mut buf = vec![];
+        points_to_line_protocol(&points, &mut buf).unwrap();
+        let mut decoded = String::from_utf8(buf)
+            .unwrap()
+            .lines()
+            .map(|l| l.to_string())
+            .collect::<Vec<_>>();
+        decoded.sort();
+        assert_eq!(
+            decoded,
+            vec![
+                "m,t1=a f1=1.5,f2=2i 1".to_string(),
+                "m,t2=b f3=\"x y\" 2".to_string()
+            ]
+        );
+    }
+}
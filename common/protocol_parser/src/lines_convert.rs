@@ -10,6 +10,7 @@ use models::column_data_ref::PrimaryColumnDataRef;
 use models::mutable_batch::MutableBatch;
 use models::schema::tskv_table_schema::{PhysicalCType, TskvTableSchemaRef};
 use models::PhysicalDType as ValueType;
+use parking_lot::{const_mutex, Mutex};
 use protos::models::{
     Column as FbColumn, ColumnBuilder, ColumnType as FbColumnType, FieldType, PointsBuilder,
     TableBuilder, ValuesBuilder,
@@ -17,6 +18,36 @@ use protos::models::{
 
 use crate::{Error, FieldValue, Line, Result};
 
+/// The builders of the points reused by the writes, so that the buffer of
+/// the points of each request is not grown from empty again.
+static POINTS_BUILDERS: Mutex<Vec<FlatBufferBuilder<'static>>> = const_mutex(Vec::new());
+/// The number of the builders kept for reuse at most.
+const MAX_POOLED_BUILDERS: usize = 16;
+/// The builders of bigger points are dropped, not to keep the memory of a
+/// huge request.
+const MAX_POOLED_BUILDER_SIZE: usize = 16 * 1024 * 1024;
+
+fn pooled_builder() -> FlatBufferBuilder<'static> {
+    POINTS_BUILDERS
+        .lock()
+        .pop()
+        .unwrap_or_else(FlatBufferBuilder::new)
+}
+
+/// Copies out the points finished by the builder, and puts the builder back
+/// for reuse.
+fn finish_pooled_builder(mut fbb: FlatBufferBuilder<'static>) -> Vec<u8> {
+    let data = fbb.finished_data().to_vec();
+    if data.len() <= MAX_POOLED_BUILDER_SIZE {
+        fbb.reset();
+        let mut builders = POINTS_BUILDERS.lock();
+        if builders.len() < MAX_POOLED_BUILDERS {
+            builders.push(fbb);
+        }
+    }
+    data
+}
+
 pub fn line_to_batches<'a>(lines: &'a [Line<'a>]) -> Result<HashMap<String, MutableBatch<'a>>> {
     let mut batches = HashMap::new();
     for line in lines.iter() {
@@ -195,7 +226,8 @@ pub fn line_to_batches<'a>(lines: &'a [Line<'a>]) -> Result<HashMap<String, Muta
 }
 
 pub fn mutable_batches_to_point(db: &str, batches: HashMap<String, MutableBatch>) -> Vec<u8> {
-    let fbb = &mut FlatBufferBuilder::new();
+    let mut builder = pooled_builder();
+    let fbb = &mut builder;
     let mut tables = Vec::with_capacity(batches.len());
     for (table_name, table_batch) in batches {
         let mut columns = Vec::with_capacity(table_batch.columns.len());
@@ -275,8 +307,7 @@ pub fn mutable_batches_to_point(db: &str, batches: HashMap<String, MutableBatch>
     point_builder.add_db(db);
     let points = point_builder.finish();
     fbb.finish(points, None);
-    let data = fbb.finished_data().to_vec();
-    data
+    finish_pooled_builder(builder)
 }
 
 pub fn arrow_array_to_points(
@@ -285,7 +316,7 @@ pub fn arrow_array_to_points(
     table_schema: TskvTableSchemaRef,
     len: usize,
 ) -> Result<Vec<u8>> {
-    let mut fbb = FlatBufferBuilder::new();
+    let mut fbb = pooled_builder();
     let table_name = table_schema.name.as_str();
     let mut fb_columns = Vec::new();
     for (column, schema) in columns.iter().zip(schema.fields.iter()) {
@@ -331,8 +362,7 @@ pub fn arrow_array_to_points(
     point_builder.add_db(db);
     let points = point_builder.finish();
     fbb.finish(points, None);
-    let data = fbb.finished_data().to_vec();
-    Ok(data)
+    Ok(finish_pooled_builder(fbb))
 }
 
 pub fn build_string_column<'a>(
@@ -610,3 +640,24 @@ pub fn build_bool_column<'a>(
     column_builder.add_col_values(values);
     Ok(column_builder.finish())
 }
+
+#[cfg(test)]
+mod test {
+    use super::{line_to_batches, mutable_batches_to_point, MAX_POOLED_BUILDERS, POINTS_BUILDERS};
+    use crate::line_protocol::line_protocol_to_lines;
+
+    #[test]
+    fn test_pooled_builder() {
+        let points = |data: &str| {
+            let lines = line_protocol_to_lines(data, 0).unwrap();
+            let batches = line_to_batches(&lines).unwrap();
+            mutable_batches_to_point("db", batches)
+        };
+
+        let first = points("m,ta=a1 f=1i 1\nm,ta=a2 f=2i 2");
+        assert!(POINTS_BUILDERS.lock().len() <= MAX_POOLED_BUILDERS);
+        // the builder reused is reset, the points are the same
+        assert_eq!(points("m,ta=a1 f=1i 1\nm,ta=a2 f=2i 2"), first);
+        assert_ne!(points("m,ta=a3 f=3i 3"), first);
+    }
+}
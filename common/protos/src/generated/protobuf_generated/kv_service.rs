@@ -47,6 +47,9 @@ pub struct WriteDataRequest {
     pub data: ::prost::alloc::vec::Vec<u8>,
     #[prost(uint32, tag = "2")]
     pub precision: u32,
+    /// The points moved inside the cluster, e.g. by splitting a bucket.
+    #[prost(bool, tag = "3")]
+    pub copied: bool,
 }
 #[allow(clippy::derive_partial_eq_without_eq)]
 #[derive(Clone, PartialEq, ::prost::Message)]
@@ -261,6 +264,13 @@ pub mod admin_command {
 pub struct DownloadFileRequest {
     #[prost(string, tag = "1")]
     pub filename: ::prost::alloc::string::String,
+    /// Download from the offset, to resume an interrupted download.
+    #[prost(uint64, tag = "2")]
+    pub offset: u64,
+    /// Respond the crc32 and the length of the first `offset` bytes of the file
+    /// instead of the bytes, of the whole file if `offset` is 0.
+    #[prost(bool, tag = "3")]
+    pub checksum: bool,
 }
 #[allow(clippy::derive_partial_eq_without_eq)]
 #[derive(Clone, PartialEq, ::prost::Message)]
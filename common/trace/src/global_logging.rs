@@ -1,7 +1,7 @@
 use std::net::SocketAddr;
 use std::path::Path;
 use std::str::FromStr;
-use std::sync::{Once, OnceLock};
+use std::sync::{Mutex, Once, OnceLock};
 
 use config::common::LogConfig;
 use time::UtcOffset;
@@ -14,43 +14,69 @@ use tracing_error::ErrorLayer;
 use tracing_subscriber::fmt::time::OffsetTime;
 use tracing_subscriber::layer::SubscriberExt;
 use tracing_subscriber::util::SubscriberInitExt;
-use tracing_subscriber::{filter, fmt, Registry};
+use tracing_subscriber::{filter, fmt, reload, Registry};
 
 static GLOBAL_LOG_GUARD: OnceLock<Vec<WorkerGuard>> = OnceLock::new();
 static START_LOGGING: Once = Once::new();
+static LOG_FILTER: OnceLock<LogFilter> = OnceLock::new();
 
-pub fn targets_filter(level: LevelFilter, defined_tokio_trace: bool) -> filter::Targets {
+/// The level of the logs and the levels of the modules overriding it.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct LogLevels {
+    pub level: String,
+    /// `<module>=<level>`
+    pub modules: Vec<String>,
+}
+
+struct LogFilter {
+    handle: reload::Handle<filter::Targets, Registry>,
+    tokio_trace: bool,
+    levels: Mutex<LogLevels>,
+}
+
+pub fn targets_filter(
+    level: LevelFilter,
+    modules: &[(String, LevelFilter)],
+    defined_tokio_trace: bool,
+) -> filter::Targets {
+    let crates = [
+        // Workspace crates,
+        // make sure all workspace members are here.
+        "client",
+        "config",
+        "coordinator",
+        "e2e_test",
+        "error_code",
+        "macros",
+        "http_protocol",
+        "limiter_bucket",
+        "lru_cache",
+        "cnosdb",
+        "memory_pool",
+        "meta",
+        "metrics",
+        "models",
+        "protos",
+        "protocol_parser",
+        "query",
+        "spi",
+        "sqllogicaltests",
+        "test",
+        "trace",
+        "tskv",
+        "utils",
+        "replication",
+        "datafusion",
+        "arrow",
+    ];
     let mut filter = filter::Targets::new()
-        .with_targets(vec![
-            // Workspace crates,
-            // make sure all workspace members are here.
-            ("client", level),
-            ("config", level),
-            ("coordinator", level),
-            ("e2e_test", level),
-            ("error_code", level),
-            ("macros", level),
-            ("http_protocol", level),
-            ("limiter_bucket", level),
-            ("lru_cache", level),
-            ("cnosdb", level),
-            ("memory_pool", level),
-            ("meta", level),
-            ("metrics", level),
-            ("models", level),
-            ("protos", level),
-            ("protocol_parser", level),
-            ("query", level),
-            ("spi", level),
-            ("sqllogicaltests", level),
-            ("test", level),
-            ("trace", level),
-            ("tskv", level),
-            ("utils", level),
-            ("replication", level),
-            ("datafusion", level),
-            ("arrow", level),
-        ])
+        .with_targets(
+            crates
+                .into_iter()
+                .filter(|c| !modules.iter().any(|(m, _)| m == c))
+                .map(|c| (c.to_string(), level)),
+        )
+        .with_targets(modules.to_vec())
         .with_targets(vec![
             // Third-party crates
             ("actix_web::middleware::logger", LevelFilter::WARN),
@@ -64,18 +90,72 @@ pub fn targets_filter(level: LevelFilter, defined_tokio_trace: bool) -> filter::
     filter
 }
 
+fn parse_levels(levels: &LogLevels) -> Result<(LevelFilter, Vec<(String, LevelFilter)>), String> {
+    let level = LevelFilter::from_str(&levels.level)
+        .map_err(|_| format!("invalid log level '{}'", levels.level))?;
+    let mut modules = Vec::with_capacity(levels.modules.len());
+    for directive in levels.modules.iter() {
+        let (module, module_level) = LogConfig::parse_module_level(directive)
+            .ok_or_else(|| format!("invalid module level '{}'", directive))?;
+        let module_level = LevelFilter::from_str(module_level)
+            .map_err(|_| format!("invalid module level '{}'", directive))?;
+        modules.push((module.to_string(), module_level));
+    }
+    Ok((level, modules))
+}
+
+/// Changes the levels of the logs at runtime.
+pub fn set_log_levels(levels: LogLevels) -> Result<(), String> {
+    let log_filter = LOG_FILTER
+        .get()
+        .ok_or_else(|| "logging is not initialized".to_string())?;
+    let (level, modules) = parse_levels(&levels)?;
+    log_filter
+        .handle
+        .reload(targets_filter(level, &modules, log_filter.tokio_trace))
+        .map_err(|e| e.to_string())?;
+    *log_filter.levels.lock().unwrap() = levels;
+    Ok(())
+}
+
+pub fn log_levels() -> Option<LogLevels> {
+    LOG_FILTER
+        .get()
+        .map(|log_filter| log_filter.levels.lock().unwrap().clone())
+}
+
 pub fn init_global_logging(log_config: &LogConfig, file_name_prefix: &str) {
     START_LOGGING.call_once(|| {
-        let tracing_level = LevelFilter::from_str(&log_config.level).unwrap_or(LevelFilter::WARN);
+        let mut levels = LogLevels {
+            level: log_config.level.clone(),
+            modules: log_config.modules.clone(),
+        };
+        let (tracing_level, modules) = match parse_levels(&levels) {
+            Ok(parsed) => parsed,
+            Err(e) => {
+                eprintln!("{}, default to [warn] without the module levels", e);
+                levels = LogLevels {
+                    level: "warn".to_string(),
+                    modules: vec![],
+                };
+                (LevelFilter::WARN, vec![])
+            }
+        };
 
         let local_time = OffsetTime::new(
             UtcOffset::current_local_offset().unwrap_or(UtcOffset::UTC),
             time::format_description::well_known::Iso8601::DEFAULT,
         );
-        let formatting_layer = fmt::layer()
+        let stderr_json = log_config.stderr_format == LogConfig::FORMAT_JSON;
+        let stderr_layer = fmt::layer()
             .with_ansi(false)
             .with_timer(local_time.clone())
             .with_writer(std::io::stderr);
+        let (stderr_json_layer, stderr_layer) = if stderr_json {
+            (Some(stderr_layer.json()), None)
+        } else {
+            (None, Some(stderr_layer))
+        };
 
         let rotation = match log_config.file_rotation.as_str() {
             "daily" => Rotation::DAILY,
@@ -101,22 +181,37 @@ pub fn init_global_logging(log_config: &LogConfig, file_name_prefix: &str) {
 
         let file_appender = file_appender_builder.build(&log_config.path).unwrap();
         let (non_blocking_appender, guard) = non_blocking(file_appender);
+        let file_json = log_config.file_format == LogConfig::FORMAT_JSON;
         let file_layer = fmt::layer()
             .with_ansi(false)
             .with_timer(local_time)
             .with_writer(non_blocking_appender);
+        let (file_json_layer, file_layer) = if file_json {
+            (Some(file_layer.json()), None)
+        } else {
+            (None, Some(file_layer))
+        };
 
         let guards = vec![guard];
         GLOBAL_LOG_GUARD.get_or_init(|| guards);
 
+        // the filter is reloaded to change the levels at runtime
+        let tokio_trace = log_config.tokio_trace.is_some();
+        let (filter_layer, handle) =
+            reload::Layer::new(targets_filter(tracing_level, &modules, tokio_trace));
+        let _ = LOG_FILTER.set(LogFilter {
+            handle,
+            tokio_trace,
+            levels: Mutex::new(levels),
+        });
+
         let registry_builder = Registry::default()
+            .with(filter_layer)
             .with(ErrorLayer::default())
-            .with(formatting_layer)
+            .with(stderr_layer)
+            .with(stderr_json_layer)
             .with(file_layer)
-            .with(targets_filter(
-                tracing_level,
-                log_config.tokio_trace.is_some(),
-            ));
+            .with(file_json_layer);
 
         if let Some(tokio_trace) = &log_config.tokio_trace {
             let console_layer = console_subscriber::ConsoleLayer::builder()
@@ -127,6 +222,9 @@ pub fn init_global_logging(log_config: &LogConfig, file_name_prefix: &str) {
             registry_builder.init()
         }
 
+        crate::sampled::set_sample_interval(log_config.sample_interval);
+        crate::sampled::start_flusher();
+
         debug!("log trace init successful");
     });
 }
@@ -139,14 +237,16 @@ pub fn init_default_global_tracing(dir: impl AsRef<Path>, file_name: &str, level
         path: dir.as_ref().to_string_lossy().to_string(),
         max_file_count: None,
         file_rotation: "daily".to_owned(),
-        tokio_trace: None,
+        ..Default::default()
     };
     init_global_logging(&log_config, file_name);
 }
 
 #[cfg(test)]
 mod tests {
-    use crate::global_logging::init_default_global_tracing;
+    use crate::global_logging::{
+        init_default_global_tracing, log_levels, set_log_levels, LogLevels,
+    };
     use crate::{error, info, instrument};
     #[instrument]
     fn return_err() {
@@ -161,5 +261,17 @@ mod tests {
         init_default_global_tracing("trace", "trace.log", "debug");
         info!("hello");
         return_err();
+
+        set_log_levels(LogLevels {
+            level: "info".to_string(),
+            modules: vec!["trace::global_logging=debug".to_string()],
+        })
+        .unwrap();
+        assert_eq!(log_levels().unwrap().level, "info");
+        assert!(set_log_levels(LogLevels {
+            level: "info".to_string(),
+            modules: vec!["trace=verbose".to_string()],
+        })
+        .is_err());
     }
 }
@@ -1,6 +1,7 @@
 pub mod global_logging;
 pub mod global_tracing;
 pub mod http;
+pub mod sampled;
 pub mod span_ctx_ext;
 pub mod span_ext;
 
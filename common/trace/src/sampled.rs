@@ -0,0 +1,160 @@
+//! Sampled logging of the frequent events of the write path, e.g. the failed
+//! writes of a misbehaving client, so that they can't flood the logs.
+//!
+//! An event of a [`LogSampler`] is logged at most once per sample interval,
+//! the suppressed events are counted and the counts are flushed to the logs
+//! once per sample interval.
+
+use std::sync::atomic::{AtomicBool, AtomicU64, Ordering};
+use std::sync::{Mutex, OnceLock};
+use std::time::{Duration, Instant};
+
+use tracing::warn;
+
+static SAMPLERS: Mutex<Vec<&'static LogSampler>> = Mutex::new(Vec::new());
+static SAMPLE_INTERVAL_MILLIS: AtomicU64 = AtomicU64::new(10_000);
+static START: OnceLock<Instant> = OnceLock::new();
+static START_FLUSHER: OnceLock<()> = OnceLock::new();
+
+/// Logs the event at most once per sample interval of the call site, the
+/// number of the events suppressed before it is logged as `suppressed`, e.g.
+/// `sampled!(error, "failed writes", "Failed to write, err: {:?}", e)`.
+#[macro_export]
+macro_rules! sampled {
+    ($level:ident, $name:expr, $($arg:tt)+) => {{
+        static SAMPLER: $crate::sampled::LogSampler = $crate::sampled::LogSampler::new($name);
+        if let Some(suppressed) = SAMPLER.sample() {
+            $crate::$level!(suppressed, $($arg)+);
+        }
+    }};
+}
+
+/// Sets the sample interval, zero to log all the events.
+pub fn set_sample_interval(interval: Duration) {
+    SAMPLE_INTERVAL_MILLIS.store(interval.as_millis() as u64, Ordering::Relaxed);
+}
+
+pub fn sample_interval() -> Duration {
+    Duration::from_millis(SAMPLE_INTERVAL_MILLIS.load(Ordering::Relaxed))
+}
+
+/// Starts the thread flushing the counts of the suppressed events once per
+/// sample interval, only the first call starts it.
+pub fn start_flusher() {
+    START_FLUSHER.get_or_init(|| {
+        let res = std::thread::Builder::new()
+            .name("log-sampler".to_string())
+            .spawn(|| loop {
+                let interval = sample_interval();
+                std::thread::sleep(if interval.is_zero() {
+                    Duration::from_secs(1)
+                } else {
+                    interval
+                });
+                flush_suppressed();
+            });
+        if let Err(e) = res {
+            eprintln!("failed to start the log sampler: {}", e);
+        }
+    });
+}
+
+/// Logs the numbers of the events suppressed since the last flush.
+pub fn flush_suppressed() {
+    for (name, suppressed) in take_suppressed() {
+        warn!(
+            "{} events of '{}' suppressed in the last {:?}",
+            suppressed,
+            name,
+            sample_interval()
+        );
+    }
+}
+
+fn take_suppressed() -> Vec<(&'static str, u64)> {
+    SAMPLERS
+        .lock()
+        .unwrap()
+        .iter()
+        .filter_map(|s| match s.suppressed.swap(0, Ordering::Relaxed) {
+            0 => None,
+            n => Some((s.name, n)),
+        })
+        .collect()
+}
+
+fn now_millis() -> u64 {
+    START.get_or_init(Instant::now).elapsed().as_millis() as u64
+}
+
+pub struct LogSampler {
+    name: &'static str,
+    registered: AtomicBool,
+    /// Milliseconds since [`START`] plus one of the last logged event, 0 if
+    /// no event is logged.
+    last_logged: AtomicU64,
+    suppressed: AtomicU64,
+}
+
+impl LogSampler {
+    pub const fn new(name: &'static str) -> Self {
+        Self {
+            name,
+            registered: AtomicBool::new(false),
+            last_logged: AtomicU64::new(0),
+            suppressed: AtomicU64::new(0),
+        }
+    }
+
+    pub fn name(&self) -> &'static str {
+        self.name
+    }
+
+    /// Returns the number of the events suppressed since the last logged
+    /// one or the last flush if the event is to be logged.
+    pub fn sample(&'static self) -> Option<u64> {
+        let interval = SAMPLE_INTERVAL_MILLIS.load(Ordering::Relaxed);
+        if interval == 0 {
+            return Some(self.suppressed.swap(0, Ordering::Relaxed));
+        }
+        if !self.registered.swap(true, Ordering::Relaxed) {
+            SAMPLERS.lock().unwrap().push(self);
+        }
+
+        let now = now_millis() + 1;
+        let last = self.last_logged.load(Ordering::Relaxed);
+        if (last == 0 || now >= last + interval)
+            && self
+                .last_logged
+                .compare_exchange(last, now, Ordering::Relaxed, Ordering::Relaxed)
+                .is_ok()
+        {
+            return Some(self.suppressed.swap(0, Ordering::Relaxed));
+        }
+        self.suppressed.fetch_add(1, Ordering::Relaxed);
+        None
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use super::{set_sample_interval, take_suppressed, LogSampler};
+
+    #[test]
+    fn test_sample() {
+        static SAMPLER: LogSampler = LogSampler::new("test_sample");
+        set_sample_interval(Duration::from_secs(3600));
+
+        assert_eq!(SAMPLER.sample(), Some(0));
+        for _ in 0..5 {
+            assert_eq!(SAMPLER.sample(), None);
+        }
+        let suppressed = take_suppressed()
+            .into_iter()
+            .find(|(name, _)| *name == SAMPLER.name());
+        assert_eq!(suppressed, Some(("test_sample", 5)));
+        assert_eq!(SAMPLER.sample(), None);
+    }
+}
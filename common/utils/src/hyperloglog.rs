@@ -0,0 +1,115 @@
+use std::hash::Hasher;
+
+use serde::{Deserialize, Serialize};
+use twox_hash::XxHash64;
+
+/// Number of bits of the hash choosing the register.
+const PRECISION: u32 = 12;
+const REGISTERS: usize = 1 << PRECISION;
+
+/// A HyperLogLog sketch estimating the number of distinct values inserted,
+/// the standard error is about 1.6% with 4096 registers, the small
+/// cardinalities are counted by linear counting, so they are almost exact.
+///
+/// The values are hashed by `XxHash64` with the default seed, so the
+/// sketches built on different nodes can be merged into the sketch of the
+/// union of the values.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct HyperLogLog {
+    registers: Vec<u8>,
+}
+
+impl Default for HyperLogLog {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl HyperLogLog {
+    pub fn new() -> Self {
+        Self {
+            registers: vec![0; REGISTERS],
+        }
+    }
+
+    pub fn insert(&mut self, data: &[u8]) {
+        let mut hasher = XxHash64::default();
+        hasher.write(data);
+        let hash = hasher.finish();
+
+        let index = (hash >> (64 - PRECISION)) as usize;
+        // position of the first 1 bit in the rest bits
+        let rank = ((hash << PRECISION).leading_zeros() + 1).min(64 - PRECISION + 1) as u8;
+        if self.registers[index] < rank {
+            self.registers[index] = rank;
+        }
+    }
+
+    /// Merges the values inserted to `other`.
+    pub fn merge(&mut self, other: &HyperLogLog) {
+        for (register, other) in self.registers.iter_mut().zip(&other.registers) {
+            *register = (*register).max(*other);
+        }
+    }
+
+    pub fn estimate(&self) -> u64 {
+        let m = REGISTERS as f64;
+        let alpha = 0.7213 / (1.0 + 1.079 / m);
+        let mut sum = 0.0;
+        let mut zeros = 0;
+        for register in &self.registers {
+            sum += 1.0 / (1u64 << register) as f64;
+            if *register == 0 {
+                zeros += 1;
+            }
+        }
+
+        let estimate = alpha * m * m / sum;
+        if estimate <= 2.5 * m && zeros > 0 {
+            (m * (m / zeros as f64).ln()).round() as u64
+        } else {
+            estimate.round() as u64
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::HyperLogLog;
+
+    #[test]
+    fn test_estimate() {
+        let mut hll = HyperLogLog::new();
+        assert_eq!(hll.estimate(), 0);
+
+        for i in 0..3 {
+            hll.insert(format!("key{i}").as_bytes());
+            hll.insert(format!("key{i}").as_bytes());
+        }
+        assert_eq!(hll.estimate(), 3);
+
+        for i in 0..100_000 {
+            hll.insert(format!("key{i}").as_bytes());
+        }
+        let error = (hll.estimate() as f64 - 100_000.0).abs() / 100_000.0;
+        assert!(error < 0.05, "estimate: {}", hll.estimate());
+    }
+
+    #[test]
+    fn test_merge() {
+        let mut a = HyperLogLog::new();
+        let mut b = HyperLogLog::new();
+        let mut union = HyperLogLog::new();
+        for i in 0..1000 {
+            a.insert(format!("key{i}").as_bytes());
+            union.insert(format!("key{i}").as_bytes());
+        }
+        for i in 500..1500 {
+            b.insert(format!("key{i}").as_bytes());
+            union.insert(format!("key{i}").as_bytes());
+        }
+
+        a.merge(&b);
+        assert_eq!(a, union);
+    }
+}
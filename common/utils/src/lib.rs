@@ -1,11 +1,13 @@
 pub use bkdr_hash::BkdrHasher;
 pub use bloom_filter::BloomFilter;
 pub use dedup::{dedup_front_by, dedup_front_by_key};
+pub use hyperloglog::HyperLogLog;
 
 pub mod backtrace;
 mod bkdr_hash;
 mod bloom_filter;
 mod dedup;
+mod hyperloglog;
 
 pub mod byte_utils;
 
@@ -40,6 +40,10 @@ impl CheckConfigResult {
         self.error.append(&mut other.error);
     }
 
+    pub fn has_errors(&self) -> bool {
+        !self.error.is_empty()
+    }
+
     pub fn is_empty(&self) -> bool {
         self.warn.is_empty() && self.error.is_empty()
     }
@@ -1,9 +1,11 @@
 use std::sync::Arc;
+use std::time::Duration;
 
 use macros::EnvKeys;
 use serde::{Deserialize, Serialize};
 
 use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::duration;
 
 #[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
 pub struct TokioTrace {
@@ -22,9 +24,27 @@ pub struct LogConfig {
     pub file_rotation: String,
     #[serde(default = "LogConfig::default_tokio_trace")]
     pub tokio_trace: Option<TokioTrace>,
+    /// Format of the log files, `console` or `json`.
+    #[serde(default = "LogConfig::default_format")]
+    pub file_format: String,
+    /// Format of the logs printed to stderr, `console` or `json`.
+    #[serde(default = "LogConfig::default_format")]
+    pub stderr_format: String,
+    /// Levels of the modules overriding `level`, e.g. `tskv::compaction=debug`.
+    #[serde(default = "Default::default")]
+    pub modules: Vec<String>,
+    /// The frequent events of the write path, e.g. the failed writes, are
+    /// logged at most once per interval with the number of the suppressed
+    /// ones, "0s" to log all of them.
+    #[serde(with = "duration", default = "LogConfig::default_sample_interval")]
+    pub sample_interval: Duration,
 }
 
 impl LogConfig {
+    pub const FORMAT_CONSOLE: &'static str = "console";
+    pub const FORMAT_JSON: &'static str = "json";
+    pub const LEVELS: [&'static str; 6] = ["trace", "debug", "info", "warn", "error", "off"];
+
     fn default_level() -> String {
         "info".to_string()
     }
@@ -45,6 +65,24 @@ impl LogConfig {
     fn default_tokio_trace() -> Option<TokioTrace> {
         None
     }
+
+    fn default_format() -> String {
+        Self::FORMAT_CONSOLE.to_string()
+    }
+
+    fn default_sample_interval() -> Duration {
+        Duration::from_secs(10)
+    }
+
+    /// Parses a level of a module, `<module>=<level>`.
+    pub fn parse_module_level(directive: &str) -> Option<(&str, &str)> {
+        let (module, level) = directive.split_once('=')?;
+        let (module, level) = (module.trim(), level.trim());
+        if module.is_empty() || !Self::LEVELS.contains(&level.to_ascii_lowercase().as_str()) {
+            return None;
+        }
+        Some((module, level))
+    }
 }
 
 impl Default for LogConfig {
@@ -55,6 +93,10 @@ impl Default for LogConfig {
             max_file_count: Self::default_max_file_count(),
             file_rotation: Self::default_file_rotation(),
             tokio_trace: None,
+            file_format: Self::default_format(),
+            stderr_format: Self::default_format(),
+            modules: vec![],
+            sample_interval: Self::default_sample_interval(),
         }
     }
 }
@@ -66,12 +108,37 @@ impl CheckConfig for LogConfig {
 
         if self.path.is_empty() {
             ret.add_warn(CheckConfigItemResult {
-                config: config_name,
+                config: config_name.clone(),
                 item: "path".to_string(),
                 message: "'path' is empty".to_string(),
             });
         }
 
+        for (item, format) in [
+            ("file_format", &self.file_format),
+            ("stderr_format", &self.stderr_format),
+        ] {
+            if format != Self::FORMAT_CONSOLE && format != Self::FORMAT_JSON {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: item.to_string(),
+                    message: format!("'{}' must be 'console' or 'json'", item),
+                });
+            }
+        }
+        for module in &self.modules {
+            if Self::parse_module_level(module).is_none() {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "modules".to_string(),
+                    message: format!(
+                        "invalid module level '{}', expected <module>=<level>",
+                        module
+                    ),
+                });
+            }
+        }
+
         if ret.is_empty() {
             None
         } else {
@@ -8,13 +8,18 @@ pub mod common;
 pub mod meta;
 pub mod tskv;
 
-pub static VERSION: Lazy<String> = Lazy::new(|| {
-    format!(
-        "{}, revision {}",
-        option_env!("CARGO_PKG_VERSION").unwrap_or("UNKNOWN"),
-        option_env!("GIT_HASH").unwrap_or("UNKNOWN")
-    )
-});
+pub const PKG_VERSION: &str = match option_env!("CARGO_PKG_VERSION") {
+    Some(version) => version,
+    None => "UNKNOWN",
+};
+
+/// The git revision of the build.
+pub const GIT_HASH: &str = match option_env!("GIT_HASH") {
+    Some(hash) => hash,
+    None => "UNKNOWN",
+};
+
+pub static VERSION: Lazy<String> = Lazy::new(|| format!("{}, revision {}", PKG_VERSION, GIT_HASH));
 
 trait EnvKeys {
     fn env_keys() -> Vec<String>;
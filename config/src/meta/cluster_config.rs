@@ -8,6 +8,22 @@ pub struct MetaClusterConfig {
     pub raft_logs_to_keep: u64,
     pub install_snapshot_timeout: u64,
     pub send_append_entries_timeout: u64,
+    /// Build a snapshot after so many logs are applied since the last one.
+    #[serde(default = "MetaClusterConfig::default_snapshot_logs_since_last")]
+    pub snapshot_logs_since_last: u64,
+    /// Seconds, also build a snapshot periodically if any log applied, 0 to disable.
+    #[serde(default = "MetaClusterConfig::default_snapshot_interval")]
+    pub snapshot_interval: u64,
+}
+
+impl MetaClusterConfig {
+    fn default_snapshot_logs_since_last() -> u64 {
+        10000
+    }
+
+    fn default_snapshot_interval() -> u64 {
+        3600
+    }
 }
 
 impl Default for MetaClusterConfig {
@@ -18,6 +34,8 @@ impl Default for MetaClusterConfig {
             raft_logs_to_keep: 10000,
             install_snapshot_timeout: 3600 * 1000,
             send_append_entries_timeout: 5 * 1000,
+            snapshot_logs_since_last: MetaClusterConfig::default_snapshot_logs_since_last(),
+            snapshot_interval: MetaClusterConfig::default_snapshot_interval(),
         }
     }
 }
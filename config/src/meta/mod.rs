@@ -115,6 +115,8 @@ heartbeat_expired_interval = 60
 
         let config: Opt = toml::from_str(config_str).unwrap();
         assert!(toml::to_string_pretty(&config).is_ok());
+        assert_eq!(config.cluster.snapshot_logs_since_last, 10000);
+        assert_eq!(config.cluster.snapshot_interval, 3600);
         dbg!(config);
     }
 }
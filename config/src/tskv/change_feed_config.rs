@@ -0,0 +1,108 @@
+use std::sync::Arc;
+
+use macros::EnvKeys;
+use serde::{Deserialize, Serialize};
+
+use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::bytes_num;
+
+/// Keep a log of the writes of the selected databases, to be tailed by the
+/// api `/api/v1/changes`.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct ChangeFeedConfig {
+    #[serde(default = "ChangeFeedConfig::default_enabled")]
+    pub enabled: bool,
+
+    /// Directory of the logs, a log per database.
+    #[serde(default = "ChangeFeedConfig::default_path")]
+    pub path: String,
+
+    /// The oldest writes of a database are removed if its log is larger
+    /// than this.
+    #[serde(with = "bytes_num", default = "ChangeFeedConfig::default_max_size")]
+    pub max_size: u64,
+
+    #[serde(
+        with = "bytes_num",
+        default = "ChangeFeedConfig::default_max_segment_size"
+    )]
+    pub max_segment_size: u64,
+
+    /// Tenant of the databases logged.
+    #[serde(default = "ChangeFeedConfig::default_tenant")]
+    pub tenant: String,
+
+    /// Databases logged, all the databases of the tenant if empty.
+    #[serde(default = "Default::default")]
+    pub databases: Vec<String>,
+}
+
+impl ChangeFeedConfig {
+    fn default_enabled() -> bool {
+        false
+    }
+
+    fn default_path() -> String {
+        let path = std::path::Path::new("/tmp/cnosdb/cnosdb_data").join("change_feed");
+        path.to_string_lossy().to_string()
+    }
+
+    fn default_max_size() -> u64 {
+        1024 * 1024 * 1024
+    }
+
+    fn default_max_segment_size() -> u64 {
+        64 * 1024 * 1024
+    }
+
+    fn default_tenant() -> String {
+        "cnosdb".to_string()
+    }
+
+    pub fn logs(&self, tenant: &str, db: &str) -> bool {
+        self.enabled
+            && self.tenant == tenant
+            && (self.databases.is_empty() || self.databases.iter().any(|d| d == db))
+    }
+}
+
+impl Default for ChangeFeedConfig {
+    fn default() -> Self {
+        Self {
+            enabled: Self::default_enabled(),
+            path: Self::default_path(),
+            max_size: Self::default_max_size(),
+            max_segment_size: Self::default_max_segment_size(),
+            tenant: Self::default_tenant(),
+            databases: vec![],
+        }
+    }
+}
+
+impl CheckConfig for ChangeFeedConfig {
+    fn check(&self, _: &super::Config) -> Option<CheckConfigResult> {
+        let config_name = Arc::new("change_feed".to_string());
+        let mut ret = CheckConfigResult::default();
+
+        if self.max_segment_size == 0 {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "max_segment_size".to_string(),
+                message: "'max_segment_size' can not be zero".to_string(),
+            });
+        }
+        if self.max_segment_size > self.max_size {
+            ret.add_warn(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "max_segment_size".to_string(),
+                message: "'max_segment_size' is larger than 'max_size'".to_string(),
+            });
+        }
+
+        if ret.is_empty() {
+            None
+        } else {
+            Some(ret)
+        }
+    }
+}
@@ -47,6 +47,19 @@ pub struct ClusterConfig {
         default = "ClusterConfig::default_install_snapshot_timeout"
     )]
     pub install_snapshot_timeout: Duration, //ms
+
+    /// Interval of probing the other data nodes, 0 to disable.
+    #[serde(
+        with = "duration",
+        default = "ClusterConfig::default_node_check_interval"
+    )]
+    pub node_check_interval: Duration,
+
+    #[serde(
+        with = "duration",
+        default = "ClusterConfig::default_node_check_timeout"
+    )]
+    pub node_check_timeout: Duration,
 }
 
 impl ClusterConfig {
@@ -77,6 +90,14 @@ impl ClusterConfig {
     fn default_install_snapshot_timeout() -> Duration {
         Duration::from_millis(3_600_000)
     }
+
+    fn default_node_check_interval() -> Duration {
+        Duration::from_millis(1_000)
+    }
+
+    fn default_node_check_timeout() -> Duration {
+        Duration::from_millis(500)
+    }
 }
 
 impl Default for ClusterConfig {
@@ -89,6 +110,8 @@ impl Default for ClusterConfig {
             trigger_snapshot_interval: ClusterConfig::default_trigger_snapshot_interval(),
             send_append_entries_timeout: ClusterConfig::default_send_append_entries_timeout(),
             install_snapshot_timeout: ClusterConfig::default_install_snapshot_timeout(),
+            node_check_interval: ClusterConfig::default_node_check_interval(),
+            node_check_timeout: ClusterConfig::default_node_check_timeout(),
         }
     }
 }
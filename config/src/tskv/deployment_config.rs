@@ -45,12 +45,12 @@ impl CheckConfig for DeploymentConfig {
         let mut ret = CheckConfigResult::default();
 
         match self.mode.as_str() {
-            "query_tskv" | "tskv" | "query" | "singleton" => {}
+            "query_tskv" | "tskv" | "query" | "singleton" | "edge" => {}
             other_mode => {
                 ret.add_error(CheckConfigItemResult {
                     config: config_name.clone(),
                     item: "mode".to_string(),
-                    message: format!("'mode' {} is not supported, 'mode' must be one of [query_tskv, query, tskv, singleton]", other_mode)
+                    message: format!("'mode' {} is not supported, 'mode' must be one of [query_tskv, query, tskv, singleton, edge]", other_mode)
                 });
             }
         }
@@ -0,0 +1,92 @@
+use std::sync::Arc;
+use std::time::Duration;
+
+use macros::EnvKeys;
+use serde::{Deserialize, Serialize};
+
+use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::duration;
+
+/// Watches the usage of the disks of the data and the wal, the node rejects
+/// the writes while any of them is fuller than `read_only_usage`.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct DiskWatchdogConfig {
+    #[serde(default = "DiskWatchdogConfig::default_enabled")]
+    pub enabled: bool,
+
+    #[serde(with = "duration", default = "DiskWatchdogConfig::default_interval")]
+    pub interval: Duration,
+
+    /// Percentage of the disk used to turn the node read-only.
+    #[serde(default = "DiskWatchdogConfig::default_read_only_usage")]
+    pub read_only_usage: u64,
+
+    /// Percentage of the disk used to accept the writes again, lower than
+    /// `read_only_usage` so that the node doesn't flap around it.
+    #[serde(default = "DiskWatchdogConfig::default_resume_usage")]
+    pub resume_usage: u64,
+}
+
+impl DiskWatchdogConfig {
+    fn default_enabled() -> bool {
+        false
+    }
+
+    fn default_interval() -> Duration {
+        Duration::from_secs(10)
+    }
+
+    fn default_read_only_usage() -> u64 {
+        95
+    }
+
+    fn default_resume_usage() -> u64 {
+        90
+    }
+}
+
+impl Default for DiskWatchdogConfig {
+    fn default() -> Self {
+        Self {
+            enabled: Self::default_enabled(),
+            interval: Self::default_interval(),
+            read_only_usage: Self::default_read_only_usage(),
+            resume_usage: Self::default_resume_usage(),
+        }
+    }
+}
+
+impl CheckConfig for DiskWatchdogConfig {
+    fn check(&self, _: &super::Config) -> Option<CheckConfigResult> {
+        let config_name = Arc::new("disk_watchdog".to_string());
+        let mut ret = CheckConfigResult::default();
+
+        if self.interval.is_zero() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "interval".to_string(),
+                message: "'interval' can not be zero".to_string(),
+            });
+        }
+        if self.read_only_usage == 0 || self.read_only_usage > 100 {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "read_only_usage".to_string(),
+                message: "'read_only_usage' must be in (0, 100]".to_string(),
+            });
+        }
+        if self.resume_usage >= self.read_only_usage {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "resume_usage".to_string(),
+                message: "'resume_usage' must be less than 'read_only_usage'".to_string(),
+            });
+        }
+
+        if ret.is_empty() {
+            None
+        } else {
+            Some(ret)
+        }
+    }
+}
@@ -0,0 +1,261 @@
+//! Checks of the host the server runs on, the checks of the configurations
+//! that depend on the disks, the limits and the memory of the host and the
+//! files in the data directory.
+
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+
+use crate::check::{CheckConfigItemResult, CheckConfigResult};
+use crate::tskv::Config;
+
+/// Recommended minimum of the limit of the open files.
+pub const MIN_OPEN_FILES: u64 = 65536;
+
+pub fn check_environment(config: &Config) -> Option<CheckConfigResult> {
+    let mut ret = CheckConfigResult::default();
+    check_devices(config, &mut ret);
+    check_open_files(config, &mut ret);
+    check_memory(config, &mut ret);
+    check_index_engine(config, &mut ret);
+
+    if ret.is_empty() {
+        None
+    } else {
+        Some(ret)
+    }
+}
+
+/// The data and the wal on the same rotational disk compete for the seeks.
+fn check_devices(config: &Config, ret: &mut CheckConfigResult) {
+    let (storage_dev, wal_dev) = match (
+        device_of(Path::new(&config.storage.path)),
+        device_of(Path::new(&config.wal.path)),
+    ) {
+        (Some(storage_dev), Some(wal_dev)) => (storage_dev, wal_dev),
+        _ => return,
+    };
+    if storage_dev == wal_dev && is_rotational(storage_dev) == Some(true) {
+        ret.add_warn(CheckConfigItemResult {
+            config: Arc::new("wal".to_string()),
+            item: "path".to_string(),
+            message: format!(
+                "'wal.path' {} and 'storage.path' {} are on the same rotational disk, \
+                 put the wal on another disk for better write throughput",
+                config.wal.path, config.storage.path
+            ),
+        });
+    }
+}
+
+/// The tsm files, the indexes and the wal of the vnodes and the sockets need
+/// more files open than the limit of the process, otherwise the server fails
+/// with EMFILE. The server raises the soft limit to the hard limit before the
+/// check, and the estimate is rough, so it only warns.
+fn check_open_files(config: &Config, ret: &mut CheckConfigResult) {
+    let limit = match open_files_limit() {
+        Some(limit) => limit,
+        None => return,
+    };
+    let config_name = Arc::new("storage".to_string());
+
+    let vnodes = vnode_dirs(config);
+    let tsm_files = vnodes
+        .iter()
+        .map(|vnode| count_files(&vnode.join("tsm")) + count_files(&vnode.join("delta")))
+        .sum::<u64>();
+    let open_tsm_files = match config.storage.max_open_tsm_files as u64 {
+        0 => tsm_files,
+        max => tsm_files.min(max),
+    };
+    // a few files of the index and the wal of every vnode, and the sockets
+    let needed = open_tsm_files + vnodes.len() as u64 * 4 + 1024;
+    if limit < needed {
+        ret.add_warn(CheckConfigItemResult {
+            config: config_name,
+            item: "max_open_tsm_files".to_string(),
+            message: format!(
+                "the limit of the open files is {}, less than the {} needed by the {} tsm \
+                 files of {} vnodes, raise it by 'ulimit -n' or 'LimitNOFILE' of systemd, \
+                 or limit the open tsm files by 'max_open_tsm_files'",
+                limit,
+                needed,
+                tsm_files,
+                vnodes.len()
+            ),
+        });
+    } else if limit < MIN_OPEN_FILES {
+        ret.add_warn(CheckConfigItemResult {
+            config: config_name,
+            item: "path".to_string(),
+            message: format!(
+                "the limit of the open files is {}, at least {} is recommended, \
+                 raise it by 'ulimit -n' or 'LimitNOFILE' of systemd",
+                limit, MIN_OPEN_FILES
+            ),
+        });
+    }
+}
+
+fn check_memory(config: &Config, ret: &mut CheckConfigResult) {
+    let total = match sys_info::mem_info() {
+        // KB
+        Ok(mem_info) => mem_info.total * 1024,
+        Err(_) => return,
+    };
+    let memory = config.deployment.memory as u64 * 1024 * 1024 * 1024;
+    if memory > total {
+        ret.add_warn(CheckConfigItemResult {
+            config: Arc::new("deployment".to_string()),
+            item: "memory".to_string(),
+            message: format!(
+                "'memory' {}G is more than the {}G memory of the host",
+                config.deployment.memory,
+                total / 1024 / 1024 / 1024
+            ),
+        });
+    }
+    // the memory of the host may be limited by the cgroup or shared with
+    // other processes, only the memory of the configurations is definite
+    let max_buffer_size = config.cache.max_buffer_size;
+    if max_buffer_size >= memory {
+        ret.add_error(CheckConfigItemResult {
+            config: Arc::new("cache".to_string()),
+            item: "max_buffer_size".to_string(),
+            message: format!(
+                "'max_buffer_size' {} bytes is not less than 'deployment.memory' {} bytes, \
+                 the node runs out of memory before flushing the caches",
+                max_buffer_size, memory
+            ),
+        });
+    } else if max_buffer_size >= total {
+        ret.add_warn(CheckConfigItemResult {
+            config: Arc::new("cache".to_string()),
+            item: "max_buffer_size".to_string(),
+            message: format!(
+                "'max_buffer_size' {} bytes is not less than the {} bytes memory of the host, \
+                 the node runs out of memory before flushing the caches",
+                max_buffer_size, total
+            ),
+        });
+    }
+}
+
+/// The vnodes indexed by the old index engine are converted to the current
+/// one when they are opened, which takes long for large indexes.
+fn check_index_engine(config: &Config, ret: &mut CheckConfigResult) {
+    let old_indexes = vnode_dirs(config)
+        .iter()
+        .filter(|vnode| vnode.join("index").join("index.db").exists())
+        .count();
+    if old_indexes > 0 {
+        ret.add_warn(CheckConfigItemResult {
+            config: Arc::new("storage".to_string()),
+            item: "path".to_string(),
+            message: format!(
+                "{} vnodes in {} use the old index engine, they are converted when the \
+                 server starts which may take long",
+                old_indexes, config.storage.path
+            ),
+        });
+    }
+}
+
+/// Directories of the vnodes, `<storage.path>/data/<owner>/<vnode>`, see
+/// `tskv::kv_option`.
+fn vnode_dirs(config: &Config) -> Vec<PathBuf> {
+    let data_dir = Path::new(&config.storage.path).join("data");
+    sub_dirs(&data_dir)
+        .iter()
+        .flat_map(|owner| sub_dirs(owner))
+        .collect()
+}
+
+fn count_files(dir: &Path) -> u64 {
+    match std::fs::read_dir(dir) {
+        Ok(entries) => entries.filter_map(|e| e.ok()).count() as u64,
+        Err(_) => 0,
+    }
+}
+
+fn sub_dirs(dir: &Path) -> Vec<PathBuf> {
+    match std::fs::read_dir(dir) {
+        Ok(entries) => entries
+            .filter_map(|e| e.ok())
+            .map(|e| e.path())
+            .filter(|p| p.is_dir())
+            .collect(),
+        Err(_) => vec![],
+    }
+}
+
+/// Device of the path, or of its closest existing ancestor if the path is
+/// not created yet.
+#[cfg(unix)]
+fn device_of(path: &Path) -> Option<u64> {
+    use std::os::unix::fs::MetadataExt;
+
+    path.ancestors()
+        .find_map(|p| std::fs::metadata(p).ok())
+        .map(|m| m.dev())
+}
+
+#[cfg(not(unix))]
+fn device_of(_path: &Path) -> Option<u64> {
+    None
+}
+
+#[cfg(target_os = "linux")]
+fn is_rotational(dev: u64) -> Option<bool> {
+    let major = ((dev >> 8) & 0xfff) | ((dev >> 32) & !0xfff);
+    let minor = (dev & 0xff) | ((dev >> 12) & !0xff);
+    let block = std::fs::canonicalize(format!("/sys/dev/block/{}:{}", major, minor)).ok()?;
+    // the queue of a partition is the queue of its disk
+    [block.join("queue"), block.join("..").join("queue")]
+        .iter()
+        .find_map(|queue| std::fs::read_to_string(queue.join("rotational")).ok())
+        .map(|rotational| rotational.trim() == "1")
+}
+
+#[cfg(not(target_os = "linux"))]
+fn is_rotational(_dev: u64) -> Option<bool> {
+    None
+}
+
+/// The soft limit of the open files of the process.
+#[cfg(target_os = "linux")]
+pub fn open_files_limit() -> Option<u64> {
+    let limits = std::fs::read_to_string("/proc/self/limits").ok()?;
+    parse_open_files_limit(&limits)
+}
+
+#[cfg(not(target_os = "linux"))]
+pub fn open_files_limit() -> Option<u64> {
+    None
+}
+
+fn parse_open_files_limit(limits: &str) -> Option<u64> {
+    let line = limits.lines().find(|l| l.starts_with("Max open files"))?;
+    let soft = line["Max open files".len()..].split_whitespace().next()?;
+    match soft {
+        "unlimited" => Some(u64::MAX),
+        soft => soft.parse().ok(),
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::parse_open_files_limit;
+
+    #[test]
+    fn test_parse_open_files_limit() {
+        let limits = "Limit                     Soft Limit           Hard Limit           Units     \n\
+                      Max processes             127431               127431               processes \n\
+                      Max open files            1024                 524288               files     \n";
+        assert_eq!(parse_open_files_limit(limits), Some(1024));
+        assert_eq!(
+            parse_open_files_limit("Max open files  unlimited  unlimited  files"),
+            Some(u64::MAX)
+        );
+        assert_eq!(parse_open_files_limit("Max processes 1 1 processes"), None);
+    }
+}
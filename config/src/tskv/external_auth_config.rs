@@ -0,0 +1,244 @@
+use std::sync::Arc;
+use std::time::Duration;
+
+use macros::EnvKeys;
+use serde::{Deserialize, Serialize};
+
+use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::duration;
+
+/// Authenticate the users of the http requests failed to be authenticated
+/// by CnosDB with an external identity provider.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct ExternalAuthConfig {
+    #[serde(default = "Default::default")]
+    pub ldap: Option<LdapConfig>,
+
+    #[serde(default = "Default::default")]
+    pub oidc: Option<OidcConfig>,
+
+    /// Roles of tenants granted to the members of the external groups.
+    #[serde(default = "Default::default")]
+    pub group_mappings: Vec<GroupMapping>,
+
+    /// How long a successful authentication by the provider is reused.
+    #[serde(with = "duration", default = "ExternalAuthConfig::default_cache_ttl")]
+    pub cache_ttl: Duration,
+}
+
+/// Authenticate the basic auth of the requests by a simple bind.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct LdapConfig {
+    /// Address of the server, `ldaps://` or `ldap://`.
+    #[serde(default = "LdapConfig::default_url")]
+    pub url: String,
+
+    /// Upgrade the `ldap://` connections by StartTLS, otherwise the
+    /// passwords are sent in plaintext.
+    #[serde(default = "Default::default")]
+    pub starttls: bool,
+
+    /// DN to bind, `{user}` is replaced by the user name.
+    #[serde(default = "LdapConfig::default_bind_dn")]
+    pub bind_dn: String,
+
+    /// The groups are searched under it if set.
+    #[serde(default = "Default::default")]
+    pub group_base_dn: Option<String>,
+
+    /// Attribute of the groups holding the DNs of the members.
+    #[serde(default = "LdapConfig::default_group_member_attribute")]
+    pub group_member_attribute: String,
+
+    /// Attribute of the groups used as the group name.
+    #[serde(default = "LdapConfig::default_group_name_attribute")]
+    pub group_name_attribute: String,
+
+    #[serde(with = "duration", default = "LdapConfig::default_timeout")]
+    pub timeout: Duration,
+}
+
+/// Authenticate the bearer tokens of the requests by the token introspection
+/// (RFC 7662) of the provider.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct OidcConfig {
+    pub introspection_url: String,
+
+    pub client_id: String,
+
+    pub client_secret: String,
+
+    /// The audience the tokens must be issued for, in the `aud` claim, the
+    /// tokens issued to `client_id` are also accepted.
+    #[serde(default = "Default::default")]
+    pub audience: Option<String>,
+
+    /// The issuer the tokens must be issued by, in the `iss` claim.
+    #[serde(default = "Default::default")]
+    pub issuer: Option<String>,
+
+    /// Claim of the introspection response used as the user name.
+    #[serde(default = "OidcConfig::default_user_claim")]
+    pub user_claim: String,
+
+    /// Claim of the introspection response holding the groups of the user.
+    #[serde(default = "OidcConfig::default_groups_claim")]
+    pub groups_claim: String,
+
+    #[serde(with = "duration", default = "OidcConfig::default_timeout")]
+    pub timeout: Duration,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct GroupMapping {
+    pub group: String,
+
+    #[serde(default = "GroupMapping::default_tenant")]
+    pub tenant: String,
+
+    /// `owner`, `member` or a custom role of the tenant.
+    pub role: String,
+}
+
+impl ExternalAuthConfig {
+    fn default_cache_ttl() -> Duration {
+        Duration::from_secs(60)
+    }
+
+    pub fn is_enabled(&self) -> bool {
+        self.ldap.is_some() || self.oidc.is_some()
+    }
+}
+
+impl Default for ExternalAuthConfig {
+    fn default() -> Self {
+        Self {
+            ldap: None,
+            oidc: None,
+            group_mappings: vec![],
+            cache_ttl: Self::default_cache_ttl(),
+        }
+    }
+}
+
+impl LdapConfig {
+    fn default_url() -> String {
+        "ldaps://127.0.0.1:636".to_string()
+    }
+
+    fn default_bind_dn() -> String {
+        "uid={user},ou=people,dc=example,dc=com".to_string()
+    }
+
+    fn default_group_member_attribute() -> String {
+        "member".to_string()
+    }
+
+    fn default_group_name_attribute() -> String {
+        "cn".to_string()
+    }
+
+    fn default_timeout() -> Duration {
+        Duration::from_secs(5)
+    }
+}
+
+impl Default for LdapConfig {
+    fn default() -> Self {
+        Self {
+            url: Self::default_url(),
+            starttls: false,
+            bind_dn: Self::default_bind_dn(),
+            group_base_dn: None,
+            group_member_attribute: Self::default_group_member_attribute(),
+            group_name_attribute: Self::default_group_name_attribute(),
+            timeout: Self::default_timeout(),
+        }
+    }
+}
+
+impl OidcConfig {
+    fn default_user_claim() -> String {
+        "preferred_username".to_string()
+    }
+
+    fn default_groups_claim() -> String {
+        "groups".to_string()
+    }
+
+    fn default_timeout() -> Duration {
+        Duration::from_secs(5)
+    }
+}
+
+impl GroupMapping {
+    fn default_tenant() -> String {
+        "cnosdb".to_string()
+    }
+}
+
+impl CheckConfig for ExternalAuthConfig {
+    fn check(&self, _: &super::Config) -> Option<CheckConfigResult> {
+        let config_name = Arc::new("security.external_auth".to_string());
+        let mut ret = CheckConfigResult::default();
+
+        if let Some(ldap) = &self.ldap {
+            if ldap.url.starts_with("ldaps://") {
+                if ldap.starttls {
+                    ret.add_error(CheckConfigItemResult {
+                        config: config_name.clone(),
+                        item: "ldap.starttls".to_string(),
+                        message: "'starttls' can't be used with 'ldaps://'".to_string(),
+                    });
+                }
+            } else if ldap.url.starts_with("ldap://") {
+                if !ldap.starttls {
+                    ret.add_warn(CheckConfigItemResult {
+                        config: config_name.clone(),
+                        item: "ldap.url".to_string(),
+                        message: "the passwords are sent to 'ldap://' in plaintext, \
+                                  use 'ldaps://' or 'starttls'"
+                            .to_string(),
+                    });
+                }
+            } else {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "ldap.url".to_string(),
+                    message: "only 'ldaps://' and 'ldap://' are supported".to_string(),
+                });
+            }
+            if !ldap.bind_dn.contains("{user}") {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "ldap.bind_dn".to_string(),
+                    message: "'bind_dn' must contain '{user}'".to_string(),
+                });
+            }
+        }
+        if let Some(oidc) = &self.oidc {
+            if oidc.introspection_url.is_empty() {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "oidc.introspection_url".to_string(),
+                    message: "'introspection_url' is empty".to_string(),
+                });
+            }
+        }
+        for mapping in &self.group_mappings {
+            if mapping.group.is_empty() || mapping.role.is_empty() {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "group_mappings".to_string(),
+                    message: "'group' and 'role' of the mappings can't be empty".to_string(),
+                });
+            }
+        }
+
+        if ret.is_empty() {
+            None
+        } else {
+            Some(ret)
+        }
+    }
+}
@@ -17,6 +17,12 @@ pub struct GlobalConfig {
     pub store_metrics: bool,
     #[serde(default = "GlobalConfig::default_pre_create_bucket")]
     pub pre_create_bucket: bool,
+    /// Zone of the node, the databases placed on a zone only use its nodes.
+    #[serde(default = "Default::default")]
+    pub zone: String,
+    /// Tags of the node, e.g. the hardware class `ssd` or `hdd`.
+    #[serde(default = "Default::default")]
+    pub node_tags: Vec<String>,
 }
 
 impl GlobalConfig {
@@ -49,6 +55,8 @@ impl Default for GlobalConfig {
             cluster_name: GlobalConfig::default_cluster_name(),
             store_metrics: GlobalConfig::default_store_metrics(),
             pre_create_bucket: GlobalConfig::default_pre_create_bucket(),
+            zone: String::new(),
+            node_tags: vec![],
         }
     }
 }
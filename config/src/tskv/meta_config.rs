@@ -29,6 +29,17 @@ pub struct MetaConfig {
     pub cluster_schema_cache_size: u64,
     #[serde(default = "MetaConfig::default_system_database_replica")]
     pub system_database_replica: u64,
+    /// 'host:port', every address the host resolves to is a meta node,
+    /// e.g. a headless service of kubernetes. Overrides `service_addr`.
+    #[serde(default)]
+    pub discovery_dns: Option<String>,
+    /// A http url returns meta node addresses, as a json array or separated
+    /// by ',' ';' or line breaks. Overrides `service_addr`.
+    #[serde(default)]
+    pub discovery_url: Option<String>,
+    /// How long to wait for meta nodes to be discovered on startup.
+    #[serde(with = "duration", default = "MetaConfig::default_discovery_timeout")]
+    pub discovery_timeout: Duration,
 }
 
 impl MetaConfig {
@@ -51,6 +62,14 @@ impl MetaConfig {
     pub fn default_system_database_replica() -> u64 {
         3
     }
+
+    fn default_discovery_timeout() -> Duration {
+        Duration::from_secs(300)
+    }
+
+    pub fn discovery_enabled(&self) -> bool {
+        self.discovery_dns.is_some() || self.discovery_url.is_some()
+    }
 }
 
 impl Default for MetaConfig {
@@ -61,6 +80,9 @@ impl Default for MetaConfig {
             usage_schema_cache_size: MetaConfig::default_usage_schema_cache_size(),
             cluster_schema_cache_size: MetaConfig::default_cluster_schema_cache_size(),
             system_database_replica: MetaConfig::default_system_database_replica(),
+            discovery_dns: None,
+            discovery_url: None,
+            discovery_timeout: MetaConfig::default_discovery_timeout(),
         }
     }
 }
@@ -70,9 +92,17 @@ impl CheckConfig for MetaConfig {
         let config_name = Arc::new("meta".to_string());
         let mut ret = CheckConfigResult::default();
 
-        for meta_addr in self.service_addr.iter() {
+        // Meta nodes may not be resolvable until they are discovered, or until
+        // the DNS records of the nodes started together are published, so it
+        // doesn't stop the server from starting.
+        let service_addr: &[String] = if self.discovery_enabled() {
+            &[]
+        } else {
+            &self.service_addr
+        };
+        for meta_addr in service_addr.iter() {
             if let Err(e) = meta_addr.to_socket_addrs() {
-                ret.add_error(CheckConfigItemResult {
+                ret.add_warn(CheckConfigItemResult {
                     config: config_name.clone(),
                     item: meta_addr.clone(),
                     message: format!("Cannot resolve 'meta_service_addr': {}", e),
@@ -0,0 +1,189 @@
+use std::sync::Arc;
+use std::time::Duration;
+
+use macros::EnvKeys;
+use serde::{Deserialize, Serialize};
+
+use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::{bytes_num, duration};
+
+/// Forward the writes of the selected databases to remote clusters.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct MirrorConfig {
+    #[serde(default = "MirrorConfig::default_enabled")]
+    pub enabled: bool,
+
+    /// Directory of the queues of the writes to forward, a queue per target.
+    #[serde(default = "MirrorConfig::default_queue_path")]
+    pub queue_path: String,
+
+    /// Writes are dropped if the queue of the target is larger than this.
+    #[serde(with = "bytes_num", default = "MirrorConfig::default_max_queue_size")]
+    pub max_queue_size: u64,
+
+    #[serde(with = "bytes_num", default = "MirrorConfig::default_max_segment_size")]
+    pub max_segment_size: u64,
+
+    #[serde(with = "duration", default = "MirrorConfig::default_request_timeout")]
+    pub request_timeout: Duration,
+
+    /// Interval of probing a target failed to answer.
+    #[serde(
+        with = "duration",
+        default = "MirrorConfig::default_health_check_interval"
+    )]
+    pub health_check_interval: Duration,
+
+    #[serde(default = "Default::default")]
+    pub targets: Vec<MirrorTarget>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct MirrorTarget {
+    /// Unique name of the target, also the name of its queue.
+    pub name: String,
+
+    /// Address of the remote cluster, e.g. `http://127.0.0.1:8902`.
+    pub url: String,
+
+    /// `cnosdb` or `influxdb`, the writes to InfluxDB are sent to its
+    /// 1.x `/write` api.
+    #[serde(default = "MirrorTarget::default_kind")]
+    pub kind: String,
+
+    #[serde(default = "Default::default")]
+    pub user: Option<String>,
+
+    #[serde(default = "Default::default")]
+    pub password: Option<String>,
+
+    /// Tenant of the databases forwarded.
+    #[serde(default = "MirrorTarget::default_tenant")]
+    pub tenant: String,
+
+    /// Databases forwarded, all the databases of the tenant if empty.
+    #[serde(default = "Default::default")]
+    pub databases: Vec<String>,
+
+    /// Tenant written in the remote CnosDB, defaults to `tenant`.
+    #[serde(default = "Default::default")]
+    pub remote_tenant: Option<String>,
+}
+
+impl MirrorConfig {
+    fn default_enabled() -> bool {
+        false
+    }
+
+    fn default_queue_path() -> String {
+        let path = std::path::Path::new("/tmp/cnosdb/cnosdb_data").join("mirror");
+        path.to_string_lossy().to_string()
+    }
+
+    fn default_max_queue_size() -> u64 {
+        1024 * 1024 * 1024
+    }
+
+    fn default_max_segment_size() -> u64 {
+        64 * 1024 * 1024
+    }
+
+    fn default_request_timeout() -> Duration {
+        Duration::from_secs(10)
+    }
+
+    fn default_health_check_interval() -> Duration {
+        Duration::from_secs(5)
+    }
+}
+
+impl MirrorTarget {
+    pub const KIND_CNOSDB: &'static str = "cnosdb";
+    pub const KIND_INFLUXDB: &'static str = "influxdb";
+
+    fn default_kind() -> String {
+        Self::KIND_CNOSDB.to_string()
+    }
+
+    fn default_tenant() -> String {
+        "cnosdb".to_string()
+    }
+
+    pub fn forwards(&self, tenant: &str, db: &str) -> bool {
+        self.tenant == tenant
+            && (self.databases.is_empty() || self.databases.iter().any(|d| d == db))
+    }
+}
+
+impl Default for MirrorConfig {
+    fn default() -> Self {
+        Self {
+            enabled: Self::default_enabled(),
+            queue_path: Self::default_queue_path(),
+            max_queue_size: Self::default_max_queue_size(),
+            max_segment_size: Self::default_max_segment_size(),
+            request_timeout: Self::default_request_timeout(),
+            health_check_interval: Self::default_health_check_interval(),
+            targets: vec![],
+        }
+    }
+}
+
+impl CheckConfig for MirrorConfig {
+    fn check(&self, config: &super::Config) -> Option<CheckConfigResult> {
+        let config_name = Arc::new("mirror".to_string());
+        let mut ret = CheckConfigResult::default();
+
+        if config.deployment.mode == "edge" && (!self.enabled || self.targets.is_empty()) {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "targets".to_string(),
+                message: "the edge mode needs 'enabled' and an upstream target".to_string(),
+            });
+        }
+
+        if self.health_check_interval.is_zero() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "health_check_interval".to_string(),
+                message: "'health_check_interval' can not be zero".to_string(),
+            });
+        }
+        if self.max_segment_size > self.max_queue_size {
+            ret.add_warn(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "max_segment_size".to_string(),
+                message: "'max_segment_size' is larger than 'max_queue_size'".to_string(),
+            });
+        }
+
+        let mut names = std::collections::HashSet::new();
+        for target in &self.targets {
+            if !names.insert(target.name.as_str()) {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "targets".to_string(),
+                    message: format!("duplicated target name '{}'", target.name),
+                });
+            }
+            if target.kind != MirrorTarget::KIND_CNOSDB
+                && target.kind != MirrorTarget::KIND_INFLUXDB
+            {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "targets".to_string(),
+                    message: format!(
+                        "kind of target '{}' must be 'cnosdb' or 'influxdb'",
+                        target.name
+                    ),
+                });
+            }
+        }
+
+        if ret.is_empty() {
+            None
+        } else {
+            Some(ret)
+        }
+    }
+}
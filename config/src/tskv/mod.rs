@@ -1,9 +1,16 @@
 mod cache_config;
+mod change_feed_config;
 mod cluster_config;
 mod deployment_config;
+mod disk_watchdog_config;
+mod environment;
+mod external_auth_config;
 mod global_config;
 mod meta_config;
+mod mirror_config;
+mod monitor_config;
 mod query_config;
+mod retention_config;
 mod security_config;
 mod service_config;
 mod storage_config;
@@ -14,15 +21,21 @@ use std::collections::HashMap;
 use std::path::{Path, PathBuf};
 
 pub use cache_config::*;
+pub use change_feed_config::*;
 pub use cluster_config::*;
 pub use deployment_config::*;
+pub use disk_watchdog_config::*;
+pub use external_auth_config::*;
 use figment::providers::{Env, Format, Toml};
 use figment::value::Uncased;
 use figment::Figment;
 pub use global_config::*;
 use macros::EnvKeys;
 pub use meta_config::*;
+pub use mirror_config::*;
+pub use monitor_config::*;
 pub use query_config::*;
+pub use retention_config::*;
 pub use security_config::*;
 use serde::{Deserialize, Serialize};
 pub use service_config::*;
@@ -82,6 +95,26 @@ pub struct Config {
 
     #[serde(default = "Default::default")]
     pub trace: TraceConfig,
+
+    /// The sweeper deleting the buckets and points expired by the TTLs.
+    #[serde(default = "Default::default")]
+    pub retention: RetentionConfig,
+
+    ///
+    #[serde(default = "Default::default")]
+    pub mirror: MirrorConfig,
+
+    ///
+    #[serde(default = "Default::default")]
+    pub change_feed: ChangeFeedConfig,
+
+    ///
+    #[serde(default = "Default::default")]
+    pub monitor: MonitorConfig,
+
+    ///
+    #[serde(default = "Default::default")]
+    pub disk_watchdog: DiskWatchdogConfig,
 }
 
 impl Config {
@@ -131,46 +164,68 @@ pub fn get_config_for_test() -> Config {
     get_config(path).unwrap()
 }
 
+fn check(cfg: &Config) -> CheckConfigResult {
+    let mut check_results = CheckConfigResult::default();
+
+    if let Some(c) = cfg.global.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.deployment.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.meta.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.query.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.storage.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.wal.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.cache.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.log.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.security.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.service.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.cluster.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.retention.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.mirror.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.change_feed.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.monitor.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = cfg.disk_watchdog.check(cfg) {
+        check_results.add_all(c)
+    }
+    if let Some(c) = environment::check_environment(cfg) {
+        check_results.add_all(c)
+    }
+    check_results.introspect();
+    check_results
+}
+
 pub fn check_config(path: impl AsRef<Path>, show_warnings: bool) {
     match get_config(path) {
         Ok(cfg) => {
-            let mut check_results = CheckConfigResult::default();
-
-            if let Some(c) = cfg.global.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.deployment.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.meta.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.query.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.storage.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.wal.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.cache.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.log.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.security.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.service.check(&cfg) {
-                check_results.add_all(c)
-            }
-            if let Some(c) = cfg.cluster.check(&cfg) {
-                check_results.add_all(c)
-            }
-
-            check_results.introspect();
+            let mut check_results = check(&cfg);
             check_results.show_warnings = show_warnings;
             println!("{}", check_results);
         }
@@ -180,11 +235,28 @@ pub fn check_config(path: impl AsRef<Path>, show_warnings: bool) {
     };
 }
 
+/// Checks the configurations and the host before the server starts, returns
+/// the report of the errors if any, otherwise the report of the warnings.
+/// Only the definite misconfigurations are errors, the checks depending on
+/// the state of the host, e.g. the DNS or the limits, are warnings.
+pub fn self_check(cfg: &Config) -> Result<Option<String>, String> {
+    let mut check_results = check(cfg);
+    check_results.show_warnings = true;
+    if check_results.has_errors() {
+        Err(check_results.to_string())
+    } else if check_results.is_empty() {
+        Ok(None)
+    } else {
+        Ok(Some(check_results.to_string()))
+    }
+}
+
 #[cfg(test)]
 mod test {
     use std::io::Write;
 
     use super::get_config_for_test;
+    use crate::check::CheckConfig;
     use crate::tskv::{get_config, Config};
     use crate::EnvKeys;
 
@@ -236,4 +308,15 @@ mod test {
         let keys = Config::env_keys();
         dbg!(keys);
     }
+
+    #[test]
+    fn test_check_unresolvable_meta() {
+        let mut cfg = Config::default();
+        cfg.meta.service_addr = vec!["meta.unresolvable.invalid:8901".to_string()];
+
+        // the DNS may not be ready when the server starts
+        let ret = cfg.meta.check(&cfg).unwrap();
+        assert!(!ret.has_errors());
+        assert!(!ret.is_empty());
+    }
 }
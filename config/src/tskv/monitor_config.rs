@@ -0,0 +1,182 @@
+use std::sync::Arc;
+use std::time::Duration;
+
+use macros::EnvKeys;
+use serde::{Deserialize, Serialize};
+use utils::duration::CnosDuration;
+
+use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::duration;
+
+/// Where and how often the statistics of the node are stored, if
+/// `global.store_metrics` is enabled.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct MonitorConfig {
+    /// Database of the system tenant the statistics are written to, created
+    /// if not exists. The views of `usage_schema` of the other tenants read
+    /// the statistics from it.
+    #[serde(default = "MonitorConfig::default_database")]
+    pub database: String,
+
+    /// TTL of the database, e.g. `7d`, the TTL of the database is not
+    /// changed if empty.
+    #[serde(default = "Default::default")]
+    pub ttl: String,
+
+    /// Interval of storing the statistics.
+    #[serde(with = "duration", default = "MonitorConfig::default_interval")]
+    pub interval: Duration,
+
+    /// Statistic groups stored less often than `interval`.
+    #[serde(default = "Default::default")]
+    pub groups: Vec<MonitorGroup>,
+}
+
+/// The statistics whose names start with `prefix`, the group of the
+/// longest prefix is used if several groups match.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct MonitorGroup {
+    pub prefix: String,
+
+    /// Interval of storing the statistics of the group, rounded up to a
+    /// multiple of the `interval` of the monitor, "0s" to not store them.
+    #[serde(with = "duration")]
+    pub interval: Duration,
+}
+
+impl MonitorConfig {
+    fn default_database() -> String {
+        "usage_schema".to_string()
+    }
+
+    fn default_interval() -> Duration {
+        Duration::from_secs(10)
+    }
+
+    pub fn group(&self, name: &str) -> Option<&MonitorGroup> {
+        self.groups
+            .iter()
+            .filter(|g| name.starts_with(&g.prefix))
+            .max_by_key(|g| g.prefix.len())
+    }
+
+    /// Whether the statistic is stored at the `tick`th interval, counting
+    /// from 1.
+    pub fn stores_at(&self, name: &str, tick: u64) -> bool {
+        let group = match self.group(name) {
+            Some(group) => group,
+            None => return true,
+        };
+        if group.interval.is_zero() {
+            return false;
+        }
+        let interval = self.interval.as_millis().max(1);
+        let every = (group.interval.as_millis() + interval - 1) / interval;
+        tick % (every.max(1) as u64) == 0
+    }
+}
+
+impl Default for MonitorConfig {
+    fn default() -> Self {
+        Self {
+            database: Self::default_database(),
+            ttl: String::new(),
+            interval: Self::default_interval(),
+            groups: vec![],
+        }
+    }
+}
+
+impl CheckConfig for MonitorConfig {
+    fn check(&self, _: &super::Config) -> Option<CheckConfigResult> {
+        let config_name = Arc::new("monitor".to_string());
+        let mut ret = CheckConfigResult::default();
+
+        if self.interval.is_zero() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "interval".to_string(),
+                message: "'interval' can not be zero".to_string(),
+            });
+        }
+        if self.database.is_empty() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "database".to_string(),
+                message: "'database' can not be empty".to_string(),
+            });
+        }
+        if !self.ttl.is_empty() && CnosDuration::new(&self.ttl).is_none() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "ttl".to_string(),
+                message: format!("invalid ttl '{}'", self.ttl),
+            });
+        }
+
+        let mut prefixes = std::collections::HashSet::new();
+        for group in &self.groups {
+            if !prefixes.insert(group.prefix.as_str()) {
+                ret.add_error(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "groups".to_string(),
+                    message: format!("duplicated group prefix '{}'", group.prefix),
+                });
+            }
+            if !group.interval.is_zero() && group.interval < self.interval {
+                ret.add_warn(CheckConfigItemResult {
+                    config: config_name.clone(),
+                    item: "groups".to_string(),
+                    message: format!(
+                        "interval of group '{}' is shorter than 'interval'",
+                        group.prefix
+                    ),
+                });
+            }
+        }
+
+        if ret.is_empty() {
+            None
+        } else {
+            Some(ret)
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use super::{MonitorConfig, MonitorGroup};
+
+    #[test]
+    fn test_stores_at() {
+        let config = MonitorConfig {
+            groups: vec![
+                MonitorGroup {
+                    prefix: "coord_".to_string(),
+                    interval: Duration::from_secs(60),
+                },
+                MonitorGroup {
+                    prefix: "coord_data_".to_string(),
+                    interval: Duration::from_secs(25),
+                },
+                MonitorGroup {
+                    prefix: "vnode_".to_string(),
+                    interval: Duration::ZERO,
+                },
+            ],
+            ..Default::default()
+        };
+
+        let ticks = |name: &str| {
+            (1..=6)
+                .filter(|t| config.stores_at(name, *t))
+                .collect::<Vec<_>>()
+        };
+        assert_eq!(ticks("http_data_in"), vec![1, 2, 3, 4, 5, 6]);
+        assert_eq!(ticks("coord_writes"), vec![6]);
+        assert_eq!(ticks("coord_data_in"), vec![3, 6]);
+        assert!(ticks("vnode_disk_storage").is_empty());
+    }
+}
@@ -27,6 +27,15 @@ pub struct QueryConfig {
     pub stream_executor_cpu: usize,
     #[serde(with = "duration", default = "QueryConfig::default_sql_record_timeout")]
     pub sql_record_timeout: Duration,
+    #[serde(default = "QueryConfig::default_spill_path")]
+    pub spill_path: String,
+    #[serde(
+        with = "duration",
+        default = "QueryConfig::default_max_query_time_range"
+    )]
+    pub max_query_time_range: Duration,
+    #[serde(default = "QueryConfig::default_max_select_series")]
+    pub max_select_series: u64,
 }
 
 impl QueryConfig {
@@ -65,6 +74,19 @@ impl QueryConfig {
     fn default_sql_record_timeout() -> Duration {
         Duration::from_secs(10)
     }
+
+    fn default_spill_path() -> String {
+        let path = std::path::Path::new("/tmp/cnosdb/spill");
+        path.to_string_lossy().to_string()
+    }
+
+    fn default_max_query_time_range() -> Duration {
+        Duration::ZERO
+    }
+
+    fn default_max_select_series() -> u64 {
+        0
+    }
 }
 
 impl Default for QueryConfig {
@@ -79,6 +101,9 @@ impl Default for QueryConfig {
             stream_trigger_cpu: Self::default_stream_trigger_cpu(),
             stream_executor_cpu: Self::default_stream_executor_cpu(),
             sql_record_timeout: Self::default_sql_record_timeout(),
+            spill_path: Self::default_spill_path(),
+            max_query_time_range: Self::default_max_query_time_range(),
+            max_select_series: Self::default_max_select_series(),
         }
     }
 }
@@ -143,12 +168,20 @@ impl CheckConfig for QueryConfig {
 
         if self.sql_record_timeout.as_secs() < 1 {
             ret.add_warn(CheckConfigItemResult {
-                config: config_name,
+                config: config_name.clone(),
                 item: "sql_record_timeout".to_string(),
                 message: "'sql_record_timeout' maybe too small(less than 1)".to_string(),
             })
         }
 
+        if self.spill_path.is_empty() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name,
+                item: "spill_path".to_string(),
+                message: "'spill_path' is empty".to_string(),
+            })
+        }
+
         if ret.is_empty() {
             None
         } else {
@@ -0,0 +1,122 @@
+use std::sync::Arc;
+use std::time::Duration;
+
+use macros::EnvKeys;
+use serde::{Deserialize, Serialize};
+
+use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::duration;
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct RetentionConfig {
+    #[serde(default = "RetentionConfig::default_enabled")]
+    pub enabled: bool,
+
+    #[serde(with = "duration", default = "RetentionConfig::default_check_interval")]
+    pub check_interval: Duration,
+
+    #[serde(default = "RetentionConfig::default_dry_run")]
+    pub dry_run: bool,
+
+    /// Buckets older than this are deleted even if the TTL of their
+    /// database is longer, e.g. on an edge node which forwards the writes
+    /// upstream, "0s" to disable.
+    #[serde(with = "duration", default = "RetentionConfig::default_local_ttl")]
+    pub local_ttl: Duration,
+}
+
+impl RetentionConfig {
+    fn default_enabled() -> bool {
+        true
+    }
+
+    fn default_check_interval() -> Duration {
+        Duration::from_secs(60)
+    }
+
+    fn default_dry_run() -> bool {
+        false
+    }
+
+    fn default_local_ttl() -> Duration {
+        Duration::ZERO
+    }
+}
+
+impl Default for RetentionConfig {
+    fn default() -> Self {
+        Self {
+            enabled: RetentionConfig::default_enabled(),
+            check_interval: RetentionConfig::default_check_interval(),
+            dry_run: RetentionConfig::default_dry_run(),
+            local_ttl: RetentionConfig::default_local_ttl(),
+        }
+    }
+}
+
+impl CheckConfig for RetentionConfig {
+    fn check(&self, _: &super::Config) -> Option<CheckConfigResult> {
+        let config_name = Arc::new("retention".to_string());
+        let mut ret = CheckConfigResult::default();
+
+        if self.check_interval.is_zero() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name,
+                item: "check_interval".to_string(),
+                message: "'check_interval' can not be zero".to_string(),
+            });
+        }
+
+        if ret.is_empty() {
+            None
+        } else {
+            Some(ret)
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use super::RetentionConfig;
+    use crate::check::CheckConfig;
+    use crate::tskv::Config;
+
+    #[test]
+    fn test_default() {
+        let config: RetentionConfig = toml::from_str("").unwrap();
+        assert_eq!(config, RetentionConfig::default());
+        assert!(config.enabled);
+        assert_eq!(config.check_interval, Duration::from_secs(60));
+        assert!(!config.dry_run);
+        assert_eq!(config.local_ttl, Duration::ZERO);
+        assert!(config.check(&Config::default()).is_none());
+    }
+
+    #[test]
+    fn test_parse() {
+        let config_str = r#"
+            enabled = false
+            check_interval = "10m"
+            dry_run = true
+            local_ttl = "7d"
+        "#;
+        let config: RetentionConfig = toml::from_str(config_str).unwrap();
+        assert_eq!(
+            config,
+            RetentionConfig {
+                enabled: false,
+                check_interval: Duration::from_secs(600),
+                dry_run: true,
+                local_ttl: Duration::from_secs(7 * 24 * 3600),
+            }
+        );
+
+        let config_str = r#"
+            check_interval = "0s"
+        "#;
+        let config: RetentionConfig = toml::from_str(config_str).unwrap();
+        assert!(config.check(&Config::default()).is_some());
+    }
+}
@@ -1,13 +1,44 @@
 use std::sync::Arc;
+use std::time::Duration;
 
 use macros::EnvKeys;
 use serde::{Deserialize, Serialize};
 
+use super::ExternalAuthConfig;
 use crate::check::{CheckConfig, CheckConfigItemResult, CheckConfigResult};
+use crate::codec::duration;
 
-#[derive(Default, Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
 pub struct SecurityConfig {
     pub tls_config: Option<TLSConfig>,
+    #[serde(with = "duration", default = "SecurityConfig::default_session_ttl")]
+    pub session_ttl: Duration,
+    /// The key signing the session tokens, the same on all the nodes, the
+    /// sessions are disabled if it's empty.
+    #[serde(default)]
+    pub session_secret: String,
+    #[serde(default)]
+    pub password_policy: PasswordPolicyConfig,
+    #[serde(default)]
+    pub external_auth: ExternalAuthConfig,
+}
+
+impl SecurityConfig {
+    fn default_session_ttl() -> Duration {
+        Duration::from_secs(24 * 60 * 60)
+    }
+}
+
+impl Default for SecurityConfig {
+    fn default() -> Self {
+        Self {
+            tls_config: None,
+            session_ttl: Self::default_session_ttl(),
+            session_secret: String::new(),
+            password_policy: PasswordPolicyConfig::default(),
+            external_auth: ExternalAuthConfig::default(),
+        }
+    }
 }
 
 impl CheckConfig for SecurityConfig {
@@ -19,6 +50,12 @@ impl CheckConfig for SecurityConfig {
                 ret.add_all(r);
             }
         }
+        if let Some(r) = self.password_policy.check(all_config) {
+            ret.add_all(r);
+        }
+        if let Some(r) = self.external_auth.check(all_config) {
+            ret.add_all(r);
+        }
 
         if ret.is_empty() {
             Some(ret)
@@ -82,3 +119,74 @@ impl CheckConfig for TLSConfig {
         }
     }
 }
+
+/// The rules applied to the passwords set by `CREATE USER` and `ALTER USER`.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, EnvKeys)]
+pub struct PasswordPolicyConfig {
+    #[serde(default = "PasswordPolicyConfig::default_bcrypt_cost")]
+    pub bcrypt_cost: u32,
+    #[serde(default = "PasswordPolicyConfig::default_min_length")]
+    pub min_length: usize,
+    #[serde(default = "PasswordPolicyConfig::default_require_digit")]
+    pub require_digit: bool,
+    #[serde(default = "PasswordPolicyConfig::default_require_mixed_case")]
+    pub require_mixed_case: bool,
+    #[serde(default = "PasswordPolicyConfig::default_require_special")]
+    pub require_special: bool,
+}
+
+impl PasswordPolicyConfig {
+    fn default_bcrypt_cost() -> u32 {
+        12
+    }
+
+    fn default_min_length() -> usize {
+        0
+    }
+
+    fn default_require_digit() -> bool {
+        false
+    }
+
+    fn default_require_mixed_case() -> bool {
+        false
+    }
+
+    fn default_require_special() -> bool {
+        false
+    }
+}
+
+impl Default for PasswordPolicyConfig {
+    fn default() -> Self {
+        Self {
+            bcrypt_cost: Self::default_bcrypt_cost(),
+            min_length: Self::default_min_length(),
+            require_digit: Self::default_require_digit(),
+            require_mixed_case: Self::default_require_mixed_case(),
+            require_special: Self::default_require_special(),
+        }
+    }
+}
+
+impl CheckConfig for PasswordPolicyConfig {
+    fn check(&self, _: &super::Config) -> Option<CheckConfigResult> {
+        let config_name = Arc::new("security.password_policy".to_string());
+        let mut ret = CheckConfigResult::default();
+
+        // the range supported by bcrypt
+        if !(4..=31).contains(&self.bcrypt_cost) {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name,
+                item: "bcrypt_cost".to_string(),
+                message: "'bcrypt_cost' must be between 4 and 31".to_string(),
+            });
+        }
+
+        if ret.is_empty() {
+            None
+        } else {
+            Some(ret)
+        }
+    }
+}
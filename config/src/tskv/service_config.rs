@@ -22,6 +22,8 @@ pub struct ServiceConfig {
     pub enable_report: bool,
     #[serde(default = "ServiceConfig::default_jaeger_rpc_listen_port")]
     pub jaeger_rpc_listen_port: Option<u16>,
+    #[serde(default = "ServiceConfig::default_enable_web_ui")]
+    pub enable_web_ui: bool,
 }
 
 impl ServiceConfig {
@@ -52,6 +54,10 @@ impl ServiceConfig {
     fn default_jaeger_rpc_listen_port() -> Option<u16> {
         None
     }
+
+    fn default_enable_web_ui() -> bool {
+        false
+    }
 }
 
 impl Default for ServiceConfig {
@@ -64,6 +70,7 @@ impl Default for ServiceConfig {
             tcp_listen_port: ServiceConfig::default_tcp_listen_port(),
             enable_report: ServiceConfig::default_enable_report(),
             jaeger_rpc_listen_port: ServiceConfig::default_jaeger_rpc_listen_port(),
+            enable_web_ui: ServiceConfig::default_enable_web_ui(),
         }
     }
 }
@@ -98,10 +105,12 @@ impl CheckConfig for ServiceConfig {
         let config_name = Arc::new("service".to_string());
         let mut ret = CheckConfigResult::default();
 
+        // The host may not be resolvable until its DNS record is published,
+        // binding the listeners reports the addresses that are wrong.
         if let Some(port) = self.http_listen_port {
             let default_http_addr = format!("{}:{}", &config.global.host, port);
             if let Err(e) = default_http_addr.to_socket_addrs() {
-                ret.add_error(CheckConfigItemResult {
+                ret.add_warn(CheckConfigItemResult {
                     config: config_name.clone(),
                     item: default_http_addr,
                     message: format!("Cannot resolve 'http_listen_addr': {}", e),
@@ -112,7 +121,7 @@ impl CheckConfig for ServiceConfig {
         if let Some(port) = self.grpc_listen_port {
             let default_grpc_addr = format!("{}:{}", &config.global.host, port);
             if let Err(e) = default_grpc_addr.to_socket_addrs() {
-                ret.add_error(CheckConfigItemResult {
+                ret.add_warn(CheckConfigItemResult {
                     config: config_name.clone(),
                     item: default_grpc_addr,
                     message: format!("Cannot resolve 'grpc_listen_addr': {}", e),
@@ -123,7 +132,7 @@ impl CheckConfig for ServiceConfig {
         if let Some(port) = self.flight_rpc_listen_port {
             let default_flight_rpc_addr = format!("{}:{}", &config.global.host, port);
             if let Err(e) = default_flight_rpc_addr.to_socket_addrs() {
-                ret.add_error(CheckConfigItemResult {
+                ret.add_warn(CheckConfigItemResult {
                     config: config_name.clone(),
                     item: default_flight_rpc_addr,
                     message: format!("Cannot resolve 'flight_rpc_listen_addr': {}", e),
@@ -134,7 +143,7 @@ impl CheckConfig for ServiceConfig {
         if let Some(port) = self.tcp_listen_port {
             let default_tcp_addr = format!("{}:{}", &config.global.host, port);
             if let Err(e) = default_tcp_addr.to_socket_addrs() {
-                ret.add_error(CheckConfigItemResult {
+                ret.add_warn(CheckConfigItemResult {
                     config: config_name.clone(),
                     item: default_tcp_addr,
                     message: format!("Cannot resolve 'tcp_listen_addr': {}", e),
@@ -74,6 +74,33 @@ pub struct StorageConfig {
 
     #[serde(default = "StorageConfig::default_tsm_meta_compress")]
     pub tsm_meta_compress: String,
+
+    #[serde(default = "StorageConfig::default_max_read_ahead_column_groups")]
+    pub max_read_ahead_column_groups: usize,
+
+    /// The maximum number of the tsm files open at the same time on the
+    /// node, 0 for no limit.
+    #[serde(default = "Default::default")]
+    pub max_open_tsm_files: usize,
+
+    /// The directory the backups of the node are written into, the backup
+    /// requested by HTTP is a directory under it.
+    #[serde(default = "StorageConfig::default_backup_path")]
+    pub backup_path: String,
+
+    /// Compress the files of the backups by zstd.
+    #[serde(default = "Default::default")]
+    pub backup_compress: bool,
+
+    /// Encrypt the files of the backups by AES-256-GCM with the key in the
+    /// file, at most one of it and `backup_encryption_key_command` is set.
+    #[serde(default = "Default::default")]
+    pub backup_encryption_key_file: Option<String>,
+
+    /// Encrypt the files of the backups with the key printed by the command,
+    /// e.g. a command decrypting the key by a KMS.
+    #[serde(default = "Default::default")]
+    pub backup_encryption_key_command: Option<String>,
 }
 
 impl StorageConfig {
@@ -146,6 +173,15 @@ impl StorageConfig {
         "null".to_string()
     }
 
+    fn default_max_read_ahead_column_groups() -> usize {
+        4
+    }
+
+    fn default_backup_path() -> String {
+        let path = std::path::Path::new("/tmp/cnosdb/cnosdb_data").join("backup");
+        path.to_string_lossy().to_string()
+    }
+
     pub fn introspect(&mut self) {
         // Unit of storage.compact_trigger_cold_duration is seconds
         self.compact_trigger_cold_duration =
@@ -173,6 +209,12 @@ impl Default for StorageConfig {
             max_datablock_size: Self::default_max_datablock_size(),
             index_cache_capacity: Self::default_index_cache_capacity(),
             tsm_meta_compress: Self::default_tsm_meta_compress(),
+            max_read_ahead_column_groups: Self::default_max_read_ahead_column_groups(),
+            max_open_tsm_files: 0,
+            backup_path: Self::default_backup_path(),
+            backup_compress: false,
+            backup_encryption_key_file: None,
+            backup_encryption_key_command: None,
         }
     }
 }
@@ -189,6 +231,21 @@ impl CheckConfig for StorageConfig {
                 message: "'path' is empty".to_string(),
             });
         }
+        if self.backup_path.is_empty() {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "backup_path".to_string(),
+                message: "'backup_path' is empty".to_string(),
+            });
+        }
+        if self.backup_encryption_key_file.is_some() && self.backup_encryption_key_command.is_some()
+        {
+            ret.add_error(CheckConfigItemResult {
+                config: config_name.clone(),
+                item: "backup_encryption_key_file".to_string(),
+                message: "only one of 'backup_encryption_key_file' and 'backup_encryption_key_command' can be set".to_string(),
+            });
+        }
         if self.max_summary_size < 1024 {
             ret.add_warn(CheckConfigItemResult {
                 config: config_name.clone(),
@@ -234,15 +291,14 @@ impl CheckConfig for StorageConfig {
         }
 
         if self.tsm_meta_compress != "zstd"
-            || self.tsm_meta_compress != "snappy"
-            || self.tsm_meta_compress != "null"
+            && self.tsm_meta_compress != "snappy"
+            && self.tsm_meta_compress != "null"
         {
             ret.add_error(CheckConfigItemResult {
                 config: config_name,
-                item: "compress_tsm_meta_algo".to_string(),
-                message:
-                    "Only 'null', 'zstd' and 'snappy' is supported for 'compress_tsm_meta_algo'"
-                        .to_string(),
+                item: "tsm_meta_compress".to_string(),
+                message: "Only 'null', 'zstd' and 'snappy' is supported for 'tsm_meta_compress'"
+                    .to_string(),
             });
         }
 
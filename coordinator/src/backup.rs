@@ -0,0 +1,755 @@
+//! Backup of the data of a tenant, orchestrated by one node.
+//!
+//! Each replica set is backed up once, from the snapshot of one of its
+//! vnodes, the leader if it answers. The snapshot is released once its files
+//! are downloaded into the directory of the backup on the orchestrating
+//! node, a directory under the backup path of the node:
+//!
+//! ```text
+//! {dir}/manifest.json
+//! {dir}/{database}/meta.json
+//! {dir}/{database}/{replica set id}/snapshot.bin
+//! {dir}/{database}/{replica set id}/{files of the snapshot}
+//! ```
+//!
+//! The files except the manifest are compressed and encrypted as the
+//! backup files of the meta if configured, see
+//! [`meta::meta_cluster_command::backup`]. The manifest is written after
+//! all the files, a backup without the manifest is incomplete.
+//! [`verify_backup`] checks a backup against its manifest without restoring
+//! it.
+
+use std::path::{Component, Path, PathBuf};
+use std::sync::Arc;
+
+use config::tskv::StorageConfig;
+use meta::meta_cluster_command::backup::{self as codec, BackupOptions, EncryptionKey};
+use models::meta_data::{DatabaseInfo, ReplicationSet, VnodeInfo, VnodeStatus};
+use models::utils::now_timestamp_millis;
+use protos::kv_service::admin_command::Command::{CreateBackupSnapshot, ReleaseBackupSnapshot};
+use protos::kv_service::{AdminCommand, CreateBackupSnapshotRequest, ReleaseBackupSnapshotRequest};
+use serde::{Deserialize, Serialize};
+use snafu::ResultExt;
+use tracing::{info, warn};
+use tskv::tsm::reader::TsmReader;
+use tskv::VnodeSnapshot;
+
+use crate::errors::{
+    BincodeSerdeSnafu, CommonSnafu, CoordinatorError, CoordinatorResult, IOErrorsSnafu, MetaSnafu,
+};
+use crate::raft::{download_snapshot, FileChecksum};
+use crate::service::CoordService;
+use crate::Coordinator;
+
+pub const MANIFEST_FILE: &str = "manifest.json";
+pub const DATABASE_META_FILE: &str = "meta.json";
+pub const SNAPSHOT_FILE: &str = "snapshot.bin";
+/// Directory the encoded tsm files are decoded to while verified.
+const VERIFY_DIR: &str = ".verify";
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct BackupManifest {
+    pub tenant: String,
+    /// Milliseconds since the epoch the backup started.
+    pub created_at: i64,
+    /// The files are compressed by zstd.
+    #[serde(default)]
+    pub compressed: bool,
+    /// The files are encrypted by AES-256-GCM.
+    #[serde(default)]
+    pub encrypted: bool,
+    pub databases: Vec<DatabaseBackup>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct DatabaseBackup {
+    pub name: String,
+    pub replica_sets: Vec<ReplicaSetBackup>,
+}
+
+/// The snapshot of a replica set, taken from one of its vnodes.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ReplicaSetBackup {
+    pub bucket_id: u32,
+    pub start_time: i64,
+    pub end_time: i64,
+    pub replica_id: u32,
+    pub vnode_id: u32,
+    pub node_id: u64,
+    pub last_seq_no: u64,
+    /// Directory of the files, relative to the directory of the backup.
+    pub dir: PathBuf,
+    pub files: Vec<BackupFile>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct BackupFile {
+    /// Path relative to the directory of the replica set.
+    pub path: PathBuf,
+    pub size: u64,
+    pub crc: u32,
+}
+
+impl BackupManifest {
+    pub fn load(dir: &Path) -> CoordinatorResult<Self> {
+        let data = std::fs::read(dir.join(MANIFEST_FILE)).context(IOErrorsSnafu)?;
+        serde_json::from_slice(&data).map_err(|e| {
+            CommonSnafu {
+                msg: format!("invalid backup manifest: {}", e),
+            }
+            .build()
+        })
+    }
+
+    pub fn replica_sets(&self) -> usize {
+        self.databases.iter().map(|d| d.replica_sets.len()).sum()
+    }
+
+    pub fn is_encoded(&self) -> bool {
+        self.compressed || self.encrypted
+    }
+
+    pub fn files(&self) -> usize {
+        self.databases
+            .iter()
+            .flat_map(|d| d.replica_sets.iter())
+            .map(|r| r.files.len())
+            .sum()
+    }
+}
+
+/// The name of a backup is one component of a path, so that the backup is
+/// not written outside the backup path.
+pub fn check_backup_name(name: &str) -> CoordinatorResult<()> {
+    let mut components = Path::new(name).components();
+    match (components.next(), components.next()) {
+        (Some(Component::Normal(_)), None) => Ok(()),
+        _ => Err(CommonSnafu {
+            msg: format!("invalid backup name '{}', expect a directory name", name),
+        }
+        .build()),
+    }
+}
+
+/// The directory of the backup named `name` under `root`.
+pub fn backup_dir(root: &Path, name: &str) -> CoordinatorResult<PathBuf> {
+    check_backup_name(name)?;
+    Ok(root.join(name))
+}
+
+/// Backs up the databases of the tenant into `dir`, all the databases if
+/// `databases` is empty. Fails if a replica set has no vnode to snapshot.
+pub async fn backup_tenant(
+    coord: &CoordService,
+    tenant: &str,
+    databases: Vec<String>,
+    dir: &Path,
+) -> CoordinatorResult<BackupManifest> {
+    let options = Arc::new(backup_options(&coord.get_config().storage)?);
+    let meta_client =
+        coord
+            .tenant_meta(tenant)
+            .await
+            .ok_or_else(|| CoordinatorError::TenantNotFound {
+                name: tenant.to_string(),
+            })?;
+    let mut db_infos = vec![];
+    if databases.is_empty() {
+        let mut all = meta_client
+            .list_databases()
+            .context(MetaSnafu)?
+            .into_values()
+            .filter(|info| !info.schema.is_hidden())
+            .collect::<Vec<_>>();
+        all.sort_by(|a, b| a.schema.database_name().cmp(b.schema.database_name()));
+        db_infos = all;
+    } else {
+        for db in databases {
+            let info = meta_client
+                .get_db_info(&db)
+                .context(MetaSnafu)?
+                .ok_or_else(|| {
+                    CommonSnafu {
+                        msg: format!("database {} of tenant {} not found", db, tenant),
+                    }
+                    .build()
+                })?;
+            db_infos.push(info);
+        }
+    }
+
+    let manifest_path = dir.join(MANIFEST_FILE);
+    if manifest_path.exists() {
+        return Err(CommonSnafu {
+            msg: format!("backup already exists in {}", dir.display()),
+        }
+        .build());
+    }
+    tokio::fs::create_dir_all(dir)
+        .await
+        .context(IOErrorsSnafu)?;
+
+    let mut manifest = BackupManifest {
+        tenant: tenant.to_string(),
+        created_at: now_timestamp_millis(),
+        compressed: options.compress,
+        encrypted: options.key.is_some(),
+        databases: Vec::with_capacity(db_infos.len()),
+    };
+    for info in db_infos {
+        manifest
+            .databases
+            .push(backup_database(coord, tenant, &info, dir, &options).await?);
+    }
+
+    let data = serde_json::to_vec_pretty(&manifest).map_err(|e| {
+        CommonSnafu {
+            msg: format!("failed to encode backup manifest: {}", e),
+        }
+        .build()
+    })?;
+    tokio::fs::write(&manifest_path, data)
+        .await
+        .context(IOErrorsSnafu)?;
+    info!(
+        "backup of tenant {} to {} finished, {} replica sets, {} files",
+        tenant,
+        dir.display(),
+        manifest.replica_sets(),
+        manifest.files()
+    );
+
+    Ok(manifest)
+}
+
+fn backup_options(config: &StorageConfig) -> CoordinatorResult<BackupOptions> {
+    let key = EncryptionKey::from_options(
+        config.backup_encryption_key_file.as_deref(),
+        config.backup_encryption_key_command.as_deref(),
+    )
+    .map_err(|e| {
+        CommonSnafu {
+            msg: format!("invalid backup encryption key: {}", e),
+        }
+        .build()
+    })?;
+    Ok(BackupOptions {
+        compress: config.backup_compress,
+        key,
+    })
+}
+
+async fn backup_database(
+    coord: &CoordService,
+    tenant: &str,
+    info: &DatabaseInfo,
+    dir: &Path,
+    options: &Arc<BackupOptions>,
+) -> CoordinatorResult<DatabaseBackup> {
+    let name = info.schema.database_name().to_string();
+    let db_dir = dir.join(&name);
+    tokio::fs::create_dir_all(&db_dir)
+        .await
+        .context(IOErrorsSnafu)?;
+    let meta = serde_json::to_vec_pretty(info).map_err(|e| {
+        CommonSnafu {
+            msg: format!("failed to encode meta of database {}: {}", name, e),
+        }
+        .build()
+    })?;
+    write_backup_file(&db_dir.join(DATABASE_META_FILE), &meta, options).await?;
+
+    let mut replica_sets = vec![];
+    for bucket in info.buckets.iter() {
+        for replica in bucket.shard_group.iter() {
+            let relative_dir = PathBuf::from(&name).join(replica.id.to_string());
+            let (vnode, snapshot, files) =
+                backup_replica_set(coord, tenant, replica, &dir.join(&relative_dir), options)
+                    .await?;
+            replica_sets.push(ReplicaSetBackup {
+                bucket_id: bucket.id,
+                start_time: bucket.start_time,
+                end_time: bucket.end_time,
+                replica_id: replica.id,
+                vnode_id: vnode.id,
+                node_id: vnode.node_id,
+                last_seq_no: snapshot.last_seq_no,
+                dir: relative_dir,
+                files,
+            });
+        }
+    }
+
+    Ok(DatabaseBackup { name, replica_sets })
+}
+
+/// Snapshots a vnode of the replica set and downloads its files, tries the
+/// vnodes in the order of [`backup_candidates`].
+async fn backup_replica_set(
+    coord: &CoordService,
+    tenant: &str,
+    replica: &ReplicationSet,
+    dir: &Path,
+    options: &Arc<BackupOptions>,
+) -> CoordinatorResult<(VnodeInfo, VnodeSnapshot, Vec<BackupFile>)> {
+    let meta = coord.meta_manager();
+    let enable_gzip = coord.get_config().service.grpc_enable_gzip;
+    let mut errors = vec![];
+    for vnode in backup_candidates(replica) {
+        let cmd = AdminCommand {
+            tenant: tenant.to_string(),
+            command: Some(CreateBackupSnapshot(CreateBackupSnapshotRequest {
+                vnode_id: vnode.id,
+            })),
+        };
+        let res = async {
+            let data = coord.admin_command_on_node(vnode.node_id, cmd).await?;
+            let snapshot: VnodeSnapshot = bincode::deserialize(&data).context(BincodeSerdeSnafu)?;
+            let files = download_snapshot(&meta, enable_gzip, dir, &snapshot).await;
+            release_snapshot(coord, tenant, vnode, &snapshot).await;
+            Ok::<_, CoordinatorError>((snapshot, files?))
+        }
+        .await;
+        match res {
+            Ok((snapshot, files)) => {
+                let files = encode_backup_files(dir, files, options).await?;
+                let data = bincode::serialize(&snapshot).context(BincodeSerdeSnafu)?;
+                write_backup_file(&dir.join(SNAPSHOT_FILE), &data, options).await?;
+                info!(
+                    "backup replica set {} from vnode {} on node {}, last seq no: {}",
+                    replica.id, vnode.id, vnode.node_id, snapshot.last_seq_no
+                );
+                let files = files
+                    .into_iter()
+                    .map(|(path, checksum)| BackupFile {
+                        path,
+                        size: checksum.len,
+                        crc: checksum.crc,
+                    })
+                    .collect();
+                return Ok((vnode.clone(), snapshot, files));
+            }
+            Err(e) => {
+                warn!(
+                    "backup replica set {} from vnode {} on node {} failed: {}",
+                    replica.id, vnode.id, vnode.node_id, e
+                );
+                // the files of another vnode are not the same
+                let _ = tokio::fs::remove_dir_all(dir).await;
+                errors.push(format!("vnode {}: {}", vnode.id, e));
+            }
+        }
+    }
+
+    Err(CommonSnafu {
+        msg: format!(
+            "no vnode of replica set {} can be backed up: [{}]",
+            replica.id,
+            errors.join(", ")
+        ),
+    }
+    .build())
+}
+
+async fn write_backup_file(
+    path: &Path,
+    data: &[u8],
+    options: &BackupOptions,
+) -> CoordinatorResult<()> {
+    let data = codec::encode(data, options).map_err(|e| {
+        CommonSnafu {
+            msg: format!("failed to encode {}: {}", path.display(), e),
+        }
+        .build()
+    })?;
+    tokio::fs::write(path, data).await.context(IOErrorsSnafu)
+}
+
+/// Encodes the files downloaded in place, returns the checksums of the
+/// files encoded.
+async fn encode_backup_files(
+    dir: &Path,
+    files: Vec<(PathBuf, FileChecksum)>,
+    options: &Arc<BackupOptions>,
+) -> CoordinatorResult<Vec<(PathBuf, FileChecksum)>> {
+    if options.is_plain() {
+        return Ok(files);
+    }
+    let mut encoded = Vec::with_capacity(files.len());
+    for (path, _) in files {
+        let file_path = dir.join(&path);
+        let (encode_path, encode_options) = (file_path.clone(), options.clone());
+        tokio::task::spawn_blocking(move || {
+            codec::encode_file(&encode_path, &encode_options).map_err(|e| e.to_string())
+        })
+        .await
+        .map_err(|e| e.to_string())
+        .and_then(|res| res)
+        .map_err(|e| {
+            CommonSnafu {
+                msg: format!("failed to encode {}: {}", file_path.display(), e),
+            }
+            .build()
+        })?;
+        let checksum = FileChecksum::compute(&file_path, 0)
+            .await
+            .context(IOErrorsSnafu)?;
+        encoded.push((path, checksum));
+    }
+    Ok(encoded)
+}
+
+/// Releases the snapshot on its node, the snapshot not released expires
+/// after the snapshot holding time.
+async fn release_snapshot(
+    coord: &CoordService,
+    tenant: &str,
+    vnode: &VnodeInfo,
+    snapshot: &VnodeSnapshot,
+) {
+    let cmd = AdminCommand {
+        tenant: tenant.to_string(),
+        command: Some(ReleaseBackupSnapshot(ReleaseBackupSnapshotRequest {
+            vnode_id: vnode.id,
+            create_time: snapshot.create_time.clone(),
+        })),
+    };
+    if let Err(e) = coord.admin_command_on_node(vnode.node_id, cmd).await {
+        warn!(
+            "release backup snapshot of vnode {} on node {} failed: {}",
+            vnode.id, vnode.node_id, e
+        );
+    }
+}
+
+/// The result of [`verify_backup`], the backup can be restored if there
+/// are no problems.
+#[derive(Debug, Default)]
+pub struct BackupVerification {
+    pub databases: usize,
+    pub replica_sets: usize,
+    pub files: usize,
+    pub tsm_files: usize,
+    pub pages: usize,
+    pub problems: Vec<String>,
+}
+
+impl BackupVerification {
+    pub fn is_ok(&self) -> bool {
+        self.problems.is_empty()
+    }
+}
+
+/// Verifies the backup in `dir` without restoring it: all the files of the
+/// manifest exist with the size and the crc recorded, all the pages of the
+/// tsm files are valid, and the meta of the databases and the snapshots of
+/// the replica sets can be parsed. The files encrypted are decrypted by
+/// `key`. Fails only if the manifest can't be loaded, the other problems
+/// are collected in the result.
+pub async fn verify_backup(
+    dir: &Path,
+    key: Option<&EncryptionKey>,
+) -> CoordinatorResult<BackupVerification> {
+    let manifest = BackupManifest::load(dir)?;
+    let mut result = BackupVerification::default();
+    if manifest.encrypted && key.is_none() {
+        result
+            .problems
+            .push("backup is encrypted, but no encryption key is supplied".to_string());
+        return Ok(result);
+    }
+    for database in manifest.databases.iter() {
+        result.databases += 1;
+        let meta_path = dir.join(&database.name).join(DATABASE_META_FILE);
+        match read_backup_file(&meta_path, key) {
+            Ok(data) => match serde_json::from_slice::<DatabaseInfo>(&data) {
+                Ok(info) if info.schema.database_name() != database.name => {
+                    result.problems.push(format!(
+                        "{}: meta of database {}, expected {}",
+                        meta_path.display(),
+                        info.schema.database_name(),
+                        database.name
+                    ));
+                }
+                Ok(_) => {}
+                Err(e) => {
+                    result
+                        .problems
+                        .push(format!("{}: invalid meta: {}", meta_path.display(), e))
+                }
+            },
+            Err(e) => result
+                .problems
+                .push(format!("{}: {}", meta_path.display(), e)),
+        }
+
+        for replica_set in database.replica_sets.iter() {
+            result.replica_sets += 1;
+            let replica_dir = dir.join(&replica_set.dir);
+            verify_replica_set(&replica_dir, replica_set, &manifest, key, &mut result).await;
+        }
+    }
+
+    Ok(result)
+}
+
+fn read_backup_file(path: &Path, key: Option<&EncryptionKey>) -> Result<Vec<u8>, String> {
+    let data = std::fs::read(path).map_err(|e| e.to_string())?;
+    codec::decode(&data, key).map_err(|e| e.to_string())
+}
+
+async fn verify_replica_set(
+    dir: &Path,
+    replica_set: &ReplicaSetBackup,
+    manifest: &BackupManifest,
+    key: Option<&EncryptionKey>,
+    result: &mut BackupVerification,
+) {
+    let snapshot_path = dir.join(SNAPSHOT_FILE);
+    match read_backup_file(&snapshot_path, key) {
+        Ok(data) => match bincode::deserialize::<VnodeSnapshot>(&data) {
+            Ok(snapshot)
+                if snapshot.vnode_id != replica_set.vnode_id
+                    || snapshot.last_seq_no != replica_set.last_seq_no =>
+            {
+                result.problems.push(format!(
+                    "{}: snapshot of vnode {} at seq no {}, expected vnode {} at seq no {}",
+                    snapshot_path.display(),
+                    snapshot.vnode_id,
+                    snapshot.last_seq_no,
+                    replica_set.vnode_id,
+                    replica_set.last_seq_no
+                ));
+            }
+            Ok(_) => {}
+            Err(e) => result.problems.push(format!(
+                "{}: invalid snapshot: {}",
+                snapshot_path.display(),
+                e
+            )),
+        },
+        Err(e) => result
+            .problems
+            .push(format!("{}: {}", snapshot_path.display(), e)),
+    }
+
+    for file in replica_set.files.iter() {
+        result.files += 1;
+        let path = dir.join(&file.path);
+        match FileChecksum::compute(&path, 0).await {
+            Ok(checksum) if checksum.len != file.size || checksum.crc != file.crc => {
+                result.problems.push(format!(
+                    "{}: size {} crc {:08x}, expected size {} crc {:08x}",
+                    path.display(),
+                    checksum.len,
+                    checksum.crc,
+                    file.size,
+                    file.crc
+                ));
+                continue;
+            }
+            Ok(_) => {}
+            Err(e) => {
+                result.problems.push(format!("{}: {}", path.display(), e));
+                continue;
+            }
+        }
+
+        let is_tsm = matches!(
+            path.extension().and_then(|e| e.to_str()),
+            Some("tsm") | Some("delta")
+        );
+        if is_tsm {
+            result.tsm_files += 1;
+            // the tsm files encoded are verified by the copies decoded, of
+            // the same names
+            let decoded_dir = dir.join(VERIFY_DIR);
+            let tsm_path = if manifest.is_encoded() {
+                let decoded = decoded_dir.join(path.file_name().unwrap_or_default());
+                let res = std::fs::create_dir_all(&decoded_dir)
+                    .map_err(|e| e.to_string())
+                    .and_then(|_| {
+                        codec::decode_file(&path, &decoded, key).map_err(|e| e.to_string())
+                    });
+                if let Err(e) = res {
+                    result
+                        .problems
+                        .push(format!("{}: failed to decode: {}", path.display(), e));
+                    continue;
+                }
+                decoded
+            } else {
+                path.clone()
+            };
+            let pages = match TsmReader::open(&tsm_path).await {
+                Ok(reader) => reader.verify().await,
+                Err(e) => Err(e),
+            };
+            if manifest.is_encoded() {
+                let _ = std::fs::remove_file(&tsm_path);
+            }
+            match pages {
+                Ok(pages) => result.pages += pages,
+                Err(e) => {
+                    result
+                        .problems
+                        .push(format!("{}: invalid tsm file: {}", path.display(), e))
+                }
+            }
+        }
+    }
+    if manifest.is_encoded() {
+        let _ = std::fs::remove_dir_all(dir.join(VERIFY_DIR));
+    }
+}
+
+/// The vnodes of the replica set to back up from, the leader first, the
+/// vnodes copying or broken are skipped.
+pub fn backup_candidates(replica: &ReplicationSet) -> Vec<&VnodeInfo> {
+    let mut vnodes = replica
+        .vnodes
+        .iter()
+        .filter(|v| matches!(v.status, VnodeStatus::Running | VnodeStatus::Frozen))
+        .collect::<Vec<_>>();
+    vnodes.sort_by_key(|v| v.id != replica.leader_vnode_id);
+    vnodes
+}
+
+#[cfg(test)]
+mod test {
+    use std::path::{Path, PathBuf};
+
+    use models::meta_data::{ReplicationSet, VnodeInfo, VnodeStatus};
+
+    use super::{
+        backup_candidates, backup_dir, verify_backup, BackupFile, BackupManifest, DatabaseBackup,
+        ReplicaSetBackup, MANIFEST_FILE,
+    };
+
+    #[test]
+    fn test_backup_candidates() {
+        let mut vnodes = vec![
+            VnodeInfo::new(1, 1),
+            VnodeInfo::new(2, 2),
+            VnodeInfo::new(3, 3),
+        ];
+        vnodes[0].status = VnodeStatus::Broken;
+        let replica = ReplicationSet::new(10, 3, 3, vnodes);
+        let ids = backup_candidates(&replica)
+            .iter()
+            .map(|v| v.id)
+            .collect::<Vec<_>>();
+        assert_eq!(ids, vec![3, 2]);
+    }
+
+    #[test]
+    fn test_backup_dir() {
+        let root = Path::new("/backup");
+        assert_eq!(backup_dir(root, "b1").unwrap(), PathBuf::from("/backup/b1"));
+        for name in ["", ".", "..", "../b1", "/tmp/b1", "a/b"] {
+            assert!(backup_dir(root, name).is_err(), "{}", name);
+        }
+    }
+
+    #[test]
+    fn test_manifest_serde() {
+        let manifest = BackupManifest {
+            tenant: "cnosdb".to_string(),
+            created_at: 1_700_000_000_000,
+            compressed: false,
+            encrypted: false,
+            databases: vec![DatabaseBackup {
+                name: "db1".to_string(),
+                replica_sets: vec![ReplicaSetBackup {
+                    bucket_id: 1,
+                    start_time: 0,
+                    end_time: 100,
+                    replica_id: 10,
+                    vnode_id: 3,
+                    node_id: 3,
+                    last_seq_no: 42,
+                    dir: PathBuf::from("db1/10"),
+                    files: vec![BackupFile {
+                        path: PathBuf::from("tsm/_000001.tsm"),
+                        size: 1024,
+                        crc: 0xdead_beef,
+                    }],
+                }],
+            }],
+        };
+        let data = serde_json::to_vec(&manifest).unwrap();
+        let decoded: BackupManifest = serde_json::from_slice(&data).unwrap();
+        assert_eq!(decoded, manifest);
+        assert_eq!(decoded.replica_sets(), 1);
+        assert_eq!(decoded.files(), 1);
+    }
+
+    #[tokio::test]
+    async fn test_verify_backup() {
+        let dir = PathBuf::from("/tmp/test/backup/verify_backup");
+        let _ = std::fs::remove_dir_all(&dir);
+        assert!(verify_backup(&dir, None).await.is_err());
+
+        let data = b"not a tsm file";
+        std::fs::create_dir_all(dir.join("db1/10")).unwrap();
+        std::fs::write(dir.join("db1/10/data.bin"), data).unwrap();
+        let manifest = BackupManifest {
+            tenant: "cnosdb".to_string(),
+            created_at: 0,
+            compressed: false,
+            encrypted: false,
+            databases: vec![DatabaseBackup {
+                name: "db1".to_string(),
+                replica_sets: vec![ReplicaSetBackup {
+                    bucket_id: 1,
+                    start_time: 0,
+                    end_time: 100,
+                    replica_id: 10,
+                    vnode_id: 3,
+                    node_id: 3,
+                    last_seq_no: 42,
+                    dir: PathBuf::from("db1/10"),
+                    files: vec![
+                        BackupFile {
+                            path: PathBuf::from("data.bin"),
+                            size: data.len() as u64,
+                            crc: crc32fast::hash(data),
+                        },
+                        BackupFile {
+                            path: PathBuf::from("missing.bin"),
+                            size: 1,
+                            crc: 0,
+                        },
+                    ],
+                }],
+            }],
+        };
+        std::fs::write(
+            dir.join(MANIFEST_FILE),
+            serde_json::to_vec(&manifest).unwrap(),
+        )
+        .unwrap();
+
+        let result = verify_backup(&dir, None).await.unwrap();
+        assert_eq!(result.replica_sets, 1);
+        assert_eq!(result.files, 2);
+        assert_eq!(result.tsm_files, 0);
+        // the meta, the snapshot and the missing file
+        assert_eq!(result.problems.len(), 3, "{:?}", result.problems);
+        assert!(!result.is_ok());
+
+        // an encrypted backup can't be verified without the key
+        let manifest = BackupManifest {
+            encrypted: true,
+            ..manifest
+        };
+        std::fs::write(
+            dir.join(MANIFEST_FILE),
+            serde_json::to_vec(&manifest).unwrap(),
+        )
+        .unwrap();
+        let result = verify_backup(&dir, None).await.unwrap();
+        assert_eq!(result.files, 0);
+        assert_eq!(result.problems.len(), 1, "{:?}", result.problems);
+    }
+}
@@ -0,0 +1,413 @@
+//! Keep a log of the writes of the selected databases, so that a consumer
+//! can tail the writes from a checkpoint, e.g. a CDC pipeline.
+//!
+//! The writes of a database are appended to a [`DurableQueue`] in
+//! `<path>/<tenant>/<db>` when the vnodes of the node apply them, the
+//! checkpoint of a change is its position in the queue. The oldest segments
+//! are removed if the log is larger than `max_size`, a consumer resuming
+//! from a removed checkpoint gets an error instead of missing the writes
+//! silently. A write is logged before it is applied and fails if it is not
+//! logged, for the client to retry it, so the feed never misses a write
+//! applied.
+//!
+//! The changes of a replication set are logged in the order of its raft
+//! log, each change has the id of the replication set and the index of the
+//! write in the raft log. Every replica logs the writes it applies, a
+//! consumer tails the nodes of the replication sets and skips the changes
+//! whose index is not after the last one it read of the replication set,
+//! including a write logged again by the retry of its failed apply. The
+//! points copied by splitting a bucket are not logged again, they were
+//! logged when written first.
+
+use std::collections::HashMap;
+use std::io;
+use std::path::Path;
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+
+use config::tskv::ChangeFeedConfig;
+use models::meta_data::ReplicationSetId;
+use models::utils::now_timestamp_millis;
+use protocol_parser::line_protocol::points_to_line_protocol;
+use serde::{Deserialize, Serialize};
+use snafu::{ResultExt, Snafu};
+use tokio::sync::Notify;
+use utils::precision::Precision;
+
+use crate::mirror::queue::{DurableQueue, Position, QueueReader};
+
+#[derive(Debug, Snafu)]
+#[snafu(visibility(pub))]
+pub enum ChangeFeedError {
+    #[snafu(display("writes of {}.{} are not logged", tenant, db))]
+    NotLogged { tenant: String, db: String },
+
+    #[snafu(display("invalid checkpoint: {}", reason))]
+    InvalidCheckpoint { reason: String },
+
+    #[snafu(display(
+        "checkpoint {} is removed, the oldest checkpoint is {}",
+        checkpoint,
+        oldest
+    ))]
+    CheckpointExpired { checkpoint: String, oldest: String },
+
+    #[snafu(display("change log io error: {}", source))]
+    ChangeLogIo { source: io::Error },
+}
+
+pub type ChangeFeedResult<T> = Result<T, ChangeFeedError>;
+
+#[derive(Debug, Serialize, Deserialize)]
+struct ChangeRecord {
+    /// Unix milliseconds the write was applied.
+    time: i64,
+    replica_id: ReplicationSetId,
+    index: u64,
+    precision: Precision,
+    /// The flatbuffers points written.
+    points: Vec<u8>,
+}
+
+/// A write read from the log.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Change {
+    /// Checkpoint to resume from after this change.
+    pub checkpoint: String,
+    pub time: i64,
+    /// Id of the replication set written.
+    pub replica_id: ReplicationSetId,
+    /// Index of the write in the raft log of the replication set.
+    pub index: u64,
+    pub precision: String,
+    /// Line protocol of the points written.
+    pub lines: String,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Changes {
+    /// Checkpoint to resume from after these changes.
+    pub checkpoint: String,
+    pub changes: Vec<Change>,
+}
+
+struct ChangeLog {
+    queue: DurableQueue,
+    notify: Notify,
+}
+
+impl ChangeLog {
+    fn push(&self, data: &[u8]) -> io::Result<()> {
+        loop {
+            if self.queue.push(data)? {
+                self.notify.notify_waiters();
+                return Ok(());
+            }
+            // the log is full, remove the oldest segment
+            let oldest = self.queue.acked();
+            if oldest.segment >= self.queue.end().segment {
+                return Err(io::Error::new(
+                    io::ErrorKind::InvalidInput,
+                    format!("write of {} bytes is larger than the log", data.len()),
+                ));
+            }
+            self.queue.ack(Position {
+                segment: oldest.segment + 1,
+                offset: 0,
+            })?;
+        }
+    }
+
+    fn read(&self, position: Position, limit: usize) -> ChangeFeedResult<Changes> {
+        let oldest = self.queue.acked();
+        if position < oldest {
+            return Err(ChangeFeedError::CheckpointExpired {
+                checkpoint: position.to_string(),
+                oldest: oldest.to_string(),
+            });
+        }
+        if position > self.queue.end() {
+            return Err(ChangeFeedError::InvalidCheckpoint {
+                reason: format!("{} is after the last change", position),
+            });
+        }
+
+        let mut reader = QueueReader::at(position);
+        let mut changes = vec![];
+        while changes.len() < limit {
+            let data = match reader.next(&self.queue) {
+                Ok(Some(data)) => data,
+                Ok(None) => break,
+                // the segment is removed while reading
+                Err(e) if e.kind() == io::ErrorKind::NotFound => {
+                    return Err(ChangeFeedError::CheckpointExpired {
+                        checkpoint: position.to_string(),
+                        oldest: self.queue.acked().to_string(),
+                    })
+                }
+                Err(e) => return Err(ChangeFeedError::ChangeLogIo { source: e }),
+            };
+            let record = bincode::deserialize::<ChangeRecord>(&data)
+                .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+                .context(ChangeLogIoSnafu)?;
+            let mut lines = vec![];
+            points_to_line_protocol(&record.points, &mut lines)
+                .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e.to_string()))
+                .context(ChangeLogIoSnafu)?;
+            changes.push(Change {
+                checkpoint: reader.position().to_string(),
+                time: record.time,
+                replica_id: record.replica_id,
+                index: record.index,
+                precision: record.precision.to_string(),
+                lines: String::from_utf8_lossy(&lines).to_string(),
+            });
+        }
+
+        Ok(Changes {
+            checkpoint: reader.position().to_string(),
+            changes,
+        })
+    }
+}
+
+pub struct ChangeFeed {
+    config: ChangeFeedConfig,
+    logs: Mutex<HashMap<(String, String), Arc<ChangeLog>>>,
+}
+
+impl ChangeFeed {
+    pub fn new(config: ChangeFeedConfig) -> Arc<Self> {
+        Arc::new(Self {
+            config,
+            logs: Mutex::new(HashMap::new()),
+        })
+    }
+
+    pub fn logs(&self, tenant: &str, db: &str) -> bool {
+        self.config.logs(tenant, db)
+    }
+
+    fn log(&self, tenant: &str, db: &str) -> ChangeFeedResult<Arc<ChangeLog>> {
+        if !self.logs(tenant, db) {
+            return Err(ChangeFeedError::NotLogged {
+                tenant: tenant.to_string(),
+                db: db.to_string(),
+            });
+        }
+
+        let mut logs = self.logs.lock().unwrap();
+        let key = (tenant.to_string(), db.to_string());
+        if let Some(log) = logs.get(&key) {
+            return Ok(log.clone());
+        }
+        let queue = DurableQueue::open(
+            Path::new(&self.config.path).join(tenant).join(db),
+            self.config.max_size,
+            self.config.max_segment_size,
+        )
+        .context(ChangeLogIoSnafu)?;
+        let log = Arc::new(ChangeLog {
+            queue,
+            notify: Notify::new(),
+        });
+        logs.insert(key, log.clone());
+        Ok(log)
+    }
+
+    /// Append the points of the write at `index` of the raft log of the
+    /// replication set, called after a vnode applied the write.
+    pub async fn push(
+        self: &Arc<Self>,
+        tenant: &str,
+        db: &str,
+        replica_id: ReplicationSetId,
+        index: u64,
+        precision: Precision,
+        points: Vec<u8>,
+    ) -> ChangeFeedResult<()> {
+        let record = ChangeRecord {
+            time: now_timestamp_millis(),
+            replica_id,
+            index,
+            precision,
+            points,
+        };
+        let data = bincode::serialize(&record)
+            .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+            .context(ChangeLogIoSnafu)?;
+        let log = self.open_log(tenant, db).await?;
+        blocking(move || log.push(&data))
+            .await
+            .context(ChangeLogIoSnafu)
+    }
+
+    async fn open_log(
+        self: &Arc<Self>,
+        tenant: &str,
+        db: &str,
+    ) -> ChangeFeedResult<Arc<ChangeLog>> {
+        let feed = self.clone();
+        let (tenant, db) = (tenant.to_string(), db.to_string());
+        blocking(move || feed.log(&tenant, &db)).await
+    }
+
+    /// Read at most `limit` changes after `checkpoint`, from the oldest
+    /// change if it is `None`. Waits at most `wait` for new changes if
+    /// there is none.
+    pub async fn read(
+        self: &Arc<Self>,
+        tenant: &str,
+        db: &str,
+        checkpoint: Option<&str>,
+        limit: usize,
+        wait: Duration,
+    ) -> ChangeFeedResult<Changes> {
+        let log = self.open_log(tenant, db).await?;
+        let position = match checkpoint {
+            Some(checkpoint) => checkpoint
+                .parse::<Position>()
+                .map_err(|reason| ChangeFeedError::InvalidCheckpoint { reason })?,
+            None => log.queue.acked(),
+        };
+
+        // register before reading, not to miss the changes pushed between
+        let notified = log.notify.notified();
+        let changes = Self::read_log(&log, position, limit).await?;
+        if !changes.changes.is_empty() || wait.is_zero() {
+            return Ok(changes);
+        }
+        if tokio::time::timeout(wait, notified).await.is_err() {
+            return Ok(changes);
+        }
+        Self::read_log(&log, position, limit).await
+    }
+
+    async fn read_log(
+        log: &Arc<ChangeLog>,
+        position: Position,
+        limit: usize,
+    ) -> ChangeFeedResult<Changes> {
+        let log = log.clone();
+        blocking(move || log.read(position, limit)).await
+    }
+}
+
+/// Run the blocking file IO of the logs by a blocking thread.
+async fn blocking<T: Send + 'static>(f: impl FnOnce() -> T + Send + 'static) -> T {
+    match tokio::task::spawn_blocking(f).await {
+        Ok(res) => res,
+        Err(e) => std::panic::resume_unwind(e.into_panic()),
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use config::tskv::ChangeFeedConfig;
+    use protocol_parser::line_protocol::line_protocol_to_lines;
+    use protocol_parser::lines_convert::{line_to_batches, mutable_batches_to_point};
+    use utils::precision::Precision;
+
+    use super::{ChangeFeed, ChangeFeedError};
+
+    fn points(data: &str) -> Vec<u8> {
+        let lines = line_protocol_to_lines(data, 0).unwrap();
+        let batches = line_to_batches(&lines).unwrap();
+        mutable_batches_to_point("db1", batches)
+    }
+
+    #[tokio::test]
+    async fn test_change_feed() {
+        let path = "/tmp/test/coordinator/change_feed";
+        let _ = std::fs::remove_dir_all(path);
+        let feed = ChangeFeed::new(ChangeFeedConfig {
+            enabled: true,
+            path: path.to_string(),
+            max_size: 2048,
+            max_segment_size: 512,
+            tenant: "cnosdb".to_string(),
+            databases: vec!["db1".to_string()],
+        });
+        assert!(matches!(
+            feed.push("cnosdb", "db2", 1, 1, Precision::NS, points("m f=1 1"))
+                .await,
+            Err(ChangeFeedError::NotLogged { .. })
+        ));
+
+        let changes = feed
+            .read("cnosdb", "db1", None, 10, Duration::ZERO)
+            .await
+            .unwrap();
+        assert!(changes.changes.is_empty());
+        let start = changes.checkpoint;
+
+        for i in 0..3 {
+            let points = points(&format!("m f={}i {}", i, i));
+            feed.push("cnosdb", "db1", 1, i, Precision::NS, points)
+                .await
+                .unwrap();
+        }
+        let changes = feed
+            .read("cnosdb", "db1", Some(&start), 2, Duration::ZERO)
+            .await
+            .unwrap();
+        assert_eq!(changes.changes.len(), 2);
+        assert_eq!(changes.changes[0].lines, "m f=0i 0\n");
+        assert_eq!(changes.changes[1].lines, "m f=1i 1\n");
+        assert_eq!(changes.changes[1].replica_id, 1);
+        assert_eq!(changes.changes[1].index, 1);
+        assert_eq!(changes.checkpoint, changes.changes[1].checkpoint);
+
+        // resume from the checkpoint
+        let changes = feed
+            .read(
+                "cnosdb",
+                "db1",
+                Some(&changes.checkpoint),
+                10,
+                Duration::ZERO,
+            )
+            .await
+            .unwrap();
+        assert_eq!(changes.changes.len(), 1);
+        assert_eq!(changes.changes[0].lines, "m f=2i 2\n");
+
+        // wait for the next change
+        let checkpoint = changes.checkpoint;
+        let read = feed.read(
+            "cnosdb",
+            "db1",
+            Some(&checkpoint),
+            10,
+            Duration::from_secs(10),
+        );
+        let push = async {
+            tokio::time::sleep(Duration::from_millis(100)).await;
+            feed.push("cnosdb", "db1", 1, 3, Precision::NS, points("m f=3i 3"))
+                .await
+                .unwrap();
+        };
+        let (changes, _) = tokio::join!(read, push);
+        assert_eq!(changes.unwrap().changes[0].lines, "m f=3i 3\n");
+
+        // the oldest changes are removed once the log is full
+        for i in 4..20 {
+            let points = points(&format!("m f={}i {}", i, i));
+            feed.push("cnosdb", "db1", 1, i, Precision::NS, points)
+                .await
+                .unwrap();
+        }
+        assert!(matches!(
+            feed.read("cnosdb", "db1", Some(&start), 10, Duration::ZERO)
+                .await,
+            Err(ChangeFeedError::CheckpointExpired { .. })
+        ));
+        let changes = feed
+            .read("cnosdb", "db1", None, 100, Duration::ZERO)
+            .await
+            .unwrap();
+        assert_eq!(changes.changes.last().unwrap().lines, "m f=19i 19\n");
+    }
+}
@@ -0,0 +1,162 @@
+//! Watches the usage of the disks of the data and the wal, the node turns
+//! read-only while any of them is nearly full, since a full disk may leave
+//! the wal and the tsm files partially written.
+//!
+//! The writes proposed to the raft nodes on this node are rejected, and the
+//! followers on this node reject the entries and the snapshots of their
+//! leaders, which retry them until the node is writable again.
+
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Arc, Mutex};
+
+use config::tskv::{Config, DiskWatchdogConfig};
+use metrics::gauge::U64Gauge;
+use metrics::label::Labels;
+use metrics::metric_register::MetricsRegister;
+use models::meta_data::get_disk_space;
+use replication::AppendGuard;
+use trace::{error, info, warn};
+
+use crate::errors::{CoordinatorError, CoordinatorResult};
+
+pub struct DiskWatchdog {
+    config: DiskWatchdogConfig,
+    paths: Vec<String>,
+    read_only: AtomicBool,
+    /// The disk turned the node read-only and its usage in percent.
+    full_disk: Mutex<Option<(String, u64)>>,
+
+    read_only_gauge: U64Gauge,
+    usage_gauges: Vec<U64Gauge>,
+}
+
+impl DiskWatchdog {
+    pub fn new(config: &Config, register: &MetricsRegister) -> Self {
+        let mut paths = vec![config.storage.path.clone()];
+        if config.wal.path != config.storage.path {
+            paths.push(config.wal.path.clone());
+        }
+        let usage_gauges = paths
+            .iter()
+            .map(|path| {
+                register
+                    .metric::<U64Gauge>("disk_usage_percent", "usage of the disk in percent")
+                    .recorder([("path", path.as_str())])
+            })
+            .collect();
+        Self {
+            config: config.disk_watchdog.clone(),
+            paths,
+            read_only: AtomicBool::new(false),
+            full_disk: Mutex::new(None),
+            read_only_gauge: register
+                .metric::<U64Gauge>("disk_read_only", "whether the node rejects the writes")
+                .recorder(Labels::default()),
+            usage_gauges,
+        }
+    }
+
+    pub fn is_read_only(&self) -> bool {
+        self.read_only.load(Ordering::Acquire)
+    }
+
+    pub fn check_writable(&self) -> CoordinatorResult<()> {
+        if !self.is_read_only() {
+            return Ok(());
+        }
+        let (path, usage) = self.full_disk.lock().unwrap().clone().unwrap_or_default();
+        Err(CoordinatorError::DiskFull { path, usage })
+    }
+
+    pub async fn run(self: Arc<Self>) {
+        let mut intv = tokio::time::interval(self.config.interval);
+        loop {
+            intv.tick().await;
+            let mut usages = Vec::with_capacity(self.paths.len());
+            for (path, gauge) in self.paths.iter().zip(self.usage_gauges.iter()) {
+                match get_disk_space(path) {
+                    Ok((total, available)) if total > 0 => {
+                        let usage = (total - available.min(total)) * 100 / total;
+                        gauge.set(usage);
+                        usages.push((path.clone(), usage));
+                    }
+                    Ok(_) => {}
+                    Err(e) => warn!("Failed to get disk space of '{}': {}", path, e),
+                }
+            }
+            self.update(&usages);
+        }
+    }
+
+    /// Turns the node read-only if any disk is used more than
+    /// `read_only_usage`, and back if all of them are used less than
+    /// `resume_usage`.
+    fn update(&self, usages: &[(String, u64)]) {
+        let fullest = match usages.iter().max_by_key(|(_, usage)| *usage) {
+            Some(fullest) => fullest,
+            None => return,
+        };
+        if !self.is_read_only() {
+            if fullest.1 >= self.config.read_only_usage {
+                error!(
+                    "Disk of '{}' is {}% used, not less than {}%, the node rejects the writes \
+                     until it's used less than {}%",
+                    fullest.0, fullest.1, self.config.read_only_usage, self.config.resume_usage
+                );
+                *self.full_disk.lock().unwrap() = Some(fullest.clone());
+                self.read_only.store(true, Ordering::Release);
+                self.read_only_gauge.set(1);
+            }
+        } else if fullest.1 < self.config.resume_usage {
+            info!(
+                "Disk of '{}' is {}% used, the node accepts the writes again",
+                fullest.0, fullest.1
+            );
+            self.read_only.store(false, Ordering::Release);
+            *self.full_disk.lock().unwrap() = None;
+            self.read_only_gauge.set(0);
+        } else {
+            *self.full_disk.lock().unwrap() = Some(fullest.clone());
+        }
+    }
+}
+
+impl AppendGuard for DiskWatchdog {
+    fn check_append(&self) -> Result<(), String> {
+        self.check_writable().map_err(|e| e.to_string())
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use config::tskv::Config;
+    use metrics::metric_register::MetricsRegister;
+    use replication::AppendGuard;
+
+    use super::DiskWatchdog;
+
+    #[test]
+    fn test_update() {
+        let config = Config::default();
+        let watchdog = DiskWatchdog::new(&config, &MetricsRegister::default());
+        let usages =
+            |data: u64, wal: u64| vec![("data".to_string(), data), ("wal".to_string(), wal)];
+
+        watchdog.update(&usages(80, 94));
+        assert!(watchdog.check_writable().is_ok());
+
+        watchdog.update(&usages(80, 95));
+        assert!(watchdog.is_read_only());
+        let err = watchdog.check_writable().unwrap_err().to_string();
+        assert!(err.contains("wal"), "{}", err);
+        // the followers reject the entries of their leaders
+        assert!(watchdog.check_append().is_err());
+
+        // stays read-only until all the disks are used less than resume_usage
+        watchdog.update(&usages(90, 85));
+        assert!(watchdog.is_read_only());
+        watchdog.update(&usages(89, 85));
+        assert!(!watchdog.is_read_only());
+        assert!(watchdog.check_writable().is_ok());
+    }
+}
@@ -6,7 +6,7 @@ use datafusion::error::DataFusionError;
 use flatbuffers::InvalidFlatbuffer;
 use meta::error::MetaError;
 use models::error_code::{ErrorCode, ErrorCoder};
-use models::meta_data::{ReplicationSet, ReplicationSetId, VnodeId};
+use models::meta_data::{NodeId, ReplicationSet, ReplicationSetId, VnodeId};
 use models::Timestamp;
 use protos::PointsError;
 use replication::errors::ReplicationError;
@@ -295,6 +295,60 @@ pub enum CoordinatorError {
     ReplicaCannotRemove {
         replica_id: ReplicationSetId,
     },
+
+    #[snafu(display(
+        "Database '{}' exceeded quota '{}', usage: {}, limit: {}",
+        database,
+        quota,
+        usage,
+        limit
+    ))]
+    #[error_code(code = 38)]
+    DatabaseQuotaExceeded {
+        database: String,
+        quota: String,
+        usage: u64,
+        limit: u64,
+    },
+
+    #[snafu(display(
+        "Timestamp {} is out of the range [{}, {}] allowed to write into database '{}'",
+        ts,
+        min,
+        max,
+        database
+    ))]
+    #[error_code(code = 39)]
+    TimestampOutOfRange {
+        database: String,
+        ts: i64,
+        min: i64,
+        max: i64,
+    },
+
+    #[snafu(display("ReplicationSet({}) is frozen, writes are rejected", id))]
+    #[error_code(code = 40)]
+    ReplicaFrozen {
+        id: u32,
+    },
+
+    #[snafu(display(
+        "No data node available to take over ReplicationSet({}) from node {}",
+        replica_id,
+        node_id
+    ))]
+    #[error_code(code = 41)]
+    NoNodeForReplica {
+        replica_id: ReplicationSetId,
+        node_id: NodeId,
+    },
+
+    #[snafu(display("Disk of '{}' is {}% used, the node is read-only", path, usage))]
+    #[error_code(code = 42)]
+    DiskFull {
+        path: String,
+        usage: u64,
+    },
 }
 
 impl From<ArrowError> for CoordinatorError {
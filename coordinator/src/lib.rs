@@ -1,5 +1,6 @@
 #![recursion_limit = "256"]
 
+use std::collections::HashMap;
 use std::fmt::Debug;
 use std::pin::Pin;
 use std::sync::atomic::AtomicUsize;
@@ -10,8 +11,11 @@ use datafusion::arrow::record_batch::RecordBatch;
 use errors::CoordinatorError;
 use futures::Stream;
 use meta::model::{MetaClientRef, MetaRef};
+use metrics::rate::MetricRate;
+use models::consistency_level::WriteToken;
 use models::meta_data::{
-    NodeId, ReplicaAllInfo, ReplicationSet, ReplicationSetId, VnodeAllInfo, VnodeId,
+    NodeId, ReplicaAllInfo, ReplicationSet, ReplicationSetId, VnodeAllInfo, VnodeId, VnodeInfo,
+    VnodeSummary,
 };
 use models::object_reference::ResolvedTable;
 use models::predicate::domain::{ResolvedPredicate, ResolvedPredicateRef};
@@ -20,17 +24,27 @@ use protocol_parser::Line;
 use protos::kv_service::{RaftWriteCommand, UpdateSetValue};
 use raft::manager::RaftNodesManager;
 use raft::writer::TskvRaftWriter;
+use replication::CommittedLog;
 use snafu::ResultExt;
 use trace::SpanContext;
 use tskv::reader::QueryOption;
 use tskv::EngineRef;
 use utils::precision::Precision;
+use utils::HyperLogLog;
 
+use crate::backup::BackupManifest;
+use crate::change_feed::ChangeFeed;
+use crate::disk_watchdog::DiskWatchdog;
 use crate::errors::{CoordinatorResult, MetaSnafu};
 use crate::service::CoordServiceMetrics;
 
+pub mod backup;
+pub mod change_feed;
+pub mod disk_watchdog;
 pub mod errors;
+pub mod materialized_view;
 pub mod metrics;
+pub mod mirror;
 pub mod raft;
 pub mod reader;
 pub mod resource_manager;
@@ -41,6 +55,16 @@ pub mod tskv_executor;
 pub type SendableCoordinatorRecordBatchStream =
     Pin<Box<dyn Stream<Item = CoordinatorResult<RecordBatch>> + Send>>;
 
+/// The sketches of the series of the tables merged from the vnodes of the
+/// replication sets.
+#[derive(Debug, Default)]
+pub struct SeriesSketches {
+    pub sketches: HashMap<String, HyperLogLog>,
+    /// The replication sets none of whose vnodes are fetched, the series
+    /// stored only by them are not counted.
+    pub missing_replicas: Vec<ReplicationSetId>,
+}
+
 #[derive(Debug, Clone)]
 pub enum ReplicationCmdType {
     /// replica set id, dst nod id
@@ -51,6 +75,10 @@ pub enum ReplicationCmdType {
     DestoryRaftGroup(u32),
     /// replica set id, new leader vnode id
     PromoteLeader(u32, u32),
+    /// replica set id, freeze(true) or unfreeze(false)
+    FreezeReplica(u32, bool),
+    /// vnode id. quarantine the follower's files and resync it from the leader
+    RebuildRaftNode(u32),
 }
 
 #[async_trait::async_trait]
@@ -59,6 +87,7 @@ pub trait Coordinator: Send + Sync {
     fn meta_manager(&self) -> MetaRef;
     fn store_engine(&self) -> Option<EngineRef>;
     fn raft_manager(&self) -> Arc<RaftNodesManager>;
+    fn disk_watchdog(&self) -> Arc<DiskWatchdog>;
     async fn tenant_meta(&self, tenant: &str) -> Option<MetaClientRef>;
 
     fn tskv_raft_writer(&self, request: RaftWriteCommand) -> TskvRaftWriter;
@@ -86,6 +115,17 @@ pub trait Coordinator: Send + Sync {
         span_ctx: Option<&SpanContext>,
     ) -> CoordinatorResult<usize>;
 
+    /// Same as `write_lines`, also returns the token to read the written
+    /// points back with the read-your-writes consistency.
+    async fn write_lines_with_token<'a>(
+        &self,
+        tenant: &str,
+        db: &str,
+        precision: Precision,
+        lines: Vec<Line<'a>>,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<(usize, WriteToken)>;
+
     async fn write_record_batch<'a>(
         &self,
         table_schema: TskvTableSchemaRef,
@@ -94,6 +134,17 @@ pub trait Coordinator: Send + Sync {
         span_ctx: Option<&SpanContext>,
     ) -> CoordinatorResult<usize>;
 
+    /// Same as `write_record_batch` without the limits of the writes of the
+    /// users, the time range to write, the quotas and the rate limits, to
+    /// move the data already written inside the cluster.
+    async fn write_record_batch_internal<'a>(
+        &self,
+        table_schema: TskvTableSchemaRef,
+        record_batch: RecordBatch,
+        db_precision: Precision,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<usize>;
+
     fn table_scan(
         &self,
         option: QueryOption,
@@ -121,6 +172,15 @@ pub trait Coordinator: Send + Sync {
         cmd_type: ReplicationCmdType,
     ) -> CoordinatorResult<()>;
 
+    /// Move every vnode off the data node, to `replacement` if given or
+    /// to other healthy nodes otherwise, then remove the node from meta.
+    /// The vnodes of a database only move to the nodes in its placement.
+    async fn decommission_node(
+        &self,
+        node_id: NodeId,
+        replacement: Option<NodeId>,
+    ) -> CoordinatorResult<()>;
+
     /// A summarizer to summarize vnode info.
     async fn replica_checksum(
         &self,
@@ -128,6 +188,47 @@ pub trait Coordinator: Send + Sync {
         replica_id: ReplicationSetId,
     ) -> CoordinatorResult<Vec<RecordBatch>>;
 
+    /// Fetch storage state of vnodes from the data nodes owning them,
+    /// vnodes on unreachable nodes are ignored.
+    async fn vnode_summaries(
+        &self,
+        tenant: &str,
+        vnodes: Vec<VnodeInfo>,
+    ) -> CoordinatorResult<Vec<VnodeSummary>>;
+
+    /// Fetch the sketches of the series of the tables from the data nodes
+    /// owning the vnodes of the replication sets, merged by table. The vnodes
+    /// of a replication set may all be fetched, a sketch counts a series once
+    /// however many times it is merged.
+    async fn series_sketches(
+        &self,
+        tenant: &str,
+        replicas: Vec<ReplicationSet>,
+        tables: Vec<String>,
+    ) -> CoordinatorResult<SeriesSketches>;
+
+    /// Read at most `limit` writes committed by the replica group from
+    /// `from_index` on its leader node, a replica catching up reads from
+    /// the `next_index` of the last result.
+    async fn committed_log(
+        &self,
+        tenant: &str,
+        db_name: &str,
+        replica: &ReplicationSet,
+        from_index: u64,
+        limit: u32,
+    ) -> CoordinatorResult<CommittedLog>;
+
+    /// Back up the databases of the tenant, all of them if `databases` is
+    /// empty, into the directory `name` under the backup path of this node,
+    /// see [`backup`].
+    async fn backup(
+        &self,
+        tenant: &str,
+        databases: Vec<String>,
+        name: &str,
+    ) -> CoordinatorResult<BackupManifest>;
+
     fn metrics(&self) -> &Arc<CoordServiceMetrics>;
 
     async fn update_tags_value(
@@ -139,6 +240,13 @@ pub trait Coordinator: Send + Sync {
 
     fn get_config(&self) -> Config;
     fn get_writer_count(&self) -> Arc<AtomicUsize>;
+
+    /// The log of the writes, if `change_feed` is enabled.
+    fn change_feed(&self) -> Option<Arc<ChangeFeed>>;
+
+    /// The per second rates of the counters of this node between the last
+    /// two samples of the monitor.
+    fn metric_rates(&self) -> Vec<MetricRate>;
 }
 
 #[async_trait::async_trait]
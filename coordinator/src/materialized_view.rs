@@ -0,0 +1,261 @@
+//! Marks the time ranges of the materialized views stale in meta when the
+//! points of their source tables are written or deleted. A query node
+//! refreshes the ranges [`REFRESH_DELAY`] after they are last marked and
+//! clears them, the queries overlapping a stale range are not answered by
+//! the view meanwhile.
+//!
+//! The buckets written are marked before the points are written, a write
+//! failing after the mark only makes the buckets refreshed needlessly. The
+//! buckets marked by a node are not marked again by its writes in the next
+//! [`MARK_REUSE`], and a write taking longer than half of the delay since
+//! the mark it relies on marks its buckets again when it is done, so the
+//! points are always stored before the ranges covering them are refreshed.
+
+use std::collections::{BTreeSet, HashMap};
+use std::sync::Mutex;
+
+use models::predicate::domain::TimeRanges;
+use models::schema::database_schema::DatabaseSchema;
+use models::schema::materialized_view::{MaterializedView, StaleRange};
+use utils::precision::{timestamp_convert, Precision};
+
+/// The time in nanoseconds a stale range is refreshed after it is marked.
+pub const REFRESH_DELAY: i64 = 60 * 1_000_000_000;
+/// The time in nanoseconds a bucket marked by a node is not marked again by
+/// the writes of the node.
+pub const MARK_REUSE: i64 = 10 * 1_000_000_000;
+
+#[derive(Debug, Default)]
+pub struct ViewMarks {
+    // (tenant, database, view, bucket) -> when the bucket was marked
+    marked: Mutex<HashMap<(String, String, String, i64), i64>>,
+}
+
+impl ViewMarks {
+    /// The ranges of the buckets written which are not marked by this node
+    /// since `since`, the adjacent buckets are merged into a range.
+    pub fn unmarked(
+        &self,
+        tenant: &str,
+        db: &str,
+        written: &WrittenBuckets,
+        since: i64,
+        now: i64,
+    ) -> Vec<(String, StaleRange)> {
+        let marked = self.marked.lock().unwrap();
+        let mut marks = vec![];
+        for (name, (view, buckets)) in &written.buckets {
+            let key = |bucket| (tenant.to_string(), db.to_string(), name.to_string(), bucket);
+            let unmarked = buckets
+                .iter()
+                .copied()
+                .filter(|bucket| marked.get(&key(*bucket)).map_or(true, |at| *at < since));
+            let mut ranges: Vec<StaleRange> = vec![];
+            for start in unmarked {
+                let end = start.saturating_add(view.interval);
+                match ranges.last_mut() {
+                    Some(last) if last.end == start => last.end = end,
+                    _ => ranges.push(StaleRange {
+                        start,
+                        end,
+                        marked_at: now,
+                    }),
+                }
+            }
+            marks.extend(ranges.into_iter().map(|range| (name.to_string(), range)));
+        }
+        marks
+    }
+
+    /// Remembers the buckets written of the ranges marked in meta.
+    pub fn remember(
+        &self,
+        tenant: &str,
+        db: &str,
+        written: &WrittenBuckets,
+        marks: &[(String, StaleRange)],
+    ) {
+        let mut marked = self.marked.lock().unwrap();
+        // the marks older than the reuse are never reused
+        if let Some(now) = marks.iter().map(|(_, range)| range.marked_at).max() {
+            marked.retain(|_, at| *at >= now.saturating_sub(MARK_REUSE));
+        }
+        for (name, range) in marks {
+            let Some((_, buckets)) = written.buckets.get(name.as_str()) else {
+                continue;
+            };
+            for bucket in buckets.range(range.start..range.end) {
+                marked.insert(
+                    (tenant.to_string(), db.to_string(), name.clone(), *bucket),
+                    range.marked_at,
+                );
+            }
+        }
+    }
+}
+
+/// Collects the buckets of the views of a database touched by a write.
+pub struct WrittenBuckets<'a> {
+    schema: &'a DatabaseSchema,
+    buckets: HashMap<&'a str, (&'a MaterializedView, BTreeSet<i64>)>,
+}
+
+impl<'a> WrittenBuckets<'a> {
+    pub fn new(schema: &'a DatabaseSchema) -> Self {
+        Self {
+            schema,
+            buckets: HashMap::new(),
+        }
+    }
+
+    /// Adds the point of the table, `ts` is in the precision of the database.
+    pub fn add(&mut self, table: &str, ts: i64) {
+        let views = self.schema.materialized_views();
+        if views.is_empty() {
+            return;
+        }
+        let ts = match timestamp_convert(*self.schema.config.precision(), Precision::NS, ts) {
+            Some(ts) => ts,
+            None => return,
+        };
+        for view in views.iter().filter(|view| view.source == table) {
+            self.buckets
+                .entry(view.name.as_str())
+                .or_insert_with(|| (view, BTreeSet::new()))
+                .1
+                .insert(view.bucket(ts));
+        }
+    }
+}
+
+/// The ranges of the views of the table covering the points deleted, the
+/// time ranges are in the precision of the database.
+pub fn deleted_ranges(
+    schema: &DatabaseSchema,
+    table: &str,
+    time_ranges: &TimeRanges,
+    now: i64,
+) -> Vec<(String, StaleRange)> {
+    let precision = *schema.config.precision();
+    let to_ns = |ts: i64| {
+        timestamp_convert(precision, Precision::NS, ts).unwrap_or(if ts < 0 {
+            i64::MIN
+        } else {
+            i64::MAX
+        })
+    };
+    let mut marks = vec![];
+    for view in schema
+        .materialized_views()
+        .iter()
+        .filter(|view| view.source == table)
+    {
+        for range in time_ranges.time_ranges() {
+            let range = view.bucket_range(to_ns(range.min_ts), to_ns(range.max_ts), now);
+            marks.push((view.name.clone(), range));
+        }
+    }
+    marks
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use models::predicate::domain::{TimeRange, TimeRanges};
+    use models::schema::database_schema::{DatabaseConfig, DatabaseOptions, DatabaseSchema};
+    use models::schema::materialized_view::{MaterializedView, StaleRange};
+
+    use super::{deleted_ranges, ViewMarks, WrittenBuckets, MARK_REUSE};
+
+    fn schema() -> DatabaseSchema {
+        let mut schema = DatabaseSchema::new(
+            "cnosdb",
+            "db",
+            DatabaseOptions::default(),
+            Arc::new(DatabaseConfig::default()),
+        );
+        for (name, interval) in [("cpu_10", 10), ("cpu_100", 100)] {
+            schema.add_materialized_view(MaterializedView {
+                name: name.to_string(),
+                source: "cpu".to_string(),
+                interval,
+                tags: vec![],
+                aggregates: vec![],
+                owner: "root".to_string(),
+                stale: vec![],
+            });
+        }
+        schema
+    }
+
+    fn range(start: i64, end: i64, marked_at: i64) -> StaleRange {
+        StaleRange {
+            start,
+            end,
+            marked_at,
+        }
+    }
+
+    #[test]
+    fn test_view_marks() {
+        let schema = schema();
+        let mut written = WrittenBuckets::new(&schema);
+        for ts in [5, 15, 45] {
+            written.add("cpu", ts);
+        }
+        written.add("mem", 25);
+
+        let marks = ViewMarks::default();
+        let mut unmarked = marks.unmarked("cnosdb", "db", &written, 0, 1);
+        unmarked.sort_by(|a, b| (&a.0, a.1.start).cmp(&(&b.0, b.1.start)));
+        assert_eq!(
+            unmarked,
+            vec![
+                ("cpu_10".to_string(), range(0, 20, 1)),
+                ("cpu_10".to_string(), range(40, 50, 1)),
+                ("cpu_100".to_string(), range(0, 100, 1)),
+            ]
+        );
+
+        // only the ranges marked in meta are reused
+        marks.remember("cnosdb", "db", &written, &unmarked[..1]);
+        let mut unmarked = marks.unmarked("cnosdb", "db", &written, 1, 2);
+        unmarked.sort_by(|a, b| (&a.0, a.1.start).cmp(&(&b.0, b.1.start)));
+        assert_eq!(
+            unmarked,
+            vec![
+                ("cpu_10".to_string(), range(40, 50, 2)),
+                ("cpu_100".to_string(), range(0, 100, 2)),
+            ]
+        );
+        // the marks older than `since` are not reused
+        assert_eq!(marks.unmarked("cnosdb", "db", &written, 2, 3).len(), 3);
+        assert_eq!(marks.unmarked("cnosdb", "db2", &written, 0, 3).len(), 3);
+
+        // pruned when marking later
+        let later = [("cpu_100".to_string(), range(0, 100, 2 + MARK_REUSE))];
+        marks.remember("cnosdb", "db", &written, &later);
+        assert_eq!(marks.unmarked("cnosdb", "db", &written, 0, 3).len(), 2);
+    }
+
+    #[test]
+    fn test_deleted_ranges() {
+        let schema = schema();
+        let mut time_ranges = TimeRanges::new(vec![TimeRange::new(5, 25)]);
+        assert_eq!(
+            deleted_ranges(&schema, "cpu", &time_ranges, 1),
+            vec![
+                ("cpu_10".to_string(), range(0, 30, 1)),
+                ("cpu_100".to_string(), range(0, 100, 1)),
+            ]
+        );
+        assert!(deleted_ranges(&schema, "mem", &time_ranges, 1).is_empty());
+
+        time_ranges = TimeRanges::new(vec![TimeRange::new(i64::MIN, i64::MAX)]);
+        assert_eq!(
+            deleted_ranges(&schema, "cpu", &time_ranges, 1)[0],
+            ("cpu_10".to_string(), StaleRange::all(1))
+        );
+    }
+}
@@ -25,6 +25,10 @@ impl LPLine {
         }
     }
 
+    pub fn measure(&self) -> &str {
+        &self.measure
+    }
+
     pub fn to_line(&self) -> Line {
         let tags = self
             .labels
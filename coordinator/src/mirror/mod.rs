@@ -0,0 +1,396 @@
+//! Forward the writes of the selected databases to remote CnosDB or
+//! InfluxDB clusters.
+//!
+//! The lines and the record batches written successfully are encoded to
+//! line protocol and appended to a durable queue per target, a task per
+//! target sends the queued writes in order. The queues are read and written
+//! by the blocking threads of the runtime. If the target fails to answer, the task probes
+//! it every `health_check_interval` and resends the write once it is back.
+//!
+//! The state of the targets is reported as metrics labeled by the target,
+//! e.g. `mirror_queue_size` and `mirror_target_healthy`.
+
+pub mod queue;
+
+use std::io;
+use std::path::Path;
+use std::sync::Arc;
+
+use config::tskv::{MirrorConfig, MirrorTarget};
+use datafusion::arrow::error::ArrowError;
+use datafusion::arrow::record_batch::RecordBatch;
+use metrics::count::U64Counter;
+use metrics::gauge::U64Gauge;
+use metrics::metric_register::MetricsRegister;
+use models::schema::tskv_table_schema::TskvTableSchema;
+use models::utils::now_timestamp_secs;
+use protocol_parser::line_protocol::{batch_to_line_protocol, lines_to_line_protocol};
+use protocol_parser::Line;
+use reqwest::StatusCode;
+use serde::{Deserialize, Serialize};
+use tokio::sync::Notify;
+use trace::{debug, error, info, warn};
+use utils::precision::Precision;
+
+use self::queue::{DurableQueue, QueueReader};
+
+#[derive(Debug, Serialize, Deserialize)]
+struct MirrorRecord {
+    tenant: String,
+    db: String,
+    precision: Precision,
+    body: Vec<u8>,
+}
+
+enum SendError {
+    /// The target refused the write, e.g. the lines are invalid there,
+    /// sending it again would not help.
+    Rejected(String),
+    Unavailable(String),
+}
+
+struct MirrorMetrics {
+    /// Bytes of the writes waiting to be sent.
+    queue_size: U64Gauge,
+    /// 1 if the last request to the target succeeded.
+    target_healthy: U64Gauge,
+    /// Unix seconds of the last write the target accepted.
+    last_sync_time: U64Gauge,
+    sent_writes: U64Counter,
+    dropped_writes: U64Counter,
+}
+
+impl MirrorMetrics {
+    fn new(register: &MetricsRegister, target: &str) -> Self {
+        let labels = [("target", target)];
+        let metrics = Self {
+            queue_size: register
+                .metric::<U64Gauge>("mirror_queue_size", "bytes of the writes to forward")
+                .recorder(labels),
+            target_healthy: register
+                .metric::<U64Gauge>("mirror_target_healthy", "whether the target is healthy")
+                .recorder(labels),
+            last_sync_time: register
+                .metric::<U64Gauge>("mirror_last_sync_time", "time of the last write forwarded")
+                .recorder(labels),
+            sent_writes: register
+                .metric::<U64Counter>("mirror_sent_writes", "writes forwarded")
+                .recorder(labels),
+            dropped_writes: register
+                .metric::<U64Counter>("mirror_dropped_writes", "writes dropped")
+                .recorder(labels),
+        };
+        metrics.target_healthy.set(1);
+        metrics
+    }
+}
+
+struct MirrorSender {
+    target: MirrorTarget,
+    queue: DurableQueue,
+    notify: Notify,
+    client: reqwest::Client,
+    config: MirrorConfig,
+    metrics: MirrorMetrics,
+}
+
+impl MirrorSender {
+    fn write_url(&self, record: &MirrorRecord) -> String {
+        let precision = record.precision.to_string().to_ascii_lowercase();
+        if self.target.kind == MirrorTarget::KIND_INFLUXDB {
+            let precision = if record.precision == Precision::NS {
+                "n"
+            } else {
+                precision.as_str()
+            };
+            format!(
+                "{}/write?db={}&precision={}",
+                self.target.url, record.db, precision
+            )
+        } else {
+            let tenant = self
+                .target
+                .remote_tenant
+                .as_deref()
+                .unwrap_or(&record.tenant);
+            format!(
+                "{}/api/v1/write?db={}&tenant={}&precision={}",
+                self.target.url, record.db, tenant, precision
+            )
+        }
+    }
+
+    fn ping_url(&self) -> String {
+        if self.target.kind == MirrorTarget::KIND_INFLUXDB {
+            format!("{}/ping", self.target.url)
+        } else {
+            format!("{}/api/v1/ping", self.target.url)
+        }
+    }
+
+    fn with_auth(&self, builder: reqwest::RequestBuilder) -> reqwest::RequestBuilder {
+        match &self.target.user {
+            Some(user) => builder.basic_auth(user, self.target.password.as_ref()),
+            None => builder,
+        }
+    }
+
+    async fn send(&self, record: &MirrorRecord) -> Result<(), SendError> {
+        let request = self
+            .client
+            .post(self.write_url(record))
+            .body(record.body.clone());
+        let response = self
+            .with_auth(request)
+            .send()
+            .await
+            .map_err(|e| SendError::Unavailable(e.to_string()))?;
+
+        let status = response.status();
+        if status.is_success() {
+            return Ok(());
+        }
+        let message = response.text().await.unwrap_or_default();
+        if status == StatusCode::BAD_REQUEST || status == StatusCode::UNPROCESSABLE_ENTITY {
+            Err(SendError::Rejected(format!("{}: {}", status, message)))
+        } else {
+            Err(SendError::Unavailable(format!("{}: {}", status, message)))
+        }
+    }
+
+    async fn wait_healthy(&self) {
+        let mut interval = tokio::time::interval(self.config.health_check_interval);
+        interval.set_missed_tick_behavior(tokio::time::MissedTickBehavior::Delay);
+        loop {
+            interval.tick().await;
+            let request = self.client.get(self.ping_url());
+            match self.with_auth(request).send().await {
+                Ok(response) if response.status().is_success() => return,
+                Ok(response) => debug!(
+                    "mirror target '{}' is unhealthy: {}",
+                    self.target.name,
+                    response.status()
+                ),
+                Err(e) => debug!("mirror target '{}' is unhealthy: {}", self.target.name, e),
+            }
+        }
+    }
+
+    /// Append the record to the queue, called by a blocking thread.
+    fn push(&self, tenant: &str, db: &str, data: &[u8]) {
+        match self.queue.push(data) {
+            Ok(true) => {
+                self.metrics.queue_size.set(self.queue.pending_size());
+                self.notify.notify_one();
+            }
+            Ok(false) => {
+                self.metrics.dropped_writes.inc_one();
+                trace::sampled!(
+                    warn,
+                    "dropped mirror writes",
+                    "mirror queue of '{}' is full, drop the write of {}.{}",
+                    self.target.name,
+                    tenant,
+                    db
+                );
+            }
+            Err(e) => trace::sampled!(
+                error,
+                "unqueued mirror writes",
+                "failed to queue the write of {}.{} for '{}': {}",
+                tenant,
+                db,
+                self.target.name,
+                e
+            ),
+        }
+    }
+
+    /// Read the next record by a blocking thread.
+    async fn read_next(
+        self: &Arc<Self>,
+        mut reader: QueueReader,
+    ) -> (QueueReader, io::Result<Option<Vec<u8>>>) {
+        let sender = self.clone();
+        let read = tokio::task::spawn_blocking(move || {
+            sender.metrics.queue_size.set(sender.queue.pending_size());
+            let data = reader.next(&sender.queue);
+            (reader, data)
+        });
+        match read.await {
+            Ok(read) => read,
+            Err(e) => std::panic::resume_unwind(e.into_panic()),
+        }
+    }
+
+    /// Save the position of the records sent by a blocking thread.
+    async fn ack(self: &Arc<Self>, reader: &QueueReader) -> io::Result<()> {
+        let sender = self.clone();
+        let position = reader.position();
+        match tokio::task::spawn_blocking(move || sender.queue.ack(position)).await {
+            Ok(res) => res,
+            Err(e) => std::panic::resume_unwind(e.into_panic()),
+        }
+    }
+
+    async fn run(self: Arc<Self>) {
+        let mut reader = QueueReader::new(&self.queue);
+        loop {
+            let (next_reader, data) = self.read_next(reader).await;
+            reader = next_reader;
+            let data = match data {
+                Ok(Some(data)) => data,
+                Ok(None) => {
+                    self.notify.notified().await;
+                    continue;
+                }
+                Err(e) => {
+                    error!(
+                        "failed to read the mirror queue of '{}', skip the segment: {}",
+                        self.target.name, e
+                    );
+                    reader.skip_segment();
+                    continue;
+                }
+            };
+
+            match bincode::deserialize::<MirrorRecord>(&data) {
+                Ok(record) => loop {
+                    match self.send(&record).await {
+                        Ok(()) => {
+                            self.metrics.sent_writes.inc_one();
+                            self.metrics.last_sync_time.set(now_timestamp_secs() as u64);
+                            break;
+                        }
+                        Err(SendError::Rejected(e)) => {
+                            self.metrics.dropped_writes.inc_one();
+                            warn!(
+                                "mirror target '{}' rejected the write of {}.{}, drop it: {}",
+                                self.target.name, record.tenant, record.db, e
+                            );
+                            break;
+                        }
+                        Err(SendError::Unavailable(e)) => {
+                            warn!(
+                                "mirror target '{}' is unavailable, wait for it: {}",
+                                self.target.name, e
+                            );
+                            self.metrics.target_healthy.set(0);
+                            self.wait_healthy().await;
+                            self.metrics.target_healthy.set(1);
+                            info!("mirror target '{}' is available again", self.target.name);
+                        }
+                    }
+                },
+                Err(e) => {
+                    self.metrics.dropped_writes.inc_one();
+                    error!(
+                        "failed to decode the mirror record of '{}', drop it: {}",
+                        self.target.name, e
+                    );
+                }
+            }
+
+            if let Err(e) = self.ack(&reader).await {
+                error!(
+                    "failed to save the mirror queue position of '{}': {}",
+                    self.target.name, e
+                );
+            }
+        }
+    }
+}
+
+pub struct WriteMirror {
+    senders: Vec<Arc<MirrorSender>>,
+}
+
+impl WriteMirror {
+    /// Open the queues of the targets and start sending the queued writes.
+    pub fn start(
+        config: &MirrorConfig,
+        metrics_register: &MetricsRegister,
+    ) -> std::io::Result<Arc<Self>> {
+        let client = reqwest::Client::builder()
+            .timeout(config.request_timeout)
+            .build()
+            .map_err(std::io::Error::other)?;
+
+        let mut senders = Vec::with_capacity(config.targets.len());
+        for target in &config.targets {
+            let queue = DurableQueue::open(
+                Path::new(&config.queue_path).join(&target.name),
+                config.max_queue_size,
+                config.max_segment_size,
+            )?;
+            let sender = Arc::new(MirrorSender {
+                target: target.clone(),
+                queue,
+                notify: Notify::new(),
+                client: client.clone(),
+                config: config.clone(),
+                metrics: MirrorMetrics::new(metrics_register, &target.name),
+            });
+            tokio::spawn(sender.clone().run());
+            senders.push(sender);
+        }
+        Ok(Arc::new(Self { senders }))
+    }
+
+    pub fn forwards(&self, tenant: &str, db: &str) -> bool {
+        self.senders.iter().any(|s| s.target.forwards(tenant, db))
+    }
+
+    /// Encode the lines, called before the lines are consumed by the write.
+    pub fn encode(lines: &[Line]) -> Vec<u8> {
+        let mut body = Vec::new();
+        lines_to_line_protocol(lines, &mut body);
+        body
+    }
+
+    /// Encode the rows of the record batch, the timestamps are in
+    /// nanoseconds.
+    pub fn encode_batch(
+        table: &TskvTableSchema,
+        batch: &RecordBatch,
+    ) -> Result<Vec<u8>, ArrowError> {
+        let mut body = Vec::new();
+        batch_to_line_protocol(table, batch, &mut body)?;
+        Ok(body)
+    }
+
+    /// Queue the lines encoded by [`WriteMirror::encode`] or
+    /// [`WriteMirror::encode_batch`] for the targets forwarding the
+    /// database.
+    pub async fn push(&self, tenant: &str, db: &str, precision: Precision, body: Vec<u8>) {
+        let record = MirrorRecord {
+            tenant: tenant.to_string(),
+            db: db.to_string(),
+            precision,
+            body,
+        };
+        let data = match bincode::serialize(&record) {
+            Ok(data) => data,
+            Err(e) => {
+                error!("failed to encode the mirror record: {}", e);
+                return;
+            }
+        };
+
+        let senders = self
+            .senders
+            .iter()
+            .filter(|s| s.target.forwards(tenant, db))
+            .cloned()
+            .collect::<Vec<_>>();
+        let (tenant, db) = (tenant.to_string(), db.to_string());
+        let push = tokio::task::spawn_blocking(move || {
+            for sender in senders {
+                sender.push(&tenant, &db, &data);
+            }
+        });
+        if let Err(e) = push.await {
+            std::panic::resume_unwind(e.into_panic());
+        }
+    }
+}
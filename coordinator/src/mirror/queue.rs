@@ -0,0 +1,398 @@
+//! A durable FIFO queue of records, kept in the segment files
+//! `<dir>/<segment>.seg`, the position acknowledged is saved in
+//! `<dir>/ack`, the segments before it are removed.
+//!
+//! ```text
+//! +------------+------------+------+
+//! | 0: 4 bytes | 4: 4 bytes | 8:   |
+//! +------------+------------+------+
+//! | data_len   | crc32      | data |
+//! +------------+------------+------+
+//! ```
+//!
+//! The records are written to the files without fsync, they survive a
+//! crash of the process but not of the machine.
+
+use std::fmt::{self, Display};
+use std::fs::{self, File, OpenOptions};
+use std::io::{self, Read, Seek, SeekFrom, Write};
+use std::path::{Path, PathBuf};
+use std::str::FromStr;
+use std::sync::Mutex;
+
+const SEGMENT_EXTENSION: &str = "seg";
+const ACK_FILE_NAME: &str = "ack";
+const RECORD_HEADER_LEN: u64 = 8;
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, PartialOrd, Ord)]
+pub struct Position {
+    pub segment: u64,
+    pub offset: u64,
+}
+
+impl Position {
+    fn encode(&self) -> [u8; 16] {
+        let mut buf = [0_u8; 16];
+        buf[..8].copy_from_slice(&self.segment.to_be_bytes());
+        buf[8..].copy_from_slice(&self.offset.to_be_bytes());
+        buf
+    }
+
+    fn decode(buf: &[u8]) -> Option<Self> {
+        if buf.len() != 16 {
+            return None;
+        }
+        Some(Self {
+            segment: u64::from_be_bytes(buf[..8].try_into().ok()?),
+            offset: u64::from_be_bytes(buf[8..].try_into().ok()?),
+        })
+    }
+}
+
+/// Formatted as `<segment>.<offset>`.
+impl Display for Position {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}.{}", self.segment, self.offset)
+    }
+}
+
+impl FromStr for Position {
+    type Err = String;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let (segment, offset) = s
+            .split_once('.')
+            .ok_or_else(|| format!("invalid position '{}', expect <segment>.<offset>", s))?;
+        Ok(Self {
+            segment: segment
+                .parse()
+                .map_err(|e| format!("invalid segment of position '{}': {}", s, e))?,
+            offset: offset
+                .parse()
+                .map_err(|e| format!("invalid offset of position '{}': {}", s, e))?,
+        })
+    }
+}
+
+struct Appender {
+    segment: u64,
+    file: File,
+    len: u64,
+    /// Bytes of all the segments.
+    size: u64,
+}
+
+pub struct DurableQueue {
+    dir: PathBuf,
+    max_size: u64,
+    max_segment_size: u64,
+    appender: Mutex<Appender>,
+    acked: Mutex<Position>,
+}
+
+fn segment_path(dir: &Path, segment: u64) -> PathBuf {
+    dir.join(format!("{:020}.{}", segment, SEGMENT_EXTENSION))
+}
+
+fn list_segments(dir: &Path) -> io::Result<Vec<u64>> {
+    let mut segments = vec![];
+    for entry in fs::read_dir(dir)? {
+        let path = entry?.path();
+        if path
+            .extension()
+            .map_or(true, |ext| ext != SEGMENT_EXTENSION)
+        {
+            continue;
+        }
+        if let Some(segment) = path
+            .file_stem()
+            .and_then(|s| s.to_str())
+            .and_then(|s| s.parse::<u64>().ok())
+        {
+            segments.push(segment);
+        }
+    }
+    segments.sort_unstable();
+    Ok(segments)
+}
+
+/// Length of the valid records of the segment, a record partly written
+/// by a crash is dropped.
+fn valid_len(path: &Path) -> io::Result<u64> {
+    let mut file = File::open(path)?;
+    let file_len = file.metadata()?.len();
+    let mut offset = 0;
+    loop {
+        match read_record(&mut file, offset, file_len) {
+            Ok(Some(data)) => offset += RECORD_HEADER_LEN + data.len() as u64,
+            Ok(None) | Err(_) => return Ok(offset),
+        }
+    }
+}
+
+/// Read the record at `offset`, `None` if there is no complete record.
+fn read_record(file: &mut File, offset: u64, file_len: u64) -> io::Result<Option<Vec<u8>>> {
+    if offset + RECORD_HEADER_LEN > file_len {
+        return Ok(None);
+    }
+    file.seek(SeekFrom::Start(offset))?;
+    let mut header = [0_u8; RECORD_HEADER_LEN as usize];
+    file.read_exact(&mut header)?;
+    let data_len = u32::from_be_bytes([header[0], header[1], header[2], header[3]]) as u64;
+    let crc = u32::from_be_bytes([header[4], header[5], header[6], header[7]]);
+    if offset + RECORD_HEADER_LEN + data_len > file_len {
+        return Ok(None);
+    }
+
+    let mut data = vec![0_u8; data_len as usize];
+    file.read_exact(&mut data)?;
+    if crc32fast::hash(&data) != crc {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidData,
+            format!("crc of the record at {} not match", offset),
+        ));
+    }
+    Ok(Some(data))
+}
+
+impl DurableQueue {
+    pub fn open(dir: impl AsRef<Path>, max_size: u64, max_segment_size: u64) -> io::Result<Self> {
+        let dir = dir.as_ref().to_path_buf();
+        fs::create_dir_all(&dir)?;
+
+        let segments = list_segments(&dir)?;
+        let acked = match fs::read(dir.join(ACK_FILE_NAME)) {
+            Ok(buf) => Position::decode(&buf).unwrap_or_default(),
+            Err(e) if e.kind() == io::ErrorKind::NotFound => Position {
+                segment: segments.first().copied().unwrap_or_default(),
+                offset: 0,
+            },
+            Err(e) => return Err(e),
+        };
+
+        let mut size = 0;
+        for segment in &segments {
+            size += fs::metadata(segment_path(&dir, *segment))?.len();
+        }
+        let segment = segments.last().copied().unwrap_or(acked.segment);
+        let path = segment_path(&dir, segment);
+        let len = if path.exists() { valid_len(&path)? } else { 0 };
+        let mut file = OpenOptions::new()
+            .create(true)
+            .write(true)
+            .truncate(false)
+            .open(&path)?;
+        file.set_len(len)?;
+        file.seek(SeekFrom::Start(len))?;
+
+        Ok(Self {
+            dir,
+            max_size,
+            max_segment_size,
+            appender: Mutex::new(Appender {
+                segment,
+                file,
+                len,
+                size,
+            }),
+            acked: Mutex::new(acked),
+        })
+    }
+
+    /// Append the record, returns false if the queue is full.
+    pub fn push(&self, data: &[u8]) -> io::Result<bool> {
+        let record_len = RECORD_HEADER_LEN + data.len() as u64;
+        let mut appender = self.appender.lock().unwrap();
+        if appender.size + record_len > self.max_size {
+            return Ok(false);
+        }
+        if appender.len > 0 && appender.len + record_len > self.max_segment_size {
+            let segment = appender.segment + 1;
+            appender.file = OpenOptions::new()
+                .create(true)
+                .write(true)
+                .truncate(true)
+                .open(segment_path(&self.dir, segment))?;
+            appender.segment = segment;
+            appender.len = 0;
+        }
+
+        let mut buf = Vec::with_capacity(record_len as usize);
+        buf.extend_from_slice(&(data.len() as u32).to_be_bytes());
+        buf.extend_from_slice(&crc32fast::hash(data).to_be_bytes());
+        buf.extend_from_slice(data);
+        appender.file.write_all(&buf)?;
+        appender.len += record_len;
+        appender.size += record_len;
+        Ok(true)
+    }
+
+    /// Position after the last record.
+    pub fn end(&self) -> Position {
+        let appender = self.appender.lock().unwrap();
+        Position {
+            segment: appender.segment,
+            offset: appender.len,
+        }
+    }
+
+    pub fn acked(&self) -> Position {
+        *self.acked.lock().unwrap()
+    }
+
+    pub fn size(&self) -> u64 {
+        self.appender.lock().unwrap().size
+    }
+
+    /// Bytes of the records not acknowledged.
+    pub fn pending_size(&self) -> u64 {
+        let acked = self.acked();
+        self.size().saturating_sub(acked.offset)
+    }
+
+    /// Save the position of the records handled, removes the segments
+    /// before it.
+    pub fn ack(&self, position: Position) -> io::Result<()> {
+        let mut acked = self.acked.lock().unwrap();
+        let tmp = self.dir.join(format!("{}.tmp", ACK_FILE_NAME));
+        fs::write(&tmp, position.encode())?;
+        fs::rename(&tmp, self.dir.join(ACK_FILE_NAME))?;
+
+        for segment in acked.segment..position.segment {
+            let path = segment_path(&self.dir, segment);
+            let len = match fs::metadata(&path) {
+                Ok(m) => m.len(),
+                Err(_) => continue,
+            };
+            fs::remove_file(&path)?;
+            let mut appender = self.appender.lock().unwrap();
+            appender.size = appender.size.saturating_sub(len);
+        }
+        *acked = position;
+        Ok(())
+    }
+
+    fn segment_path(&self, segment: u64) -> PathBuf {
+        segment_path(&self.dir, segment)
+    }
+}
+
+/// Reads the records of a queue in order, from the position acknowledged.
+pub struct QueueReader {
+    position: Position,
+    file: Option<File>,
+}
+
+impl QueueReader {
+    pub fn new(queue: &DurableQueue) -> Self {
+        Self::at(queue.acked())
+    }
+
+    /// Reads from `position`, which must be the start of a record.
+    pub fn at(position: Position) -> Self {
+        Self {
+            position,
+            file: None,
+        }
+    }
+
+    /// Position after the records read.
+    pub fn position(&self) -> Position {
+        self.position
+    }
+
+    /// Read the next record, `None` if all the records are read.
+    pub fn next(&mut self, queue: &DurableQueue) -> io::Result<Option<Vec<u8>>> {
+        loop {
+            let end = queue.end();
+            if self.position >= end {
+                return Ok(None);
+            }
+            let file_len = if self.position.segment == end.segment {
+                end.offset
+            } else {
+                match fs::metadata(queue.segment_path(self.position.segment)) {
+                    Ok(m) => m.len(),
+                    Err(e) if e.kind() == io::ErrorKind::NotFound => 0,
+                    Err(e) => return Err(e),
+                }
+            };
+            if self.position.offset >= file_len {
+                self.skip_segment();
+                continue;
+            }
+
+            if self.file.is_none() {
+                self.file = Some(File::open(queue.segment_path(self.position.segment))?);
+            }
+            let file = self.file.as_mut().expect("file opened");
+            match read_record(file, self.position.offset, file_len)? {
+                Some(data) => {
+                    self.position.offset += RECORD_HEADER_LEN + data.len() as u64;
+                    return Ok(Some(data));
+                }
+                None => self.skip_segment(),
+            }
+        }
+    }
+
+    /// Skip the rest of the current segment, e.g. it is broken.
+    pub fn skip_segment(&mut self) {
+        self.position = Position {
+            segment: self.position.segment + 1,
+            offset: 0,
+        };
+        self.file = None;
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::{DurableQueue, Position, QueueReader};
+
+    #[test]
+    fn test_durable_queue() {
+        let dir = "/tmp/test/coordinator/mirror/queue";
+        let _ = std::fs::remove_dir_all(dir);
+
+        let queue = DurableQueue::open(dir, 1024, 64).unwrap();
+        let mut reader = QueueReader::new(&queue);
+        assert_eq!(reader.next(&queue).unwrap(), None);
+        for i in 0..10_u8 {
+            assert!(queue.push(&[i; 20]).unwrap());
+        }
+        for i in 0..4_u8 {
+            assert_eq!(reader.next(&queue).unwrap(), Some(vec![i; 20]));
+        }
+        queue.ack(reader.position()).unwrap();
+        drop(queue);
+
+        // resume from the position acknowledged
+        let queue = DurableQueue::open(dir, 1024, 64).unwrap();
+        let mut reader = QueueReader::new(&queue);
+        for i in 4..10_u8 {
+            assert_eq!(reader.next(&queue).unwrap(), Some(vec![i; 20]));
+        }
+        assert_eq!(reader.next(&queue).unwrap(), None);
+        assert!(queue.push(&[10; 20]).unwrap());
+        assert_eq!(reader.next(&queue).unwrap(), Some(vec![10; 20]));
+        queue.ack(reader.position()).unwrap();
+        assert_eq!(queue.size(), 28);
+        assert_eq!(queue.pending_size(), 0);
+
+        // full
+        assert!(!queue.push(&[0; 1024]).unwrap());
+    }
+
+    #[test]
+    fn test_position() {
+        let position = Position {
+            segment: 3,
+            offset: 28,
+        };
+        assert_eq!(position.to_string(), "3.28");
+        assert_eq!("3.28".parse::<Position>().unwrap(), position);
+        assert!("3".parse::<Position>().is_err());
+        assert!("3.x".parse::<Position>().is_err());
+    }
+}
@@ -14,7 +14,9 @@ use replication::multi_raft::MultiRaft;
 use replication::node_store::NodeStorage;
 use replication::raft_node::RaftNode;
 use replication::state_store::{RaftNodeSummary, StateStorage};
-use replication::{ApplyStorageRef, EntryStorageRef, RaftNodeId, RaftNodeInfo, ReplicationConfig};
+use replication::{
+    ApplyStorageRef, CommittedLog, EntryStorageRef, RaftNodeId, RaftNodeInfo, ReplicationConfig,
+};
 use snafu::ResultExt;
 use tokio::runtime::Runtime;
 use tokio::sync::RwLock;
@@ -23,6 +25,7 @@ use tskv::wal::wal_store::RaftEntryStorage;
 use tskv::{wal, EngineRef};
 
 use super::TskvEngineStorage;
+use crate::change_feed::ChangeFeed;
 use crate::errors::{
     CommonSnafu, CoordinatorError, CoordinatorResult, LeaderIsWrongSnafu, MetaSnafu,
     RaftNodeNotFoundSnafu, ReplicatSnafu, TskvSnafu,
@@ -34,6 +37,7 @@ pub struct RaftNodesManager {
     meta: MetaRef,
     config: config::tskv::Config,
     kv_inst: Option<EngineRef>,
+    change_feed: Option<Arc<ChangeFeed>>,
     raft_state: Arc<StateStorage>,
     raft_nodes: Arc<RwLock<MultiRaft>>,
 
@@ -45,6 +49,7 @@ impl RaftNodesManager {
         config: config::tskv::Config,
         meta: MetaRef,
         kv_inst: Option<EngineRef>,
+        change_feed: Option<Arc<ChangeFeed>>,
         register: Arc<MetricsRegister>,
     ) -> Self {
         let path = PathBuf::from(config.storage.path.clone()).join("raft-state");
@@ -55,6 +60,7 @@ impl RaftNodesManager {
             meta,
             config,
             kv_inst,
+            change_feed,
             register,
             raft_state: Arc::new(state),
             raft_nodes: Arc::new(RwLock::new(MultiRaft::new())),
@@ -407,6 +413,26 @@ impl RaftNodesManager {
         Ok(())
     }
 
+    /// Read the writes committed by the replica group from `from_index`,
+    /// all the replicas read the same writes for an index.
+    pub async fn committed_log(
+        &self,
+        tenant: &str,
+        db_name: &str,
+        replica_id: ReplicationSetId,
+        from_index: u64,
+        limit: usize,
+    ) -> CoordinatorResult<CommittedLog> {
+        let all_info = get_replica_all_info(self.meta.clone(), tenant, replica_id).await?;
+        let replica = &all_info.replica_set;
+
+        let raft_node = self.get_node_or_build(tenant, db_name, replica).await?;
+        raft_node
+            .committed_log(from_index, limit)
+            .await
+            .context(ReplicatSnafu)
+    }
+
     pub async fn destory_replica_group(
         &self,
         tenant: &str,
@@ -564,6 +590,97 @@ impl RaftNodesManager {
         Ok(())
     }
 
+    /// Rebuild a (corrupted) follower: remove it from the raft group, move its
+    /// files into quarantine, then add a new empty vnode on the same node,
+    /// which will be resynchronized from the leader by raft snapshot.
+    pub async fn rebuild_node_in_group(
+        &self,
+        tenant: &str,
+        db_name: &str,
+        vnode_id: VnodeId,
+        replica_id: ReplicationSetId,
+    ) -> CoordinatorResult<()> {
+        let all_info = get_replica_all_info(self.meta.clone(), tenant, replica_id).await?;
+        let replica = all_info.replica_set.clone();
+        let vnode = replica.vnode(vnode_id).ok_or_else(|| {
+            RaftNodeNotFoundSnafu {
+                vnode_id,
+                replica_id,
+            }
+            .build()
+        })?;
+        if replica.vnodes.len() < 2 {
+            return Err(CommonSnafu {
+                msg: format!(
+                    "replica {} has no other vnode to resync vnode {} from",
+                    replica_id, vnode_id
+                ),
+            }
+            .build());
+        }
+        if vnode_id == replica.leader_vnode_id {
+            return Err(CommonSnafu {
+                msg: format!(
+                    "vnode {} is the leader of replica {}, promote another vnode before rebuilding",
+                    vnode_id, replica_id
+                ),
+            }
+            .build());
+        }
+
+        let raft_node = self.get_node_or_build(tenant, db_name, &replica).await?;
+        self.assert_leader_node(raft_node.clone()).await?;
+
+        let mut members = BTreeSet::new();
+        for vnode in replica.vnodes.iter() {
+            if vnode.id != vnode_id {
+                members.insert(vnode.id as RaftNodeId);
+            }
+        }
+        raft_node
+            .raft_change_membership(members, false)
+            .await
+            .context(ReplicatSnafu)?;
+
+        if vnode.node_id == self.node_id() {
+            let storage =
+                self.kv_inst
+                    .clone()
+                    .ok_or_else(|| CoordinatorError::KvInstanceNotFound {
+                        node_id: self.node_id(),
+                    })?;
+            storage
+                .quarantine_tsfamily(tenant, db_name, vnode.id)
+                .await
+                .context(TskvSnafu)?;
+            self.exec_drop_raft_node(tenant, db_name, vnode.id, replica.id)
+                .await?;
+        } else {
+            self.quarantine_remote_vnode(tenant, db_name, &vnode)
+                .await?;
+            self.drop_remote_raft_node(tenant, db_name, &vnode, replica.id)
+                .await?;
+        }
+
+        update_replication_set(
+            self.meta.clone(),
+            tenant,
+            db_name,
+            all_info.bucket_id,
+            replica.id,
+            &[vnode.clone()],
+            &[],
+        )
+        .await?;
+
+        info!(
+            "vnode {}.{} quarantined, resync to node {} from leader",
+            replica_id, vnode_id, vnode.node_id
+        );
+        self.add_follower_to_group(tenant, db_name, vnode.node_id, replica_id)
+            .await
+    }
+
     async fn open_raft_node(
         &self,
         tenant: &str,
@@ -662,6 +779,7 @@ impl RaftNodesManager {
             self.meta.clone(),
             vnode_store.clone(),
             storage,
+            self.change_feed.clone(),
             self.config.service.grpc_enable_gzip,
         );
 
@@ -717,6 +835,34 @@ impl RaftNodesManager {
         Ok(())
     }
 
+    async fn quarantine_remote_vnode(
+        &self,
+        tenant: &str,
+        db_name: &str,
+        vnode: &VnodeInfo,
+    ) -> CoordinatorResult<()> {
+        let request = AdminCommand {
+            tenant: tenant.to_string(),
+            command: Some(admin_command::Command::QuarantineVnode(
+                QuarantineVnodeRequest {
+                    db_name: db_name.to_string(),
+                    vnode_id: vnode.id,
+                },
+            )),
+        };
+
+        let caller = TskvAdminRequest {
+            request,
+            meta: self.meta.clone(),
+            timeout: Duration::from_secs(60),
+            enable_gzip: self.config.service.grpc_enable_gzip,
+        };
+
+        caller.do_request(vnode.node_id).await?;
+
+        Ok(())
+    }
+
     async fn open_remote_raft_node(
         &self,
         tenant: &str,
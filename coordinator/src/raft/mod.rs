@@ -1,10 +1,11 @@
 use std::path::{Path, PathBuf};
+use std::sync::Arc;
 use std::time::Duration;
 
 use meta::model::MetaRef;
 use models::meta_data::VnodeId;
 use protos::kv_service::tskv_service_client::TskvServiceClient;
-use protos::kv_service::{DownloadFileRequest, RaftWriteCommand};
+use protos::kv_service::{raft_write_command, DownloadFileRequest, RaftWriteCommand};
 use protos::models_helper::parse_prost_bytes;
 use protos::{tskv_service_time_out_client, DEFAULT_GRPC_SERVER_MESSAGE_LEN};
 use replication::errors::{
@@ -12,23 +13,87 @@ use replication::errors::{
 };
 use replication::{ApplyContext, ApplyStorage, EngineMetrics};
 use snafu::ResultExt;
-use tokio::io::AsyncWriteExt;
+use tokio::io::{AsyncReadExt, AsyncSeekExt, AsyncWriteExt, SeekFrom};
 use tokio_stream::StreamExt;
 use tonic::transport::Channel;
 use tower::timeout::Timeout;
-use tracing::{error, info};
-use tskv::file_system::async_filesystem::LocalFileSystem;
-use tskv::file_system::FileSystem;
+use tracing::{error, info, warn};
 use tskv::kv_option::DATA_PATH;
 use tskv::vnode_store::VnodeStorage;
 use tskv::VnodeSnapshot;
+use utils::precision::Precision;
 
+use crate::change_feed::ChangeFeed;
 use crate::errors::{CommonSnafu, CoordinatorResult, IOErrorsSnafu, MetaSnafu};
 
 pub mod manager;
 
 pub mod writer;
 
+/// Times to resume the download of a file after the stream broke.
+const MAX_DOWNLOAD_RETRIES: usize = 3;
+const DOWNLOAD_RETRY_INTERVAL: Duration = Duration::from_secs(1);
+/// Times to resume the download of the same snapshot by the restores of a
+/// vnode, before the files downloaded are removed and downloaded again.
+const MAX_SNAPSHOT_DOWNLOAD_ATTEMPTS: u32 = 3;
+const SNAPSHOT_DOWNLOAD_ATTEMPTS_FILE: &str = "download_attempts";
+
+/// The crc32 and the length of the first bytes of a file, to verify the
+/// files of a snapshot are the same at both ends of the transfer.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FileChecksum {
+    pub crc: u32,
+    pub len: u64,
+}
+
+impl FileChecksum {
+    const ENCODED_LEN: usize = 12;
+
+    /// The checksum of the first `len` bytes of the file, of the whole file
+    /// if `len` is 0.
+    pub async fn compute(path: &Path, len: u64) -> std::io::Result<Self> {
+        let file = tokio::fs::File::open(path).await?;
+        let limit = if len == 0 { u64::MAX } else { len };
+        let mut reader = file.take(limit);
+        let mut hasher = crc32fast::Hasher::new();
+        let mut buffer = vec![0; 64 * 1024];
+        let mut read = 0;
+        loop {
+            let n = reader.read(&mut buffer).await?;
+            if n == 0 {
+                break;
+            }
+            hasher.update(&buffer[..n]);
+            read += n as u64;
+        }
+        Ok(Self {
+            crc: hasher.finalize(),
+            len: read,
+        })
+    }
+
+    pub fn encode(&self) -> Vec<u8> {
+        let mut buf = Vec::with_capacity(Self::ENCODED_LEN);
+        buf.extend_from_slice(&self.crc.to_be_bytes());
+        buf.extend_from_slice(&self.len.to_be_bytes());
+        buf
+    }
+
+    pub fn decode(data: &[u8]) -> CoordinatorResult<Self> {
+        if data.len() != Self::ENCODED_LEN {
+            return Err(CommonSnafu {
+                msg: format!("invalid file checksum of {} bytes", data.len()),
+            }
+            .build());
+        }
+        let (crc, len) = data.split_at(4);
+        Ok(Self {
+            crc: u32::from_be_bytes(crc.try_into().unwrap_or_default()),
+            len: u64::from_be_bytes(len.try_into().unwrap_or_default()),
+        })
+    }
+}
+
 pub struct TskvEngineStorage {
     tenant: String,
     db_name: String,
@@ -36,6 +101,7 @@ pub struct TskvEngineStorage {
     meta: MetaRef,
     vnode: VnodeStorage,
     storage: tskv::EngineRef,
+    change_feed: Option<Arc<ChangeFeed>>,
     grpc_enable_gzip: bool,
 }
 
@@ -47,13 +113,17 @@ impl TskvEngineStorage {
         meta: MetaRef,
         vnode: VnodeStorage,
         storage: tskv::EngineRef,
+        change_feed: Option<Arc<ChangeFeed>>,
         grpc_enable_gzip: bool,
     ) -> Self {
+        // the writes of the databases not logged are not kept
+        let change_feed = change_feed.filter(|feed| feed.logs(tenant, db_name));
         Self {
             meta,
             vnode_id,
             storage,
             vnode,
+            change_feed,
             tenant: tenant.to_owned(),
             db_name: db_name.to_owned(),
             grpc_enable_gzip,
@@ -62,125 +132,284 @@ impl TskvEngineStorage {
 
     pub async fn download_snapshot(
         &self,
-        dir: &PathBuf,
+        dir: &Path,
         snapshot: &VnodeSnapshot,
     ) -> CoordinatorResult<()> {
-        let channel = self
-            .meta
-            .get_node_conn(snapshot.node_id)
-            .await
-            .context(MetaSnafu)?;
-        let mut client = tskv_service_time_out_client(
-            channel,
-            Duration::from_secs(60 * 60),
-            DEFAULT_GRPC_SERVER_MESSAGE_LEN,
-            self.grpc_enable_gzip,
-        );
-
+        // the files downloaded are kept on errors, the download of the same
+        // snapshot resumes from them
         info!("download snapshot to path: {:?}", dir);
-        if let Err(err) = self
-            .download_snapshot_files(dir, snapshot, &mut client)
-            .await
-        {
-            tokio::fs::remove_dir_all(&dir)
-                .await
-                .context(IOErrorsSnafu)?;
-            return Err(err);
-        }
-
+        download_snapshot(&self.meta, self.grpc_enable_gzip, dir, snapshot).await?;
         info!("success download snapshot all files");
 
         Ok(())
     }
 
-    async fn download_snapshot_files(
+    async fn exec_apply(
         &self,
-        dir: &Path,
-        snapshot: &VnodeSnapshot,
-        client: &mut TskvServiceClient<Timeout<Channel>>,
-    ) -> CoordinatorResult<()> {
-        let src_dir = PathBuf::from(DATA_PATH)
-            .join(&snapshot.version_edit.tsf_name)
-            .join(snapshot.vnode_id.to_string());
-
-        for info in snapshot.version_edit.add_files.iter() {
-            let filename = dir.join(info.relative_path());
-            let src_filename = src_dir
-                .join(info.relative_path())
-                .to_string_lossy()
-                .to_string();
-
-            info!(
-                "begin download file {} -> {:?}, from {}",
-                src_filename, filename, snapshot.node_id
-            );
-
-            Self::download_file(&src_filename, &filename, client).await?;
-            let filename = filename.to_string_lossy().to_string();
-            let length = LocalFileSystem::get_file_length(filename);
-            if info.file_size != length {
-                return Err(CommonSnafu {
-                    msg: format!(
-                        "download file length not match {} -> {}",
-                        info.file_size, length
-                    ),
+        ctx: &ApplyContext,
+        req: &replication::Request,
+    ) -> ReplicationResult<replication::Response> {
+        let request = parse_prost_bytes::<RaftWriteCommand>(req)
+            .map_err(|e| MsgInvalidSnafu { msg: e.to_string() }.build())?;
+        if let Some(command) = request.command {
+            // logged before applied, so that a write applied is never missed
+            // by the feed, the writes replayed from the wal were logged when
+            // applied, and the points copied were logged when first written
+            if let (Some(feed), raft_write_command::Command::WriteData(write)) =
+                (&self.change_feed, &command)
+            {
+                if ctx.apply_type == replication::APPLY_TYPE_WRITE && !write.copied {
+                    feed.push(
+                        &self.tenant,
+                        &self.db_name,
+                        request.replica_id,
+                        ctx.index,
+                        Precision::from(write.precision as u8),
+                        write.data.clone(),
+                    )
+                    .await
+                    .map_err(|err| ReplicationError::ApplyEngineErr {
+                        msg: format!("failed to log the write: {}", err),
+                    })?;
                 }
-                .build());
             }
+
+            self.vnode.apply(ctx, command).await.map_err(|err| {
+                ReplicationError::ApplyEngineErr {
+                    msg: err.to_string(),
+                }
+            })?;
         }
 
-        Ok(())
+        Ok(vec![])
     }
+}
 
-    async fn download_file(
-        download: &str,
-        filename: &Path,
-        client: &mut TskvServiceClient<Timeout<Channel>>,
-    ) -> CoordinatorResult<()> {
-        if let Some(dir) = filename.parent() {
-            tokio::fs::create_dir_all(dir)
-                .await
-                .context(IOErrorsSnafu)?;
+/// The prefix of the directories the snapshots restored by the vnode are
+/// downloaded to.
+fn snapshot_dir_prefix(vnode_id: VnodeId) -> String {
+    format!("snap_{}_", vnode_id)
+}
+
+/// Removes the directories the snapshots restored by the vnode are
+/// downloaded to, except `keep`.
+async fn remove_snapshot_dirs(path: &Path, vnode_id: VnodeId, keep: Option<&str>) {
+    let prefix = snapshot_dir_prefix(vnode_id);
+    let mut entries = match tokio::fs::read_dir(path).await {
+        Ok(entries) => entries,
+        Err(_) => return,
+    };
+    while let Ok(Some(entry)) = entries.next_entry().await {
+        let name = entry.file_name().to_string_lossy().to_string();
+        if !name.starts_with(&prefix) || keep == Some(name.as_str()) {
+            continue;
         }
+        match tokio::fs::remove_dir_all(entry.path()).await {
+            Ok(()) => info!("remove stale snapshot dir {:?}", entry.path()),
+            Err(e) => warn!("remove stale snapshot dir {:?} failed: {}", entry.path(), e),
+        }
+    }
+}
+
+/// Times the download of the snapshot into `dir` failed.
+async fn snapshot_download_attempts(dir: &Path) -> u32 {
+    tokio::fs::read_to_string(dir.join(SNAPSHOT_DOWNLOAD_ATTEMPTS_FILE))
+        .await
+        .ok()
+        .and_then(|s| s.trim().parse().ok())
+        .unwrap_or(0)
+}
+
+/// Downloads the files of the snapshot from the node of the snapshot into
+/// `dir`, returns the relative paths and the checksums of the files.
+pub async fn download_snapshot(
+    meta: &MetaRef,
+    grpc_enable_gzip: bool,
+    dir: &Path,
+    snapshot: &VnodeSnapshot,
+) -> CoordinatorResult<Vec<(PathBuf, FileChecksum)>> {
+    let channel = meta
+        .get_node_conn(snapshot.node_id)
+        .await
+        .context(MetaSnafu)?;
+    let mut client = tskv_service_time_out_client(
+        channel,
+        Duration::from_secs(60 * 60),
+        DEFAULT_GRPC_SERVER_MESSAGE_LEN,
+        grpc_enable_gzip,
+    );
+    download_snapshot_files(dir, snapshot, &mut client).await
+}
+
+async fn download_snapshot_files(
+    dir: &Path,
+    snapshot: &VnodeSnapshot,
+    client: &mut TskvServiceClient<Timeout<Channel>>,
+) -> CoordinatorResult<Vec<(PathBuf, FileChecksum)>> {
+    let src_dir = PathBuf::from(DATA_PATH)
+        .join(&snapshot.version_edit.tsf_name)
+        .join(snapshot.vnode_id.to_string());
+
+    let mut checksums = Vec::with_capacity(snapshot.version_edit.add_files.len());
+    for info in snapshot.version_edit.add_files.iter() {
+        let filename = dir.join(info.relative_path());
+        let src_filename = src_dir
+            .join(info.relative_path())
+            .to_string_lossy()
+            .to_string();
+
+        info!(
+            "begin download file {} -> {:?}, from {}",
+            src_filename, filename, snapshot.node_id
+        );
 
-        let mut file = tokio::fs::OpenOptions::new()
-            .create(true)
-            .truncate(true)
-            .read(true)
-            .write(true)
-            .open(filename)
+        let checksum = download_file(&src_filename, &filename, info.file_size, client).await?;
+        checksums.push((info.relative_path(), checksum));
+    }
+
+    Ok(checksums)
+}
+
+/// Downloads the file of `file_size` bytes, resumes from the bytes
+/// downloaded before if they are the same as the source, and verifies
+/// the checksum of the file downloaded.
+async fn download_file(
+    download: &str,
+    filename: &Path,
+    file_size: u64,
+    client: &mut TskvServiceClient<Timeout<Channel>>,
+) -> CoordinatorResult<FileChecksum> {
+    if let Some(dir) = filename.parent() {
+        tokio::fs::create_dir_all(dir)
             .await
             .context(IOErrorsSnafu)?;
+    }
 
-        let request = tonic::Request::new(DownloadFileRequest {
-            filename: download.to_string(),
+    let mut file = tokio::fs::OpenOptions::new()
+        .create(true)
+        .truncate(false)
+        .read(true)
+        .write(true)
+        .open(filename)
+        .await
+        .context(IOErrorsSnafu)?;
+
+    let mut offset = file.metadata().await.context(IOErrorsSnafu)?.len();
+    if offset > file_size {
+        offset = 0;
+    } else if offset > 0 && offset < file_size {
+        let local = FileChecksum::compute(filename, offset)
+            .await
+            .context(IOErrorsSnafu)?;
+        let remote = download_checksum(download, offset, client).await?;
+        if local != remote {
+            warn!(
+                "downloaded {} bytes of {} not match the source, download again",
+                offset, download
+            );
+            offset = 0;
+        } else {
+            info!("resume download file {} from {}", download, offset);
+        }
+    }
+    let mut retries = 0;
+    while offset < file_size {
+        // drop the bytes written partially before the stream broke
+        file.set_len(offset).await.context(IOErrorsSnafu)?;
+        file.seek(SeekFrom::Start(offset))
+            .await
+            .context(IOErrorsSnafu)?;
+        let res = download_from(download, &mut offset, &mut file, client).await;
+        let res = res.and_then(|_| {
+            if offset == file_size {
+                Ok(())
+            } else {
+                Err(CommonSnafu {
+                    msg: format!("download file length not match {} -> {}", file_size, offset),
+                }
+                .build())
+            }
         });
-        let mut resp_stream = client.download_file(request).await?.into_inner();
-        while let Some(received) = resp_stream.next().await {
-            let received = received?;
-            let data = crate::errors::decode_grpc_response(received)?;
-            file.write_all(&data).await.context(IOErrorsSnafu)?;
+        match res {
+            Ok(()) => break,
+            Err(err) if retries < MAX_DOWNLOAD_RETRIES && offset < file_size => {
+                retries += 1;
+                warn!(
+                    "download file {} broke at {}, retry {}: {}",
+                    download, offset, retries, err
+                );
+                tokio::time::sleep(DOWNLOAD_RETRY_INTERVAL).await;
+            }
+            Err(err) => return Err(err),
+        }
+    }
+    file.sync_all().await.context(IOErrorsSnafu)?;
+
+    let local = FileChecksum::compute(filename, 0)
+        .await
+        .context(IOErrorsSnafu)?;
+    let remote = download_checksum(download, 0, client).await?;
+    if local != remote || local.len != file_size {
+        // download it again from the start next time
+        file.set_len(0).await.context(IOErrorsSnafu)?;
+        return Err(CommonSnafu {
+            msg: format!(
+                "download file {} checksum not match, {:?} -> {:?}, length {}",
+                download, remote, local, file_size
+            ),
         }
+        .build());
+    }
 
-        Ok(())
+    Ok(local)
+}
+
+/// Appends the bytes of the file from `offset` to `file`, `offset` is
+/// updated to the bytes written, even if the stream broke.
+async fn download_from(
+    download: &str,
+    offset: &mut u64,
+    file: &mut tokio::fs::File,
+    client: &mut TskvServiceClient<Timeout<Channel>>,
+) -> CoordinatorResult<()> {
+    let request = tonic::Request::new(DownloadFileRequest {
+        filename: download.to_string(),
+        offset: *offset,
+        checksum: false,
+    });
+    let mut resp_stream = client.download_file(request).await?.into_inner();
+    while let Some(received) = resp_stream.next().await {
+        let received = received?;
+        let data = crate::errors::decode_grpc_response(received)?;
+        file.write_all(&data).await.context(IOErrorsSnafu)?;
+        *offset += data.len() as u64;
     }
 
-    async fn exec_apply(
-        &self,
-        ctx: &ApplyContext,
-        req: &replication::Request,
-    ) -> ReplicationResult<replication::Response> {
-        let request = parse_prost_bytes::<RaftWriteCommand>(req)
-            .map_err(|e| MsgInvalidSnafu { msg: e.to_string() }.build())?;
-        if let Some(command) = request.command {
-            self.vnode.apply(ctx, command).await.map_err(|err| {
-                ReplicationError::ApplyEngineErr {
-                    msg: err.to_string(),
-                }
-            })?;
-        }
+    Ok(())
+}
 
-        Ok(vec![])
+/// The checksum of the first `len` bytes of the source file, of the
+/// whole file if `len` is 0.
+async fn download_checksum(
+    download: &str,
+    len: u64,
+    client: &mut TskvServiceClient<Timeout<Channel>>,
+) -> CoordinatorResult<FileChecksum> {
+    let request = tonic::Request::new(DownloadFileRequest {
+        filename: download.to_string(),
+        offset: len,
+        checksum: true,
+    });
+    let mut resp_stream = client.download_file(request).await?.into_inner();
+    match resp_stream.next().await {
+        Some(received) => {
+            let data = crate::errors::decode_grpc_response(received?)?;
+            FileChecksum::decode(&data)
+        }
+        None => Err(CommonSnafu {
+            msg: format!("no checksum of download file {}", download),
+        }
+        .build()),
     }
 }
 
@@ -240,23 +469,47 @@ impl ApplyStorage for TskvEngineStorage {
             .map_err(|e| MsgInvalidSnafu { msg: e.to_string() }.build())?;
         let opt = self.storage.get_storage_options();
         let snapshot_name = format!(
-            "snap_{}_{}_{}_{}",
-            snapshot.node_id, snapshot.vnode_id, snapshot.last_seq_no, snapshot.create_time
+            "{}{}_{}_{}_{}",
+            snapshot_dir_prefix(self.vnode_id),
+            snapshot.node_id,
+            snapshot.vnode_id,
+            snapshot.last_seq_no,
+            snapshot.create_time
         );
-        let download_dir = opt.path().join(snapshot_name);
-
-        self.download_snapshot(&download_dir, &snapshot)
-            .await
-            .map_err(|err| ReplicationError::RestoreSnapshotErr {
+        let download_dir = opt.path().join(&snapshot_name);
+        // only the download of the same snapshot is resumed
+        remove_snapshot_dirs(&opt.path(), self.vnode_id, Some(&snapshot_name)).await;
+
+        if let Err(err) = self.download_snapshot(&download_dir, &snapshot).await {
+            let attempts = snapshot_download_attempts(&download_dir).await + 1;
+            if attempts < MAX_SNAPSHOT_DOWNLOAD_ATTEMPTS {
+                let _ = tokio::fs::write(
+                    download_dir.join(SNAPSHOT_DOWNLOAD_ATTEMPTS_FILE),
+                    attempts.to_string(),
+                )
+                .await;
+            } else {
+                warn!(
+                    "give up resuming the download of snapshot {:?} after {} attempts",
+                    download_dir, attempts
+                );
+                let _ = tokio::fs::remove_dir_all(&download_dir).await;
+            }
+            return Err(ReplicationError::RestoreSnapshotErr {
                 msg: err.to_string(),
-            })?;
+            });
+        }
 
-        self.vnode
+        if let Err(err) = self
+            .vnode
             .apply_snapshot(snapshot, download_dir.as_path())
             .await
-            .map_err(|err| ReplicationError::RestoreSnapshotErr {
+        {
+            let _ = tokio::fs::remove_dir_all(&download_dir).await;
+            return Err(ReplicationError::RestoreSnapshotErr {
                 msg: err.to_string(),
-            })?;
+            });
+        }
 
         tokio::fs::remove_dir_all(download_dir)
             .await
@@ -273,6 +526,8 @@ impl ApplyStorage for TskvEngineStorage {
             .map_err(|err| ReplicationError::DestoryRaftNodeErr {
                 msg: err.to_string(),
             })?;
+        let opt = self.storage.get_storage_options();
+        remove_snapshot_dirs(&opt.path(), self.vnode_id, None).await;
 
         Ok(())
     }
@@ -281,3 +536,38 @@ impl ApplyStorage for TskvEngineStorage {
         Ok(self.vnode.metrics().await)
     }
 }
+
+#[cfg(test)]
+mod test {
+    use std::path::Path;
+
+    use super::FileChecksum;
+
+    #[tokio::test]
+    async fn test_file_checksum() {
+        let dir = "/tmp/test/coordinator/raft/file_checksum";
+        let _ = std::fs::remove_dir_all(dir);
+        std::fs::create_dir_all(dir).unwrap();
+        let path = Path::new(dir).join("file");
+        let data = (0..100_000_u32).map(|i| i as u8).collect::<Vec<_>>();
+        std::fs::write(&path, &data).unwrap();
+
+        let whole = FileChecksum::compute(&path, 0).await.unwrap();
+        assert_eq!(
+            whole,
+            FileChecksum {
+                crc: crc32fast::hash(&data),
+                len: 100_000
+            }
+        );
+        let prefix = FileChecksum::compute(&path, 70_000).await.unwrap();
+        assert_eq!(prefix.crc, crc32fast::hash(&data[..70_000]));
+        assert_eq!(prefix.len, 70_000);
+        // longer than the file
+        let longer = FileChecksum::compute(&path, 200_000).await.unwrap();
+        assert_eq!(longer, whole);
+
+        assert_eq!(FileChecksum::decode(&whole.encode()).unwrap(), whole);
+        assert!(FileChecksum::decode(&[0; 4]).is_err());
+    }
+}
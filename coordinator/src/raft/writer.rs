@@ -1,5 +1,5 @@
 use std::sync::atomic::{AtomicUsize, Ordering};
-use std::sync::Arc;
+use std::sync::{Arc, OnceLock};
 use std::time::Duration;
 
 use memory_pool::MemoryPoolRef;
@@ -13,6 +13,7 @@ use snafu::{OptionExt, ResultExt};
 use trace::debug;
 
 use super::manager::RaftNodesManager;
+use crate::disk_watchdog::DiskWatchdog;
 use crate::errors::*;
 use crate::TskvLeaderCaller;
 
@@ -24,10 +25,14 @@ pub struct TskvRaftWriter {
     pub total_memory: usize,
     pub memory_pool: MemoryPoolRef,
     pub raft_manager: Arc<RaftNodesManager>,
+    pub disk_watchdog: Arc<DiskWatchdog>,
 
     pub request: RaftWriteCommand,
 
     pub counter: Arc<AtomicUsize>,
+
+    // the node acknowledged the write
+    acked_node: OnceLock<NodeId>,
 }
 
 impl TskvRaftWriter {
@@ -39,6 +44,7 @@ impl TskvRaftWriter {
         total_memory: usize,
         memory_pool: MemoryPoolRef,
         raft_manager: Arc<RaftNodesManager>,
+        disk_watchdog: Arc<DiskWatchdog>,
         request: RaftWriteCommand,
         counter: Arc<AtomicUsize>,
     ) -> TskvRaftWriter {
@@ -51,10 +57,18 @@ impl TskvRaftWriter {
             total_memory,
             memory_pool,
             raft_manager,
+            disk_watchdog,
             request,
             counter,
+            acked_node: OnceLock::new(),
         }
     }
+
+    /// The node whose vnode acknowledged the write, `None` if not written.
+    pub fn acked_node(&self) -> Option<NodeId> {
+        self.acked_node.get().copied()
+    }
+
     async fn pre_check_write_to_raft(&self, request: &RaftWriteCommand) -> CoordinatorResult<()> {
         if let Some(command) = &request.command {
             match command {
@@ -71,6 +85,8 @@ impl TskvRaftWriter {
                     {
                         return Err(MemoryExhaustedSnafu.build());
                     }
+
+                    self.disk_watchdog.check_writable()?;
                 }
 
                 raft_write_command::Command::DropTable(_request) => {}
@@ -171,6 +187,7 @@ impl TskvLeaderCaller for TskvRaftWriter {
         } else {
             self.write_to_remote(node_id).await?;
         }
+        let _ = self.acked_node.set(node_id);
 
         Ok(vec![])
     }
@@ -1,11 +1,13 @@
 #![allow(clippy::type_complexity)]
 
-use std::collections::HashMap;
+use std::borrow::Cow;
+use std::collections::{HashMap, HashSet};
 use std::fmt::Debug;
 use std::future::Future;
+use std::path::Path;
 use std::pin::Pin;
 use std::sync::atomic::AtomicUsize;
-use std::sync::Arc;
+use std::sync::{Arc, Mutex};
 use std::time::Duration;
 use std::{mem, vec};
 
@@ -14,9 +16,12 @@ use datafusion::arrow::array::{
     Array, ArrayRef, Int64Array, StringArray, TimestampMicrosecondArray, TimestampMillisecondArray,
     TimestampNanosecondArray, UInt32Array,
 };
-use datafusion::arrow::compute::take;
+use datafusion::arrow::compute::{cast, take};
 use datafusion::arrow::datatypes::{DataType, TimeUnit};
 use datafusion::arrow::record_batch::RecordBatch;
+use datafusion::scalar::ScalarValue;
+use datafusion::sql::TableReference;
+use futures::{TryFutureExt, TryStreamExt};
 use memory_pool::MemoryPoolRef;
 use meta::error::MetaError;
 use meta::model::{MetaClientRef, MetaRef};
@@ -25,16 +30,26 @@ use metrics::count::U64Counter;
 use metrics::label::Labels;
 use metrics::metric::Metric;
 use metrics::metric_register::MetricsRegister;
+use metrics::rate::{MetricRate, MetricRates};
+use models::consistency_level::WriteToken;
 use models::meta_data::{
-    ExpiredBucketInfo, NodeId, ReplicationSet, ReplicationSetId, VnodeId, VnodeStatus,
+    ExpiredBucketInfo, MetaChangeEvent, NodeId, NodeInfo, ReplicationSet, ReplicationSetId,
+    VnodeId, VnodeInfo, VnodeStatus, VnodeSummary,
 };
-use models::object_reference::ResolvedTable;
+use models::object_reference::{Resolve, ResolvedTable};
 use models::oid::Identifier;
-use models::predicate::domain::{ResolvedPredicate, ResolvedPredicateRef, TimeRange, TimeRanges};
+use models::predicate::domain::{
+    ColumnDomains, Domain, ResolvedPredicate, ResolvedPredicateRef, TimeRange, TimeRanges,
+};
+use models::predicate::PlacedSplit;
+use models::schema::database_schema::{
+    DatabaseConfigBuilder, DatabaseOptionsBuilder, DatabaseSchema,
+};
+use models::schema::ingest_rule::IngestRules;
 use models::schema::resource_info::{ResourceInfo, ResourceOperator};
-use models::schema::tskv_table_schema::{ColumnType, TskvTableSchemaRef};
-use models::schema::{DEFAULT_CATALOG, TIME_FIELD_NAME, USAGE_SCHEMA};
-use models::utils::now_timestamp_nanos;
+use models::schema::tskv_table_schema::{ColumnType, TskvTableSchema, TskvTableSchemaRef};
+use models::schema::{DEFAULT_CATALOG, POINT_TTL_TAG, TIME_FIELD_NAME};
+use models::utils::{now_timestamp_nanos, now_timestamp_secs};
 use models::{record_batch_decode, SeriesKey, Tag};
 use protocol_parser::lines_convert::{
     arrow_array_to_points, line_to_batches, mutable_batches_to_point,
@@ -43,19 +58,29 @@ use protocol_parser::Line;
 use protos::kv_service::admin_command::Command::*;
 use protos::kv_service::*;
 use replication::multi_raft::MultiRaft;
+use replication::CommittedLog;
 use snafu::{IntoError, OptionExt, ResultExt};
 use tokio::runtime::Runtime;
+use tokio::sync::broadcast::error::RecvError;
 use trace::span_ext::SpanExt;
-use trace::{debug, error, info, Span, SpanContext};
-use tskv::EngineRef;
+use trace::{debug, error, info, warn, Span, SpanContext};
+use tskv::{EngineRef, VnodeTagValues};
+use utils::duration::CnosDuration;
 use utils::precision::{timestamp_convert, Precision};
-use utils::BkdrHasher;
+use utils::{BkdrHasher, HyperLogLog};
 
+use crate::backup::{self, BackupManifest};
+use crate::change_feed::ChangeFeed;
+use crate::disk_watchdog::DiskWatchdog;
 use crate::errors::{
     ArrowSnafu, BincodeSerdeSnafu, ColumnNotFoundSnafu, CommonSnafu, CoordinatorError,
-    CoordinatorResult, FieldsIsEmptySnafu, MetaSnafu,
+    CoordinatorResult, FieldsIsEmptySnafu, MetaSnafu, ModelsSnafu,
+};
+use crate::materialized_view::{
+    deleted_ranges, ViewMarks, WrittenBuckets, MARK_REUSE, REFRESH_DELAY,
 };
 use crate::metrics::LPReporter;
+use crate::mirror::WriteMirror;
 use crate::raft::manager::RaftNodesManager;
 use crate::raft::writer::TskvRaftWriter;
 use crate::reader::table_scan::opener::TemporaryTableScanOpener;
@@ -65,7 +90,7 @@ use crate::resource_manager::ResourceManager;
 use crate::tskv_executor::{TskvAdminRequest, TskvLeaderExecutor};
 use crate::{
     get_replica_all_info, get_vnode_all_info, Coordinator, QueryOption, ReplicationCmdType,
-    SendableCoordinatorRecordBatchStream,
+    SendableCoordinatorRecordBatchStream, SeriesSketches,
 };
 
 pub type CoordinatorRef = Arc<dyn Coordinator>;
@@ -76,12 +101,20 @@ pub struct CoordService {
     meta: MetaRef,
     config: Config,
     writer_count: Arc<AtomicUsize>,
+    // database owner -> (second, points written in the second)
+    write_rates: Arc<Mutex<HashMap<String, (i64, u64)>>>,
+    // rates of the counters between the last two samples of the monitor
+    metric_rates: Arc<Mutex<MetricRates>>,
 
     runtime: Arc<Runtime>,
     kv_inst: Option<EngineRef>,
     memory_pool: MemoryPoolRef,
     metrics: Arc<CoordServiceMetrics>,
     raft_manager: Arc<RaftNodesManager>,
+    mirror: Option<Arc<WriteMirror>>,
+    change_feed: Option<Arc<ChangeFeed>>,
+    disk_watchdog: Arc<DiskWatchdog>,
+    view_marks: Arc<ViewMarks>,
 }
 
 #[derive(Debug)]
@@ -165,10 +198,17 @@ impl CoordService {
         memory_pool: MemoryPoolRef,
         metrics_register: Arc<MetricsRegister>,
     ) -> Arc<Self> {
+        // the vnodes log the writes they apply
+        let change_feed = config
+            .change_feed
+            .enabled
+            .then(|| ChangeFeed::new(config.change_feed.clone()));
+
         let raft_manager = Arc::new(RaftNodesManager::new(
             config.clone(),
             meta.clone(),
             kv_inst.clone(),
+            change_feed.clone(),
             metrics_register.clone(),
         ));
         RaftNodesManager::start_all_raft_node(runtime.clone(), raft_manager.clone())
@@ -180,8 +220,18 @@ impl CoordService {
             config.cluster.trigger_snapshot_interval,
         ));
 
+        let mirror = config.mirror.enabled.then(|| {
+            WriteMirror::start(&config.mirror, metrics_register.as_ref())
+                .unwrap_or_else(|e| panic!("failed to start the write mirror: {}", e))
+        });
+
+        let disk_watchdog = Arc::new(DiskWatchdog::new(&config, metrics_register.as_ref()));
+
         let coord = Arc::new(Self {
             runtime,
+            mirror,
+            change_feed,
+            disk_watchdog,
             kv_inst,
             memory_pool,
             raft_manager,
@@ -190,34 +240,137 @@ impl CoordService {
             node_id: config.global.node_id,
             metrics: Arc::new(CoordServiceMetrics::new(metrics_register.as_ref())),
             writer_count: Arc::new(AtomicUsize::new(0)),
+            write_rates: Arc::new(Mutex::new(HashMap::new())),
+            metric_rates: Arc::new(Mutex::new(MetricRates::default())),
+            view_marks: Arc::new(ViewMarks::default()),
         });
 
-        tokio::spawn(CoordService::db_ttl_service(coord.clone()));
+        if config.retention.enabled {
+            tokio::spawn(CoordService::db_ttl_service(coord.clone()));
+        }
+
+        if !config.cluster.node_check_interval.is_zero() {
+            tokio::spawn(CoordService::node_check_service(coord.clone()));
+        }
+
+        if coord.kv_inst.is_some() {
+            tokio::spawn(CoordService::database_usage_service(coord.clone()));
+        }
+
+        if config.disk_watchdog.enabled && coord.kv_inst.is_some() {
+            tokio::spawn(coord.disk_watchdog.clone().run());
+        }
 
         if config.global.pre_create_bucket {
             tokio::spawn(CoordService::pre_create_bucket_service(coord.clone()));
         }
 
-        if config.global.store_metrics {
-            tokio::spawn(CoordService::metrics_service(
-                coord.clone(),
-                metrics_register,
-            ));
-        }
+        tokio::spawn(CoordService::metrics_service(
+            coord.clone(),
+            metrics_register,
+        ));
 
         coord
     }
 
+    /// Probe the grpc port of the other data nodes, so requests skip a node
+    /// that is down at once instead of waiting for the request timeout,
+    /// and go back to it as soon as it answers again.
+    async fn node_check_service(coord: Arc<CoordService>) {
+        let check_timeout = coord.config.cluster.node_check_timeout;
+        let mut interval = tokio::time::interval(coord.config.cluster.node_check_interval);
+        interval.set_missed_tick_behavior(tokio::time::MissedTickBehavior::Delay);
+        loop {
+            interval.tick().await;
+
+            let nodes = coord.meta.data_nodes().await;
+            let checks = nodes
+                .into_iter()
+                .filter(|node| node.id != coord.node_id)
+                .map(|node| async move {
+                    let connect = tokio::net::TcpStream::connect(node.grpc_addr.as_str());
+                    let alive = matches!(
+                        tokio::time::timeout(check_timeout, connect).await,
+                        Ok(Ok(_))
+                    );
+                    (node, alive)
+                });
+
+            for (node, alive) in futures::future::join_all(checks).await {
+                if alive {
+                    if let Some(down_time) = coord.meta.mark_node_up(node.id) {
+                        info!(
+                            "Data node {}({}) is back after {:?}",
+                            node.id, node.grpc_addr, down_time
+                        );
+                    }
+                } else if coord.meta.mark_node_down(node.id) {
+                    warn!("Data node {}({}) is down", node.id, node.grpc_addr);
+                }
+            }
+        }
+    }
+
     async fn db_ttl_service(coord: Arc<CoordService>) {
+        let dry_run = coord.config.retention.dry_run;
+        let interval = coord.config.retention.check_interval;
+        let mut next_check = tokio::time::Instant::now() + interval;
+        let mut meta_events = coord.meta.subscribe();
         loop {
-            let dur = tokio::time::Duration::from_secs(60);
-            tokio::time::sleep(dur).await;
+            // Check on every interval, and also right after a database is
+            // altered, so a shortened ttl takes effect immediately.
+            tokio::select! {
+                _ = tokio::time::sleep_until(next_check) => {}
+                event = meta_events.recv() => match event {
+                    Ok(MetaChangeEvent::DatabaseAltered { .. }) | Err(RecvError::Lagged(_)) => {}
+                    Ok(_) => continue,
+                    Err(RecvError::Closed) => tokio::time::sleep_until(next_check).await,
+                }
+            }
+            next_check = tokio::time::Instant::now() + interval;
 
-            let expired = coord.meta.expired_bucket().await;
+            coord.delete_expired_points(dry_run).await;
+
+            let expired = coord
+                .meta
+                .expired_bucket(coord.config.retention.local_ttl)
+                .await;
             for info in expired.iter() {
-                let result = coord.delete_expired_bucket(info).await;
+                let result = sweep_expired(dry_run, coord.delete_expired_bucket(info)).await;
+
+                let replica_ids = info
+                    .bucket
+                    .shard_group
+                    .iter()
+                    .map(|r| r.id)
+                    .collect::<Vec<_>>();
+                info!(
+                    target: "retention_audit",
+                    dry_run,
+                    tenant = info.tenant.as_str(),
+                    database = info.database.as_str(),
+                    bucket_id = info.bucket.id,
+                    replica_ids = ?replica_ids,
+                    result = ?result,
+                    "delete expired bucket, time range [{}, {}) ends before {}",
+                    info.bucket.start_time,
+                    info.bucket.end_time,
+                    info.expired_before,
+                );
+            }
+        }
+    }
+
+    async fn database_usage_service(coord: Arc<CoordService>) {
+        loop {
+            let dur = tokio::time::Duration::from_secs(60);
+            tokio::time::sleep(dur).await;
 
-                info!("delete expired bucket :{:?}, {:?}", info, result);
+            if let Some(kv_inst) = coord.kv_inst.clone() {
+                let usages = kv_inst.get_database_usages().await;
+                if let Err(e) = coord.meta.report_database_usages(usages).await {
+                    error!("report database usages failed: {}", e);
+                }
             }
         }
     }
@@ -257,27 +410,559 @@ impl CoordService {
         }
     }
 
+    /// Samples the metrics every interval of the monitor to compute the
+    /// rates of the counters, and stores them if `store_metrics` is enabled.
     async fn metrics_service(
         coord: Arc<CoordService>,
         root_metrics_register: Arc<MetricsRegister>,
     ) {
-        let start = tokio::time::Instant::now() + Duration::from_secs(10);
-        let interval = Duration::from_secs(10);
-        let mut intv = tokio::time::interval_at(start, interval);
+        let monitor = coord.config.monitor.clone();
+        let store_metrics = coord.config.global.store_metrics;
+        if store_metrics {
+            if let Err(e) = coord.prepare_monitor_database().await {
+                error!(
+                    "prepare database {} of tenant {} to store metrics fail. {e}",
+                    monitor.database, DEFAULT_CATALOG
+                );
+            }
+        }
+
+        let start = tokio::time::Instant::now() + monitor.interval;
+        let mut intv = tokio::time::interval_at(start, monitor.interval);
+        let mut tick = 0_u64;
         loop {
             intv.tick().await;
+            tick += 1;
+            coord
+                .metric_rates
+                .lock()
+                .unwrap()
+                .sample(root_metrics_register.as_ref());
+            if !store_metrics {
+                continue;
+            }
+
             let mut lines_buffer = Vec::new();
             let mut reporter = LPReporter::new(&mut lines_buffer);
             root_metrics_register.report(&mut reporter);
+            lines_buffer.retain(|l| monitor.stores_at(l.measure(), tick));
+            if lines_buffer.is_empty() {
+                continue;
+            }
 
             let lines = lines_buffer.iter().map(|l| l.to_line()).collect::<Vec<_>>();
             if let Err(e) = coord
-                .write_lines(DEFAULT_CATALOG, USAGE_SCHEMA, Precision::NS, lines, None)
+                .write_lines(
+                    DEFAULT_CATALOG,
+                    &monitor.database,
+                    Precision::NS,
+                    lines,
+                    None,
+                )
                 .await
             {
-                error!("write metrics to {DEFAULT_CATALOG} fail. {e}")
+                error!("write metrics to {} fail. {e}", monitor.database)
+            }
+        }
+    }
+
+    /// Creates the database storing the metrics if not exists, and sets its
+    /// ttl if configured.
+    async fn prepare_monitor_database(&self) -> CoordinatorResult<()> {
+        let monitor = &self.config.monitor;
+        let ttl = if monitor.ttl.is_empty() {
+            None
+        } else {
+            Some(CnosDuration::new(&monitor.ttl).ok_or_else(|| {
+                CommonSnafu {
+                    msg: format!("invalid ttl of monitor: {}", monitor.ttl),
+                }
+                .build()
+            })?)
+        };
+        let meta_client = self.tenant_meta(DEFAULT_CATALOG).await.ok_or_else(|| {
+            CoordinatorError::TenantNotFound {
+                name: DEFAULT_CATALOG.to_string(),
+            }
+        })?;
+
+        match meta_client
+            .get_db_schema(&monitor.database)
+            .context(MetaSnafu)?
+        {
+            Some(mut schema) => {
+                if let Some(ttl) = ttl {
+                    if *schema.options.ttl() != ttl {
+                        schema.options.set_ttl(ttl);
+                        meta_client
+                            .alter_db_schema(schema)
+                            .await
+                            .context(MetaSnafu)?;
+                    }
+                }
+            }
+            None => {
+                let mut options = DatabaseOptionsBuilder::new();
+                if let Some(ttl) = ttl {
+                    options.with_ttl(ttl);
+                }
+                let schema = DatabaseSchema::new(
+                    DEFAULT_CATALOG,
+                    &monitor.database,
+                    options.build(),
+                    Arc::new(DatabaseConfigBuilder::new().build(self.config.clone())),
+                );
+                match meta_client.create_db(schema).await {
+                    // created by another node at the same time
+                    Ok(()) | Err(MetaError::DatabaseAlreadyExists { .. }) => {}
+                    Err(e) => return Err(e).context(MetaSnafu),
+                }
+                info!(
+                    "created database {} of tenant {} to store metrics",
+                    monitor.database, DEFAULT_CATALOG
+                );
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Tags the points of the tables with a `sequence_tag` ingest rule with
+    /// their sequence, if the series and the timestamp of the point are
+    /// taken by a stored point or an earlier point of the write, so that
+    /// they are not overwritten.
+    ///
+    /// The sequences are assigned before the points are replicated, so that
+    /// the replicas store the same series.
+    async fn assign_sequence_tags(
+        &self,
+        meta_client: &MetaClientRef,
+        db_schema: &DatabaseSchema,
+        precision: Precision,
+        lines: &mut [Line<'_>],
+    ) -> CoordinatorResult<()> {
+        let rules = db_schema.options().ingest_rules();
+        // the sequence tag and the lines without it of each table
+        let mut tables: HashMap<String, (String, Vec<usize>)> = HashMap::new();
+        for (i, line) in lines.iter().enumerate() {
+            let Some(tag) = rules.sequence_tag(&line.table) else {
+                continue;
+            };
+            if line.tags.iter().any(|(k, _)| k.as_ref() == tag) {
+                continue;
+            }
+            tables
+                .entry(line.table.to_string())
+                .or_insert_with(|| (tag.to_string(), vec![]))
+                .1
+                .push(i);
+        }
+
+        let (tenant, db) = (db_schema.tenant_name(), db_schema.database_name());
+        for (table, (tag, indices)) in tables {
+            let table_schema = meta_client
+                .get_tskv_table_schema(db, &table)
+                .context(MetaSnafu)?;
+            let table_precision = match &table_schema {
+                Some(schema) => schema.time_column_precision(),
+                None => *db_schema.config.precision(),
+            };
+
+            let mut timestamps = Vec::with_capacity(indices.len());
+            for &i in &indices {
+                let ts = timestamp_convert(precision, table_precision, lines[i].timestamp)
+                    .ok_or_else(|| {
+                        CommonSnafu {
+                            msg: "timestamp overflow".to_string(),
+                        }
+                        .build()
+                    })?;
+                timestamps.push(ts);
+            }
+
+            // the taken sequences of each series without the sequence tag and
+            // timestamp, the points without the sequence tag are sequence 0
+            let mut taken = match table_schema {
+                Some(schema) => {
+                    let min_ts = timestamps.iter().min().copied().unwrap_or_default();
+                    let max_ts = timestamps.iter().max().copied().unwrap_or_default();
+                    self.stored_sequences(tenant, db, schema, &tag, min_ts, max_ts)
+                        .await?
+                }
+                None => HashSet::new(),
+            };
+
+            for (i, ts) in indices.into_iter().zip(timestamps) {
+                let line = &mut lines[i];
+                let mut series = line
+                    .tags
+                    .iter()
+                    .map(|(k, v)| (k.to_string(), v.to_string()))
+                    .collect::<Vec<_>>();
+                series.sort();
+                let mut seq = 0_usize;
+                while taken.contains(&(series.clone(), ts, seq)) {
+                    seq += 1;
+                }
+                taken.insert((series, ts, seq));
+                if seq > 0 {
+                    line.tags
+                        .push((Cow::Owned(tag.clone()), Cow::Owned(seq.to_string())));
+                    line.hash_id = 0;
+                    line.init_hash_id();
+                }
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Scans the sequences of the series stored in the table between
+    /// `min_ts` and `max_ts`, by the series without the sequence tag and the
+    /// timestamp.
+    async fn stored_sequences(
+        &self,
+        tenant: &str,
+        db: &str,
+        table: TskvTableSchemaRef,
+        tag: &str,
+        min_ts: i64,
+        max_ts: i64,
+    ) -> CoordinatorResult<HashSet<(Vec<(String, String)>, i64, usize)>> {
+        let mut columns = vec![table.time_column()];
+        columns.extend(
+            table
+                .tag_indices()
+                .into_iter()
+                .filter_map(|i| table.column_by_index(i).cloned()),
+        );
+        let proj_table = Arc::new(TskvTableSchema::new(
+            table.tenant.clone(),
+            table.db.clone(),
+            table.name.clone(),
+            columns,
+        ));
+        let schema = proj_table.to_arrow_schema();
+
+        let time_ranges = TimeRanges::new(vec![TimeRange::new(min_ts, max_ts)]);
+        let predicate = Arc::new(
+            ResolvedPredicate::new(Arc::new(time_ranges), ColumnDomains::all(), None)
+                .context(ModelsSnafu)?,
+        );
+        let resolved_table = TableReference::bare(table.name.as_str())
+            .resolve_object(tenant, db)
+            .map_err(|e| CommonSnafu { msg: e.to_string() }.build())?;
+        let shards = self
+            .table_vnodes(&resolved_table, predicate.clone())
+            .await?;
+
+        let mut taken = HashSet::new();
+        for (idx, shard) in shards.into_iter().enumerate() {
+            let split = PlacedSplit::new(idx, predicate.clone(), None, shard);
+            let option = QueryOption::new(
+                4096,
+                split,
+                None,
+                schema.clone(),
+                proj_table.clone(),
+                table.meta(),
+            );
+            let mut stream = self.table_scan(option, None)?;
+            while let Some(batch) = stream.try_next().await? {
+                let times = cast(batch.column(0), &DataType::Int64).context(ArrowSnafu)?;
+                let times = times.as_any().downcast_ref::<Int64Array>().ok_or_else(|| {
+                    CommonSnafu {
+                        msg: "time column is not a timestamp".to_string(),
+                    }
+                    .build()
+                })?;
+                let tags = (1..batch.num_columns())
+                    .map(|i| {
+                        let name = schema.field(i).name().as_str();
+                        let values = batch.column(i).as_any().downcast_ref::<StringArray>();
+                        values.map(|values| (name, values)).ok_or_else(|| {
+                            CommonSnafu {
+                                msg: format!("tag column {} is not a string", name),
+                            }
+                            .build()
+                        })
+                    })
+                    .collect::<CoordinatorResult<Vec<_>>>()?;
+
+                for row in 0..batch.num_rows() {
+                    let mut seq = Some(0);
+                    let mut series = vec![];
+                    for (name, values) in &tags {
+                        if values.is_null(row) {
+                            continue;
+                        }
+                        if *name == tag {
+                            seq = values.value(row).parse::<usize>().ok();
+                        } else {
+                            series.push((name.to_string(), values.value(row).to_string()));
+                        }
+                    }
+                    // the sequences not written by the rule never collide
+                    if let Some(seq) = seq {
+                        series.sort();
+                        taken.insert((series, times.value(row), seq));
+                    }
+                }
+            }
+        }
+
+        Ok(taken)
+    }
+
+    /// Checks the point ttls written are durations, the points are deleted
+    /// by the retention service once the ttls passed.
+    fn check_point_ttls(lines: &[Line<'_>]) -> CoordinatorResult<()> {
+        for line in lines {
+            if let Some((_, ttl)) = line.tags.iter().find(|(k, _)| k == POINT_TTL_TAG) {
+                if CnosDuration::new(ttl).is_none() {
+                    return Err(CommonSnafu {
+                        msg: format!(
+                            "invalid {} '{}', expect a duration like '1h'",
+                            POINT_TTL_TAG, ttl
+                        ),
+                    }
+                    .build());
+                }
+            }
+        }
+        Ok(())
+    }
+
+    /// Deletes the points whose POINT_TTL_TAG has passed. The ttls are the
+    /// values of the tag in the indexes of the vnodes on this node, each
+    /// replication set is checked by the node of its leader, and the vnodes
+    /// whose bucket starts after the ttl has no point to delete.
+    async fn delete_expired_points(&self, dry_run: bool) {
+        let Some(kv_inst) = &self.kv_inst else {
+            return;
+        };
+        let tag_values = match kv_inst.get_tag_values(POINT_TTL_TAG).await {
+            Ok(tag_values) => tag_values,
+            Err(e) => {
+                error!("failed to get the values of {}: {}", POINT_TTL_TAG, e);
+                return;
+            }
+        };
+
+        for VnodeTagValues {
+            tenant,
+            database: db,
+            vnode_id,
+            table,
+            values: ttls,
+        } in tag_values
+        {
+            let Some(meta) = self.meta.tenant_meta(&tenant).await else {
+                continue;
+            };
+            let (Some(vnode), Ok(Some(db_schema))) =
+                (meta.get_vnode_all_info(vnode_id), meta.get_db_schema(&db))
+            else {
+                continue;
+            };
+            let replica = match meta.get_replica_all_info(vnode.repl_set_id) {
+                Some(replica) if replica.replica_set.leader_node_id == self.node_id => {
+                    replica.replica_set
+                }
+                _ => continue,
+            };
+
+            let precision = *db_schema.config.precision();
+            let now = timestamp_convert(Precision::NS, precision, now_timestamp_nanos())
+                .unwrap_or(i64::MAX);
+            for ttl in ttls {
+                let expired_before = match CnosDuration::new(&ttl) {
+                    Some(duration) => now.saturating_sub(duration.to_precision(precision)),
+                    None => continue,
+                };
+                if vnode.start_time >= expired_before {
+                    continue;
+                }
+                if dry_run {
+                    info!(
+                        target: "retention_audit",
+                        dry_run,
+                        tenant = tenant.as_str(),
+                        database = db.as_str(),
+                        table = table.as_str(),
+                        vnode_id,
+                        ttl = ttl.as_str(),
+                        "delete points with expired ttl before {}",
+                        expired_before,
+                    );
+                }
+                let delete = async {
+                    match point_ttl_predicate(&ttl, expired_before) {
+                        Ok(predicate) => {
+                            self.delete_from_replica(&tenant, &db, &table, &replica, &predicate)
+                                .await
+                        }
+                        Err(e) => Err(e),
+                    }
+                };
+                let result = sweep_expired(dry_run, delete).await;
+                if let Err(e) = result {
+                    error!(
+                        "failed to delete points of {}.{}.{} in replica {} with expired {} '{}': {}",
+                        tenant, db, table, replica.id, POINT_TTL_TAG, ttl, e
+                    );
+                }
+            }
+        }
+    }
+
+    async fn delete_from_replica(
+        &self,
+        tenant: &str,
+        db: &str,
+        table: &str,
+        replica: &ReplicationSet,
+        predicate: &ResolvedPredicate,
+    ) -> CoordinatorResult<()> {
+        let request = DeleteFromTableRequest {
+            tenant: tenant.to_string(),
+            database: db.to_string(),
+            table: table.to_string(),
+            predicate: bincode::serialize(predicate).context(BincodeSerdeSnafu)?,
+            vnode_id: 0,
+        };
+        let command = RaftWriteCommand {
+            replica_id: replica.id,
+            tenant: tenant.to_string(),
+            db_name: db.to_string(),
+            command: Some(raft_write_command::Command::DeleteFromTable(request)),
+        };
+
+        // stale while deleted, and refreshed after the delete is done
+        self.mark_deleted_views(tenant, db, table, predicate)
+            .await?;
+        self.write_replica_by_raft(replica.clone(), command, None)
+            .await?;
+        self.mark_deleted_views(tenant, db, table, predicate).await
+    }
+
+    /// Marks the ranges of the materialized views of the table covering the
+    /// points deleted stale.
+    async fn mark_deleted_views(
+        &self,
+        tenant: &str,
+        db: &str,
+        table: &str,
+        predicate: &ResolvedPredicate,
+    ) -> CoordinatorResult<()> {
+        let meta_client = self.meta.tenant_meta(tenant).await.ok_or_else(|| {
+            CoordinatorError::TenantNotFound {
+                name: tenant.to_string(),
+            }
+        })?;
+        let Some(db_schema) = meta_client.get_db_schema(db).context(MetaSnafu)? else {
+            return Ok(());
+        };
+        let marks = deleted_ranges(
+            &db_schema,
+            table,
+            &predicate.time_ranges(),
+            now_timestamp_nanos(),
+        );
+        if marks.is_empty() {
+            return Ok(());
+        }
+        meta_client
+            .mark_materialized_views(db, marks)
+            .await
+            .context(MetaSnafu)
+    }
+
+    /// Marks the buckets of the materialized views written stale, unless
+    /// this node marked them in the last `reuse` nanoseconds.
+    async fn mark_written_views(
+        &self,
+        meta_client: &MetaClientRef,
+        tenant: &str,
+        db: &str,
+        written: &WrittenBuckets<'_>,
+        reuse: i64,
+    ) -> CoordinatorResult<()> {
+        let now = now_timestamp_nanos();
+        let marks = self
+            .view_marks
+            .unmarked(tenant, db, written, now.saturating_sub(reuse), now);
+        if marks.is_empty() {
+            return Ok(());
+        }
+        meta_client
+            .mark_materialized_views(db, marks.clone())
+            .await
+            .context(MetaSnafu)?;
+        self.view_marks.remember(tenant, db, written, &marks);
+        Ok(())
+    }
+
+    /// Checks the quota of the database and reserves the points in its
+    /// write rate, the reservation is refunded unless it is committed after
+    /// the write succeeded.
+    fn check_database_quota(
+        &self,
+        db_schema: &DatabaseSchema,
+        points: u64,
+    ) -> CoordinatorResult<Option<WriteRateReservation>> {
+        let quota = db_schema.options().quota();
+        if quota.is_empty() {
+            return Ok(None);
+        }
+
+        let exceeded = |quota: &str, usage: u64, limit: u64| {
+            Err(CoordinatorError::DatabaseQuotaExceeded {
+                database: db_schema.database_name().to_string(),
+                quota: quota.to_string(),
+                usage,
+                limit,
+            })
+        };
+
+        let owner = db_schema.owner();
+        let usage = self
+            .meta
+            .database_usage(&owner, db_schema.options().replica());
+        if let Some(limit) = quota.max_disk_size {
+            if usage.disk_size >= limit {
+                return exceeded("max_disk_size", usage.disk_size, limit);
+            }
+        }
+        if let Some(limit) = quota.max_series {
+            if usage.series >= limit {
+                return exceeded("max_series", usage.series, limit);
             }
         }
+        let Some(limit) = quota.max_writes_per_sec else {
+            return Ok(None);
+        };
+        // checked and reserved under the lock, so the concurrent writes don't
+        // overshoot the limit together
+        let now = now_timestamp_secs();
+        let mut write_rates = self.write_rates.lock().unwrap();
+        let (second, count) = write_rates.entry(owner.clone()).or_insert((now, 0));
+        if *second != now {
+            *second = now;
+            *count = 0;
+        }
+        if *count + points > limit {
+            return exceeded("max_writes_per_sec", *count + points, limit);
+        }
+        *count += points;
+
+        Ok(Some(WriteRateReservation {
+            write_rates: self.write_rates.clone(),
+            owner,
+            second: now,
+            points,
+            committed: false,
+        }))
     }
 
     async fn delete_expired_bucket(&self, info: &ExpiredBucketInfo) -> CoordinatorResult<()> {
@@ -361,6 +1046,37 @@ impl CoordService {
         }
     }
 
+    /// Writes to the leader of the replication set, returns the vnode
+    /// acknowledged the write.
+    async fn write_replica_acked(
+        &self,
+        replica: ReplicationSet,
+        request: RaftWriteCommand,
+    ) -> CoordinatorResult<VnodeId> {
+        if replica
+            .vnodes
+            .iter()
+            .any(|vnode| vnode.status == VnodeStatus::Frozen)
+        {
+            return Err(CoordinatorError::ReplicaFrozen { id: replica.id });
+        }
+
+        let tenant = request.tenant.clone();
+        let writer = self.tskv_raft_writer(request);
+        let executor = TskvLeaderExecutor {
+            meta: self.meta.clone(),
+        };
+
+        executor.do_request(&tenant, &replica, &writer).await?;
+
+        // the vnode of the node acknowledged the write, the leader if unknown
+        let vnode_id = writer
+            .acked_node()
+            .and_then(|node_id| replica.vnodes.iter().find(|v| v.node_id == node_id))
+            .map_or(replica.leader_vnode_id, |vnode| vnode.id);
+        Ok(vnode_id)
+    }
+
     async fn push_points_to_requests<'a>(
         &'a self,
         tenant: &'a str,
@@ -368,19 +1084,23 @@ impl CoordService {
         precision: Precision,
         info: ReplicationSet,
         points: Arc<Vec<u8>>,
+        limited: bool,
         span_ctx: Option<&'a SpanContext>,
-    ) -> CoordinatorResult<Vec<impl Future<Output = CoordinatorResult<()>> + Sized + 'a>> {
+    ) -> CoordinatorResult<
+        Vec<impl Future<Output = CoordinatorResult<(ReplicationSetId, VnodeId)>> + Sized + 'a>,
+    > {
         {
             let _span = Span::from_context("limit check", span_ctx);
 
-            let limiter = self.meta.limiter(tenant).await.context(MetaSnafu)?;
             let write_size = points.len();
-
-            limiter.check_coord_writes().await.context(MetaSnafu)?;
-            limiter
-                .check_coord_data_in(write_size)
-                .await
-                .context(MetaSnafu)?;
+            if limited {
+                let limiter = self.meta.limiter(tenant).await.context(MetaSnafu)?;
+                limiter.check_coord_writes().await.context(MetaSnafu)?;
+                limiter
+                    .check_coord_data_in(write_size)
+                    .await
+                    .context(MetaSnafu)?;
+            }
 
             self.metrics.coord_writes(tenant, db).inc_one();
             self.metrics
@@ -394,11 +1114,14 @@ impl CoordService {
             .build());
         }
 
-        let mut requests: Vec<Pin<Box<dyn Future<Output = Result<(), CoordinatorError>> + Send>>> =
-            Vec::new();
+        let mut requests: Vec<
+            Pin<Box<dyn Future<Output = CoordinatorResult<(ReplicationSetId, VnodeId)>> + Send>>,
+        > = Vec::new();
         let request = WriteDataRequest {
             precision: precision as u32,
             data: Arc::unwrap_or_clone(points),
+            // the writes not limited move the points written before
+            copied: !limited,
         };
         let request = RaftWriteCommand {
             replica_id: info.id,
@@ -408,30 +1131,290 @@ impl CoordService {
             command: Some(raft_write_command::Command::WriteData(request)),
         };
 
-        let request = self.write_replica_by_raft(info.clone(), request, span_ctx);
+        let replica_id = info.id;
+        let request = self
+            .write_replica_acked(info, request)
+            .map_ok(move |vnode_id| (replica_id, vnode_id));
         requests.push(Box::pin(request));
 
         Ok(requests)
     }
 
-    async fn admin_command_on_leader(
+    /// Writes the record batch, the limits of the writes of the users are
+    /// checked and the write is forwarded by the mirror if `limited`. The
+    /// other writes move the points written before, e.g. splitting a bucket.
+    async fn write_record_batch_limited(
         &self,
-        replica: ReplicationSet,
-        request: AdminCommand,
-    ) -> CoordinatorResult<()> {
-        let tenant = request.tenant.clone();
-        let caller = TskvAdminRequest {
-            request,
-            meta: self.meta.clone(),
-            timeout: Duration::from_secs(3600),
-            enable_gzip: self.config.service.grpc_enable_gzip,
-        };
-        let executor = TskvLeaderExecutor {
-            meta: self.meta.clone(),
-        };
-        executor.do_request(&tenant, &replica, &caller).await?;
-        Ok(())
-    }
+        table_schema: TskvTableSchemaRef,
+        record_batch: RecordBatch,
+        db_precision: Precision,
+        limited: bool,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<usize> {
+        let pre_write_start = std::time::Instant::now();
+
+        let mut write_bytes: usize = 0;
+        let mut precision = Precision::NS;
+        let tenant = table_schema.tenant.as_str();
+        let db = table_schema.db.as_str();
+        let meta_client = self.meta.tenant_meta(tenant).await.ok_or_else(|| {
+            CoordinatorError::TenantNotFound {
+                name: tenant.to_string(),
+            }
+        })?;
+        let db_schema = meta_client.get_db_schema(db).context(MetaSnafu)?;
+        let mut time_range = (i64::MIN, i64::MAX);
+        let mut reservation = None;
+        if let (true, Some(db_schema)) = (limited, &db_schema) {
+            reservation = self.check_database_quota(db_schema, record_batch.num_rows() as u64)?;
+            time_range = db_schema.time_range_to_write();
+        }
+        let mut written_buckets = db_schema.as_ref().map(WrittenBuckets::new);
+
+        let mut repl_idx: HashMap<ReplicationSet, Vec<u32>> = HashMap::new();
+        let schema = record_batch.schema().fields.clone();
+        let table_name = table_schema.name.as_str();
+        let columns = record_batch.columns();
+        for idx in 0..record_batch.num_rows() {
+            let mut hasher = BkdrHasher::new();
+            hasher.hash_with(table_name.as_bytes());
+            let mut ts = i64::MAX;
+            let mut has_ts = false;
+            let mut has_fileds = false;
+            for (column, schema) in columns.iter().zip(schema.iter()) {
+                let name = schema.name().as_str();
+                let tskv_schema_column = table_schema.column(name).ok_or_else(|| {
+                    CommonSnafu {
+                        msg: format!("column {} not found in table {}", name, table_name),
+                    }
+                    .build()
+                })?;
+                if name == TIME_FIELD_NAME {
+                    let precsion_and_value =
+                        get_precision_and_value_from_arrow_column(column, idx)?;
+                    precision = precsion_and_value.0;
+                    ts = timestamp_convert(precision, db_precision, precsion_and_value.1)
+                        .ok_or_else(|| {
+                            CommonSnafu {
+                                msg: "timestamp overflow".to_string(),
+                            }
+                            .build()
+                        })?;
+                    check_timestamp_range(db, ts, time_range.0, time_range.1)?;
+                    has_ts = true;
+                }
+                if matches!(tskv_schema_column.column_type, ColumnType::Tag) {
+                    let value = column
+                        .as_any()
+                        .downcast_ref::<StringArray>()
+                        .ok_or_else(|| {
+                            CommonSnafu {
+                                msg: format!("column {} is not StringArray", name),
+                            }
+                            .build()
+                        })?
+                        .value(idx);
+                    hasher.hash_with(name.as_bytes());
+                    hasher.hash_with(value.as_bytes());
+                }
+
+                if let ColumnType::Field(_) = tskv_schema_column.column_type {
+                    if !column.is_null(idx) {
+                        has_fileds = true;
+                    }
+                }
+            }
+
+            if !has_ts {
+                return Err(CommonSnafu {
+                    msg: format!(
+                        "column {} not found in table {}",
+                        TIME_FIELD_NAME, table_name
+                    ),
+                }
+                .build());
+            }
+
+            if !has_fileds {
+                return Err(FieldsIsEmptySnafu.build());
+            }
+            if let Some(written_buckets) = written_buckets.as_mut() {
+                written_buckets.add(table_name, ts);
+            }
+
+            let hash = hasher.number();
+            let info = meta_client
+                .locate_replication_set_for_write(db, hash, ts)
+                .await
+                .context(MetaSnafu)?;
+            repl_idx.entry(info).or_default().push(idx as u32);
+        }
+
+        let mut requests = Vec::new();
+        for (repl, idxs) in repl_idx {
+            let indices = UInt32Array::from(idxs);
+            let columns = record_batch
+                .columns()
+                .iter()
+                .map(|column| {
+                    take(column, &indices, None).map_err(|e| {
+                        CommonSnafu {
+                            msg: format!("take column error: {}", e),
+                        }
+                        .build()
+                    })
+                })
+                .collect::<Result<Vec<_>, _>>()?;
+            let schema = record_batch.schema();
+            let points = Arc::new(
+                arrow_array_to_points(columns, schema, table_schema.clone(), indices.len())
+                    .map_err(|e| {
+                        CommonSnafu {
+                            msg: format!("arrow array to points error: {}", e),
+                        }
+                        .build()
+                    })?,
+            );
+            write_bytes += points.len();
+            requests.extend(
+                self.push_points_to_requests(
+                    tenant, db, precision, repl, points, limited, span_ctx,
+                )
+                .await?,
+            );
+        }
+        if let Some(written_buckets) = &written_buckets {
+            self.mark_written_views(&meta_client, tenant, db, written_buckets, MARK_REUSE)
+                .await?;
+        }
+        self.metrics
+            .write_lines_prepare(tenant, db)
+            .add(pre_write_start.elapsed().as_millis() as u64);
+
+        let now = tokio::time::Instant::now();
+        for res in futures::future::join_all(requests).await {
+            debug!(
+                "Parallel write points on vnode over, start at: {:?}, elapsed: {} millis, result: {:?}",
+                now,
+                now.elapsed().as_millis(),
+                res
+            );
+            res?;
+        }
+        self.metrics
+            .write_replica_duration(tenant, db)
+            .add(now.elapsed().as_millis() as u64);
+        if let Some(reservation) = reservation {
+            reservation.commit();
+        }
+        if let Some(written_buckets) = &written_buckets {
+            let reuse = REFRESH_DELAY / 2;
+            self.mark_written_views(&meta_client, tenant, db, written_buckets, reuse)
+                .await?;
+        }
+
+        if limited && self.mirrors(tenant, db) {
+            match WriteMirror::encode_batch(&table_schema, &record_batch) {
+                Ok(body) => self.mirror_write(tenant, db, Precision::NS, body).await,
+                Err(e) => trace::sampled!(
+                    error,
+                    "unencoded mirror writes",
+                    "failed to encode the write of {}.{} to forward: {}",
+                    tenant,
+                    db,
+                    e
+                ),
+            }
+        }
+
+        Ok(write_bytes)
+    }
+
+    fn mirrors(&self, tenant: &str, db: &str) -> bool {
+        matches!(&self.mirror, Some(mirror) if mirror.forwards(tenant, db))
+    }
+
+    /// Queues the committed write of the lines or the record batch for the
+    /// mirror targets, `body` is the line protocol of the points.
+    async fn mirror_write(&self, tenant: &str, db: &str, precision: Precision, body: Vec<u8>) {
+        if let Some(mirror) = &self.mirror {
+            mirror.push(tenant, db, precision, body).await;
+        }
+    }
+
+    /// Set status of all vnodes in the replication set in meta,
+    /// then notify the data nodes to reject or accept writes and compactions.
+    async fn freeze_replica(
+        &self,
+        tenant: &str,
+        replica_id: ReplicationSetId,
+        frozen: bool,
+    ) -> CoordinatorResult<()> {
+        let replica = get_replica_all_info(self.meta.clone(), tenant, replica_id).await?;
+        let meta_client = self.meta.tenant_meta(tenant).await.ok_or_else(|| {
+            CoordinatorError::TenantNotFound {
+                name: tenant.to_string(),
+            }
+        })?;
+
+        let status = if frozen {
+            VnodeStatus::Frozen
+        } else {
+            VnodeStatus::Running
+        };
+        let mut node_vnode_ids_map: HashMap<u64, Vec<u32>> = HashMap::new();
+        for vnode in replica.replica_set.vnodes.iter() {
+            let mut all_info = get_vnode_all_info(self.meta.clone(), tenant, vnode.id).await?;
+            all_info.set_status(status);
+            meta_client
+                .update_vnode(&all_info)
+                .await
+                .context(MetaSnafu)?;
+
+            node_vnode_ids_map
+                .entry(vnode.node_id)
+                .or_default()
+                .push(vnode.id);
+        }
+
+        let mut req_futures = vec![];
+        for (node_id, vnode_ids) in node_vnode_ids_map {
+            let cmd = AdminCommand {
+                tenant: tenant.to_string(),
+                command: Some(FreezeVnode(FreezeVnodeRequest { vnode_ids, frozen })),
+            };
+            req_futures.push(self.admin_command_on_node(node_id, cmd));
+        }
+        for res in futures::future::join_all(req_futures).await {
+            res?;
+        }
+
+        info!(
+            "set status of replica set {} of {}.{} to {:?}",
+            replica_id, tenant, replica.db_name, status
+        );
+
+        Ok(())
+    }
+
+    async fn admin_command_on_leader(
+        &self,
+        replica: ReplicationSet,
+        request: AdminCommand,
+    ) -> CoordinatorResult<()> {
+        let tenant = request.tenant.clone();
+        let caller = TskvAdminRequest {
+            request,
+            meta: self.meta.clone(),
+            timeout: Duration::from_secs(3600),
+            enable_gzip: self.config.service.grpc_enable_gzip,
+        };
+        let executor = TskvLeaderExecutor {
+            meta: self.meta.clone(),
+        };
+        executor.do_request(&tenant, &replica, &caller).await?;
+        Ok(())
+    }
 
     pub async fn admin_command_on_node(
         &self,
@@ -471,6 +1454,82 @@ impl CoordService {
 
         Ok(())
     }
+
+    /// Nodes able to take over vnodes of the decommissioned node,
+    /// the one with most free disk first.
+    async fn decommission_candidates(
+        &self,
+        node_id: NodeId,
+        replacement: Option<NodeId>,
+    ) -> CoordinatorResult<Vec<NodeInfo>> {
+        let nodes = self.meta.data_nodes().await;
+        for id in std::iter::once(node_id).chain(replacement) {
+            if !nodes.iter().any(|node| node.id == id) {
+                return Err(MetaError::NotFoundNode { id }).context(MetaSnafu);
+            }
+        }
+
+        match replacement {
+            Some(id) if id == node_id => Err(CommonSnafu {
+                msg: format!("Can't replace node {} with itself", node_id),
+            }
+            .build()),
+            Some(id) => Ok(nodes.into_iter().filter(|node| node.id == id).collect()),
+            None => {
+                let mut metrics = self.meta.node_metrics().await.context(MetaSnafu)?;
+                metrics.retain(|m| m.id != node_id && m.is_healthy());
+                metrics.sort_by_key(|m| std::cmp::Reverse(m.disk_free));
+                Ok(metrics
+                    .into_iter()
+                    .filter_map(|m| nodes.iter().find(|node| node.id == m.id).cloned())
+                    .collect())
+            }
+        }
+    }
+
+    /// Add a vnode of the replica set on one of `candidates`,
+    /// then remove the vnode on `node_id` from the raft group.
+    async fn drain_replica(
+        &self,
+        tenant: &str,
+        replica: &ReplicationSet,
+        node_id: NodeId,
+        candidates: &[NodeId],
+    ) -> CoordinatorResult<()> {
+        let vnode = match replica.by_node_id(node_id) {
+            Some(vnode) => vnode,
+            None => return Ok(()),
+        };
+
+        match candidates
+            .iter()
+            .find(|id| replica.by_node_id(**id).is_none())
+        {
+            Some(target) => {
+                info!(
+                    "decommission node {}: move vnode {} of replica {} to node {}",
+                    node_id, vnode.id, replica.id, target
+                );
+                let cmd_type = ReplicationCmdType::AddRaftFollower(replica.id, *target);
+                self.replication_manager(tenant, cmd_type).await?;
+            }
+            None if replica.vnodes.len() > 1 => {
+                warn!(
+                    "decommission node {}: no spare node for replica {}, drop vnode {}",
+                    node_id, replica.id, vnode.id
+                );
+            }
+            None => {
+                return Err(CoordinatorError::NoNodeForReplica {
+                    replica_id: replica.id,
+                    node_id,
+                });
+            }
+        }
+
+        let cmd_type = ReplicationCmdType::RemoveRaftNode(vnode.id);
+        self.replication_manager(tenant, cmd_type).await
+    }
 }
 
 //***************************** Coordinator Interface ***************************************** */
@@ -492,6 +1551,10 @@ impl Coordinator for CoordService {
         self.raft_manager.clone()
     }
 
+    fn disk_watchdog(&self) -> Arc<DiskWatchdog> {
+        self.disk_watchdog.clone()
+    }
+
     async fn tenant_meta(&self, tenant: &str) -> Option<MetaClientRef> {
         self.meta.tenant_meta(tenant).await
     }
@@ -500,11 +1563,15 @@ impl Coordinator for CoordService {
         TskvRaftWriter::new(
             self.meta.clone(),
             self.node_id,
-            self.config.query.write_timeout,
+            self.meta
+                .runtime_limits()
+                .write_timeout
+                .unwrap_or(self.config.query.write_timeout),
             self.config.service.grpc_enable_gzip,
             self.config.deployment.memory * 1024 * 1024 * 1024,
             self.memory_pool.clone(),
             self.raft_manager.clone(),
+            self.disk_watchdog.clone(),
             request,
             self.writer_count.clone(),
         )
@@ -532,7 +1599,7 @@ impl Coordinator for CoordService {
                     0
                 } else {
                     match vnode.status {
-                        VnodeStatus::Running => 1,
+                        VnodeStatus::Running | VnodeStatus::Frozen => 1,
                         VnodeStatus::Copying => 2,
                         VnodeStatus::Broken => i32::MAX,
                     }
@@ -555,14 +1622,7 @@ impl Coordinator for CoordService {
         request: RaftWriteCommand,
         _span_ctx: Option<&SpanContext>,
     ) -> CoordinatorResult<()> {
-        let tenant = request.tenant.clone();
-        let writer = self.tskv_raft_writer(request);
-        let executor = TskvLeaderExecutor {
-            meta: self.meta.clone(),
-        };
-
-        executor.do_request(&tenant, &replica, &writer).await?;
-
+        self.write_replica_acked(replica, request).await?;
         Ok(())
     }
 
@@ -574,213 +1634,105 @@ impl Coordinator for CoordService {
         lines: Vec<Line<'a>>,
         span_ctx: Option<&SpanContext>,
     ) -> CoordinatorResult<usize> {
-        let pre_write_start = std::time::Instant::now();
-        let mut write_bytes: usize = 0;
-        let meta_client = self.meta.tenant_meta(tenant).await.ok_or_else(|| {
-            CoordinatorError::TenantNotFound {
-                name: tenant.to_string(),
-            }
-        })?;
-        let mut map_lines: HashMap<ReplicationSetId, VnodeLines> = HashMap::new();
-        let db_schema = meta_client
-            .get_db_schema(db)
-            .context(MetaSnafu)?
-            .ok_or_else(|| MetaError::DatabaseNotFound {
-                database: db.to_string(),
-            })
-            .context(MetaSnafu)?;
-        if db_schema.is_hidden() {
-            return Err(CoordinatorError::Meta {
-                source: MetaError::DatabaseNotFound {
-                    database: db.to_string(),
-                },
-            });
-        }
-
-        let db_precision = db_schema.config.precision();
-        for line in lines {
-            let ts =
-                timestamp_convert(precision, *db_precision, line.timestamp).ok_or_else(|| {
-                    CommonSnafu {
-                        msg: "timestamp overflow".to_string(),
-                    }
-                    .build()
-                })?;
-            let info = meta_client
-                .locate_replication_set_for_write(db, line.hash_id, ts)
-                .await
-                .context(MetaSnafu)?;
-            let lines_entry = map_lines.entry(info.id).or_insert(VnodeLines::new(info));
-            lines_entry.add_line(line)
-        }
-
-        let mut requests = Vec::new();
-        for lines in map_lines.into_values() {
-            let batches = line_to_batches(&lines.lines).map_err(|e| {
-                CommonSnafu {
-                    msg: format!("line to batch error: {}", e),
-                }
-                .build()
-            })?;
-            let points = Arc::new(mutable_batches_to_point(db, batches));
-            write_bytes += points.len();
-            requests.extend(
-                self.push_points_to_requests(tenant, db, precision, lines.info, points, span_ctx)
-                    .await?,
-            );
-        }
-
-        self.metrics
-            .write_lines_prepare(tenant, db)
-            .add(pre_write_start.elapsed().as_millis() as u64);
-
-        let now = tokio::time::Instant::now();
-        for res in futures::future::join_all(requests).await {
-            debug!(
-                "Parallel write points on vnode over, start at: {:?}, elapsed: {} millis, result: {:?}",
-                now,
-                now.elapsed().as_millis(),
-                res
-            );
-            res?
-        }
-        self.metrics
-            .write_replica_duration(tenant, db)
-            .add(now.elapsed().as_millis() as u64);
-
+        let (write_bytes, _) = self
+            .write_lines_with_token(tenant, db, precision, lines, span_ctx)
+            .await?;
         Ok(write_bytes)
     }
 
-    async fn write_record_batch<'a>(
+    async fn write_lines_with_token<'a>(
         &self,
-        table_schema: TskvTableSchemaRef,
-        record_batch: RecordBatch,
-        db_precision: Precision,
-        span_ctx: Option<&SpanContext>,
-    ) -> CoordinatorResult<usize> {
-        let pre_write_start = std::time::Instant::now();
-
-        let mut write_bytes: usize = 0;
-        let mut precision = Precision::NS;
-        let tenant = table_schema.tenant.as_str();
-        let db = table_schema.db.as_str();
-        let meta_client = self.meta.tenant_meta(tenant).await.ok_or_else(|| {
-            CoordinatorError::TenantNotFound {
-                name: tenant.to_string(),
-            }
-        })?;
-
-        let mut repl_idx: HashMap<ReplicationSet, Vec<u32>> = HashMap::new();
-        let schema = record_batch.schema().fields.clone();
-        let table_name = table_schema.name.as_str();
-        let columns = record_batch.columns();
-        for idx in 0..record_batch.num_rows() {
-            let mut hasher = BkdrHasher::new();
-            hasher.hash_with(table_name.as_bytes());
-            let mut ts = i64::MAX;
-            let mut has_ts = false;
-            let mut has_fileds = false;
-            for (column, schema) in columns.iter().zip(schema.iter()) {
-                let name = schema.name().as_str();
-                let tskv_schema_column = table_schema.column(name).ok_or_else(|| {
-                    CommonSnafu {
-                        msg: format!("column {} not found in table {}", name, table_name),
-                    }
-                    .build()
-                })?;
-                if name == TIME_FIELD_NAME {
-                    let precsion_and_value =
-                        get_precision_and_value_from_arrow_column(column, idx)?;
-                    precision = precsion_and_value.0;
-                    ts = timestamp_convert(precision, db_precision, precsion_and_value.1)
-                        .ok_or_else(|| {
-                            CommonSnafu {
-                                msg: "timestamp overflow".to_string(),
-                            }
-                            .build()
-                        })?;
-                    has_ts = true;
-                }
-                if matches!(tskv_schema_column.column_type, ColumnType::Tag) {
-                    let value = column
-                        .as_any()
-                        .downcast_ref::<StringArray>()
-                        .ok_or_else(|| {
-                            CommonSnafu {
-                                msg: format!("column {} is not StringArray", name),
-                            }
-                            .build()
-                        })?
-                        .value(idx);
-                    hasher.hash_with(name.as_bytes());
-                    hasher.hash_with(value.as_bytes());
-                }
-
-                if let ColumnType::Field(_) = tskv_schema_column.column_type {
-                    if !column.is_null(idx) {
-                        has_fileds = true;
-                    }
-                }
-            }
-
-            if !has_ts {
-                return Err(CommonSnafu {
-                    msg: format!(
-                        "column {} not found in table {}",
-                        TIME_FIELD_NAME, table_name
-                    ),
-                }
-                .build());
+        tenant: &str,
+        db: &str,
+        precision: Precision,
+        lines: Vec<Line<'a>>,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<(usize, WriteToken)> {
+        let pre_write_start = std::time::Instant::now();
+        let mut write_bytes: usize = 0;
+        let meta_client = self.meta.tenant_meta(tenant).await.ok_or_else(|| {
+            CoordinatorError::TenantNotFound {
+                name: tenant.to_string(),
             }
+        })?;
+        let mut map_lines: HashMap<ReplicationSetId, VnodeLines> = HashMap::new();
+        let db_schema = meta_client
+            .get_db_schema(db)
+            .context(MetaSnafu)?
+            .ok_or_else(|| MetaError::DatabaseNotFound {
+                database: db.to_string(),
+            })
+            .context(MetaSnafu)?;
+        if db_schema.is_hidden() {
+            return Err(CoordinatorError::Meta {
+                source: MetaError::DatabaseNotFound {
+                    database: db.to_string(),
+                },
+            });
+        }
+        let mut lines = apply_ingest_rules(db_schema.options().ingest_rules(), lines);
+        self.assign_sequence_tags(&meta_client, &db_schema, precision, &mut lines)
+            .await?;
+        let points = lines.len() as u64;
+        let reservation = self.check_database_quota(&db_schema, points)?;
+        Self::check_point_ttls(&lines)?;
 
-            if !has_fileds {
-                return Err(FieldsIsEmptySnafu.build());
-            }
+        let forwards = self.mirrors(tenant, db);
+        let body = forwards.then(|| WriteMirror::encode(&lines));
 
-            let hash = hasher.number();
-            let info = meta_client
-                .locate_replication_set_for_write(db, hash, ts)
+        let db_precision = db_schema.config.precision();
+        let (min_ts, max_ts) = db_schema.time_range_to_write();
+        let mut written_buckets = WrittenBuckets::new(&db_schema);
+        for line in lines {
+            let ts =
+                timestamp_convert(precision, *db_precision, line.timestamp).ok_or_else(|| {
+                    CommonSnafu {
+                        msg: "timestamp overflow".to_string(),
+                    }
+                    .build()
+                })?;
+            check_timestamp_range(db, ts, min_ts, max_ts)?;
+            written_buckets.add(&line.table, ts);
+            // only clone the replication set the first time it is located
+            let (id, info) = meta_client
+                .locate_replication_set_for_write_with(db, line.hash_id, ts, |set| {
+                    let info = (!map_lines.contains_key(&set.id)).then(|| set.clone());
+                    (set.id, info)
+                })
                 .await
                 .context(MetaSnafu)?;
-            repl_idx.entry(info).or_default().push(idx as u32);
+            let lines_entry = map_lines
+                .entry(id)
+                .or_insert_with(|| VnodeLines::new(info.unwrap_or_default()));
+            lines_entry.add_line(line)
         }
 
         let mut requests = Vec::new();
-        for (repl, idxs) in repl_idx {
-            let indices = UInt32Array::from(idxs);
-            let columns = record_batch
-                .columns()
-                .iter()
-                .map(|column| {
-                    take(column, &indices, None).map_err(|e| {
-                        CommonSnafu {
-                            msg: format!("take column error: {}", e),
-                        }
-                        .build()
-                    })
-                })
-                .collect::<Result<Vec<_>, _>>()?;
-            let schema = record_batch.schema();
-            let points = Arc::new(
-                arrow_array_to_points(columns, schema, table_schema.clone(), indices.len())
-                    .map_err(|e| {
-                        CommonSnafu {
-                            msg: format!("arrow array to points error: {}", e),
-                        }
-                        .build()
-                    })?,
-            );
+        for lines in map_lines.into_values() {
+            let batches = line_to_batches(&lines.lines).map_err(|e| {
+                CommonSnafu {
+                    msg: format!("line to batch error: {}", e),
+                }
+                .build()
+            })?;
+            let points = Arc::new(mutable_batches_to_point(db, batches));
             write_bytes += points.len();
             requests.extend(
-                self.push_points_to_requests(tenant, db, precision, repl, points, span_ctx)
-                    .await?,
+                self.push_points_to_requests(
+                    tenant, db, precision, lines.info, points, true, span_ctx,
+                )
+                .await?,
             );
         }
+
+        self.mark_written_views(&meta_client, tenant, db, &written_buckets, MARK_REUSE)
+            .await?;
         self.metrics
             .write_lines_prepare(tenant, db)
             .add(pre_write_start.elapsed().as_millis() as u64);
 
         let now = tokio::time::Instant::now();
+        let mut token = WriteToken::default();
         for res in futures::future::join_all(requests).await {
             debug!(
                 "Parallel write points on vnode over, start at: {:?}, elapsed: {} millis, result: {:?}",
@@ -788,13 +1740,52 @@ impl Coordinator for CoordService {
                 now.elapsed().as_millis(),
                 res
             );
-            res?
+            let (replica_id, vnode_id) = res?;
+            token.insert(replica_id, vnode_id);
         }
         self.metrics
             .write_replica_duration(tenant, db)
             .add(now.elapsed().as_millis() as u64);
+        if let Some(reservation) = reservation {
+            reservation.commit();
+        }
+        // the points written slowly are refreshed later
+        self.mark_written_views(
+            &meta_client,
+            tenant,
+            db,
+            &written_buckets,
+            REFRESH_DELAY / 2,
+        )
+        .await?;
 
-        Ok(write_bytes)
+        if let Some(body) = body {
+            self.mirror_write(tenant, db, precision, body).await;
+        }
+
+        Ok((write_bytes, token))
+    }
+
+    async fn write_record_batch<'a>(
+        &self,
+        table_schema: TskvTableSchemaRef,
+        record_batch: RecordBatch,
+        db_precision: Precision,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<usize> {
+        self.write_record_batch_limited(table_schema, record_batch, db_precision, true, span_ctx)
+            .await
+    }
+
+    async fn write_record_batch_internal<'a>(
+        &self,
+        table_schema: TskvTableSchemaRef,
+        record_batch: RecordBatch,
+        db_precision: Precision,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<usize> {
+        self.write_record_batch_limited(table_schema, record_batch, db_precision, false, span_ctx)
+            .await
     }
 
     fn table_scan(
@@ -861,24 +1852,14 @@ impl Coordinator for CoordService {
 
         let now = tokio::time::Instant::now();
         let mut requests = vec![];
-        let predicate_bytes = bincode::serialize(predicate).context(BincodeSerdeSnafu)?;
         for replica in replicas.iter() {
-            let request = DeleteFromTableRequest {
-                tenant: table.tenant().to_string(),
-                database: table.database().to_string(),
-                table: table.table().to_string(),
-                predicate: predicate_bytes.clone(),
-                vnode_id: 0,
-            };
-            let command = RaftWriteCommand {
-                replica_id: replica.id,
-                tenant: table.tenant().to_string(),
-                db_name: table.database().to_string(),
-                command: Some(raft_write_command::Command::DeleteFromTable(request)),
-            };
-
-            let request = self.write_replica_by_raft(replica.clone(), command, None);
-            requests.push(request);
+            requests.push(self.delete_from_replica(
+                table.tenant(),
+                table.database(),
+                table.table(),
+                replica,
+                predicate,
+            ));
         }
 
         for result in futures::future::join_all(requests).await {
@@ -895,6 +1876,10 @@ impl Coordinator for CoordService {
         cmd_type: ReplicationCmdType,
     ) -> CoordinatorResult<()> {
         let (request, replica) = match cmd_type {
+            ReplicationCmdType::FreezeReplica(replica_id, frozen) => {
+                return self.freeze_replica(tenant, replica_id, frozen).await;
+            }
+
             ReplicationCmdType::AddRaftFollower(replica_id, node_id) => {
                 let replica = get_replica_all_info(self.meta.clone(), tenant, replica_id).await?;
                 if replica.replica_set.by_node_id(node_id).is_some() {
@@ -941,6 +1926,23 @@ impl Coordinator for CoordService {
                 )
             }
 
+            ReplicationCmdType::RebuildRaftNode(vnode_id) => {
+                let all_info = get_vnode_all_info(self.meta.clone(), tenant, vnode_id).await?;
+                let replica_id = all_info.repl_set_id;
+                let replica = get_replica_all_info(self.meta.clone(), tenant, replica_id).await?;
+                (
+                    AdminCommand {
+                        tenant: tenant.to_string(),
+                        command: Some(RebuildRaftNode(RebuildRaftNodeRequest {
+                            vnode_id,
+                            replica_id,
+                            db_name: all_info.db_name,
+                        })),
+                    },
+                    replica.replica_set,
+                )
+            }
+
             ReplicationCmdType::DestoryRaftGroup(replica_id) => {
                 let replica = get_replica_all_info(self.meta.clone(), tenant, replica_id).await?;
                 (
@@ -974,6 +1976,78 @@ impl Coordinator for CoordService {
         self.admin_command_on_leader(replica, request).await
     }
 
+    async fn decommission_node(
+        &self,
+        node_id: NodeId,
+        replacement: Option<NodeId>,
+    ) -> CoordinatorResult<()> {
+        let candidates = self.decommission_candidates(node_id, replacement).await?;
+
+        // the vnodes of a database only move to the nodes in its placement,
+        // checked for all the databases before any vnode is moved
+        let mut drains = vec![];
+        for tenant in self.meta.tenants().await.context(MetaSnafu)? {
+            let tenant = tenant.name();
+            let meta_client = self.meta.tenant_meta(tenant).await.ok_or_else(|| {
+                CoordinatorError::TenantNotFound {
+                    name: tenant.to_string(),
+                }
+            })?;
+
+            for (db, db_info) in meta_client.list_databases().context(MetaSnafu)? {
+                let replicas = db_info
+                    .buckets
+                    .iter()
+                    .flat_map(|bucket| bucket.shard_group.iter())
+                    .filter(|replica| replica.by_node_id(node_id).is_some())
+                    .cloned()
+                    .collect::<Vec<_>>();
+                if replicas.is_empty() {
+                    continue;
+                }
+
+                let placement = db_info.schema.options().placement();
+                let db_candidates = candidates
+                    .iter()
+                    .filter(|node| placement.contains(node))
+                    .map(|node| node.id)
+                    .collect::<Vec<_>>();
+                if db_candidates.is_empty() {
+                    return Err(CommonSnafu {
+                        msg: format!(
+                            "No node in the placement of database {}.{} to move the vnodes \
+                             of node {} to",
+                            tenant, db, node_id
+                        ),
+                    }
+                    .build());
+                }
+                drains.push((tenant.to_string(), replicas, db_candidates));
+            }
+        }
+
+        // stop placing new vnodes on the node before draining it
+        self.meta
+            .cordon_data_node(node_id, true)
+            .await
+            .context(MetaSnafu)?;
+
+        for (tenant, replicas, candidates) in drains {
+            for replica in replicas {
+                self.drain_replica(&tenant, &replica, node_id, &candidates)
+                    .await?;
+            }
+        }
+
+        self.meta
+            .remove_data_node(node_id)
+            .await
+            .context(MetaSnafu)?;
+        info!("data node {} decommissioned", node_id);
+
+        Ok(())
+    }
+
     async fn compact_vnodes(&self, tenant: &str, vnode_ids: Vec<VnodeId>) -> CoordinatorResult<()> {
         // Group vnode ids by node id.
         let mut node_vnode_ids_map: HashMap<u64, Vec<u32>> = HashMap::new();
@@ -1039,6 +2113,149 @@ impl Coordinator for CoordService {
         Ok(record_batches)
     }
 
+    async fn vnode_summaries(
+        &self,
+        tenant: &str,
+        vnodes: Vec<VnodeInfo>,
+    ) -> CoordinatorResult<Vec<VnodeSummary>> {
+        // Group vnode ids by node id.
+        let mut node_vnode_ids_map: HashMap<u64, Vec<u32>> = HashMap::new();
+        for vnode in vnodes {
+            node_vnode_ids_map
+                .entry(vnode.node_id)
+                .or_default()
+                .push(vnode.id);
+        }
+
+        let mut node_ids = vec![];
+        let mut req_futures = vec![];
+        for (node_id, vnode_ids) in node_vnode_ids_map {
+            let cmd = AdminCommand {
+                tenant: tenant.to_string(),
+                command: Some(FetchVnodeSummary(FetchVnodeSummaryRequest { vnode_ids })),
+            };
+            node_ids.push(node_id);
+            req_futures.push(self.admin_command_on_node(node_id, cmd));
+        }
+
+        let mut summaries = vec![];
+        for (node_id, res) in node_ids
+            .into_iter()
+            .zip(futures::future::join_all(req_futures).await)
+        {
+            match res {
+                Ok(data) => {
+                    let node_summaries: Vec<VnodeSummary> =
+                        bincode::deserialize(&data).context(BincodeSerdeSnafu)?;
+                    summaries.extend(node_summaries);
+                }
+                Err(e) => warn!("fetch vnode summaries from node {} failed: {}", node_id, e),
+            }
+        }
+
+        Ok(summaries)
+    }
+
+    async fn series_sketches(
+        &self,
+        tenant: &str,
+        replicas: Vec<ReplicationSet>,
+        tables: Vec<String>,
+    ) -> CoordinatorResult<SeriesSketches> {
+        // Group vnode ids by node id.
+        let mut node_vnode_ids_map: HashMap<u64, Vec<u32>> = HashMap::new();
+        for vnode in replicas.iter().flat_map(|replica| replica.vnodes.iter()) {
+            node_vnode_ids_map
+                .entry(vnode.node_id)
+                .or_default()
+                .push(vnode.id);
+        }
+
+        let mut node_ids = vec![];
+        let mut req_futures = vec![];
+        for (node_id, vnode_ids) in node_vnode_ids_map {
+            let cmd = AdminCommand {
+                tenant: tenant.to_string(),
+                command: Some(FetchSeriesSketch(FetchSeriesSketchRequest {
+                    vnode_ids,
+                    tables: tables.clone(),
+                })),
+            };
+            node_ids.push(node_id);
+            req_futures.push(self.admin_command_on_node(node_id, cmd));
+        }
+
+        // the series on an unreachable node are still counted by the other
+        // replicas of its vnodes
+        let mut sketches = HashMap::<String, HyperLogLog>::new();
+        let mut fetched_nodes = HashSet::new();
+        for (node_id, res) in node_ids
+            .into_iter()
+            .zip(futures::future::join_all(req_futures).await)
+        {
+            match res {
+                Ok(data) => {
+                    let node_sketches: HashMap<String, HyperLogLog> =
+                        bincode::deserialize(&data).context(BincodeSerdeSnafu)?;
+                    for (table, sketch) in node_sketches {
+                        sketches.entry(table).or_default().merge(&sketch);
+                    }
+                    fetched_nodes.insert(node_id);
+                }
+                Err(e) => warn!("fetch series sketches from node {} failed: {}", node_id, e),
+            }
+        }
+
+        let missing_replicas = replicas
+            .iter()
+            .filter(|replica| {
+                !replica
+                    .vnodes
+                    .iter()
+                    .any(|vnode| fetched_nodes.contains(&vnode.node_id))
+            })
+            .map(|replica| replica.id)
+            .collect();
+        Ok(SeriesSketches {
+            sketches,
+            missing_replicas,
+        })
+    }
+
+    async fn committed_log(
+        &self,
+        tenant: &str,
+        db_name: &str,
+        replica: &ReplicationSet,
+        from_index: u64,
+        limit: u32,
+    ) -> CoordinatorResult<CommittedLog> {
+        let cmd = AdminCommand {
+            tenant: tenant.to_string(),
+            command: Some(FetchCommittedLog(FetchCommittedLogRequest {
+                db_name: db_name.to_string(),
+                replica_id: replica.id,
+                from_index,
+                limit,
+            })),
+        };
+        let data = self
+            .admin_command_on_node(replica.leader_node_id, cmd)
+            .await?;
+        let log = bincode::deserialize(&data).context(BincodeSerdeSnafu)?;
+        Ok(log)
+    }
+
+    async fn backup(
+        &self,
+        tenant: &str,
+        databases: Vec<String>,
+        name: &str,
+    ) -> CoordinatorResult<BackupManifest> {
+        let dir = backup::backup_dir(Path::new(&self.config.storage.backup_path), name)?;
+        backup::backup_tenant(self, tenant, databases, &dir).await
+    }
+
     fn metrics(&self) -> &Arc<CoordServiceMetrics> {
         &self.metrics
     }
@@ -1186,6 +2403,45 @@ impl Coordinator for CoordService {
     fn get_writer_count(&self) -> Arc<AtomicUsize> {
         self.writer_count.clone()
     }
+
+    fn change_feed(&self) -> Option<Arc<ChangeFeed>> {
+        self.change_feed.clone()
+    }
+
+    fn metric_rates(&self) -> Vec<MetricRate> {
+        self.metric_rates.lock().unwrap().rates().to_vec()
+    }
+}
+
+/// The points of a write reserved in the write rate of a database, refunded
+/// when dropped unless the write succeeded.
+struct WriteRateReservation {
+    write_rates: Arc<Mutex<HashMap<String, (i64, u64)>>>,
+    owner: String,
+    second: i64,
+    points: u64,
+    committed: bool,
+}
+
+impl WriteRateReservation {
+    fn commit(mut self) {
+        self.committed = true;
+    }
+}
+
+impl Drop for WriteRateReservation {
+    fn drop(&mut self) {
+        if self.committed {
+            return;
+        }
+        let mut write_rates = self.write_rates.lock().unwrap();
+        // the rate of a second passed is not checked any more
+        if let Some((second, count)) = write_rates.get_mut(&self.owner) {
+            if *second == self.second {
+                *count = count.saturating_sub(self.points);
+            }
+        }
+    }
 }
 
 struct VnodeLines<'a> {
@@ -1206,6 +2462,61 @@ impl<'a> VnodeLines<'a> {
     }
 }
 
+fn check_timestamp_range(db: &str, ts: i64, min: i64, max: i64) -> CoordinatorResult<()> {
+    if ts < min || ts > max {
+        return Err(CoordinatorError::TimestampOutOfRange {
+            database: db.to_string(),
+            ts,
+            min,
+            max,
+        });
+    }
+
+    Ok(())
+}
+
+/// Rewrites the lines by the ingest rules of the database, the lines dropped
+/// by the rules are removed.
+fn apply_ingest_rules<'a>(rules: &IngestRules, lines: Vec<Line<'a>>) -> Vec<Line<'a>> {
+    if rules.is_empty() {
+        return lines;
+    }
+    let rewriter = rules.rewriter();
+    lines
+        .into_iter()
+        .filter_map(|mut line| {
+            if !rewriter.rewrite(&mut line.table, &mut line.tags, &mut line.fields) {
+                return None;
+            }
+            // the series key may be changed
+            line.hash_id = 0;
+            line.init_hash_id();
+            Some(line)
+        })
+        .collect()
+}
+
+/// Runs a deletion of the retention sweeper, a dry run deletes nothing and
+/// succeeds.
+async fn sweep_expired(
+    dry_run: bool,
+    delete: impl Future<Output = CoordinatorResult<()>>,
+) -> CoordinatorResult<()> {
+    if dry_run {
+        return Ok(());
+    }
+    delete.await
+}
+
+/// The predicate of the points written with the `ttl`, and before `expired_before`.
+fn point_ttl_predicate(ttl: &str, expired_before: i64) -> CoordinatorResult<ResolvedPredicate> {
+    let value = ScalarValue::Utf8(Some(ttl.to_string()));
+    let domain = Domain::of_values(&DataType::Utf8, true, &[&value]);
+    let tags_filter = ColumnDomains::of(POINT_TTL_TAG.to_string(), &domain);
+    let time_ranges = TimeRanges::new(vec![TimeRange::new(i64::MIN, expired_before)]);
+    ResolvedPredicate::new(Arc::new(time_ranges), tags_filter, None).context(ModelsSnafu)
+}
+
 fn get_precision_and_value_from_arrow_column(
     column: &ArrayRef,
     idx: usize,
@@ -1275,3 +2586,25 @@ fn get_precision_and_value_from_arrow_column(
         .build()),
     }
 }
+
+#[cfg(test)]
+mod test {
+    use std::sync::atomic::{AtomicUsize, Ordering};
+
+    use super::sweep_expired;
+
+    #[tokio::test]
+    async fn test_sweep_expired_dry_run() {
+        let deleted = &AtomicUsize::new(0);
+        let delete = move || async move {
+            deleted.fetch_add(1, Ordering::SeqCst);
+            Ok(())
+        };
+
+        sweep_expired(true, delete()).await.unwrap();
+        assert_eq!(deleted.load(Ordering::SeqCst), 0);
+
+        sweep_expired(false, delete()).await.unwrap();
+        assert_eq!(deleted.load(Ordering::SeqCst), 1);
+    }
+}
@@ -10,23 +10,33 @@ use datafusion::arrow::record_batch::RecordBatch;
 use meta::model::meta_admin::AdminMeta;
 use meta::model::meta_tenant::TenantMeta;
 use meta::model::{MetaClientRef, MetaRef};
-use models::meta_data::{ReplicationSet, ReplicationSetId, VnodeId, VnodeInfo, VnodeStatus};
+use metrics::rate::MetricRate;
+use models::consistency_level::WriteToken;
+use models::meta_data::{
+    NodeId, ReplicationSet, ReplicationSetId, VnodeId, VnodeInfo, VnodeStatus, VnodeSummary,
+};
 use models::object_reference::ResolvedTable;
 use models::predicate::domain::{ResolvedPredicate, ResolvedPredicateRef};
 use models::schema::tskv_table_schema::TskvTableSchemaRef;
 use protocol_parser::Line;
 use protos::kv_service::{RaftWriteCommand, UpdateSetValue};
+use replication::CommittedLog;
 use trace::SpanContext;
 use tskv::engine_mock::MockEngine;
 use tskv::reader::QueryOption;
 use tskv::EngineRef;
 use utils::precision::Precision;
 
+use crate::backup::BackupManifest;
+use crate::change_feed::ChangeFeed;
+use crate::disk_watchdog::DiskWatchdog;
 use crate::errors::CoordinatorResult;
 use crate::raft::manager::RaftNodesManager;
 use crate::raft::writer::TskvRaftWriter;
 use crate::service::CoordServiceMetrics;
-use crate::{Coordinator, ReplicationCmdType, SendableCoordinatorRecordBatchStream};
+use crate::{
+    Coordinator, ReplicationCmdType, SendableCoordinatorRecordBatchStream, SeriesSketches,
+};
 
 pub const WITH_NONEMPTY_DATABASE_FOR_TEST: &str = "with_nonempty_database";
 
@@ -51,6 +61,10 @@ impl Coordinator for MockCoordinator {
         todo!()
     }
 
+    fn disk_watchdog(&self) -> Arc<DiskWatchdog> {
+        todo!()
+    }
+
     async fn tenant_meta(&self, tenant: &str) -> Option<MetaClientRef> {
         Some(Arc::new(TenantMeta::mock()))
     }
@@ -175,6 +189,17 @@ impl Coordinator for MockCoordinator {
         todo!()
     }
 
+    async fn write_lines_with_token<'a>(
+        &self,
+        tenant: &str,
+        db: &str,
+        precision: Precision,
+        line: Vec<Line<'a>>,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<(usize, WriteToken)> {
+        todo!()
+    }
+
     async fn write_record_batch<'a>(
         &self,
         table_schema: TskvTableSchemaRef,
@@ -185,6 +210,16 @@ impl Coordinator for MockCoordinator {
         todo!()
     }
 
+    async fn write_record_batch_internal<'a>(
+        &self,
+        table_schema: TskvTableSchemaRef,
+        record_batch: RecordBatch,
+        db_precision: Precision,
+        span_ctx: Option<&SpanContext>,
+    ) -> CoordinatorResult<usize> {
+        todo!()
+    }
+
     fn table_scan(
         &self,
         option: QueryOption,
@@ -218,6 +253,14 @@ impl Coordinator for MockCoordinator {
         Ok(())
     }
 
+    async fn decommission_node(
+        &self,
+        node_id: NodeId,
+        replacement: Option<NodeId>,
+    ) -> CoordinatorResult<()> {
+        Ok(())
+    }
+
     async fn replica_checksum(
         &self,
         tenant: &str,
@@ -226,6 +269,43 @@ impl Coordinator for MockCoordinator {
         Ok(vec![])
     }
 
+    async fn vnode_summaries(
+        &self,
+        tenant: &str,
+        vnodes: Vec<VnodeInfo>,
+    ) -> CoordinatorResult<Vec<VnodeSummary>> {
+        Ok(vec![])
+    }
+
+    async fn series_sketches(
+        &self,
+        tenant: &str,
+        replicas: Vec<ReplicationSet>,
+        tables: Vec<String>,
+    ) -> CoordinatorResult<SeriesSketches> {
+        Ok(SeriesSketches::default())
+    }
+
+    async fn committed_log(
+        &self,
+        tenant: &str,
+        db_name: &str,
+        replica: &ReplicationSet,
+        from_index: u64,
+        limit: u32,
+    ) -> CoordinatorResult<CommittedLog> {
+        Ok(CommittedLog::default())
+    }
+
+    async fn backup(
+        &self,
+        tenant: &str,
+        databases: Vec<String>,
+        name: &str,
+    ) -> CoordinatorResult<BackupManifest> {
+        todo!()
+    }
+
     fn metrics(&self) -> &Arc<CoordServiceMetrics> {
         todo!()
     }
@@ -242,6 +322,15 @@ impl Coordinator for MockCoordinator {
     fn get_config(&self) -> Config {
         Config::default()
     }
+
+    fn change_feed(&self) -> Option<Arc<ChangeFeed>> {
+        None
+    }
+
+    fn metric_rates(&self) -> Vec<MetricRate> {
+        vec![]
+    }
+
     fn get_writer_count(&self) -> Arc<AtomicUsize> {
         todo!()
     }
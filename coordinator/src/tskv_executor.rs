@@ -6,7 +6,7 @@ use models::meta_data::*;
 use protos::kv_service::AdminCommand;
 use protos::{tskv_service_time_out_client, DEFAULT_GRPC_SERVER_MESSAGE_LEN};
 use snafu::ResultExt;
-use trace::info;
+use trace::{info, warn};
 
 use crate::errors::*;
 use crate::TskvLeaderCaller;
@@ -77,7 +77,13 @@ impl TskvLeaderExecutor {
     ) -> CoordinatorResult<Vec<u8>> {
         let leader_id = replica.leader_node_id;
         let mut vnode_list = replica.vnodes.clone();
-        vnode_list.sort_by_key(|vnode| if vnode.node_id == leader_id { 0 } else { 1 });
+        // try the leader first, nodes known to be down last
+        vnode_list.sort_by_key(|vnode| {
+            (
+                self.meta.is_node_down(vnode.node_id),
+                vnode.node_id != leader_id,
+            )
+        });
         let mut node_list = VecDeque::from(vnode_list);
 
         let mut result = Err(CoordinatorError::NoValidReplica { id: replica.id });
@@ -90,6 +96,9 @@ impl TskvLeaderExecutor {
 
             result = caller.call(replica, vnode.node_id).await;
             if let Err(CoordinatorError::PreExecution { .. }) = &result {
+                if vnode.node_id != self.meta.node_id() && self.meta.mark_node_down(vnode.node_id) {
+                    warn!("Node {} failed to answer, mark it down", vnode.node_id);
+                }
                 continue;
             } else if let Err(CoordinatorError::RaftForwardToLeader {
                 replica_id: _,
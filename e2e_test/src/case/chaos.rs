@@ -0,0 +1,409 @@
+//! Chaos runner, runs writes, queries and faults concurrently against the
+//! cluster, to catch the races the serial steps miss.
+//!
+//! Each writer writes its own series, the value of the `n`th point is `n`,
+//! and a point is written again until it is acknowledged, so:
+//! - a query counts at least the points acknowledged before it starts, and
+//!   at most the points attempted after it ends.
+//! - after the faults, a series has no hole, its points are from 0 to the
+//!   last one acknowledged, or the one attempted after it.
+
+use std::sync::atomic::{AtomicBool, AtomicU64, Ordering};
+use std::sync::Arc;
+use std::thread;
+use std::time::{Duration, Instant};
+
+use meta::model::meta_admin::AdminMeta;
+use meta::model::MetaClientRef;
+use metrics::metric_register::MetricsRegister;
+use parking_lot::Mutex;
+use rand::Rng;
+
+use super::E2eExecutor;
+use crate::utils::Client;
+
+/// The timestamp of the first point of a series, in seconds.
+const START_SECONDS: u64 = 1_700_000_000;
+/// Interval of the retries of a failed write.
+const WRITE_RETRY_INTERVAL: Duration = Duration::from_millis(10);
+/// Time the cluster has to recover after the faults, before the final check.
+const RECOVER_TIMEOUT: Duration = Duration::from_secs(60);
+
+/// A fault injected while the writes and queries are running.
+#[derive(Debug, Clone, Copy)]
+pub enum Fault {
+    /// Restart the data node of the index.
+    RestartDataNode(usize),
+    /// Drop a vnode which is not the leader of a replica set of more than one
+    /// vnode, the data is still served by the others.
+    DropShardReplica,
+}
+
+impl std::fmt::Display for Fault {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Fault::RestartDataNode(i) => write!(f, "restart data node: {i}"),
+            Fault::DropShardReplica => write!(f, "drop shard replica"),
+        }
+    }
+}
+
+pub struct ChaosOptions {
+    /// Database written and queried, must be created before the run.
+    pub database: String,
+    pub table: String,
+    pub writers: usize,
+    pub queriers: usize,
+    /// Faults injected one at a time, chosen randomly.
+    pub faults: Vec<Fault>,
+    pub fault_interval: Duration,
+    pub duration: Duration,
+}
+
+impl Default for ChaosOptions {
+    fn default() -> Self {
+        Self {
+            database: "chaos_db".to_string(),
+            table: "chaos_tbl".to_string(),
+            writers: 4,
+            queriers: 2,
+            faults: vec![],
+            fault_interval: Duration::from_secs(5),
+            duration: Duration::from_secs(60),
+        }
+    }
+}
+
+#[derive(Debug, Default)]
+pub struct ChaosReport {
+    pub points_acknowledged: u64,
+    pub write_retries: u64,
+    pub queries_succeeded: u64,
+    pub queries_failed: u64,
+    pub faults_injected: Vec<String>,
+    /// The results inconsistent with the writes, empty if the checks passed.
+    pub violations: Vec<String>,
+}
+
+impl std::fmt::Display for ChaosReport {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        writeln!(f, "# Chaos report")?;
+        writeln!(f, "- points acknowledged: {}", self.points_acknowledged)?;
+        writeln!(f, "- write retries: {}", self.write_retries)?;
+        writeln!(
+            f,
+            "- queries succeeded: {}, failed: {}",
+            self.queries_succeeded, self.queries_failed
+        )?;
+        writeln!(f, "- faults injected: {}", self.faults_injected.len())?;
+        for fault in &self.faults_injected {
+            writeln!(f, "  - {fault}")?;
+        }
+        writeln!(f, "- violations: {}", self.violations.len())?;
+        for violation in &self.violations {
+            writeln!(f, "  - {violation}")?;
+        }
+        Ok(())
+    }
+}
+
+/// Points of a writer.
+#[derive(Default)]
+struct WriterState {
+    acknowledged: AtomicU64,
+    attempted: AtomicU64,
+}
+
+#[derive(Default)]
+struct SharedState {
+    stop: AtomicBool,
+    writers: Vec<WriterState>,
+    write_retries: AtomicU64,
+    queries_succeeded: AtomicU64,
+    queries_failed: AtomicU64,
+    faults_injected: Mutex<Vec<String>>,
+    violations: Mutex<Vec<String>>,
+}
+
+impl SharedState {
+    fn acknowledged(&self) -> u64 {
+        self.writers
+            .iter()
+            .map(|w| w.acknowledged.load(Ordering::SeqCst))
+            .sum()
+    }
+
+    fn attempted(&self) -> u64 {
+        self.writers
+            .iter()
+            .map(|w| w.attempted.load(Ordering::SeqCst))
+            .sum()
+    }
+
+    fn stopped(&self) -> bool {
+        self.stop.load(Ordering::SeqCst)
+    }
+}
+
+pub struct ChaosRunner {
+    options: Arc<ChaosOptions>,
+    executor: Arc<Mutex<E2eExecutor>>,
+    meta: MetaClientRef,
+    client: Arc<Client>,
+    /// `http://host:port` of the data nodes.
+    hosts: Arc<Vec<String>>,
+}
+
+impl ChaosRunner {
+    /// The cluster of the executor must be started.
+    pub fn new(executor: E2eExecutor, options: ChaosOptions) -> Self {
+        let context = executor.case_context();
+        let config = context.data().data_node_configs[0].clone();
+        let meta = context.runtime().block_on(async move {
+            let admin_meta = AdminMeta::new(config, Arc::new(MetricsRegister::default())).await;
+            admin_meta.tenant_meta("cnosdb").await.unwrap()
+        });
+        let hosts = context
+            .cluster_definition()
+            .data_cluster_def
+            .iter()
+            .map(|d| format!("http://{}", d.http_host_port))
+            .collect();
+        Self {
+            options: Arc::new(options),
+            executor: Arc::new(Mutex::new(executor)),
+            meta,
+            client: Arc::new(Client::with_auth("root".to_string(), Some(String::new()))),
+            hosts: Arc::new(hosts),
+        }
+    }
+
+    pub fn executor(&self) -> Arc<Mutex<E2eExecutor>> {
+        self.executor.clone()
+    }
+
+    /// Runs the writes, queries and faults for `duration`, then checks the
+    /// points written after the cluster recovered.
+    pub fn run(&self) -> ChaosReport {
+        let state = Arc::new(SharedState {
+            writers: (0..self.options.writers)
+                .map(|_| WriterState::default())
+                .collect(),
+            ..Default::default()
+        });
+
+        let mut handles = vec![];
+        for writer in 0..self.options.writers {
+            let (runner, state) = (self.clone_handle(), state.clone());
+            handles.push(thread::spawn(move || runner.write(&state, writer)));
+        }
+        for _ in 0..self.options.queriers {
+            let (runner, state) = (self.clone_handle(), state.clone());
+            handles.push(thread::spawn(move || runner.query(&state)));
+        }
+        if !self.options.faults.is_empty() {
+            let (runner, state) = (self.clone_handle(), state.clone());
+            handles.push(thread::spawn(move || runner.inject_faults(&state)));
+        }
+
+        thread::sleep(self.options.duration);
+        state.stop.store(true, Ordering::SeqCst);
+        for handle in handles {
+            handle.join().unwrap();
+        }
+        self.check_series(&state);
+
+        ChaosReport {
+            points_acknowledged: state.acknowledged(),
+            write_retries: state.write_retries.load(Ordering::SeqCst),
+            queries_succeeded: state.queries_succeeded.load(Ordering::SeqCst),
+            queries_failed: state.queries_failed.load(Ordering::SeqCst),
+            faults_injected: state.faults_injected.lock().clone(),
+            violations: state.violations.lock().clone(),
+        }
+    }
+
+    fn clone_handle(&self) -> Self {
+        Self {
+            options: self.options.clone(),
+            executor: self.executor.clone(),
+            meta: self.meta.clone(),
+            client: self.client.clone(),
+            hosts: self.hosts.clone(),
+        }
+    }
+
+    /// A random data node to send a request to.
+    fn host(&self) -> &str {
+        let i = rand::thread_rng().gen_range(0..self.hosts.len());
+        &self.hosts[i]
+    }
+
+    fn sql(&self, sql: &str) -> Result<Vec<String>, String> {
+        let url = format!("{}/api/v1/sql?db={}", self.host(), self.options.database);
+        self.client.api_v1_sql(url, sql).map_err(|e| e.to_string())
+    }
+
+    fn write(&self, state: &SharedState, writer: usize) {
+        let writer_state = &state.writers[writer];
+        while !state.stopped() {
+            let n = writer_state.attempted.fetch_add(1, Ordering::SeqCst);
+            let body = format!(
+                "{},writer=w{writer} value={n}i {}",
+                self.options.table,
+                (START_SECONDS + n) * 1_000_000_000
+            );
+            loop {
+                let url = format!("{}/api/v1/write?db={}", self.host(), self.options.database);
+                if self.client.api_v1_write(url, &body).is_ok() {
+                    writer_state.acknowledged.fetch_add(1, Ordering::SeqCst);
+                    break;
+                }
+                if state.stopped() {
+                    // the point may be written or not
+                    return;
+                }
+                state.write_retries.fetch_add(1, Ordering::SeqCst);
+                thread::sleep(WRITE_RETRY_INTERVAL);
+            }
+        }
+    }
+
+    fn query(&self, state: &SharedState) {
+        let sql = format!("SELECT count(*) FROM {}", self.options.table);
+        while !state.stopped() {
+            let acknowledged = state.acknowledged();
+            let result = self.sql(&sql);
+            let attempted = state.attempted();
+            match result.map(|lines| parse_count(&lines)) {
+                Ok(Some(count)) => {
+                    state.queries_succeeded.fetch_add(1, Ordering::SeqCst);
+                    if count < acknowledged || count > attempted {
+                        state.violations.lock().push(format!(
+                            "count(*) is {count}, expected in [{acknowledged}, {attempted}]"
+                        ));
+                    }
+                }
+                // the nodes may be restarting
+                Ok(None) | Err(_) => {
+                    state.queries_failed.fetch_add(1, Ordering::SeqCst);
+                }
+            }
+            thread::sleep(Duration::from_millis(100));
+        }
+    }
+
+    fn inject_faults(&self, state: &SharedState) {
+        let mut next = Instant::now() + self.options.fault_interval;
+        while !state.stopped() {
+            if Instant::now() < next {
+                thread::sleep(Duration::from_millis(100));
+                continue;
+            }
+            let index = rand::thread_rng().gen_range(0..self.options.faults.len());
+            let fault = self.options.faults[index];
+            println!("------- Inject fault: {fault}");
+            let injected = match fault {
+                Fault::RestartDataNode(i) => {
+                    let mut executor = self.executor.lock();
+                    let data = executor.case_context_mut().data_mut();
+                    let node_def = data.data_node_definitions[i].clone();
+                    data.restart_one_node(&node_def);
+                    Ok(fault.to_string())
+                }
+                Fault::DropShardReplica => self.drop_shard_replica(),
+            };
+            match injected {
+                Ok(fault) => state.faults_injected.lock().push(fault),
+                Err(e) => println!("------- Fault not injected: {e}"),
+            }
+            next = Instant::now() + self.options.fault_interval;
+        }
+    }
+
+    fn drop_shard_replica(&self) -> Result<String, String> {
+        let db_info = self
+            .meta
+            .get_db_info(&self.options.database)
+            .map_err(|e| e.to_string())?
+            .ok_or_else(|| format!("database {} not found", self.options.database))?;
+        let vnodes = db_info
+            .buckets
+            .iter()
+            .flat_map(|b| b.shard_group.iter())
+            .filter(|set| set.vnodes.len() > 1)
+            .flat_map(|set| {
+                set.vnodes
+                    .iter()
+                    .filter(move |v| v.id != set.leader_vnode_id)
+            })
+            .collect::<Vec<_>>();
+        if vnodes.is_empty() {
+            return Err("no replica set has more than one vnode".to_string());
+        }
+        let vnode = vnodes[rand::thread_rng().gen_range(0..vnodes.len())];
+        let sql = format!("DROP VNODE {}", vnode.id);
+        self.sql(&sql)?;
+        Ok(format!("{sql} on node {}", vnode.node_id))
+    }
+
+    /// Checks each series has no hole and has the points acknowledged,
+    /// retries until the cluster recovered.
+    fn check_series(&self, state: &SharedState) {
+        let sql = format!(
+            "SELECT writer, count(*), min(value), max(value) FROM {} GROUP BY writer",
+            self.options.table
+        );
+        let deadline = Instant::now() + RECOVER_TIMEOUT;
+        let lines = loop {
+            match self.sql(&sql) {
+                Ok(lines) => break lines,
+                Err(e) if Instant::now() > deadline => {
+                    state
+                        .violations
+                        .lock()
+                        .push(format!("cluster not recovered: {e}"));
+                    return;
+                }
+                Err(_) => thread::sleep(Duration::from_secs(1)),
+            }
+        };
+
+        let mut violations = state.violations.lock();
+        for (writer, writer_state) in state.writers.iter().enumerate() {
+            let acknowledged = writer_state.acknowledged.load(Ordering::SeqCst);
+            let attempted = writer_state.attempted.load(Ordering::SeqCst);
+            let series = format!("w{writer}");
+            let row = lines
+                .iter()
+                .skip(1)
+                .map(|l| l.split(',').collect::<Vec<_>>())
+                .find(|r| r.first() == Some(&series.as_str()));
+            let Some(row) = row else {
+                if acknowledged > 0 {
+                    violations.push(format!("series {series} not found"));
+                }
+                continue;
+            };
+            let values = row[1..]
+                .iter()
+                .map(|v| v.parse::<u64>().ok())
+                .collect::<Option<Vec<_>>>();
+            let Some([count, min, max]) = values.as_deref() else {
+                violations.push(format!("invalid row of series {series}: {row:?}"));
+                continue;
+            };
+            if *count < acknowledged || *count > attempted || *min != 0 || *max + 1 != *count {
+                violations.push(format!(
+                    "series {series} has {count} points of values [{min}, {max}], \
+                     expected [0, n) for n in [{acknowledged}, {attempted}]"
+                ));
+            }
+        }
+    }
+}
+
+/// The count of `SELECT count(*)`, the first line is the header.
+fn parse_count(lines: &[String]) -> Option<u64> {
+    lines.get(1).and_then(|l| l.trim().parse().ok())
+}
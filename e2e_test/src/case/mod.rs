@@ -1,6 +1,7 @@
 #![cfg(test)]
 #![allow(unused)]
 
+pub mod chaos;
 mod executor;
 pub mod step;
 
@@ -99,3 +100,89 @@ fn check_e2e_error<T>(
     }
     CaseFlowControl::Continue
 }
+
+/// Compares the response lines (left) with the expected lines (right), returns
+/// all the differences, empty if they are equal.
+///
+/// If `regex` is true, the expected lines are matched as regex line by line,
+/// otherwise the lines are diffed, so an extra or missing line is reported
+/// once rather than as a mismatch of each line after it.
+fn diff_lines(resp_lines: &[String], exp_lines: &[String], regex: bool) -> Vec<String> {
+    let mut diffs = Vec::new();
+    if !regex {
+        let (mut left, mut right) = (0, 0);
+        for d in diff::slice(resp_lines, exp_lines) {
+            match d {
+                diff::Result::Both(_, _) => {
+                    left += 1;
+                    right += 1;
+                }
+                diff::Result::Left(l) => {
+                    diffs.push(format!("line {left}: unexpected, left: {l:?}"));
+                    left += 1;
+                }
+                diff::Result::Right(r) => {
+                    diffs.push(format!("line {right}: missing, right: {r:?}"));
+                    right += 1;
+                }
+            }
+        }
+        return diffs;
+    }
+
+    for (i, (resp, exp_resp)) in resp_lines.iter().zip(exp_lines.iter()).enumerate() {
+        let (is_eq, is_regex) = match regex::Regex::new(exp_resp) {
+            // If the expected response is a regex, check whether the response matches the regex.
+            Ok(regexp) => (regexp.is_match(resp), true),
+            // If the expected response is not a regex, check the equality directly.
+            Err(_) => (resp == exp_resp, false),
+        };
+        if !is_eq {
+            diffs.push(format!(
+                "line {i}: mismatch (regex:{is_regex}), left: {resp:?}, right: {exp_resp:?}"
+            ));
+        }
+    }
+    for (i, resp) in resp_lines.iter().enumerate().skip(exp_lines.len()) {
+        diffs.push(format!("line {i}: unexpected, left: {resp:?}"));
+    }
+    for (i, exp_resp) in exp_lines.iter().enumerate().skip(resp_lines.len()) {
+        diffs.push(format!("line {i}: missing, right: {exp_resp:?}"));
+    }
+    diffs
+}
+
+#[cfg(test)]
+mod test {
+    use super::diff_lines;
+
+    fn lines(lines: &[&str]) -> Vec<String> {
+        lines.iter().map(|l| l.to_string()).collect()
+    }
+
+    #[test]
+    fn test_diff_lines() {
+        let exp = lines(&["time,value", "1,a", "2,b", "3,c"]);
+        assert!(diff_lines(&exp, &exp, false).is_empty());
+
+        let resp = lines(&["time,value", "2,b", "3,x"]);
+        assert_eq!(
+            diff_lines(&resp, &exp, false),
+            vec![
+                "line 1: missing, right: \"1,a\"",
+                "line 2: unexpected, left: \"3,x\"",
+                "line 3: missing, right: \"3,c\"",
+            ]
+        );
+
+        let exp = lines(&["time,value", r"\d+,a", "2,b"]);
+        assert!(diff_lines(&lines(&["time,value", "11,a", "2,b"]), &exp, true).is_empty());
+        assert_eq!(
+            diff_lines(&lines(&["time,value", "x,a"]), &exp, true),
+            vec![
+                "line 1: mismatch (regex:true), left: \"x,a\", right: \"\\\\d+,a\"",
+                "line 2: missing, right: \"2,b\"",
+            ]
+        );
+    }
+}
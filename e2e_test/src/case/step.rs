@@ -3,7 +3,7 @@ use std::sync::atomic::{AtomicUsize, Ordering};
 use std::sync::Arc;
 use std::time::Duration;
 
-use super::{check_e2e_error, CaseContext, CaseFlowControl, CnosdbAuth, Location};
+use super::{check_e2e_error, diff_lines, CaseContext, CaseFlowControl, CnosdbAuth, Location};
 use crate::utils::{kill_all, run_cluster, Client};
 use crate::{E2eError, E2eResult};
 
@@ -445,27 +445,15 @@ impl Sql {
                     if self.sorted {
                         resp_lines.sort_unstable();
                     }
-                    if !self.regex {
-                        if resp_lines != exp_lines {
-                            let message = format!("assertion failed: (left == right), {fail_message}\n left: {resp_lines:?}\nright: {exp_lines:?}");
-                            return CaseFlowControl::Error(message);
-                        }
-                    } else if resp_lines.len() == exp_lines.len() {
-                        for (i, (resp, exp_resp)) in
-                            resp_lines.iter().zip(exp_lines.iter()).enumerate()
-                        {
-                            let (is_eq, is_regex) = match regex::Regex::new(exp_resp) {
-                                // If the expected response is a regex, check whether the response matches the regex.
-                                Ok(regexp) => (regexp.is_match(resp), true),
-                                // If the expected response is not a regex, check the equality directly.
-                                Err(_) => (resp == exp_resp, false),
-                            };
-                            if !is_eq {
-                                let message = format!("assertion failed: (left == right, regex:{is_regex}, line:{i}), {fail_message}\n left: {resp:?}\nright: {exp_resp:?}");
-                                return CaseFlowControl::Error(message);
-                            }
-                        }
-                    };
+                    let diffs = diff_lines(&resp_lines, &exp_lines, self.regex);
+                    if !diffs.is_empty() {
+                        let message = format!(
+                            "assertion failed: (left == right, regex:{}), {fail_message}\n left: {resp_lines:?}\nright: {exp_lines:?}\ndiffs:\n  {}",
+                            self.regex,
+                            diffs.join("\n  ")
+                        );
+                        return CaseFlowControl::Error(message);
+                    }
                     if let Some(f) = &request.after_request_succeed {
                         f(context, &resp_lines);
                     }
@@ -1,4 +1,5 @@
 use http_protocol::status_code;
+use reqwest::Method;
 
 use crate::utils::global::E2eContext;
 use crate::utils::Client;
@@ -219,3 +220,71 @@ fn test2() {
         );
     }
 }
+
+#[test]
+fn test_session_logout() {
+    let mut ctx = E2eContext::new("auth_tests", "test_session_logout");
+    let mut executor = ctx.build_executor(cluster_def::one_data(1));
+    let host_port = executor.cluster_definition().data_cluster_def[0].http_host_port;
+    let api_v1_sql_url = &format!("http://{host_port}/api/v1/sql?db=public");
+    let api_v1_login_url = &format!("http://{host_port}/api/v1/login");
+    let api_v1_logout_url = &format!("http://{host_port}/api/v1/logout");
+
+    executor.startup();
+
+    {
+        // Start cnosdb singleton with `auth_enabled = false`, alter password for root.
+        let client = executor.case_context().data_client(0);
+        check_response!(client.post(api_v1_sql_url, "alter user root set password='abc'",));
+        check_response!(client.post(
+            api_v1_sql_url,
+            "alter user root set must_change_password = false",
+        ));
+        executor.shutdown();
+    }
+
+    // Start cnosdb singleton with `auth_enabled = true`
+    executor.set_update_data_config_fn_vec(vec![Some(Box::new(|config| {
+        config.query.auth_enabled = true;
+        config.security.session_secret = "secret".to_string();
+    }))]);
+    executor.restart(true);
+
+    let client = Client::with_auth("root".to_string(), Some("abc".to_owned()));
+    let resp = check_response!(client.post(api_v1_login_url, ""));
+    let body = resp.text().unwrap();
+    let token = regex::Regex::new(r#""token":"([^"]+)""#)
+        .unwrap()
+        .captures(&body)
+        .unwrap_or_else(|| panic!("no token in the response of login: {body}"))[1]
+        .to_string();
+    let post_with_token = |url: &str, body: &str| {
+        client
+            .request(Method::POST, url)
+            .bearer_auth(&token)
+            .body(body.to_string())
+            .send()
+            .unwrap()
+    };
+
+    // the session is cached after the first query
+    for _ in 0..2 {
+        let resp = post_with_token(api_v1_sql_url, "select 1");
+        assert_eq!(resp.status(), status_code::OK);
+        assert_eq!(resp.text().unwrap(), "Int64(1)\n1\n");
+    }
+
+    let resp = post_with_token(api_v1_logout_url, "");
+    assert_eq!(resp.status(), status_code::OK);
+
+    let resp = post_with_token(api_v1_sql_url, "select 1");
+    assert_eq!(resp.status(), status_code::UNPROCESSABLE_ENTITY);
+    assert!(
+        resp.text().unwrap().contains("session revoked"),
+        "the revoked session is still accepted"
+    );
+
+    // the basic auth is not affected by the logout
+    let resp = check_response!(client.post(api_v1_sql_url, "select 1"));
+    assert_eq!(resp.text().unwrap(), "Int64(1)\n1\n");
+}
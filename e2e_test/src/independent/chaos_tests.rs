@@ -8,6 +8,7 @@ use metrics::metric_register::MetricsRegister;
 use parking_lot::Mutex;
 use rand::Rng;
 
+use crate::case::chaos::{ChaosOptions, ChaosRunner, Fault};
 use crate::utils::global::E2eContext;
 use crate::utils::{Client, CnosdbDataTestHelper};
 use crate::{check_response, cluster_def};
@@ -171,3 +172,40 @@ fn chaos_test_case_1() {
 
     println!("#### Test complete chaos_test_case_1 ####");
 }
+
+#[test]
+fn chaos_test_concurrent_write_query() {
+    println!("Test begin 'chaos_test_concurrent_write_query'");
+    let mut ctx = E2eContext::new("chaos_tests", "concurrent_write_query");
+    let mut executor = ctx.build_executor(cluster_def::one_meta_two_data_bundled());
+    let host_port = executor.cluster_definition().data_cluster_def[0].http_host_port;
+
+    executor.startup();
+    std::thread::sleep(std::time::Duration::from_secs(2));
+
+    let client = Client::with_auth("root".to_string(), Some(String::new()));
+    check_response!(client.post(
+        format!("http://{host_port}/api/v1/sql"),
+        "CREATE DATABASE chaos_write_query_db WITH TTL '3650d' SHARD 2 VNODE_DURATION '1d' REPLICA 2;",
+    ));
+    std::thread::sleep(std::time::Duration::from_secs(2));
+
+    let runner = ChaosRunner::new(
+        executor,
+        ChaosOptions {
+            database: "chaos_write_query_db".to_string(),
+            table: "ma".to_string(),
+            writers: 4,
+            queriers: 2,
+            faults: vec![Fault::RestartDataNode(1), Fault::DropShardReplica],
+            fault_interval: std::time::Duration::from_secs(10),
+            duration: std::time::Duration::from_secs(60),
+        },
+    );
+    let report = runner.run();
+    println!("{report}");
+    assert!(report.points_acknowledged > 0);
+    assert!(report.violations.is_empty(), "{report}");
+
+    println!("#### Test complete chaos_test_concurrent_write_query ####");
+}
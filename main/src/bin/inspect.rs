@@ -0,0 +1,170 @@
+//! Inspect the files of CnosDB offline.
+
+use std::error::Error;
+use std::path::{Path, PathBuf};
+use std::process::ExitCode;
+
+use clap::{Parser, Subcommand};
+use config::VERSION;
+use coordinator::backup::{verify_backup, BackupVerification};
+use futures::TryStreamExt;
+use meta::meta_cluster_command::backup::EncryptionKey;
+use object_store::aws::AmazonS3Builder;
+use object_store::ObjectStore;
+use spi::query::datasource::s3::S3StorageConfigBuilder;
+use tokio::io::AsyncWriteExt;
+
+#[derive(Debug, Parser)]
+#[command(name = "cnosdb-inspect", version = & VERSION[..])]
+#[command(about = "Inspect the files of CnosDB offline")]
+struct Cli {
+    #[command(subcommand)]
+    subcmd: InspectCommand,
+}
+
+#[derive(Debug, Subcommand)]
+enum InspectCommand {
+    /// Verify a backup without restoring it: the manifest is complete, the
+    /// tsm files are intact and the meta and the snapshots can be parsed.
+    VerifyBackup(VerifyBackupArgs),
+}
+
+#[derive(Debug, clap::Args)]
+struct VerifyBackupArgs {
+    /// Directory of the backup, or the S3 prefix of it as s3://<bucket>/<prefix>
+    path: String,
+
+    /// Region of the S3 bucket
+    #[arg(long, default_value = "us-east-1")]
+    s3_region: String,
+
+    /// Endpoint of the S3 compatible storage, AWS if not set
+    #[arg(long)]
+    s3_endpoint: Option<String>,
+
+    #[arg(long, env = "AWS_ACCESS_KEY_ID")]
+    s3_access_key_id: Option<String>,
+
+    #[arg(long, env = "AWS_SECRET_ACCESS_KEY")]
+    s3_secret_access_key: Option<String>,
+
+    /// Directory the backup in S3 is downloaded to, removed after verified
+    #[arg(long, default_value = "cnosdb-verify-backup")]
+    work_dir: PathBuf,
+
+    /// Decrypt the files of the backup with the key in the file
+    #[arg(long)]
+    encryption_key_file: Option<String>,
+
+    /// Decrypt the files of the backup with the key printed by the command
+    #[arg(long)]
+    encryption_key_command: Option<String>,
+}
+
+#[tokio::main]
+async fn main() -> ExitCode {
+    let cli = Cli::parse();
+    let result = match cli.subcmd {
+        InspectCommand::VerifyBackup(args) => verify(args).await,
+    };
+    match result {
+        Ok(true) => ExitCode::SUCCESS,
+        Ok(false) => ExitCode::FAILURE,
+        Err(e) => {
+            eprintln!("Error: {}", e);
+            ExitCode::FAILURE
+        }
+    }
+}
+
+/// Returns whether the backup is good.
+async fn verify(args: VerifyBackupArgs) -> Result<bool, Box<dyn Error>> {
+    let key = EncryptionKey::from_options(
+        args.encryption_key_file.as_deref(),
+        args.encryption_key_command.as_deref(),
+    )?;
+    let result = match args.path.strip_prefix("s3://") {
+        Some(location) => {
+            let (bucket, prefix) = location.split_once('/').unwrap_or((location, ""));
+            if args.work_dir.exists() {
+                return Err(format!("work dir {} already exists", args.work_dir.display()).into());
+            }
+            let result = async {
+                download_s3_prefix(&args, bucket, prefix).await?;
+                Ok::<_, Box<dyn Error>>(verify_backup(&args.work_dir, key.as_ref()).await?)
+            }
+            .await;
+            let _ = tokio::fs::remove_dir_all(&args.work_dir).await;
+            result?
+        }
+        None => verify_backup(Path::new(&args.path), key.as_ref()).await?,
+    };
+
+    print_verification(&args.path, &result);
+    Ok(result.is_ok())
+}
+
+async fn download_s3_prefix(
+    args: &VerifyBackupArgs,
+    bucket: &str,
+    prefix: &str,
+) -> Result<(), Box<dyn Error>> {
+    let mut config = S3StorageConfigBuilder::default();
+    config.region(args.s3_region.clone()).bucket(bucket);
+    if let Some(endpoint) = &args.s3_endpoint {
+        config.endpoint_url(endpoint.clone());
+    }
+    if let Some(access_key_id) = &args.s3_access_key_id {
+        config.access_key_id(access_key_id.clone());
+    }
+    if let Some(secret_access_key) = &args.s3_secret_access_key {
+        config.secret_access_key(secret_access_key.clone());
+    }
+    let store = AmazonS3Builder::from(config.build()?).build()?;
+
+    let prefix = object_store::path::Path::from(prefix.trim_end_matches('/'));
+    let objects = store
+        .list(Some(&prefix))
+        .await?
+        .try_collect::<Vec<_>>()
+        .await?;
+    if objects.is_empty() {
+        return Err(format!("no objects under s3://{}/{}", bucket, prefix).into());
+    }
+    for object in objects {
+        let relative = object
+            .location
+            .prefix_match(&prefix)
+            .map(|parts| parts.map(|p| p.as_ref().to_string()).collect::<Vec<_>>())
+            .unwrap_or_default();
+        let path = relative
+            .iter()
+            .fold(args.work_dir.clone(), |path, part| path.join(part));
+        if let Some(parent) = path.parent() {
+            tokio::fs::create_dir_all(parent).await?;
+        }
+        let mut file = tokio::fs::File::create(&path).await?;
+        let mut stream = store.get(&object.location).await?.into_stream();
+        while let Some(bytes) = stream.try_next().await? {
+            file.write_all(&bytes).await?;
+        }
+        file.sync_all().await?;
+    }
+    Ok(())
+}
+
+fn print_verification(path: &str, result: &BackupVerification) {
+    println!("Backup: {}", path);
+    println!("Databases: {}", result.databases);
+    println!("Replica sets: {}", result.replica_sets);
+    println!("Files: {}", result.files);
+    println!("TSM files: {}, pages: {}", result.tsm_files, result.pages);
+    if result.is_ok() {
+        println!("OK");
+    } else {
+        println!("{} problems:", result.problems.len());
+        for problem in result.problems.iter() {
+            println!("  {}", problem);
+        }
+    }
+}
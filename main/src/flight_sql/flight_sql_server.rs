@@ -22,7 +22,7 @@ use arrow_flight::{
 };
 use datafusion::arrow::datatypes::{Schema, SchemaRef, ToByteSlice};
 use futures::Stream;
-use http_protocol::header::{DB, STREAM_TRIGGER_INTERVAL, TARGET_PARTITIONS, TENANT};
+use http_protocol::header::{ALIGN_SERIES, DB, STREAM_TRIGGER_INTERVAL, TARGET_PARTITIONS, TENANT};
 use models::auth::user::User;
 use models::oid::UuidGenerator;
 use moka::sync::Cache;
@@ -201,11 +201,18 @@ where
                         STREAM_TRIGGER_INTERVAL, e
                     ))
                 })?;
+        let align_series = utils::get_value_from_header(metadata, ALIGN_SERIES, "")
+            .map(|e| e.parse::<bool>())
+            .transpose()
+            .map_err(|e| {
+                Status::invalid_argument(format!("parse {} failed, error: {}", ALIGN_SERIES, e))
+            })?;
         let ctx = ContextBuilder::new(user)
             .with_tenant(tenant)
             .with_database(db)
             .with_target_partitions(target_partitions)
             .with_stream_trigger_interval(stream_trigger_interval)
+            .with_align_series(align_series)
             .build();
 
         Ok(ctx)
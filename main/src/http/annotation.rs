@@ -0,0 +1,324 @@
+//! Stores the annotations, e.g. the deploy markers shown on the dashboards,
+//! as the rows of the table [`ANNOTATIONS_TABLE`] in the database of the
+//! request, so that they are kept as long as the metrics of the database,
+//! see the apis `POST /api/v1/annotations` and `GET /api/v1/annotations`.
+
+use std::borrow::Cow;
+use std::collections::BTreeMap;
+
+use datafusion::arrow::array::{Array, ArrayRef, AsArray};
+use datafusion::arrow::compute::cast;
+use datafusion::arrow::datatypes::{DataType, Int64Type, TimeUnit};
+use datafusion::arrow::error::ArrowError;
+use datafusion::arrow::record_batch::RecordBatch;
+use models::schema::tskv_table_schema::{ColumnType, TskvTableSchema};
+use protocol_parser::Line;
+use protos::FieldValue;
+use serde::{Deserialize, Serialize};
+
+use super::export::quote_ident;
+
+pub const ANNOTATIONS_TABLE: &str = "annotations";
+const TEXT_FIELD: &str = "text";
+const TIME_END_FIELD: &str = "time_end";
+
+/// An annotation of the time `time`, or the range `[time, time_end]`, the
+/// timestamps are in milliseconds.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Annotation {
+    pub time: i64,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub time_end: Option<i64>,
+    pub text: String,
+    #[serde(default)]
+    pub tags: BTreeMap<String, String>,
+}
+
+impl Annotation {
+    pub fn validate(&self) -> Result<(), String> {
+        if self.text.is_empty() {
+            return Err("the text of the annotation is empty".to_string());
+        }
+        if matches!(self.time_end, Some(end) if end < self.time) {
+            return Err(format!(
+                "time_end {} is before time {}",
+                self.time_end.unwrap_or_default(),
+                self.time
+            ));
+        }
+        for (key, value) in &self.tags {
+            if key.is_empty() || value.is_empty() {
+                return Err(format!("empty tag key or value: '{key}'='{value}'"));
+            }
+            if [TEXT_FIELD, TIME_END_FIELD, "time"].contains(&key.as_str()) {
+                return Err(format!("tag key {key} is reserved"));
+            }
+        }
+        Ok(())
+    }
+
+    /// The line written in millisecond precision.
+    pub fn to_line(&self) -> Line<'_> {
+        let tags = self
+            .tags
+            .iter()
+            .map(|(k, v)| (Cow::Borrowed(k.as_str()), Cow::Borrowed(v.as_str())))
+            .collect();
+        let mut fields = vec![(
+            Cow::Borrowed(TEXT_FIELD),
+            FieldValue::Str(self.text.as_bytes().to_vec()),
+        )];
+        if let Some(end) = self.time_end {
+            fields.push((Cow::Borrowed(TIME_END_FIELD), FieldValue::I64(end)));
+        }
+        Line::new(Cow::Borrowed(ANNOTATIONS_TABLE), tags, fields, self.time)
+    }
+}
+
+/// Parses the tag filter `k1:v1,k2:v2` of the list api.
+pub fn parse_tag_filter(tags: &str) -> Result<Vec<(&str, &str)>, String> {
+    tags.split(',')
+        .filter(|tag| !tag.is_empty())
+        .map(|tag| {
+            tag.split_once(':')
+                .filter(|(k, v)| !k.is_empty() && !v.is_empty())
+                .ok_or_else(|| format!("invalid tag filter '{tag}', expect key:value"))
+        })
+        .collect()
+}
+
+/// The query selecting the annotations in `[start, end)` having all the
+/// tags, the bounds are timestamps in milliseconds. `None` if a tag is not
+/// a tag of the table, so no annotation has it.
+pub fn annotations_sql(
+    table: &TskvTableSchema,
+    start: Option<i64>,
+    end: Option<i64>,
+    tags: &[(&str, &str)],
+) -> Option<String> {
+    let time = quote_ident(&table.time_column().name);
+    let mut filters = vec![];
+    if let Some(start) = start {
+        let start = start.saturating_mul(1_000_000);
+        filters.push(format!("{time} >= CAST({start} AS TIMESTAMP)"));
+    }
+    if let Some(end) = end {
+        let end = end.saturating_mul(1_000_000);
+        filters.push(format!("{time} < CAST({end} AS TIMESTAMP)"));
+    }
+    for (key, value) in tags {
+        if !matches!(table.column(key), Some(c) if c.column_type == ColumnType::Tag) {
+            return None;
+        }
+        filters.push(format!(
+            "{} = '{}'",
+            quote_ident(key),
+            value.replace('\'', "''")
+        ));
+    }
+
+    let mut sql = format!("SELECT * FROM {}", quote_ident(&table.name));
+    if !filters.is_empty() {
+        sql.push_str(" WHERE ");
+        sql.push_str(&filters.join(" AND "));
+    }
+    sql.push_str(&format!(" ORDER BY {time}"));
+    Some(sql)
+}
+
+/// Appends the annotations of a batch queried by [`annotations_sql`], the
+/// rows without text are skipped.
+pub fn batch_to_annotations(
+    table: &TskvTableSchema,
+    batch: &RecordBatch,
+    annotations: &mut Vec<Annotation>,
+) -> Result<(), ArrowError> {
+    let schema = batch.schema();
+    let mut times = None;
+    let mut texts = None;
+    let mut time_ends = None;
+    let mut tags = vec![];
+    for (field, array) in schema.fields().iter().zip(batch.columns()) {
+        match table.column(field.name()).map(|c| &c.column_type) {
+            Some(ColumnType::Time(_)) => times = Some(timestamps_millis(array)?),
+            Some(ColumnType::Tag) => tags.push((field.name(), cast(array, &DataType::Utf8)?)),
+            Some(ColumnType::Field(_)) if field.name() == TEXT_FIELD => {
+                texts = Some(cast(array, &DataType::Utf8)?)
+            }
+            Some(ColumnType::Field(_)) if field.name() == TIME_END_FIELD => {
+                time_ends = Some(cast(array, &DataType::Int64)?)
+            }
+            _ => {}
+        }
+    }
+    let (Some(times), Some(texts)) = (times, texts) else {
+        return Err(ArrowError::SchemaError(format!(
+            "the time or {TEXT_FIELD} column of {} is not queried",
+            table.name
+        )));
+    };
+    let texts = texts.as_string::<i32>();
+    let time_ends = time_ends.as_ref().map(|a| a.as_primitive::<Int64Type>());
+    let tags = tags
+        .iter()
+        .map(|(name, array)| (*name, array.as_string::<i32>()))
+        .collect::<Vec<_>>();
+
+    for (row, time) in times.into_iter().enumerate() {
+        if texts.is_null(row) {
+            continue;
+        }
+        annotations.push(Annotation {
+            time,
+            time_end: time_ends.filter(|a| a.is_valid(row)).map(|a| a.value(row)),
+            text: texts.value(row).to_string(),
+            tags: tags
+                .iter()
+                .filter(|(_, array)| array.is_valid(row))
+                .map(|(name, array)| (name.to_string(), array.value(row).to_string()))
+                .collect(),
+        });
+    }
+
+    Ok(())
+}
+
+fn timestamps_millis(array: &ArrayRef) -> Result<Vec<i64>, ArrowError> {
+    let values = cast(array, &DataType::Int64)?;
+    let values = values.as_primitive::<Int64Type>().values();
+    let millis = match array.data_type() {
+        DataType::Timestamp(TimeUnit::Second, _) => values.iter().map(|v| v * 1_000).collect(),
+        DataType::Timestamp(TimeUnit::Millisecond, _) => values.to_vec(),
+        DataType::Timestamp(TimeUnit::Microsecond, _) => values.iter().map(|v| v / 1_000).collect(),
+        DataType::Timestamp(TimeUnit::Nanosecond, _) => {
+            values.iter().map(|v| v / 1_000_000).collect()
+        }
+        other => {
+            return Err(ArrowError::SchemaError(format!(
+                "the time column is {other}, expect a timestamp"
+            )))
+        }
+    };
+    Ok(millis)
+}
+
+#[cfg(test)]
+mod test {
+    use std::collections::BTreeMap;
+    use std::sync::Arc;
+
+    use datafusion::arrow::array::{Int64Array, StringArray, TimestampNanosecondArray};
+    use datafusion::arrow::datatypes::TimeUnit;
+    use datafusion::arrow::record_batch::RecordBatch;
+    use models::schema::tskv_table_schema::{ColumnType, TableColumn, TskvTableSchema};
+    use models::ValueType;
+
+    use super::{
+        annotations_sql, batch_to_annotations, parse_tag_filter, Annotation, ANNOTATIONS_TABLE,
+    };
+
+    fn table() -> TskvTableSchema {
+        TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            ANNOTATIONS_TABLE.to_string(),
+            vec![
+                TableColumn::new_time_column(0, TimeUnit::Nanosecond),
+                TableColumn::new_tag_column(1, "service".to_string()),
+                TableColumn::new(
+                    2,
+                    "text".to_string(),
+                    ColumnType::Field(ValueType::String),
+                    Default::default(),
+                ),
+                TableColumn::new(
+                    3,
+                    "time_end".to_string(),
+                    ColumnType::Field(ValueType::Integer),
+                    Default::default(),
+                ),
+            ],
+        )
+    }
+
+    #[test]
+    fn test_validate() {
+        let mut annotation = Annotation {
+            time: 10,
+            time_end: Some(20),
+            text: "deploy v1.2".to_string(),
+            tags: BTreeMap::from([("service".to_string(), "api".to_string())]),
+        };
+        assert!(annotation.validate().is_ok());
+
+        annotation.time_end = Some(5);
+        assert!(annotation.validate().is_err());
+        annotation.time_end = None;
+        annotation.tags.insert("text".to_string(), "x".to_string());
+        assert!(annotation.validate().is_err());
+    }
+
+    #[test]
+    fn test_parse_tag_filter() {
+        assert_eq!(
+            parse_tag_filter("service:api,env:prod").unwrap(),
+            vec![("service", "api"), ("env", "prod")]
+        );
+        assert!(parse_tag_filter("").unwrap().is_empty());
+        assert!(parse_tag_filter("service").is_err());
+        assert!(parse_tag_filter("service:").is_err());
+    }
+
+    #[test]
+    fn test_annotations_sql() {
+        let table = table();
+        assert_eq!(
+            annotations_sql(&table, Some(1), Some(2), &[("service", "a'b")]).unwrap(),
+            "SELECT * FROM \"annotations\" WHERE \"time\" >= CAST(1000000 AS TIMESTAMP) \
+            AND \"time\" < CAST(2000000 AS TIMESTAMP) AND \"service\" = 'a''b' ORDER BY \"time\""
+        );
+        assert!(annotations_sql(&table, None, None, &[("env", "prod")]).is_none());
+        assert!(annotations_sql(&table, None, None, &[("text", "x")]).is_none());
+    }
+
+    #[test]
+    fn test_batch_to_annotations() {
+        let table = table();
+        let batch = RecordBatch::try_new(
+            table.to_arrow_schema(),
+            vec![
+                Arc::new(TimestampNanosecondArray::from(vec![
+                    1_000_000, 2_000_000, 3_000_000,
+                ])),
+                Arc::new(StringArray::from(vec![Some("api"), None, Some("web")])),
+                Arc::new(StringArray::from(vec![
+                    Some("deploy"),
+                    Some("restart"),
+                    None,
+                ])),
+                Arc::new(Int64Array::from(vec![Some(5), None, None])),
+            ],
+        )
+        .unwrap();
+
+        let mut annotations = vec![];
+        batch_to_annotations(&table, &batch, &mut annotations).unwrap();
+        assert_eq!(
+            annotations,
+            vec![
+                Annotation {
+                    time: 1,
+                    time_end: Some(5),
+                    text: "deploy".to_string(),
+                    tags: BTreeMap::from([("service".to_string(), "api".to_string())]),
+                },
+                Annotation {
+                    time: 2,
+                    time_end: None,
+                    text: "restart".to_string(),
+                    tags: BTreeMap::new(),
+                },
+            ]
+        );
+    }
+}
@@ -9,10 +9,20 @@ pub enum HttpApiType {
     ApiV1PromWrite,
 
     ApiV1Sql,
+    ApiV1Export,
+    ApiV1Changes,
+    ApiV1Annotations,
     ApiV1PromRead,
+    ApiV1PromQuery,
+    ApiV1PromQueryRange,
+    ApiV1PromLabels,
+    ApiV1PromLabelValues,
+    ApiV1PromSeries,
     ApiV1ESLogWrite,
 
     ApiV1Ping,
+    Ping,
+    ApiV2Buckets,
     DebugBacktrace,
     Write,
     ApiV1metaleader,
@@ -21,6 +31,7 @@ pub enum HttpApiType {
     DebugPprof,
     DebugJeprof,
     Metrics,
+    MetricsRates,
     ApiV1DumpSqlDdl,
     ApiV1Traces,
     ApiTraces,
@@ -48,12 +59,42 @@ impl Display for HttpApiType {
             HttpApiType::ApiV1Sql => {
                 write!(f, "api/v1/sql")
             }
+            HttpApiType::ApiV1Export => {
+                write!(f, "api/v1/export")
+            }
+            HttpApiType::ApiV1Changes => {
+                write!(f, "api/v1/changes")
+            }
+            HttpApiType::ApiV1Annotations => {
+                write!(f, "api/v1/annotations")
+            }
             HttpApiType::ApiV1PromRead => {
                 write!(f, "api/v1/prom/read")
             }
+            HttpApiType::ApiV1PromQuery => {
+                write!(f, "api/v1/query")
+            }
+            HttpApiType::ApiV1PromQueryRange => {
+                write!(f, "api/v1/query_range")
+            }
+            HttpApiType::ApiV1PromLabels => {
+                write!(f, "api/v1/labels")
+            }
+            HttpApiType::ApiV1PromLabelValues => {
+                write!(f, "api/v1/label/values")
+            }
+            HttpApiType::ApiV1PromSeries => {
+                write!(f, "api/v1/series")
+            }
             HttpApiType::ApiV1ESLogWrite => {
                 write!(f, "api/v1/es/write")
             }
+            HttpApiType::Ping => {
+                write!(f, "ping")
+            }
+            HttpApiType::ApiV2Buckets => {
+                write!(f, "api/v2/buckets")
+            }
             HttpApiType::ApiV1Ping => {
                 write!(f, "api/v1/ping")
             }
@@ -81,6 +122,9 @@ impl Display for HttpApiType {
             HttpApiType::Metrics => {
                 write!(f, "metrics")
             }
+            HttpApiType::MetricsRates => {
+                write!(f, "metrics/rates")
+            }
             HttpApiType::ApiV1DumpSqlDdl => {
                 write!(f, "api/v1/dump/sql/ddl")
             }
@@ -114,7 +158,15 @@ pub fn metrics_record_db(api: &HttpApiType) -> bool {
         | HttpApiType::ApiV1OpenTsDBWrite
         | HttpApiType::ApiV1PromWrite
         | HttpApiType::ApiV1ESLogWrite
+        | HttpApiType::ApiV1Export
+        | HttpApiType::ApiV1Changes
+        | HttpApiType::ApiV1Annotations
         | HttpApiType::ApiV1PromRead
+        | HttpApiType::ApiV1PromQuery
+        | HttpApiType::ApiV1PromQueryRange
+        | HttpApiType::ApiV1PromLabels
+        | HttpApiType::ApiV1PromLabelValues
+        | HttpApiType::ApiV1PromSeries
         | HttpApiType::ApiV1Traces
         | HttpApiType::ApiTraces
         | HttpApiType::ApiTracesID
@@ -123,6 +175,8 @@ pub fn metrics_record_db(api: &HttpApiType) -> bool {
         | HttpApiType::ApiServicesOperations => true,
         HttpApiType::ApiV1Sql
         | HttpApiType::ApiV1Ping
+        | HttpApiType::Ping
+        | HttpApiType::ApiV2Buckets
         | HttpApiType::DebugBacktrace
         | HttpApiType::Write
         | HttpApiType::ApiV1metaleader
@@ -131,6 +185,7 @@ pub fn metrics_record_db(api: &HttpApiType) -> bool {
         | HttpApiType::DebugPprof
         | HttpApiType::DebugJeprof
         | HttpApiType::Metrics
+        | HttpApiType::MetricsRates
         | HttpApiType::ApiV1DumpSqlDdl => false,
     }
 }
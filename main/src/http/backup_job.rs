@@ -0,0 +1,189 @@
+use std::collections::BTreeMap;
+use std::future::Future;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+
+use coordinator::backup::BackupManifest;
+use parking_lot::Mutex;
+use serde::Serialize;
+
+/// Keeps the finished backups to be queried, the oldest ones are removed first.
+const MAX_FINISHED_JOBS: usize = 100;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum BackupJobState {
+    Running,
+    Finished,
+    Failed,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct BackupJobStatus {
+    pub name: String,
+    pub tenant: String,
+    pub state: BackupJobState,
+    pub elapsed_ms: u128,
+    pub error: Option<String>,
+    pub manifest: Option<BackupManifest>,
+}
+
+struct BackupJob {
+    status: BackupJobStatus,
+    start: Instant,
+    elapsed: Option<Duration>,
+    finished_seq: u64,
+}
+
+impl BackupJob {
+    fn status(&self) -> BackupJobStatus {
+        let elapsed = self.elapsed.unwrap_or_else(|| self.start.elapsed());
+        BackupJobStatus {
+            elapsed_ms: elapsed.as_millis(),
+            ..self.status.clone()
+        }
+    }
+}
+
+/// The backups run in the background, polled by their names until they
+/// finish, so that a backup doesn't block the http request until it times
+/// out. A backup is only visible to the tenant backed up.
+#[derive(Default)]
+pub struct BackupJobs {
+    jobs: Mutex<BTreeMap<String, BackupJob>>,
+    finished_seq: AtomicU64,
+}
+
+impl BackupJobs {
+    /// Starts the backup named `name`, fails if a backup of the name is
+    /// running.
+    pub fn start<F>(self: &Arc<Self>, tenant: &str, name: &str, task: F) -> Result<(), String>
+    where
+        F: Future<Output = Result<BackupManifest, String>> + Send + 'static,
+    {
+        let job = BackupJob {
+            status: BackupJobStatus {
+                name: name.to_string(),
+                tenant: tenant.to_string(),
+                state: BackupJobState::Running,
+                elapsed_ms: 0,
+                error: None,
+                manifest: None,
+            },
+            start: Instant::now(),
+            elapsed: None,
+            finished_seq: 0,
+        };
+        {
+            let mut jobs = self.jobs.lock();
+            if let Some(job) = jobs.get(name) {
+                if job.status.state == BackupJobState::Running {
+                    return Err(format!("backup {} is running", name));
+                }
+            }
+            jobs.insert(name.to_string(), job);
+        }
+
+        let jobs = self.clone();
+        let name = name.to_string();
+        tokio::spawn(async move {
+            let result = task.await;
+            jobs.finish(&name, result);
+        });
+
+        Ok(())
+    }
+
+    pub fn status(&self, name: &str, tenant: &str) -> Option<BackupJobStatus> {
+        self.jobs
+            .lock()
+            .get(name)
+            .filter(|job| job.status.tenant == tenant)
+            .map(|job| job.status())
+    }
+
+    fn finish(&self, name: &str, result: Result<BackupManifest, String>) {
+        let seq = self.finished_seq.fetch_add(1, Ordering::Relaxed) + 1;
+        let mut jobs = self.jobs.lock();
+        if let Some(job) = jobs.get_mut(name) {
+            match result {
+                Ok(manifest) => {
+                    job.status.state = BackupJobState::Finished;
+                    job.status.manifest = Some(manifest);
+                }
+                Err(e) => {
+                    job.status.state = BackupJobState::Failed;
+                    job.status.error = Some(e);
+                }
+            }
+            job.elapsed = Some(job.start.elapsed());
+            job.finished_seq = seq;
+        }
+
+        let mut finished = jobs
+            .iter()
+            .filter(|(_, job)| job.status.state != BackupJobState::Running)
+            .map(|(name, job)| (job.finished_seq, name.clone()))
+            .collect::<Vec<_>>();
+        if finished.len() > MAX_FINISHED_JOBS {
+            finished.sort();
+            let to_remove = finished.len() - MAX_FINISHED_JOBS;
+            for (_, name) in finished.into_iter().take(to_remove) {
+                jobs.remove(&name);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+    use std::time::Duration;
+
+    use coordinator::backup::BackupManifest;
+
+    use super::{BackupJobState, BackupJobs};
+
+    #[tokio::test]
+    async fn test_backup_jobs() {
+        let jobs = Arc::new(BackupJobs::default());
+        let manifest = BackupManifest {
+            tenant: "cnosdb".to_string(),
+            created_at: 0,
+            compressed: false,
+            encrypted: false,
+            databases: vec![],
+        };
+
+        let finished = manifest.clone();
+        jobs.start("cnosdb", "b1", async move { Ok(finished) })
+            .unwrap();
+        jobs.start("cnosdb", "b2", async { Err("failed".to_string()) })
+            .unwrap();
+        jobs.start("cnosdb", "b3", async {
+            futures::future::pending::<()>().await;
+            Err("never".to_string())
+        })
+        .unwrap();
+        tokio::time::sleep(Duration::from_millis(100)).await;
+
+        let status = jobs.status("b1", "cnosdb").unwrap();
+        assert_eq!(status.state, BackupJobState::Finished);
+        assert_eq!(status.manifest, Some(manifest));
+        let status = jobs.status("b2", "cnosdb").unwrap();
+        assert_eq!(status.state, BackupJobState::Failed);
+        assert_eq!(status.error.as_deref(), Some("failed"));
+        assert_eq!(
+            jobs.status("b3", "cnosdb").unwrap().state,
+            BackupJobState::Running
+        );
+
+        // a running backup can't be started again
+        assert!(jobs
+            .start("cnosdb", "b3", async { Err("".to_string()) })
+            .is_err());
+        // only visible to the tenant backed up
+        assert!(jobs.status("b1", "other").is_none());
+    }
+}
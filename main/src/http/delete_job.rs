@@ -0,0 +1,203 @@
+use std::collections::BTreeMap;
+use std::future::Future;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+
+use parking_lot::Mutex;
+use serde::Serialize;
+use tokio::task::AbortHandle;
+
+/// Keeps the finished jobs to be queried, the oldest ones are removed first.
+const MAX_FINISHED_JOBS: usize = 100;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum DeleteJobState {
+    Running,
+    Finished,
+    Failed,
+    Cancelled,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct DeleteJobStatus {
+    pub job_id: u64,
+    pub tenant: String,
+    pub user: String,
+    pub sql: String,
+    pub state: DeleteJobState,
+    pub elapsed_ms: u128,
+    pub error: Option<String>,
+}
+
+struct DeleteJob {
+    status: DeleteJobStatus,
+    start: Instant,
+    elapsed: Option<Duration>,
+    abort: Option<AbortHandle>,
+}
+
+impl DeleteJob {
+    fn status(&self) -> DeleteJobStatus {
+        let elapsed = self.elapsed.unwrap_or_else(|| self.start.elapsed());
+        DeleteJobStatus {
+            elapsed_ms: elapsed.as_millis(),
+            ..self.status.clone()
+        }
+    }
+
+    fn finish(&mut self, state: DeleteJobState, error: Option<String>) {
+        if self.status.state == DeleteJobState::Running {
+            self.status.state = state;
+            self.status.error = error;
+            self.elapsed = Some(self.start.elapsed());
+            self.abort = None;
+        }
+    }
+
+    fn visible_to(&self, tenant: &str, user: &str) -> bool {
+        self.status.tenant == tenant && self.status.user == user
+    }
+}
+
+/// The DELETE statements run in the background, so that a large deletion
+/// doesn't block the http request until it times out. A job is only
+/// visible to the user who started it.
+#[derive(Default)]
+pub struct DeleteJobs {
+    next_id: AtomicU64,
+    jobs: Mutex<BTreeMap<u64, DeleteJob>>,
+}
+
+impl DeleteJobs {
+    pub fn start<F>(self: &Arc<Self>, tenant: &str, user: &str, sql: &str, task: F) -> u64
+    where
+        F: Future<Output = Result<(), String>> + Send + 'static,
+    {
+        let job_id = self.next_id.fetch_add(1, Ordering::Relaxed) + 1;
+        let job = DeleteJob {
+            status: DeleteJobStatus {
+                job_id,
+                tenant: tenant.to_string(),
+                user: user.to_string(),
+                sql: sql.to_string(),
+                state: DeleteJobState::Running,
+                elapsed_ms: 0,
+                error: None,
+            },
+            start: Instant::now(),
+            elapsed: None,
+            abort: None,
+        };
+        self.jobs.lock().insert(job_id, job);
+
+        let jobs = self.clone();
+        let handle = tokio::spawn(async move {
+            let result = task.await;
+            jobs.finish(job_id, result);
+        });
+        if let Some(job) = self.jobs.lock().get_mut(&job_id) {
+            if job.status.state == DeleteJobState::Running {
+                job.abort = Some(handle.abort_handle());
+            }
+        }
+
+        job_id
+    }
+
+    pub fn status(&self, job_id: u64, tenant: &str, user: &str) -> Option<DeleteJobStatus> {
+        self.jobs
+            .lock()
+            .get(&job_id)
+            .filter(|job| job.visible_to(tenant, user))
+            .map(|job| job.status())
+    }
+
+    /// Stops waiting for the deletion, the vnodes which have received the
+    /// deletion still finish it.
+    pub fn cancel(&self, job_id: u64, tenant: &str, user: &str) -> Option<DeleteJobStatus> {
+        let mut jobs = self.jobs.lock();
+        let job = jobs
+            .get_mut(&job_id)
+            .filter(|job| job.visible_to(tenant, user))?;
+        if let Some(abort) = job.abort.take() {
+            abort.abort();
+        }
+        job.finish(DeleteJobState::Cancelled, None);
+        Some(job.status())
+    }
+
+    fn finish(&self, job_id: u64, result: Result<(), String>) {
+        let mut jobs = self.jobs.lock();
+        if let Some(job) = jobs.get_mut(&job_id) {
+            match result {
+                Ok(()) => job.finish(DeleteJobState::Finished, None),
+                Err(e) => job.finish(DeleteJobState::Failed, Some(e)),
+            }
+        }
+
+        let finished = jobs
+            .values()
+            .filter(|job| job.status.state != DeleteJobState::Running)
+            .count();
+        if finished > MAX_FINISHED_JOBS {
+            let to_remove = jobs
+                .iter()
+                .filter(|(_, job)| job.status.state != DeleteJobState::Running)
+                .map(|(id, _)| *id)
+                .take(finished - MAX_FINISHED_JOBS)
+                .collect::<Vec<_>>();
+            for id in to_remove {
+                jobs.remove(&id);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+    use std::time::Duration;
+
+    use super::{DeleteJobState, DeleteJobs};
+
+    #[tokio::test]
+    async fn test_delete_jobs() {
+        let jobs = Arc::new(DeleteJobs::default());
+
+        let id = jobs.start("cnosdb", "root", "DELETE FROM t", async { Ok(()) });
+        let id_failed = jobs.start("cnosdb", "root", "DELETE FROM t", async {
+            Err("failed".to_string())
+        });
+        let id_pending = jobs.start("cnosdb", "root", "DELETE FROM t", async {
+            futures::future::pending::<()>().await;
+            Ok(())
+        });
+        tokio::time::sleep(Duration::from_millis(100)).await;
+
+        assert_eq!(
+            jobs.status(id, "cnosdb", "root").unwrap().state,
+            DeleteJobState::Finished
+        );
+        let status = jobs.status(id_failed, "cnosdb", "root").unwrap();
+        assert_eq!(status.state, DeleteJobState::Failed);
+        assert_eq!(status.error.as_deref(), Some("failed"));
+        assert_eq!(
+            jobs.status(id_pending, "cnosdb", "root").unwrap().state,
+            DeleteJobState::Running
+        );
+
+        // only visible to the user who started it
+        assert!(jobs.status(id, "cnosdb", "other").is_none());
+        assert!(jobs.cancel(id_pending, "other", "root").is_none());
+
+        let status = jobs.cancel(id_pending, "cnosdb", "root").unwrap();
+        assert_eq!(status.state, DeleteJobState::Cancelled);
+        // a finished job is not changed by cancel
+        assert_eq!(
+            jobs.cancel(id, "cnosdb", "root").unwrap().state,
+            DeleteJobState::Finished
+        );
+    }
+}
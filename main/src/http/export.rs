@@ -0,0 +1,77 @@
+//! Exports the rows of the tables as line protocol, see the api
+//! `/api/v1/export`.
+
+use models::schema::tskv_table_schema::TskvTableSchema;
+
+/// The query selecting the rows of the table in `[start, end)`, the bounds
+/// are timestamps in nanoseconds.
+pub fn export_sql(table: &TskvTableSchema, start: Option<i64>, end: Option<i64>) -> String {
+    let time = quote_ident(&table.time_column().name);
+    let mut filters = vec![];
+    if let Some(start) = start {
+        filters.push(format!("{time} >= CAST({start} AS TIMESTAMP)"));
+    }
+    if let Some(end) = end {
+        filters.push(format!("{time} < CAST({end} AS TIMESTAMP)"));
+    }
+
+    let mut sql = format!("SELECT * FROM {}", quote_ident(&table.name));
+    if !filters.is_empty() {
+        sql.push_str(" WHERE ");
+        sql.push_str(&filters.join(" AND "));
+    }
+    sql
+}
+
+pub fn quote_ident(ident: &str) -> String {
+    format!("\"{}\"", ident.replace('"', "\"\""))
+}
+
+#[cfg(test)]
+mod test {
+    use datafusion::arrow::datatypes::TimeUnit;
+    use models::schema::tskv_table_schema::{ColumnType, TableColumn, TskvTableSchema};
+    use models::ValueType;
+
+    use super::export_sql;
+
+    fn table() -> TskvTableSchema {
+        TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            "air".to_string(),
+            vec![
+                TableColumn::new_time_column(0, TimeUnit::Nanosecond),
+                TableColumn::new_tag_column(1, "station".to_string()),
+                TableColumn::new(
+                    2,
+                    "visibility".to_string(),
+                    ColumnType::Field(ValueType::Float),
+                    Default::default(),
+                ),
+                TableColumn::new(
+                    3,
+                    "pressure".to_string(),
+                    ColumnType::Field(ValueType::Integer),
+                    Default::default(),
+                ),
+                TableColumn::new(
+                    4,
+                    "note".to_string(),
+                    ColumnType::Field(ValueType::String),
+                    Default::default(),
+                ),
+            ],
+        )
+    }
+
+    #[test]
+    fn test_export_sql() {
+        let table = table();
+        assert_eq!(export_sql(&table, None, None), "SELECT * FROM \"air\"");
+        assert_eq!(
+            export_sql(&table, Some(1), Some(2)),
+            "SELECT * FROM \"air\" WHERE \"time\" >= CAST(1 AS TIMESTAMP) AND \"time\" < CAST(2 AS TIMESTAMP)"
+        );
+    }
+}
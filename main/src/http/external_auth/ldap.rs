@@ -0,0 +1,111 @@
+//! Authenticates the users by a simple bind against the LDAP server, and
+//! searches the groups of the user.
+
+use config::tskv::LdapConfig;
+use ldap3::{dn_escape, ldap_escape, Ldap, LdapConnAsync, LdapConnSettings, Scope, SearchEntry};
+
+use super::ExternalIdentity;
+
+type Result<T> = std::result::Result<T, String>;
+
+/// Binds as the user, and searches the groups of the user if
+/// `group_base_dn` is set.
+pub async fn authenticate(
+    config: &LdapConfig,
+    user: &str,
+    password: &str,
+) -> Result<ExternalIdentity> {
+    // the bind without password is an unauthenticated bind, which succeeds
+    // for any user
+    if user.is_empty() || password.is_empty() {
+        return Err("empty user or password".to_string());
+    }
+    let dn = config.bind_dn.replace("{user}", &dn_escape(user));
+
+    // ldaps:// is connected by TLS, and ldap:// is upgraded by StartTLS if
+    // configured
+    let settings = LdapConnSettings::new()
+        .set_conn_timeout(config.timeout)
+        .set_starttls(config.starttls);
+    let (conn, mut ldap) = LdapConnAsync::with_settings(settings, &config.url)
+        .await
+        .map_err(|e| format!("failed to connect {}: {}", config.url, e))?;
+    ldap3::drive!(conn);
+
+    let search = bind_and_search(config, &mut ldap, &dn, password);
+    let result = match tokio::time::timeout(config.timeout, search).await {
+        Ok(groups) => groups,
+        Err(_) => Err(format!("timeout authenticating by {}", config.url)),
+    };
+    let _ = ldap.unbind().await;
+
+    result.map(|groups| ExternalIdentity {
+        user: user.to_string(),
+        groups,
+    })
+}
+
+async fn bind_and_search(
+    config: &LdapConfig,
+    ldap: &mut Ldap,
+    dn: &str,
+    password: &str,
+) -> Result<Vec<String>> {
+    ldap.simple_bind(dn, password)
+        .await
+        .and_then(|res| res.success())
+        .map_err(|e| format!("failed to bind {}: {}", dn, e))?;
+
+    let base_dn = match &config.group_base_dn {
+        Some(base_dn) => base_dn,
+        None => return Ok(vec![]),
+    };
+    let filter = format!("({}={})", config.group_member_attribute, ldap_escape(dn));
+    let (entries, _) = ldap
+        .search(
+            base_dn,
+            Scope::Subtree,
+            &filter,
+            vec![config.group_name_attribute.as_str()],
+        )
+        .await
+        .and_then(|res| res.success())
+        .map_err(|e| format!("failed to search the groups of {}: {}", dn, e))?;
+
+    Ok(entries
+        .into_iter()
+        .map(SearchEntry::construct)
+        .flat_map(|entry| group_names(entry, &config.group_name_attribute))
+        .collect())
+}
+
+/// The values of the attribute, the names of the attributes returned by the
+/// server are case-insensitive.
+fn group_names(entry: SearchEntry, attribute: &str) -> Vec<String> {
+    entry
+        .attrs
+        .into_iter()
+        .find(|(name, _)| name.eq_ignore_ascii_case(attribute))
+        .map(|(_, values)| values)
+        .unwrap_or_default()
+}
+
+#[cfg(test)]
+mod test {
+    use std::collections::HashMap;
+
+    use ldap3::SearchEntry;
+
+    use super::group_names;
+
+    #[test]
+    fn test_group_names() {
+        let entry = SearchEntry {
+            dn: "cn=dba,ou=groups,dc=example,dc=com".to_string(),
+            attrs: HashMap::from([("CN".to_string(), vec!["dba".to_string()])]),
+            bin_attrs: HashMap::new(),
+        };
+        assert_eq!(group_names(entry.clone(), "cn"), vec!["dba".to_string()]);
+        assert!(group_names(entry, "ou").is_empty());
+    }
+}
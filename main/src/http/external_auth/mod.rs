@@ -0,0 +1,320 @@
+//! Authenticate the users of the http requests by the external identity
+//! providers configured in `[security.external_auth]`.
+//!
+//! The users authenticated externally are created in meta without password
+//! and marked as external on their first login, and join the tenants by the
+//! roles mapped from their groups. The roles of the external users are only
+//! managed by the mappings, a user no longer mapped to a tenant is removed
+//! from it.
+
+use std::sync::OnceLock;
+
+use base64::prelude::{Engine, BASE64_STANDARD};
+use config::tskv::ExternalAuthConfig;
+use http_protocol::header::{BASIC_PREFIX, BEARER_PREFIX};
+use meta::error::MetaError;
+use meta::model::MetaRef;
+use models::auth::auth_cache::AuthCache;
+use models::auth::role::{SystemTenantRole, TenantRoleIdentifier};
+use models::auth::session::SessionToken;
+use models::auth::user::{User, UserDesc, UserOptionsBuilder};
+use models::auth::AuthError;
+use models::oid::Identifier;
+use openssl::sha::Sha256;
+use snafu::ResultExt;
+use spi::QueryError;
+use trace::{info, warn};
+
+use super::{Error as HttpError, MetaSnafu};
+
+mod ldap;
+mod oidc;
+
+static IDENTITY_CACHE: OnceLock<AuthCache<String, ExternalIdentity>> = OnceLock::new();
+
+/// A user authenticated by the external identity provider.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ExternalIdentity {
+    pub user: String,
+    pub groups: Vec<String>,
+}
+
+/// Authenticates the authorization header by the provider accepting it,
+/// the basic auth by LDAP and the bearer token by OIDC.
+///
+/// Returns `None` if no provider is configured for the authorization, or the
+/// user of the basic auth is a local user of CnosDB.
+pub async fn authenticate(
+    config: &ExternalAuthConfig,
+    authorization: &str,
+    meta: &MetaRef,
+) -> Result<Option<ExternalIdentity>, HttpError> {
+    let cache = IDENTITY_CACHE.get_or_init(|| AuthCache::new(1024, Some(config.cache_ttl)));
+
+    let (key, identity) = if let Some(token) = authorization.strip_prefix(BEARER_PREFIX) {
+        let Some(oidc_config) = &config.oidc else {
+            return Ok(None);
+        };
+        // the sessions issued by CnosDB are never introspected
+        if SessionToken::decode(token).is_ok() {
+            return Ok(None);
+        }
+        let key = cache_key("", token);
+        if let Some(identity) = cache.get(&key) {
+            return Ok(Some(identity));
+        }
+        let identity = oidc::introspect(oidc_config, token)
+            .await
+            .map_err(|err| denied("", "oidc", err))?;
+        (key, identity)
+    } else if let Some(basic) = authorization.strip_prefix(BASIC_PREFIX) {
+        let Some(ldap_config) = &config.ldap else {
+            return Ok(None);
+        };
+        let (user, password) = decode_basic_auth(basic)?;
+        let key = cache_key(&user, &password);
+        if let Some(identity) = cache.get(&key) {
+            return Ok(Some(identity));
+        }
+        // the local users failed to log in are never handed to the provider
+        match meta.user_desc(&user).await {
+            Ok(desc) if !is_external(&desc) => return Ok(None),
+            Ok(_) | Err(MetaError::UserNotFound { .. }) => {}
+            Err(source) => return Err(HttpError::Meta { source }),
+        }
+        let identity = ldap::authenticate(ldap_config, &user, &password)
+            .await
+            .map_err(|err| denied(&user, "ldap", err))?;
+        (key, identity)
+    } else {
+        return Ok(None);
+    };
+
+    cache.insert(key, identity.clone());
+    Ok(Some(identity))
+}
+
+/// The key of the identity authenticated by the credential, the credential
+/// is digested with a random salt of the process, so that the passwords and
+/// tokens are never kept in memory.
+fn cache_key(user: &str, credential: &str) -> String {
+    static SALT: OnceLock<[u8; 32]> = OnceLock::new();
+    let mut hasher = Sha256::new();
+    hasher.update(SALT.get_or_init(rand::random));
+    hasher.update(credential.as_bytes());
+    format!("{}:{}", user, BASE64_STANDARD.encode(hasher.finish()))
+}
+
+/// Gets the user authenticated externally with the privileges of the tenant,
+/// the user is created if not exists, and the role of the user in the tenant
+/// is updated by the group mappings.
+pub async fn external_user(
+    config: &ExternalAuthConfig,
+    identity: &ExternalIdentity,
+    tenant_name: &str,
+    meta: MetaRef,
+) -> Result<User, HttpError> {
+    let user_desc = match meta.user(&identity.user).await.context(MetaSnafu)? {
+        Some(desc) if is_external(&desc) => desc,
+        // the local users can't be taken over by the provider
+        Some(_) => {
+            return Err(denied(
+                &identity.user,
+                "external",
+                "the user is authenticated by CnosDB",
+            ));
+        }
+        None => {
+            let options = UserOptionsBuilder::default()
+                .comment("authenticated by the external identity provider")
+                .external(true)
+                .build()
+                .map_err(|e| denied(&identity.user, "external", e.to_string()))?;
+            match meta
+                .create_user(identity.user.clone(), options, false)
+                .await
+            {
+                Ok(_) => info!("created the external user {}", identity.user),
+                // created by another request in the meantime
+                Err(MetaError::UserAlreadyExists { .. }) => {}
+                Err(source) => return Err(HttpError::Meta { source }),
+            }
+            let desc = meta
+                .user(&identity.user)
+                .await
+                .context(MetaSnafu)?
+                .ok_or_else(|| MetaError::UserNotFound {
+                    user: identity.user.clone(),
+                })
+                .context(MetaSnafu)?;
+            // a local user created by another request in the meantime
+            if !is_external(&desc) {
+                return Err(denied(
+                    &identity.user,
+                    "external",
+                    "the user is authenticated by CnosDB",
+                ));
+            }
+            desc
+        }
+    };
+
+    let tenant = meta
+        .tenant_meta(tenant_name)
+        .await
+        .ok_or_else(|| MetaError::TenantNotFound {
+            tenant: tenant_name.to_string(),
+        })
+        .context(MetaSnafu)?;
+    let user_id = *user_desc.id();
+    let current = tenant
+        .member_role(&user_id, false)
+        .await
+        .context(MetaSnafu)?;
+    match (mapped_role(config, identity, tenant_name), current) {
+        (Some(role), Some(current)) if current == role => {}
+        (Some(role), Some(_)) => tenant
+            .reassign_member_role(user_id, role)
+            .await
+            .context(MetaSnafu)?,
+        (Some(role), None) => tenant
+            .add_member_with_role(user_id, role)
+            .await
+            .context(MetaSnafu)?,
+        // the groups granting the role are gone
+        (None, Some(_)) => {
+            tenant.remove_member(user_id).await.context(MetaSnafu)?;
+            info!(
+                "removed the external user {} from the tenant {}",
+                identity.user, tenant_name
+            );
+        }
+        (None, None) => {}
+    }
+
+    meta.user_with_privileges(&identity.user, tenant_name)
+        .await
+        .context(MetaSnafu)
+}
+
+/// Only the users created by the provider are authenticated by it, a local
+/// user, even without password, is never taken over by an external identity
+/// of the same name.
+fn is_external(desc: &UserDesc) -> bool {
+    !desc.is_root_admin() && desc.options().external()
+}
+
+/// The role of the tenant granted by the first mapping matching the groups.
+fn mapped_role(
+    config: &ExternalAuthConfig,
+    identity: &ExternalIdentity,
+    tenant_name: &str,
+) -> Option<TenantRoleIdentifier> {
+    config
+        .group_mappings
+        .iter()
+        .find(|mapping| mapping.tenant == tenant_name && identity.groups.contains(&mapping.group))
+        .map(
+            |mapping| match SystemTenantRole::try_from(mapping.role.as_str()) {
+                Ok(role) => TenantRoleIdentifier::System(role),
+                Err(_) => TenantRoleIdentifier::Custom(mapping.role.clone()),
+            },
+        )
+}
+
+fn decode_basic_auth(basic: &str) -> Result<(String, String), HttpError> {
+    let parse_err = || HttpError::ParseAuth {
+        reason: format!("{}{}", BASIC_PREFIX, basic),
+    };
+    let content = BASE64_STANDARD.decode(basic).map_err(|_| parse_err())?;
+    let content = String::from_utf8(content).map_err(|_| parse_err())?;
+    let (user, password) = content.split_once(':').ok_or_else(parse_err)?;
+    Ok((user.to_string(), password.to_string()))
+}
+
+fn denied(user_name: &str, auth_type: &str, err: impl Into<String>) -> HttpError {
+    let err = err.into();
+    warn!(
+        "external authentication of user '{}' by {} failed: {}",
+        user_name, auth_type, err
+    );
+    HttpError::Query {
+        source: QueryError::Auth {
+            source: AuthError::AccessDenied {
+                user_name: user_name.to_string(),
+                auth_type: auth_type.to_string(),
+                err,
+            },
+        },
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use config::tskv::{ExternalAuthConfig, GroupMapping};
+    use models::auth::role::{SystemTenantRole, TenantRoleIdentifier};
+    use models::auth::user::{UserDesc, UserOptions, UserOptionsBuilder};
+
+    use super::{cache_key, is_external, mapped_role, ExternalIdentity};
+
+    #[test]
+    fn test_cache_key() {
+        let key = cache_key("alice", "password");
+        assert!(key.starts_with("alice:"));
+        assert!(!key.contains("password"));
+        assert_eq!(key, cache_key("alice", "password"));
+        assert_ne!(key, cache_key("alice", "other"));
+        assert_ne!(key, cache_key("bob", "password"));
+    }
+
+    #[test]
+    fn test_is_external() {
+        let external = UserOptionsBuilder::default()
+            .external(true)
+            .build()
+            .unwrap();
+        let local = UserOptionsBuilder::default().build().unwrap();
+        let user = |options: &UserOptions, is_root_admin| {
+            UserDesc::new(0, "alice".to_string(), options.clone(), is_root_admin)
+        };
+
+        assert!(is_external(&user(&external, false)));
+        // the local users, even without password, and root
+        assert!(!is_external(&user(&local, false)));
+        assert!(!is_external(&user(&external, true)));
+    }
+
+    #[test]
+    fn test_mapped_role() {
+        let config = ExternalAuthConfig {
+            group_mappings: vec![
+                GroupMapping {
+                    group: "dba".to_string(),
+                    tenant: "cnosdb".to_string(),
+                    role: "owner".to_string(),
+                },
+                GroupMapping {
+                    group: "dev".to_string(),
+                    tenant: "cnosdb".to_string(),
+                    role: "developer".to_string(),
+                },
+            ],
+            ..Default::default()
+        };
+        let identity = |groups: &[&str]| ExternalIdentity {
+            user: "alice".to_string(),
+            groups: groups.iter().map(|g| g.to_string()).collect(),
+        };
+
+        assert_eq!(
+            mapped_role(&config, &identity(&["dev", "dba"]), "cnosdb"),
+            Some(TenantRoleIdentifier::System(SystemTenantRole::Owner))
+        );
+        assert_eq!(
+            mapped_role(&config, &identity(&["dev"]), "cnosdb"),
+            Some(TenantRoleIdentifier::Custom("developer".to_string()))
+        );
+        assert_eq!(mapped_role(&config, &identity(&["dev"]), "other"), None);
+        assert_eq!(mapped_role(&config, &identity(&[]), "cnosdb"), None);
+    }
+}
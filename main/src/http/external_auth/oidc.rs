@@ -0,0 +1,151 @@
+use std::collections::HashMap;
+
+use config::tskv::OidcConfig;
+use lazy_static::lazy_static;
+use serde::Deserialize;
+use serde_json::Value;
+
+use super::ExternalIdentity;
+
+lazy_static! {
+    static ref HTTP_CLIENT: reqwest::Client = reqwest::Client::new();
+}
+
+/// The response of the token introspection (RFC 7662).
+#[derive(Debug, Deserialize)]
+struct Introspection {
+    active: bool,
+    #[serde(flatten)]
+    claims: HashMap<String, Value>,
+}
+
+/// Asks the provider whether the token is active.
+pub async fn introspect(config: &OidcConfig, token: &str) -> Result<ExternalIdentity, String> {
+    let response = HTTP_CLIENT
+        .post(&config.introspection_url)
+        .basic_auth(&config.client_id, Some(&config.client_secret))
+        .form(&[("token", token), ("token_type_hint", "access_token")])
+        .timeout(config.timeout)
+        .send()
+        .await
+        .map_err(|e| format!("failed to introspect token: {}", e))?;
+    if !response.status().is_success() {
+        return Err(format!(
+            "failed to introspect token: status {}",
+            response.status()
+        ));
+    }
+    let introspection = response
+        .json::<Introspection>()
+        .await
+        .map_err(|e| format!("invalid introspection response: {}", e))?;
+
+    to_identity(config, introspection)
+}
+
+fn to_identity(
+    config: &OidcConfig,
+    introspection: Introspection,
+) -> Result<ExternalIdentity, String> {
+    if !introspection.active {
+        return Err("inactive token".to_string());
+    }
+    let claim = |name: &str| introspection.claims.get(name).and_then(Value::as_str);
+    // the tokens of other clients of the provider are not accepted
+    let audience = config.audience.as_deref().unwrap_or(&config.client_id);
+    let for_audience = match introspection.claims.get("aud") {
+        Some(Value::String(aud)) => aud == audience,
+        Some(Value::Array(aud)) => aud.iter().any(|aud| aud.as_str() == Some(audience)),
+        _ => false,
+    };
+    if !for_audience && claim("client_id") != Some(config.client_id.as_str()) {
+        return Err("token not issued for CnosDB".to_string());
+    }
+    if let Some(issuer) = &config.issuer {
+        if claim("iss") != Some(issuer.as_str()) {
+            return Err("token not issued by the issuer".to_string());
+        }
+    }
+    let user = introspection
+        .claims
+        .get(&config.user_claim)
+        .and_then(Value::as_str)
+        .filter(|user| !user.is_empty())
+        .ok_or_else(|| format!("claim {} not found", config.user_claim))?
+        .to_string();
+    // an array of the groups, or the groups separated by whitespaces
+    let groups = match introspection.claims.get(&config.groups_claim) {
+        Some(Value::Array(groups)) => groups
+            .iter()
+            .filter_map(Value::as_str)
+            .map(str::to_string)
+            .collect(),
+        Some(Value::String(groups)) => groups.split_whitespace().map(str::to_string).collect(),
+        _ => vec![],
+    };
+
+    Ok(ExternalIdentity { user, groups })
+}
+
+#[cfg(test)]
+mod test {
+    use config::tskv::OidcConfig;
+
+    use super::{to_identity, Introspection};
+
+    #[test]
+    fn test_to_identity() {
+        let config: OidcConfig = serde_json::from_str(
+            r#"{"introspection_url": "http://idp", "client_id": "cnosdb", "client_secret": "secret"}"#,
+        )
+        .unwrap();
+
+        let introspection: Introspection = serde_json::from_str(
+            r#"{"active": true, "aud": "cnosdb", "preferred_username": "alice", "groups": ["dba", "dev"]}"#,
+        )
+        .unwrap();
+        let identity = to_identity(&config, introspection).unwrap();
+        assert_eq!(identity.user, "alice");
+        assert_eq!(identity.groups, vec!["dba".to_string(), "dev".to_string()]);
+
+        let introspection: Introspection = serde_json::from_str(
+            r#"{"active": true, "client_id": "cnosdb", "preferred_username": "alice", "groups": "dba dev"}"#,
+        )
+        .unwrap();
+        let identity = to_identity(&config, introspection).unwrap();
+        assert_eq!(identity.groups, vec!["dba".to_string(), "dev".to_string()]);
+
+        let introspection: Introspection = serde_json::from_str(r#"{"active": false}"#).unwrap();
+        assert!(to_identity(&config, introspection).is_err());
+
+        let introspection: Introspection =
+            serde_json::from_str(r#"{"active": true, "aud": "cnosdb", "sub": "123"}"#).unwrap();
+        assert!(to_identity(&config, introspection).is_err());
+    }
+
+    #[test]
+    fn test_to_identity_audience_and_issuer() {
+        let config: OidcConfig = serde_json::from_str(
+            r#"{"introspection_url": "http://idp", "client_id": "cnosdb", "client_secret": "secret",
+                "audience": "tsdb", "issuer": "http://idp"}"#,
+        )
+        .unwrap();
+        let identity = |claims: &str| {
+            let introspection: Introspection = serde_json::from_str(&format!(
+                r#"{{"active": true, "preferred_username": "alice", {}}}"#,
+                claims
+            ))
+            .unwrap();
+            to_identity(&config, introspection)
+        };
+
+        assert!(identity(r#""aud": ["web", "tsdb"], "iss": "http://idp""#).is_ok());
+        assert!(identity(r#""client_id": "cnosdb", "iss": "http://idp""#).is_ok());
+        // issued for another client of the provider
+        assert!(identity(r#""aud": "web", "client_id": "web", "iss": "http://idp""#).is_err());
+        assert!(identity(r#""iss": "http://idp""#).is_err());
+        // issued by another issuer
+        assert!(identity(r#""aud": "tsdb", "iss": "http://other""#).is_err());
+        assert!(identity(r#""aud": "tsdb""#).is_err());
+    }
+}
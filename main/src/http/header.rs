@@ -1,6 +1,9 @@
 use base64::prelude::{Engine, BASE64_STANDARD};
-use http_protocol::header::{APPLICATION_CSV, BASIC_PREFIX};
+use http_protocol::header::{APPLICATION_CSV, BASIC_PREFIX, BEARER_PREFIX};
+use models::auth::session::SessionToken;
 use models::auth::user::UserInfo;
+use models::utils::now_timestamp_millis;
+use spi::QueryError;
 use warp::http::header::{HeaderName, HeaderValue};
 
 use super::Error as HttpError;
@@ -15,6 +18,12 @@ pub struct Header {
     tenant: Option<String>,
     db: Option<String>,
     table: Option<String>,
+    unbounded_time_range: Option<bool>,
+    write_token: Option<String>,
+    series_cursor: Option<String>,
+    max_points: Option<u64>,
+    align_series: Option<bool>,
+    async_job: Option<bool>,
 }
 
 impl Header {
@@ -33,6 +42,12 @@ impl Header {
             tenant: None,
             db: None,
             table: None,
+            unbounded_time_range: None,
+            write_token: None,
+            series_cursor: None,
+            max_points: None,
+            align_series: None,
+            async_job: None,
         }
     }
 
@@ -55,9 +70,45 @@ impl Header {
             tenant,
             db,
             table,
+            unbounded_time_range: None,
+            write_token: None,
+            series_cursor: None,
+            max_points: None,
+            align_series: None,
+            async_job: None,
         }
     }
 
+    pub fn with_unbounded_time_range(mut self, unbounded_time_range: Option<bool>) -> Self {
+        self.unbounded_time_range = unbounded_time_range;
+        self
+    }
+
+    pub fn with_write_token(mut self, write_token: Option<String>) -> Self {
+        self.write_token = write_token;
+        self
+    }
+
+    pub fn with_series_cursor(mut self, series_cursor: Option<String>) -> Self {
+        self.series_cursor = series_cursor;
+        self
+    }
+
+    pub fn with_max_points(mut self, max_points: Option<u64>) -> Self {
+        self.max_points = max_points;
+        self
+    }
+
+    pub fn with_align_series(mut self, align_series: Option<bool>) -> Self {
+        self.align_series = align_series;
+        self
+    }
+
+    pub fn with_async_job(mut self, async_job: Option<bool>) -> Self {
+        self.async_job = async_job;
+        self
+    }
+
     pub fn get_accept(&self) -> &str {
         self.accept.as_deref().unwrap_or(APPLICATION_CSV)
     }
@@ -82,6 +133,34 @@ impl Header {
         self.table.clone()
     }
 
+    pub fn get_unbounded_time_range(&self) -> Option<bool> {
+        self.unbounded_time_range
+    }
+
+    pub fn get_write_token(&self) -> Option<&str> {
+        self.write_token.as_deref()
+    }
+
+    pub fn get_series_cursor(&self) -> Option<&str> {
+        self.series_cursor.as_deref()
+    }
+
+    pub fn get_max_points(&self) -> Option<u64> {
+        self.max_points
+    }
+
+    pub fn get_align_series(&self) -> Option<bool> {
+        self.align_series
+    }
+
+    pub fn get_async_job(&self) -> Option<bool> {
+        self.async_job
+    }
+
+    pub fn get_authorization(&self) -> &str {
+        &self.authorization
+    }
+
     pub fn try_get_basic_auth(&self) -> Result<UserInfo, HttpError> {
         let private_key = self
             .private_key
@@ -100,6 +179,10 @@ impl Header {
 
         let auth = &self.authorization;
 
+        if let Some(token) = auth.strip_prefix(BEARER_PREFIX) {
+            return session_user_info(token);
+        }
+
         let get_err = || {
             Err(HttpError::ParseAuth {
                 reason: auth.to_string(),
@@ -125,6 +208,7 @@ impl Header {
                         user: str[0..idx].to_string(),
                         password: str[idx + 1..].to_string(),
                         private_key,
+                        session_token: None,
                     });
                 }
             }
@@ -134,6 +218,26 @@ impl Header {
     }
 }
 
+/// The session is verified when the user is authenticated, the expiration is
+/// checked here as the authenticated users are cached.
+fn session_user_info(token: &str) -> Result<UserInfo, HttpError> {
+    let session = SessionToken::decode(token).map_err(|source| HttpError::Query {
+        source: QueryError::Auth { source },
+    })?;
+    if session.expires_at <= now_timestamp_millis() {
+        return Err(HttpError::InvalidHeader {
+            reason: "session expired".to_string(),
+        });
+    }
+
+    Ok(UserInfo {
+        user: session.user,
+        password: String::new(),
+        private_key: None,
+        session_token: Some(token.to_string()),
+    })
+}
+
 pub trait IntoHeaderValue: Sized {
     fn into_value(self) -> HeaderValue;
 }
@@ -173,7 +277,10 @@ impl IntoHeaderValue for HeaderValue {
 
 #[cfg(test)]
 mod tests {
+    use std::time::Duration;
+
     use base64::prelude::{Engine, BASE64_STANDARD};
+    use models::auth::user::UserOptionsBuilder;
 
     use super::*;
 
@@ -224,4 +331,35 @@ mod tests {
         let header = Header::with(None, None, None, auth);
         assert!(header.try_get_basic_auth().is_err());
     }
+
+    #[test]
+    fn test_header_session_auth() {
+        let options = UserOptionsBuilder::default()
+            .hash_password("hash")
+            .build()
+            .unwrap();
+        let token = SessionToken::new(
+            "xx",
+            &options,
+            now_timestamp_millis(),
+            Duration::from_secs(60),
+        )
+        .unwrap()
+        .sign("secret")
+        .unwrap();
+        let header = Header::with(None, None, None, format!("{}{}", BEARER_PREFIX, token));
+        let user_info = header.try_get_basic_auth().unwrap();
+        assert_eq!(&user_info.user, "xx");
+        assert_eq!(user_info.session_token.as_deref(), Some(token.as_str()));
+
+        let expired = SessionToken::new("xx", &options, 0, Duration::from_secs(60))
+            .unwrap()
+            .sign("secret")
+            .unwrap();
+        let header = Header::with(None, None, None, format!("{}{}", BEARER_PREFIX, expired));
+        assert!(header.try_get_basic_auth().is_err());
+
+        let header = Header::with(None, None, None, format!("{}xx", BEARER_PREFIX));
+        assert!(header.try_get_basic_auth().is_err());
+    }
 }
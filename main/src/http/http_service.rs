@@ -1,5 +1,6 @@
 #![allow(clippy::too_many_arguments)]
 
+use std::borrow::Cow;
 use std::collections::{HashMap, HashSet};
 use std::convert::Infallible;
 use std::fmt;
@@ -7,21 +8,28 @@ use std::fmt::Display;
 use std::mem::size_of_val;
 use std::net::SocketAddr;
 use std::sync::Arc;
-use std::time::Instant;
+use std::time::{Duration, Instant};
 
 use config::tskv::TLSConfig;
+use config::{GIT_HASH, PKG_VERSION};
+use coordinator::backup::check_backup_name;
+use coordinator::change_feed::ChangeFeedError;
 use coordinator::service::CoordinatorRef;
 use datafusion::arrow::array::{Array, StringArray};
-use futures::TryStreamExt;
+use futures::{StreamExt, TryStreamExt};
 use http_protocol::encoding::Encoding;
 use http_protocol::header::{
-    ACCEPT, APPLICATION_JSON, AUTHORIZATION, DB, PRIVATE_KEY, TABLE, TENANT,
+    ACCEPT, ALIGN_SERIES, APPLICATION_JSON, APPLICATION_PROM_STREAMED, ASYNC_JOB, AUTHORIZATION,
+    BEARER_PREFIX, CNOSDB_BUILD, CNOSDB_VERSION, DB, INFLUXDB_BUILD, INFLUXDB_VERSION, MAX_POINTS,
+    PRIVATE_KEY, SERIES_CURSOR, SESSION_COOKIE, TABLE, TENANT, TEXT_PLAIN, UNBOUNDED_TIME_RANGE,
+    WRITE_TOKEN,
 };
 use http_protocol::parameter::{
-    DebugParam, DumpParam, FindTracesParam, GetOperationParam, LogParam, SqlParam, WriteParam,
+    AnnotationParam, BackupParam, ChangesParam, DebugParam, DumpParam, ExportParam,
+    FindTracesParam, GetOperationParam, LogLevelParam, LogParam, SqlParam, WriteParam,
 };
 use http_protocol::response::ErrorResponse;
-use http_protocol::status_code::OK;
+use http_protocol::status_code::{NO_CONTENT, OK};
 use meta::error::{MetaError, MetaResult};
 use meta::limiter::RequestLimiter;
 use meta::model::MetaRef;
@@ -29,33 +37,43 @@ use metrics::count::U64Counter;
 use metrics::metric_register::MetricsRegister;
 use metrics::prom_reporter::PromReporter;
 use models::auth::privilege::{DatabasePrivilege, Privilege, TenantObjectPrivilege};
+use models::auth::session::SessionToken;
+use models::auth::user::{User, UserOptionsBuilder};
+use models::consistency_level::WriteToken;
 use models::error_code::UnknownCodeWithMessage;
 use models::oid::{Identifier, Oid};
-use models::schema::{DEFAULT_CATALOG, DEFAULT_DATABASE};
-use models::utils::now_timestamp_nanos;
+use models::predicate::series_cursor::SeriesCursor;
+use models::schema::{DEFAULT_CATALOG, DEFAULT_DATABASE, POINT_TTL_TAG};
+use models::utils::{now_timestamp_millis, now_timestamp_nanos};
 use protocol_parser::json_protocol::parser::{
     parse_json_to_eslog, parse_json_to_lokilog, parse_json_to_ndjsonlog, parse_protobuf_to_lokilog,
     parse_protobuf_to_otlptrace, parse_to_line, JsonProtocol,
 };
 use protocol_parser::json_protocol::JsonType;
-use protocol_parser::line_protocol::line_protocol_to_lines;
+use protocol_parser::json_write::json_points_to_lines;
+use protocol_parser::line_protocol::batch_to_line_protocol;
+use protocol_parser::line_protocol::parser::{NonFiniteFloat, Parser as LineProtocolParser};
 use protocol_parser::open_tsdb::open_tsdb_to_lines;
 use protocol_parser::{DataPoint, Line};
+use query::prom::promql::{self, MAX_POINTS_PER_SERIES};
 use query::prom::remote_server::PromRemoteSqlServer;
-use reqwest::header::{HeaderName, HeaderValue, ACCEPT_ENCODING, CONTENT_ENCODING, CONTENT_TYPE};
+use reqwest::header::{
+    HeaderName, HeaderValue, ACCEPT_ENCODING, CONTENT_ENCODING, CONTENT_TYPE, SET_COOKIE,
+};
 use snafu::{IntoError, ResultExt};
 use spi::query::config::StreamTriggerInterval;
 use spi::server::dbms::DBMSRef;
-use spi::server::prom::PromRemoteServerRef;
+use spi::server::prom::{PromQLQuery, PromReadResponse, PromRemoteServerRef};
 use spi::service::protocol::{Context, ContextBuilder, Query};
 use spi::QueryError;
 use tokio::sync::oneshot;
+use trace::global_logging::{log_levels, set_log_levels, LogLevels};
 use trace::http::http_ctx::{HeaderDecodeSnafu, DEFAULT_TRACE_HEADER_NAME};
 use trace::span_ctx_ext::SpanContextExt;
 use trace::span_ext::SpanExt;
 use trace::{debug, error, info, Span, SpanContext};
-use utils::backtrace;
-use utils::precision::Precision;
+use utils::precision::{timestamp_convert, Precision};
+use utils::{backtrace, BkdrHasher};
 use warp::hyper::body::Bytes;
 use warp::hyper::Body;
 use warp::reject::{MethodNotAllowed, MissingHeader, PayloadTooLarge};
@@ -63,9 +81,19 @@ use warp::reply::Response;
 use warp::{header, reject, Filter, Rejection, Reply};
 
 use super::header::Header;
-use super::{ContextSnafu, CoordinatorSnafu, DecodeRequestSnafu, Error as HttpError, MetaSnafu};
+use super::{
+    external_auth, ChangeFeedSnafu, ContextSnafu, CoordinatorSnafu, DecodeRequestSnafu,
+    Error as HttpError, MetaSnafu, PartialWriteResponse, PromQLRejection, PromQLResponse,
+    WriteRejection,
+};
+use crate::http::annotation::{
+    annotations_sql, batch_to_annotations, parse_tag_filter, Annotation, ANNOTATIONS_TABLE,
+};
 use crate::http::api_type::{metrics_record_db, HttpApiType};
+use crate::http::backup_job::BackupJobs;
+use crate::http::delete_job::DeleteJobs;
 use crate::http::encoding::{get_accept_encoding_from_header, get_content_encoding_from_header};
+use crate::http::export::export_sql;
 use crate::http::metrics::HttpMetrics;
 use crate::http::response::{HttpResponse, ResponseBuilder};
 use crate::http::result_format::{get_result_format_from_header, ResultFormat};
@@ -80,6 +108,8 @@ use crate::server::ServiceHandle;
 use crate::spi::service::Service;
 use crate::{server, VERSION};
 
+const WEB_UI_INDEX: &str = include_str!("web_ui/index.html");
+
 pub enum ServerMode {
     Store,
     Query,
@@ -115,6 +145,8 @@ pub struct HttpService {
     metrics_register: Arc<MetricsRegister>,
     http_metrics: Arc<HttpMetrics>,
     auto_generate_span: bool,
+    delete_jobs: Arc<DeleteJobs>,
+    backup_jobs: Arc<BackupJobs>,
 }
 
 impl HttpService {
@@ -146,6 +178,8 @@ impl HttpService {
             metrics_register,
             http_metrics,
             auto_generate_span,
+            delete_jobs: Arc::new(DeleteJobs::default()),
+            backup_jobs: Arc::new(BackupJobs::default()),
         }
     }
 
@@ -158,11 +192,22 @@ impl HttpService {
         header::optional::<String>(ACCEPT.as_str())
             .and(header::optional::<String>(ACCEPT_ENCODING.as_str()))
             .and(header::optional::<String>(CONTENT_ENCODING.as_str()))
-            .and(header::<String>(AUTHORIZATION.as_str()))
+            .and(
+                header::<String>(AUTHORIZATION.as_str())
+                    .or(warp::cookie::cookie::<String>(SESSION_COOKIE)
+                        .map(|token: String| format!("{}{}", BEARER_PREFIX, token)))
+                    .unify(),
+            )
             .and(header::optional::<String>(PRIVATE_KEY))
             .and(header::optional::<String>(TENANT))
             .and(header::optional::<String>(DB))
             .and(header::optional::<String>(TABLE))
+            .and(header::optional::<bool>(UNBOUNDED_TIME_RANGE))
+            .and(header::optional::<String>(WRITE_TOKEN))
+            .and(header::optional::<String>(SERIES_CURSOR))
+            .and(header::optional::<u64>(MAX_POINTS))
+            .and(header::optional::<bool>(ALIGN_SERIES))
+            .and(header::optional::<bool>(ASYNC_JOB))
             .and_then(
                 |accept,
                  accept_encoding,
@@ -171,7 +216,13 @@ impl HttpService {
                  private_key,
                  tenant,
                  db,
-                 table| async move {
+                 table,
+                 unbounded_time_range,
+                 write_token,
+                 series_cursor,
+                 max_points,
+                 align_series,
+                 async_job| async move {
                     let res: Result<Header, warp::Rejection> = Ok(Header::with_private_key(
                         accept,
                         accept_encoding,
@@ -181,7 +232,13 @@ impl HttpService {
                         tenant,
                         db,
                         table,
-                    ));
+                    )
+                    .with_unbounded_time_range(unbounded_time_range)
+                    .with_write_token(write_token)
+                    .with_series_cursor(series_cursor)
+                    .with_max_points(max_points)
+                    .with_align_series(align_series)
+                    .with_async_job(async_job));
                     res
                 },
             )
@@ -226,6 +283,20 @@ impl HttpService {
         let coord = self.coord.clone();
         warp::any().map(move || coord.clone())
     }
+    fn with_delete_jobs(
+        &self,
+    ) -> impl Filter<Extract = (Arc<DeleteJobs>,), Error = Infallible> + Clone {
+        let delete_jobs = self.delete_jobs.clone();
+        warp::any().map(move || delete_jobs.clone())
+    }
+
+    fn with_backup_jobs(
+        &self,
+    ) -> impl Filter<Extract = (Arc<BackupJobs>,), Error = Infallible> + Clone {
+        let backup_jobs = self.backup_jobs.clone();
+        warp::any().map(move || backup_jobs.clone())
+    }
+
     fn with_prom_remote_server(
         &self,
     ) -> impl Filter<Extract = (PromRemoteServerRef,), Error = Infallible> + Clone {
@@ -256,14 +327,32 @@ impl HttpService {
         &self,
     ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
         self.ping()
+            .or(self.influxdb_ping())
+            .or(self.influxdb_buckets())
             .or(self.query())
+            .or(self.export())
+            .or(self.changes())
+            .or(self.create_annotation())
+            .or(self.list_annotations())
+            .or(self.start_delete_job())
+            .or(self.delete_job_status())
+            .or(self.cancel_delete_job())
+            .or(self.backup())
+            .or(self.backup_status())
+            .or(self.login())
+            .or(self.logout())
+            .or(self.web_ui())
             .or(self.mock_influxdb_write())
             .or(self.metrics())
+            .or(self.metrics_rates())
+            .or(self.log_level())
             .or(self.print_meta())
             .or(self.meta_leader_addr())
             .or(self.debug_pprof())
             .or(self.debug_jeprof())
             .or(self.prom_remote_read())
+            .or(self.prom_query())
+            .or(self.prom_metadata())
             .or(self.backtrace())
             .or(self.print_raft())
             .or(self.dump_ddl_sql())
@@ -292,6 +381,8 @@ impl HttpService {
     ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
         self.ping()
             .or(self.metrics())
+            .or(self.metrics_rates())
+            .or(self.log_level())
             .or(self.print_meta())
             .or(self.meta_leader_addr())
             .or(self.debug_pprof())
@@ -322,10 +413,148 @@ impl HttpService {
                     start,
                     HttpApiType::ApiV1Ping,
                 );
-                warp::reply::json(&resp)
+                with_version_headers(ResponseBuilder::new(OK)).json(&resp)
             })
     }
 
+    /// The page of the web UI, it works with the session issued by `/api/v1/login`
+    /// and the sql api.
+    fn web_ui(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        let enabled = self.coord.get_config().service.enable_web_ui;
+        warp::path!("ui")
+            .and(warp::get())
+            .and_then(move || async move {
+                if !enabled {
+                    return Err(reject::not_found());
+                }
+                Ok::<_, Rejection>(warp::reply::html(WEB_UI_INDEX))
+            })
+    }
+
+    /// `/ping` of InfluxDB, for Telegraf and the tools of InfluxDB checking
+    /// the server. Responds no content unless `verbose` is true.
+    fn influxdb_ping(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("ping")
+            .and(warp::get().or(warp::head()))
+            .and(warp::query::<HashMap<String, String>>())
+            .and(self.with_http_metrics())
+            .and(self.with_hostaddr())
+            .map(
+                |_, query: HashMap<String, String>, metrics: Arc<HttpMetrics>, addr: String| {
+                    let start = Instant::now();
+                    let verbose = query
+                        .get("verbose")
+                        .map_or(false, |v| v.parse::<bool>().unwrap_or(false));
+                    let resp = if verbose {
+                        let mut body = HashMap::new();
+                        body.insert("version", PKG_VERSION);
+                        with_version_headers(ResponseBuilder::new(OK)).json(&body)
+                    } else {
+                        with_version_headers(ResponseBuilder::new(NO_CONTENT)).build(vec![])
+                    };
+                    http_response_time_and_flow_metrics(
+                        &metrics,
+                        &addr,
+                        size_of_val(&resp),
+                        start,
+                        HttpApiType::Ping,
+                    );
+                    resp
+                },
+            )
+    }
+
+    /// `/api/v2/buckets` of InfluxDB, the databases the user can read as the
+    /// buckets `<db>/autogen` of the organization, which is the tenant.
+    fn influxdb_buckets(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v2" / "buckets")
+            .and(warp::get())
+            .and(warp::query::<HashMap<String, String>>())
+            .and(self.handle_header())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_hostaddr())
+            .and_then(
+                |query: HashMap<String, String>,
+                 header: Header,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 metrics: Arc<HttpMetrics>,
+                 addr: String| async move {
+                    let start = Instant::now();
+                    let param = SqlParam {
+                        tenant: query.get("org").cloned(),
+                        db: None,
+                        chunked: None,
+                        target_partitions: None,
+                        stream_trigger_interval: None,
+                    };
+                    let ctx = construct_read_context(&header, param, dbms, coord.clone(), false)
+                        .await
+                        .map_err(|e| {
+                            error!("Failed to construct read context, err: {:?}", e);
+                            reject::custom(e)
+                        })?;
+                    let meta = coord
+                        .meta_manager()
+                        .tenant_meta(ctx.tenant())
+                        .await
+                        .ok_or_else(|| {
+                            reject::custom(HttpError::NotFoundTenant {
+                                name: ctx.tenant().to_string(),
+                            })
+                        })?;
+                    let databases = meta
+                        .list_databases()
+                        .context(MetaSnafu)
+                        .map_err(reject::custom)?;
+
+                    let tenant_id = *meta.tenant().id();
+                    let name = query.get("name").map(|n| bucket_database(n.as_str()));
+                    let mut buckets = databases
+                        .values()
+                        .map(|db| &db.schema)
+                        .filter(|schema| !schema.is_hidden())
+                        .filter(|schema| name.map_or(true, |n| n == schema.database_name()))
+                        .filter(|schema| {
+                            ctx.user()
+                                .can_read_database(tenant_id, schema.database_name())
+                        })
+                        .map(|schema| {
+                            InfluxDBBucket::new(
+                                tenant_id,
+                                schema.database_name(),
+                                schema.options().ttl().to_millisecond(),
+                            )
+                        })
+                        .collect::<Vec<_>>();
+                    buckets.sort_by(|a, b| a.name.cmp(&b.name));
+
+                    let resp = ResponseBuilder::new(OK).json(&InfluxDBBuckets {
+                        links: InfluxDBLinks {
+                            this: "/api/v2/buckets".to_string(),
+                        },
+                        buckets,
+                    });
+                    http_response_time_and_flow_metrics(
+                        &metrics,
+                        &addr,
+                        size_of_val(&resp),
+                        start,
+                        HttpApiType::ApiV2Buckets,
+                    );
+                    Ok::<_, warp::Rejection>(resp)
+                },
+            )
+    }
+
     fn backtrace(
         &self,
     ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
@@ -465,15 +694,702 @@ impl HttpService {
                         Err(error) => size_of_val(error),
                     };
 
-                    let total_size = result_size + value_size + req_len;
-                    http_response_time_and_flow_metrics(
-                        &metrics,
-                        &addr,
-                        total_size,
-                        start,
-                        HttpApiType::ApiV1Sql,
-                    );
-                    result
+                    let total_size = result_size + value_size + req_len;
+                    http_response_time_and_flow_metrics(
+                        &metrics,
+                        &addr,
+                        total_size,
+                        start,
+                        HttpApiType::ApiV1Sql,
+                    );
+                    result
+                },
+            )
+    }
+
+    /// Streams the rows of a table, or of all the tables in the database, as
+    /// gzipped line protocol, so that the bulk data can be extracted without
+    /// paging through the query api.
+    fn export(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "export")
+            .and(warp::get())
+            .and(self.handle_header())
+            .and(warp::query::<ExportParam>())
+            .and(self.with_dbms())
+            .and(self.with_meta())
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_hostaddr())
+            .and_then(
+                |header: Header,
+                 param: ExportParam,
+                 dbms: DBMSRef,
+                 meta: MetaRef,
+                 coord: CoordinatorRef,
+                 metrics: Arc<HttpMetrics>,
+                 addr: String| async move {
+                    let start = Instant::now();
+                    debug!(
+                        "Receive http export request, header: {:?}, param: {:?}",
+                        header, param
+                    );
+                    let sql_param = SqlParam {
+                        tenant: param.tenant,
+                        db: param.db,
+                        chunked: Some(true),
+                        target_partitions: None,
+                        stream_trigger_interval: None,
+                    };
+                    let ctx =
+                        construct_read_context(&header, sql_param, dbms.clone(), coord, false)
+                            .await
+                            .map_err(|e| {
+                                error!("Failed to construct export context, err: {:?}", e);
+                                reject::custom(e)
+                            })?;
+                    let limiter = meta.limiter(ctx.tenant()).await.context(MetaSnafu)?;
+                    let http_data_out = metrics.http_data_out(
+                        ctx.tenant(),
+                        ctx.user().desc().name(),
+                        Some(ctx.database()),
+                        &addr,
+                        HttpApiType::ApiV1Export,
+                    );
+
+                    let result = export_handle(
+                        ctx.clone(),
+                        param.table,
+                        (param.start, param.end),
+                        dbms,
+                        meta,
+                        limiter,
+                        http_data_out,
+                    )
+                    .await
+                    .map_err(|e| {
+                        error!("Failed to handle http export request, err: {:?}", e);
+                        reject::custom(e)
+                    });
+
+                    http_record_query_metrics(
+                        &metrics,
+                        &ctx,
+                        &addr,
+                        0,
+                        start,
+                        HttpApiType::ApiV1Export,
+                    );
+                    result
+                },
+            )
+    }
+
+    /// Reads the writes of a database logged after a checkpoint, see
+    /// [`coordinator::change_feed`]. Waits for new writes at most `wait`
+    /// seconds if there is none, so that a consumer can tail the database.
+    fn changes(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "changes")
+            .and(warp::get())
+            .and(self.handle_header())
+            .and(warp::query::<ChangesParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_hostaddr())
+            .and_then(
+                |header: Header,
+                 param: ChangesParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 metrics: Arc<HttpMetrics>,
+                 addr: String| async move {
+                    let start = Instant::now();
+                    debug!(
+                        "Receive http changes request, header: {:?}, param: {:?}",
+                        header, param
+                    );
+                    let sql_param = SqlParam {
+                        tenant: param.tenant,
+                        db: param.db,
+                        chunked: None,
+                        target_partitions: None,
+                        stream_trigger_interval: None,
+                    };
+                    let ctx =
+                        construct_read_context(&header, sql_param, dbms, coord.clone(), false)
+                            .await
+                            .map_err(|e| {
+                                error!("Failed to construct changes context, err: {:?}", e);
+                                reject::custom(e)
+                            })?;
+
+                    let result = changes_handle(
+                        &ctx,
+                        &coord,
+                        param.checkpoint.as_deref(),
+                        param.limit,
+                        param.wait,
+                    )
+                    .await
+                    .map_err(|e| {
+                        error!("Failed to handle http changes request, err: {:?}", e);
+                        reject::custom(e)
+                    });
+
+                    http_record_query_metrics(
+                        &metrics,
+                        &ctx,
+                        &addr,
+                        0,
+                        start,
+                        HttpApiType::ApiV1Changes,
+                    );
+                    result
+                },
+            )
+    }
+
+    /// Writes an annotation to the table [`ANNOTATIONS_TABLE`] of the database.
+    fn create_annotation(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "annotations")
+            .and(warp::post())
+            .and(warp::body::content_length_limit(self.write_body_limit))
+            .and(warp::body::bytes())
+            .and(self.handle_header())
+            .and(warp::query::<AnnotationParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_hostaddr())
+            .and_then(
+                |req: Bytes,
+                 header: Header,
+                 param: AnnotationParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 metrics: Arc<HttpMetrics>,
+                 addr: String| async move {
+                    let start = Instant::now();
+                    debug!(
+                        "Receive http create annotation request, header: {:?}, param: {:?}",
+                        header, param
+                    );
+                    let write_param = WriteParam {
+                        precision: Some("ms".to_string()),
+                        tenant: param.tenant,
+                        db: param.db,
+                        partial_write: None,
+                        non_finite_float: None,
+                        unicode_escape: None,
+                        format: None,
+                        field_label: None,
+                        ttl: None,
+                    };
+                    let ctx = construct_write_context_and_check_privilege(
+                        header,
+                        write_param,
+                        dbms,
+                        coord.clone(),
+                    )
+                    .await
+                    .map_err(|e| {
+                        error!("Failed to construct write context, err: {:?}", e);
+                        reject::custom(e)
+                    })?;
+
+                    let annotation = serde_json::from_slice::<Annotation>(&req)
+                        .map_err(|e| e.to_string())
+                        .and_then(|annotation| annotation.validate().map(|_| annotation))
+                        .map_err(|reason| {
+                            reject::custom(HttpError::InvalidAnnotation { reason })
+                        })?;
+                    let result = coord_write_points_with_span_recorder(
+                        &coord,
+                        ctx.tenant(),
+                        ctx.database(),
+                        Precision::MS,
+                        vec![annotation.to_line()],
+                        None,
+                    )
+                    .await
+                    .map(|_| ResponseBuilder::ok())
+                    .map_err(|e| {
+                        error!(
+                            "Failed to handle http create annotation request, err: {:?}",
+                            e
+                        );
+                        reject::custom(e)
+                    });
+
+                    http_record_write_metrics(
+                        &metrics,
+                        &ctx,
+                        &addr,
+                        req.len(),
+                        start,
+                        HttpApiType::ApiV1Annotations,
+                    );
+                    result
+                },
+            )
+    }
+
+    /// Lists the annotations in the time range `[start, end)` in
+    /// milliseconds, having all the tags of the parameter `tags`.
+    fn list_annotations(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "annotations")
+            .and(warp::get())
+            .and(self.handle_header())
+            .and(warp::query::<AnnotationParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_hostaddr())
+            .and_then(
+                |header: Header,
+                 param: AnnotationParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 metrics: Arc<HttpMetrics>,
+                 addr: String| async move {
+                    let start = Instant::now();
+                    debug!(
+                        "Receive http list annotations request, header: {:?}, param: {:?}",
+                        header, param
+                    );
+                    let sql_param = SqlParam {
+                        tenant: param.tenant,
+                        db: param.db,
+                        chunked: None,
+                        target_partitions: None,
+                        stream_trigger_interval: None,
+                    };
+                    let ctx = construct_read_context(
+                        &header,
+                        sql_param,
+                        dbms.clone(),
+                        coord.clone(),
+                        false,
+                    )
+                    .await
+                    .map_err(|e| {
+                        error!("Failed to construct annotations context, err: {:?}", e);
+                        reject::custom(e)
+                    })?;
+
+                    let result = annotations_handle(
+                        &ctx,
+                        (param.start, param.end),
+                        param.tags.as_deref(),
+                        &dbms,
+                        &coord,
+                    )
+                    .await
+                    .map_err(|e| {
+                        error!(
+                            "Failed to handle http list annotations request, err: {:?}",
+                            e
+                        );
+                        reject::custom(e)
+                    });
+
+                    http_record_query_metrics(
+                        &metrics,
+                        &ctx,
+                        &addr,
+                        0,
+                        start,
+                        HttpApiType::ApiV1Annotations,
+                    );
+                    result
+                },
+            )
+    }
+
+    /// Runs a DELETE statement in the background, returns the id of the job.
+    fn start_delete_job(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "delete")
+            .and(warp::post())
+            .and(warp::body::content_length_limit(self.query_body_limit))
+            .and(warp::body::bytes())
+            .and(self.handle_header())
+            .and(warp::query::<SqlParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_delete_jobs())
+            .and_then(
+                |req: Bytes,
+                 header: Header,
+                 param: SqlParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 delete_jobs: Arc<DeleteJobs>| async move {
+                    let query = construct_query(req, &header, param, dbms.clone(), coord)
+                        .await
+                        .map_err(|e| {
+                            error!("Failed to construct query, err: {:?}", e);
+                            reject::custom(e)
+                        })?;
+                    if !is_delete_statement(query.content()) {
+                        return Err(reject::custom(HttpError::InvalidDeleteJob {
+                            reason: "only DELETE statement can be run as a job".to_string(),
+                        }));
+                    }
+
+                    let tenant = query.context().tenant().to_string();
+                    let user = query.context().user().desc().name().to_string();
+                    let sql = query.content().to_string();
+                    let job_id = delete_jobs.start(&tenant, &user, &sql, async move {
+                        dbms.execute(&query, None)
+                            .await
+                            .map(|_| ())
+                            .map_err(|e| e.to_string())
+                    });
+                    info!("Start delete job {}: {}", job_id, sql);
+
+                    let mut resp = HashMap::new();
+                    resp.insert("job_id", job_id);
+                    Ok(ResponseBuilder::new(OK).json(&resp))
+                },
+            )
+    }
+
+    fn delete_job_status(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "delete" / u64)
+            .and(warp::get())
+            .and(self.handle_header())
+            .and(warp::query::<SqlParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_delete_jobs())
+            .and_then(
+                |job_id: u64,
+                 header: Header,
+                 param: SqlParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 delete_jobs: Arc<DeleteJobs>| async move {
+                    let ctx = construct_read_context(&header, param, dbms, coord, true)
+                        .await
+                        .map_err(reject::custom)?;
+                    let status = delete_jobs.status(job_id, ctx.tenant(), ctx.user().desc().name());
+                    Ok::<_, Rejection>(match status {
+                        Some(status) => ResponseBuilder::new(OK).json(&status),
+                        None => ResponseBuilder::not_found(),
+                    })
+                },
+            )
+    }
+
+    /// Stops waiting for a delete job, the vnodes which have received the
+    /// deletion still finish it.
+    fn cancel_delete_job(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "delete" / u64)
+            .and(warp::delete())
+            .and(self.handle_header())
+            .and(warp::query::<SqlParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_delete_jobs())
+            .and_then(
+                |job_id: u64,
+                 header: Header,
+                 param: SqlParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 delete_jobs: Arc<DeleteJobs>| async move {
+                    let ctx = construct_read_context(&header, param, dbms, coord, true)
+                        .await
+                        .map_err(reject::custom)?;
+                    let status = delete_jobs.cancel(job_id, ctx.tenant(), ctx.user().desc().name());
+                    Ok::<_, Rejection>(match status {
+                        Some(status) => ResponseBuilder::new(OK).json(&status),
+                        None => ResponseBuilder::not_found(),
+                    })
+                },
+            )
+    }
+
+    /// Backs up the databases of the tenant into a directory under the backup
+    /// path of this node in the background, see [`coordinator::backup`],
+    /// returns the name of the backup to poll.
+    fn backup(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "backup")
+            .and(warp::post())
+            .and(self.handle_header())
+            .and(warp::query::<BackupParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_backup_jobs())
+            .and_then(
+                |header: Header,
+                 param: BackupParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 backup_jobs: Arc<BackupJobs>| async move {
+                    let sql_param = SqlParam {
+                        tenant: param.tenant,
+                        db: None,
+                        chunked: None,
+                        target_partitions: None,
+                        stream_trigger_interval: None,
+                    };
+                    let ctx =
+                        construct_read_context(&header, sql_param, dbms, coord.clone(), false)
+                            .await
+                            .map_err(reject::custom)?;
+                    if !ctx.user().desc().is_admin() {
+                        return Err(reject::custom(HttpError::Query {
+                            source: QueryError::InsufficientPrivileges {
+                                privilege: "admin".to_string(),
+                            },
+                        }));
+                    }
+                    check_backup_name(&param.name).map_err(|e| {
+                        reject::custom(HttpError::InvalidBackupParam {
+                            reason: e.to_string(),
+                        })
+                    })?;
+                    let databases = param
+                        .db
+                        .iter()
+                        .flat_map(|db| db.split(','))
+                        .map(|db| db.trim().to_string())
+                        .filter(|db| !db.is_empty())
+                        .collect::<Vec<_>>();
+
+                    info!(
+                        "Start backup {} of tenant {}, databases: {:?}",
+                        param.name,
+                        ctx.tenant(),
+                        databases
+                    );
+                    let tenant = ctx.tenant().to_string();
+                    let name = param.name.clone();
+                    backup_jobs
+                        .start(ctx.tenant(), &param.name, async move {
+                            coord.backup(&tenant, databases, &name).await.map_err(|e| {
+                                error!("Failed to backup tenant {}, err: {:?}", tenant, e);
+                                e.to_string()
+                            })
+                        })
+                        .map_err(|reason| {
+                            reject::custom(HttpError::InvalidBackupParam { reason })
+                        })?;
+
+                    let mut resp = HashMap::new();
+                    resp.insert("name", param.name);
+                    Ok(ResponseBuilder::new(OK).json(&resp))
+                },
+            )
+    }
+
+    /// The status of a backup, with the manifest of the backup once finished.
+    fn backup_status(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "backup" / String)
+            .and(warp::get())
+            .and(self.handle_header())
+            .and(warp::query::<SqlParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and(self.with_backup_jobs())
+            .and_then(
+                |name: String,
+                 header: Header,
+                 param: SqlParam,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef,
+                 backup_jobs: Arc<BackupJobs>| async move {
+                    let ctx = construct_read_context(&header, param, dbms, coord, false)
+                        .await
+                        .map_err(reject::custom)?;
+                    if !ctx.user().desc().is_admin() {
+                        return Err(reject::custom(HttpError::Query {
+                            source: QueryError::InsufficientPrivileges {
+                                privilege: "admin".to_string(),
+                            },
+                        }));
+                    }
+                    Ok(match backup_jobs.status(&name, ctx.tenant()) {
+                        Some(status) => ResponseBuilder::new(OK).json(&status),
+                        None => ResponseBuilder::not_found(),
+                    })
+                },
+            )
+    }
+
+    /// Shows the levels of the logs, or changes them if they are put, e.g.
+    /// `{"level": "info", "modules": ["tskv::compaction=debug"]}`.
+    fn log_level(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / "log_level")
+            .and(
+                warp::get()
+                    .map(|| None)
+                    .or(warp::put()
+                        .and(warp::body::json::<LogLevelParam>())
+                        .map(Some))
+                    .unify(),
+            )
+            .and(self.handle_header())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and_then(
+                |param: Option<LogLevelParam>,
+                 header: Header,
+                 dbms: DBMSRef,
+                 coord: CoordinatorRef| async move {
+                    let sql_param = SqlParam {
+                        tenant: None,
+                        db: None,
+                        chunked: None,
+                        target_partitions: None,
+                        stream_trigger_interval: None,
+                    };
+                    let ctx = construct_read_context(&header, sql_param, dbms, coord, false)
+                        .await
+                        .map_err(reject::custom)?;
+                    if !ctx.user().desc().is_admin() {
+                        return Err(reject::custom(HttpError::Query {
+                            source: QueryError::InsufficientPrivileges {
+                                privilege: "admin".to_string(),
+                            },
+                        }));
+                    }
+
+                    if let Some(param) = param {
+                        let levels = LogLevels {
+                            level: param.level,
+                            modules: param.modules,
+                        };
+                        info!("Change the log levels to {:?}", levels);
+                        set_log_levels(levels).map_err(|reason| {
+                            reject::custom(HttpError::InvalidLogLevel { reason })
+                        })?;
+                    }
+                    let levels = log_levels().ok_or_else(|| {
+                        reject::custom(HttpError::InvalidLogLevel {
+                            reason: "logging is not initialized".to_string(),
+                        })
+                    })?;
+                    let body = serde_json::json!({
+                        "level": levels.level,
+                        "modules": levels.modules,
+                    });
+                    Ok(ResponseBuilder::new(OK).json(&body))
+                },
+            )
+    }
+
+    /// Issues a session token for the user of the basic auth, the token is
+    /// returned in the body and the cookie, and used as the bearer token.
+    fn login(&self) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        let session_ttl = self.coord.get_config().security.session_ttl;
+        let secure = self.tls_config.is_some();
+        warp::path!("api" / "v1" / "login")
+            .and(warp::post())
+            .and(self.handle_header())
+            .and(warp::query::<SqlParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and_then(
+                move |header: Header, param: SqlParam, dbms: DBMSRef, coord: CoordinatorRef| async move {
+                    if header.try_get_basic_auth()?.session_token.is_some() {
+                        return Err(reject::custom(HttpError::InvalidHeader {
+                            reason: "login requires the basic auth".to_string(),
+                        }));
+                    }
+                    let secret = coord.get_config().security.session_secret;
+                    let ctx = construct_read_context(&header, param, dbms, coord, true)
+                        .await
+                        .map_err(reject::custom)?;
+                    let user = ctx.user().desc();
+
+                    let auth_error = |source| {
+                        reject::custom(HttpError::Query {
+                            source: QueryError::Auth { source },
+                        })
+                    };
+                    let session = SessionToken::new(
+                        user.name(),
+                        user.options(),
+                        now_timestamp_millis(),
+                        session_ttl,
+                    )
+                    .map_err(auth_error)?;
+                    let token = session.sign(&secret).map_err(auth_error)?;
+                    info!("User {} logged in", user.name());
+
+                    let cookie = session_cookie(&token, session_ttl.as_secs(), secure)?;
+                    let body = serde_json::json!({"token": token, "expires_at": session.expires_at});
+                    Ok::<_, Rejection>(
+                        ResponseBuilder::new(OK)
+                            .insert_header((SET_COOKIE, cookie))
+                            .json(&body),
+                    )
+                },
+            )
+    }
+
+    /// Revokes all the sessions of the user issued before, the revocation is
+    /// stored in meta, so that it's seen by all the nodes.
+    fn logout(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        let secure = self.tls_config.is_some();
+        warp::path!("api" / "v1" / "logout")
+            .and(warp::post())
+            .and(self.handle_header())
+            .and(warp::query::<SqlParam>())
+            .and(self.with_dbms())
+            .and(self.with_coord())
+            .and_then(
+                move |header: Header, param: SqlParam, dbms: DBMSRef, coord: CoordinatorRef| async move {
+                    let ctx = construct_read_context(&header, param, dbms, coord.clone(), true)
+                        .await
+                        .map_err(reject::custom)?;
+                    let user_name = ctx.user().desc().name();
+
+                    let options = UserOptionsBuilder::default()
+                        .sessions_revoked_at(now_timestamp_millis())
+                        .build()
+                        .map_err(|e| {
+                            reject::custom(HttpError::InvalidHeader {
+                                reason: e.to_string(),
+                            })
+                        })?;
+                    coord
+                        .meta_manager()
+                        .alter_user(user_name, options)
+                        .await
+                        .context(MetaSnafu)?;
+                    info!("User {} logged out", user_name);
+
+                    let cookie = session_cookie("", 0, secure)?;
+                    Ok::<_, Rejection>(
+                        ResponseBuilder::new(OK)
+                            .insert_header((SET_COOKIE, cookie))
+                            .build(vec![]),
+                    )
                 },
             )
     }
@@ -505,13 +1421,19 @@ impl HttpService {
                     let span =
                         Span::from_context("rest line protocol write", parent_span_ctx.as_ref());
                     let span_context = span.context();
+                    let partial_write = param.partial_write.unwrap_or(false);
+                    let non_finite_float = param.non_finite_float.clone();
+                    let unicode_escape = param.unicode_escape.unwrap_or(false);
+                    let format =
+                        WriteFormat::new(param.format.as_deref()).map_err(WriteRejection)?;
+                    let ttl = param.ttl.clone();
 
                     let req_len = req.len();
                     let content_encoding = get_content_encoding_from_header(&header)?;
                     if let Some(encoding) = content_encoding {
                         req = encoding.decode(req).map_err(|e| {
                             error!("Failed to decode request, err: {:?}", e);
-                            reject::custom(HttpError::DecodeRequest { source: e })
+                            reject::custom(WriteRejection(HttpError::DecodeRequest { source: e }))
                         })?;
                     }
 
@@ -526,24 +1448,65 @@ impl HttpService {
                         .await
                         .map_err(|e| {
                             error!("Failed to construct write context, err: {:?}", e);
-                            reject::custom(e)
+                            reject::custom(WriteRejection(e))
                         })?;
                         record_context_in_span(&mut span, &ctx);
                         ctx
                     };
 
-                    http_limiter_check_write(&coord.meta_manager(), ctx.tenant(), req_len).await?;
+                    http_limiter_check_write(&coord.meta_manager(), ctx.tenant(), req_len)
+                        .await
+                        .map_err(WriteRejection)?;
 
                     let precision = Precision::new(ctx.precision()).unwrap_or(Precision::NS);
+                    let default_time = now_timestamp(precision);
+                    let parser = line_protocol_parser(
+                        default_time,
+                        non_finite_float.as_deref(),
+                        unicode_escape,
+                    )
+                    .map_err(WriteRejection)?;
 
                     let parse_start = std::time::Instant::now();
-                    let write_points_lines = {
+                    let (mut write_points_lines, partial_resp) = {
                         let mut span = Span::enter_with_parent("try parse req to lines", &span);
                         span.add_property(|| ("bytes", req.len().to_string()));
-                        try_parse_req_to_lines(&req).map_err(|e| {
-                            error!("Failed to parse request to lines, err: {:?}", e);
-                            reject::custom(e)
-                        })?
+                        if format == WriteFormat::Json {
+                            let lines =
+                                try_parse_json_req_to_lines(&req, default_time).map_err(|e| {
+                                    trace::sampled!(
+                                        error,
+                                        "unparsable http writes",
+                                        "Failed to parse request to lines, err: {:?}",
+                                        e
+                                    );
+                                    reject::custom(WriteRejection(e))
+                                })?;
+                            (lines, None)
+                        } else if partial_write {
+                            let (lines, partial_resp) =
+                                try_parse_req_to_lines_lenient(&req, &parser).map_err(|e| {
+                                    trace::sampled!(
+                                        error,
+                                        "unparsable http writes",
+                                        "Failed to parse request to lines, err: {:?}",
+                                        e
+                                    );
+                                    reject::custom(WriteRejection(e))
+                                })?;
+                            (lines, Some(partial_resp))
+                        } else {
+                            let lines = try_parse_req_to_lines(&req, &parser).map_err(|e| {
+                                trace::sampled!(
+                                    error,
+                                    "unparsable http writes",
+                                    "Failed to parse request to lines, err: {:?}",
+                                    e
+                                );
+                                reject::custom(WriteRejection(e))
+                            })?;
+                            (lines, None)
+                        }
                     };
 
                     {
@@ -561,6 +1524,10 @@ impl HttpService {
                             .record(parse_start.elapsed());
                     }
 
+                    if let Some(ttl) = ttl.as_deref() {
+                        add_point_ttl(&mut write_points_lines, ttl);
+                    }
+
                     let resp = coord_write_points_with_span_recorder(
                         &coord,
                         ctx.tenant(),
@@ -593,9 +1560,26 @@ impl HttpService {
                         start,
                         HttpApiType::ApiV1Write,
                     );
-                    resp.map(|_| ResponseBuilder::ok()).map_err(|e| {
-                        error!("Failed to handle http write request, err: {:?}", e);
-                        reject::custom(e)
+                    resp.map(|(_, token)| {
+                        let mut response = match partial_resp {
+                            Some(partial_resp) => ResponseBuilder::new(OK).json(&partial_resp),
+                            None => ResponseBuilder::ok(),
+                        };
+                        if let Ok(token) = HeaderValue::from_str(&token.to_string()) {
+                            if !token.is_empty() {
+                                response.headers_mut().insert(WRITE_TOKEN, token);
+                            }
+                        }
+                        response
+                    })
+                    .map_err(|e| {
+                        trace::sampled!(
+                            error,
+                            "failed http writes",
+                            "Failed to handle http write request, err: {:?}",
+                            e
+                        );
+                        reject::custom(WriteRejection(e))
                     })
                 },
             )
@@ -633,8 +1617,16 @@ impl HttpService {
                         db: Some(db),
                         precision: None,
                         tenant: None,
+                        partial_write: None,
+                        non_finite_float: None,
+                        unicode_escape: None,
+                        format: None,
+                        field_label: None,
+                        ttl: None,
                     };
                     let precision = Precision::NS;
+                    let format = WriteFormat::new(query.get("format").map(String::as_str))
+                        .map_err(WriteRejection)?;
 
                     let ctx = construct_write_context_and_check_privilege(
                         header,
@@ -645,12 +1637,26 @@ impl HttpService {
                     .await
                     .map_err(|e| {
                         error!("Failed to construct write context, err: {:?}", e);
-                        reject::custom(e)
+                        reject::custom(WriteRejection(e))
                     })?;
 
-                    let lines = try_parse_req_to_lines(&req).map_err(|e| {
-                        error!("Failed to parse request to lines, err: {:?}", e);
-                        reject::custom(e)
+                    let lines = match format {
+                        WriteFormat::Json => {
+                            try_parse_json_req_to_lines(&req, now_timestamp_nanos())
+                        }
+                        WriteFormat::LineProtocol => {
+                            let parser = LineProtocolParser::new(now_timestamp_nanos());
+                            try_parse_req_to_lines(&req, &parser)
+                        }
+                    }
+                    .map_err(|e| {
+                        trace::sampled!(
+                            error,
+                            "unparsable http writes",
+                            "Failed to parse request to lines, err: {:?}",
+                            e
+                        );
+                        reject::custom(WriteRejection(e))
                     })?;
 
                     let resp = coord_write_points_with_span_recorder(
@@ -678,8 +1684,13 @@ impl HttpService {
                         HttpApiType::Write,
                     );
                     resp.map(|_| ResponseBuilder::ok()).map_err(|e| {
-                        error!("Failed to handle http write request, err: {:?}", e);
-                        reject::custom(e)
+                        trace::sampled!(
+                            error,
+                            "failed http writes",
+                            "Failed to handle http write request, err: {:?}",
+                            e
+                        );
+                        reject::custom(WriteRejection(e))
                     })
                 },
             )
@@ -743,7 +1754,12 @@ impl HttpService {
                     http_limiter_check_write(&coord.meta_manager(), ctx.tenant(), req_len)
                         .await
                         .map_err(|e| {
-                            error!("Failed to check write limiter, err: {:?}", e);
+                            trace::sampled!(
+                                error,
+                                "limited http writes",
+                                "Failed to check write limiter, err: {:?}",
+                                e
+                            );
                             reject::custom(e)
                         })?;
 
@@ -793,7 +1809,12 @@ impl HttpService {
                         HttpApiType::ApiV1OpenTsDBWrite,
                     );
                     resp.map(|_| ResponseBuilder::ok()).map_err(|e| {
-                        error!("Failed to handle http write request, err: {:?}", e);
+                        trace::sampled!(
+                            error,
+                            "failed http writes",
+                            "Failed to handle http write request, err: {:?}",
+                            e
+                        );
                         reject::custom(e)
                     })
                 },
@@ -864,7 +1885,12 @@ impl HttpService {
                     http_limiter_check_write(&coord.meta_manager(), ctx.tenant(), req_len)
                         .await
                         .map_err(|e| {
-                            error!("Failed to check write limiter, err: {:?}", e);
+                            trace::sampled!(
+                                error,
+                                "limited http writes",
+                                "Failed to check write limiter, err: {:?}",
+                                e
+                            );
                             reject::custom(e)
                         })?;
 
@@ -915,7 +1941,12 @@ impl HttpService {
                         HttpApiType::ApiV1OpenTsDBPut,
                     );
                     resp.map(|_| ResponseBuilder::ok()).map_err(|e| {
-                        error!("Failed to handle http write request, err: {:?}", e);
+                        trace::sampled!(
+                            error,
+                            "failed http writes",
+                            "Failed to handle http write request, err: {:?}",
+                            e
+                        );
                         reject::custom(e)
                     })
                 },
@@ -1143,6 +2174,48 @@ impl HttpService {
             )
     }
 
+    /// The per second rates of the counters of `/metrics` between the last
+    /// two samples of the monitor.
+    fn metrics_rates(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("metrics" / "rates")
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_hostaddr())
+            .map(
+                |coord: CoordinatorRef, metrics: Arc<HttpMetrics>, addr: String| {
+                    let start = Instant::now();
+                    let rates = coord
+                        .metric_rates()
+                        .into_iter()
+                        .map(|r| {
+                            let labels = r
+                                .labels
+                                .iter()
+                                .map(|(k, v)| (k.to_string(), v.to_string()))
+                                .collect::<HashMap<_, _>>();
+                            serde_json::json!({
+                                "name": r.name,
+                                "labels": labels,
+                                "value": r.value,
+                                "rate": r.rate,
+                            })
+                        })
+                        .collect::<Vec<_>>();
+                    let body = serde_json::json!({ "rates": rates });
+                    http_response_time_and_flow_metrics(
+                        &metrics,
+                        &addr,
+                        size_of_val(&body),
+                        start,
+                        HttpApiType::MetricsRates,
+                    );
+                    warp::reply::json(&body)
+                },
+            )
+    }
+
     fn prom_remote_read(
         &self,
     ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
@@ -1221,20 +2294,287 @@ impl HttpService {
                                 error!("Failed to handle prom remote read request, err: {:?}", e);
                                 reject::custom(QuerySnafu.into_error(e))
                             })
-                            .map(|b| {
-                                http_query_data_out.inc(b.len() as u64);
-                                b
+                            .map(|response| prom_read_response(response, http_query_data_out))
+                    };
+
+                    http_record_query_metrics(
+                        &metrics,
+                        &context,
+                        &addr,
+                        req_len,
+                        start,
+                        HttpApiType::ApiV1PromRead,
+                    );
+                    let result_size = size_of_val(&result);
+                    let value_size = match &result {
+                        Ok(value) => size_of_val(value),
+                        Err(error) => size_of_val(error),
+                    };
+
+                    let total_size = result_size + value_size + req_len;
+                    http_response_time_and_flow_metrics(
+                        &metrics,
+                        &addr,
+                        total_size,
+                        start,
+                        HttpApiType::ApiV1PromRead,
+                    );
+                    result
+                },
+            )
+    }
+
+    /// `/api/v1/query` and `/api/v1/query_range` of the Prometheus http api,
+    /// the parameters are in the query string or the form body.
+    fn prom_query(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        let is_range = warp::path!("api" / "v1" / "query")
+            .map(|| false)
+            .or(warp::path!("api" / "v1" / "query_range").map(|| true))
+            .unify();
+        let get_params = warp::get().and(warp::query::<HashMap<String, String>>());
+        let post_params = warp::post()
+            .and(warp::query::<HashMap<String, String>>())
+            .and(warp::body::content_length_limit(self.query_body_limit))
+            .and(warp::body::form::<HashMap<String, String>>())
+            .map(
+                |mut params: HashMap<String, String>, form: HashMap<String, String>| {
+                    params.extend(form);
+                    params
+                },
+            );
+
+        is_range
+            .and(get_params.or(post_params).unify())
+            .and(self.handle_header())
+            .and(self.with_dbms())
+            .and(self.with_meta())
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_prom_remote_server())
+            .and(self.with_hostaddr())
+            .and(self.handle_span_header())
+            .and_then(
+                |is_range: bool,
+                 params: HashMap<String, String>,
+                 header: Header,
+                 dbms: DBMSRef,
+                 meta: MetaRef,
+                 coord: CoordinatorRef,
+                 metrics: Arc<HttpMetrics>,
+                 prs: PromRemoteServerRef,
+                 addr: String,
+                 parent_span_ctx: Option<SpanContext>| async move {
+                    let start = Instant::now();
+                    let api_type = if is_range {
+                        HttpApiType::ApiV1PromQueryRange
+                    } else {
+                        HttpApiType::ApiV1PromQuery
+                    };
+                    debug!(
+                        "Receive rest prom query request, header: {:?}, param: {:?}",
+                        header, params
+                    );
+                    let span = Span::from_context("rest prom query", parent_span_ctx.as_ref());
+
+                    let query = prom_query_from_params(&params, is_range)
+                        .map_err(|e| reject::custom(PromQLRejection(e)))?;
+                    let context = {
+                        let mut span = Span::enter_with_parent("construct context", &span);
+                        let param = SqlParam {
+                            tenant: params.get(TENANT).cloned(),
+                            db: params.get(DB).cloned(),
+                            chunked: None,
+                            target_partitions: None,
+                            stream_trigger_interval: None,
+                        };
+                        let ctx = construct_read_context(&header, param, dbms, coord, false)
+                            .await
+                            .map_err(|e| {
+                                error!("Failed to construct read context, err: {:?}", e);
+                                reject::custom(PromQLRejection(e))
+                            })?;
+                        record_context_in_span(&mut span, &ctx);
+                        ctx
+                    };
+                    let req_len = query.query.len();
+
+                    http_limiter_check_query(&meta, context.tenant(), req_len)
+                        .await
+                        .map_err(|e| {
+                            error!("Failed to check query limiter, err: {:?}", e);
+                            reject::custom(PromQLRejection(e))
+                        })?;
+
+                    let http_query_data_out = metrics.http_data_out(
+                        context.tenant(),
+                        context.user().desc().name(),
+                        Some(context.database()),
+                        addr.as_str(),
+                        api_type,
+                    );
+
+                    let result = {
+                        let span = Span::enter_with_parent("promql query", &span);
+                        prs.query(&context, query, span.context().as_ref())
+                            .await
+                            .map_err(|e| {
+                                span.error(e.to_string());
+                                error!("Failed to handle prom query request, err: {:?}", e);
+                                reject::custom(PromQLRejection(QuerySnafu.into_error(e)))
                             })
+                            .map(|data| prom_query_response(data, http_query_data_out))
+                    };
+
+                    http_record_query_metrics(&metrics, &context, &addr, req_len, start, api_type);
+                    let result_size = size_of_val(&result);
+                    let value_size = match &result {
+                        Ok(value) => size_of_val(value),
+                        Err(error) => size_of_val(error),
+                    };
+
+                    let total_size = result_size + value_size + req_len;
+                    http_response_time_and_flow_metrics(
+                        &metrics, &addr, total_size, start, api_type,
+                    );
+                    result
+                },
+            )
+    }
+
+    /// `/api/v1/labels`, `/api/v1/label/<name>/values` and `/api/v1/series`
+    /// of the Prometheus http api. The series are looked up in the index of
+    /// the tags, `start` and `end` are not applied.
+    fn prom_metadata(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        let api = warp::path!("api" / "v1" / "labels")
+            .map(|| PromMetadataApi::LabelNames)
+            .or(warp::path!("api" / "v1" / "label" / String / "values")
+                .map(PromMetadataApi::LabelValues))
+            .unify()
+            .or(warp::path!("api" / "v1" / "series").map(|| PromMetadataApi::Series))
+            .unify();
+        // `match[]` may be repeated
+        let get_params = warp::get().and(warp::query::<Vec<(String, String)>>());
+        let post_params = warp::post()
+            .and(warp::query::<Vec<(String, String)>>())
+            .and(warp::body::content_length_limit(self.query_body_limit))
+            .and(warp::body::form::<Vec<(String, String)>>())
+            .map(
+                |mut params: Vec<(String, String)>, form: Vec<(String, String)>| {
+                    params.extend(form);
+                    params
+                },
+            );
+
+        api.and(get_params.or(post_params).unify())
+            .and(self.handle_header())
+            .and(self.with_dbms())
+            .and(self.with_meta())
+            .and(self.with_coord())
+            .and(self.with_http_metrics())
+            .and(self.with_prom_remote_server())
+            .and(self.with_hostaddr())
+            .and(self.handle_span_header())
+            .and_then(
+                |api: PromMetadataApi,
+                 params: Vec<(String, String)>,
+                 header: Header,
+                 dbms: DBMSRef,
+                 meta: MetaRef,
+                 coord: CoordinatorRef,
+                 metrics: Arc<HttpMetrics>,
+                 prs: PromRemoteServerRef,
+                 addr: String,
+                 parent_span_ctx: Option<SpanContext>| async move {
+                    let start = Instant::now();
+                    let api_type = api.api_type();
+                    debug!(
+                        "Receive rest prom metadata request {:?}, header: {:?}, param: {:?}",
+                        api, header, params
+                    );
+                    let span = Span::from_context("rest prom metadata", parent_span_ctx.as_ref());
+
+                    let param = |name: &str| {
+                        params
+                            .iter()
+                            .find(|(k, _)| k == name)
+                            .map(|(_, v)| v.clone())
+                    };
+                    let selectors = params
+                        .iter()
+                        .filter(|(k, _)| k == "match[]")
+                        .map(|(_, v)| v.clone())
+                        .collect::<Vec<_>>();
+                    if matches!(api, PromMetadataApi::Series) && selectors.is_empty() {
+                        return Err(reject::custom(PromQLRejection(
+                            HttpError::InvalidPromQLParam {
+                                reason: "no match[] parameter provided".to_string(),
+                            },
+                        )));
+                    }
+                    let context = {
+                        let mut span = Span::enter_with_parent("construct context", &span);
+                        let param = SqlParam {
+                            tenant: param(TENANT),
+                            db: param(DB),
+                            chunked: None,
+                            target_partitions: None,
+                            stream_trigger_interval: None,
+                        };
+                        let ctx = construct_read_context(&header, param, dbms, coord, false)
+                            .await
+                            .map_err(|e| {
+                                error!("Failed to construct read context, err: {:?}", e);
+                                reject::custom(PromQLRejection(e))
+                            })?;
+                        record_context_in_span(&mut span, &ctx);
+                        ctx
+                    };
+                    let req_len = selectors.iter().map(|s| s.len()).sum::<usize>();
+
+                    http_limiter_check_query(&meta, context.tenant(), req_len)
+                        .await
+                        .map_err(|e| {
+                            error!("Failed to check query limiter, err: {:?}", e);
+                            reject::custom(PromQLRejection(e))
+                        })?;
+
+                    let http_query_data_out = metrics.http_data_out(
+                        context.tenant(),
+                        context.user().desc().name(),
+                        Some(context.database()),
+                        addr.as_str(),
+                        api_type,
+                    );
+
+                    let result = {
+                        let span = Span::enter_with_parent("prom metadata", &span);
+                        let span_ctx = span.context();
+                        let result = match &api {
+                            PromMetadataApi::LabelNames => prs
+                                .label_names(&context, &selectors, span_ctx.as_ref())
+                                .await
+                                .map(|data| prom_query_response(data, http_query_data_out)),
+                            PromMetadataApi::LabelValues(name) => prs
+                                .label_values(&context, name, &selectors, span_ctx.as_ref())
+                                .await
+                                .map(|data| prom_query_response(data, http_query_data_out)),
+                            PromMetadataApi::Series => prs
+                                .series(&context, &selectors, span_ctx.as_ref())
+                                .await
+                                .map(|data| prom_query_response(data, http_query_data_out)),
+                        };
+                        result.map_err(|e| {
+                            span.error(e.to_string());
+                            error!("Failed to handle prom metadata request, err: {:?}", e);
+                            reject::custom(PromQLRejection(QuerySnafu.into_error(e)))
+                        })
                     };
 
-                    http_record_query_metrics(
-                        &metrics,
-                        &context,
-                        &addr,
-                        req_len,
-                        start,
-                        HttpApiType::ApiV1PromRead,
-                    );
+                    http_record_query_metrics(&metrics, &context, &addr, req_len, start, api_type);
                     let result_size = size_of_val(&result);
                     let value_size = match &result {
                         Ok(value) => size_of_val(value),
@@ -1243,11 +2583,7 @@ impl HttpService {
 
                     let total_size = result_size + value_size + req_len;
                     http_response_time_and_flow_metrics(
-                        &metrics,
-                        &addr,
-                        total_size,
-                        start,
-                        HttpApiType::ApiV1PromRead,
+                        &metrics, &addr, total_size, start, api_type,
                     );
                     result
                 },
@@ -1287,6 +2623,7 @@ impl HttpService {
                     let span =
                         Span::from_context("rest prom remote write", parent_span_ctx.as_ref());
                     let span_context = span.context();
+                    let field_label = param.field_label.clone();
 
                     // Parse req、header and param to construct query request
                     let ctx = {
@@ -1311,21 +2648,36 @@ impl HttpService {
                     http_limiter_check_write(&coord.meta_manager(), ctx.tenant(), req_len)
                         .await
                         .map_err(|e| {
-                            error!("Failed to check write limiter, err: {:?}", e);
+                            trace::sampled!(
+                                error,
+                                "limited http writes",
+                                "Failed to check write limiter, err: {:?}",
+                                e
+                            );
                             reject::custom(e)
                         })?;
 
                     let span = Span::enter_with_parent("remote write", &span);
                     let prom_write_request = prs.remote_write(req).map_err(|e| {
                         span.error(e.to_string());
-                        error!("Failed to handle prom remote write request, err: {:?}", e);
+                        trace::sampled!(
+                            error,
+                            "failed prom remote writes",
+                            "Failed to handle prom remote write request, err: {:?}",
+                            e
+                        );
                         reject::custom(QuerySnafu.into_error(e))
                     })?;
                     let write_request = prs
-                        .prom_write_request_to_lines(&prom_write_request)
+                        .prom_write_request_to_lines(&prom_write_request, field_label.as_deref())
                         .map_err(|e| {
                             span.error(e.to_string());
-                            error!("Failed to handle prom remote write request, err: {:?}", e);
+                            trace::sampled!(
+                                error,
+                                "failed prom remote writes",
+                                "Failed to handle prom remote write request, err: {:?}",
+                                e
+                            );
                             reject::custom(QuerySnafu.into_error(e))
                         })?;
 
@@ -1362,7 +2714,12 @@ impl HttpService {
                         HttpApiType::ApiV1PromWrite,
                     );
                     resp.map(|_| ResponseBuilder::ok()).map_err(|e| {
-                        error!("Failed to handle http write request, err: {:?}", e);
+                        trace::sampled!(
+                            error,
+                            "failed http writes",
+                            "Failed to handle http write request, err: {:?}",
+                            e
+                        );
                         reject::custom(e)
                     })
                 },
@@ -1561,6 +2918,12 @@ impl HttpService {
                         precision: None,
                         tenant: param.tenant,
                         db: param.db,
+                        partial_write: None,
+                        non_finite_float: None,
+                        unicode_escape: None,
+                        format: None,
+                        field_label: None,
+                        ttl: None,
                     };
 
                     if param.table.is_none() {
@@ -1646,7 +3009,12 @@ impl HttpService {
 
                     if resp.is_err() || log_type != JsonType::Bulk {
                         resp.map_err(|e| {
-                            error!("Failed to handle http write request, err: {:?}", e);
+                            trace::sampled!(
+                                error,
+                                "failed http writes",
+                                "Failed to handle http write request, err: {:?}",
+                                e
+                            );
                             reject::custom(e)
                         })
                     } else {
@@ -1724,6 +3092,12 @@ impl HttpService {
                         precision: None,
                         tenant: header.get_tenant(),
                         db: header.get_db(),
+                        partial_write: None,
+                        non_finite_float: None,
+                        unicode_escape: None,
+                        format: None,
+                        field_label: None,
+                        ttl: None,
                     };
                     let ctx = {
                         let mut span = Span::enter_with_parent("construct write context", &span);
@@ -2612,6 +3986,19 @@ impl Service for HttpService {
     }
 }
 
+fn session_cookie(token: &str, max_age: u64, secure: bool) -> Result<HeaderValue, HttpError> {
+    let mut cookie = format!(
+        "{}={}; Path=/; Max-Age={}; HttpOnly; SameSite=Strict",
+        SESSION_COOKIE, token, max_age
+    );
+    if secure {
+        cookie.push_str("; Secure");
+    }
+    HeaderValue::from_str(&cookie).map_err(|e| HttpError::InvalidHeader {
+        reason: e.to_string(),
+    })
+}
+
 async fn construct_query(
     req: Bytes,
     header: &Header,
@@ -2634,21 +4021,21 @@ async fn construct_read_context(
     coord: CoordinatorRef,
     is_sql: bool,
 ) -> Result<Context, HttpError> {
-    let user_info = header.try_get_basic_auth()?;
-
     let tenant = param.tenant;
-    let user = dbms
-        .authenticate(&user_info, tenant.as_deref().unwrap_or(DEFAULT_CATALOG))
-        .await
-        .context(QuerySnafu)?;
+    let user = authenticate(
+        header,
+        tenant.as_deref().unwrap_or(DEFAULT_CATALOG),
+        &dbms,
+        &coord,
+    )
+    .await?;
 
     if !is_sql
         && coord.get_config().query.auth_enabled
         && user
             .desc()
             .options()
-            .must_change_password()
-            .is_some_and(|x| x)
+            .need_change_password(now_timestamp_millis())
     {
         return Err(HttpError::Query {
             source: QueryError::InsufficientPrivileges {
@@ -2662,6 +4049,30 @@ async fn construct_read_context(
         .with_database(param.db)
         .with_target_partitions(param.target_partitions)
         .with_chunked(param.chunked)
+        .with_unbounded_time_range(header.get_unbounded_time_range())
+        .with_write_token(
+            header
+                .get_write_token()
+                .map(|token| {
+                    token
+                        .parse::<WriteToken>()
+                        .map_err(|reason| HttpError::InvalidHeader { reason })
+                })
+                .transpose()?,
+        )
+        .with_series_cursor(
+            header
+                .get_series_cursor()
+                .map(|cursor| {
+                    cursor
+                        .parse::<SeriesCursor>()
+                        .map_err(|reason| HttpError::InvalidHeader { reason })
+                })
+                .transpose()?,
+        )
+        .with_max_points(header.get_max_points())
+        .with_align_series(header.get_align_series())
+        .with_async_job(header.get_async_job())
         .with_stream_trigger_interval(
             param
                 .stream_trigger_interval
@@ -2676,20 +4087,54 @@ async fn construct_read_context(
     Ok(context)
 }
 
+/// Authenticates the user of the request by CnosDB, then by the external
+/// identity provider if it's failed.
+async fn authenticate(
+    header: &Header,
+    tenant: &str,
+    dbms: &DBMSRef,
+    coord: &CoordinatorRef,
+) -> Result<User, HttpError> {
+    let result = match header.try_get_basic_auth() {
+        Ok(user_info) => dbms
+            .authenticate(&user_info, tenant)
+            .await
+            .context(QuerySnafu),
+        Err(err) => Err(err),
+    };
+
+    let config = coord.get_config().security.external_auth;
+    match result {
+        Err(err) if config.is_enabled() => {
+            let meta = coord.meta_manager();
+            match external_auth::authenticate(&config, header.get_authorization(), &meta).await? {
+                Some(identity) => {
+                    external_auth::external_user(&config, &identity, tenant, meta).await
+                }
+                None => Err(err),
+            }
+        }
+        result => result,
+    }
+}
+
 async fn construct_write_context(
     header: &Header,
     param: WriteParam,
     dbms: DBMSRef,
+    coord: &CoordinatorRef,
 ) -> Result<Context, HttpError> {
-    let user_info = header.try_get_basic_auth()?;
     let tenant = param.tenant;
     let db = param.db;
     let precision = param.precision;
 
-    let user = dbms
-        .authenticate(&user_info, tenant.as_deref().unwrap_or(DEFAULT_CATALOG))
-        .await
-        .context(QuerySnafu)?;
+    let user = authenticate(
+        header,
+        tenant.as_deref().unwrap_or(DEFAULT_CATALOG),
+        &dbms,
+        coord,
+    )
+    .await?;
 
     let context = ContextBuilder::new(user)
         .with_tenant(tenant)
@@ -2714,7 +4159,7 @@ async fn construct_write_context_and_check_privilege(
     dbms: DBMSRef,
     coord: CoordinatorRef,
 ) -> Result<Context, HttpError> {
-    let context = construct_write_context(&header, param, dbms).await?;
+    let context = construct_write_context(&header, param, dbms, &coord).await?;
 
     let tenant_id = *coord
         .tenant_meta(context.tenant())
@@ -2731,8 +4176,7 @@ async fn construct_write_context_and_check_privilege(
             .user()
             .desc()
             .options()
-            .must_change_password()
-            .is_some_and(|x| x)
+            .need_change_password(now_timestamp_millis())
     {
         return Err(HttpError::Query {
             source: QueryError::InsufficientPrivileges {
@@ -2757,15 +4201,335 @@ async fn construct_write_context_and_check_privilege(
     Ok(context)
 }
 
-fn try_parse_req_to_lines(req: &Bytes) -> Result<Vec<Line>, HttpError> {
+/// Body format of the write apis.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum WriteFormat {
+    LineProtocol,
+    /// See [`protocol_parser::json_write::JsonPoint`].
+    Json,
+}
+
+impl WriteFormat {
+    fn new(format: Option<&str>) -> Result<Self, HttpError> {
+        match format {
+            None | Some("line_protocol") => Ok(Self::LineProtocol),
+            Some("json") => Ok(Self::Json),
+            Some(other) => Err(HttpError::InvalidWriteParam {
+                reason: format!("unknown format '{}', expect line_protocol or json", other),
+            }),
+        }
+    }
+}
+
+fn prom_read_response(response: PromReadResponse, http_query_data_out: U64Counter) -> Response {
+    match response {
+        PromReadResponse::Samples(b) => {
+            http_query_data_out.inc(b.len() as u64);
+            b.into_response()
+        }
+        PromReadResponse::StreamedXorChunks(frames) => {
+            let frames = frames
+                .map_ok(move |frame| {
+                    http_query_data_out.inc(frame.len() as u64);
+                    frame
+                })
+                .map_err(|e| {
+                    error!("Failed to stream prom remote read response, err: {:?}", e);
+                    std::io::Error::new(std::io::ErrorKind::Other, e.to_string())
+                });
+            ResponseBuilder::new(OK)
+                .insert_header((CONTENT_TYPE, APPLICATION_PROM_STREAMED))
+                .build_stream_response(Response::new(Body::wrap_stream(frames)))
+        }
+    }
+}
+
+fn prom_query_response<T: serde::Serialize>(data: T, http_query_data_out: U64Counter) -> Response {
+    match serde_json::to_vec(&PromQLResponse::success(data)) {
+        Ok(body) => {
+            http_query_data_out.inc(body.len() as u64);
+            ResponseBuilder::new(OK)
+                .insert_header((CONTENT_TYPE, APPLICATION_JSON))
+                .build(body)
+        }
+        Err(e) => {
+            error!("Failed to encode prom query response, err: {:?}", e);
+            ResponseBuilder::internal_server_error()
+        }
+    }
+}
+
+/// Add the version of the server to the headers, of CnosDB and for the tools
+/// of InfluxDB.
+fn with_version_headers(builder: ResponseBuilder) -> ResponseBuilder {
+    let build = HeaderValue::from_str(GIT_HASH.trim())
+        .unwrap_or_else(|_| HeaderValue::from_static("UNKNOWN"));
+    builder
+        .insert_header((HeaderName::from_static(CNOSDB_VERSION), PKG_VERSION))
+        .insert_header((HeaderName::from_static(CNOSDB_BUILD), build))
+        .insert_header((HeaderName::from_static(INFLUXDB_VERSION), PKG_VERSION))
+        .insert_header((HeaderName::from_static(INFLUXDB_BUILD), "OSS"))
+}
+
+/// The database of a bucket `<db>/<rp>` of InfluxDB, the retention policy
+/// is ignored as a database has only one.
+fn bucket_database(bucket: &str) -> &str {
+    bucket.split_once('/').map_or(bucket, |(db, _)| db)
+}
+
+#[derive(Debug, serde::Serialize)]
+struct InfluxDBLinks {
+    #[serde(rename = "self")]
+    this: String,
+}
+
+#[derive(Debug, serde::Serialize)]
+#[serde(rename_all = "camelCase")]
+struct InfluxDBRetentionRule {
+    r#type: &'static str,
+    every_seconds: i64,
+}
+
+#[derive(Debug, serde::Serialize)]
+#[serde(rename_all = "camelCase")]
+struct InfluxDBBucket {
+    id: String,
+    #[serde(rename = "orgID")]
+    org_id: String,
+    name: String,
+    r#type: &'static str,
+    retention_rules: Vec<InfluxDBRetentionRule>,
+    links: InfluxDBLinks,
+}
+
+impl InfluxDBBucket {
+    /// The bucket of a database, `ttl_ms` is `i64::MAX` if the data never
+    /// expires.
+    fn new(tenant_id: Oid, database: &str, ttl_ms: i64) -> Self {
+        // the ids of InfluxDB are 16 hex digits
+        let id = format!(
+            "{:016x}",
+            BkdrHasher::new().hash_with(database.as_bytes()).number()
+        );
+        let retention_rules = if ttl_ms == i64::MAX {
+            vec![]
+        } else {
+            vec![InfluxDBRetentionRule {
+                r#type: "expire",
+                every_seconds: ttl_ms / 1000,
+            }]
+        };
+        Self {
+            links: InfluxDBLinks {
+                this: format!("/api/v2/buckets/{}", id),
+            },
+            id,
+            org_id: format!("{:016x}", tenant_id as u64),
+            name: format!("{}/autogen", database),
+            r#type: "user",
+            retention_rules,
+        }
+    }
+}
+
+#[derive(Debug, serde::Serialize)]
+struct InfluxDBBuckets {
+    links: InfluxDBLinks,
+    buckets: Vec<InfluxDBBucket>,
+}
+
+/// A metadata api of Prometheus.
+#[derive(Debug)]
+enum PromMetadataApi {
+    LabelNames,
+    LabelValues(String),
+    Series,
+}
+
+impl PromMetadataApi {
+    fn api_type(&self) -> HttpApiType {
+        match self {
+            Self::LabelNames => HttpApiType::ApiV1PromLabels,
+            Self::LabelValues(_) => HttpApiType::ApiV1PromLabelValues,
+            Self::Series => HttpApiType::ApiV1PromSeries,
+        }
+    }
+}
+
+/// The PromQL query of the parameters of `/api/v1/query` or
+/// `/api/v1/query_range`, checked as Prometheus.
+fn prom_query_from_params(
+    params: &HashMap<String, String>,
+    is_range: bool,
+) -> Result<PromQLQuery, HttpError> {
+    let invalid = |reason: String| HttpError::InvalidPromQLParam { reason };
+    let query = params
+        .get("query")
+        .filter(|q| !q.is_empty())
+        .ok_or_else(|| invalid("missing parameter 'query'".to_string()))?
+        .clone();
+    let time = |name: &str| match params.get(name) {
+        Some(v) => parse_prom_time(v).map(Some).ok_or_else(|| {
+            invalid(format!(
+                "cannot parse \"{}\" of '{}' to a valid timestamp",
+                v, name
+            ))
+        }),
+        None => Ok(None),
+    };
+
+    if !is_range {
+        let time = time("time")?.unwrap_or_else(|| now_timestamp_nanos() / 1_000_000);
+        return Ok(PromQLQuery::instant(query, time));
+    }
+
+    let start = time("start")?.ok_or_else(|| invalid("missing parameter 'start'".to_string()))?;
+    let end = time("end")?.ok_or_else(|| invalid("missing parameter 'end'".to_string()))?;
+    let step = params
+        .get("step")
+        .ok_or_else(|| invalid("missing parameter 'step'".to_string()))?;
+    let step = parse_prom_duration(step).ok_or_else(|| {
+        invalid(format!(
+            "cannot parse \"{}\" of 'step' to a valid duration",
+            step
+        ))
+    })?;
+    if end < start {
+        return Err(invalid(
+            "end timestamp must not be before start time".to_string(),
+        ));
+    }
+    if step <= 0 {
+        return Err(invalid(
+            "zero or negative query resolution step widths are not accepted".to_string(),
+        ));
+    }
+    if (end - start) / step > MAX_POINTS_PER_SERIES {
+        return Err(invalid(format!(
+            "exceeded maximum resolution of {} points per timeseries, try increasing the step",
+            MAX_POINTS_PER_SERIES
+        )));
+    }
+    Ok(PromQLQuery::range(query, start, end, step))
+}
+
+/// Unix seconds with fraction or RFC 3339, to unix milliseconds.
+fn parse_prom_time(s: &str) -> Option<i64> {
+    if let Ok(secs) = s.parse::<f64>() {
+        return secs.is_finite().then(|| (secs * 1000.0).round() as i64);
+    }
+    chrono::DateTime::parse_from_rfc3339(s)
+        .ok()
+        .map(|t| t.timestamp_millis())
+}
+
+/// Seconds with fraction or a duration of PromQL, to milliseconds.
+fn parse_prom_duration(s: &str) -> Option<i64> {
+    if let Ok(secs) = s.parse::<f64>() {
+        return secs.is_finite().then(|| (secs * 1000.0).round() as i64);
+    }
+    promql::parse_duration(s)
+}
+
+/// Current time in the request precision, the timestamp of the points
+/// written without one.
+fn now_timestamp(precision: Precision) -> i64 {
+    timestamp_convert(Precision::NS, precision, now_timestamp_nanos()).unwrap_or_default()
+}
+
+/// Build the line protocol parser of a write request.
+fn line_protocol_parser(
+    default_time: i64,
+    non_finite_float: Option<&str>,
+    unicode_escape: bool,
+) -> Result<LineProtocolParser, HttpError> {
+    let non_finite_float = match non_finite_float {
+        Some(s) => s
+            .parse::<NonFiniteFloat>()
+            .map_err(|reason| HttpError::InvalidWriteParam { reason })?,
+        None => NonFiniteFloat::default(),
+    };
+
+    Ok(LineProtocolParser::new(default_time)
+        .with_non_finite_float(non_finite_float)
+        .with_unicode_escape(unicode_escape))
+}
+
+fn try_parse_req_to_lines<'a>(
+    req: &'a Bytes,
+    parser: &LineProtocolParser,
+) -> Result<Vec<Line<'a>>, HttpError> {
     let lines = simdutf8::basic::from_utf8(req.as_ref())
         .map_err(|e| HttpError::InvalidUTF8 { source: e })?;
-    let line_protocol_lines = line_protocol_to_lines(lines, now_timestamp_nanos())
-        .map_err(|e| HttpError::ParseLineProtocol { source: e })?;
+    let line_protocol_lines = parser.parse(lines).map_err(|e| {
+        let line = e.pos().map(|pos| {
+            let pos = pos.min(lines.len());
+            lines.as_bytes()[..pos]
+                .iter()
+                .filter(|b| **b == b'\n')
+                .count()
+        });
+        HttpError::ParseLineProtocol { source: e, line }
+    })?;
 
     Ok(line_protocol_lines)
 }
 
+/// Parse the lines could be parsed, the others are reported in the
+/// [`PartialWriteResponse`]. Fails only if no line could be parsed.
+fn try_parse_req_to_lines_lenient<'a>(
+    req: &'a Bytes,
+    parser: &LineProtocolParser,
+) -> Result<(Vec<Line<'a>>, PartialWriteResponse), HttpError> {
+    let lines = simdutf8::basic::from_utf8(req.as_ref())
+        .map_err(|e| HttpError::InvalidUTF8 { source: e })?;
+    let (line_protocol_lines, errors) = parser.parse_lenient(lines);
+
+    // offsets of the errors are in ascending order
+    let mut line_indexes = Vec::with_capacity(errors.len());
+    let (mut line, mut scanned) = (0, 0);
+    for (offset, _) in errors.iter() {
+        line += lines.as_bytes()[scanned..*offset]
+            .iter()
+            .filter(|b| **b == b'\n')
+            .count();
+        scanned = *offset;
+        line_indexes.push(line);
+    }
+
+    if line_protocol_lines.is_empty() {
+        if let Some((_, e)) = errors.into_iter().next() {
+            return Err(HttpError::ParseLineProtocol {
+                source: e,
+                line: line_indexes.first().copied(),
+            });
+        }
+        return Ok((line_protocol_lines, PartialWriteResponse::new(0)));
+    }
+
+    if let Some((_, e)) = errors.first() {
+        trace::sampled!(
+            warn,
+            "rejected points",
+            "Rejected {} lines of a partial write, first err: {}",
+            errors.len(),
+            e
+        );
+    }
+    let mut partial_resp = PartialWriteResponse::new(line_protocol_lines.len());
+    for (line, (_, e)) in line_indexes.into_iter().zip(errors) {
+        partial_resp.reject(line, e.to_string());
+    }
+
+    Ok((line_protocol_lines, partial_resp))
+}
+
+fn try_parse_json_req_to_lines(req: &Bytes, default_time: i64) -> Result<Vec<Line>, HttpError> {
+    let body = simdutf8::basic::from_utf8(req.as_ref())
+        .map_err(|e| HttpError::InvalidUTF8 { source: e })?;
+    json_points_to_lines(body, default_time).map_err(|e| HttpError::ParseJsonWrite { source: e })
+}
+
 fn construct_write_tsdb_points_request(req: &Bytes) -> Result<Vec<Line>, HttpError> {
     let lines = simdutf8::basic::from_utf8(req.as_ref())
         .map_err(|e| HttpError::InvalidUTF8 { source: e })?;
@@ -2876,6 +4640,25 @@ async fn coord_write_log(
     Ok(ResponseBuilder::ok())
 }
 
+fn is_delete_statement(sql: &str) -> bool {
+    sql.trim_start()
+        .get(..6)
+        .is_some_and(|keyword| keyword.eq_ignore_ascii_case("DELETE"))
+}
+
+/// Sets the tag `_ttl` of the lines written without it.
+fn add_point_ttl(lines: &mut [Line<'_>], ttl: &str) {
+    for line in lines.iter_mut() {
+        if line.tags.iter().all(|(k, _)| k != POINT_TTL_TAG) {
+            line.tags
+                .push((Cow::Borrowed(POINT_TTL_TAG), Cow::Owned(ttl.to_string())));
+            // the series key is changed
+            line.hash_id = 0;
+            line.init_hash_id();
+        }
+    }
+}
+
 async fn coord_write_points_with_span_recorder(
     coord: &CoordinatorRef,
     tenant: &str,
@@ -2883,10 +4666,10 @@ async fn coord_write_points_with_span_recorder(
     precision: Precision,
     write_points_lines: Vec<Line<'_>>,
     span_context: Option<&SpanContext>,
-) -> Result<usize, HttpError> {
+) -> Result<(usize, WriteToken), HttpError> {
     let span = Span::from_context("write points", span_context);
     coord
-        .write_lines(
+        .write_lines_with_token(
             tenant,
             db,
             precision,
@@ -2900,6 +4683,204 @@ async fn coord_write_points_with_span_recorder(
         })
 }
 
+/// Queries the tables one by one and encodes each record batch as a gzip
+/// member of line protocol. An error after the response started aborts the
+/// body, so that a truncated export can't be taken as a complete one.
+async fn export_handle(
+    ctx: Context,
+    table: Option<String>,
+    (start, end): (Option<i64>, Option<i64>),
+    dbms: DBMSRef,
+    meta: MetaRef,
+    limiter: Arc<dyn RequestLimiter>,
+    http_data_out: U64Counter,
+) -> Result<Response, HttpError> {
+    if let (Some(start), Some(end)) = (start, end) {
+        if start >= end {
+            return Err(HttpError::InvalidExportParam {
+                reason: format!("start {} is not before end {}", start, end),
+            });
+        }
+    }
+    let tenant_meta =
+        meta.tenant_meta(ctx.tenant())
+            .await
+            .ok_or_else(|| HttpError::NotFoundTenant {
+                name: ctx.tenant().to_string(),
+            })?;
+    let db = ctx.database();
+    let tables = match table {
+        Some(table) => {
+            let schema = tenant_meta
+                .get_tskv_table_schema(db, &table)
+                .context(MetaSnafu)?
+                .ok_or_else(|| HttpError::InvalidExportParam {
+                    reason: format!("table {}.{} not found", db, table),
+                })?;
+            vec![schema]
+        }
+        // the external tables are skipped, their data are not in cnosdb
+        None => {
+            let mut tables = vec![];
+            for table in tenant_meta.list_tables(db).context(MetaSnafu)? {
+                if let Some(schema) = tenant_meta
+                    .get_tskv_table_schema(db, &table)
+                    .context(MetaSnafu)?
+                {
+                    tables.push(schema);
+                }
+            }
+            tables
+        }
+    };
+
+    let body = futures::stream::iter(tables)
+        .then(move |table| {
+            let (ctx, dbms) = (ctx.clone(), dbms.clone());
+            async move {
+                let query = Query::new(ctx, export_sql(&table, start, end));
+                let handle = dbms.execute(&query, None).await.context(QuerySnafu)?;
+                Ok::<_, HttpError>(handle.result().map(move |batch| {
+                    let mut buffer = vec![];
+                    batch_to_line_protocol(&table, &batch.context(QuerySnafu)?, &mut buffer)
+                        .map_err(|e| HttpError::FetchResult {
+                            reason: e.to_string(),
+                        })?;
+                    Ok(buffer)
+                }))
+            }
+        })
+        .try_flatten()
+        .try_filter(|buffer| futures::future::ready(!buffer.is_empty()))
+        .and_then(move |buffer| {
+            let (limiter, http_data_out) = (limiter.clone(), http_data_out.clone());
+            async move {
+                let buffer = Encoding::Gzip
+                    .encode(buffer)
+                    .map_err(|e| HttpError::EncodeResponse { source: e })?;
+                http_data_out.inc(buffer.len() as u64);
+                limiter
+                    .check_http_data_out(buffer.len())
+                    .await
+                    .context(MetaSnafu)?;
+                Ok(buffer)
+            }
+        })
+        .map_err(|e| {
+            error!("Failed to stream export response, err: {:?}", e);
+            std::io::Error::new(std::io::ErrorKind::Other, e.to_string())
+        });
+
+    Ok(ResponseBuilder::new(OK)
+        .insert_header((CONTENT_TYPE, TEXT_PLAIN))
+        .insert_header((CONTENT_ENCODING, Encoding::Gzip.to_header_value()))
+        .build_stream_response(Response::new(Body::wrap_stream(body))))
+}
+
+/// Default and max number of changes read by a request.
+const DEFAULT_CHANGES_LIMIT: usize = 1000;
+const MAX_CHANGES_LIMIT: usize = 10000;
+/// Max seconds a request waits for new changes.
+const MAX_CHANGES_WAIT_SECS: u64 = 60;
+
+async fn changes_handle(
+    ctx: &Context,
+    coord: &CoordinatorRef,
+    checkpoint: Option<&str>,
+    limit: Option<usize>,
+    wait: Option<u64>,
+) -> Result<Response, HttpError> {
+    let tenant_id = *coord
+        .tenant_meta(ctx.tenant())
+        .await
+        .ok_or_else(|| MetaError::TenantNotFound {
+            tenant: ctx.tenant().to_string(),
+        })
+        .context(MetaSnafu)?
+        .tenant()
+        .id();
+    let privilege = Privilege::TenantObject(
+        TenantObjectPrivilege::Database(DatabasePrivilege::Read, Some(ctx.database().to_string())),
+        Some(tenant_id),
+    );
+    if !ctx.user().check_privilege(&privilege) {
+        return Err(HttpError::Query {
+            source: QueryError::InsufficientPrivileges {
+                privilege: format!("{privilege}"),
+            },
+        });
+    }
+
+    let feed = coord.change_feed().ok_or_else(|| HttpError::ChangeFeed {
+        source: ChangeFeedError::NotLogged {
+            tenant: ctx.tenant().to_string(),
+            db: ctx.database().to_string(),
+        },
+    })?;
+    let limit = limit
+        .unwrap_or(DEFAULT_CHANGES_LIMIT)
+        .clamp(1, MAX_CHANGES_LIMIT);
+    let wait = Duration::from_secs(wait.unwrap_or_default().min(MAX_CHANGES_WAIT_SECS));
+    let changes = feed
+        .read(ctx.tenant(), ctx.database(), checkpoint, limit, wait)
+        .await
+        .context(ChangeFeedSnafu)?;
+
+    Ok(ResponseBuilder::new(OK).json(&changes))
+}
+
+async fn annotations_handle(
+    ctx: &Context,
+    (start, end): (Option<i64>, Option<i64>),
+    tags: Option<&str>,
+    dbms: &DBMSRef,
+    coord: &CoordinatorRef,
+) -> Result<Response, HttpError> {
+    if let (Some(start), Some(end)) = (start, end) {
+        if start >= end {
+            return Err(HttpError::InvalidAnnotation {
+                reason: format!("start {} is not before end {}", start, end),
+            });
+        }
+    }
+    let tags = parse_tag_filter(tags.unwrap_or_default())
+        .map_err(|reason| HttpError::InvalidAnnotation { reason })?;
+
+    let tenant_meta =
+        coord
+            .tenant_meta(ctx.tenant())
+            .await
+            .ok_or_else(|| HttpError::NotFoundTenant {
+                name: ctx.tenant().to_string(),
+            })?;
+    // no annotation is written to the database yet
+    let Some(table) = tenant_meta
+        .get_tskv_table_schema(ctx.database(), ANNOTATIONS_TABLE)
+        .context(MetaSnafu)?
+    else {
+        return Ok(ResponseBuilder::new(OK).json(&Vec::<Annotation>::new()));
+    };
+    let Some(sql) = annotations_sql(&table, start, end, &tags) else {
+        return Ok(ResponseBuilder::new(OK).json(&Vec::<Annotation>::new()));
+    };
+
+    let handle = dbms
+        .execute(&Query::new(ctx.clone(), sql), None)
+        .await
+        .context(QuerySnafu)?;
+    let mut batches = handle.result();
+    let mut annotations = vec![];
+    while let Some(batch) = batches.next().await {
+        batch_to_annotations(&table, &batch.context(QuerySnafu)?, &mut annotations).map_err(
+            |e| HttpError::FetchResult {
+                reason: e.to_string(),
+            },
+        )?;
+    }
+
+    Ok(ResponseBuilder::new(OK).json(&annotations))
+}
+
 async fn sql_handle(
     query: &Query,
     dbms: &DBMSRef,
@@ -2932,8 +4913,9 @@ async fn sql_handle(
     );
 
     let span = Span::from_context("build response", span_ctx);
-    if !query.context().chunked() {
-        let result = resp.wrap_batches_to_response().await;
+    // the footer of parquet is written after all the rows
+    let mut response = if !query.context().chunked() || fmt == ResultFormat::Parquet {
+        let mut result = resp.wrap_batches_to_response().await;
         if let Err(err) = &result {
             if tskv::TskvError::vnode_broken_code(err.error_code().code()) {
                 info!("tsm file broken {:?}, try read....", err);
@@ -2955,14 +4937,22 @@ async fn sql_handle(
                     http_query_data_out.clone(),
                     limiter.clone(),
                 );
-                return resp.wrap_batches_to_response().await;
+                result = resp.wrap_batches_to_response().await;
             }
         }
 
         result
     } else {
         resp.wrap_stream_to_response()
+    }?;
+
+    // the page of the series is decided when the query is planned
+    if let Some(cursor) = query.context().session_config().next_series_cursor() {
+        if let Ok(cursor) = HeaderValue::from_str(&cursor.to_string()) {
+            response.headers_mut().insert(SERIES_CURSOR, cursor);
+        }
     }
+    Ok(response)
 }
 
 async fn http_limiter_check_query(
@@ -3072,6 +5062,12 @@ async fn handle_rejection(err: Rejection) -> Result<impl Reply, std::convert::In
     } else if let Some(e) = err.find::<HttpError>() {
         let resp: Response = e.into();
         Ok(resp)
+    } else if let Some(e) = err.find::<WriteRejection>() {
+        let resp: Response = e.into();
+        Ok(resp)
+    } else if let Some(e) = err.find::<PromQLRejection>() {
+        let resp: Response = e.into();
+        Ok(resp)
     } else {
         trace::warn!("unhandled rejection: {:?}", err);
         Ok(ResponseBuilder::internal_server_error())
@@ -3092,8 +5088,191 @@ fn record_context_in_span(span: &mut Span, context: &Context) {
 /**************** bottom *****************/
 #[cfg(test)]
 mod test {
+    use std::collections::HashMap;
+
+    use spi::server::prom::PromQLQuery;
     use tokio::time;
 
+    use super::{
+        add_point_ttl, bucket_database, is_delete_statement, line_protocol_parser, now_timestamp,
+        prom_query_from_params, try_parse_json_req_to_lines, try_parse_req_to_lines_lenient, Bytes,
+        HttpError, InfluxDBBucket, LineProtocolParser, Precision, WriteFormat,
+    };
+
+    #[test]
+    fn test_influxdb_bucket() {
+        assert_eq!(bucket_database("db0/autogen"), "db0");
+        assert_eq!(bucket_database("db0"), "db0");
+
+        let bucket = InfluxDBBucket::new(1, "db0", 86_400_000);
+        assert_eq!(bucket.name, "db0/autogen");
+        assert_eq!(bucket.id.len(), 16);
+        assert_eq!(bucket.org_id, "0000000000000001");
+        let json = serde_json::to_value(&bucket).unwrap();
+        assert_eq!(json["orgID"], "0000000000000001");
+        assert_eq!(
+            json["retentionRules"],
+            serde_json::json!([{"type": "expire", "everySeconds": 86400}])
+        );
+        assert_eq!(
+            json["links"]["self"],
+            format!("/api/v2/buckets/{}", bucket.id)
+        );
+
+        let bucket = InfluxDBBucket::new(1, "db0", i64::MAX);
+        assert!(bucket.retention_rules.is_empty());
+    }
+
+    #[test]
+    fn test_prom_query_from_params() {
+        let params = |pairs: &[(&str, &str)]| {
+            pairs
+                .iter()
+                .map(|(k, v)| (k.to_string(), v.to_string()))
+                .collect::<HashMap<_, _>>()
+        };
+
+        assert_eq!(
+            prom_query_from_params(&params(&[("query", "up"), ("time", "1700000000.5")]), false)
+                .unwrap(),
+            PromQLQuery::instant("up".to_string(), 1_700_000_000_500)
+        );
+        assert_eq!(
+            prom_query_from_params(
+                &params(&[
+                    ("query", "up"),
+                    ("start", "2023-11-14T22:13:20Z"),
+                    ("end", "1700000060"),
+                    ("step", "15s"),
+                ]),
+                true
+            )
+            .unwrap(),
+            PromQLQuery::range(
+                "up".to_string(),
+                1_700_000_000_000,
+                1_700_000_060_000,
+                15_000
+            )
+        );
+
+        for invalid in [
+            params(&[("time", "0")]),
+            params(&[("query", "up"), ("start", "0"), ("end", "60")]),
+            params(&[
+                ("query", "up"),
+                ("start", "60"),
+                ("end", "0"),
+                ("step", "1"),
+            ]),
+            params(&[
+                ("query", "up"),
+                ("start", "0"),
+                ("end", "60"),
+                ("step", "0"),
+            ]),
+            params(&[
+                ("query", "up"),
+                ("start", "x"),
+                ("end", "60"),
+                ("step", "1"),
+            ]),
+            params(&[
+                ("query", "up"),
+                ("start", "0"),
+                ("end", "86400"),
+                ("step", "1"),
+            ]),
+        ] {
+            assert!(matches!(
+                prom_query_from_params(&invalid, true),
+                Err(HttpError::InvalidPromQLParam { .. })
+            ));
+        }
+    }
+
+    #[test]
+    fn test_parse_req_to_lines_lenient() {
+        let parser = LineProtocolParser::new(-1);
+        let req = Bytes::from("ma fa=1 1\nm\\x fa=1 2\nmc fa=1 12x\nmd fa=1i 4");
+        let (lines, partial_resp) = try_parse_req_to_lines_lenient(&req, &parser).unwrap();
+        assert_eq!(lines.len(), 2);
+        let resp = serde_json::to_value(partial_resp).unwrap();
+        assert_eq!(resp["accepted"], 2);
+        assert_eq!(resp["rejected"], 2);
+        assert_eq!(resp["rejected_lines"][0]["line"], 1);
+        assert_eq!(resp["rejected_lines"][1]["line"], 2);
+
+        let req = Bytes::from("ma fa=1 1\nm\\x fa=1 2");
+        let (lines, _) = try_parse_req_to_lines_lenient(&req, &parser).unwrap();
+        assert_eq!(lines.len(), 1);
+
+        let req = Bytes::from("m\\x fa=1 2");
+        let err = try_parse_req_to_lines_lenient(&req, &parser).unwrap_err();
+        assert!(matches!(
+            err,
+            HttpError::ParseLineProtocol { line: Some(0), .. }
+        ));
+    }
+
+    #[test]
+    fn test_is_delete_statement() {
+        assert!(is_delete_statement("DELETE FROM t WHERE time < 10"));
+        assert!(is_delete_statement("\n delete from t"));
+        assert!(!is_delete_statement("SELECT * FROM t"));
+        assert!(!is_delete_statement("DROP"));
+    }
+
+    #[test]
+    fn test_add_point_ttl() {
+        let parser = LineProtocolParser::new(-1);
+        let req = Bytes::from("m,_ttl=1d,host=a fa=1 1\nm,host=a fa=1 2");
+        let (mut lines, _) = try_parse_req_to_lines_lenient(&req, &parser).unwrap();
+        let hash_id = lines[1].hash_id;
+        add_point_ttl(&mut lines, "1h");
+
+        let ttl = |i: usize| {
+            lines[i]
+                .tags
+                .iter()
+                .find(|(k, _)| k == "_ttl")
+                .map(|(_, v)| v.to_string())
+        };
+        assert_eq!(ttl(0).as_deref(), Some("1d"));
+        assert_eq!(ttl(1).as_deref(), Some("1h"));
+        assert_ne!(lines[1].hash_id, hash_id);
+    }
+
+    #[test]
+    fn test_line_protocol_parser() {
+        let parser =
+            line_protocol_parser(now_timestamp(Precision::US), Some("null"), true).unwrap();
+        let lines = parser.parse("m fa=1,fb=inf,fc=\"\\u4e2d\"").unwrap();
+        assert_eq!(lines[0].fields.len(), 2);
+        // the default timestamp is in microseconds
+        let now_us = models::utils::now_timestamp_micros();
+        assert!((now_us - lines[0].timestamp).abs() < 60_000_000);
+
+        let err = line_protocol_parser(0, Some("nan"), false).unwrap_err();
+        assert!(matches!(err, HttpError::InvalidWriteParam { .. }));
+    }
+
+    #[test]
+    fn test_json_write_format() {
+        assert_eq!(WriteFormat::new(None).unwrap(), WriteFormat::LineProtocol);
+        assert_eq!(WriteFormat::new(Some("json")).unwrap(), WriteFormat::Json);
+        assert!(WriteFormat::new(Some("csv")).is_err());
+
+        let req = Bytes::from(r#"[{"measurement": "m", "fields": {"f": 1}}]"#);
+        let lines = try_parse_json_req_to_lines(&req, 1).unwrap();
+        assert_eq!(lines.len(), 1);
+        assert_eq!(lines[0].timestamp, 1);
+
+        let req = Bytes::from(r#"[{"measurement": "m", "fields": {}}]"#);
+        let err = try_parse_json_req_to_lines(&req, 1).unwrap_err();
+        assert!(matches!(err, HttpError::ParseJsonWrite { .. }));
+    }
+
     #[tokio::test]
     async fn test1() {
         // use futures_util::future::TryFutureExt;
@@ -1,19 +1,29 @@
+use coordinator::change_feed::ChangeFeedError;
 use coordinator::errors::CoordinatorError;
 use http_protocol::response::ErrorResponse;
-use http_protocol::status_code::UNPROCESSABLE_ENTITY;
+use http_protocol::status_code::{BAD_REQUEST, INTERNAL_SERVER_ERROR, UNPROCESSABLE_ENTITY};
 use meta::error::MetaError;
 use models::error_code::{ErrorCode, ErrorCoder};
 use prost::DecodeError;
+use serde::Serialize;
 use snafu::Snafu;
 use spi::QueryError;
 use trace::http::http_ctx::ContextError;
+use tskv::error::SchemaError;
+use tskv::TskvError;
+use warp::http::StatusCode;
 use warp::reject;
 use warp::reply::Response;
 
 use self::response::ResponseBuilder;
 
+mod annotation;
 mod api_type;
+mod backup_job;
+mod delete_job;
 mod encoding;
+mod export;
+mod external_auth;
 pub mod header;
 pub mod http_service;
 mod metrics;
@@ -44,6 +54,8 @@ pub enum Error {
     #[error_code(code = 4)]
     ParseLineProtocol {
         source: protocol_parser::LineProtocolError,
+        /// index of the line failed to parse
+        line: Option<usize>,
     },
 
     #[snafu(display("Invalid header: {}", reason))]
@@ -135,6 +147,60 @@ pub enum Error {
     ParseOtlpProtocol {
         source: DecodeError,
     },
+
+    #[snafu(display("Invalid write parameter: {}", reason))]
+    #[error_code(code = 20)]
+    InvalidWriteParam {
+        reason: String,
+    },
+
+    #[snafu(display("Error parsing json points: {}", source))]
+    #[error_code(code = 21)]
+    ParseJsonWrite {
+        source: protocol_parser::JsonWriteError,
+    },
+
+    #[snafu(display("Invalid PromQL query parameter: {}", reason))]
+    #[error_code(code = 22)]
+    InvalidPromQLParam {
+        reason: String,
+    },
+
+    #[snafu(display("Invalid delete job: {}", reason))]
+    #[error_code(code = 23)]
+    InvalidDeleteJob {
+        reason: String,
+    },
+
+    #[snafu(display("Invalid export parameter: {}", reason))]
+    #[error_code(code = 24)]
+    InvalidExportParam {
+        reason: String,
+    },
+
+    #[snafu(display("Change feed: {}", source))]
+    #[error_code(code = 25)]
+    ChangeFeed {
+        source: ChangeFeedError,
+    },
+
+    #[snafu(display("Invalid annotation: {}", reason))]
+    #[error_code(code = 26)]
+    InvalidAnnotation {
+        reason: String,
+    },
+
+    #[snafu(display("Invalid backup parameter: {}", reason))]
+    #[error_code(code = 27)]
+    InvalidBackupParam {
+        reason: String,
+    },
+
+    #[snafu(display("Invalid log level: {}", reason))]
+    #[error_code(code = 28)]
+    InvalidLogLevel {
+        reason: String,
+    },
 }
 
 impl reject::Reject for Error {}
@@ -152,10 +218,9 @@ impl Error {
     }
 }
 
-impl From<&Error> for Response {
-    fn from(e: &Error) -> Self {
-        let error_resp = ErrorResponse::new(e.error_code());
-        match e {
+impl Error {
+    fn status_code(&self) -> Option<StatusCode> {
+        match self {
             Error::Query { .. }
             | Error::FetchResult { .. }
             | Error::Tskv { .. }
@@ -164,22 +229,292 @@ impl From<&Error> for Response {
             | Error::NotFoundTenant { .. }
             | Error::EncodeResponse { .. }
             | Error::ParseLineProtocol { .. }
+            | Error::ParseJsonWrite { .. }
             | Error::ParseLog { .. }
             | Error::ParseLogJson { .. }
-            | Error::InvalidUTF8 { .. } => {
-                ResponseBuilder::new(UNPROCESSABLE_ENTITY).json(&error_resp)
-            }
+            | Error::InvalidUTF8 { .. } => Some(UNPROCESSABLE_ENTITY),
             Error::InvalidHeader { .. }
             | Error::ParseAuth { .. }
             | Error::TraceHttp { .. }
             | Error::DecodeRequest { .. }
+            | Error::InvalidWriteParam { .. }
+            | Error::InvalidPromQLParam { .. }
+            | Error::InvalidDeleteJob { .. }
+            | Error::InvalidExportParam { .. }
+            | Error::InvalidAnnotation { .. }
+            | Error::InvalidBackupParam { .. }
+            | Error::InvalidLogLevel { .. }
+            | Error::ChangeFeed {
+                source:
+                    ChangeFeedError::NotLogged { .. }
+                    | ChangeFeedError::InvalidCheckpoint { .. }
+                    | ChangeFeedError::CheckpointExpired { .. },
+            }
+            | Error::ParseOpentsdbProtocol { .. }
+            | Error::ParseOpentsdbJsonProtocol { .. } => Some(BAD_REQUEST),
+            _ => None,
+        }
+    }
+
+    /// Classify the error of a write request.
+    pub fn write_error_type(&self) -> WriteErrorType {
+        match self {
+            Error::ParseLineProtocol { .. }
+            | Error::ParseJsonWrite { .. }
             | Error::ParseOpentsdbProtocol { .. }
-            | Error::ParseOpentsdbJsonProtocol { .. } => ResponseBuilder::bad_request(&error_resp),
-            _ => ResponseBuilder::internal_server_error(),
+            | Error::ParseOpentsdbJsonProtocol { .. }
+            | Error::ParseLog { .. }
+            | Error::ParseLogJson { .. }
+            | Error::ParseOtlpProtocol { .. }
+            | Error::InvalidUTF8 { .. } => WriteErrorType::ParseError,
+            Error::InvalidHeader { .. }
+            | Error::ParseAuth { .. }
+            | Error::TraceHttp { .. }
+            | Error::DecodeRequest { .. }
+            | Error::InvalidWriteParam { .. }
+            | Error::InvalidAnnotation { .. }
+            | Error::NotFoundTenant { .. }
+            | Error::Query { .. } => WriteErrorType::InvalidRequest,
+            Error::Meta { source } => match source {
+                MetaError::RequestLimit { .. } => WriteErrorType::RateLimited,
+                MetaError::DatabaseNotFound { .. }
+                | MetaError::NotFoundDb { .. }
+                | MetaError::TenantNotFound { .. } => WriteErrorType::InvalidRequest,
+                _ => WriteErrorType::Internal,
+            },
+            Error::Tskv { source } => match source {
+                TskvError::Schema {
+                    source: SchemaError::ColumnTypeError { .. },
+                } => WriteErrorType::FieldTypeConflict,
+                TskvError::MemoryExhausted { .. } => WriteErrorType::Overloaded,
+                _ => WriteErrorType::Internal,
+            },
+            Error::Coordinator { source } => match source {
+                CoordinatorError::DatabaseQuotaExceeded { quota, .. } => match quota.as_str() {
+                    "max_series" => WriteErrorType::MaxSeriesExceeded,
+                    "max_writes_per_sec" => WriteErrorType::RateLimited,
+                    _ => WriteErrorType::QuotaExceeded,
+                },
+                CoordinatorError::TimestampOutOfRange { .. }
+                | CoordinatorError::PointTimestampExpired { .. } => {
+                    WriteErrorType::TimestampOutOfRange
+                }
+                CoordinatorError::Points { .. }
+                | CoordinatorError::FieldsIsEmpty { .. }
+                | CoordinatorError::InvalidPointTable { .. } => WriteErrorType::InvalidRequest,
+                CoordinatorError::MemoryExhausted { .. } => WriteErrorType::Overloaded,
+                CoordinatorError::NoValidReplica { .. }
+                | CoordinatorError::PreExecution { .. }
+                | CoordinatorError::ReplicationSetNotFound { .. }
+                | CoordinatorError::LeaderIsWrong { .. }
+                | CoordinatorError::RaftForwardToLeader { .. }
+                | CoordinatorError::RaftGroupError { .. }
+                | CoordinatorError::ReplicaFrozen { .. }
+                | CoordinatorError::DiskFull { .. } => WriteErrorType::ReplicaUnavailable,
+                // errors applied by a raft node only keep their message
+                CoordinatorError::TskvError {
+                    source:
+                        TskvError::Schema {
+                            source: SchemaError::ColumnTypeError { .. },
+                        },
+                } => WriteErrorType::FieldTypeConflict,
+                CoordinatorError::CommonError { msg, .. }
+                | CoordinatorError::GRPCRequest { msg, .. }
+                    if msg.contains(COLUMN_TYPE_ERROR_MSG) =>
+                {
+                    WriteErrorType::FieldTypeConflict
+                }
+                _ => WriteErrorType::Internal,
+            },
+            _ => WriteErrorType::Internal,
+        }
+    }
+}
+
+/// Part of the display of [`SchemaError::ColumnTypeError`].
+const COLUMN_TYPE_ERROR_MSG: &str = "type error, found";
+
+impl From<&Error> for Response {
+    fn from(e: &Error) -> Self {
+        let error_resp = ErrorResponse::new(e.error_code());
+        match e.status_code() {
+            Some(status) if status == BAD_REQUEST => ResponseBuilder::bad_request(&error_resp),
+            Some(status) => ResponseBuilder::new(status).json(&error_resp),
+            None => ResponseBuilder::internal_server_error(),
         }
     }
 }
 
+/// Category of a failed write, lets clients decide whether to retry.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum WriteErrorType {
+    InvalidRequest,
+    ParseError,
+    FieldTypeConflict,
+    TimestampOutOfRange,
+    MaxSeriesExceeded,
+    QuotaExceeded,
+    RateLimited,
+    Overloaded,
+    ReplicaUnavailable,
+    Internal,
+}
+
+impl WriteErrorType {
+    pub fn retryable(&self) -> bool {
+        matches!(
+            self,
+            WriteErrorType::RateLimited
+                | WriteErrorType::Overloaded
+                | WriteErrorType::ReplicaUnavailable
+                | WriteErrorType::Internal
+        )
+    }
+}
+
+#[derive(Debug, Serialize)]
+pub struct WriteErrorResponse {
+    error_code: String,
+    error_message: String,
+    error_type: WriteErrorType,
+    retryable: bool,
+    /// indexes of the lines rejected, starts from 0
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    rejected_lines: Vec<usize>,
+}
+
+impl WriteErrorResponse {
+    pub fn new(e: &Error) -> Self {
+        let error_code = e.error_code();
+        let error_type = e.write_error_type();
+        let rejected_lines = match e {
+            Error::ParseLineProtocol {
+                line: Some(line), ..
+            } => vec![*line],
+            Error::ParseJsonWrite { source } => source.index().into_iter().collect(),
+            _ => vec![],
+        };
+        Self {
+            error_code: error_code.code().to_string(),
+            error_message: error_code.message(),
+            error_type,
+            retryable: error_type.retryable(),
+            rejected_lines,
+        }
+    }
+}
+
+/// Max number of rejected lines reported in a [`PartialWriteResponse`].
+pub const MAX_REPORTED_REJECTED_LINES: usize = 10;
+
+#[derive(Debug, Serialize)]
+pub struct RejectedLine {
+    /// index of the line, starts from 0
+    line: usize,
+    error_message: String,
+}
+
+/// Response of a write with `partial_write=true`, the lines could be
+/// parsed were written, and the first rejected lines are reported.
+#[derive(Debug, Default, Serialize)]
+pub struct PartialWriteResponse {
+    accepted: usize,
+    rejected: usize,
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    rejected_lines: Vec<RejectedLine>,
+}
+
+impl PartialWriteResponse {
+    pub fn new(accepted: usize) -> Self {
+        Self {
+            accepted,
+            ..Default::default()
+        }
+    }
+
+    pub fn reject(&mut self, line: usize, error_message: String) {
+        self.rejected += 1;
+        if self.rejected_lines.len() < MAX_REPORTED_REJECTED_LINES {
+            self.rejected_lines.push(RejectedLine {
+                line,
+                error_message,
+            });
+        }
+    }
+}
+
+/// Rejection of the write apis, responds a [`WriteErrorResponse`].
+#[derive(Debug)]
+pub struct WriteRejection(pub Error);
+
+impl reject::Reject for WriteRejection {}
+
+impl From<Error> for WriteRejection {
+    fn from(e: Error) -> Self {
+        Self(e)
+    }
+}
+
+impl From<&WriteRejection> for Response {
+    fn from(e: &WriteRejection) -> Self {
+        let status = e.0.status_code().unwrap_or(INTERNAL_SERVER_ERROR);
+        ResponseBuilder::new(status).json(&WriteErrorResponse::new(&e.0))
+    }
+}
+
+/// Response of the PromQL and metadata apis, in the format of the
+/// Prometheus http api.
+#[derive(Debug, Serialize)]
+pub struct PromQLResponse<T> {
+    status: &'static str,
+    data: T,
+}
+
+impl<T: Serialize> PromQLResponse<T> {
+    pub fn success(data: T) -> Self {
+        Self {
+            status: "success",
+            data,
+        }
+    }
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+pub struct PromQLErrorResponse {
+    status: &'static str,
+    error_type: &'static str,
+    error: String,
+}
+
+/// Rejection of the PromQL apis, responds a [`PromQLErrorResponse`].
+#[derive(Debug)]
+pub struct PromQLRejection(pub Error);
+
+impl reject::Reject for PromQLRejection {}
+
+impl From<&PromQLRejection> for Response {
+    fn from(e: &PromQLRejection) -> Self {
+        let status = match &e.0 {
+            Error::Query {
+                source: QueryError::InvalidPromQL { .. },
+            } => Some(BAD_REQUEST),
+            e => e.status_code(),
+        };
+        let (status, error_type) = match status {
+            Some(status) if status == BAD_REQUEST => (status, "bad_data"),
+            Some(status) => (status, "execution"),
+            None => (INTERNAL_SERVER_ERROR, "internal"),
+        };
+        ResponseBuilder::new(status).json(&PromQLErrorResponse {
+            status: "error",
+            error_type,
+            error: e.0.error_code().message(),
+        })
+    }
+}
+
 impl From<Error> for Response {
     fn from(e: Error) -> Self {
         (&e).into()
@@ -268,4 +603,54 @@ mod tests {
 
         assert_eq!(content_type, HeaderValue::from_static(APPLICATION_JSON));
     }
+
+    #[test]
+    fn test_write_error_response() {
+        let e = Error::ParseLineProtocol {
+            source: protocol_parser::LineProtocolError::UnexpectedEnd { pos: 10 },
+            line: Some(2),
+        };
+        let resp = serde_json::to_value(WriteErrorResponse::new(&e)).unwrap();
+        assert_eq!(resp["error_type"], "parse_error");
+        assert_eq!(resp["retryable"], false);
+        assert_eq!(resp["rejected_lines"], serde_json::json!([2]));
+
+        let e = Error::Coordinator {
+            source: CoordinatorError::DatabaseQuotaExceeded {
+                database: "db".to_string(),
+                quota: "max_series".to_string(),
+                usage: 10,
+                limit: 10,
+            },
+        };
+        assert_eq!(e.write_error_type(), WriteErrorType::MaxSeriesExceeded);
+        let resp = serde_json::to_value(WriteErrorResponse::new(&e)).unwrap();
+        assert!(resp.get("rejected_lines").is_none());
+
+        let e = Error::Coordinator {
+            source: CoordinatorError::NoValidReplica { id: 1 },
+        };
+        assert_eq!(e.write_error_type(), WriteErrorType::ReplicaUnavailable);
+        assert!(e.write_error_type().retryable());
+        let resp: Response = (&WriteRejection(e)).into();
+        assert_eq!(resp.status(), UNPROCESSABLE_ENTITY);
+    }
+
+    #[test]
+    fn test_partial_write_response() {
+        let resp = serde_json::to_value(PartialWriteResponse::new(3)).unwrap();
+        assert_eq!(resp, serde_json::json!({"accepted": 3, "rejected": 0}));
+
+        let mut resp = PartialWriteResponse::new(1);
+        for line in 0..MAX_REPORTED_REJECTED_LINES + 2 {
+            resp.reject(line, "bad line".to_string());
+        }
+        let resp = serde_json::to_value(resp).unwrap();
+        assert_eq!(resp["accepted"], 1);
+        assert_eq!(resp["rejected"], MAX_REPORTED_REJECTED_LINES + 2);
+        let rejected_lines = resp["rejected_lines"].as_array().unwrap();
+        assert_eq!(rejected_lines.len(), MAX_REPORTED_REJECTED_LINES);
+        assert_eq!(rejected_lines[1]["line"], 1);
+        assert_eq!(rejected_lines[1]["error_message"], "bad line");
+    }
 }
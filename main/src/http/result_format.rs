@@ -1,14 +1,15 @@
 use std::str::FromStr;
 
 use datafusion::arrow::csv::writer::WriterBuilder;
-use datafusion::arrow::error::Result as ArrowResult;
+use datafusion::arrow::error::{ArrowError, Result as ArrowResult};
 use datafusion::arrow::json::{ArrayWriter, LineDelimitedWriter};
 use datafusion::arrow::record_batch::RecordBatch;
 use datafusion::arrow::util::pretty::pretty_format_batches;
+use datafusion::parquet::arrow::ArrowWriter;
 use http_protocol::encoding::Encoding;
 use http_protocol::header::{
-    APPLICATION_CSV, APPLICATION_JSON, APPLICATION_NDJSON, APPLICATION_PREFIX, APPLICATION_STAR,
-    APPLICATION_TABLE, APPLICATION_TSV, CONTENT_TYPE, STAR_STAR, TEXT_PREFIX,
+    APPLICATION_CSV, APPLICATION_JSON, APPLICATION_NDJSON, APPLICATION_PARQUET, APPLICATION_PREFIX,
+    APPLICATION_STAR, APPLICATION_TABLE, APPLICATION_TSV, CONTENT_TYPE, STAR_STAR, TEXT_PREFIX,
 };
 use http_protocol::status_code::OK;
 use metrics::count::U64Counter;
@@ -53,6 +54,24 @@ fn batches_with_sep(
     Ok(bytes)
 }
 
+/// Write the batches as a parquet file, the schema is the one of the
+/// first batch.
+fn batches_to_parquet(batches: &[RecordBatch]) -> ArrowResult<Vec<u8>> {
+    let mut bytes = vec![];
+    let schema = batches[0].schema();
+    let mut writer = ArrowWriter::try_new(&mut bytes, schema, None)
+        .map_err(|e| ArrowError::ExternalError(Box::new(e)))?;
+    for batch in batches {
+        writer
+            .write(batch)
+            .map_err(|e| ArrowError::ExternalError(Box::new(e)))?;
+    }
+    writer
+        .close()
+        .map_err(|e| ArrowError::ExternalError(Box::new(e)))?;
+    Ok(bytes)
+}
+
 /// Allow records to be printed in different formats
 #[derive(Debug, PartialEq, Eq, clap::ValueEnum, Clone)]
 pub enum ResultFormat {
@@ -61,6 +80,8 @@ pub enum ResultFormat {
     Json,
     NdJson,
     Table,
+    /// Parquet file, can not be sent in chunks
+    Parquet,
 }
 
 impl ResultFormat {
@@ -71,6 +92,7 @@ impl ResultFormat {
             Self::Json => APPLICATION_JSON,
             Self::NdJson => APPLICATION_NDJSON,
             Self::Table => APPLICATION_TABLE,
+            Self::Parquet => APPLICATION_PARQUET,
         }
     }
 
@@ -90,6 +112,7 @@ impl ResultFormat {
                 batches_to_json!(LineDelimitedWriter, batches)
             }
             Self::Table => Ok(pretty_format_batches(batches)?.to_string().into_bytes()),
+            Self::Parquet => batches_to_parquet(batches),
         }
     }
 
@@ -243,4 +266,38 @@ mod tests {
         );
         Ok(())
     }
+
+    #[test]
+    fn test_format_batches_to_parquet() {
+        use datafusion::parquet::arrow::arrow_reader::ParquetRecordBatchReaderBuilder;
+
+        let schema = Arc::new(Schema::new(vec![
+            Field::new("a", DataType::Int32, false),
+            Field::new("b", DataType::Int32, false),
+        ]));
+        let batch = RecordBatch::try_new(
+            schema,
+            vec![
+                Arc::new(Int32Array::from(vec![1, 2, 3])),
+                Arc::new(Int32Array::from(vec![4, 5, 6])),
+            ],
+        )
+        .unwrap();
+
+        let bytes = ResultFormat::Parquet
+            .format_batches(&[batch.clone(), batch.clone()], true)
+            .unwrap();
+        let reader = ParquetRecordBatchReaderBuilder::try_new(bytes::Bytes::from(bytes))
+            .unwrap()
+            .build()
+            .unwrap();
+        let batches = reader.collect::<ArrowResult<Vec<_>>>().unwrap();
+        assert_eq!(batches.iter().map(|b| b.num_rows()).sum::<usize>(), 6);
+        assert_eq!(batches[0].schema(), batch.schema());
+
+        assert_eq!(
+            ResultFormat::try_from(APPLICATION_PARQUET).unwrap(),
+            ResultFormat::Parquet
+        );
+    }
 }
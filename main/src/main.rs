@@ -16,7 +16,7 @@ use tokio::runtime::Runtime;
 use tokio::time::sleep;
 use trace::global_logging::init_global_logging;
 use trace::global_tracing::{finalize_global_tracing, init_global_tracing};
-use trace::info;
+use trace::{info, warn};
 
 use crate::report::ReportService;
 
@@ -24,6 +24,7 @@ mod flight_sql;
 mod http;
 mod opentelemetry;
 mod report;
+mod rlimit;
 mod rpc;
 mod server;
 mod signal;
@@ -40,7 +41,9 @@ Examples:
     # Run the CnosDB:
     cnosdb run
     # Check configuration file:
-    cnosdb check server-config ./config/config.toml"#)]
+    cnosdb check server-config ./config/config.toml
+    # Check configuration file and the host:
+    cnosdb config check --config ./config/config.toml"#)]
 struct Cli {
     #[command(subcommand)]
     subcmd: CliCommand,
@@ -50,8 +53,11 @@ struct Cli {
 enum CliCommand {
     /// Run CnosDB server.
     Run(RunArgs),
-    /// Print default configurations.
-    Config,
+    /// Print default configurations, or check the configurations.
+    Config {
+        #[command(subcommand)]
+        subcmd: Option<ConfigCommand>,
+    },
     /// Check the configuration file in the given path.
     Check {
         #[command(subcommand)]
@@ -76,6 +82,10 @@ struct RunArgs {
     /// The deployment mode of CnosDB,
     #[arg(short = 'M', long, global = true, value_enum)]
     deployment_mode: Option<DeploymentMode>,
+
+    /// Start without checking the configurations and the host.
+    #[arg(long)]
+    skip_self_check: bool,
 }
 
 #[derive(Debug, Copy, Clone, ValueEnum)]
@@ -89,6 +99,9 @@ enum DeploymentMode {
     Query,
     /// Stand-alone deployment.
     Singleton,
+    /// Stand-alone deployment forwarding the writes to the upstream
+    /// cluster configured in `[mirror]`.
+    Edge,
 }
 
 impl FromStr for DeploymentMode {
@@ -99,9 +112,11 @@ impl FromStr for DeploymentMode {
             "tskv" => Self::Tskv,
             "query" => Self::Query,
             "singleton" => Self::Singleton,
+            "edge" => Self::Edge,
             _ => {
                 return Err(
-                    "deployment must be one of [query_tskv, tskv, query, singleton]".to_string(),
+                    "deployment must be one of [query_tskv, tskv, query, singleton, edge]"
+                        .to_string(),
                 )
             }
         };
@@ -116,10 +131,26 @@ impl Display for DeploymentMode {
             DeploymentMode::Tskv => write!(f, "tskv"),
             DeploymentMode::Query => write!(f, "query"),
             DeploymentMode::Singleton => write!(f, "singleton"),
+            DeploymentMode::Edge => write!(f, "edge"),
         }
     }
 }
 
+#[derive(Debug, Subcommand)]
+enum ConfigCommand {
+    /// Check the configurations and the host the server runs on, e.g. the
+    /// disks of the data and the wal, the limit of the open files and the
+    /// memory.
+    Check {
+        /// Path to configuration file.
+        #[arg(long, default_value = "/etc/cnosdb/cnosdb.conf")]
+        config: String,
+        /// Print warnings.
+        #[arg(short, long)]
+        show_warnings: bool,
+    },
+}
+
 #[derive(Debug, Subcommand)]
 enum CheckCommand {
     /// Check server configurations.
@@ -150,10 +181,20 @@ fn main() -> Result<(), std::io::Error> {
     let cli = Cli::parse();
     let run_args = match cli.subcmd {
         CliCommand::Run(run_args) => run_args,
-        CliCommand::Config => {
+        CliCommand::Config { subcmd: None } => {
             println!("{}", Config::default().to_string_pretty());
             return Ok(());
         }
+        CliCommand::Config {
+            subcmd:
+                Some(ConfigCommand::Check {
+                    config,
+                    show_warnings,
+                }),
+        } => {
+            config::tskv::check_config(config, show_warnings);
+            return Ok(());
+        }
         CliCommand::Check { subcmd } => match subcmd {
             CheckCommand::ServerConfig {
                 config,
@@ -167,9 +208,42 @@ fn main() -> Result<(), std::io::Error> {
 
     let config = parse_config(&run_args);
     let deployment_mode = get_deployment_mode(&config.deployment.mode)?;
+    if matches!(deployment_mode, DeploymentMode::Edge)
+        && (!config.mirror.enabled || config.mirror.targets.is_empty())
+    {
+        return Err(std::io::Error::new(
+            std::io::ErrorKind::Other,
+            "the edge mode needs an upstream target in [mirror]",
+        ));
+    }
+
+    // the self check reads the limit of the open files after it is raised
+    let open_files_limit = rlimit::raise_open_files_limit();
+    let warnings = if run_args.skip_self_check {
+        None
+    } else {
+        config::tskv::self_check(&config).map_err(|errors| {
+            eprintln!("{}", errors);
+            std::io::Error::new(
+                std::io::ErrorKind::InvalidInput,
+                "the self check failed, fix the errors or start with --skip-self-check",
+            )
+        })?
+    };
 
     init_global_logging(&config.log, "tsdb.log");
     info!("CnosDB init config: {:?}", config);
+    match open_files_limit {
+        Ok((old, new)) if old < new => {
+            info!("Raised the limit of the open files from {} to {}", old, new)
+        }
+        Ok(_) => {}
+        Err(e) => warn!("Failed to raise the limit of the open files: {}", e),
+    }
+    if let Some(warnings) = warnings {
+        warn!("Self check:\n{}", warnings);
+    }
+    models::auth::set_password_policy(config.security.password_policy.clone());
 
     let runtime = Arc::new(init_runtime(Some(config.deployment.cpu))?);
     let mem_bytes = run_args.memory.unwrap_or(config.deployment.memory) * 1024 * 1024 * 1024;
@@ -200,6 +274,8 @@ fn main() -> Result<(), std::io::Error> {
             DeploymentMode::Tskv => builder.build_storage_server(&mut server).await,
             DeploymentMode::Query => builder.build_query_server(&mut server).await,
             DeploymentMode::Singleton => builder.build_singleton(&mut server).await,
+            // an edge node is a singleton forwarding its writes upstream by the mirror
+            DeploymentMode::Edge => builder.build_singleton(&mut server).await,
         };
 
         info!("CnosDB server start as {} mode", deployment_mode);
@@ -92,7 +92,9 @@ impl Service for GrpcService {
         .max_decoding_message_size(DEFAULT_GRPC_SERVER_MESSAGE_LEN);
 
         let multi_raft = self.coord.raft_manager().multi_raft();
-        let mut raft_grpc_service = RaftServiceServer::new(RaftCBServer::new(multi_raft))
+        let raft_cb_server =
+            RaftCBServer::new(multi_raft).with_append_guard(self.coord.disk_watchdog());
+        let mut raft_grpc_service = RaftServiceServer::new(raft_cb_server)
             .max_decoding_message_size(DEFAULT_GRPC_SERVER_MESSAGE_LEN);
 
         if self.enable_gzip {
@@ -2,20 +2,21 @@ use std::pin::Pin;
 use std::sync::Arc;
 
 use coordinator::errors::{
-    encode_grpc_response, ArrowSnafu, CommonSnafu, CoordinatorResult, TskvSnafu,
+    encode_grpc_response, ArrowSnafu, BincodeSerdeSnafu, CommonSnafu, CoordinatorResult, TskvSnafu,
 };
+use coordinator::raft::FileChecksum;
 use coordinator::service::CoordinatorRef;
 use futures::{Stream, TryStreamExt};
 use meta::model::MetaRef;
 use metrics::metric_register::MetricsRegister;
-use models::meta_data::VnodeInfo;
+use models::meta_data::{VnodeInfo, VnodeStatus};
 use models::predicate::domain::{self, PushedAggregateFunction, QueryArgs, QueryExpr};
 use models::record_batch_encode;
 use protos::kv_service::tskv_service_server::TskvService;
 use protos::kv_service::*;
 use protos::models::{PingBody, PingBodyBuilder};
 use snafu::ResultExt;
-use tokio::io::AsyncReadExt;
+use tokio::io::{AsyncReadExt, AsyncSeekExt, SeekFrom};
 use tokio::runtime::Runtime;
 use tokio::sync::mpsc;
 use tokio_stream::wrappers::ReceiverStream;
@@ -84,6 +85,62 @@ impl TskvServiceImpl {
                 Ok(data)
             }
 
+            admin_command::Command::FetchVnodeSummary(req) => {
+                let summaries = self.kv_inst.get_vnode_summaries(&req.vnode_ids).await;
+                let data = bincode::serialize(&summaries).context(BincodeSerdeSnafu)?;
+                Ok(data)
+            }
+
+            admin_command::Command::FetchSeriesSketch(req) => {
+                let sketches = self
+                    .kv_inst
+                    .get_series_sketches(&req.vnode_ids, &req.tables)
+                    .await
+                    .context(TskvSnafu)?;
+                let data = bincode::serialize(&sketches).context(BincodeSerdeSnafu)?;
+                Ok(data)
+            }
+
+            admin_command::Command::CreateBackupSnapshot(req) => {
+                let snapshot = self
+                    .kv_inst
+                    .create_backup_snapshot(req.vnode_id)
+                    .await
+                    .context(TskvSnafu)?;
+                let data = bincode::serialize(&snapshot).context(BincodeSerdeSnafu)?;
+                Ok(data)
+            }
+
+            admin_command::Command::ReleaseBackupSnapshot(req) => {
+                self.kv_inst
+                    .release_backup_snapshot(req.vnode_id, &req.create_time)
+                    .await;
+                Ok(vec![])
+            }
+
+            admin_command::Command::FreezeVnode(req) => {
+                let status = if req.frozen {
+                    VnodeStatus::Frozen
+                } else {
+                    VnodeStatus::Running
+                };
+                for vnode_id in req.vnode_ids.iter() {
+                    self.kv_inst
+                        .set_vnode_status(*vnode_id, status)
+                        .await
+                        .context(TskvSnafu)?;
+                }
+                Ok(vec![])
+            }
+
+            admin_command::Command::QuarantineVnode(req) => {
+                self.kv_inst
+                    .quarantine_tsfamily(tenant, &req.db_name, req.vnode_id)
+                    .await
+                    .context(TskvSnafu)?;
+                Ok(vec![])
+            }
+
             admin_command::Command::AddRaftFollower(command) => {
                 self.coord
                     .raft_manager()
@@ -110,6 +167,35 @@ impl TskvServiceImpl {
                 Ok(vec![])
             }
 
+            admin_command::Command::RebuildRaftNode(command) => {
+                self.coord
+                    .raft_manager()
+                    .rebuild_node_in_group(
+                        tenant,
+                        &command.db_name,
+                        command.vnode_id,
+                        command.replica_id,
+                    )
+                    .await?;
+                Ok(vec![])
+            }
+
+            admin_command::Command::FetchCommittedLog(command) => {
+                let log = self
+                    .coord
+                    .raft_manager()
+                    .committed_log(
+                        tenant,
+                        &command.db_name,
+                        command.replica_id,
+                        command.from_index,
+                        command.limit as usize,
+                    )
+                    .await?;
+                let data = bincode::serialize(&log).context(BincodeSerdeSnafu)?;
+                Ok(data)
+            }
+
             admin_command::Command::DestoryRaftGroup(command) => {
                 self.coord
                     .raft_manager()
@@ -291,23 +377,60 @@ impl TskvService for TskvServiceImpl {
         let inner = request.into_inner();
         let opt = self.kv_inst.get_storage_options();
         let filename = opt.path().join(inner.filename);
-        info!("request download file name: {:?}", filename);
+        info!(
+            "request download file name: {:?}, offset: {}, checksum: {}",
+            filename, inner.offset, inner.checksum
+        );
+
+        if inner.checksum {
+            let result = FileChecksum::compute(&filename, inner.offset)
+                .await
+                .map(|checksum| checksum.encode())
+                .map_err(|e| self.internal_status(format!("{:?}: {}", filename, e)));
+            let out_stream = tokio_stream::iter(vec![result.map(|data| BatchBytesResponse {
+                code: coordinator::errors::SUCCESS_RESPONSE_CODE,
+                data,
+            })]);
+            return Ok(tonic::Response::new(Box::pin(out_stream)));
+        }
 
         let (send, recv) = mpsc::channel(1024);
         tokio::spawn(async move {
-            if let Ok(mut file) = tokio::fs::File::open(filename).await {
-                let mut buffer = vec![0; 8 * 1024];
-                while let Ok(len) = file.read(&mut buffer).await {
-                    if len == 0 {
+            let mut file = match tokio::fs::File::open(&filename).await {
+                Ok(file) => file,
+                Err(e) => {
+                    let status = Status::not_found(format!("{:?}: {}", filename, e));
+                    let _ = send.send(Err(status)).await;
+                    return;
+                }
+            };
+            if let Err(e) = file.seek(SeekFrom::Start(inner.offset)).await {
+                let status = Status::internal(format!("{:?}: {}", filename, e));
+                let _ = send.send(Err(status)).await;
+                return;
+            }
+
+            let mut buffer = vec![0; 8 * 1024];
+            loop {
+                let len = match file.read(&mut buffer).await {
+                    Ok(0) => break,
+                    Ok(len) => len,
+                    Err(e) => {
+                        let status = Status::internal(format!("{:?}: {}", filename, e));
+                        let _ = send.send(Err(status)).await;
                         break;
                     }
-
-                    let _ = send
-                        .send(Ok(BatchBytesResponse {
-                            code: coordinator::errors::SUCCESS_RESPONSE_CODE,
-                            data: (buffer[0..len]).to_vec(),
-                        }))
-                        .await;
+                };
+
+                let res = send
+                    .send(Ok(BatchBytesResponse {
+                        code: coordinator::errors::SUCCESS_RESPONSE_CODE,
+                        data: (buffer[0..len]).to_vec(),
+                    }))
+                    .await;
+                if res.is_err() {
+                    // the receiver is gone
+                    break;
                 }
             }
         });
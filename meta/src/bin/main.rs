@@ -3,6 +3,7 @@
 use clap::{Parser, Subcommand};
 use config::VERSION;
 use meta::meta_cluster_command::add_node::add_node;
+use meta::meta_cluster_command::backup::{BackupOptions, EncryptionKey};
 use meta::meta_cluster_command::dump::dump;
 use meta::meta_cluster_command::dumpsql::dumpsql;
 use meta::meta_cluster_command::meta_init::meta_init;
@@ -72,6 +73,16 @@ enum Commands {
         /// File path to save the exported data
         #[arg(long)]
         file: String,
+        /// Compress the file by zstd
+        #[arg(long, default_value_t = false)]
+        compress: bool,
+        /// Encrypt the file by AES-256-GCM with the key in the file
+        #[arg(long)]
+        encryption_key_file: Option<String>,
+        /// Encrypt the file by AES-256-GCM with the key printed by the
+        /// command, e.g. a command decrypting the key by a KMS
+        #[arg(long)]
+        encryption_key_command: Option<String>,
     },
     /// Restore the cluster's meta resources from a file
     Restore {
@@ -81,6 +92,12 @@ enum Commands {
         /// File path to restore the data from
         #[arg(long)]
         file: String,
+        /// Decrypt the file with the key in the file
+        #[arg(long)]
+        encryption_key_file: Option<String>,
+        /// Decrypt the file with the key printed by the command
+        #[arg(long)]
+        encryption_key_command: Option<String>,
     },
     /// List information about all nodes in the cluster
     ShowNodes {
@@ -125,13 +142,40 @@ async fn main() {
                 eprintln!("Error backing up meta service: {}", e);
             }
         }
-        Some(Commands::Restore { bind, file }) => {
-            if let Err(e) = restore(&bind, &file).await {
+        Some(Commands::Restore {
+            bind,
+            file,
+            encryption_key_file,
+            encryption_key_command,
+        }) => {
+            let result = EncryptionKey::from_options(
+                encryption_key_file.as_deref(),
+                encryption_key_command.as_deref(),
+            );
+            let result = match result {
+                Ok(key) => restore(&bind, &file, key.as_ref()).await,
+                Err(e) => Err(e),
+            };
+            if let Err(e) = result {
                 eprintln!("Error restoring meta service: {}", e);
             }
         }
-        Some(Commands::Dump { bind, file }) => {
-            if let Err(e) = dump(&bind, &file).await {
+        Some(Commands::Dump {
+            bind,
+            file,
+            compress,
+            encryption_key_file,
+            encryption_key_command,
+        }) => {
+            let result = EncryptionKey::from_options(
+                encryption_key_file.as_deref(),
+                encryption_key_command.as_deref(),
+            );
+            let result = match result {
+                Ok(key) => dump(&bind, &file, &BackupOptions { compress, key }).await,
+                Err(e) => Err(e),
+            };
+            if let Err(e) = result {
                 eprintln!("Error exporting meta service: {}", e);
             }
         }
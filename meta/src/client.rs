@@ -297,6 +297,7 @@ mod test {
         let node = NodeInfo {
             id: 111,
             grpc_addr: "".to_string(),
+            ..Default::default()
         };
 
         let client = reqwest::Client::new();
@@ -324,6 +325,7 @@ mod test {
         let node = NodeInfo {
             id: 111,
             grpc_addr: "".to_string(),
+            ..Default::default()
         };
 
         let req = command::WriteCommand::AddDataNode(cluster.clone(), node);
@@ -0,0 +1,135 @@
+use std::collections::BTreeSet;
+use std::time::Duration;
+
+use config::tskv::MetaConfig;
+use tokio::time::Instant;
+use tracing::{info, warn};
+
+use crate::error::{MetaError, MetaResult};
+
+const DISCOVERY_RETRY_INTERVAL: Duration = Duration::from_secs(2);
+
+/// Resolve the addresses of the meta nodes this node should talk to.
+///
+/// Without `discovery_dns` or `discovery_url` this is just `service_addr`.
+/// Otherwise the discovery sources are polled until they return at least
+/// one address or `discovery_timeout` elapses, so a data node started
+/// before its meta peers (e.g. in a StatefulSet) can wait for them.
+pub async fn discover_meta_addrs(config: &MetaConfig) -> MetaResult<Vec<String>> {
+    if !config.discovery_enabled() {
+        return Ok(config.service_addr.clone());
+    }
+
+    let deadline = Instant::now() + config.discovery_timeout;
+    loop {
+        let mut last_err = None;
+        if let Some(dns) = &config.discovery_dns {
+            match lookup_dns(dns).await {
+                Ok(addrs) if !addrs.is_empty() => {
+                    info!("discovered meta nodes from dns {}: {:?}", dns, addrs);
+                    return Ok(addrs);
+                }
+                Ok(_) => last_err = Some(format!("dns {} returned no address", dns)),
+                Err(e) => last_err = Some(e.to_string()),
+            }
+        }
+        if let Some(url) = &config.discovery_url {
+            match fetch_url(url).await {
+                Ok(addrs) if !addrs.is_empty() => {
+                    info!("discovered meta nodes from url {}: {:?}", url, addrs);
+                    return Ok(addrs);
+                }
+                Ok(_) => last_err = Some(format!("url {} returned no address", url)),
+                Err(e) => last_err = Some(e.to_string()),
+            }
+        }
+
+        let msg = last_err.unwrap_or_default();
+        if Instant::now() + DISCOVERY_RETRY_INTERVAL > deadline {
+            return Err(MetaError::MetaDiscovery {
+                msg: format!(
+                    "no meta node found in {:?}, last error: {}",
+                    config.discovery_timeout, msg
+                ),
+            });
+        }
+        warn!("discover meta nodes failed, will retry: {}", msg);
+        tokio::time::sleep(DISCOVERY_RETRY_INTERVAL).await;
+    }
+}
+
+/// Resolve a `host:port` name to every address behind it, e.g. the
+/// headless service of the meta StatefulSet.
+async fn lookup_dns(dns: &str) -> MetaResult<Vec<String>> {
+    let addrs = tokio::net::lookup_host(dns)
+        .await
+        .map_err(|e| MetaError::MetaDiscovery {
+            msg: format!("resolve {} failed: {}", dns, e),
+        })?;
+
+    Ok(addrs
+        .map(|a| a.to_string())
+        .collect::<BTreeSet<_>>()
+        .into_iter()
+        .collect())
+}
+
+async fn fetch_url(url: &str) -> MetaResult<Vec<String>> {
+    let body = async { reqwest::get(url).await?.error_for_status()?.text().await }
+        .await
+        .map_err(|e| MetaError::MetaDiscovery {
+            msg: format!("request {} failed: {}", url, e),
+        })?;
+
+    Ok(parse_addr_list(&body))
+}
+
+/// The discovery url may answer with a JSON array of addresses or with
+/// plain text separated by commas, semicolons or whitespace.
+fn parse_addr_list(body: &str) -> Vec<String> {
+    let items = match serde_json::from_str::<Vec<String>>(body) {
+        Ok(list) => list,
+        Err(_) => body
+            .split(|c: char| c == ',' || c == ';' || c.is_whitespace())
+            .map(|s| s.to_string())
+            .collect(),
+    };
+
+    items
+        .into_iter()
+        .map(|s| s.trim().to_string())
+        .filter(|s| !s.is_empty())
+        .collect()
+}
+
+#[cfg(test)]
+mod test {
+    use config::tskv::MetaConfig;
+
+    use super::*;
+
+    #[test]
+    fn test_parse_addr_list() {
+        assert_eq!(
+            parse_addr_list(r#"["meta-0:8901", "meta-1:8901"]"#),
+            vec!["meta-0:8901", "meta-1:8901"]
+        );
+        assert_eq!(
+            parse_addr_list("meta-0:8901, meta-1:8901;meta-2:8901\n"),
+            vec!["meta-0:8901", "meta-1:8901", "meta-2:8901"]
+        );
+        assert!(parse_addr_list(" \n").is_empty());
+    }
+
+    #[tokio::test]
+    async fn test_discover_meta_addrs() {
+        let mut config = MetaConfig::default();
+        let addrs = discover_meta_addrs(&config).await.unwrap();
+        assert_eq!(addrs, config.service_addr);
+
+        config.discovery_dns = Some("localhost:8901".to_string());
+        let addrs = discover_meta_addrs(&config).await.unwrap();
+        assert!(!addrs.is_empty());
+        assert!(addrs.iter().all(|a| a.ends_with(":8901")));
+    }
+}
@@ -182,6 +182,14 @@ pub enum MetaError {
     #[snafu(display("cannot revoke the privilege {privilege} of role"))]
     #[error_code(code = 56)]
     PrivilegeCannotRevoke { privilege: TenantObjectPrivilege },
+
+    #[snafu(display("Discover meta nodes failed: {msg}"))]
+    #[error_code(code = 57)]
+    MetaDiscovery { msg: String },
+
+    #[snafu(display("Data node {id} still owns {vnodes} vnodes, decommission it first"))]
+    #[error_code(code = 58)]
+    DataNodeInUse { id: u64, vnodes: usize },
 }
 
 impl MetaError {
@@ -1,4 +1,5 @@
 pub mod client;
+pub mod discovery;
 pub mod error;
 pub mod limiter;
 pub mod meta_cluster_command;
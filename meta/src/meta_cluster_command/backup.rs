@@ -0,0 +1,475 @@
+//! Format of the backup files, of the meta resources and of the data,
+//! compressed by zstd and encrypted by AES-256-GCM optionally, so the
+//! offsite copies are smaller and safe:
+//!
+//! `MAGIC | version: u8 | flags: u8 | [salt: 16 bytes | nonce: 12 bytes] | payload | [tag: 16 bytes]`
+//!
+//! The key is derived from the secret and the salt by PBKDF2, a salt is
+//! generated for each file. The payload is compressed before encrypted, the
+//! header is authenticated along with it. The plain files without the
+//! header are restored as before.
+
+use std::error::Error;
+use std::fs::File;
+use std::io::{BufReader, BufWriter, Read, Write};
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+use openssl::hash::MessageDigest;
+use openssl::pkcs5::pbkdf2_hmac;
+use openssl::rand::rand_bytes;
+use openssl::symm::{Cipher, Crypter, Mode};
+
+const MAGIC: &[u8] = b"CNOSMETA";
+const VERSION: u8 = 1;
+const FLAG_COMPRESSED: u8 = 0b01;
+const FLAG_ENCRYPTED: u8 = 0b10;
+const HEADER_LEN: usize = MAGIC.len() + 2;
+const SALT_LEN: usize = 16;
+const NONCE_LEN: usize = 12;
+const TAG_LEN: usize = 16;
+const KEY_LEN: usize = 32;
+const KDF_ITERATIONS: usize = 100_000;
+const COMPRESSION_LEVEL: i32 = 3;
+
+/// Secret the keys of AES-256-GCM are derived from, the secret can be of
+/// any length.
+pub struct EncryptionKey(Vec<u8>);
+
+impl EncryptionKey {
+    pub fn from_secret(secret: &[u8]) -> Result<Self, Box<dyn Error>> {
+        let start = secret.iter().position(|b| !b.is_ascii_whitespace());
+        let end = secret.iter().rposition(|b| !b.is_ascii_whitespace());
+        let secret = match (start, end) {
+            (Some(start), Some(end)) => &secret[start..=end],
+            _ => &[],
+        };
+        if secret.is_empty() {
+            return Err("encryption key is empty".into());
+        }
+        Ok(Self(secret.to_vec()))
+    }
+
+    pub fn from_file(path: impl AsRef<Path>) -> Result<Self, Box<dyn Error>> {
+        let path = path.as_ref();
+        let secret = std::fs::read(path)
+            .map_err(|e| format!("failed to read encryption key {}: {}", path.display(), e))?;
+        Self::from_secret(&secret)
+    }
+
+    /// The secret is the output of the command run by `sh -c`, e.g. the
+    /// command decrypting a data key by the KMS.
+    pub fn from_command(command: &str) -> Result<Self, Box<dyn Error>> {
+        let output = Command::new("sh").arg("-c").arg(command).output()?;
+        if !output.status.success() {
+            return Err(format!(
+                "encryption key command failed with {}: {}",
+                output.status,
+                String::from_utf8_lossy(&output.stderr).trim()
+            )
+            .into());
+        }
+        Self::from_secret(&output.stdout)
+    }
+
+    /// The key of the file or of the command, at most one of them is
+    /// supplied.
+    pub fn from_options(
+        file: Option<&str>,
+        command: Option<&str>,
+    ) -> Result<Option<Self>, Box<dyn Error>> {
+        match (file, command) {
+            (Some(_), Some(_)) => {
+                Err("only one of the encryption key file and command can be supplied".into())
+            }
+            (Some(file), None) => Self::from_file(file).map(Some),
+            (None, Some(command)) => Self::from_command(command).map(Some),
+            (None, None) => Ok(None),
+        }
+    }
+
+    fn derive(&self, salt: &[u8]) -> Result<[u8; KEY_LEN], Box<dyn Error>> {
+        let mut key = [0; KEY_LEN];
+        pbkdf2_hmac(
+            &self.0,
+            salt,
+            KDF_ITERATIONS,
+            MessageDigest::sha256(),
+            &mut key,
+        )?;
+        Ok(key)
+    }
+}
+
+#[derive(Default)]
+pub struct BackupOptions {
+    pub compress: bool,
+    pub key: Option<EncryptionKey>,
+}
+
+impl BackupOptions {
+    pub fn is_plain(&self) -> bool {
+        !self.compress && self.key.is_none()
+    }
+}
+
+/// Encodes the dumped data as a backup file, the data is returned as is
+/// if neither compressed nor encrypted.
+pub fn encode(data: &[u8], options: &BackupOptions) -> Result<Vec<u8>, Box<dyn Error>> {
+    let mut buf = Vec::with_capacity(data.len() + HEADER_LEN + SALT_LEN + NONCE_LEN + TAG_LEN);
+    encode_stream(&mut &data[..], &mut buf, options)?;
+    Ok(buf)
+}
+
+/// Decodes a backup file to the dumped data.
+pub fn decode(data: &[u8], key: Option<&EncryptionKey>) -> Result<Vec<u8>, Box<dyn Error>> {
+    let mut buf = Vec::with_capacity(data.len());
+    decode_stream(&mut &data[..], data.len() as u64, &mut buf, key)?;
+    Ok(buf)
+}
+
+/// Encodes the file in place, the file is replaced once encoded.
+pub fn encode_file(path: &Path, options: &BackupOptions) -> Result<(), Box<dyn Error>> {
+    if options.is_plain() {
+        return Ok(());
+    }
+    let tmp = tmp_path(path);
+    let res = (|| {
+        let mut reader = BufReader::new(File::open(path)?);
+        let mut writer = BufWriter::new(File::create(&tmp)?);
+        encode_stream(&mut reader, &mut writer, options)?;
+        writer
+            .into_inner()
+            .map_err(|e| e.into_error())?
+            .sync_all()?;
+        Ok::<_, Box<dyn Error>>(())
+    })();
+    finish_tmp(res, &tmp, path)
+}
+
+/// Decodes the file `src` to `dst`, `dst` is only created if the file is
+/// decoded and authenticated.
+pub fn decode_file(
+    src: &Path,
+    dst: &Path,
+    key: Option<&EncryptionKey>,
+) -> Result<(), Box<dyn Error>> {
+    let tmp = tmp_path(dst);
+    let res = (|| {
+        let file = File::open(src)?;
+        let len = file.metadata()?.len();
+        let mut writer = BufWriter::new(File::create(&tmp)?);
+        decode_stream(&mut BufReader::new(file), len, &mut writer, key)?;
+        writer
+            .into_inner()
+            .map_err(|e| e.into_error())?
+            .sync_all()?;
+        Ok::<_, Box<dyn Error>>(())
+    })();
+    finish_tmp(res, &tmp, dst)
+}
+
+/// Whether the file is encoded, compressed or encrypted.
+pub fn is_encoded_file(path: &Path) -> std::io::Result<bool> {
+    let mut magic = [0; MAGIC.len()];
+    match File::open(path)?.read_exact(&mut magic) {
+        Ok(()) => Ok(magic == MAGIC),
+        Err(e) if e.kind() == std::io::ErrorKind::UnexpectedEof => Ok(false),
+        Err(e) => Err(e),
+    }
+}
+
+fn tmp_path(path: &Path) -> PathBuf {
+    let mut name = path.file_name().unwrap_or_default().to_os_string();
+    name.push(".encoding");
+    path.with_file_name(name)
+}
+
+fn finish_tmp(
+    res: Result<(), Box<dyn Error>>,
+    tmp: &Path,
+    path: &Path,
+) -> Result<(), Box<dyn Error>> {
+    match res {
+        Ok(()) => Ok(std::fs::rename(tmp, path)?),
+        Err(e) => {
+            let _ = std::fs::remove_file(tmp);
+            Err(e)
+        }
+    }
+}
+
+/// Encodes the data read from `reader` to `writer`, the data is copied as
+/// is if neither compressed nor encrypted.
+pub fn encode_stream(
+    reader: &mut impl Read,
+    writer: &mut impl Write,
+    options: &BackupOptions,
+) -> Result<(), Box<dyn Error>> {
+    if options.is_plain() {
+        std::io::copy(reader, writer)?;
+        return Ok(());
+    }
+
+    let mut flags = 0;
+    if options.compress {
+        flags |= FLAG_COMPRESSED;
+    }
+    if options.key.is_some() {
+        flags |= FLAG_ENCRYPTED;
+    }
+    let mut header = Vec::with_capacity(HEADER_LEN + SALT_LEN + NONCE_LEN);
+    header.extend_from_slice(MAGIC);
+    header.push(VERSION);
+    header.push(flags);
+    let mut crypter = None;
+    if let Some(key) = &options.key {
+        let mut salt = [0; SALT_LEN];
+        rand_bytes(&mut salt)?;
+        let mut nonce = [0; NONCE_LEN];
+        rand_bytes(&mut nonce)?;
+        header.extend_from_slice(&salt);
+        header.extend_from_slice(&nonce);
+        let mut c = Crypter::new(
+            Cipher::aes_256_gcm(),
+            Mode::Encrypt,
+            &key.derive(&salt)?,
+            Some(&nonce),
+        )?;
+        c.aad_update(&header)?;
+        crypter = Some(c);
+    }
+    writer.write_all(&header)?;
+
+    let mut sink = CipherWriter::new(crypter, &mut *writer);
+    if options.compress {
+        let mut encoder = zstd::stream::Encoder::new(&mut sink, COMPRESSION_LEVEL)?;
+        std::io::copy(reader, &mut encoder)?;
+        encoder.finish()?;
+    } else {
+        std::io::copy(reader, &mut sink)?;
+    }
+    let tag = sink.finish(true)?;
+    writer.write_all(&tag)?;
+    writer.flush()?;
+    Ok(())
+}
+
+/// Decodes the `len` bytes read from `reader` to `writer`. The data
+/// decrypted is written before authenticated by the tag at the end, it is
+/// only trusted if no error is returned.
+pub fn decode_stream(
+    reader: &mut impl Read,
+    len: u64,
+    writer: &mut impl Write,
+    key: Option<&EncryptionKey>,
+) -> Result<(), Box<dyn Error>> {
+    let mut header = vec![0; MAGIC.len().min(len as usize)];
+    reader.read_exact(&mut header)?;
+    if header != MAGIC {
+        writer.write_all(&header)?;
+        std::io::copy(reader, writer)?;
+        return Ok(());
+    }
+    if len < HEADER_LEN as u64 {
+        return Err("backup file is truncated".into());
+    }
+    let mut version_flags = [0; 2];
+    reader.read_exact(&mut version_flags)?;
+    header.extend_from_slice(&version_flags);
+    let [version, flags] = version_flags;
+    if version != VERSION {
+        return Err(format!("unsupported backup file version {}", version).into());
+    }
+
+    let mut payload_len = len - HEADER_LEN as u64;
+    let mut crypter = None;
+    if flags & FLAG_ENCRYPTED != 0 {
+        let key = key.ok_or("backup file is encrypted, but no encryption key is supplied")?;
+        let params_len = (SALT_LEN + NONCE_LEN + TAG_LEN) as u64;
+        if payload_len < params_len {
+            return Err("backup file is truncated".into());
+        }
+        payload_len -= params_len;
+        let mut params = [0; SALT_LEN + NONCE_LEN];
+        reader.read_exact(&mut params)?;
+        header.extend_from_slice(&params);
+        let (salt, nonce) = params.split_at(SALT_LEN);
+        let mut c = Crypter::new(
+            Cipher::aes_256_gcm(),
+            Mode::Decrypt,
+            &key.derive(salt)?,
+            Some(nonce),
+        )?;
+        c.aad_update(&header)?;
+        crypter = Some(c);
+    }
+
+    let mut payload = reader.take(payload_len);
+    if flags & FLAG_COMPRESSED != 0 {
+        let mut decoder = zstd::stream::write::Decoder::new(&mut *writer)?;
+        let mut sink = CipherWriter::new(crypter, &mut decoder);
+        std::io::copy(&mut payload, &mut sink)?;
+        finish_decrypt(sink, payload.into_inner())?;
+        decoder.flush()?;
+    } else {
+        let mut sink = CipherWriter::new(crypter, &mut *writer);
+        std::io::copy(&mut payload, &mut sink)?;
+        finish_decrypt(sink, payload.into_inner())?;
+    }
+    writer.flush()?;
+    Ok(())
+}
+
+fn finish_decrypt<W: Write>(
+    mut sink: CipherWriter<W>,
+    reader: &mut impl Read,
+) -> Result<(), Box<dyn Error>> {
+    if let Some(crypter) = sink.crypter.as_mut() {
+        let mut tag = [0; TAG_LEN];
+        reader.read_exact(&mut tag)?;
+        crypter.set_tag(&tag)?;
+    }
+    sink.finish(false)
+        .map_err(|_| "failed to decrypt backup file, the key is wrong or the file is corrupted")?;
+    Ok(())
+}
+
+/// Encrypts or decrypts the data written through it, the data is written
+/// as is without a crypter.
+struct CipherWriter<W: Write> {
+    crypter: Option<Crypter>,
+    inner: W,
+    buf: Vec<u8>,
+}
+
+impl<W: Write> CipherWriter<W> {
+    fn new(crypter: Option<Crypter>, inner: W) -> Self {
+        Self {
+            crypter,
+            inner,
+            buf: vec![],
+        }
+    }
+
+    /// Finalizes the crypter, returns the tag if `encrypt`.
+    fn finish(mut self, encrypt: bool) -> Result<Vec<u8>, Box<dyn Error>> {
+        let mut tag = vec![];
+        if let Some(mut crypter) = self.crypter.take() {
+            self.buf.resize(Cipher::aes_256_gcm().block_size(), 0);
+            let n = crypter.finalize(&mut self.buf)?;
+            self.inner.write_all(&self.buf[..n])?;
+            if encrypt {
+                tag.resize(TAG_LEN, 0);
+                crypter.get_tag(&mut tag)?;
+            }
+        }
+        self.inner.flush()?;
+        Ok(tag)
+    }
+}
+
+impl<W: Write> Write for CipherWriter<W> {
+    fn write(&mut self, data: &[u8]) -> std::io::Result<usize> {
+        match self.crypter.as_mut() {
+            Some(crypter) => {
+                self.buf
+                    .resize(data.len() + Cipher::aes_256_gcm().block_size(), 0);
+                let n = crypter
+                    .update(data, &mut self.buf)
+                    .map_err(std::io::Error::other)?;
+                self.inner.write_all(&self.buf[..n])?;
+            }
+            None => self.inner.write_all(data)?,
+        }
+        Ok(data.len())
+    }
+
+    fn flush(&mut self) -> std::io::Result<()> {
+        self.inner.flush()
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::{
+        decode, decode_file, encode, encode_file, is_encoded_file, BackupOptions, EncryptionKey,
+    };
+
+    #[test]
+    fn test_backup_codec() {
+        let data = br#"{"version":1,"map":{"/cluster/users/root":"{}"}}"#.repeat(100);
+        let key = || Some(EncryptionKey::from_secret(b"secret\n").unwrap());
+
+        // plain dumps are kept as is
+        let plain = encode(&data, &BackupOptions::default()).unwrap();
+        assert_eq!(plain, data);
+        assert_eq!(decode(&plain, None).unwrap(), data);
+
+        let compressed = encode(
+            &data,
+            &BackupOptions {
+                compress: true,
+                key: None,
+            },
+        )
+        .unwrap();
+        assert!(compressed.len() < data.len());
+        assert_eq!(decode(&compressed, None).unwrap(), data);
+
+        for compress in [false, true] {
+            let options = BackupOptions {
+                compress,
+                key: key(),
+            };
+            let encrypted = encode(&data, &options).unwrap();
+            assert!(!encrypted.windows(b"cluster".len()).any(|w| w == b"cluster"));
+            // a salt and a nonce of each file
+            assert_ne!(encode(&data, &options).unwrap(), encrypted);
+            assert_eq!(decode(&encrypted, key().as_ref()).unwrap(), data);
+
+            assert!(decode(&encrypted, None).is_err());
+            let wrong = EncryptionKey::from_secret(b"wrong").unwrap();
+            assert!(decode(&encrypted, Some(&wrong)).is_err());
+            let mut corrupted = encrypted.clone();
+            let last = corrupted.len() - 20;
+            corrupted[last] ^= 1;
+            assert!(decode(&corrupted, key().as_ref()).is_err());
+        }
+
+        assert!(EncryptionKey::from_secret(b" \n").is_err());
+        assert!(EncryptionKey::from_options(Some("a"), Some("b")).is_err());
+        let from_command = EncryptionKey::from_command("echo secret").unwrap();
+        assert_eq!(from_command.0, key().unwrap().0);
+    }
+
+    #[test]
+    fn test_backup_file_codec() {
+        let dir =
+            std::env::temp_dir().join(format!("test_backup_file_codec_{}", std::process::id()));
+        std::fs::create_dir_all(&dir).unwrap();
+        let path = dir.join("data.tsm");
+        let decoded = dir.join("data.tsm.decoded");
+        let data = (0..200_000u32)
+            .flat_map(|i| (i % 1000).to_le_bytes())
+            .collect::<Vec<_>>();
+        std::fs::write(&path, &data).unwrap();
+
+        let options = BackupOptions {
+            compress: true,
+            key: Some(EncryptionKey::from_secret(b"secret").unwrap()),
+        };
+        encode_file(&path, &options).unwrap();
+        assert!(is_encoded_file(&path).unwrap());
+        assert!(std::fs::metadata(&path).unwrap().len() < data.len() as u64);
+
+        assert!(decode_file(&path, &decoded, None).is_err());
+        let wrong = EncryptionKey::from_secret(b"wrong").unwrap();
+        assert!(decode_file(&path, &decoded, Some(&wrong)).is_err());
+        assert!(!decoded.exists());
+        decode_file(&path, &decoded, options.key.as_ref()).unwrap();
+        assert_eq!(std::fs::read(&decoded).unwrap(), data);
+
+        let _ = std::fs::remove_dir_all(&dir);
+    }
+}
@@ -1,6 +1,21 @@
-use super::utils::http_save_to_file;
+use std::fs::File;
+use std::io::Write;
 
-pub async fn dump(bind: &str, file: &str) -> Result<(), Box<dyn std::error::Error>> {
+use super::backup::{self, BackupOptions};
+use super::utils::http_post_text;
+
+pub async fn dump(
+    bind: &str,
+    file: &str,
+    options: &BackupOptions,
+) -> Result<(), Box<dyn std::error::Error>> {
     let url = format!("http://{}/dump", bind);
-    http_save_to_file(&url, file).await
+    let data = http_post_text(&url).await?;
+    let data = backup::encode(data.as_bytes(), options)?;
+
+    let mut file = File::create(file)?;
+    file.write_all(&data)?;
+    file.flush()?;
+
+    Ok(())
 }
@@ -1,4 +1,5 @@
 pub mod add_node;
+pub mod backup;
 pub mod dump;
 pub mod dumpsql;
 pub mod meta_http_client;
@@ -3,7 +3,14 @@ use std::io::Read;
 use std::time::Duration;
 
 use reqwest::Client;
-pub async fn restore(bind: &str, file_path: &str) -> Result<(), Box<dyn std::error::Error>> {
+
+use super::backup::{self, EncryptionKey};
+
+pub async fn restore(
+    bind: &str,
+    file_path: &str,
+    key: Option<&EncryptionKey>,
+) -> Result<(), Box<dyn std::error::Error>> {
     let client = Client::builder()
         .timeout(Duration::from_secs(600))
         .build()?;
@@ -12,6 +19,7 @@ pub async fn restore(bind: &str, file_path: &str) -> Result<(), Box<dyn std::err
     let mut file = File::open(file_path)?;
     let mut file_content = Vec::new();
     file.read_to_end(&mut file_content)?;
+    let file_content = backup::decode(&file_content, key)?;
     let response = client.post(&url).body(file_content).send().await?;
 
     if !response.status().is_success() {
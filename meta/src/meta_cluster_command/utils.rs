@@ -4,7 +4,7 @@ use std::io::Write;
 
 use reqwest::Client;
 
-pub async fn http_save_to_file(url: &str, file: &str) -> Result<(), Box<dyn Error>> {
+pub async fn http_post_text(url: &str) -> Result<String, Box<dyn Error>> {
     let client = Client::new();
     let response = client.post(url).send().await?;
     let status = response.status();
@@ -20,6 +20,12 @@ pub async fn http_save_to_file(url: &str, file: &str) -> Result<(), Box<dyn Erro
         return Err(format!("Error in response from {}: {}", url, response_text).into());
     }
 
+    Ok(response_text)
+}
+
+pub async fn http_save_to_file(url: &str, file: &str) -> Result<(), Box<dyn Error>> {
+    let response_text = http_post_text(url).await?;
+
     let mut file = File::create(file)?;
     file.write_all(response_text.as_bytes())?;
     file.flush()?;
@@ -4,6 +4,7 @@ use std::collections::{HashMap, HashSet};
 use std::fmt::Debug;
 use std::sync::atomic::{AtomicU64, Ordering};
 use std::sync::Arc;
+use std::time::{Duration, Instant};
 
 use config::common::{RequestLimiterConfig, TenantLimiterConfig, TenantObjectLimiterConfig};
 use config::tskv::Config;
@@ -16,8 +17,9 @@ use models::schema::query_info::QueryInfo;
 use models::schema::resource_info::{ResourceInfo, ResourceStatus};
 use models::schema::table_schema::TableSchema;
 use models::schema::tenant::{Tenant, TenantOptions};
-use models::utils::{build_address_with_optional_addr, now_timestamp_secs};
+use models::utils::{build_address_with_optional_addr, now_timestamp_millis, now_timestamp_secs};
 use parking_lot::{Mutex, RwLock};
+use tokio::sync::broadcast;
 use tokio::sync::mpsc::{self, Receiver, Sender};
 use tonic::transport::{Channel, Endpoint};
 use trace::error;
@@ -61,11 +63,16 @@ pub struct AdminMeta {
     users: RwLock<HashMap<String, UserDesc>>,
     conn_map: RwLock<HashMap<u64, Channel>>,
     data_nodes: RwLock<HashMap<u64, NodeInfo>>,
+    // data nodes failed to answer, and since when
+    down_nodes: RwLock<HashMap<NodeId, Instant>>,
+    runtime_limits: RwLock<RuntimeLimits>,
+    database_usages: RwLock<HashMap<NodeId, HashMap<String, DatabaseUsage>>>,
 
     tenants: RwLock<HashMap<String, Arc<TenantMeta>>>,
     limiters: Arc<LimiterManager>,
 
     resource_tx_rx: (Sender<MetaModifyType>, ReceiverType),
+    change_events: broadcast::Sender<MetaChangeEvent>,
     metrics_register: Arc<MetricsRegister>,
 }
 
@@ -85,17 +92,30 @@ impl AdminMeta {
             users: RwLock::new(HashMap::new()),
             conn_map: RwLock::new(HashMap::new()),
             data_nodes: RwLock::new(HashMap::new()),
+            down_nodes: RwLock::new(HashMap::new()),
+            runtime_limits: RwLock::new(RuntimeLimits::default()),
+            database_usages: RwLock::new(HashMap::new()),
             tenants: RwLock::new(HashMap::new()),
             limiters: Arc::new(limiters),
 
             watch_version: AtomicU64::new(0),
             watch_tenants: RwLock::new(HashSet::new()),
             resource_tx_rx: (tx, Arc::new(Mutex::new(Some(rx)))),
+            change_events: broadcast::channel(1024).0,
             metrics_register: Arc::new(MetricsRegister::default()),
         }
     }
 
-    pub async fn new(config: Config, metrics_register: Arc<MetricsRegister>) -> Arc<Self> {
+    pub async fn new(mut config: Config, metrics_register: Arc<MetricsRegister>) -> Arc<Self> {
+        if config.meta.discovery_enabled() {
+            match crate::discovery::discover_meta_addrs(&config.meta).await {
+                Ok(addrs) => config.meta.service_addr = addrs,
+                Err(e) => error!(
+                    "{}, fall back to service_addr {:?}",
+                    e, config.meta.service_addr
+                ),
+            }
+        }
         let meta_service_addr = config.meta.service_addr.clone();
         let meta_url = meta_service_addr.join(";");
         let (watch_notify, receiver) = mpsc::channel(1024);
@@ -121,11 +141,15 @@ impl AdminMeta {
             users: RwLock::new(HashMap::new()),
             conn_map: RwLock::new(HashMap::new()),
             data_nodes: RwLock::new(HashMap::new()),
+            down_nodes: RwLock::new(HashMap::new()),
+            runtime_limits: RwLock::new(RuntimeLimits::default()),
+            database_usages: RwLock::new(HashMap::new()),
             tenants: RwLock::new(HashMap::new()),
             limiters,
             watch_version: AtomicU64::new(0),
             watch_tenants: RwLock::new(HashSet::new()),
             resource_tx_rx: (tx, Arc::new(Mutex::new(Some(rx)))),
+            change_events: broadcast::channel(1024).0,
             metrics_register,
         });
 
@@ -184,6 +208,30 @@ impl AdminMeta {
         Err(MetaError::NotFoundNode { id })
     }
 
+    pub fn is_node_down(&self, node_id: NodeId) -> bool {
+        self.down_nodes.read().contains_key(&node_id)
+    }
+
+    /// Mark the data node as down so requests skip it until it is marked up,
+    /// return false if it was already down.
+    pub fn mark_node_down(&self, node_id: NodeId) -> bool {
+        self.conn_map.write().remove(&node_id);
+        let mut down_nodes = self.down_nodes.write();
+        if down_nodes.contains_key(&node_id) {
+            return false;
+        }
+        down_nodes.insert(node_id, Instant::now());
+        true
+    }
+
+    /// Mark the data node as up, return how long it was down.
+    pub fn mark_node_up(&self, node_id: NodeId) -> Option<Duration> {
+        self.down_nodes
+            .write()
+            .remove(&node_id)
+            .map(|since| since.elapsed())
+    }
+
     pub async fn get_node_conn(&self, node_id: u64) -> MetaResult<Channel> {
         if let Some(val) = self.conn_map.read().get(&node_id) {
             return Ok(val.clone());
@@ -237,6 +285,17 @@ impl AdminMeta {
             }
         }
 
+        let req = command::ReadCommand::RuntimeLimits(self.cluster());
+        let resp = self.client.read::<RuntimeLimits>(&req).await?;
+        *self.runtime_limits.write() = resp;
+
+        let req = command::ReadCommand::DatabaseUsages(self.cluster());
+        let resp = self
+            .client
+            .read::<HashMap<NodeId, HashMap<String, DatabaseUsage>>>(&req)
+            .await?;
+        *self.database_usages.write() = resp;
+
         Ok(version)
     }
 
@@ -346,6 +405,7 @@ impl AdminMeta {
                 if watch_data.full_sync {
                     let base_ver = admin.process_full_sync().await;
                     admin.watch_version.store(base_ver, Ordering::Relaxed);
+                    admin.notify_change(MetaChangeEvent::FullSync);
                     request.3 = base_ver;
                     continue;
                 }
@@ -392,42 +452,91 @@ impl AdminMeta {
                 let opt_client = self.tenants.read().get(tenant_name).cloned();
                 let _ = self.limiters.process_watch_log(tenant_name, entry).await;
                 if let Some(client) = opt_client {
-                    let _ = client.process_watch_log(entry).await;
+                    if let Ok(Some(event)) = client.process_watch_log(entry).await {
+                        self.notify_change(event);
+                    }
                 }
             } else if len == 3 && strs[2] == key_path::AUTO_INCR_ID {
+            } else if len == 3 && strs[2] == key_path::RUNTIME_LIMITS {
+                if let Ok(Some(event)) = self.process_watch_log(entry).await {
+                    self.notify_change(event);
+                }
             } else if len == 4
                 && (strs[2] == key_path::USERS
                     || strs[2] == key_path::RESOURCE_INFOS
                     || strs[2] == key_path::DATA_NODES
-                    || strs[2] == key_path::DATA_NODES_METRICS)
+                    || strs[2] == key_path::DATA_NODES_METRICS
+                    || strs[2] == key_path::DATABASE_USAGES)
             {
-                let _ = self.process_watch_log(entry).await;
+                if let Ok(Some(event)) = self.process_watch_log(entry).await {
+                    self.notify_change(event);
+                }
             }
         }
     }
 
-    pub async fn process_watch_log(&self, entry: &EntryLog) -> MetaResult<()> {
+    /// Subscribe typed meta data change events, the receiver gets
+    /// `RecvError::Lagged` if it falls behind, and should reload what it needs.
+    pub fn subscribe(&self) -> broadcast::Receiver<MetaChangeEvent> {
+        self.change_events.subscribe()
+    }
+
+    fn notify_change(&self, event: MetaChangeEvent) {
+        // Err only if there is no subscriber.
+        let _ = self.change_events.send(event);
+    }
+
+    pub async fn process_watch_log(&self, entry: &EntryLog) -> MetaResult<Option<MetaChangeEvent>> {
+        let mut event = None;
         let strs: Vec<&str> = entry.key.split('/').collect();
 
         let len = strs.len();
-        if len == 4 && strs[2] == key_path::DATA_NODES {
+        if len == 3 && strs[2] == key_path::RUNTIME_LIMITS {
+            if entry.tye == command::ENTRY_LOG_TYPE_SET {
+                if let Ok(limits) = serde_json::from_str::<RuntimeLimits>(&entry.val) {
+                    *self.runtime_limits.write() = limits;
+                    event = Some(MetaChangeEvent::RuntimeLimitsChanged);
+                }
+            }
+        } else if len == 4 && strs[2] == key_path::DATA_NODES {
             if let Ok(node_id) = serde_json::from_str::<u64>(strs[3]) {
                 if entry.tye == command::ENTRY_LOG_TYPE_SET {
                     if let Ok(info) = serde_json::from_str::<NodeInfo>(&entry.val) {
-                        self.data_nodes.write().insert(node_id, info);
+                        event = match self.data_nodes.write().insert(node_id, info) {
+                            Some(_) => Some(MetaChangeEvent::DataNodeUpdated { node_id }),
+                            None => Some(MetaChangeEvent::DataNodeAdded { node_id }),
+                        };
                     }
                 } else if entry.tye == command::ENTRY_LOG_TYPE_DEL {
-                    self.data_nodes.write().remove(&node_id);
                     self.conn_map.write().remove(&node_id);
+                    self.down_nodes.write().remove(&node_id);
+                    if self.data_nodes.write().remove(&node_id).is_some() {
+                        event = Some(MetaChangeEvent::DataNodeRemoved { node_id });
+                    }
+                }
+            }
+        } else if len == 4 && strs[2] == key_path::DATABASE_USAGES {
+            if let Ok(node_id) = strs[3].parse::<NodeId>() {
+                if entry.tye == command::ENTRY_LOG_TYPE_SET {
+                    if let Ok(usages) =
+                        serde_json::from_str::<HashMap<String, DatabaseUsage>>(&entry.val)
+                    {
+                        self.database_usages.write().insert(node_id, usages);
+                    }
+                } else if entry.tye == command::ENTRY_LOG_TYPE_DEL {
+                    self.database_usages.write().remove(&node_id);
                 }
             }
         } else if len == 4 && strs[2] == key_path::USERS {
+            let name = strs[3].to_owned();
             if entry.tye == command::ENTRY_LOG_TYPE_SET {
                 if let Ok(user) = serde_json::from_str::<UserDesc>(&entry.val) {
-                    self.users.write().insert(strs[3].to_owned(), user);
+                    self.users.write().insert(name.clone(), user);
+                    event = Some(MetaChangeEvent::UserChanged { name });
                 }
             } else if entry.tye == command::ENTRY_LOG_TYPE_DEL {
-                self.users.write().remove(strs[3]);
+                self.users.write().remove(&name);
+                event = Some(MetaChangeEvent::UserDropped { name });
             }
         } else if len == 4
             && strs[2] == key_path::RESOURCE_INFOS
@@ -458,12 +567,14 @@ impl AdminMeta {
             }
         }
 
-        Ok(())
+        Ok(event)
     }
 
     // **[3]    /cluster_name/auto_incr_id -> id
+    // **[3]    /cluster_name/runtime_limits -> [RuntimeLimits]
     // **[4]    /cluster_name/users/name -> [UserDesc]
     // **[4]    /cluster_name/data_nodes/node_id -> [NodeInfo] 集群、数据节点等信息
+    // **[4]    /cluster_name/database_usages/node_id -> [HashMap<String, DatabaseUsage>]
 
     // **[6]    /cluster_name/tenants/tenant/roles/name -> [CustomTenantRole<Oid>]
     // **[6]    /cluster_name/tenants/tenant/members/oid -> [TenantRoleIdentifier]
@@ -484,6 +595,8 @@ impl AdminMeta {
         let node = NodeInfo {
             id: self.config.global.node_id,
             grpc_addr,
+            zone: self.config.global.zone.clone(),
+            tags: self.config.global.node_tags.clone(),
         };
 
         let cluster_name = self.config.global.cluster_name.clone();
@@ -505,6 +618,23 @@ impl AdminMeta {
         nodes
     }
 
+    pub async fn node_metrics(&self) -> MetaResult<Vec<NodeMetrics>> {
+        let req = command::ReadCommand::NodeMetrics(self.cluster());
+        self.client.read::<Vec<NodeMetrics>>(&req).await
+    }
+
+    /// A cordoned node stays in the cluster but gets no new vnodes.
+    pub async fn cordon_data_node(&self, node_id: NodeId, cordon: bool) -> MetaResult<()> {
+        let req = command::WriteCommand::CordonDataNode(self.cluster(), node_id, cordon);
+        self.client.write::<()>(&req).await
+    }
+
+    /// Remove a data node from the cluster, fails if it still owns vnodes.
+    pub async fn remove_data_node(&self, node_id: NodeId) -> MetaResult<()> {
+        let req = command::WriteCommand::RemoveDataNode(self.cluster(), node_id);
+        self.client.write::<()>(&req).await
+    }
+
     pub async fn report_node_metrics(&self) -> MetaResult<()> {
         let disk_free = match get_disk_info(&self.config.storage.path) {
             Ok(size) => size,
@@ -536,15 +666,45 @@ impl AdminMeta {
 
         self.client.write::<()>(&req).await
     }
+
+    pub async fn report_database_usages(
+        &self,
+        usages: HashMap<String, DatabaseUsage>,
+    ) -> MetaResult<()> {
+        let req = command::WriteCommand::ReportDatabaseUsages(
+            self.cluster(),
+            self.config.global.node_id,
+            usages,
+        );
+
+        self.client.write::<()>(&req).await
+    }
+
+    /// Resource usage of the database summed over all data nodes, divided by
+    /// the replica factor as every replica of a vnode reports its usage.
+    pub fn database_usage(&self, owner: &str, replica: u64) -> DatabaseUsage {
+        let mut usage = DatabaseUsage::default();
+        for usages in self.database_usages.read().values() {
+            if let Some(node_usage) = usages.get(owner) {
+                usage.merge(node_usage);
+            }
+        }
+
+        let replica = replica.max(1);
+        usage.disk_size /= replica;
+        usage.series /= replica;
+        usage
+    }
     /******************** Data Node Operation End *********************/
 
     /******************** User Operation Begin *********************/
     pub async fn create_user(
         &self,
         name: String,
-        options: UserOptions,
+        mut options: UserOptions,
         is_admin: bool,
     ) -> MetaResult<Oid> {
+        options.stamp_password_changed_at(now_timestamp_millis());
         let oid = UuidGenerator::default().next_id();
         let user_desc = UserDesc::new(oid, name.clone(), options.clone(), is_admin);
         let req = command::WriteCommand::CreateUser(self.cluster(), user_desc);
@@ -566,10 +726,19 @@ impl AdminMeta {
         self.client.read::<Vec<UserDesc>>(&req).await
     }
 
-    pub async fn alter_user(&self, name: &str, options: UserOptions) -> MetaResult<()> {
+    pub async fn alter_user(&self, name: &str, mut options: UserOptions) -> MetaResult<()> {
+        options.stamp_password_changed_at(now_timestamp_millis());
         let req = command::WriteCommand::AlterUser(self.cluster(), name.to_string(), options);
 
-        self.client.write::<()>(&req).await
+        self.client.write::<()>(&req).await?;
+
+        // refresh the cached user instead of waiting for the watch, so that
+        // e.g. a revocation of the sessions takes effect on this node at once
+        if let Some(user) = self.user(name).await? {
+            self.users.write().insert(name.to_string(), user);
+        }
+
+        Ok(())
     }
 
     pub async fn drop_user(&self, name: &str) -> MetaResult<bool> {
@@ -584,23 +753,27 @@ impl AdminMeta {
         self.client.write::<()>(&req).await
     }
 
+    /// Returns the user from the cache synchronized by the watch, or from the
+    /// meta server if it's not cached yet.
+    pub async fn user_desc(&self, user_name: &str) -> MetaResult<UserDesc> {
+        let cache = self.users.read().get(user_name).cloned();
+        match cache {
+            Some(user) => Ok(user),
+            None => self
+                .user(user_name)
+                .await?
+                .ok_or_else(|| MetaError::UserNotFound {
+                    user: user_name.to_string(),
+                }),
+        }
+    }
+
     pub async fn user_with_privileges(
         &self,
         user_name: &str,
         tenant_name: &str,
     ) -> MetaResult<User> {
-        let user_desc = {
-            let cache = self.users.read().get(user_name).cloned();
-            if let Some(user) = cache {
-                user.clone()
-            } else {
-                self.user(user_name)
-                    .await?
-                    .ok_or_else(|| MetaError::UserNotFound {
-                        user: user_name.to_string(),
-                    })?
-            }
-        };
+        let user_desc = self.user_desc(user_name).await?;
 
         let client =
             self.tenant_meta(tenant_name)
@@ -844,10 +1017,12 @@ impl AdminMeta {
         }
     }
 
-    pub async fn expired_bucket(&self) -> Vec<ExpiredBucketInfo> {
+    /// Buckets beyond the TTL of their database, or `local_ttl` if it is
+    /// not zero and shorter.
+    pub async fn expired_bucket(&self, local_ttl: Duration) -> Vec<ExpiredBucketInfo> {
         let mut list = vec![];
         for (_key, val) in self.tenants.write().iter() {
-            list.append(&mut val.expired_bucket());
+            list.append(&mut val.expired_bucket(local_ttl));
         }
         list
     }
@@ -939,6 +1114,18 @@ impl AdminMeta {
         self.client.write::<()>(&req).await
     }
 
+    pub fn runtime_limits(&self) -> RuntimeLimits {
+        self.runtime_limits.read().clone()
+    }
+
+    pub async fn set_runtime_limit(&self, limit: RuntimeLimit) -> MetaResult<()> {
+        let req = command::WriteCommand::SetRuntimeLimit(self.cluster(), limit);
+        let limits = self.client.write::<RuntimeLimits>(&req).await?;
+        *self.runtime_limits.write() = limits;
+
+        Ok(())
+    }
+
     pub async fn read_tableschema(
         &self,
         tenant: &str,
@@ -955,3 +1142,78 @@ impl AdminMeta {
         self.client.read::<TableSchema>(&req).await
     }
 }
+
+#[cfg(test)]
+mod test {
+    use models::meta_data::{MetaChangeEvent, NodeInfo};
+
+    use super::AdminMeta;
+    use crate::store::command::{self, EntryLog, WatchData};
+
+    #[test]
+    fn test_mark_node_down_and_up() {
+        let admin = AdminMeta::mock();
+        assert!(!admin.is_node_down(1));
+        assert!(admin.mark_node_up(1).is_none());
+
+        assert!(admin.mark_node_down(1));
+        assert!(!admin.mark_node_down(1));
+        assert!(admin.is_node_down(1));
+        assert!(!admin.is_node_down(2));
+
+        assert!(admin.mark_node_up(1).is_some());
+        assert!(!admin.is_node_down(1));
+    }
+
+    #[tokio::test]
+    async fn test_subscribe_data_node_events() {
+        let admin = AdminMeta::mock();
+        let mut events = admin.subscribe();
+
+        let key = format!("/{}/data_nodes/1", admin.cluster());
+        let val = serde_json::to_string(&NodeInfo {
+            id: 1,
+            grpc_addr: "127.0.0.1:8903".to_string(),
+            ..Default::default()
+        })
+        .unwrap();
+        let watch_data = WatchData {
+            entry_logs: vec![
+                EntryLog {
+                    tye: command::ENTRY_LOG_TYPE_SET,
+                    ver: 1,
+                    key: key.clone(),
+                    val: val.clone(),
+                },
+                EntryLog {
+                    tye: command::ENTRY_LOG_TYPE_SET,
+                    ver: 2,
+                    key: key.clone(),
+                    val,
+                },
+                EntryLog {
+                    tye: command::ENTRY_LOG_TYPE_DEL,
+                    ver: 3,
+                    key,
+                    val: String::new(),
+                },
+            ],
+            ..Default::default()
+        };
+        admin.process_watch_data(&watch_data).await;
+
+        assert_eq!(
+            events.recv().await.unwrap(),
+            MetaChangeEvent::DataNodeAdded { node_id: 1 }
+        );
+        assert_eq!(
+            events.recv().await.unwrap(),
+            MetaChangeEvent::DataNodeUpdated { node_id: 1 }
+        );
+        assert_eq!(
+            events.recv().await.unwrap(),
+            MetaChangeEvent::DataNodeRemoved { node_id: 1 }
+        );
+        assert!(admin.data_nodes().await.is_empty());
+    }
+}
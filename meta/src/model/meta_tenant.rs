@@ -3,6 +3,7 @@
 use std::collections::{HashMap, HashSet};
 use std::fmt::Debug;
 use std::sync::Arc;
+use std::time::Duration;
 
 use client::MetaHttpClient;
 use config::common::TenantObjectLimiterConfig;
@@ -14,10 +15,12 @@ use models::meta_data::*;
 use models::oid::{Identifier, Oid};
 use models::schema::database_schema::DatabaseSchema;
 use models::schema::external_table_schema::ExternalTableSchema;
+use models::schema::materialized_view::{MaterializedView, StaleRange};
 use models::schema::resource_info::ResourceInfo;
 use models::schema::table_schema::TableSchema;
 use models::schema::tenant::Tenant;
 use models::schema::tskv_table_schema::TskvTableSchemaRef;
+use models::utils::now_timestamp_nanos;
 use parking_lot::RwLock;
 use store::command;
 use trace::info;
@@ -423,6 +426,71 @@ impl TenantMeta {
         Ok(())
     }
 
+    pub async fn create_materialized_view(
+        &self,
+        db: &str,
+        view: MaterializedView,
+    ) -> MetaResult<()> {
+        let req = command::WriteCommand::CreateMaterializedView(
+            self.cluster.clone(),
+            self.tenant_name(),
+            db.to_string(),
+            view,
+        );
+
+        self.write_with_data(&req).await?;
+        Ok(())
+    }
+
+    pub async fn drop_materialized_view(&self, db: &str, name: &str) -> MetaResult<()> {
+        let req = command::WriteCommand::DropMaterializedView(
+            self.cluster.clone(),
+            self.tenant_name(),
+            db.to_string(),
+            name.to_string(),
+        );
+
+        self.write_with_data(&req).await?;
+        Ok(())
+    }
+
+    /// Marks the ranges of the views stale, after the points of their tables
+    /// are written or deleted.
+    pub async fn mark_materialized_views(
+        &self,
+        db: &str,
+        marks: Vec<(String, StaleRange)>,
+    ) -> MetaResult<()> {
+        let req = command::WriteCommand::MarkMaterializedViews(
+            self.cluster.clone(),
+            self.tenant_name(),
+            db.to_string(),
+            marks,
+        );
+
+        self.write_with_data(&req).await?;
+        Ok(())
+    }
+
+    /// Clears the ranges of the view refreshed.
+    pub async fn clear_materialized_view(
+        &self,
+        db: &str,
+        name: &str,
+        refreshed: Vec<StaleRange>,
+    ) -> MetaResult<()> {
+        let req = command::WriteCommand::ClearMaterializedView(
+            self.cluster.clone(),
+            self.tenant_name(),
+            db.to_string(),
+            name.to_string(),
+            refreshed,
+        );
+
+        self.write_with_data(&req).await?;
+        Ok(())
+    }
+
     pub fn get_db_schema(&self, name: &str) -> MetaResult<Option<DatabaseSchema>> {
         if let Some(db) = self.data.read().dbs.get(name) {
             return Ok(Some(db.schema.clone()));
@@ -589,19 +657,71 @@ impl TenantMeta {
         self.client.write::<()>(&req).await
     }
 
+    /// Split the bucket by the current vnode_duration of the database,
+    /// return the new buckets.
+    pub async fn split_bucket(&self, db: &str, id: u32) -> MetaResult<Vec<BucketInfo>> {
+        let req = command::WriteCommand::SplitBucket(
+            self.cluster.clone(),
+            self.tenant_name(),
+            db.to_string(),
+            id,
+        );
+
+        self.write_with_data(&req).await?;
+
+        let data = self.data.read();
+        let db_info = data
+            .dbs
+            .get(db)
+            .ok_or_else(|| MetaError::DatabaseNotFound {
+                database: db.to_string(),
+            })?;
+        let old_bucket = db_info
+            .buckets
+            .iter()
+            .find(|bucket| bucket.id == id)
+            .ok_or(MetaError::BucketNotFound { id })?;
+        let buckets = db_info
+            .buckets
+            .iter()
+            .filter(|bucket| {
+                bucket.id > id
+                    && bucket.start_time >= old_bucket.start_time
+                    && bucket.end_time <= old_bucket.end_time
+            })
+            .cloned()
+            .collect();
+
+        Ok(buckets)
+    }
+
     pub fn database_min_ts(&self, name: &str) -> Option<i64> {
         self.data.read().database_min_ts(name)
     }
 
-    pub fn expired_bucket(&self) -> Vec<ExpiredBucketInfo> {
+    pub fn expired_bucket(&self, local_ttl: Duration) -> Vec<ExpiredBucketInfo> {
         let mut list = vec![];
         for (key, val) in self.data.read().dbs.iter() {
+            let mut expired_before = val.schema.time_to_expired();
+            if !local_ttl.is_zero() {
+                let precision = *val.schema.config.precision();
+                let local_ttl = timestamp_convert(
+                    Precision::NS,
+                    precision,
+                    local_ttl.as_nanos().min(i64::MAX as u128) as i64,
+                )
+                .unwrap_or(i64::MAX);
+                let now = timestamp_convert(Precision::NS, precision, now_timestamp_nanos())
+                    .unwrap_or_default();
+                expired_before = expired_before.max(now.saturating_sub(local_ttl));
+            }
             for bucket in val.buckets.iter() {
-                if bucket.end_time < val.schema.time_to_expired() {
+                if bucket.end_time < expired_before {
                     let info = ExpiredBucketInfo {
                         tenant: self.tenant_name(),
                         database: key.clone(),
                         bucket: bucket.clone(),
+                        expired_before,
                     };
 
                     list.push(info)
@@ -728,6 +848,24 @@ impl TenantMeta {
         Ok(bucket.vnode_for(hash_id))
     }
 
+    /// Locate the replication set the same as `locate_replication_set_for_write`,
+    /// but pass it to `f` rather than clone it, for the writes of many lines.
+    pub async fn locate_replication_set_for_write_with<R>(
+        &self,
+        db: &str,
+        hash_id: u64,
+        ts: i64,
+        f: impl FnOnce(&ReplicationSet) -> R,
+    ) -> MetaResult<R> {
+        if let Some(bucket) = self.data.read().bucket_by_timestamp(db, ts) {
+            return Ok(f(bucket.replication_set_for(hash_id)));
+        }
+
+        let bucket = self.create_bucket(db, ts).await?;
+
+        Ok(f(bucket.replication_set_for(hash_id)))
+    }
+
     pub async fn get_replication_set(
         &self,
         db_name: &str,
@@ -851,14 +989,15 @@ impl TenantMeta {
 
     // **[6]    /cluster_name/tenants/tenant/roles/name -> [CustomTenantRole<Oid>]
     // **[6]    /cluster_name/tenants/tenant/members/oid -> [TenantRoleIdentifier]
-    pub async fn process_watch_log(&self, entry: &EntryLog) -> MetaResult<()> {
+    pub async fn process_watch_log(&self, entry: &EntryLog) -> MetaResult<Option<MetaChangeEvent>> {
         let mut cache = self.data.write();
         if cache.version >= entry.ver {
-            return Ok(());
+            return Ok(None);
         } else {
             cache.version = entry.ver;
         }
 
+        let mut event = None;
         let strs: Vec<&str> = entry.key.split('/').collect();
         let len = strs.len();
         if len == 8
@@ -866,16 +1005,28 @@ impl TenantMeta {
             && strs[4] == key_path::DBS
             && strs[2] == key_path::TENANTS
         {
-            let _tenant = strs[3];
+            let tenant = strs[3].to_string();
             let db_name = strs[5];
             let tab_name = strs[7];
             if let Some(db) = cache.dbs.get_mut(db_name) {
+                let database = db_name.to_string();
+                let table = tab_name.to_string();
                 if entry.tye == command::ENTRY_LOG_TYPE_SET {
                     if let Ok(info) = serde_json::from_str::<TableSchema>(&entry.val) {
                         db.tables.insert(tab_name.to_string(), info);
+                        event = Some(MetaChangeEvent::TableChanged {
+                            tenant,
+                            database,
+                            table,
+                        });
                     }
                 } else if entry.tye == command::ENTRY_LOG_TYPE_DEL {
                     db.tables.remove(tab_name);
+                    event = Some(MetaChangeEvent::TableDropped {
+                        tenant,
+                        database,
+                        table,
+                    });
                 }
             }
         } else if len == 8
@@ -883,36 +1034,64 @@ impl TenantMeta {
             && strs[4] == key_path::DBS
             && strs[2] == key_path::TENANTS
         {
-            let _tenant = strs[3];
+            let tenant = strs[3].to_string();
             let db_name = strs[5];
             if let Some(db) = cache.dbs.get_mut(db_name) {
+                let database = db_name.to_string();
                 if let Ok(bucket_id) = serde_json::from_str::<u32>(strs[7]) {
                     db.buckets.sort_by(|a, b| a.id.cmp(&b.id));
                     if entry.tye == command::ENTRY_LOG_TYPE_SET {
                         if let Ok(info) = serde_json::from_str::<BucketInfo>(&entry.val) {
                             match db.buckets.binary_search_by(|v| v.id.cmp(&bucket_id)) {
-                                Ok(index) => db.buckets[index] = info,
-                                Err(index) => db.buckets.insert(index, info),
+                                Ok(index) => {
+                                    db.buckets[index] = info;
+                                    event = Some(MetaChangeEvent::BucketUpdated {
+                                        tenant,
+                                        database,
+                                        bucket_id,
+                                    });
+                                }
+                                Err(index) => {
+                                    db.buckets.insert(index, info);
+                                    event = Some(MetaChangeEvent::BucketCreated {
+                                        tenant,
+                                        database,
+                                        bucket_id,
+                                    });
+                                }
                             }
                         }
                     } else if entry.tye == command::ENTRY_LOG_TYPE_DEL {
                         if let Ok(index) = db.buckets.binary_search_by(|v| v.id.cmp(&bucket_id)) {
                             db.buckets.remove(index);
+                            event = Some(MetaChangeEvent::BucketDropped {
+                                tenant,
+                                database,
+                                bucket_id,
+                            });
                         }
                     }
                 }
             }
         } else if len == 6 && strs[4] == key_path::DBS && strs[2] == key_path::TENANTS {
-            let _tenant = strs[3];
+            let tenant = strs[3].to_string();
             let db_name = strs[5];
+            let database = db_name.to_string();
             if entry.tye == command::ENTRY_LOG_TYPE_SET {
                 if let Ok(info) = serde_json::from_str::<DatabaseSchema>(&entry.val) {
-                    let db = cache.dbs.entry(db_name.to_string()).or_default();
+                    event = if cache.dbs.contains_key(db_name) {
+                        Some(MetaChangeEvent::DatabaseAltered { tenant, database })
+                    } else {
+                        Some(MetaChangeEvent::DatabaseCreated { tenant, database })
+                    };
 
+                    let db = cache.dbs.entry(db_name.to_string()).or_default();
                     db.schema = info;
                 }
-            } else if entry.tye == command::ENTRY_LOG_TYPE_DEL {
-                cache.dbs.remove(db_name);
+            } else if entry.tye == command::ENTRY_LOG_TYPE_DEL
+                && cache.dbs.remove(db_name).is_some()
+            {
+                event = Some(MetaChangeEvent::DatabaseDropped { tenant, database });
             }
         } else if len == 6 && strs[4] == key_path::MEMBERS && strs[2] == key_path::TENANTS {
             let key = strs[5];
@@ -934,7 +1113,7 @@ impl TenantMeta {
             }
         }
 
-        Ok(())
+        Ok(event)
     }
 
     pub fn print_data(&self) -> String {
@@ -962,6 +1141,89 @@ impl TenantMeta {
 
 #[cfg(test)]
 mod test {
+    use models::meta_data::{BucketInfo, MetaChangeEvent};
+    use models::schema::database_schema::DatabaseSchema;
+
+    use super::TenantMeta;
+    use crate::store::command::{self, EntryLog};
+
+    fn entry(tye: i32, ver: u64, key: &str, val: String) -> EntryLog {
+        EntryLog {
+            tye,
+            ver,
+            key: key.to_string(),
+            val,
+        }
+    }
+
+    #[tokio::test]
+    async fn test_process_watch_log_events() {
+        let meta = TenantMeta::mock();
+        let db_key = "/cluster/tenants/cnosdb/dbs/db1";
+        let db_val = serde_json::to_string(&DatabaseSchema::default()).unwrap();
+        let bucket_val = serde_json::to_string(&BucketInfo {
+            id: 7,
+            ..Default::default()
+        })
+        .unwrap();
+
+        let cases = vec![
+            (
+                entry(command::ENTRY_LOG_TYPE_SET, 1, db_key, db_val.clone()),
+                Some(MetaChangeEvent::DatabaseCreated {
+                    tenant: "cnosdb".to_string(),
+                    database: "db1".to_string(),
+                }),
+            ),
+            (
+                entry(command::ENTRY_LOG_TYPE_SET, 2, db_key, db_val.clone()),
+                Some(MetaChangeEvent::DatabaseAltered {
+                    tenant: "cnosdb".to_string(),
+                    database: "db1".to_string(),
+                }),
+            ),
+            // Stale version is ignored.
+            (entry(command::ENTRY_LOG_TYPE_SET, 2, db_key, db_val), None),
+            (
+                entry(
+                    command::ENTRY_LOG_TYPE_SET,
+                    3,
+                    "/cluster/tenants/cnosdb/dbs/db1/buckets/7",
+                    bucket_val,
+                ),
+                Some(MetaChangeEvent::BucketCreated {
+                    tenant: "cnosdb".to_string(),
+                    database: "db1".to_string(),
+                    bucket_id: 7,
+                }),
+            ),
+            (
+                entry(
+                    command::ENTRY_LOG_TYPE_DEL,
+                    4,
+                    "/cluster/tenants/cnosdb/dbs/db1/buckets/7",
+                    String::new(),
+                ),
+                Some(MetaChangeEvent::BucketDropped {
+                    tenant: "cnosdb".to_string(),
+                    database: "db1".to_string(),
+                    bucket_id: 7,
+                }),
+            ),
+            (
+                entry(command::ENTRY_LOG_TYPE_DEL, 5, db_key, String::new()),
+                Some(MetaChangeEvent::DatabaseDropped {
+                    tenant: "cnosdb".to_string(),
+                    database: "db1".to_string(),
+                }),
+            ),
+        ];
+        for (log, expected) in cases {
+            let event = meta.process_watch_log(&log).await.unwrap();
+            assert_eq!(event, expected, "{:?}", log);
+        }
+    }
+
     #[tokio::test]
     async fn test_sys_info() {
         let info = sys_info::disk_info();
@@ -5,6 +5,7 @@ use std::time::Duration;
 
 use replication::network_http::RaftHttpAdmin;
 use replication::raft_node::RaftNode;
+use serde::Serialize;
 use tokio::sync::RwLock;
 use trace::info;
 use tracing::{debug, error};
@@ -15,6 +16,20 @@ use crate::store::command::*;
 use crate::store::dump::dump_impl;
 use crate::store::storage::StateMachine;
 
+#[derive(Debug, Serialize)]
+pub struct MetaStatus {
+    pub node_id: u64,
+    pub state: String,
+    pub current_term: u64,
+    pub current_leader: Option<u64>,
+    pub last_log_index: Option<u64>,
+    pub last_applied_index: Option<u64>,
+    pub snapshot_index: Option<u64>,
+    pub purged_index: Option<u64>,
+    /// Number of raft log entries not purged yet.
+    pub log_entries: u64,
+}
+
 pub struct HttpServer {
     pub node: Arc<RaftNode>,
     pub storage: Arc<RwLock<StateMachine>>,
@@ -38,6 +53,8 @@ impl HttpServer {
             .or(self.debug_pprof())
             .or(self.debug_backtrace())
             .or(self.is_initialized())
+            .or(self.status())
+            .or(self.api_routes())
     }
 
     fn with_raft_node(
@@ -329,6 +346,49 @@ impl HttpServer {
             })
     }
 
+    // curl http://127.0.0.1:8901/meta/status
+    fn status(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("meta" / "status")
+            .and(warp::get())
+            .and(self.with_raft_node())
+            .and_then(|node: Arc<RaftNode>| async move {
+                let status = Self::process_status(node).await.map_err(|e| {
+                    error!("meta status error: {:?}", e);
+                    warp::reject::custom(e)
+                })?;
+
+                Ok::<_, warp::Rejection>(warp::reply::json(&status))
+            })
+    }
+
+    pub async fn process_status(node: Arc<RaftNode>) -> MetaResult<MetaStatus> {
+        let metrics = node.metrics().await?;
+        let raft = metrics.raft;
+        let purged_index = raft.purged.map(|id| id.index);
+        // All logs are purged if the last log is the purged one.
+        let log_entries = match raft.last_log_index {
+            Some(last) if Some(last) != purged_index => {
+                let entries = &metrics.entries;
+                entries.max_seq.saturating_sub(entries.min_seq) + 1
+            }
+            _ => 0,
+        };
+
+        Ok(MetaStatus {
+            node_id: raft.id,
+            state: format!("{:?}", raft.state),
+            current_term: raft.current_term,
+            current_leader: raft.current_leader,
+            last_log_index: raft.last_log_index,
+            last_applied_index: raft.last_applied.map(|id| id.index),
+            snapshot_index: raft.snapshot.map(|id| id.index),
+            purged_index,
+            log_entries,
+        })
+    }
+
     pub async fn process_watch(
         req: hyper::body::Bytes,
         storage: Arc<RwLock<StateMachine>>,
@@ -0,0 +1,604 @@
+//! JSON admin api of meta data, for orchestration tools to manage tenants,
+//! databases and users declaratively.
+//!
+//! GET    /api/v1/{cluster}/tenants
+//! GET    /api/v1/{cluster}/tenants/{tenant}/databases
+//! POST   /api/v1/{cluster}/tenants/{tenant}/databases         [CreateDatabaseRequest]
+//! GET    /api/v1/{cluster}/tenants/{tenant}/databases/{db}
+//! PUT    /api/v1/{cluster}/tenants/{tenant}/databases/{db}    [DatabaseOptions]
+//! DELETE /api/v1/{cluster}/tenants/{tenant}/databases/{db}
+//! GET    /api/v1/{cluster}/users
+//! POST   /api/v1/{cluster}/users                              [UserRequest]
+//! GET    /api/v1/{cluster}/users/{name}
+//! PUT    /api/v1/{cluster}/users/{name}                       [UserRequest]
+//! DELETE /api/v1/{cluster}/users/{name}
+
+use std::sync::Arc;
+
+use models::auth::user::{UserDesc, UserOptions, UserOptionsBuilder};
+use models::oid::{Identifier, UuidGenerator};
+use models::schema::database_schema::{DatabaseConfig, DatabaseOptions, DatabaseSchema};
+use models::schema::resource_info::{ResourceInfo, ResourceOperator, ResourceStatus};
+use models::schema::tenant::Tenant;
+use models::utils::now_timestamp_millis;
+use replication::raft_node::RaftNode;
+use serde::de::DeserializeOwned;
+use serde::{Deserialize, Serialize};
+use tokio::sync::RwLock;
+use tracing::error;
+use warp::http::StatusCode;
+use warp::{hyper, Filter};
+
+use super::http::HttpServer;
+use crate::error::{MetaError, MetaResult};
+use crate::store::command::WriteCommand;
+use crate::store::key_path::KeyPath;
+use crate::store::storage::StateMachine;
+
+#[derive(Debug, Deserialize)]
+pub struct CreateDatabaseRequest {
+    pub name: String,
+    #[serde(default)]
+    pub options: DatabaseOptions,
+    #[serde(default)]
+    pub config: DatabaseConfig,
+}
+
+#[derive(Debug, Default, Deserialize)]
+pub struct UserRequest {
+    /// Required when creating user.
+    pub name: Option<String>,
+    pub password: Option<String>,
+    pub must_change_password: Option<bool>,
+    pub comment: Option<String>,
+    pub granted_admin: Option<bool>,
+}
+
+impl UserRequest {
+    fn user_options(&self) -> MetaResult<UserOptions> {
+        let mut builder = UserOptionsBuilder::default();
+        if let Some(password) = &self.password {
+            builder
+                .password(password)
+                .map_err(|e| MetaError::CommonError { msg: e.to_string() })?;
+        }
+        if let Some(must_change_password) = self.must_change_password {
+            builder.must_change_password(must_change_password);
+        }
+        if let Some(comment) = &self.comment {
+            builder.comment(comment.clone());
+        }
+        if let Some(granted_admin) = self.granted_admin {
+            builder.granted_admin(granted_admin);
+        }
+
+        let mut options = builder
+            .build()
+            .map_err(|e| MetaError::CommonError { msg: e.to_string() })?;
+        options.stamp_password_changed_at(now_timestamp_millis());
+        Ok(options)
+    }
+}
+
+#[derive(Debug, Serialize)]
+struct ErrorResponse {
+    error_code: String,
+    error_message: String,
+}
+
+type ApiReply = warp::reply::WithStatus<warp::reply::Json>;
+
+/// The users are never replied with their hashed passwords, the api is not
+/// authenticated.
+fn hidden_password(mut user: UserDesc) -> UserDesc {
+    user.hidden_password();
+    user
+}
+
+fn json_reply<T: Serialize>(result: MetaResult<T>, ok_status: StatusCode) -> ApiReply {
+    match result {
+        Ok(data) => warp::reply::with_status(warp::reply::json(&data), ok_status),
+        Err(err) => {
+            let status = match &err {
+                MetaError::TenantNotFound { .. }
+                | MetaError::DatabaseNotFound { .. }
+                | MetaError::UserNotFound { .. } => StatusCode::NOT_FOUND,
+                MetaError::TenantAlreadyExists { .. }
+                | MetaError::DatabaseAlreadyExists { .. }
+                | MetaError::UserAlreadyExists { .. } => StatusCode::CONFLICT,
+                MetaError::SerdeMsgInvalid { .. } | MetaError::CommonError { .. } => {
+                    StatusCode::BAD_REQUEST
+                }
+                _ => StatusCode::INTERNAL_SERVER_ERROR,
+            };
+            let body = ErrorResponse {
+                error_code: err.error_code().code().to_string(),
+                error_message: err.to_string(),
+            };
+            warp::reply::with_status(warp::reply::json(&body), status)
+        }
+    }
+}
+
+fn parse_body<T: DeserializeOwned>(body: &[u8]) -> MetaResult<T> {
+    serde_json::from_slice(body).map_err(|e| MetaError::SerdeMsgInvalid { err: e.to_string() })
+}
+
+impl HttpServer {
+    pub fn api_routes(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        self.api_list_tenants()
+            .or(self.api_list_databases())
+            .or(self.api_create_database())
+            .or(self.api_get_database())
+            .or(self.api_alter_database())
+            .or(self.api_drop_database())
+            .or(self.api_list_users())
+            .or(self.api_create_user())
+            .or(self.api_get_user())
+            .or(self.api_alter_user())
+            .or(self.api_drop_user())
+    }
+
+    fn with_api_node(
+        &self,
+    ) -> impl Filter<Extract = (Arc<RaftNode>,), Error = std::convert::Infallible> + Clone {
+        let node = self.node.clone();
+        warp::any().map(move || node.clone())
+    }
+
+    fn with_api_storage(
+        &self,
+    ) -> impl Filter<Extract = (Arc<RwLock<StateMachine>>,), Error = std::convert::Infallible> + Clone
+    {
+        let storage = self.storage.clone();
+        warp::any().map(move || storage.clone())
+    }
+
+    fn api_list_tenants(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "tenants")
+            .and(warp::get())
+            .and(self.with_api_storage())
+            .then(
+                |cluster: String, storage: Arc<RwLock<StateMachine>>| async move {
+                    let result = storage.read().await.process_read_tenants(&cluster);
+                    json_reply(result, StatusCode::OK)
+                },
+            )
+    }
+
+    fn api_list_databases(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "tenants" / String / "databases")
+            .and(warp::get())
+            .and(self.with_api_storage())
+            .then(
+                |cluster: String, tenant: String, storage: Arc<RwLock<StateMachine>>| async move {
+                    let result = Self::api_read_databases(&storage, &cluster, &tenant).await;
+                    json_reply(result, StatusCode::OK)
+                },
+            )
+    }
+
+    fn api_create_database(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "tenants" / String / "databases")
+            .and(warp::post())
+            .and(warp::body::bytes())
+            .and(self.with_api_storage())
+            .and(self.with_api_node())
+            .then(
+                |cluster: String,
+                 tenant: String,
+                 body: hyper::body::Bytes,
+                 storage: Arc<RwLock<StateMachine>>,
+                 node: Arc<RaftNode>| async move {
+                    let result = async {
+                        let req: CreateDatabaseRequest = parse_body(&body)?;
+                        Self::api_read_tenant(&storage, &cluster, &tenant).await?;
+                        let schema = DatabaseSchema::new(
+                            &tenant,
+                            &req.name,
+                            req.options,
+                            Arc::new(req.config),
+                        );
+                        let cmd = WriteCommand::CreateDB(cluster, tenant, schema.clone());
+                        Self::api_write::<serde_json::Value>(&node, &cmd).await?;
+                        Ok(schema)
+                    }
+                    .await;
+                    json_reply(result, StatusCode::CREATED)
+                },
+            )
+    }
+
+    fn api_get_database(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "tenants" / String / "databases" / String)
+            .and(warp::get())
+            .and(self.with_api_storage())
+            .then(
+                |cluster: String,
+                 tenant: String,
+                 db: String,
+                 storage: Arc<RwLock<StateMachine>>| async move {
+                    let result = Self::api_read_database(&storage, &cluster, &tenant, &db).await;
+                    json_reply(result, StatusCode::OK)
+                },
+            )
+    }
+
+    /// Replace options of the database, the unmodifiable config is kept.
+    fn api_alter_database(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "tenants" / String / "databases" / String)
+            .and(warp::put())
+            .and(warp::body::bytes())
+            .and(self.with_api_storage())
+            .and(self.with_api_node())
+            .then(
+                |cluster: String,
+                 tenant: String,
+                 db: String,
+                 body: hyper::body::Bytes,
+                 storage: Arc<RwLock<StateMachine>>,
+                 node: Arc<RaftNode>| async move {
+                    let result = async {
+                        let options: DatabaseOptions = parse_body(&body)?;
+                        let mut schema =
+                            Self::api_read_database(&storage, &cluster, &tenant, &db).await?;
+                        schema.options = options;
+                        let cmd = WriteCommand::AlterDB(cluster, tenant, schema.clone());
+                        Self::api_write::<serde_json::Value>(&node, &cmd).await?;
+                        Ok(schema)
+                    }
+                    .await;
+                    json_reply(result, StatusCode::OK)
+                },
+            )
+    }
+
+    /// Same as `DROP DATABASE`: hide the database, then schedule a task for
+    /// data nodes to remove its data and meta.
+    fn api_drop_database(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "tenants" / String / "databases" / String)
+            .and(warp::delete())
+            .and(self.with_api_storage())
+            .and(self.with_api_node())
+            .then(
+                |cluster: String,
+                 tenant: String,
+                 db: String,
+                 storage: Arc<RwLock<StateMachine>>,
+                 node: Arc<RaftNode>| async move {
+                    let result = async {
+                        let tenant_info =
+                            Self::api_read_tenant(&storage, &cluster, &tenant).await?;
+                        Self::api_read_database(&storage, &cluster, &tenant, &db).await?;
+                        let (execute_node_id, _) = storage
+                            .read()
+                            .await
+                            .process_read_resourceinfos_mark(&cluster)?;
+
+                        let cmd = WriteCommand::SetDBIsHidden(
+                            cluster.clone(),
+                            tenant.clone(),
+                            db.clone(),
+                            true,
+                        );
+                        Self::api_write::<serde_json::Value>(&node, &cmd).await?;
+
+                        let name = format!("{}-{}", tenant, db);
+                        let mut resource_info = ResourceInfo::new(
+                            (*tenant_info.id(), db.clone()),
+                            name.clone(),
+                            ResourceOperator::DropDatabase(tenant, db),
+                            &None,
+                            execute_node_id,
+                        );
+                        resource_info.set_status(ResourceStatus::Schedule);
+                        let cmd = WriteCommand::ResourceInfo(cluster, name, resource_info);
+                        Self::api_write::<serde_json::Value>(&node, &cmd).await?;
+                        Ok(())
+                    }
+                    .await;
+                    json_reply(result, StatusCode::ACCEPTED)
+                },
+            )
+    }
+
+    fn api_list_users(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "users")
+            .and(warp::get())
+            .and(self.with_api_storage())
+            .then(
+                |cluster: String, storage: Arc<RwLock<StateMachine>>| async move {
+                    let result = Self::api_read_users(&storage, &cluster).await;
+                    json_reply(result, StatusCode::OK)
+                },
+            )
+    }
+
+    fn api_create_user(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "users")
+            .and(warp::post())
+            .and(warp::body::bytes())
+            .and(self.with_api_node())
+            .then(
+                |cluster: String, body: hyper::body::Bytes, node: Arc<RaftNode>| async move {
+                    let result = async {
+                        let req: UserRequest = parse_body(&body)?;
+                        let name = req.name.clone().ok_or_else(|| MetaError::CommonError {
+                            msg: "user name is required".to_string(),
+                        })?;
+                        let options = req.user_options()?;
+                        let oid = UuidGenerator::default().next_id();
+                        let user_desc = UserDesc::new(oid, name, options, false);
+                        let cmd = WriteCommand::CreateUser(cluster, user_desc.clone());
+                        Self::api_write::<serde_json::Value>(&node, &cmd).await?;
+                        Ok(hidden_password(user_desc))
+                    }
+                    .await;
+                    json_reply(result, StatusCode::CREATED)
+                },
+            )
+    }
+
+    fn api_get_user(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "users" / String)
+            .and(warp::get())
+            .and(self.with_api_storage())
+            .then(
+                |cluster: String, name: String, storage: Arc<RwLock<StateMachine>>| async move {
+                    let result = Self::api_read_user(&storage, &cluster, &name).await;
+                    json_reply(result.map(hidden_password), StatusCode::OK)
+                },
+            )
+    }
+
+    /// Merge the given options into the user, absent fields are unchanged.
+    fn api_alter_user(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "users" / String)
+            .and(warp::put())
+            .and(warp::body::bytes())
+            .and(self.with_api_storage())
+            .and(self.with_api_node())
+            .then(
+                |cluster: String,
+                 name: String,
+                 body: hyper::body::Bytes,
+                 storage: Arc<RwLock<StateMachine>>,
+                 node: Arc<RaftNode>| async move {
+                    let result = async {
+                        let req: UserRequest = parse_body(&body)?;
+                        Self::api_read_user(&storage, &cluster, &name).await?;
+                        let options = req.user_options()?;
+                        let cmd = WriteCommand::AlterUser(cluster.clone(), name.clone(), options);
+                        Self::api_write::<serde_json::Value>(&node, &cmd).await?;
+                        Self::api_read_user(&storage, &cluster, &name)
+                            .await
+                            .map(hidden_password)
+                    }
+                    .await;
+                    json_reply(result, StatusCode::OK)
+                },
+            )
+    }
+
+    fn api_drop_user(
+        &self,
+    ) -> impl Filter<Extract = (impl warp::Reply,), Error = warp::Rejection> + Clone {
+        warp::path!("api" / "v1" / String / "users" / String)
+            .and(warp::delete())
+            .and(self.with_api_storage())
+            .and(self.with_api_node())
+            .then(
+                |cluster: String,
+                 name: String,
+                 storage: Arc<RwLock<StateMachine>>,
+                 node: Arc<RaftNode>| async move {
+                    let result = async {
+                        let user = Self::api_read_user(&storage, &cluster, &name).await?;
+                        if user.is_root_admin() {
+                            return Err(MetaError::CommonError {
+                                msg: format!("can not drop root user {}", name),
+                            });
+                        }
+                        let cmd = WriteCommand::DropUser(cluster, name);
+                        Self::api_write::<bool>(&node, &cmd).await?;
+                        Ok(())
+                    }
+                    .await;
+                    json_reply(result, StatusCode::OK)
+                },
+            )
+    }
+
+    async fn api_read_tenant(
+        storage: &RwLock<StateMachine>,
+        cluster: &str,
+        tenant: &str,
+    ) -> MetaResult<Tenant> {
+        storage
+            .read()
+            .await
+            .process_read_tenant(cluster, tenant, false)?
+            .ok_or_else(|| MetaError::TenantNotFound {
+                tenant: tenant.to_string(),
+            })
+    }
+
+    async fn api_read_databases(
+        storage: &RwLock<StateMachine>,
+        cluster: &str,
+        tenant: &str,
+    ) -> MetaResult<Vec<DatabaseSchema>> {
+        Self::api_read_tenant(storage, cluster, tenant).await?;
+        let mut dbs: Vec<DatabaseSchema> = storage
+            .read()
+            .await
+            .children_data::<DatabaseSchema>(&KeyPath::tenant_dbs(cluster, tenant))?
+            .into_values()
+            .filter(|schema| !schema.is_hidden())
+            .collect();
+        dbs.sort_by(|a, b| a.database_name().cmp(b.database_name()));
+
+        Ok(dbs)
+    }
+
+    async fn api_read_database(
+        storage: &RwLock<StateMachine>,
+        cluster: &str,
+        tenant: &str,
+        db: &str,
+    ) -> MetaResult<DatabaseSchema> {
+        Self::api_read_tenant(storage, cluster, tenant).await?;
+        storage
+            .read()
+            .await
+            .get_struct::<DatabaseSchema>(&KeyPath::tenant_db_name(cluster, tenant, db))?
+            .filter(|schema| !schema.is_hidden())
+            .ok_or_else(|| MetaError::DatabaseNotFound {
+                database: db.to_string(),
+            })
+    }
+
+    /// The users without their hashed passwords.
+    async fn api_read_users(
+        storage: &RwLock<StateMachine>,
+        cluster: &str,
+    ) -> MetaResult<Vec<UserDesc>> {
+        let users = storage.read().await.process_read_users(cluster)?;
+        Ok(users.into_iter().map(hidden_password).collect())
+    }
+
+    async fn api_read_user(
+        storage: &RwLock<StateMachine>,
+        cluster: &str,
+        name: &str,
+    ) -> MetaResult<UserDesc> {
+        storage
+            .read()
+            .await
+            .get_struct::<UserDesc>(&KeyPath::user(cluster, name))?
+            .ok_or_else(|| MetaError::UserNotFound {
+                user: name.to_string(),
+            })
+    }
+
+    /// Write through raft, only the leader accepts writes.
+    async fn api_write<T: DeserializeOwned>(node: &RaftNode, cmd: &WriteCommand) -> MetaResult<T> {
+        let data = serde_json::to_vec(cmd)?;
+        let rsp = node.raw_raft().client_write(data).await.map_err(|err| {
+            error!("meta api write error: {:?}", err);
+            if let Some(openraft::error::ForwardToLeader {
+                leader_node: Some(leader_node),
+                ..
+            }) = err.forward_to_leader()
+            {
+                MetaError::CommonError {
+                    msg: format!("not leader, send request to {}", leader_node.address),
+                }
+            } else {
+                MetaError::CommonError {
+                    msg: err.to_string(),
+                }
+            }
+        })?;
+
+        let rsp = String::from_utf8_lossy(&rsp.data);
+        serde_json::from_str::<MetaResult<T>>(&rsp)
+            .map_err(|e| MetaError::SerdeMsgInvalid { err: e.to_string() })?
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use models::auth::user::{UserDesc, UserOptionsBuilder};
+    use models::oid::{Identifier, UuidGenerator};
+    use tokio::sync::RwLock;
+    use warp::http::StatusCode;
+    use warp::{hyper, Reply};
+
+    use super::{hidden_password, json_reply, UserRequest};
+    use crate::service::http::HttpServer;
+    use crate::store::command::WriteCommand;
+    use crate::store::storage::StateMachine;
+
+    #[tokio::test]
+    async fn test_users_without_password() {
+        let dir = "/tmp/test/meta/http_api/users_without_password";
+        let _ = std::fs::remove_dir_all(dir);
+        let storage = StateMachine::open(dir, 16 * 1024 * 1024).unwrap();
+        let cluster = "cluster_xxx";
+
+        let hash = "$2b$12$R9h/cIPz0gi.URNNX3kh2OPST9/PgBkqquzi.Ss7KIUgO2t0jWMUW";
+        let options = UserOptionsBuilder::default()
+            .hash_password(hash)
+            .build()
+            .unwrap();
+        let user = UserDesc::new(
+            UuidGenerator::default().next_id(),
+            "u1".to_string(),
+            options,
+            false,
+        );
+        storage
+            .process_write_command(&WriteCommand::CreateUser(cluster.to_string(), user))
+            .await;
+        let storage = RwLock::new(storage);
+
+        let body = |reply: super::ApiReply| async move {
+            let body = hyper::body::to_bytes(reply.into_response().into_body())
+                .await
+                .unwrap();
+            String::from_utf8(body.to_vec()).unwrap()
+        };
+
+        let users = HttpServer::api_read_users(&storage, cluster).await;
+        assert_eq!(users.as_ref().unwrap().len(), 1);
+        let listed = body(json_reply(users, StatusCode::OK)).await;
+        assert!(listed.contains("u1"), "{}", listed);
+        assert!(!listed.contains(hash), "{}", listed);
+
+        let user = HttpServer::api_read_user(&storage, cluster, "u1").await;
+        let read = body(json_reply(user.map(hidden_password), StatusCode::OK)).await;
+        assert!(read.contains("u1"), "{}", read);
+        assert!(!read.contains(hash), "{}", read);
+    }
+
+    #[test]
+    fn test_user_request_options() {
+        let req: UserRequest = serde_json::from_str(
+            r#"{"name": "u1", "password": "secret", "comment": "ops", "granted_admin": true}"#,
+        )
+        .unwrap();
+        let options = req.user_options().unwrap();
+        assert_ne!(options.hash_password(), Some("secret"));
+        assert!(options.hash_password().is_some());
+        assert_eq!(options.comment(), Some("ops"));
+        assert_eq!(options.granted_admin(), Some(true));
+        assert_eq!(options.must_change_password(), None);
+
+        let req: UserRequest = serde_json::from_str(r#"{"comment": "dev"}"#).unwrap();
+        let options = req.user_options().unwrap();
+        assert!(options.hash_password().is_none());
+    }
+}
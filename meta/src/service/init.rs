@@ -1,3 +1,4 @@
+use models::auth::bcrypt_hash;
 use models::auth::user::{UserDesc, UserOptionsBuilder};
 use models::schema::database_schema::{DatabaseConfig, DatabaseOptions, DatabaseSchema};
 use models::schema::tenant::{Tenant, TenantOptionsBuilder};
@@ -59,8 +60,8 @@ impl MetaInit {
         // init user
         let user_opt = UserOptionsBuilder::default()
             .must_change_password(true)
-            .password(self.admin_pwd)
-            .expect("failed to init user option.")
+            // the initial password is not restricted by the password policy
+            .hash_password(bcrypt_hash(&self.admin_pwd).expect("failed to init user option."))
             .comment("system admin")
             .build()
             .expect("failed to init user option.");
@@ -1,4 +1,5 @@
 pub mod http;
+pub mod http_api;
 pub mod init;
 pub mod server;
 pub mod single;
@@ -61,7 +61,7 @@ pub async fn start_raft_node(opt: config::meta::Opt) -> MetaResult<()> {
         raft_logs_to_keep: opt.cluster.raft_logs_to_keep,
         send_append_entries_timeout: opt.cluster.send_append_entries_timeout,
         install_snapshot_timeout: opt.cluster.install_snapshot_timeout,
-        snapshot_policy: SnapshotPolicy::LogsSinceLast(opt.cluster.raft_logs_to_keep),
+        snapshot_policy: SnapshotPolicy::LogsSinceLast(opt.cluster.snapshot_logs_since_last),
     };
 
     let mut db_opt = DatabaseOptions::default();
@@ -113,12 +113,44 @@ pub async fn start_raft_node(opt: config::meta::Opt) -> MetaResult<()> {
         opt.heartbeat.clone(),
     ));
 
+    if opt.cluster.snapshot_interval > 0 {
+        tokio::spawn(trigger_snapshot_service(
+            node.clone(),
+            Duration::from_secs(opt.cluster.snapshot_interval),
+        ));
+    }
+
     let bind_addr = models::utils::build_address("0.0.0.0", opt.global.listen_port);
     tokio::spawn(start_warp_grpc_server(bind_addr, node, engine));
 
     Ok(())
 }
 
+/// Snapshot (then purge logs) periodically, so that a meta node with few
+/// writes does not keep the logs forever waiting for `snapshot_logs_since_last`.
+async fn trigger_snapshot_service(node: RaftNode, interval: Duration) {
+    let mut ticker = tokio::time::interval(interval);
+    ticker.tick().await;
+    loop {
+        ticker.tick().await;
+
+        let metrics = node.raft_metrics();
+        let applied = metrics.last_applied.map(|id| id.index);
+        let snapshot = metrics.snapshot.map(|id| id.index);
+        if applied <= snapshot {
+            continue;
+        }
+
+        info!(
+            "trigger meta snapshot, last applied: {:?}, last snapshot: {:?}",
+            applied, snapshot
+        );
+        if let Err(err) = node.raw_raft().trigger().snapshot().await {
+            warn!("trigger meta snapshot failed: {}", err);
+        }
+    }
+}
+
 async fn detect_node_heartbeat(
     node: RaftNode,
     storage: Arc<RwLock<StateMachine>>,
@@ -8,6 +8,7 @@ use models::auth::user::{UserDesc, UserOptions};
 use models::meta_data::*;
 use models::oid::Oid;
 use models::schema::database_schema::DatabaseSchema;
+use models::schema::materialized_view::{MaterializedView, StaleRange};
 use models::schema::query_info::QueryInfo;
 use models::schema::resource_info::ResourceInfo;
 use models::schema::table_schema::TableSchema;
@@ -64,6 +65,12 @@ pub enum WriteCommand {
     //cluster, node metrics
     ReportNodeMetrics(String, NodeMetrics),
 
+    // cluster, node_id, cordon
+    CordonDataNode(String, NodeId, bool),
+
+    // cluster, node_id
+    RemoveDataNode(String, NodeId),
+
     // cluster, tenant, db schema
     CreateDB(String, String, DatabaseSchema),
 
@@ -73,6 +80,15 @@ pub enum WriteCommand {
     // cluster, tenant, db, db_is_hidden
     SetDBIsHidden(String, String, String, bool),
 
+    // cluster, tenant, db, view
+    CreateMaterializedView(String, String, String, MaterializedView),
+    // cluster, tenant, db, view name
+    DropMaterializedView(String, String, String, String),
+    // cluster, tenant, db, (view name, range)
+    MarkMaterializedViews(String, String, String, Vec<(String, StaleRange)>),
+    // cluster, tenant, db, view name, ranges refreshed
+    ClearMaterializedView(String, String, String, String, Vec<StaleRange>),
+
     // cluster, tenant, db name
     DropDB(String, String, String),
 
@@ -82,6 +98,9 @@ pub enum WriteCommand {
     // cluster, tenant, db name, id
     DeleteBucket(String, String, String, u32),
 
+    // cluster, tenant, db name, id
+    SplitBucket(String, String, String, u32),
+
     // cluster, tenant, table schema
     CreateTable(String, String, TableSchema),
     UpdateTable(String, String, TableSchema),
@@ -153,6 +172,12 @@ pub enum WriteCommand {
 
     // cluster, source_node_id, dest_node_id
     MoveQueryInfo(String, NodeId, NodeId),
+
+    // cluster, limit
+    SetRuntimeLimit(String, RuntimeLimit),
+
+    // cluster, node_id, usages by database owner
+    ReportDatabaseUsages(String, NodeId, HashMap<String, DatabaseUsage>),
 }
 
 /******************* read command *************************/
@@ -198,6 +223,12 @@ pub enum ReadCommand {
 
     // cluster, tenant, db, table
     ReadTableSchema(String, String, String, String),
+
+    // cluster
+    RuntimeLimits(String),
+
+    // cluster
+    DatabaseUsages(String),
 }
 
 pub const ENTRY_LOG_TYPE_SET: i32 = 1;
@@ -8,6 +8,8 @@ use models::oid::Oid;
 // **    /cluster_name/tenants/tenant/limiter ->
 // **    /cluster_name/auto_incr_id -> id
 // **    /cluster_name/data_nodes/node_id -> [NodeInfo] 集群、数据节点等信息
+// **    /cluster_name/runtime_limits -> [RuntimeLimits]
+// **    /cluster_name/database_usages/node_id -> [HashMap<String, DatabaseUsage>]
 
 // **    /cluster_name/tenant_name/dbs/db_name -> [DatabaseInfo] db相关信息、保留策略等
 // **    /cluster_name/tenant_name/dbs/db_name/buckets/id -> [BucketInfo] bucket相关信息
@@ -26,6 +28,8 @@ pub const AUTO_INCR_ID: &str = "auto_incr_id";
 pub const DATA_NODES_METRICS: &str = "data_nodes_metrics";
 pub const RESOURCE_INFOS: &str = "resourceinfos";
 pub const RESOURCE_INFOS_MARK: &str = "resourceinfosmark";
+pub const RUNTIME_LIMITS: &str = "runtime_limits";
+pub const DATABASE_USAGES: &str = "database_usages";
 
 pub struct KeyPath {}
 
@@ -147,4 +151,16 @@ impl KeyPath {
     pub fn queries(cluster: &str) -> String {
         format!("/{}/queries", cluster)
     }
+
+    pub fn runtime_limits(cluster: &str) -> String {
+        format!("/{}/{}", cluster, RUNTIME_LIMITS)
+    }
+
+    pub fn database_usages(cluster: &str) -> String {
+        format!("/{}/{}", cluster, DATABASE_USAGES)
+    }
+
+    pub fn database_usage(cluster: &str, node_id: u64) -> String {
+        format!("/{}/{}/{}", cluster, DATABASE_USAGES, node_id)
+    }
 }
@@ -3,13 +3,16 @@ use std::collections::{BTreeMap, HashMap, HashSet};
 use std::fs;
 use std::path::Path;
 use std::sync::Arc;
+use std::time::Duration;
 
 use models::auth::privilege::DatabasePrivilege;
 use models::auth::role::{CustomTenantRole, SystemTenantRole, TenantRoleIdentifier};
 use models::auth::user::{UserDesc, UserOptions};
 use models::meta_data::*;
+use models::node_info::NodeStatus;
 use models::oid::{Identifier, Oid, UuidGenerator};
 use models::schema::database_schema::DatabaseSchema;
+use models::schema::materialized_view::MaterializedView;
 use models::schema::query_info::QueryInfo;
 use models::schema::resource_info::ResourceInfo;
 use models::schema::table_schema::TableSchema;
@@ -20,6 +23,7 @@ use serde::{Deserialize, Serialize};
 use snafu::ResultExt;
 use trace::{debug, error, info};
 use tracing::warn;
+use utils::duration::CnosDuration;
 
 use super::command::*;
 use super::key_path;
@@ -468,7 +472,35 @@ impl StateMachine {
             ReadCommand::ReadTableSchema(cluster, tenant, db_name, table_name) => {
                 response_encode(self.process_read_table(cluster, tenant, db_name, table_name))
             }
+            ReadCommand::RuntimeLimits(cluster) => {
+                response_encode(self.process_read_runtime_limits(cluster))
+            }
+            ReadCommand::DatabaseUsages(cluster) => {
+                response_encode(self.process_read_database_usages(cluster))
+            }
+        }
+    }
+
+    pub fn process_read_runtime_limits(&self, cluster: &str) -> MetaResult<RuntimeLimits> {
+        let key = KeyPath::runtime_limits(cluster);
+        let limits = self.get_struct::<RuntimeLimits>(&key)?.unwrap_or_default();
+
+        Ok(limits)
+    }
+
+    pub fn process_read_database_usages(
+        &self,
+        cluster: &str,
+    ) -> MetaResult<HashMap<NodeId, HashMap<String, DatabaseUsage>>> {
+        let path = KeyPath::database_usages(cluster);
+        let mut usages = HashMap::new();
+        for (key, val) in self.children_data::<HashMap<String, DatabaseUsage>>(&path)? {
+            if let Ok(node_id) = key.parse::<NodeId>() {
+                usages.insert(node_id, val);
+            }
         }
+
+        Ok(usages)
     }
 
     pub fn process_read_queries(
@@ -671,6 +703,12 @@ impl StateMachine {
             WriteCommand::ReportNodeMetrics(cluster, node_metrics) => {
                 response_encode(self.process_add_node_metrics(cluster, node_metrics))
             }
+            WriteCommand::CordonDataNode(cluster, node_id, cordon) => {
+                response_encode(self.process_cordon_data_node(cluster, *node_id, *cordon))
+            }
+            WriteCommand::RemoveDataNode(cluster, node_id) => {
+                response_encode(self.process_remove_data_node(cluster, *node_id))
+            }
             WriteCommand::CreateDB(cluster, tenant, schema) => {
                 response_encode(self.process_create_db(cluster, tenant, schema))
             }
@@ -680,6 +718,35 @@ impl StateMachine {
             WriteCommand::SetDBIsHidden(cluster, tenant, db, db_is_hidden) => {
                 response_encode(self.process_db_is_hidden(cluster, tenant, db, *db_is_hidden))
             }
+            WriteCommand::CreateMaterializedView(cluster, tenant, db, view) => {
+                response_encode(self.process_create_materialized_view(cluster, tenant, db, view))
+            }
+            WriteCommand::DropMaterializedView(cluster, tenant, db, name) => response_encode(
+                self.process_alter_materialized_views(cluster, tenant, db, |schema| {
+                    schema.remove_materialized_view(name);
+                }),
+            ),
+            WriteCommand::MarkMaterializedViews(cluster, tenant, db, marks) => response_encode(
+                self.process_alter_materialized_views(cluster, tenant, db, |schema| {
+                    for (name, range) in marks {
+                        if let Some(view) = schema.materialized_view_mut(name) {
+                            view.mark_stale(*range);
+                        }
+                    }
+                }),
+            ),
+            WriteCommand::ClearMaterializedView(cluster, tenant, db, name, refreshed) => {
+                response_encode(self.process_alter_materialized_views(
+                    cluster,
+                    tenant,
+                    db,
+                    |schema| {
+                        if let Some(view) = schema.materialized_view_mut(name) {
+                            view.clear_stale(refreshed);
+                        }
+                    },
+                ))
+            }
             WriteCommand::DropDB(cluster, tenant, db_name) => {
                 response_encode(self.process_drop_db(cluster, tenant, db_name))
             }
@@ -698,6 +765,9 @@ impl StateMachine {
             WriteCommand::DeleteBucket(cluster, tenant, db, id) => {
                 response_encode(self.process_delete_bucket(cluster, tenant, db, *id))
             }
+            WriteCommand::SplitBucket(cluster, tenant, db, id) => {
+                response_encode(self.process_split_bucket(cluster, tenant, db, *id).await)
+            }
             WriteCommand::CreateUser(cluster, user) => {
                 response_encode(self.process_create_user(cluster, user))
             }
@@ -803,9 +873,39 @@ impl StateMachine {
             WriteCommand::MoveQueryInfo(cluster, source_node_id, dest_node_id) => response_encode(
                 self.process_move_queryinfo(cluster, *source_node_id, *dest_node_id),
             ),
+            WriteCommand::SetRuntimeLimit(cluster, limit) => {
+                response_encode(self.process_set_runtime_limit(cluster, limit))
+            }
+            WriteCommand::ReportDatabaseUsages(cluster, node_id, usages) => {
+                response_encode(self.process_report_database_usages(cluster, *node_id, usages))
+            }
         }
     }
 
+    fn process_set_runtime_limit(
+        &self,
+        cluster: &str,
+        limit: &RuntimeLimit,
+    ) -> MetaResult<RuntimeLimits> {
+        let mut limits = self.process_read_runtime_limits(cluster)?;
+        limits.apply(limit.clone());
+
+        let key = KeyPath::runtime_limits(cluster);
+        self.insert(&key, &value_encode(&limits)?)?;
+
+        Ok(limits)
+    }
+
+    fn process_report_database_usages(
+        &self,
+        cluster: &str,
+        node_id: NodeId,
+        usages: &HashMap<String, DatabaseUsage>,
+    ) -> MetaResult<()> {
+        let key = KeyPath::database_usage(cluster, node_id);
+        self.insert(&key, &value_encode(usages)?)
+    }
+
     fn process_move_queryinfo(
         &self,
         cluster: &str,
@@ -992,10 +1092,81 @@ impl StateMachine {
         node_metrics: &NodeMetrics,
     ) -> MetaResult<()> {
         let key = KeyPath::data_node_metrics(cluster, node_metrics.id);
-        let value = value_encode(node_metrics)?;
+        // a cordoned node keeps its status until it is uncordoned or removed,
+        // so no new vnodes are placed on it while it is being drained.
+        let mut node_metrics = node_metrics.clone();
+        if let Some(old) = self.get_struct::<NodeMetrics>(&key)? {
+            if old.status == NodeStatus::Cordon {
+                node_metrics.status = NodeStatus::Cordon;
+            }
+        }
+        let value = value_encode(&node_metrics)?;
         self.insert(&key, &value)
     }
 
+    fn process_cordon_data_node(
+        &self,
+        cluster: &str,
+        node_id: NodeId,
+        cordon: bool,
+    ) -> MetaResult<()> {
+        if !self.contains_key(&KeyPath::data_node_id(cluster, node_id))? {
+            return Err(MetaError::NotFoundNode { id: node_id });
+        }
+
+        let key = KeyPath::data_node_metrics(cluster, node_id);
+        let mut node_metrics =
+            self.get_struct::<NodeMetrics>(&key)?
+                .unwrap_or_else(|| NodeMetrics {
+                    id: node_id,
+                    ..Default::default()
+                });
+        node_metrics.status = if cordon {
+            NodeStatus::Cordon
+        } else {
+            NodeStatus::Healthy
+        };
+        self.insert(&key, &value_encode(&node_metrics)?)
+    }
+
+    fn process_remove_data_node(&self, cluster: &str, node_id: NodeId) -> MetaResult<()> {
+        if !self.contains_key(&KeyPath::data_node_id(cluster, node_id))? {
+            return Err(MetaError::NotFoundNode { id: node_id });
+        }
+
+        let mut vnodes = 0;
+        for tenant in self
+            .children_data::<Tenant>(&KeyPath::tenants(cluster))?
+            .keys()
+        {
+            let data = self.to_tenant_meta_data(cluster, tenant)?;
+            vnodes += data
+                .dbs
+                .values()
+                .flat_map(|db| db.buckets.iter())
+                .flat_map(|bucket| bucket.shard_group.iter())
+                .flat_map(|repl| repl.vnodes.iter())
+                .filter(|vnode| vnode.node_id == node_id)
+                .count();
+        }
+        if vnodes > 0 {
+            return Err(MetaError::DataNodeInUse {
+                id: node_id,
+                vnodes,
+            });
+        }
+
+        for key in [
+            KeyPath::data_node_metrics(cluster, node_id),
+            KeyPath::database_usage(cluster, node_id),
+        ] {
+            if self.contains_key(&key)? {
+                self.remove(&key)?;
+            }
+        }
+        self.remove(&KeyPath::data_node_id(cluster, node_id))
+    }
+
     fn process_drop_db(&self, cluster: &str, tenant: &str, db_name: &str) -> MetaResult<()> {
         let key = KeyPath::tenant_db_name(cluster, tenant, db_name);
         let _ = self.remove(&key);
@@ -1063,8 +1234,57 @@ impl StateMachine {
         }
 
         self.check_db_schema_valid(cluster, schema)?;
-        self.insert(&key, &value_encode(schema)?)?;
+        // the views are changed by their own commands
+        let mut schema = schema.clone();
+        if let Some(stored) = self.get_struct::<DatabaseSchema>(&key)? {
+            schema.keep_materialized_views(&stored);
+        }
+        self.insert(&key, &value_encode(&schema)?)?;
+
+        self.to_tenant_meta_data(cluster, tenant)
+    }
+
+    fn process_create_materialized_view(
+        &self,
+        cluster: &str,
+        tenant: &str,
+        db: &str,
+        view: &MaterializedView,
+    ) -> MetaResult<TenantMetaData> {
+        let key = KeyPath::tenant_db_name(cluster, tenant, db);
+        let Some(mut db_schema) = self.get_struct::<DatabaseSchema>(&key)? else {
+            return Err(MetaError::DatabaseNotFound {
+                database: db.to_string(),
+            });
+        };
+        if db_schema.materialized_view(&view.name).is_some() {
+            return Err(MetaError::CommonError {
+                msg: format!("materialized view {}.{} already exists", db, view.name),
+            });
+        }
+        db_schema.add_materialized_view(view.clone());
+        self.insert(&key, &value_encode(&db_schema)?)?;
+        self.to_tenant_meta_data(cluster, tenant)
+    }
 
+    /// Changes the views of the stored schema, so that the changes of the
+    /// views, e.g. the stale ranges marked by the nodes written, are not
+    /// lost when they are made concurrently.
+    fn process_alter_materialized_views(
+        &self,
+        cluster: &str,
+        tenant: &str,
+        db: &str,
+        alter: impl FnOnce(&mut DatabaseSchema),
+    ) -> MetaResult<TenantMetaData> {
+        let key = KeyPath::tenant_db_name(cluster, tenant, db);
+        let Some(mut db_schema) = self.get_struct::<DatabaseSchema>(&key)? else {
+            return Err(MetaError::DatabaseNotFound {
+                database: db.to_string(),
+            });
+        };
+        alter(&mut db_schema);
+        self.insert(&key, &value_encode(&db_schema)?)?;
         self.to_tenant_meta_data(cluster, tenant)
     }
 
@@ -1089,6 +1309,7 @@ impl StateMachine {
 
     fn check_db_schema_valid(&self, cluster: &str, db_schema: &DatabaseSchema) -> MetaResult<()> {
         let node_list = self.get_valid_node_list(cluster)?;
+        let node_list = db_schema.options.placement().filter_nodes(node_list);
         check_node_enough(db_schema.options.replica(), &node_list)?;
 
         if db_schema.options.shard_num() == 0 {
@@ -1194,6 +1415,7 @@ impl StateMachine {
             })?;
 
         let node_list = self.get_valid_node_list(cluster)?;
+        let node_list = db_schema.options.placement().filter_nodes(node_list);
         let node_list = ping_servers(&node_list).await;
 
         check_node_enough(db_schema.options.replica(), &node_list)?;
@@ -1216,12 +1438,10 @@ impl StateMachine {
             end_time: 0,
             shard_group: vec![],
         };
-        (bucket.start_time, bucket.end_time) = get_time_range(
+        (bucket.start_time, bucket.end_time) = bucket_time_range(
             *ts,
-            db_schema
-                .options
-                .vnode_duration()
-                .to_precision(*db_schema.config.precision()),
+            self.tuned_vnode_duration(cluster, &db_schema, &buckets)?,
+            buckets.values(),
         );
         let (group, used) = allocation_replication_set(
             node_list,
@@ -1238,6 +1458,122 @@ impl StateMachine {
         self.to_tenant_meta_data(cluster, tenant)
     }
 
+    // Halve vnode_duration until the estimated size of the new bucket fits in
+    // max_bucket_size, the ingest volume is estimated by the disk usage of the
+    // database over the time range covered by the existing buckets.
+    fn tuned_vnode_duration(
+        &self,
+        cluster: &str,
+        db_schema: &DatabaseSchema,
+        buckets: &HashMap<String, BucketInfo>,
+    ) -> MetaResult<i64> {
+        let precision = *db_schema.config.precision();
+        let duration = db_schema.options.vnode_duration().to_precision(precision);
+        let max_bucket_size = match db_schema.options.max_bucket_size() {
+            Some(size) => size,
+            None => return Ok(duration),
+        };
+
+        let covered = buckets
+            .values()
+            .map(|b| b.end_time.saturating_sub(b.start_time))
+            .fold(0_i64, |acc, d| acc.saturating_add(d));
+        // every replica of a vnode reports its disk usage
+        let owner = db_schema.owner();
+        let disk_size = self
+            .process_read_database_usages(cluster)?
+            .values()
+            .filter_map(|usages| usages.get(&owner))
+            .map(|usage| usage.disk_size)
+            .sum::<u64>()
+            / db_schema.options.replica().max(1);
+        let min_duration =
+            CnosDuration::new_with_duration(Duration::from_secs(3600)).to_precision(precision);
+
+        Ok(tune_vnode_duration(
+            duration,
+            min_duration,
+            disk_size,
+            covered,
+            max_bucket_size,
+        ))
+    }
+
+    // Create new buckets covering the time range of the bucket by the current
+    // vnode_duration, the old bucket is kept until its data has been moved.
+    // The new buckets created by an interrupted split are reused, so that the
+    // split can be resumed by running it again.
+    async fn process_split_bucket(
+        &self,
+        cluster: &str,
+        tenant: &str,
+        db: &str,
+        id: u32,
+    ) -> MetaResult<TenantMetaData> {
+        let db_path = KeyPath::tenant_db_name(cluster, tenant, db);
+        let db_schema = self
+            .get_struct::<DatabaseSchema>(&db_path)?
+            .ok_or_else(|| MetaError::DatabaseNotFound {
+                database: db.to_string(),
+            })?;
+        let old_bucket = self
+            .get_struct::<BucketInfo>(&KeyPath::tenant_bucket_id(cluster, tenant, db, id))?
+            .ok_or_else(|| MetaError::BucketNotFound { id })?;
+
+        let duration = db_schema
+            .options
+            .vnode_duration()
+            .to_precision(*db_schema.config.precision());
+        if old_bucket.end_time.saturating_sub(old_bucket.start_time) <= duration {
+            return Err(MetaError::NotSupport {
+                msg: format!("bucket {} is not longer than vnode_duration", id),
+            });
+        }
+
+        let buckets =
+            self.children_data::<BucketInfo>(&KeyPath::tenant_db_buckets(cluster, tenant, db))?;
+        if buckets.values().any(|bucket| {
+            bucket.id > id
+                && bucket.start_time >= old_bucket.start_time
+                && bucket.end_time <= old_bucket.end_time
+        }) {
+            return self.to_tenant_meta_data(cluster, tenant);
+        }
+
+        let node_list = self.get_valid_node_list(cluster)?;
+        let node_list = db_schema.options.placement().filter_nodes(node_list);
+        let node_list = ping_servers(&node_list).await;
+        check_node_enough(db_schema.options.replica(), &node_list)?;
+
+        let mut start = old_bucket.start_time;
+        while start < old_bucket.end_time {
+            let (_, end) = get_time_range(start, duration);
+            let end = end.min(old_bucket.end_time);
+
+            let mut bucket = BucketInfo {
+                id: self.fetch_and_add_incr_id(cluster, 1)?,
+                start_time: start,
+                end_time: end,
+                shard_group: vec![],
+            };
+            let (group, used) = allocation_replication_set(
+                node_list.clone(),
+                db_schema.options.shard_num() as u32,
+                db_schema.options.replica() as u32,
+                bucket.id + 1,
+            );
+            bucket.shard_group = group;
+            self.fetch_and_add_incr_id(cluster, used)?;
+
+            let key = KeyPath::tenant_bucket_id(cluster, tenant, db, bucket.id);
+            self.insert(&key, &value_encode(&bucket)?)?;
+
+            start = end;
+        }
+
+        self.to_tenant_meta_data(cluster, tenant)
+    }
+
     fn process_delete_bucket(
         &self,
         cluster: &str,
@@ -1702,12 +2038,361 @@ fn check_node_enough(need: u64, node_list: &[NodeInfo]) -> MetaResult<()> {
     Ok(())
 }
 
+// Halves `duration`, but not under `min_duration`, until `disk_size`
+// written over the time range `covered` fits in `max_bucket_size`.
+fn tune_vnode_duration(
+    duration: i64,
+    min_duration: i64,
+    disk_size: u64,
+    covered: i64,
+    max_bucket_size: u64,
+) -> i64 {
+    if covered <= 0 || disk_size == 0 {
+        return duration;
+    }
+
+    let size_per_unit = disk_size as f64 / covered as f64;
+    let mut tuned = duration;
+    while tuned / 2 >= min_duration && size_per_unit * tuned as f64 > max_bucket_size as f64 {
+        tuned /= 2;
+    }
+
+    tuned
+}
+
+// The time range of the new bucket containing `ts`, clipped by the existing
+// buckets, which may be created by a different duration.
+fn bucket_time_range<'a>(
+    ts: i64,
+    duration: i64,
+    buckets: impl IntoIterator<Item = &'a BucketInfo>,
+) -> (i64, i64) {
+    let (mut start_time, mut end_time) = get_time_range(ts, duration);
+    for bucket in buckets {
+        if bucket.end_time <= ts {
+            start_time = start_time.max(bucket.end_time);
+        } else if bucket.start_time > ts {
+            end_time = end_time.min(bucket.start_time);
+        }
+    }
+
+    (start_time, end_time)
+}
+
 #[cfg(test)]
 mod test {
-    use std::collections::BTreeMap;
+    use std::collections::{BTreeMap, HashMap};
     use std::println;
-
+    use std::sync::Arc;
+    use std::time::Duration;
+
+    use models::meta_data::{BucketInfo, DatabaseUsage, NodeInfo, NodeMetrics};
+    use models::node_info::NodeStatus;
+    use models::schema::database_schema::{
+        DatabaseConfig, DatabaseOptions, DatabasePlacement, DatabaseSchema,
+    };
+    use models::schema::materialized_view::{MaterializedView, StaleRange};
     use serde::{Deserialize, Serialize};
+    use utils::duration::CnosDuration;
+
+    use super::{bucket_time_range, tune_vnode_duration, value_encode, StateMachine};
+    use crate::error::MetaError;
+    use crate::store::command::WriteCommand;
+    use crate::store::key_path::KeyPath;
+
+    #[test]
+    fn test_database_placement() {
+        let dir = "/tmp/test/meta/storage/database_placement";
+        let _ = std::fs::remove_dir_all(dir);
+        let storage = StateMachine::open(dir, 16 * 1024 * 1024).unwrap();
+        let cluster = "cluster_xxx";
+
+        for (id, zone, tags) in [
+            (1, "eu", vec!["ssd"]),
+            (2, "eu", vec![]),
+            (3, "us", vec!["ssd"]),
+        ] {
+            let node = NodeInfo {
+                id,
+                grpc_addr: format!("127.0.0.1:{}", 8903 + id),
+                zone: zone.to_string(),
+                tags: tags.into_iter().map(|t| t.to_string()).collect(),
+            };
+            storage.process_add_date_node(cluster, &node).unwrap();
+            let metrics = NodeMetrics {
+                id,
+                disk_free: 1024,
+                time: 0,
+                status: NodeStatus::Healthy,
+            };
+            storage.process_add_node_metrics(cluster, &metrics).unwrap();
+        }
+
+        let placed = |placement: DatabasePlacement| {
+            let mut ids = placement
+                .filter_nodes(storage.get_valid_node_list(cluster).unwrap())
+                .iter()
+                .map(|node| node.id)
+                .collect::<Vec<_>>();
+            ids.sort();
+            ids
+        };
+        assert_eq!(placed(DatabasePlacement::default()), vec![1, 2, 3]);
+        let zone = Some("eu".to_string());
+        assert_eq!(
+            placed(DatabasePlacement {
+                zone: zone.clone(),
+                ..Default::default()
+            }),
+            vec![1, 2]
+        );
+        assert_eq!(
+            placed(DatabasePlacement {
+                zone,
+                tags: vec!["ssd".to_string()],
+                ..Default::default()
+            }),
+            vec![1]
+        );
+        assert_eq!(
+            placed(DatabasePlacement {
+                nodes: vec![2, 3, 4],
+                ..Default::default()
+            }),
+            vec![2, 3]
+        );
+    }
+
+    #[tokio::test]
+    async fn test_materialized_view_commands() {
+        let dir = "/tmp/test/meta/storage/materialized_view_commands";
+        let _ = std::fs::remove_dir_all(dir);
+        let storage = StateMachine::open(dir, 16 * 1024 * 1024).unwrap();
+        let cluster = "cluster_xxx";
+        let node = NodeInfo {
+            id: 1,
+            grpc_addr: "127.0.0.1:8904".to_string(),
+            zone: String::new(),
+            tags: vec![],
+        };
+        storage.process_add_date_node(cluster, &node).unwrap();
+        let metrics = NodeMetrics {
+            id: 1,
+            disk_free: 1024,
+            time: 0,
+            status: NodeStatus::Healthy,
+        };
+        storage.process_add_node_metrics(cluster, &metrics).unwrap();
+
+        let schema = DatabaseSchema::new(
+            "cnosdb",
+            "db",
+            DatabaseOptions::default(),
+            Arc::new(DatabaseConfig::default()),
+        );
+        let key = KeyPath::tenant_db_name(cluster, "cnosdb", "db");
+        storage
+            .insert(&key, &value_encode(&schema).unwrap())
+            .unwrap();
+        let stored_view = || {
+            storage
+                .get_struct::<DatabaseSchema>(&key)
+                .unwrap()
+                .unwrap()
+                .materialized_view("cpu_1m")
+                .cloned()
+        };
+
+        let view = MaterializedView {
+            name: "cpu_1m".to_string(),
+            source: "cpu".to_string(),
+            interval: 60,
+            tags: vec![],
+            aggregates: vec![],
+            owner: "root".to_string(),
+            stale: vec![StaleRange::all(1)],
+        };
+        storage
+            .process_create_materialized_view(cluster, "cnosdb", "db", &view)
+            .unwrap();
+        assert!(storage
+            .process_create_materialized_view(cluster, "cnosdb", "db", &view)
+            .is_err());
+
+        let range = StaleRange {
+            start: 0,
+            end: 60,
+            marked_at: 2,
+        };
+        storage
+            .process_write_command(&WriteCommand::MarkMaterializedViews(
+                cluster.to_string(),
+                "cnosdb".to_string(),
+                "db".to_string(),
+                vec![("cpu_1m".to_string(), range)],
+            ))
+            .await;
+        // altered by a schema read before the range is marked
+        storage
+            .process_alter_db(cluster, "cnosdb", &schema)
+            .unwrap();
+        assert_eq!(
+            stored_view().unwrap().stale,
+            vec![StaleRange::all(1), range]
+        );
+
+        storage
+            .process_write_command(&WriteCommand::ClearMaterializedView(
+                cluster.to_string(),
+                "cnosdb".to_string(),
+                "db".to_string(),
+                "cpu_1m".to_string(),
+                vec![StaleRange::all(1)],
+            ))
+            .await;
+        assert_eq!(stored_view().unwrap().stale, vec![range]);
+
+        storage
+            .process_write_command(&WriteCommand::DropMaterializedView(
+                cluster.to_string(),
+                "cnosdb".to_string(),
+                "db".to_string(),
+                "cpu_1m".to_string(),
+            ))
+            .await;
+        assert!(stored_view().is_none());
+    }
+
+    #[test]
+    fn test_tune_vnode_duration() {
+        let hour = 3600;
+        let day = 24 * hour;
+        // nothing written yet
+        assert_eq!(tune_vnode_duration(7 * day, hour, 0, 0, 100), 7 * day);
+        assert_eq!(tune_vnode_duration(7 * day, hour, 100, 0, 100), 7 * day);
+        // 1 byte per second fits in the buckets of 7 days
+        assert_eq!(
+            tune_vnode_duration(7 * day, hour, day as u64, day, 7 * day as u64),
+            7 * day
+        );
+        // 4 bytes per second, halved twice
+        assert_eq!(
+            tune_vnode_duration(8 * day, hour, 4 * day as u64, day, 8 * day as u64),
+            2 * day
+        );
+        // not shorter than the min duration
+        assert_eq!(
+            tune_vnode_duration(8 * hour, hour, u64::MAX / 2, day, 1),
+            hour
+        );
+    }
+
+    #[test]
+    fn test_tuned_vnode_duration_with_replicas() {
+        let dir = "/tmp/test/meta/storage/tuned_vnode_duration_with_replicas";
+        let _ = std::fs::remove_dir_all(dir);
+        let storage = StateMachine::open(dir, 16 * 1024 * 1024).unwrap();
+        let cluster = "cluster_xxx";
+
+        let day = CnosDuration::new_with_duration(Duration::from_secs(24 * 3600));
+        let mut options = DatabaseOptions::default();
+        options
+            .with_vnode_duration(CnosDuration::new_with_duration(Duration::from_secs(
+                8 * 24 * 3600,
+            )))
+            .with_replica(2)
+            .with_max_bucket_size(8000);
+        let schema =
+            DatabaseSchema::new("cnosdb", "db", options, Arc::new(DatabaseConfig::default()));
+        let day = day.to_precision(*schema.config.precision());
+
+        // each of the 2 replicas stores 1000 bytes written in a day
+        for node_id in [1, 2] {
+            let usage = DatabaseUsage {
+                disk_size: 1000,
+                series: 1,
+            };
+            let usages = HashMap::from([(schema.owner(), usage)]);
+            storage
+                .process_report_database_usages(cluster, node_id, &usages)
+                .unwrap();
+        }
+        let bucket = BucketInfo {
+            id: 1,
+            start_time: 0,
+            end_time: day,
+            shard_group: vec![],
+        };
+        let buckets = HashMap::from([("1".to_string(), bucket)]);
+        assert_eq!(
+            storage
+                .tuned_vnode_duration(cluster, &schema, &buckets)
+                .unwrap(),
+            8 * day
+        );
+    }
+
+    #[test]
+    fn test_bucket_time_range() {
+        let bucket = |start_time, end_time| BucketInfo {
+            id: 0,
+            start_time,
+            end_time,
+            shard_group: vec![],
+        };
+        assert_eq!(bucket_time_range(15, 10, &[] as &[BucketInfo]), (10, 20));
+        // clipped by the buckets created by a longer duration before and after
+        let buckets = [bucket(0, 12), bucket(18, 40)];
+        assert_eq!(bucket_time_range(15, 10, &buckets), (12, 18));
+        // the buckets not adjacent are ignored
+        let buckets = [bucket(-10, 0), bucket(30, 40)];
+        assert_eq!(bucket_time_range(15, 10, &buckets), (10, 20));
+    }
+
+    #[test]
+    fn test_cordon_and_remove_data_node() {
+        let dir = "/tmp/test/meta/storage/cordon_and_remove_data_node";
+        let _ = std::fs::remove_dir_all(dir);
+        let storage = StateMachine::open(dir, 16 * 1024 * 1024).unwrap();
+        let cluster = "cluster_xxx";
+
+        let node = NodeInfo {
+            id: 1,
+            grpc_addr: "127.0.0.1:8903".to_string(),
+            ..Default::default()
+        };
+        storage.process_add_date_node(cluster, &node).unwrap();
+        let metrics = NodeMetrics {
+            id: 1,
+            disk_free: 1024,
+            time: 0,
+            status: NodeStatus::Healthy,
+        };
+        storage.process_add_node_metrics(cluster, &metrics).unwrap();
+
+        storage.process_cordon_data_node(cluster, 1, true).unwrap();
+        // a heartbeat from the node must not lift the cordon
+        storage.process_add_node_metrics(cluster, &metrics).unwrap();
+        let key = KeyPath::data_node_metrics(cluster, 1);
+        let stored = storage.get_struct::<NodeMetrics>(&key).unwrap().unwrap();
+        assert_eq!(stored.status, NodeStatus::Cordon);
+        assert!(storage.get_valid_node_list(cluster).unwrap().is_empty());
+
+        storage.process_cordon_data_node(cluster, 1, false).unwrap();
+        assert_eq!(storage.get_valid_node_list(cluster).unwrap().len(), 1);
+
+        storage.process_remove_data_node(cluster, 1).unwrap();
+        assert!(storage
+            .process_read_data_nodes(cluster)
+            .unwrap()
+            .0
+            .is_empty());
+        assert!(storage.get_struct::<NodeMetrics>(&key).unwrap().is_none());
+        assert!(matches!(
+            storage.process_remove_data_node(cluster, 1),
+            Err(MetaError::NotFoundNode { id: 1 })
+        ));
+    }
 
     #[test]
     fn test_btree_map() {
@@ -45,6 +45,7 @@ async fn write_data_to_meta() {
     let node = NodeInfo {
         id: 111,
         grpc_addr: "".to_string(),
+        ..Default::default()
     };
     let req = command::WriteCommand::AddDataNode("cluster_xxx".to_string(), node);
     let cli = client::MetaHttpClient::new("127.0.0.1:8901", Arc::new(MetricsRegister::default()));
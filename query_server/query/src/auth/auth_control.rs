@@ -1,7 +1,9 @@
 use meta::model::MetaRef;
+use models::auth::session::SessionToken;
 use models::auth::user::{AuthType, User, UserInfo};
 use models::auth::AuthError;
 use models::oid::{Identifier, Oid};
+use models::utils::now_timestamp_millis;
 use spi::query::auth::AccessControl;
 use trace::warn;
 
@@ -10,11 +12,16 @@ pub type Result<T> = std::result::Result<T, AuthError>;
 #[derive(Clone)]
 pub struct AccessControlImpl {
     inner: AccessControlNoCheck,
+    /// The key verifying the session tokens.
+    session_secret: String,
 }
 
 impl AccessControlImpl {
-    pub fn new(inner: AccessControlNoCheck) -> Self {
-        Self { inner }
+    pub fn new(inner: AccessControlNoCheck, session_secret: String) -> Self {
+        Self {
+            inner,
+            session_secret,
+        }
     }
 }
 
@@ -33,6 +40,16 @@ impl AccessControl for AccessControlImpl {
 
         let user_options = user.desc().options();
         // access check
+        if let Some(token) = &user_info.session_token {
+            return SessionToken::verify(
+                token,
+                &user_info.user,
+                user_options,
+                &self.session_secret,
+                now_timestamp_millis(),
+            )
+            .map(|_| user);
+        }
         AuthType::from(user_options)
             .access_check(user_info)
             .map_err(|_err| AuthError::AccessDenied {
@@ -44,6 +61,29 @@ impl AccessControl for AccessControlImpl {
         Ok(user)
     }
 
+    async fn verify_session(&self, user_info: &UserInfo) -> Result<()> {
+        let token = match &user_info.session_token {
+            Some(token) => token,
+            None => return Ok(()),
+        };
+        let user_desc = self
+            .inner
+            .meta_manager
+            .user_desc(&user_info.user)
+            .await
+            .map_err(|err| AuthError::Metadata {
+                err: format!("{}", err),
+            })?;
+        SessionToken::verify(
+            token,
+            &user_info.user,
+            user_desc.options(),
+            &self.session_secret,
+            now_timestamp_millis(),
+        )
+        .map(|_| ())
+    }
+
     async fn tenant_id(&self, tenant_name: &str) -> Result<Oid> {
         // 查询租户信息，不存在则直接报错
         // tenant(&self, tenant_name: &str) -> Result<Tenant>;
@@ -1,6 +1,7 @@
 use std::any::Any;
 use std::ops::Deref;
 use std::sync::Arc;
+use std::time::Duration;
 
 use async_trait::async_trait;
 use coordinator::service::CoordinatorRef;
@@ -25,17 +26,22 @@ use datafusion::prelude::Column;
 use meta::error::MetaError;
 use meta::model::MetaClientRef;
 use models::arrow::{DataType, Field, Schema};
-use models::predicate::domain::{Predicate, PredicateRef, PushedAggregateFunction};
+use models::predicate::domain::{Predicate, PredicateRef, PushedAggregateFunction, TimeRanges};
+use models::predicate::{PlacedSplit, Sample};
+use models::schema::materialized_view::MaterializedView;
 use models::schema::tskv_table_schema::{TskvTableSchema, TskvTableSchemaRef};
 use models::schema::TIME_FIELD_NAME;
+use models::utils::now_timestamp_nanos;
+use spi::query::config::{SeriesPaging, UnboundedTimeRange};
 use trace::debug;
+use utils::precision::{timestamp_convert, Precision};
 
 use crate::data_source::batch::filter_expr_rewriter::{has_udf_function, rewrite_filters};
 use crate::data_source::sink::tskv::TskvRecordBatchSinkProvider;
 use crate::data_source::split::tskv::TableLayoutHandle;
 use crate::data_source::split::SplitManagerRef;
 use crate::data_source::{UpdateExecExt, WriteExecExt};
-use crate::extension::expr::expr_utils;
+use crate::extension::expr::{add_sample, expr_utils, is_sample};
 use crate::extension::physical::plan_node::aggregate_filter_scan::AggregateFilterTskvExec;
 use crate::extension::physical::plan_node::table_writer::TableWriterExec;
 use crate::extension::physical::plan_node::tag_scan::TagScanExec;
@@ -48,6 +54,8 @@ pub struct ClusterTable {
     split_manager: SplitManagerRef,
     _meta: MetaClientRef,
     schema: TskvTableSchemaRef,
+    // the views of the table and the tables storing them
+    materialized_views: Vec<(MaterializedView, Arc<ClusterTable>)>,
 }
 
 impl ClusterTable {
@@ -56,6 +64,7 @@ impl ClusterTable {
         ctx: &SessionState,
         projection: Option<&Vec<usize>>,
         predicate: PredicateRef,
+        sample: Option<Sample>,
     ) -> Result<Arc<dyn ExecutionPlan>> {
         let proj_schema = self.project_schema(projection)?;
 
@@ -69,6 +78,12 @@ impl ClusterTable {
             .splits(ctx, table_layout)
             .await
             .map_err(|err| DataFusionError::External(Box::new(err)))?;
+        let splits = self
+            .page_series(ctx, splits)
+            .await?
+            .into_iter()
+            .map(|s| s.with_sample(sample))
+            .collect::<Vec<_>>();
         if splits.is_empty() {
             return Ok(Arc::new(EmptyExec::new(false, proj_schema)));
         }
@@ -268,13 +283,100 @@ impl ClusterTable {
             split_manager,
             _meta: meta,
             schema,
+            materialized_views: vec![],
         }
     }
 
+    pub fn with_materialized_views(
+        mut self,
+        materialized_views: Vec<(MaterializedView, Arc<ClusterTable>)>,
+    ) -> Self {
+        self.materialized_views = materialized_views;
+        self
+    }
+
     pub fn table_schema(&self) -> TskvTableSchemaRef {
         self.schema.clone()
     }
 
+    pub fn materialized_views(&self) -> &[(MaterializedView, Arc<ClusterTable>)] {
+        &self.materialized_views
+    }
+
+    /// Rejects the scan whose time range is larger than `query.max_query_time_range`,
+    /// unless the session allows the unbounded time range.
+    fn check_time_range(&self, ctx: &SessionState, predicate: &Predicate) -> Result<()> {
+        let max_time_range = self.coord.get_config().query.max_query_time_range;
+        if max_time_range.is_zero() {
+            return Ok(());
+        }
+        let unbounded = ctx
+            .config()
+            .get_extension::<UnboundedTimeRange>()
+            .map(|e| e.0)
+            .unwrap_or_default();
+        if unbounded {
+            return Ok(());
+        }
+
+        let resolved = predicate
+            .resolve(&self.schema)
+            .map_err(|e| DataFusionError::External(Box::new(e)))?;
+        check_time_range(
+            &resolved.time_ranges(),
+            self.schema.time_column_precision(),
+            max_time_range,
+            now_timestamp_nanos(),
+        )
+    }
+
+    /// Checks the number of series selected if `query.max_select_series` is
+    /// set, the series are read page by page if the session passes a series
+    /// cursor, otherwise the query selecting too many series is rejected.
+    async fn page_series(
+        &self,
+        ctx: &SessionState,
+        splits: Vec<PlacedSplit>,
+    ) -> Result<Vec<PlacedSplit>> {
+        let max_series = self.coord.get_config().query.max_select_series as usize;
+        if max_series == 0 || splits.is_empty() {
+            return Ok(splits);
+        }
+
+        let table = format!("{}.{}", self.schema.db, self.schema.name);
+        let paging = ctx.config().get_extension::<SeriesPaging>();
+        // one more series than the page to know whether there are series left
+        let series = self
+            .split_manager
+            .series_ids(
+                &self.schema,
+                &splits,
+                |replica_id| paging.as_ref().and_then(|p| p.after(&table, replica_id)),
+                max_series + 1,
+            )
+            .await
+            .map_err(|err| DataFusionError::External(Box::new(err)))?;
+        let Some(paging) = paging else {
+            let total = series.iter().map(|(_, ids)| ids.len()).sum::<usize>();
+            if total <= max_series {
+                return Ok(splits);
+            }
+            return Err(DataFusionError::Plan(format!(
+                "The query selects more than {} series of table {}, exceeds query.max_select_series, \
+                add a condition on the tags or set the header 'X-CnosDB-Series-Cursor' to read the series page by page",
+                max_series, self.schema.name
+            )));
+        };
+
+        let ranges = paging.page(&table, &series, max_series);
+        Ok(splits
+            .into_iter()
+            .zip(ranges)
+            .filter(|(_, range)| range.limit > 0)
+            .map(|(split, range)| split.with_series_range(Some(range)))
+            .collect())
+    }
+
     // Check and return the projected schema
     fn project_schema(&self, projection: Option<&Vec<usize>>) -> Result<SchemaRef> {
         valid_project(&self.schema, projection)
@@ -329,13 +431,25 @@ impl TableProvider for ClusterTable {
             (df_schema, arrow_schema)
         };
 
-        let filters = rewrite_filters(filters, df_schema.clone())?;
+        // the sample functions are taken by the scan, not evaluated as filters
+        let mut sample = Sample::default();
+        let mut other_filters = Vec::with_capacity(filters.len());
+        for expr in filters {
+            if !add_sample(expr, &mut sample)? {
+                other_filters.push(expr.clone());
+            }
+        }
+        let sample = (!sample.is_empty()).then_some(sample);
+
+        let filters = rewrite_filters(&other_filters, df_schema.clone())?;
         // Generate physical expressions using projected schema
         let filter = Arc::new(
             Predicate::push_down_filter(filters, &df_schema, &arrow_schema, limit)
                 .map_err(|e| DataFusionError::External(Box::new(e)))?,
         );
 
+        self.check_time_range(ctx, &filter)?;
+
         if let Some(agg_with_grouping) = agg_with_grouping {
             debug!("Create aggregate filter tskv scan.");
             return self
@@ -344,11 +458,14 @@ impl TableProvider for ClusterTable {
         }
 
         return self
-            .create_table_scan_physical_plan(ctx, projection, filter)
+            .create_table_scan_physical_plan(ctx, projection, filter, sample)
             .await;
     }
 
     fn supports_filter_pushdown(&self, expr: &Expr) -> Result<TableProviderFilterPushDown> {
+        if is_sample(expr) {
+            return Ok(TableProviderFilterPushDown::Exact);
+        }
         if has_udf_function(expr)? {
             return Ok(TableProviderFilterPushDown::Inexact);
         }
@@ -510,3 +627,71 @@ pub fn valid_project(
 
     Ok(())
 }
+
+/// The upper bound of the time ranges is limited to `now_nanos`, so that
+/// `time > now() - 1d` is a time range of one day.
+fn check_time_range(
+    time_ranges: &TimeRanges,
+    precision: Precision,
+    max_time_range: Duration,
+    now_nanos: i64,
+) -> Result<()> {
+    if time_ranges.is_empty() {
+        return Ok(());
+    }
+
+    let now = timestamp_convert(Precision::NS, precision, now_nanos).unwrap_or(i64::MAX);
+    let max_range = i64::try_from(max_time_range.as_nanos())
+        .ok()
+        .and_then(|e| timestamp_convert(Precision::NS, precision, e))
+        .unwrap_or(i64::MAX);
+    let min_ts = time_ranges.min_ts();
+    let max_ts = time_ranges.max_ts().min(now);
+    if min_ts != i64::MIN && max_ts.saturating_sub(min_ts) <= max_range {
+        return Ok(());
+    }
+
+    Err(DataFusionError::Plan(format!(
+        "The time range of the query exceeds query.max_query_time_range {:?}, \
+        add a condition on the time column or set the header 'X-CnosDB-Unbounded-Time-Range: true'",
+        max_time_range
+    )))
+}
+
+#[cfg(test)]
+mod test {
+    use std::time::Duration;
+
+    use models::predicate::domain::{TimeRange, TimeRanges};
+    use utils::precision::Precision;
+
+    use super::check_time_range;
+
+    #[test]
+    fn test_check_time_range() {
+        let day_nanos = 86_400_000_000_000_i64;
+        let now = 100 * day_nanos;
+        let max_time_range = Duration::from_secs(7 * 86_400);
+
+        let check = |min_ts: i64, max_ts: i64, precision: Precision| {
+            let time_ranges = TimeRanges::new(vec![TimeRange::new(min_ts, max_ts)]);
+            check_time_range(&time_ranges, precision, max_time_range, now)
+        };
+
+        // no condition on the time column
+        assert!(check(i64::MIN, i64::MAX, Precision::NS).is_err());
+        // time > now() - 1d
+        assert!(check(now - day_nanos, i64::MAX, Precision::NS).is_ok());
+        // time > now() - 30d
+        assert!(check(now - 30 * day_nanos, i64::MAX, Precision::NS).is_err());
+        // time < now() - 1d
+        assert!(check(i64::MIN, now - day_nanos, Precision::NS).is_err());
+        assert!(check(day_nanos, 3 * day_nanos, Precision::NS).is_ok());
+        assert!(check(day_nanos, 30 * day_nanos, Precision::NS).is_err());
+        let day_millis = day_nanos / 1_000_000;
+        assert!(check(day_millis, 3 * day_millis, Precision::MS).is_ok());
+        assert!(check(day_millis, 30 * day_millis, Precision::MS).is_err());
+
+        assert!(check_time_range(&TimeRanges::empty(), Precision::NS, max_time_range, now).is_ok());
+    }
+}
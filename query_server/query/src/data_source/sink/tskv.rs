@@ -14,6 +14,9 @@ use trace::{Span, SpanContext};
 
 use crate::data_source::{RecordBatchSink, RecordBatchSinkProvider, SinkMetadata};
 
+/// The metric of the rows written so far, the progress of the writing.
+pub const WRITTEN_ROWS: &str = "written_rows";
+
 pub struct TskvRecordBatchSink {
     coord: CoordinatorRef,
     partition: usize,
@@ -96,6 +99,7 @@ impl RecordBatchSink for TskvRecordBatchSink {
 
         // Record the number of `RecordBatch` that has been written
         self.metrics.record_output_batches(1);
+        self.metrics.record_written_rows(rows_writed);
 
         Ok(SinkMetadata::new(rows_writed, write_bytes))
     }
@@ -144,6 +148,7 @@ impl RecordBatchSinkProvider for TskvRecordBatchSinkProvider {
 pub struct TskvSinkMetrics {
     elapsed_record_batch_write: metrics::Time,
     output_batches: Count,
+    written_rows: Count,
 }
 
 impl TskvSinkMetrics {
@@ -154,9 +159,12 @@ impl TskvSinkMetrics {
 
         let output_batches = MetricBuilder::new(metrics).counter("output_batches", partition);
 
+        let written_rows = MetricBuilder::new(metrics).counter(WRITTEN_ROWS, partition);
+
         Self {
             elapsed_record_batch_write,
             output_batches,
+            written_rows,
         }
     }
 
@@ -171,4 +179,8 @@ impl TskvSinkMetrics {
     pub fn output_batches(&self) -> usize {
         self.output_batches.value()
     }
+
+    pub fn record_written_rows(&self, num: usize) {
+        self.written_rows.add(num);
+    }
 }
@@ -1,13 +1,22 @@
 use std::sync::Arc;
 
 use coordinator::service::CoordinatorRef;
+use datafusion::arrow::array::{Array, UInt32Array};
+use datafusion::arrow::datatypes::{DataType, Field, Schema};
 use datafusion::execution::context::SessionState;
 use datafusion::sql::TableReference;
+use futures::TryStreamExt;
+use models::consistency_level::WriteToken;
+use models::meta_data::{ReplicationSet, ReplicationSetId, VnodeStatus};
 use models::object_reference::Resolve;
-use models::predicate::PlacedSplit;
+use models::predicate::{PlacedSplit, SeriesRange, SERIES_ID_COLUMN};
+use models::schema::tskv_table_schema::TskvTableSchemaRef;
+use models::SeriesId;
 use snafu::ResultExt;
-use spi::{AnalyzePushedFilterSnafu, CoordinatorSnafu, QueryResult};
+use spi::query::config::ReadYourWrites;
+use spi::{AnalyzePushedFilterSnafu, CoordinatorSnafu, QueryError, QueryResult};
 use trace::debug;
+use tskv::reader::QueryOption;
 
 use self::tskv::TableLayoutHandle;
 
@@ -33,7 +42,7 @@ impl SplitManager {
 
     pub async fn splits(
         &self,
-        _ctx: &SessionState,
+        ctx: &SessionState,
         table_layout: TableLayoutHandle,
     ) -> QueryResult<Vec<PlacedSplit>> {
         let TableLayoutHandle {
@@ -53,11 +62,15 @@ impl SplitManager {
             .resolve(&table)
             .context(AnalyzePushedFilterSnafu)?;
 
-        let shards = self
+        let mut shards = self
             .coord
             .table_vnodes(&table_name, resolved_predicate.clone())
             .await
             .context(CoordinatorSnafu)?;
+        if let Some(read_your_writes) = ctx.config().get_extension::<ReadYourWrites>() {
+            self.read_your_writes(&table.tenant, &read_your_writes.0, &mut shards)
+                .await;
+        }
 
         let splits = shards
             .into_iter()
@@ -74,4 +87,101 @@ impl SplitManager {
 
         Ok(splits)
     }
+
+    /// Reads the ids of the series of each split matching its tags filter,
+    /// at most `limit` series after the series id `after(replica_id)` in the
+    /// order of series id, the limit of the splits is ignored.
+    pub async fn series_ids(
+        &self,
+        table: &TskvTableSchemaRef,
+        splits: &[PlacedSplit],
+        after: impl Fn(ReplicationSetId) -> Option<SeriesId>,
+        limit: usize,
+    ) -> QueryResult<Vec<(ReplicationSetId, Vec<SeriesId>)>> {
+        let schema = Arc::new(Schema::new(vec![Field::new(
+            SERIES_ID_COLUMN,
+            DataType::UInt32,
+            false,
+        )]));
+
+        let series = splits.iter().map(|split| {
+            let range = SeriesRange {
+                after: after(split.replica_id()),
+                limit,
+            };
+            let option = QueryOption::new(
+                4096,
+                split.clone().without_limit().with_series_range(Some(range)),
+                None,
+                schema.clone(),
+                table.clone(),
+                table.meta(),
+            );
+            async move {
+                let ids = self.scan_series_ids(option).await;
+                ids.map(|ids| (split.replica_id(), ids))
+            }
+        });
+        futures::future::try_join_all(series).await
+    }
+
+    async fn scan_series_ids(&self, option: QueryOption) -> QueryResult<Vec<SeriesId>> {
+        let mut stream = self
+            .coord
+            .tag_scan(option, None)
+            .context(CoordinatorSnafu)?;
+        let mut series_ids = vec![];
+        while let Some(batch) = stream.try_next().await.context(CoordinatorSnafu)? {
+            let ids = batch
+                .column(0)
+                .as_any()
+                .downcast_ref::<UInt32Array>()
+                .ok_or_else(|| QueryError::Internal {
+                    reason: "the series ids scanned are not UInt32".to_string(),
+                })?;
+            series_ids.extend(ids.values().iter().copied());
+        }
+        // the series of a split may be scanned from several vnodes
+        series_ids.sort_unstable();
+        series_ids.dedup();
+        Ok(series_ids)
+    }
+
+    /// Reads the replication sets written from the vnodes acknowledged the
+    /// writes, falls back to the leader if the vnode is gone or broken.
+    async fn read_your_writes(
+        &self,
+        tenant: &str,
+        token: &WriteToken,
+        shards: &mut [ReplicationSet],
+    ) {
+        for shard in shards.iter_mut() {
+            let Some(vnode_id) = token.vnode_for(shard.id) else {
+                continue;
+            };
+            // the vnodes of the shard may have been truncated
+            let vnode = match shard.vnodes.iter().find(|v| v.id == vnode_id) {
+                Some(vnode) => Some(vnode.clone()),
+                None => self
+                    .coord
+                    .meta_manager()
+                    .tenant_meta(tenant)
+                    .await
+                    .and_then(|meta| meta.get_replica_all_info(shard.id))
+                    .and_then(|info| {
+                        info.replica_set
+                            .vnodes
+                            .into_iter()
+                            .find(|v| v.id == vnode_id && v.status != VnodeStatus::Broken)
+                    }),
+            };
+            match vnode {
+                Some(vnode) => shard.vnodes = vec![vnode],
+                None => debug!(
+                    "Vnode {} of the write token is gone, read replica {} from the leader",
+                    vnode_id, shard.id
+                ),
+            }
+        }
+    }
 }
@@ -34,6 +34,7 @@ use tokio_retry::Retry;
 use trace::span_ext::SpanExt;
 use trace::{error, info, Span, SpanContext};
 
+use super::materialized_view::refresh_materialized_views;
 use super::query_tracker::QueryTracker;
 use crate::data_source::split::SplitManagerRef;
 use crate::execution::factory::QueryExecutionFactoryRef;
@@ -47,6 +48,8 @@ pub struct SimpleQueryDispatcher {
     coord: CoordinatorRef,
     // client for default tenant
     default_table_provider: TableHandleProviderRef,
+    // database storing the usage metrics
+    usage_database: String,
     split_manager: SplitManagerRef,
     session_factory: Arc<SessionCtxFactory>,
     // memory pool
@@ -519,6 +522,7 @@ impl SimpleQueryDispatcher {
             meta_client,
             current_session_table_provider,
             self.default_table_provider.clone(),
+            self.usage_database.clone(),
             self.func_manager.clone(),
             self.query_tracker.clone(),
             session.clone(),
@@ -563,6 +567,7 @@ impl SimpleQueryDispatcher {
 pub struct SimpleQueryDispatcherBuilder {
     coord: Option<CoordinatorRef>,
     default_table_provider: Option<TableHandleProviderRef>,
+    usage_database: Option<String>,
     split_manager: Option<SplitManagerRef>,
     session_factory: Option<Arc<SessionCtxFactory>>,
     parser: Option<Arc<dyn Parser + Send + Sync>>,
@@ -591,6 +596,11 @@ impl SimpleQueryDispatcherBuilder {
         self
     }
 
+    pub fn with_usage_database(mut self, usage_database: String) -> Self {
+        self.usage_database = Some(usage_database);
+        self
+    }
+
     pub fn with_session_factory(mut self, session_factory: Arc<SessionCtxFactory>) -> Self {
         self.session_factory = Some(session_factory);
         self
@@ -706,6 +716,12 @@ impl SimpleQueryDispatcherBuilder {
                     err: "lost of default_table_provider".to_string(),
                 })?;
 
+        let usage_database =
+            self.usage_database
+                .ok_or_else(|| QueryError::BuildQueryDispatcher {
+                    err: "lost of usage_database".to_string(),
+                })?;
+
         let span_ctx = self.span_ctx;
 
         let auth_cache = self
@@ -717,6 +733,7 @@ impl SimpleQueryDispatcherBuilder {
         let dispatcher = Arc::new(SimpleQueryDispatcher {
             coord,
             default_table_provider,
+            usage_database,
             split_manager,
             session_factory,
             memory_pool,
@@ -740,6 +757,10 @@ impl SimpleQueryDispatcherBuilder {
             dispatcher.clone(),
             meta_task_receiver,
         ));
+        tokio::spawn(refresh_materialized_views(
+            dispatcher.coord.clone(),
+            dispatcher.clone(),
+        ));
 
         Ok(dispatcher)
     }
@@ -0,0 +1,292 @@
+//! Refreshes the stale ranges of the materialized views on the node holding
+//! the lock of the async tasks, as the owners of the views.
+//!
+//! A range is refreshed [`REFRESH_DELAY`] after it was last marked, so the
+//! points written and deleted before the mark are stored. The rows of the
+//! view in the range are deleted and aggregated again from the points of the
+//! table, then the range is cleared unless it was marked again meanwhile.
+
+use std::sync::Arc;
+use std::time::Duration;
+
+use coordinator::materialized_view::REFRESH_DELAY;
+use coordinator::service::CoordinatorRef;
+use meta::model::MetaClientRef;
+use models::oid::Identifier;
+use models::schema::materialized_view::{MaterializedView, StaleRange, ViewAggregateFunction};
+use models::utils::now_timestamp_nanos;
+use snafu::ResultExt;
+use spi::query::dispatcher::QueryDispatcher;
+use spi::service::protocol::{ContextBuilder, Query};
+use spi::{MetaSnafu, QueryResult};
+use trace::{debug, warn};
+
+use super::manager::SimpleQueryDispatcher;
+
+/// How often the stale ranges due are looked for.
+const REFRESH_INTERVAL: Duration = Duration::from_secs(10);
+
+pub async fn refresh_materialized_views(
+    coord: CoordinatorRef,
+    dispatcher: Arc<SimpleQueryDispatcher>,
+) {
+    let mut ticker = tokio::time::interval(REFRESH_INTERVAL);
+    loop {
+        ticker.tick().await;
+        // only one node refreshes the views
+        match coord.meta_manager().read_resourceinfos_mark().await {
+            Ok((id, lock)) if id == coord.node_id() && lock => {}
+            Ok(_) => continue,
+            Err(err) => {
+                warn!("Failed to read the lock to refresh the views: {}", err);
+                continue;
+            }
+        }
+        refresh_stale_ranges(&coord, &dispatcher).await;
+    }
+}
+
+async fn refresh_stale_ranges(coord: &CoordinatorRef, dispatcher: &SimpleQueryDispatcher) {
+    let meta = coord.meta_manager();
+    let tenants = match meta.tenants().await {
+        Ok(tenants) => tenants,
+        Err(err) => {
+            warn!("Failed to list the tenants to refresh the views: {}", err);
+            return;
+        }
+    };
+
+    for tenant in tenants {
+        let Some(client) = meta.tenant_meta(tenant.name()).await else {
+            continue;
+        };
+        let databases = match client.list_databases() {
+            Ok(databases) => databases,
+            Err(err) => {
+                warn!("Failed to list the databases of {}: {}", tenant.name(), err);
+                continue;
+            }
+        };
+        for (database, info) in databases {
+            if info.schema.is_hidden() {
+                continue;
+            }
+            let now = now_timestamp_nanos();
+            for view in info.schema.materialized_views() {
+                let due = view
+                    .stale
+                    .iter()
+                    .filter(|range| range.marked_at.saturating_add(REFRESH_DELAY) <= now)
+                    .copied()
+                    .collect::<Vec<_>>();
+                if due.is_empty() {
+                    continue;
+                }
+                match refresh_view(coord, dispatcher, &client, &database, view, due).await {
+                    Ok(()) => debug!("Refreshed the materialized view {}", view.name),
+                    Err(err) => warn!(
+                        "Failed to refresh the materialized view {}.{}: {}",
+                        database, view.name, err
+                    ),
+                }
+            }
+        }
+    }
+}
+
+async fn refresh_view(
+    coord: &CoordinatorRef,
+    dispatcher: &SimpleQueryDispatcher,
+    client: &MetaClientRef,
+    database: &str,
+    view: &MaterializedView,
+    ranges: Vec<StaleRange>,
+) -> QueryResult<()> {
+    let tenant = client.tenant();
+    let user = coord
+        .meta_manager()
+        .user_with_privileges(&view.owner, tenant.name())
+        .await
+        .context(MetaSnafu)?;
+    let ctx = ContextBuilder::new(user)
+        .with_tenant(Some(tenant.name().to_string()))
+        .with_database(Some(database.to_string()))
+        .build();
+    for range in &ranges {
+        for sql in [delete_sql(view, range), refresh_sql(view, range)] {
+            let query = Query::new(ctx.clone(), sql);
+            dispatcher
+                .execute_query(*tenant.id(), dispatcher.create_query_id(), &query, None)
+                .await?
+                .chunk_result()
+                .await?;
+        }
+    }
+    client
+        .clear_materialized_view(database, &view.name, ranges)
+        .await
+        .context(MetaSnafu)
+}
+
+/// The filter of the time in the range, the unbounded ends are omitted.
+fn time_filter(range: &StaleRange) -> String {
+    let mut bounds = vec![];
+    if range.start != i64::MIN {
+        bounds.push(format!("\"time\" >= CAST({} AS TIMESTAMP)", range.start));
+    }
+    if range.end != i64::MAX {
+        bounds.push(format!("\"time\" < CAST({} AS TIMESTAMP)", range.end));
+    }
+    match bounds.is_empty() {
+        true => String::new(),
+        false => format!(" WHERE {}", bounds.join(" AND ")),
+    }
+}
+
+fn quote(ident: &str) -> String {
+    format!("\"{}\"", ident.replace('"', "\"\""))
+}
+
+/// The statement deleting the rows of the view in the range.
+fn delete_sql(view: &MaterializedView, range: &StaleRange) -> String {
+    format!("DELETE FROM {}{}", quote(&view.name), time_filter(range))
+}
+
+/// The statement aggregating the points of the table in the range into the
+/// view.
+fn refresh_sql(view: &MaterializedView, range: &StaleRange) -> String {
+    let bucket = format!(
+        "date_bin(INTERVAL '{} nanoseconds', \"time\")",
+        view.interval
+    );
+    let aggregates = view
+        .aggregates
+        .iter()
+        .map(|agg| {
+            let field = agg.field.as_deref().map_or("*".to_string(), quote);
+            format!("{}({})", agg.func, field)
+        })
+        .collect::<Vec<_>>();
+
+    let mut columns = vec![quote("time")];
+    columns.extend(view.tags.iter().map(|tag| quote(tag)));
+    columns.extend(view.aggregates.iter().map(|agg| quote(&agg.column)));
+
+    let mut select = vec![format!("{} AS \"time\"", bucket)];
+    select.extend(view.tags.iter().map(|tag| quote(tag)));
+    select.extend(
+        aggregates
+            .iter()
+            .zip(&view.aggregates)
+            .map(|(expr, agg)| format!("{} AS {}", expr, quote(&agg.column))),
+    );
+
+    let mut group_by = vec![bucket];
+    group_by.extend(view.tags.iter().map(|tag| quote(tag)));
+
+    let mut sql = format!(
+        "INSERT INTO {} ({}) SELECT {} FROM {}",
+        quote(&view.name),
+        columns.join(", "),
+        select.join(", "),
+        quote(&view.source)
+    );
+    sql.push_str(&time_filter(range));
+    sql.push_str(&format!(" GROUP BY {}", group_by.join(", ")));
+    // a row with all the fields null can't be written
+    let counted = view
+        .aggregates
+        .iter()
+        .any(|agg| agg.func == ViewAggregateFunction::Count);
+    if !counted && !aggregates.is_empty() {
+        let having = aggregates
+            .iter()
+            .map(|expr| format!("{} IS NOT NULL", expr))
+            .collect::<Vec<_>>();
+        sql.push_str(&format!(" HAVING {}", having.join(" OR ")));
+    }
+    sql
+}
+
+#[cfg(test)]
+mod test {
+    use models::schema::materialized_view::{
+        MaterializedView, StaleRange, ViewAggregate, ViewAggregateFunction,
+    };
+
+    use super::{delete_sql, refresh_sql};
+
+    fn view(aggregates: Vec<ViewAggregate>) -> MaterializedView {
+        MaterializedView {
+            name: "cpu_1m".to_string(),
+            source: "cpu".to_string(),
+            interval: 60,
+            tags: vec!["host".to_string()],
+            aggregates,
+            owner: "root".to_string(),
+            stale: vec![],
+        }
+    }
+
+    #[test]
+    fn test_delete_sql() {
+        let range = StaleRange {
+            start: 0,
+            end: 120,
+            marked_at: 0,
+        };
+        assert_eq!(
+            delete_sql(&view(vec![]), &range),
+            "DELETE FROM \"cpu_1m\" \
+            WHERE \"time\" >= CAST(0 AS TIMESTAMP) AND \"time\" < CAST(120 AS TIMESTAMP)"
+        );
+        let range = StaleRange {
+            start: i64::MIN,
+            ..range
+        };
+        assert_eq!(
+            delete_sql(&view(vec![]), &range),
+            "DELETE FROM \"cpu_1m\" WHERE \"time\" < CAST(120 AS TIMESTAMP)"
+        );
+        assert_eq!(
+            delete_sql(&view(vec![]), &StaleRange::all(0)),
+            "DELETE FROM \"cpu_1m\""
+        );
+    }
+
+    #[test]
+    fn test_refresh_sql() {
+        let max = ViewAggregate {
+            func: ViewAggregateFunction::Max,
+            field: Some("usage".to_string()),
+            column: "max_usage".to_string(),
+        };
+        let count = ViewAggregate {
+            func: ViewAggregateFunction::Count,
+            field: None,
+            column: "cnt".to_string(),
+        };
+
+        assert_eq!(
+            refresh_sql(&view(vec![count, max.clone()]), &StaleRange::all(0)),
+            "INSERT INTO \"cpu_1m\" (\"time\", \"host\", \"cnt\", \"max_usage\") \
+            SELECT date_bin(INTERVAL '60 nanoseconds', \"time\") AS \"time\", \"host\", \
+            count(*) AS \"cnt\", max(\"usage\") AS \"max_usage\" FROM \"cpu\" \
+            GROUP BY date_bin(INTERVAL '60 nanoseconds', \"time\"), \"host\""
+        );
+        let range = StaleRange {
+            start: 0,
+            end: 120,
+            marked_at: 0,
+        };
+        assert_eq!(
+            refresh_sql(&view(vec![max]), &range),
+            "INSERT INTO \"cpu_1m\" (\"time\", \"host\", \"max_usage\") \
+            SELECT date_bin(INTERVAL '60 nanoseconds', \"time\") AS \"time\", \"host\", \
+            max(\"usage\") AS \"max_usage\" FROM \"cpu\" \
+            WHERE \"time\" >= CAST(0 AS TIMESTAMP) AND \"time\" < CAST(120 AS TIMESTAMP) \
+            GROUP BY date_bin(INTERVAL '60 nanoseconds', \"time\"), \"host\" \
+            HAVING max(\"usage\") IS NOT NULL"
+        );
+    }
+}
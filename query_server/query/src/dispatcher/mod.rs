@@ -4,6 +4,7 @@ use models::schema::query_info::{QueryId, QueryInfo};
 use spi::QueryResult;
 
 pub mod manager;
+pub mod materialized_view;
 pub mod persister;
 pub mod query_tracker;
 
@@ -89,6 +89,10 @@ impl QueryTracker {
                 // 流任务是常驻任务，需要手动kill，不需要在这里做代理
                 query
             }
+            QueryType::Job => {
+                // the job expires itself when it's done, see `BackfillExecution`
+                query
+            }
         };
 
         Ok(TrackedQuery { query })
@@ -213,12 +217,23 @@ impl QueryTracker {
         })
     }
 
+    /// The limit set at runtime by `SET max_concurrent_queries` takes precedence over the config
+    fn query_limit(&self) -> usize {
+        self.coord
+            .meta_manager()
+            .runtime_limits()
+            .max_concurrent_queries
+            .map(|limit| limit as usize)
+            .unwrap_or(self.query_limit)
+    }
+
     async fn save_query(
         &self,
         query_id: QueryId,
         query: Arc<dyn QueryExecution>,
     ) -> QueryResult<()> {
-        if self.queries.read().len() >= self.query_limit {
+        let query_limit = self.query_limit();
+        if self.queries.read().len() >= query_limit {
             warn!("simultaneous request limit exceeded - dropping request");
             return Err(QueryError::RequestLimit);
         }
@@ -226,7 +241,7 @@ impl QueryTracker {
         {
             // store the query in memory
             let mut wqueries = self.queries.write();
-            if wqueries.len() >= self.query_limit {
+            if wqueries.len() >= query_limit {
                 warn!("simultaneous request limit exceeded - dropping request");
                 return Err(QueryError::RequestLimit);
             }
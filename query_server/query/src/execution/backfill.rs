@@ -0,0 +1,423 @@
+//! Runs `INSERT INTO ... SELECT` as an asynchronous job, see [`AsyncJob`].
+//!
+//! The source table is copied bucket by bucket, the end time of the last
+//! bucket copied is committed by a [`WatermarkTracker`] keyed by the
+//! statement, so the job restarted by the node, or the same statement
+//! submitted again after a failure, resumes from the bucket not copied. The
+//! rows copied again overwrite the rows of the same series and time, so
+//! resuming does not duplicate them.
+//!
+//! [`AsyncJob`]: spi::query::config::AsyncJob
+
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+
+use async_trait::async_trait;
+use datafusion::arrow::array::{Int64Array, StringArray};
+use datafusion::arrow::datatypes::{DataType, Field, Schema};
+use datafusion::arrow::record_batch::RecordBatch;
+use datafusion::common::tree_node::{Transformed, TreeNode, TreeNodeVisitor, VisitRecursion};
+use datafusion::common::{Column, OwnedTableReference};
+use datafusion::error::{DataFusionError, Result as DFResult};
+use datafusion::logical_expr::{
+    count, lit, Expr, Filter, LogicalPlan, LogicalPlanBuilder, TableScan,
+};
+use datafusion::physical_plan::ExecutionPlan;
+use datafusion::scalar::ScalarValue;
+use futures::stream::AbortHandle;
+use futures::TryStreamExt;
+use models::schema::query_info::{QueryId, QueryInfo};
+use models::schema::tskv_table_schema::TskvTableSchemaRef;
+use parking_lot::Mutex;
+use snafu::ResultExt;
+use spi::query::dispatcher::{QueryStatus, QueryStatusBuilder};
+use spi::query::execution::{Output, QueryExecution, QueryStateMachineRef, QueryType};
+use spi::query::logical_planner::QueryPlan;
+use spi::query::optimizer::Optimizer;
+use spi::query::recordbatch::RecordBatchStreamWrapper;
+use spi::query::scheduler::SchedulerRef;
+use spi::{MetaSnafu, QueryError, QueryResult};
+use trace::{debug, error, info};
+use utils::precision::Precision;
+use utils::BkdrHasher;
+
+use super::query::written_rows;
+use crate::data_source::source_downcast_adapter;
+use crate::data_source::table_source::TableHandle;
+use crate::dispatcher::query_tracker::QueryTracker;
+use crate::stream::watermark_tracker::WatermarkTracker;
+
+pub struct BackfillExecution {
+    query_state_machine: QueryStateMachineRef,
+    plan: Arc<QueryPlan>,
+    optimizer: Arc<dyn Optimizer + Send + Sync>,
+    scheduler: SchedulerRef,
+    query_tracker: Arc<QueryTracker>,
+
+    progress: Arc<BackfillProgress>,
+    abort_handle: Mutex<Option<AbortHandle>>,
+}
+
+impl BackfillExecution {
+    pub fn new(
+        query_state_machine: QueryStateMachineRef,
+        plan: QueryPlan,
+        optimizer: Arc<dyn Optimizer + Send + Sync>,
+        scheduler: SchedulerRef,
+        query_tracker: Arc<QueryTracker>,
+    ) -> Self {
+        Self {
+            query_state_machine,
+            plan: Arc::new(plan),
+            optimizer,
+            scheduler,
+            query_tracker,
+            progress: Arc::new(BackfillProgress::default()),
+            abort_handle: Mutex::new(None),
+        }
+    }
+}
+
+#[async_trait]
+impl QueryExecution for BackfillExecution {
+    fn query_type(&self) -> QueryType {
+        QueryType::Job
+    }
+
+    async fn start(&self) -> QueryResult<Output> {
+        // rejected before the id of the job is returned
+        let source = BackfillSource::try_new(&self.plan)?;
+
+        let job = Backfill {
+            query_state_machine: self.query_state_machine.clone(),
+            plan: self.plan.clone(),
+            optimizer: self.optimizer.clone(),
+            scheduler: self.scheduler.clone(),
+            progress: self.progress.clone(),
+            source,
+        };
+        let query_id = self.query_state_machine.query_id;
+        let query_state_machine = self.query_state_machine.clone();
+        let query_tracker = self.query_tracker.clone();
+        let (task, abort_handle) = futures::future::abortable(async move {
+            match job.run().await {
+                Ok(_) => {
+                    info!("Backfill {} finished", query_id);
+                    query_state_machine.finish();
+                }
+                Err(e) => {
+                    error!("Backfill {} failed: {}", query_id, e);
+                    query_state_machine.fail();
+                }
+            }
+            let _ = query_tracker.expire_query(&query_id);
+        });
+        *self.abort_handle.lock() = Some(abort_handle);
+        tokio::spawn(task);
+
+        let schema = Arc::new(Schema::new(vec![Field::new(
+            "query_id",
+            DataType::Utf8,
+            false,
+        )]));
+        let batch = RecordBatch::try_new(
+            schema.clone(),
+            vec![Arc::new(StringArray::from(vec![query_id.to_string()]))],
+        )?;
+        Ok(Output::StreamData(Box::pin(RecordBatchStreamWrapper::new(
+            schema,
+            vec![batch],
+        ))))
+    }
+
+    fn cancel(&self) -> QueryResult<()> {
+        debug!(
+            "cancel backfill: query_id: {:?}, sql: {}",
+            &self.query_state_machine.query_id,
+            self.query_state_machine.query.content(),
+        );
+
+        self.query_state_machine.cancel();
+        if let Some(e) = self.abort_handle.lock().as_ref() {
+            e.abort()
+        };
+        Ok(())
+    }
+
+    fn info(&self) -> QueryInfo {
+        let qsm = &self.query_state_machine;
+        QueryInfo::new(
+            qsm.query_id,
+            qsm.query.content().to_string(),
+            *qsm.session.tenant_id(),
+            qsm.session.tenant().to_string(),
+            qsm.session.default_database().to_string(),
+            qsm.session.user().clone(),
+            qsm.coord.node_id(),
+        )
+    }
+
+    fn status(&self) -> QueryStatus {
+        QueryStatusBuilder::new(
+            self.query_state_machine.state().clone(),
+            self.query_state_machine.duration(),
+        )
+        .with_processed_count(self.progress.written_rows())
+        .with_estimated_count(self.progress.estimated_rows())
+        .build()
+    }
+
+    /// Restarted with the node until it's done.
+    fn need_persist(&self) -> bool {
+        true
+    }
+}
+
+#[derive(Default)]
+struct BackfillProgress {
+    // rows written by the buckets copied
+    written_rows: AtomicU64,
+    // rows of the source left to copy when the job started
+    estimated_rows: Mutex<Option<u64>>,
+    // the plan copying the current bucket
+    running: Mutex<Option<Arc<dyn ExecutionPlan>>>,
+}
+
+impl BackfillProgress {
+    fn written_rows(&self) -> u64 {
+        let running = self.running.lock();
+        let rows = running
+            .as_ref()
+            .map(|plan| written_rows(plan.as_ref()))
+            .unwrap_or_default();
+        self.written_rows.load(Ordering::Relaxed) + rows
+    }
+
+    fn finish_running(&self) {
+        let mut running = self.running.lock();
+        if let Some(plan) = running.take() {
+            let rows = written_rows(plan.as_ref());
+            self.written_rows.fetch_add(rows, Ordering::Relaxed);
+        }
+    }
+
+    fn estimated_rows(&self) -> Option<u64> {
+        *self.estimated_rows.lock()
+    }
+}
+
+/// The only tskv table read by the backfill.
+struct BackfillSource {
+    table_name: OwnedTableReference,
+    schema: TskvTableSchemaRef,
+}
+
+impl BackfillSource {
+    fn try_new(plan: &QueryPlan) -> QueryResult<Self> {
+        let mut visitor = SourceVisitor {
+            scans: 0,
+            sources: vec![],
+        };
+        plan.df_plan.visit(&mut visitor)?;
+        match (visitor.scans, visitor.sources.pop()) {
+            (1, Some(source)) => Ok(source),
+            _ => Err(QueryError::NotImplemented {
+                err: "the asynchronous job only copies from one tskv table".to_string(),
+            }),
+        }
+    }
+
+    fn time_column(&self) -> Expr {
+        Expr::Column(Column::new(
+            Some(self.table_name.clone()),
+            self.schema.time_column().name,
+        ))
+    }
+
+    fn time_literal(&self, time: i64) -> Expr {
+        lit(match self.schema.time_column_precision() {
+            Precision::MS => ScalarValue::TimestampMillisecond(Some(time), None),
+            Precision::US => ScalarValue::TimestampMicrosecond(Some(time), None),
+            Precision::NS => ScalarValue::TimestampNanosecond(Some(time), None),
+        })
+    }
+
+    /// Filters the rows of the source by `start <= time < end`.
+    fn filter_time(&self, plan: &LogicalPlan, start: i64, end: i64) -> DFResult<LogicalPlan> {
+        let predicate = self
+            .time_column()
+            .gt_eq(self.time_literal(start))
+            .and(self.time_column().lt(self.time_literal(end)));
+        plan.clone().transform_up(&|plan| match plan {
+            LogicalPlan::TableScan(TableScan { ref table_name, .. })
+                if *table_name == self.table_name =>
+            {
+                Ok(Transformed::Yes(LogicalPlan::Filter(Filter::try_new(
+                    predicate.clone(),
+                    Arc::new(plan),
+                )?)))
+            }
+            plan => Ok(Transformed::No(plan)),
+        })
+    }
+
+    /// Counts the rows of the source with `start <= time < end`.
+    fn count_time(&self, plan: &LogicalPlan, start: i64, end: i64) -> DFResult<LogicalPlan> {
+        let mut scan = None;
+        plan.apply(&mut |plan| {
+            if let LogicalPlan::TableScan(TableScan { table_name, .. }) = plan {
+                if *table_name == self.table_name {
+                    scan = Some(plan.clone());
+                    return Ok(VisitRecursion::Stop);
+                }
+            }
+            Ok(VisitRecursion::Continue)
+        })?;
+        let scan = scan.ok_or_else(|| {
+            DataFusionError::Internal(format!("table scan of {} not found", self.table_name))
+        })?;
+        LogicalPlanBuilder::from(self.filter_time(&scan, start, end)?)
+            .aggregate(Vec::<Expr>::new(), vec![count(self.time_column())])?
+            .build()
+    }
+}
+
+struct SourceVisitor {
+    scans: usize,
+    sources: Vec<BackfillSource>,
+}
+
+impl TreeNodeVisitor for SourceVisitor {
+    type N = LogicalPlan;
+
+    fn pre_visit(&mut self, plan: &LogicalPlan) -> DFResult<VisitRecursion> {
+        if let LogicalPlan::TableScan(TableScan {
+            table_name, source, ..
+        }) = plan
+        {
+            self.scans += 1;
+            if let Ok(adapter) = source_downcast_adapter(source) {
+                if let TableHandle::Tskv(table) = adapter.table_handle() {
+                    self.sources.push(BackfillSource {
+                        table_name: table_name.clone(),
+                        schema: table.table_schema(),
+                    });
+                }
+            }
+        }
+
+        Ok(VisitRecursion::Continue)
+    }
+}
+
+struct Backfill {
+    query_state_machine: QueryStateMachineRef,
+    plan: Arc<QueryPlan>,
+    optimizer: Arc<dyn Optimizer + Send + Sync>,
+    scheduler: SchedulerRef,
+    progress: Arc<BackfillProgress>,
+    source: BackfillSource,
+}
+
+impl Backfill {
+    async fn run(&self) -> QueryResult<()> {
+        let qsm = &self.query_state_machine;
+        let tracker =
+            WatermarkTracker::try_new(self.job_id(), qsm.coord.clone(), qsm.session.clone(), true)
+                .await?;
+        let copied_before = tracker.current_watermark_ns();
+
+        let buckets = self.buckets(copied_before).await?;
+        if let (Some((start, _)), Some((_, end))) = (buckets.first(), buckets.last()) {
+            let rows = self.count_rows(*start, *end).await?;
+            *self.progress.estimated_rows.lock() = Some(rows);
+        }
+
+        qsm.begin_schedule();
+        for (start, end) in buckets {
+            debug!(
+                "Backfill {} copies the rows in [{}, {})",
+                qsm.query_id, start, end
+            );
+            let plan = QueryPlan {
+                df_plan: self.source.filter_time(&self.plan.df_plan, start, end)?,
+                is_tag_scan: self.plan.is_tag_scan,
+            };
+            let physical_plan = self.optimizer.optimize(&plan, &qsm.session).await?;
+            *self.progress.running.lock() = Some(physical_plan.clone());
+            let mut stream = self
+                .scheduler
+                .schedule(physical_plan.clone(), qsm.session.inner().task_ctx())
+                .await?
+                .stream();
+            while stream.try_next().await?.is_some() {}
+
+            self.progress.finish_running();
+
+            tracker.update_watermark(end, 0);
+            tracker.commit(0, qsm.coord.clone()).await?;
+        }
+
+        // the same statement submitted later copies the table again
+        tracker.update_watermark(i64::MIN, 0);
+        tracker.commit(0, qsm.coord.clone()).await
+    }
+
+    /// The id of the statement, the progress committed is shared by the
+    /// statements with the same text.
+    fn job_id(&self) -> QueryId {
+        let qsm = &self.query_state_machine;
+        let mut hasher = BkdrHasher::new();
+        hasher
+            .hash_with(qsm.session.tenant().as_bytes())
+            .hash_with(qsm.session.default_database().as_bytes())
+            .hash_with(qsm.query.content().as_bytes());
+        QueryId::from(hasher.number())
+    }
+
+    /// The time ranges of the buckets of the source left to copy, in order.
+    async fn buckets(&self, copied_before: i64) -> QueryResult<Vec<(i64, i64)>> {
+        let schema = &self.source.schema;
+        let Some(meta) = self
+            .query_state_machine
+            .coord
+            .tenant_meta(&schema.tenant)
+            .await
+        else {
+            return Ok(vec![]);
+        };
+        let mut buckets = meta
+            .get_db_info(&schema.db)
+            .context(MetaSnafu)?
+            .map(|db| db.buckets)
+            .unwrap_or_default()
+            .into_iter()
+            .filter(|bucket| bucket.end_time > copied_before)
+            .map(|bucket| (bucket.start_time.max(copied_before), bucket.end_time))
+            .collect::<Vec<_>>();
+        buckets.sort_unstable();
+        Ok(buckets)
+    }
+
+    async fn count_rows(&self, start: i64, end: i64) -> QueryResult<u64> {
+        let session = &self.query_state_machine.session;
+        let plan = QueryPlan {
+            df_plan: self.source.count_time(&self.plan.df_plan, start, end)?,
+            is_tag_scan: false,
+        };
+        let physical_plan = self.optimizer.optimize(&plan, session).await?;
+        let batches = self
+            .scheduler
+            .schedule(physical_plan, session.inner().task_ctx())
+            .await?
+            .stream()
+            .try_collect::<Vec<_>>()
+            .await?;
+
+        Ok(batches
+            .iter()
+            .filter_map(|batch| batch.column(0).as_any().downcast_ref::<Int64Array>())
+            .flat_map(|counts| counts.iter().flatten())
+            .sum::<i64>() as u64)
+    }
+}
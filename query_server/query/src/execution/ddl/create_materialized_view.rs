@@ -0,0 +1,88 @@
+use std::sync::Arc;
+
+use async_trait::async_trait;
+use meta::error::MetaError;
+use models::schema::materialized_view::{MaterializedView, StaleRange};
+use models::schema::table_schema::TableSchema;
+use models::schema::tskv_table_schema::TskvTableSchema;
+use models::utils::now_timestamp_nanos;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::logical_planner::{CreateMaterializedView, CreateTable};
+use spi::{MetaSnafu, QueryError, QueryResult};
+
+use crate::execution::ddl::DDLDefinitionTask;
+
+pub struct CreateMaterializedViewTask {
+    stmt: CreateMaterializedView,
+}
+
+impl CreateMaterializedViewTask {
+    pub fn new(stmt: CreateMaterializedView) -> Self {
+        Self { stmt }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for CreateMaterializedViewTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        let CreateMaterializedView { table, view } = &self.stmt;
+        let CreateTable {
+            schema,
+            name,
+            if_not_exists,
+        } = table;
+
+        let client = query_state_machine
+            .meta
+            .tenant_meta(name.tenant())
+            .await
+            .ok_or_else(|| MetaError::TenantNotFound {
+                tenant: name.tenant().to_string(),
+            })
+            .context(MetaSnafu)?;
+        let db_schema = || {
+            client
+                .get_db_schema(name.database())
+                .context(MetaSnafu)?
+                .ok_or_else(|| MetaError::DatabaseNotFound {
+                    database: name.database().to_string(),
+                })
+                .context(MetaSnafu)
+        };
+
+        if db_schema()?.materialized_view(&view.name).is_some() {
+            if *if_not_exists {
+                return Ok(Output::Nil(()));
+            }
+            return Err(QueryError::Semantic {
+                err: format!("materialized view {} already exists", name),
+            });
+        }
+
+        // the rows of the view are stored in a table named after the view, the
+        // table is created first so that a view always has its table
+        let table_schema = TskvTableSchema::new(
+            name.tenant().to_string(),
+            name.database().to_string(),
+            name.table().to_string(),
+            schema.to_owned(),
+        );
+        client
+            .create_table(&TableSchema::TsKvTableSchema(Arc::new(table_schema)))
+            .await
+            .context(MetaSnafu)?;
+
+        // stale for all the time until it is populated
+        let view = MaterializedView {
+            stale: vec![StaleRange::all(now_timestamp_nanos())],
+            ..view.clone()
+        };
+        client
+            .create_materialized_view(name.database(), view)
+            .await
+            .context(MetaSnafu)?;
+
+        Ok(Output::Nil(()))
+    }
+}
@@ -0,0 +1,31 @@
+use async_trait::async_trait;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::logical_planner::DecommissionNode;
+use spi::{CoordinatorSnafu, QueryResult};
+
+use super::DDLDefinitionTask;
+
+pub struct DecommissionNodeTask {
+    stmt: DecommissionNode,
+}
+
+impl DecommissionNodeTask {
+    #[inline(always)]
+    pub fn new(stmt: DecommissionNode) -> Self {
+        Self { stmt }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for DecommissionNodeTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        query_state_machine
+            .coord
+            .decommission_node(self.stmt.node_id, self.stmt.replacement)
+            .await
+            .context(CoordinatorSnafu)?;
+
+        Ok(Output::Nil(()))
+    }
+}
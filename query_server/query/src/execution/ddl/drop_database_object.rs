@@ -31,20 +31,20 @@ impl DDLDefinitionTask for DropDatabaseObjectTask {
             ref obj_type,
         } = self.stmt;
 
+        let tenant = object_name.tenant();
+        let client = query_state_machine
+            .meta
+            .tenant_meta(tenant)
+            .await
+            .ok_or_else(|| MetaError::TenantNotFound {
+                tenant: tenant.to_string(),
+            })
+            .context(MetaSnafu)?;
+
         match obj_type {
             DatabaseObjectType::Table => {
                 // TODO 删除指定租户下的表
                 info!("Drop table {}", object_name);
-                let tenant = object_name.tenant();
-                let client = query_state_machine
-                    .meta
-                    .tenant_meta(tenant)
-                    .await
-                    .ok_or_else(|| MetaError::TenantNotFound {
-                        tenant: tenant.to_string(),
-                    })
-                    .context(MetaSnafu)?;
-
                 if client
                     .get_table_schema(object_name.database(), object_name.table())
                     .is_ok_and(|opt| opt.is_none())
@@ -60,27 +60,69 @@ impl DDLDefinitionTask for DropDatabaseObjectTask {
                     }
                 }
 
-                let resourceinfo = ResourceInfo::new(
-                    (*client.tenant().id(), object_name.database().to_string()),
-                    object_name.tenant().to_string()
-                        + "-"
-                        + object_name.database()
-                        + "-"
-                        + object_name.table(),
-                    ResourceOperator::DropTable(
-                        object_name.tenant().to_string(),
-                        object_name.database().to_string(),
-                        object_name.table().to_string(),
-                    ),
-                    &None,
-                    query_state_machine.coord.node_id(),
-                );
-                ResourceManager::add_resource_task(query_state_machine.coord.clone(), resourceinfo)
+                // the table aggregated by a view or storing a view
+                if let Some(db_schema) = client
+                    .get_db_schema(object_name.database())
+                    .context(MetaSnafu)?
+                {
+                    if let Some(view) = db_schema.materialized_views().iter().find(|view| {
+                        view.name == object_name.table() || view.source == object_name.table()
+                    }) {
+                        return Err(QueryError::Semantic {
+                            err: format!(
+                                "table {} is used by the materialized view {}, drop the materialized view first",
+                                object_name, view.name
+                            ),
+                        });
+                    }
+                }
+            }
+            DatabaseObjectType::MaterializedView => {
+                info!("Drop materialized view {}", object_name);
+                let db_schema = client
+                    .get_db_schema(object_name.database())
+                    .context(MetaSnafu)?
+                    .ok_or_else(|| MetaError::DatabaseNotFound {
+                        database: object_name.database().to_string(),
+                    })
+                    .context(MetaSnafu)?;
+                if db_schema.materialized_view(object_name.table()).is_none() {
+                    if *if_exist {
+                        return Ok(Output::Nil(()));
+                    } else {
+                        return Err(QueryError::Semantic {
+                            err: format!("materialized view {} doesn't exist", object_name),
+                        });
+                    }
+                }
+                // stop the view being refreshed and rewritten to before its
+                // table is dropped
+                client
+                    .drop_materialized_view(object_name.database(), object_name.table())
                     .await
-                    .context(CoordinatorSnafu)?;
+                    .context(MetaSnafu)?;
             }
         };
 
+        let resourceinfo = ResourceInfo::new(
+            (*client.tenant().id(), object_name.database().to_string()),
+            object_name.tenant().to_string()
+                + "-"
+                + object_name.database()
+                + "-"
+                + object_name.table(),
+            ResourceOperator::DropTable(
+                object_name.tenant().to_string(),
+                object_name.database().to_string(),
+                object_name.table().to_string(),
+            ),
+            &None,
+            query_state_machine.coord.node_id(),
+        );
+        ResourceManager::add_resource_task(query_state_machine.coord.clone(), resourceinfo)
+            .await
+            .context(CoordinatorSnafu)?;
+
         Ok(Output::Nil(()))
     }
 }
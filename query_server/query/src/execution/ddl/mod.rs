@@ -9,11 +9,13 @@ use spi::QueryResult;
 use self::alter_tenant::AlterTenantTask;
 use self::alter_user::AlterUserTask;
 use self::create_external_table::CreateExternalTableTask;
+use self::create_materialized_view::CreateMaterializedViewTask;
 use self::create_role::CreateRoleTask;
 use self::create_stream_table::CreateStreamTableTask;
 use self::create_table::CreateTableTask;
 use self::create_tenant::CreateTenantTask;
 use self::create_user::CreateUserTask;
+use self::decommission_node::DecommissionNodeTask;
 use self::drop_database_object::DropDatabaseObjectTask;
 use self::drop_global_object::DropGlobalObjectTask;
 use self::drop_tenant_object::DropTenantObjectTask;
@@ -22,9 +24,16 @@ use self::recover_database::RecoverDatabaseTask;
 use self::recover_tenant::RecoverTenantTask;
 use self::replica_add::ReplicaAddTask;
 use self::replica_destory::ReplicaDestoryTask;
+use self::replica_freeze::ReplicaFreezeTask;
 use self::replica_promote::ReplicaPromoteTask;
+use self::replica_rebuild::ReplicaRebuildTask;
 use self::replica_remove::ReplicaRemoveTask;
+use self::set_runtime_limit::SetRuntimeLimitTask;
 use self::show_replica::ShowReplicasTask;
+use self::show_series_cardinality::ShowSeriesCardinalityTask;
+use self::show_stats_derivative::ShowStatsDerivativeTask;
+use self::show_users::ShowUsersTask;
+use self::split_buckets::SplitBucketsTask;
 use crate::execution::ddl::alter_database::AlterDatabaseTask;
 use crate::execution::ddl::alter_table::AlterTableTask;
 use crate::execution::ddl::checksum_group::ChecksumGroupTask;
@@ -43,11 +52,13 @@ mod compact_vnode;
 mod copy_vnode;
 mod create_database;
 mod create_external_table;
+mod create_materialized_view;
 mod create_role;
 mod create_stream_table;
 mod create_table;
 mod create_tenant;
 mod create_user;
+mod decommission_node;
 mod drop_database_object;
 mod drop_global_object;
 mod drop_tenant_object;
@@ -58,9 +69,16 @@ mod recover_database;
 mod recover_tenant;
 mod replica_add;
 mod replica_destory;
+mod replica_freeze;
 mod replica_promote;
+mod replica_rebuild;
 mod replica_remove;
+mod set_runtime_limit;
 mod show_replica;
+mod show_series_cardinality;
+mod show_stats_derivative;
+mod show_users;
+mod split_buckets;
 
 /// Traits that DDL tasks should implement
 #[async_trait]
@@ -163,6 +181,9 @@ impl DDLDefinitionTaskFactory {
                 Box::new(DropGlobalObjectTask::new(sub_plan.clone()))
             }
             DDLPlan::CreateTable(sub_plan) => Box::new(CreateTableTask::new(sub_plan.clone())),
+            DDLPlan::CreateMaterializedView(sub_plan) => {
+                Box::new(CreateMaterializedViewTask::new(sub_plan.clone()))
+            }
             DDLPlan::CreateDatabase(sub_plan) => {
                 Box::new(CreateDatabaseTask::new(sub_plan.clone()))
             }
@@ -173,11 +194,19 @@ impl DDLDefinitionTaskFactory {
             DDLPlan::AlterTable(sub_plan) => Box::new(AlterTableTask::new(sub_plan.clone())),
             DDLPlan::AlterTenant(sub_plan) => Box::new(AlterTenantTask::new(sub_plan.clone())),
             DDLPlan::AlterUser(sub_plan) => Box::new(AlterUserTask::new(sub_plan.clone())),
+            DDLPlan::ShowUsers => Box::new(ShowUsersTask::new()),
+            DDLPlan::ShowStatsDerivative => {
+                Box::new(ShowStatsDerivativeTask::new(self.plan.schema()))
+            }
+            DDLPlan::SetRuntimeLimit(sub_plan) => {
+                Box::new(SetRuntimeLimitTask::new(sub_plan.clone()))
+            }
             DDLPlan::GrantRevoke(sub_plan) => Box::new(GrantRevokeTask::new(sub_plan.clone())),
             DDLPlan::DropVnode(sub_plan) => Box::new(DropVnodeTask::new(sub_plan.clone())),
             DDLPlan::CopyVnode(sub_plan) => Box::new(CopyVnodeTask::new(sub_plan.clone())),
             DDLPlan::MoveVnode(sub_plan) => Box::new(MoveVnodeTask::new(sub_plan.clone())),
             DDLPlan::CompactVnode(sub_plan) => Box::new(CompactVnodeTask::new(sub_plan.clone())),
+            DDLPlan::SplitBuckets(sub_plan) => Box::new(SplitBucketsTask::new(sub_plan.clone())),
             DDLPlan::ChecksumGroup(sub_plan) => {
                 Box::new(ChecksumGroupTask::new(sub_plan.clone(), self.plan.schema()))
             }
@@ -191,14 +220,25 @@ impl DDLDefinitionTaskFactory {
             }
             DDLPlan::RecoverTenant(sub_plan) => Box::new(RecoverTenantTask::new(sub_plan.clone())),
             DDLPlan::ShowReplicas => Box::new(ShowReplicasTask::new()),
+            DDLPlan::ShowSeriesCardinality(sub_plan) => Box::new(ShowSeriesCardinalityTask::new(
+                sub_plan.clone(),
+                self.plan.schema(),
+            )),
             DDLPlan::ReplicaDestory(sub_plan) => {
                 Box::new(ReplicaDestoryTask::new(sub_plan.clone()))
             }
+            DDLPlan::ReplicaFreeze(sub_plan) => Box::new(ReplicaFreezeTask::new(sub_plan.clone())),
             DDLPlan::ReplicaAdd(sub_plan) => Box::new(ReplicaAddTask::new(sub_plan.clone())),
             DDLPlan::ReplicaRemove(sub_plan) => Box::new(ReplicaRemoveTask::new(sub_plan.clone())),
+            DDLPlan::ReplicaRebuild(sub_plan) => {
+                Box::new(ReplicaRebuildTask::new(sub_plan.clone()))
+            }
             DDLPlan::ReplicaPromote(sub_plan) => {
                 Box::new(ReplicaPromoteTask::new(sub_plan.clone()))
             }
+            DDLPlan::DecommissionNode(sub_plan) => {
+                Box::new(DecommissionNodeTask::new(sub_plan.clone()))
+            }
         }
     }
 }
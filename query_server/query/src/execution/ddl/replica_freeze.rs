@@ -0,0 +1,37 @@
+use async_trait::async_trait;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::logical_planner::ReplicaFreeze;
+use spi::{CoordinatorSnafu, QueryResult};
+
+use super::DDLDefinitionTask;
+
+pub struct ReplicaFreezeTask {
+    stmt: ReplicaFreeze,
+}
+
+impl ReplicaFreezeTask {
+    #[inline(always)]
+    pub fn new(stmt: ReplicaFreeze) -> Self {
+        Self { stmt }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for ReplicaFreezeTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        let replica_id = self.stmt.replica_id;
+        let frozen = self.stmt.frozen;
+        let tenant = query_state_machine.session.tenant();
+
+        let coord = query_state_machine.coord.clone();
+
+        let cmd_type = coordinator::ReplicationCmdType::FreezeReplica(replica_id, frozen);
+        coord
+            .replication_manager(tenant, cmd_type)
+            .await
+            .context(CoordinatorSnafu)?;
+
+        Ok(Output::Nil(()))
+    }
+}
@@ -0,0 +1,48 @@
+use async_trait::async_trait;
+use coordinator::ReplicationCmdType;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::logical_planner::ReplicaRebuild;
+use spi::{CoordinatorSnafu, QueryError, QueryResult};
+
+use super::DDLDefinitionTask;
+
+pub struct ReplicaRebuildTask {
+    stmt: ReplicaRebuild,
+}
+
+impl ReplicaRebuildTask {
+    #[inline(always)]
+    pub fn new(stmt: ReplicaRebuild) -> Self {
+        Self { stmt }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for ReplicaRebuildTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        let (replica_id, node_id) = (self.stmt.replica_id, self.stmt.node_id);
+        let tenant = query_state_machine.session.tenant();
+
+        let meta = query_state_machine.meta.clone();
+        let coord = query_state_machine.coord.clone();
+        let all_info = coordinator::get_replica_all_info(meta, tenant, replica_id)
+            .await
+            .context(CoordinatorSnafu)?;
+
+        if let Some(info) = all_info.replica_set.by_node_id(node_id) {
+            let cmd_type = ReplicationCmdType::RebuildRaftNode(info.id);
+            coord
+                .replication_manager(tenant, cmd_type)
+                .await
+                .context(CoordinatorSnafu)?;
+
+            Ok(Output::Nil(()))
+        } else {
+            Err(QueryError::ReplicaNotFound {
+                replica_id,
+                node_id,
+            })
+        }
+    }
+}
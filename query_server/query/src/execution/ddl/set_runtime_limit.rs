@@ -0,0 +1,36 @@
+use async_trait::async_trait;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::logical_planner::SetRuntimeLimit;
+use spi::{MetaSnafu, QueryResult};
+use trace::info;
+
+use super::DDLDefinitionTask;
+
+pub struct SetRuntimeLimitTask {
+    stmt: SetRuntimeLimit,
+}
+
+impl SetRuntimeLimitTask {
+    #[inline(always)]
+    pub fn new(stmt: SetRuntimeLimit) -> Self {
+        Self { stmt }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for SetRuntimeLimitTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        let limit = self.stmt.limit.clone();
+        info!("set runtime limit: {:?}", limit);
+
+        // persisted in meta, all nodes pick up the new limit by watching meta
+        query_state_machine
+            .meta
+            .set_runtime_limit(limit)
+            .await
+            .context(MetaSnafu)?;
+
+        Ok(Output::Nil(()))
+    }
+}
@@ -1,14 +1,16 @@
+use std::collections::HashMap;
 use std::sync::Arc;
 
 use async_trait::async_trait;
-use datafusion::arrow::array::{StringArray, UInt32Array};
+use datafusion::arrow::array::{StringArray, UInt32Array, UInt64Array};
 use datafusion::arrow::datatypes::{DataType, Field, Schema};
 use datafusion::arrow::record_batch::RecordBatch;
 use meta::error::MetaError;
+use models::meta_data::{ReplicationSet, VnodeId, VnodeSummary};
 use snafu::ResultExt;
 use spi::query::execution::{Output, QueryStateMachineRef};
 use spi::query::recordbatch::RecordBatchStreamWrapper;
-use spi::{MetaSnafu, QueryResult};
+use spi::{CoordinatorSnafu, MetaSnafu, QueryResult};
 use utils::precision::{timestamp_convert, Precision};
 
 use crate::execution::ddl::DDLDefinitionTask;
@@ -35,6 +37,11 @@ async fn show_replica(machine: QueryStateMachineRef) -> QueryResult<Output> {
         Field::new("database", DataType::Utf8, false),
         Field::new("start_time", DataType::Utf8, false),
         Field::new("end_time", DataType::Utf8, false),
+        Field::new("bucket_id", DataType::UInt32, false),
+        Field::new("disk_size", DataType::UInt64, false),
+        Field::new("series_count", DataType::UInt64, false),
+        Field::new("state", DataType::Utf8, false),
+        Field::new("last_write_time", DataType::Utf8, true),
     ]));
 
     let mut location_list = Vec::new();
@@ -42,6 +49,11 @@ async fn show_replica(machine: QueryStateMachineRef) -> QueryResult<Output> {
     let mut database_list = Vec::new();
     let mut start_time_list = Vec::new();
     let mut end_time_list = Vec::new();
+    let mut bucket_id_list = Vec::new();
+    let mut disk_size_list = Vec::new();
+    let mut series_count_list = Vec::new();
+    let mut state_list = Vec::new();
+    let mut last_write_time_list = Vec::new();
 
     let tenant = machine.session.tenant();
     let client = machine
@@ -55,6 +67,22 @@ async fn show_replica(machine: QueryStateMachineRef) -> QueryResult<Output> {
 
     let databases = client.list_databases().context(MetaSnafu)?;
 
+    // Fetch storage state of all vnodes from the nodes owning them.
+    let vnodes = databases
+        .values()
+        .flat_map(|db_info| db_info.buckets.iter())
+        .flat_map(|bucket| bucket.shard_group.iter())
+        .flat_map(|replica| replica.vnodes.iter().cloned())
+        .collect::<Vec<_>>();
+    let summaries = machine
+        .coord
+        .vnode_summaries(tenant, vnodes)
+        .await
+        .context(CoordinatorSnafu)?
+        .into_iter()
+        .map(|summary| (summary.vnode_id, summary))
+        .collect::<HashMap<_, _>>();
+
     for (db_name, db_info) in databases {
         for bucket in db_info.buckets {
             for replica in bucket.shard_group {
@@ -77,7 +105,7 @@ async fn show_replica(machine: QueryStateMachineRef) -> QueryResult<Output> {
                 end_time_list.push(timestamp_to_string(end_time_nanos));
 
                 let mut temp_locations = Vec::new();
-                for vnode in replica.vnodes {
+                for vnode in replica.vnodes.iter() {
                     let mut temp = format!("{:?}", vnode.node_id);
                     if replica.leader_vnode_id == vnode.id {
                         temp = format!("{:?}*", vnode.node_id);
@@ -85,6 +113,13 @@ async fn show_replica(machine: QueryStateMachineRef) -> QueryResult<Output> {
                     temp_locations.push(temp);
                 }
                 location_list.push(temp_locations.join(","));
+                bucket_id_list.push(bucket.id);
+
+                let summary = ReplicaSummary::new(&replica, &summaries);
+                disk_size_list.push(summary.disk_size);
+                series_count_list.push(summary.series);
+                state_list.push(summary.state);
+                last_write_time_list.push(summary.last_write_time.map(timestamp_to_string));
             }
         }
     }
@@ -97,6 +132,11 @@ async fn show_replica(machine: QueryStateMachineRef) -> QueryResult<Output> {
             Arc::new(StringArray::from(database_list)),
             Arc::new(StringArray::from(start_time_list)),
             Arc::new(StringArray::from(end_time_list)),
+            Arc::new(UInt32Array::from(bucket_id_list)),
+            Arc::new(UInt64Array::from(disk_size_list)),
+            Arc::new(UInt64Array::from(series_count_list)),
+            Arc::new(StringArray::from(state_list)),
+            Arc::new(StringArray::from(last_write_time_list)),
         ],
     )?;
 
@@ -106,6 +146,51 @@ async fn show_replica(machine: QueryStateMachineRef) -> QueryResult<Output> {
     ))))
 }
 
+/// The storage state of a replication set, summarized from the vnodes of
+/// the nodes responded.
+#[derive(Debug, PartialEq)]
+struct ReplicaSummary {
+    disk_size: u64,
+    series: u64,
+    state: &'static str,
+    last_write_time: Option<i64>,
+}
+
+impl ReplicaSummary {
+    fn new(replica: &ReplicationSet, summaries: &HashMap<VnodeId, VnodeSummary>) -> Self {
+        // Vnodes of a replication set hold the same data, prefer the leader.
+        let summary = summaries.get(&replica.leader_vnode_id).or_else(|| {
+            replica
+                .vnodes
+                .iter()
+                .find_map(|vnode| summaries.get(&vnode.id))
+        });
+
+        let replica_summaries = replica
+            .vnodes
+            .iter()
+            .filter_map(|vnode| summaries.get(&vnode.id))
+            .collect::<Vec<_>>();
+        let state = if replica_summaries.is_empty() {
+            "unknown"
+        } else if replica_summaries.iter().all(|s| s.cold) {
+            "cold"
+        } else {
+            "hot"
+        };
+
+        Self {
+            disk_size: summary.map(|s| s.disk_size).unwrap_or_default(),
+            series: summary.map(|s| s.series).unwrap_or_default(),
+            state,
+            last_write_time: replica_summaries
+                .iter()
+                .filter_map(|s| s.last_write_time)
+                .max(),
+        }
+    }
+}
+
 fn timestamp_to_string(nanos: i64) -> String {
     if let Some(datetime) = chrono::NaiveDateTime::from_timestamp_nanos(nanos) {
         let utc_datetime = datetime.and_utc();
@@ -115,3 +200,63 @@ fn timestamp_to_string(nanos: i64) -> String {
         nanos.to_string()
     }
 }
+
+#[cfg(test)]
+mod test {
+    use std::collections::HashMap;
+
+    use models::meta_data::{ReplicationSet, VnodeInfo, VnodeSummary};
+
+    use super::ReplicaSummary;
+
+    #[test]
+    fn test_replica_summary() {
+        let replica =
+            ReplicationSet::new(1, 1, 10, vec![VnodeInfo::new(10, 1), VnodeInfo::new(11, 2)]);
+        let summary = |vnode_id, disk_size, last_write_time, cold| VnodeSummary {
+            vnode_id,
+            disk_size,
+            series: disk_size / 10,
+            last_write_time,
+            cold,
+        };
+
+        // no node responded
+        assert_eq!(
+            ReplicaSummary::new(&replica, &HashMap::new()),
+            ReplicaSummary {
+                disk_size: 0,
+                series: 0,
+                state: "unknown",
+                last_write_time: None,
+            }
+        );
+
+        // the size of the leader, and the last write of any vnode
+        let summaries = HashMap::from([
+            (10, summary(10, 100, Some(1), true)),
+            (11, summary(11, 200, Some(2), false)),
+        ]);
+        assert_eq!(
+            ReplicaSummary::new(&replica, &summaries),
+            ReplicaSummary {
+                disk_size: 100,
+                series: 10,
+                state: "hot",
+                last_write_time: Some(2),
+            }
+        );
+
+        // the follower if the leader didn't respond
+        let summaries = HashMap::from([(11, summary(11, 200, None, true))]);
+        assert_eq!(
+            ReplicaSummary::new(&replica, &summaries),
+            ReplicaSummary {
+                disk_size: 200,
+                series: 20,
+                state: "cold",
+                last_write_time: None,
+            }
+        );
+    }
+}
@@ -0,0 +1,118 @@
+use std::sync::Arc;
+
+use async_trait::async_trait;
+use datafusion::arrow::array::{BooleanArray, StringArray, UInt64Array};
+use datafusion::arrow::datatypes::SchemaRef;
+use datafusion::arrow::record_batch::RecordBatch;
+use meta::error::MetaError;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::logical_planner::ShowSeriesCardinality;
+use spi::query::recordbatch::RecordBatchStreamWrapper;
+use spi::{CoordinatorSnafu, MetaSnafu, QueryResult};
+use trace::warn;
+
+use crate::execution::ddl::DDLDefinitionTask;
+
+/// Estimates the number of series of the tables by merging the sketches of
+/// the series kept by the indexes of the vnodes, instead of scanning the
+/// series, the error is about 1.6%. The estimates are not complete if all the
+/// vnodes of a replication set are unreachable.
+pub struct ShowSeriesCardinalityTask {
+    stmt: ShowSeriesCardinality,
+    schema: SchemaRef,
+}
+
+impl ShowSeriesCardinalityTask {
+    pub fn new(stmt: ShowSeriesCardinality, schema: SchemaRef) -> Self {
+        Self { stmt, schema }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for ShowSeriesCardinalityTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        let ShowSeriesCardinality { database, table } = &self.stmt;
+        let tenant = query_state_machine.session.tenant();
+        let client = query_state_machine
+            .meta
+            .tenant_meta(tenant)
+            .await
+            .ok_or_else(|| MetaError::TenantNotFound {
+                tenant: tenant.to_string(),
+            })
+            .context(MetaSnafu)?;
+        let db_info = client
+            .get_db_info(database)
+            .context(MetaSnafu)?
+            .ok_or_else(|| MetaError::DatabaseNotFound {
+                database: database.to_string(),
+            })
+            .context(MetaSnafu)?;
+
+        // the external tables have no series
+        let mut tables = vec![];
+        let names = match table {
+            Some(table) => vec![table.clone()],
+            None => client.list_tables(database).context(MetaSnafu)?,
+        };
+        for name in names {
+            match client
+                .get_tskv_table_schema(database, &name)
+                .context(MetaSnafu)?
+            {
+                Some(_) => tables.push(name),
+                None if table.is_some() => {
+                    return Err(MetaError::TableNotFound {
+                        table: format!("{database}.{name}"),
+                    })
+                    .context(MetaSnafu)
+                }
+                None => {}
+            }
+        }
+        tables.sort();
+
+        let replicas = db_info
+            .buckets
+            .iter()
+            .flat_map(|bucket| bucket.shard_group.iter().cloned())
+            .collect::<Vec<_>>();
+        let sketches = query_state_machine
+            .coord
+            .series_sketches(tenant, replicas, tables.clone())
+            .await
+            .context(CoordinatorSnafu)?;
+        if !sketches.missing_replicas.is_empty() {
+            warn!(
+                "series cardinality of {} undercounted, replication sets {:?} unreachable",
+                database, sketches.missing_replicas
+            );
+        }
+        let cardinalities = tables
+            .iter()
+            .map(|table| {
+                sketches
+                    .sketches
+                    .get(table)
+                    .map(|s| s.estimate())
+                    .unwrap_or(0)
+            })
+            .collect::<Vec<_>>();
+        let complete = vec![sketches.missing_replicas.is_empty(); tables.len()];
+
+        let batch = RecordBatch::try_new(
+            self.schema.clone(),
+            vec![
+                Arc::new(StringArray::from(tables)),
+                Arc::new(UInt64Array::from(cardinalities)),
+                Arc::new(BooleanArray::from(complete)),
+            ],
+        )?;
+
+        Ok(Output::StreamData(Box::pin(RecordBatchStreamWrapper::new(
+            self.schema.clone(),
+            vec![batch],
+        ))))
+    }
+}
@@ -0,0 +1,62 @@
+use std::sync::Arc;
+
+use async_trait::async_trait;
+use datafusion::arrow::array::{Float64Array, StringArray};
+use datafusion::arrow::datatypes::SchemaRef;
+use datafusion::arrow::record_batch::RecordBatch;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::recordbatch::RecordBatchStreamWrapper;
+use spi::QueryResult;
+
+use crate::execution::ddl::DDLDefinitionTask;
+
+/// Shows the per second rates of the counters of the node running the
+/// query, computed from the last two samples of the monitor.
+pub struct ShowStatsDerivativeTask {
+    schema: SchemaRef,
+}
+
+impl ShowStatsDerivativeTask {
+    pub fn new(schema: SchemaRef) -> Self {
+        Self { schema }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for ShowStatsDerivativeTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        let rates = query_state_machine.coord.metric_rates();
+
+        let mut names = Vec::with_capacity(rates.len());
+        let mut labels = Vec::with_capacity(rates.len());
+        let mut values = Vec::with_capacity(rates.len());
+        let mut derivatives = Vec::with_capacity(rates.len());
+        for rate in rates {
+            names.push(rate.name.to_string());
+            labels.push(
+                rate.labels
+                    .iter()
+                    .map(|(k, v)| format!("{k}={v}"))
+                    .collect::<Vec<_>>()
+                    .join(","),
+            );
+            values.push(rate.value);
+            derivatives.push(rate.rate);
+        }
+
+        let batch = RecordBatch::try_new(
+            self.schema.clone(),
+            vec![
+                Arc::new(StringArray::from(names)),
+                Arc::new(StringArray::from(labels)),
+                Arc::new(Float64Array::from(values)),
+                Arc::new(Float64Array::from(derivatives)),
+            ],
+        )?;
+
+        Ok(Output::StreamData(Box::pin(RecordBatchStreamWrapper::new(
+            self.schema.clone(),
+            vec![batch],
+        ))))
+    }
+}
@@ -0,0 +1,79 @@
+use std::sync::Arc;
+
+use async_trait::async_trait;
+use datafusion::arrow::array::{BooleanArray, StringArray};
+use datafusion::arrow::datatypes::{DataType, Field, Schema};
+use datafusion::arrow::record_batch::RecordBatch;
+use models::utils::now_timestamp_millis;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::recordbatch::RecordBatchStreamWrapper;
+use spi::{MetaSnafu, QueryResult};
+
+use crate::execution::ddl::DDLDefinitionTask;
+
+pub struct ShowUsersTask {}
+
+impl ShowUsersTask {
+    pub fn new() -> Self {
+        ShowUsersTask {}
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for ShowUsersTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        show_users(query_state_machine).await
+    }
+}
+
+async fn show_users(machine: QueryStateMachineRef) -> QueryResult<Output> {
+    let schema = Arc::new(Schema::new(vec![
+        Field::new("user_name", DataType::Utf8, false),
+        Field::new("is_admin", DataType::Boolean, false),
+        Field::new("password_changed_at", DataType::Utf8, true),
+        Field::new("password_max_age", DataType::Utf8, true),
+        Field::new("must_change_password", DataType::Boolean, false),
+    ]));
+
+    let mut users = machine.meta.users().await.context(MetaSnafu)?;
+    users.sort_by(|a, b| a.name().cmp(b.name()));
+
+    let now = now_timestamp_millis();
+    let mut user_name_list = Vec::with_capacity(users.len());
+    let mut is_admin_list = Vec::with_capacity(users.len());
+    let mut password_changed_at_list = Vec::with_capacity(users.len());
+    let mut password_max_age_list = Vec::with_capacity(users.len());
+    let mut must_change_password_list = Vec::with_capacity(users.len());
+    for user in users {
+        let options = user.options();
+        user_name_list.push(user.name().to_string());
+        is_admin_list.push(user.is_admin());
+        password_changed_at_list.push(options.password_changed_at().map(timestamp_to_string));
+        password_max_age_list.push(options.password_max_age().map(|age| age.to_string()));
+        must_change_password_list.push(options.need_change_password(now));
+    }
+
+    let batch = RecordBatch::try_new(
+        schema.clone(),
+        vec![
+            Arc::new(StringArray::from(user_name_list)),
+            Arc::new(BooleanArray::from(is_admin_list)),
+            Arc::new(StringArray::from(password_changed_at_list)),
+            Arc::new(StringArray::from(password_max_age_list)),
+            Arc::new(BooleanArray::from(must_change_password_list)),
+        ],
+    )?;
+
+    Ok(Output::StreamData(Box::pin(RecordBatchStreamWrapper::new(
+        schema,
+        vec![batch],
+    ))))
+}
+
+fn timestamp_to_string(millis: i64) -> String {
+    match chrono::DateTime::from_timestamp_millis(millis) {
+        Some(datetime) => format!("{}", datetime),
+        None => millis.to_string(),
+    }
+}
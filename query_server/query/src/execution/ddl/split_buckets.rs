@@ -0,0 +1,148 @@
+use std::sync::Arc;
+
+use async_trait::async_trait;
+use coordinator::ReplicationCmdType;
+use futures::TryStreamExt;
+use meta::error::MetaError;
+use models::predicate::domain::Predicate;
+use models::schema::table_schema::TableSchema;
+use snafu::ResultExt;
+use spi::query::execution::{Output, QueryStateMachineRef};
+use spi::query::logical_planner::SplitBuckets;
+use spi::{CoordinatorSnafu, MetaSnafu, ModelsSnafu, QueryResult};
+use trace::info;
+use tskv::reader::QueryOption;
+
+use super::DDLDefinitionTask;
+use crate::data_source::split::tskv::TableLayoutHandle;
+use crate::data_source::split::SplitManager;
+
+pub struct SplitBucketsTask {
+    stmt: SplitBuckets,
+}
+
+impl SplitBucketsTask {
+    #[inline(always)]
+    pub fn new(stmt: SplitBuckets) -> Self {
+        Self { stmt }
+    }
+}
+
+#[async_trait]
+impl DDLDefinitionTask for SplitBucketsTask {
+    async fn execute(&self, query_state_machine: QueryStateMachineRef) -> QueryResult<Output> {
+        for bucket_id in self.stmt.bucket_ids.iter() {
+            split_bucket(&query_state_machine, &self.stmt.database, *bucket_id).await?;
+        }
+
+        Ok(Output::Nil(()))
+    }
+}
+
+/// 1. create new buckets covering the old bucket, new writes go to them.
+/// 2. rewrite the data of the old bucket, which is routed to the new buckets.
+/// 3. destroy the replication sets of the old bucket and delete it.
+///
+/// Queries during the split may see the rewritten data twice. The data is
+/// rewritten without the limits of the writes of the users, e.g. the time
+/// range to write and the quotas. An interrupted split is resumed by running
+/// it again, the new buckets are reused and the points rewritten again
+/// overwrite the same points.
+async fn split_bucket(
+    query_state_machine: &QueryStateMachineRef,
+    database: &str,
+    bucket_id: u32,
+) -> QueryResult<()> {
+    let tenant = query_state_machine.session.tenant();
+    let coord = query_state_machine.coord.clone();
+    let client = query_state_machine
+        .meta
+        .tenant_meta(tenant)
+        .await
+        .ok_or_else(|| MetaError::TenantNotFound {
+            tenant: tenant.to_string(),
+        })
+        .context(MetaSnafu)?;
+    let db_info = client
+        .get_db_info(database)
+        .context(MetaSnafu)?
+        .ok_or_else(|| MetaError::DatabaseNotFound {
+            database: database.to_string(),
+        })
+        .context(MetaSnafu)?;
+    let old_bucket = db_info
+        .buckets
+        .iter()
+        .find(|bucket| bucket.id == bucket_id)
+        .cloned()
+        .ok_or(MetaError::BucketNotFound { id: bucket_id })
+        .context(MetaSnafu)?;
+
+    let new_buckets = client
+        .split_bucket(database, bucket_id)
+        .await
+        .context(MetaSnafu)?;
+    info!(
+        "split bucket {:?} of {}.{} into {:?}",
+        old_bucket, tenant, database, new_buckets
+    );
+
+    let db_precision = *db_info.schema.config.precision();
+    let split_manager = SplitManager::new(coord.clone());
+    for table in db_info.tables.values() {
+        let table = match table {
+            TableSchema::TsKvTableSchema(table) => table.clone(),
+            _ => continue,
+        };
+
+        let schema = table.to_arrow_schema();
+        let table_layout = TableLayoutHandle {
+            table: table.clone(),
+            predicate: Arc::new(
+                Predicate::push_down_filter(None, &*table.to_df_schema()?, &schema, None)
+                    .context(ModelsSnafu)?,
+            ),
+        };
+        let splits = split_manager
+            .splits(query_state_machine.session.inner(), table_layout)
+            .await?;
+        for split in splits {
+            if !old_bucket
+                .shard_group
+                .iter()
+                .any(|replica| replica.id == split.replica_id())
+            {
+                continue;
+            }
+
+            let option = QueryOption::new(
+                4096,
+                split,
+                None,
+                schema.clone(),
+                table.clone(),
+                table.meta(),
+            );
+            let mut stream = coord.table_scan(option, None).context(CoordinatorSnafu)?;
+            while let Some(record_batch) = stream.try_next().await.context(CoordinatorSnafu)? {
+                coord
+                    .write_record_batch_internal(table.clone(), record_batch, db_precision, None)
+                    .await
+                    .context(CoordinatorSnafu)?;
+            }
+        }
+    }
+
+    for replica in old_bucket.shard_group.iter() {
+        coord
+            .replication_manager(tenant, ReplicationCmdType::DestoryRaftGroup(replica.id))
+            .await
+            .context(CoordinatorSnafu)?;
+    }
+    client
+        .delete_bucket(database, bucket_id)
+        .await
+        .context(MetaSnafu)?;
+
+    Ok(())
+}
@@ -3,6 +3,7 @@ use std::sync::Arc;
 use async_trait::async_trait;
 use datafusion::logical_expr::{Extension, LogicalPlan};
 use models::runtime::executor::DedicatedExecutor;
+use spi::query::config::AsyncJob;
 use spi::query::datasource::stream::checker::StreamCheckerManagerRef;
 use spi::query::execution::{QueryExecutionFactory, QueryExecutionRef, QueryStateMachineRef};
 use spi::query::logical_planner::{Plan, QueryPlan};
@@ -11,6 +12,7 @@ use spi::query::scheduler::SchedulerRef;
 use spi::QueryError;
 use tskv::kv_option::QueryOptions;
 
+use super::backfill::BackfillExecution;
 use super::dml::DMLExecution;
 use super::query::SqlQueryExecution;
 use super::stream::trigger::executor::{TriggerExecutorFactory, TriggerExecutorFactoryRef};
@@ -84,6 +86,15 @@ impl QueryExecutionFactory for SqlQueryExecutionFactory {
                     query_plan.is_explain(),
                     is_dml(&query_plan),
                 ) {
+                    (false, false, true) if is_async_job(&state_machine) => {
+                        Ok(Arc::new(BackfillExecution::new(
+                            state_machine,
+                            query_plan,
+                            self.optimizer.clone(),
+                            self.scheduler.clone(),
+                            self.query_tracker.clone(),
+                        )))
+                    }
                     (false, _, _) | (true, true, _) => Ok(Arc::new(SqlQueryExecution::new(
                         state_machine,
                         query_plan,
@@ -133,6 +144,18 @@ impl QueryExecutionFactory for SqlQueryExecutionFactory {
     }
 }
 
+/// The jobs persisted are restarted by the node as the old queries.
+fn is_async_job(state_machine: &QueryStateMachineRef) -> bool {
+    let async_job = state_machine
+        .session
+        .inner()
+        .config()
+        .get_extension::<AsyncJob>()
+        .map(|e| e.0)
+        .unwrap_or_default();
+    async_job || state_machine.query.context().is_old()
+}
+
 fn is_dml(query_plan: &QueryPlan) -> bool {
     match &query_plan.df_plan {
         LogicalPlan::Dml(_) => true,
@@ -1,3 +1,4 @@
+mod backfill;
 mod ddl;
 mod dml;
 pub mod factory;
@@ -1,10 +1,11 @@
 use std::sync::Arc;
 
 use async_trait::async_trait;
+use datafusion::physical_plan::ExecutionPlan;
 use futures::stream::AbortHandle;
 use models::schema::query_info::QueryInfo;
 use parking_lot::Mutex;
-use spi::query::dispatcher::QueryStatus;
+use spi::query::dispatcher::{QueryStatus, QueryStatusBuilder};
 use spi::query::execution::{Output, QueryExecution, QueryStateMachineRef};
 use spi::query::logical_planner::QueryPlan;
 use spi::query::optimizer::Optimizer;
@@ -12,6 +13,8 @@ use spi::query::scheduler::SchedulerRef;
 use spi::{QueryError, QueryResult};
 use trace::debug;
 
+use crate::data_source::sink::tskv::WRITTEN_ROWS;
+
 pub struct SqlQueryExecution {
     query_state_machine: QueryStateMachineRef,
     plan: QueryPlan,
@@ -19,6 +22,8 @@ pub struct SqlQueryExecution {
     scheduler: SchedulerRef,
 
     abort_handle: Mutex<Option<AbortHandle>>,
+    /// The plan being executed, to report the progress.
+    physical_plan: Mutex<Option<Arc<dyn ExecutionPlan>>>,
 }
 
 impl SqlQueryExecution {
@@ -34,6 +39,7 @@ impl SqlQueryExecution {
             optimizer,
             scheduler,
             abort_handle: Mutex::new(None),
+            physical_plan: Mutex::new(None),
         }
     }
 
@@ -45,6 +51,7 @@ impl SqlQueryExecution {
             .optimize(&self.plan, &self.query_state_machine.session)
             .await?;
         self.query_state_machine.end_optimize();
+        *self.physical_plan.lock() = Some(physical_plan.clone());
 
         // begin schedule
         self.query_state_machine.begin_schedule();
@@ -114,9 +121,30 @@ impl QueryExecution for SqlQueryExecution {
     }
 
     fn status(&self) -> QueryStatus {
-        QueryStatus::new(
+        let processed_count = self
+            .physical_plan
+            .lock()
+            .as_ref()
+            .map(|plan| written_rows(plan.as_ref()))
+            .unwrap_or_default();
+        QueryStatusBuilder::new(
             self.query_state_machine.state().clone(),
             self.query_state_machine.duration(),
         )
+        .with_processed_count(processed_count)
+        .build()
     }
 }
+
+/// The rows written by the plan so far, the progress of `INSERT INTO ... SELECT`.
+pub(super) fn written_rows(plan: &dyn ExecutionPlan) -> u64 {
+    let rows = plan
+        .metrics()
+        .and_then(|m| m.sum_by_name(WRITTEN_ROWS))
+        .map_or(0, |v| v.as_usize() as u64);
+    rows + plan
+        .children()
+        .iter()
+        .map(|child| written_rows(child.as_ref()))
+        .sum::<u64>()
+}
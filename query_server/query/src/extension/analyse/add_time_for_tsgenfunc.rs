@@ -6,7 +6,6 @@ use datafusion::logical_expr::{Extension, Filter, LogicalPlan, Projection};
 use datafusion::optimizer::analyzer::AnalyzerRule;
 use datafusion::prelude::Expr;
 
-use crate::extension::expr::TSGenFunc;
 use crate::extension::logical::plan_node::ts_gen_func::TSGenFuncNode;
 use crate::extension::utils::downcast_plan_node;
 
@@ -32,7 +31,7 @@ fn analyze_internal(plan: LogicalPlan) -> Result<Transformed<LogicalPlan>> {
 
         if let LogicalPlan::Extension(Extension { node }) = temp_input.as_ref() {
             if let Some(tsgenfunc) = downcast_plan_node::<TSGenFuncNode>(node.as_ref()) {
-                if tsgenfunc.symbol == TSGenFunc::TimestampRepair {
+                if tsgenfunc.symbol.generates_timestamps() {
                     let mut new_expr = expr.clone();
                     new_expr.insert(
                         0,
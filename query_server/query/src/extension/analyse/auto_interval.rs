@@ -0,0 +1,323 @@
+use chrono::Utc;
+use datafusion::arrow::datatypes::{DataType, IntervalMonthDayNanoType, TimeUnit};
+use datafusion::common::scalar::{dt_to_nano, mdn_to_nano};
+use datafusion::common::tree_node::{Transformed, TreeNode};
+use datafusion::common::DFSchemaRef;
+use datafusion::config::ConfigOptions;
+use datafusion::error::Result;
+use datafusion::execution::context::ExecutionProps;
+use datafusion::logical_expr::expr::{ScalarFunction, ScalarUDF};
+use datafusion::logical_expr::expr_rewriter::rewrite_preserving_name;
+use datafusion::logical_expr::utils::from_plan;
+use datafusion::logical_expr::{
+    Between, BinaryExpr, BuiltinScalarFunction, LogicalPlan, Operator, TableScan,
+};
+use datafusion::optimizer::analyzer::AnalyzerRule;
+use datafusion::optimizer::simplify_expressions::{ExprSimplifier, SimplifyContext};
+use datafusion::optimizer::utils::split_conjunction;
+use datafusion::prelude::{lit, Expr};
+use datafusion::scalar::ScalarValue;
+
+use crate::extension::expr::expr_rewriter::ExprReplacer;
+use crate::extension::expr::expr_utils::find_exprs_in_exprs_deeply_nested;
+use crate::extension::expr::{DATE_BIN_TZ, TIME_WINDOW};
+
+const MILLIS: i64 = 1_000_000;
+const SECOND: i64 = 1_000 * MILLIS;
+const MINUTE: i64 = 60 * SECOND;
+const HOUR: i64 = 60 * MINUTE;
+const DAY: i64 = 24 * HOUR;
+
+/// The intervals chosen for the time buckets, in nanoseconds, the intervals
+/// longer than a day are whole days.
+const INTERVALS: &[i64] = &[
+    MILLIS,
+    2 * MILLIS,
+    5 * MILLIS,
+    10 * MILLIS,
+    20 * MILLIS,
+    50 * MILLIS,
+    100 * MILLIS,
+    200 * MILLIS,
+    500 * MILLIS,
+    SECOND,
+    2 * SECOND,
+    5 * SECOND,
+    10 * SECOND,
+    15 * SECOND,
+    30 * SECOND,
+    MINUTE,
+    2 * MINUTE,
+    5 * MINUTE,
+    10 * MINUTE,
+    15 * MINUTE,
+    30 * MINUTE,
+    HOUR,
+    2 * HOUR,
+    3 * HOUR,
+    6 * HOUR,
+    12 * HOUR,
+    DAY,
+];
+
+/// Widen the intervals of the time buckets, so that a query returns at most
+/// `max_points` points per series over its time range, e.g. with 100 points
+///
+/// ```sql
+/// SELECT date_bin(interval '1 second', time) AS t, avg(f) FROM m
+/// WHERE time >= now() - interval '1 day' GROUP BY t
+/// ```
+///
+/// groups the points by 15 minutes. The interval written is the smallest
+/// interval used, `date_bin`, `date_bin_tz` and tumbling `time_window` are
+/// widened. The time range is the bounds of the time column filtered under
+/// the bucket, ending now if there is no upper bound, the buckets of a query
+/// without a lower bound are not changed.
+pub struct AutoIntervalRule {
+    max_points: u64,
+}
+
+impl AutoIntervalRule {
+    pub fn new(max_points: u64) -> Self {
+        Self { max_points }
+    }
+}
+
+impl AnalyzerRule for AutoIntervalRule {
+    fn analyze(&self, plan: LogicalPlan, _config: &ConfigOptions) -> Result<LogicalPlan> {
+        if self.max_points == 0 {
+            return Ok(plan);
+        }
+        plan.transform_up(&|plan| analyze_internal(plan, self.max_points as i64))
+    }
+
+    fn name(&self) -> &str {
+        "auto_interval"
+    }
+}
+
+fn analyze_internal(plan: LogicalPlan, max_points: i64) -> Result<Transformed<LogicalPlan>> {
+    let exprs = plan.expressions();
+    if find_exprs_in_exprs_deeply_nested(&exprs, &|e| bucket_args(e).is_some()).is_empty() {
+        return Ok(Transformed::No(plan));
+    }
+    let inputs = plan.inputs();
+    let [input] = inputs[..] else {
+        return Ok(Transformed::No(plan));
+    };
+    let filters = filters(input);
+    let schema = input.schema().clone();
+
+    let widen = |expr: &Expr| {
+        let (interval_idx, time_idx, args) = bucket_args(expr)?;
+        let interval = interval_nanos(&args[interval_idx])?;
+        let Expr::Column(time) = &args[time_idx] else {
+            return None;
+        };
+        let (start, end) = time_range(&filters, &time.name, &schema)?;
+        let widened = widen_interval(interval, end - start, max_points);
+        if widened == interval {
+            return None;
+        }
+
+        let mut args = args.to_vec();
+        args[interval_idx] = lit(ScalarValue::IntervalMonthDayNano(Some(
+            IntervalMonthDayNanoType::make_value(0, 0, widened),
+        )));
+        Some(with_args(expr, args))
+    };
+    let mut replacer = ExprReplacer::new(&widen);
+    let new_exprs = exprs
+        .into_iter()
+        .map(|e| rewrite_preserving_name(e, &mut replacer))
+        .collect::<Result<Vec<_>>>()?;
+
+    Ok(Transformed::Yes(from_plan(
+        &plan,
+        &new_exprs,
+        &[input.clone()],
+    )?))
+}
+
+/// The positions of the interval and the time column in the args of the
+/// time bucket function, and the args.
+fn bucket_args(expr: &Expr) -> Option<(usize, usize, &[Expr])> {
+    match expr {
+        Expr::ScalarFunction(ScalarFunction {
+            fun: BuiltinScalarFunction::DateBin,
+            args,
+        }) => Some((0, 1, args)),
+        Expr::ScalarUDF(ScalarUDF { fun, args }) if fun.name == DATE_BIN_TZ => Some((0, 1, args)),
+        // only tumbling windows
+        Expr::ScalarUDF(ScalarUDF { fun, args }) if fun.name == TIME_WINDOW && args.len() == 2 => {
+            Some((1, 0, args))
+        }
+        _ => None,
+    }
+}
+
+fn with_args(expr: &Expr, args: Vec<Expr>) -> Expr {
+    match expr {
+        Expr::ScalarFunction(ScalarFunction { fun, .. }) => {
+            Expr::ScalarFunction(ScalarFunction::new(*fun, args))
+        }
+        Expr::ScalarUDF(ScalarUDF { fun, .. }) => {
+            Expr::ScalarUDF(ScalarUDF::new(fun.clone(), args))
+        }
+        _ => expr.clone(),
+    }
+}
+
+/// The interval of fixed length in nanoseconds.
+pub(crate) fn interval_nanos(expr: &Expr) -> Option<i64> {
+    match expr {
+        Expr::Literal(ScalarValue::IntervalDayTime(v)) => dt_to_nano(v),
+        Expr::Literal(ScalarValue::IntervalMonthDayNano(Some(v))) => {
+            match IntervalMonthDayNanoType::to_parts(*v) {
+                (0, _, _) => mdn_to_nano(&Some(*v)),
+                _ => None,
+            }
+        }
+        _ => None,
+    }
+    .filter(|nanos| *nanos > 0)
+}
+
+/// The filters under the plan, through the nodes with a single input.
+fn filters(plan: &LogicalPlan) -> Vec<Expr> {
+    let mut filters = vec![];
+    let mut plan = plan;
+    loop {
+        match plan {
+            LogicalPlan::Filter(filter) => {
+                filters.extend(split_conjunction(&filter.predicate).into_iter().cloned())
+            }
+            LogicalPlan::TableScan(TableScan { filters: f, .. }) => {
+                filters.extend(f.iter().flat_map(split_conjunction).cloned())
+            }
+            _ => {}
+        }
+        match plan.inputs()[..] {
+            [input] => plan = input,
+            _ => return filters,
+        }
+    }
+}
+
+/// The time range of `column` in nanoseconds bounded by the filters, ending
+/// now if there is no upper bound.
+fn time_range(filters: &[Expr], column: &str, schema: &DFSchemaRef) -> Option<(i64, i64)> {
+    let is_column = |e: &Expr| matches!(e, Expr::Column(c) if c.name == column);
+    let mut start = None::<i64>;
+    let mut end = None::<i64>;
+    let mut bound = |op: Operator, value: &Expr| {
+        let Some(value) = timestamp_nanos(value, schema) else {
+            return;
+        };
+        match op {
+            Operator::Gt | Operator::GtEq => start = Some(start.map_or(value, |s| s.max(value))),
+            Operator::Lt | Operator::LtEq => end = Some(end.map_or(value, |e| e.min(value))),
+            _ => {}
+        }
+    };
+
+    for filter in filters {
+        match filter {
+            Expr::BinaryExpr(BinaryExpr { left, op, right }) if is_column(left) => {
+                bound(*op, right)
+            }
+            Expr::BinaryExpr(BinaryExpr { left, op, right }) if is_column(right) => {
+                if let Some(op) = op.swap() {
+                    bound(op, left)
+                }
+            }
+            Expr::Between(Between {
+                expr,
+                negated: false,
+                low,
+                high,
+            }) if is_column(expr) => {
+                bound(Operator::GtEq, low);
+                bound(Operator::LtEq, high);
+            }
+            _ => {}
+        }
+    }
+
+    let end = end.or_else(|| Utc::now().timestamp_nanos_opt())?;
+    Some((start?, end)).filter(|(start, end)| start < end)
+}
+
+/// Evaluates the constant expression as a timestamp in nanoseconds.
+pub(crate) fn timestamp_nanos(expr: &Expr, schema: &DFSchemaRef) -> Option<i64> {
+    let execution_props = ExecutionProps::new();
+    let info = SimplifyContext::new(&execution_props).with_schema(schema.clone());
+    let Expr::Literal(value) = ExprSimplifier::new(info).simplify(expr.clone()).ok()? else {
+        return None;
+    };
+    match value
+        .cast_to(&DataType::Timestamp(TimeUnit::Nanosecond, None))
+        .ok()?
+    {
+        ScalarValue::TimestampNanosecond(nanos, _) => nanos,
+        _ => None,
+    }
+}
+
+/// The interval of the buckets fitting `range` in `max_points`, at least
+/// `interval`.
+fn widen_interval(interval: i64, range: i64, max_points: i64) -> i64 {
+    let min = (range + max_points - 1) / max_points;
+    if min <= interval {
+        return interval;
+    }
+    let nice = match INTERVALS.iter().find(|i| **i >= min) {
+        Some(i) if min >= MILLIS => *i,
+        Some(_) => min,
+        None => (min + DAY - 1) / DAY * DAY,
+    };
+    nice.max(interval)
+}
+
+#[cfg(test)]
+mod tests {
+    use std::sync::Arc;
+
+    use datafusion::common::DFSchema;
+    use datafusion::prelude::{col, lit, Expr};
+    use datafusion::scalar::ScalarValue;
+
+    use super::{time_range, widen_interval, DAY, HOUR, MINUTE, SECOND};
+
+    fn ts(nanos: i64) -> Expr {
+        lit(ScalarValue::TimestampNanosecond(Some(nanos), None))
+    }
+
+    #[test]
+    fn test_widen_interval() {
+        assert_eq!(widen_interval(SECOND, DAY, 100), 15 * MINUTE);
+        assert_eq!(widen_interval(SECOND, 10 * SECOND, 100), SECOND);
+        assert_eq!(widen_interval(HOUR, DAY, 100), HOUR);
+        assert_eq!(widen_interval(SECOND, 365 * DAY, 100), 4 * DAY);
+        assert_eq!(widen_interval(1, 1000, 100), 10);
+    }
+
+    #[test]
+    fn test_time_range() {
+        let schema = Arc::new(DFSchema::empty());
+        let filters = vec![
+            col("time").gt_eq(ts(10)),
+            ts(100).gt(col("time")),
+            col("time").gt(ts(20)),
+            col("f").gt(ts(50)),
+        ];
+        assert_eq!(time_range(&filters, "time", &schema), Some((20, 100)));
+
+        let filters = vec![col("time").between(ts(10), ts(20))];
+        assert_eq!(time_range(&filters, "time", &schema), Some((10, 20)));
+
+        // no lower bound
+        let filters = vec![col("time").lt(ts(10))];
+        assert_eq!(time_range(&filters, "time", &schema), None);
+    }
+}
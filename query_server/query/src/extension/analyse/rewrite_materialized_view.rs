@@ -0,0 +1,537 @@
+//! Answers the aggregations of a table by its materialized views, e.g. with
+//! the view
+//!
+//! ```sql
+//! CREATE MATERIALIZED VIEW cpu_1m AS
+//! SELECT date_bin(INTERVAL '1 minute', time) AS time, host, count(*) AS cnt, max(usage) AS max_usage
+//! FROM cpu GROUP BY date_bin(INTERVAL '1 minute', time), host
+//! ```
+//!
+//! the query
+//!
+//! ```sql
+//! SELECT date_bin(INTERVAL '1 hour', time), count(*), max(usage) FROM cpu
+//! WHERE host = 'a' AND time >= '2024-01-01T00:00:00' GROUP BY date_bin(INTERVAL '1 hour', time)
+//! ```
+//!
+//! reads `sum(cnt)` and `max(max_usage)` of `cpu_1m` instead of the points of
+//! `cpu`. An aggregation is rewritten if it is grouped by the tags of the
+//! view and the buckets whose intervals are multiples of the interval of the
+//! view, its aggregates are stored by the view, and it only filters the tags
+//! of the view, or the time by `time >= t` and `time < t` with `t` aligned to
+//! the buckets of the view.
+//!
+//! The buckets of a view whose points are written or deleted are stale until
+//! they are refreshed, an aggregation is only rewritten if the time it
+//! filters overlaps no stale range of the view in the schema it is planned
+//! with. The statements writing tables, e.g. the refreshes of the views, are
+//! not rewritten, so that the rows written are always aggregated from the
+//! points.
+
+use std::collections::HashSet;
+use std::sync::Arc;
+
+use datafusion::common::tree_node::{Transformed, TreeNode, VisitRecursion};
+use datafusion::common::{Column, DFSchemaRef, OwnedTableReference};
+use datafusion::config::ConfigOptions;
+use datafusion::datasource::{provider_as_source, source_as_provider};
+use datafusion::error::Result;
+use datafusion::logical_expr::expr::{AggregateFunction, Cast, ScalarFunction, TryCast};
+use datafusion::logical_expr::utils::expr_to_columns;
+use datafusion::logical_expr::{
+    aggregate_function, Aggregate, BinaryExpr, BuiltinScalarFunction, LogicalPlan,
+    LogicalPlanBuilder, Operator, TableSource,
+};
+use datafusion::optimizer::analyzer::AnalyzerRule;
+use datafusion::optimizer::utils::split_conjunction;
+use datafusion::prelude::{coalesce, lit, Expr};
+use models::schema::materialized_view::{MaterializedView, ViewAggregateFunction};
+use models::schema::TIME_FIELD_NAME;
+
+use super::auto_interval::{interval_nanos, timestamp_nanos};
+use crate::data_source::batch::tskv::ClusterTable;
+use crate::extension::logical::plan_node::table_writer::TableWriterPlanNode;
+
+pub struct RewriteMaterializedView;
+
+impl AnalyzerRule for RewriteMaterializedView {
+    fn analyze(&self, plan: LogicalPlan, _config: &ConfigOptions) -> Result<LogicalPlan> {
+        if writes_table(&plan)? {
+            return Ok(plan);
+        }
+        plan.transform_up(&analyze_internal)
+    }
+
+    fn name(&self) -> &str {
+        "rewrite_materialized_view"
+    }
+}
+
+fn writes_table(plan: &LogicalPlan) -> Result<bool> {
+    let mut writes = false;
+    plan.apply(&mut |plan| {
+        if let LogicalPlan::Extension(ext) = plan {
+            if ext.node.as_any().is::<TableWriterPlanNode>() {
+                writes = true;
+                return Ok(VisitRecursion::Stop);
+            }
+        }
+        Ok(VisitRecursion::Continue)
+    })?;
+    Ok(writes)
+}
+
+fn analyze_internal(plan: LogicalPlan) -> Result<Transformed<LogicalPlan>> {
+    let rewritten = match &plan {
+        LogicalPlan::Aggregate(aggregate) => rewrite_by_views(aggregate)?,
+        _ => None,
+    };
+    Ok(match rewritten {
+        Some(plan) => Transformed::Yes(plan),
+        None => Transformed::No(plan),
+    })
+}
+
+/// Rewrites the aggregation of a table scanned, directly or through a
+/// filter, by the first view answering it.
+fn rewrite_by_views(aggregate: &Aggregate) -> Result<Option<LogicalPlan>> {
+    let (predicate, scan) = match aggregate.input.as_ref() {
+        LogicalPlan::Filter(filter) => match filter.input.as_ref() {
+            LogicalPlan::TableScan(scan) => (Some(&filter.predicate), scan),
+            _ => return Ok(None),
+        },
+        LogicalPlan::TableScan(scan) => (None, scan),
+        _ => return Ok(None),
+    };
+    if !scan.filters.is_empty() || scan.fetch.is_some() {
+        return Ok(None);
+    }
+    let provider = source_as_provider(&scan.source)?;
+    let Some(table) = provider.as_any().downcast_ref::<ClusterTable>() else {
+        return Ok(None);
+    };
+
+    for (view, view_table) in table.materialized_views() {
+        let source = provider_as_source(view_table.clone());
+        if let Some(plan) = rewrite_aggregate(aggregate, predicate, &scan.table_name, view, source)?
+        {
+            return Ok(Some(plan));
+        }
+    }
+    Ok(None)
+}
+
+/// Aggregates the view scanned as `table_name` instead, the output is the
+/// same as the aggregation, `None` if the view can't answer it.
+fn rewrite_aggregate(
+    aggregate: &Aggregate,
+    predicate: Option<&Expr>,
+    table_name: &OwnedTableReference,
+    view: &MaterializedView,
+    source: Arc<dyn TableSource>,
+) -> Result<Option<LogicalPlan>> {
+    let is_view_tag = |expr: &Expr| matches!(expr, Expr::Column(c) if view.tags.contains(&c.name));
+    let grouped_by_view = aggregate.group_expr.iter().all(|expr| {
+        is_view_tag(expr) || time_bucket(expr).is_some_and(|interval| interval % view.interval == 0)
+    });
+    if !grouped_by_view {
+        return Ok(None);
+    }
+
+    let mut time_range = (i64::MIN, i64::MAX);
+    if let Some(predicate) = predicate {
+        let schema = aggregate.input.schema();
+        for expr in split_conjunction(predicate) {
+            let Some((start, end)) = filters_view(expr, view, schema) else {
+                return Ok(None);
+            };
+            time_range = (time_range.0.max(start), time_range.1.min(end));
+        }
+    }
+    // the stale buckets are aggregated from the points
+    if !view.is_fresh(time_range.0, time_range.1) {
+        return Ok(None);
+    }
+
+    // the groups are the same, the aggregates are renamed after the original
+    // ones
+    let fields = aggregate.schema.fields();
+    let (group_fields, aggr_fields) = fields.split_at(aggregate.group_expr.len());
+    let mut projection = group_fields
+        .iter()
+        .map(|field| Expr::Column(field.qualified_column()))
+        .collect::<Vec<_>>();
+    let mut aggr_expr = Vec::with_capacity(aggregate.aggr_expr.len());
+    for (expr, field) in aggregate.aggr_expr.iter().zip(aggr_fields) {
+        let Some((func, column)) = view_aggregate(expr)
+            .and_then(|(func, field)| Some((func, view.aggregate(func, field)?)))
+        else {
+            return Ok(None);
+        };
+        // the aggregates of the buckets are merged
+        let fun = match func {
+            ViewAggregateFunction::Count | ViewAggregateFunction::Sum => {
+                aggregate_function::AggregateFunction::Sum
+            }
+            ViewAggregateFunction::Min => aggregate_function::AggregateFunction::Min,
+            ViewAggregateFunction::Max => aggregate_function::AggregateFunction::Max,
+        };
+        let merged = Expr::AggregateFunction(AggregateFunction {
+            fun,
+            args: vec![Expr::Column(Column::new(Some(table_name.clone()), column))],
+            distinct: false,
+            filter: None,
+            order_by: None,
+            can_be_pushed_down: false,
+        });
+        let mut output = Expr::Column(Column::from_name(merged.display_name()?));
+        // the count of no points is 0 instead of null
+        if func == ViewAggregateFunction::Count {
+            output = coalesce(vec![output, lit(0_i64)]);
+        }
+        projection.push(output.alias(field.name()));
+        if !aggr_expr.contains(&merged) {
+            aggr_expr.push(merged);
+        }
+    }
+
+    let mut builder = LogicalPlanBuilder::scan(table_name.clone(), source, None)?;
+    if let Some(predicate) = predicate {
+        builder = builder.filter(predicate.clone())?;
+    }
+    builder
+        .aggregate(aggregate.group_expr.clone(), aggr_expr)?
+        .project(projection)?
+        .build()
+        .map(Some)
+}
+
+/// The interval in nanoseconds of `date_bin(interval, time)`, whose buckets
+/// are aligned to the unix epoch.
+pub(crate) fn time_bucket(expr: &Expr) -> Option<i64> {
+    let Expr::ScalarFunction(ScalarFunction {
+        fun: BuiltinScalarFunction::DateBin,
+        args,
+    }) = expr
+    else {
+        return None;
+    };
+    let [interval, time] = args.as_slice() else {
+        return None;
+    };
+    let time = match time {
+        Expr::Cast(Cast { expr, .. }) | Expr::TryCast(TryCast { expr, .. }) => expr.as_ref(),
+        time => time,
+    };
+    match time {
+        Expr::Column(c) if c.name == TIME_FIELD_NAME => interval_nanos(interval),
+        _ => None,
+    }
+}
+
+/// The time range `[start, end)` in nanoseconds kept by the filter, `None`
+/// if the filter doesn't keep or remove the whole buckets of the view.
+fn filters_view(expr: &Expr, view: &MaterializedView, schema: &DFSchemaRef) -> Option<(i64, i64)> {
+    let mut columns = HashSet::new();
+    expr_to_columns(expr, &mut columns).ok()?;
+    if !columns.is_empty() && columns.iter().all(|c| view.tags.contains(&c.name)) {
+        return Some((i64::MIN, i64::MAX));
+    }
+
+    let is_time = |e: &Expr| matches!(e, Expr::Column(c) if c.name == TIME_FIELD_NAME);
+    let aligned =
+        |e: &Expr| timestamp_nanos(e, schema).filter(|ts| ts.rem_euclid(view.interval) == 0);
+    let Expr::BinaryExpr(BinaryExpr { left, op, right }) = expr else {
+        return None;
+    };
+    match op {
+        Operator::GtEq if is_time(left) => Some((aligned(right)?, i64::MAX)),
+        Operator::Lt if is_time(left) => Some((i64::MIN, aligned(right)?)),
+        Operator::LtEq if is_time(right) => Some((aligned(left)?, i64::MAX)),
+        Operator::Gt if is_time(right) => Some((i64::MIN, aligned(left)?)),
+        _ => None,
+    }
+}
+
+/// The aggregate a view can store for the aggregate expression, and the
+/// field aggregated, `None` for `count(*)`.
+pub(crate) fn view_aggregate(expr: &Expr) -> Option<(ViewAggregateFunction, Option<&str>)> {
+    let expr = match expr {
+        Expr::Alias(expr, _) => expr.as_ref(),
+        expr => expr,
+    };
+    let Expr::AggregateFunction(AggregateFunction {
+        fun,
+        args,
+        distinct: false,
+        filter: None,
+        order_by: None,
+        ..
+    }) = expr
+    else {
+        return None;
+    };
+    let func = match fun {
+        aggregate_function::AggregateFunction::Count => ViewAggregateFunction::Count,
+        aggregate_function::AggregateFunction::Sum => ViewAggregateFunction::Sum,
+        aggregate_function::AggregateFunction::Min => ViewAggregateFunction::Min,
+        aggregate_function::AggregateFunction::Max => ViewAggregateFunction::Max,
+        _ => return None,
+    };
+    let field = match args.as_slice() {
+        [Expr::Wildcard] if func == ViewAggregateFunction::Count => None,
+        [Expr::Literal(value)] if func == ViewAggregateFunction::Count && !value.is_null() => None,
+        [Expr::Column(column)] => Some(column.name.as_str()),
+        _ => return None,
+    };
+    Some((func, field))
+}
+
+#[cfg(test)]
+mod tests {
+    use std::sync::Arc;
+
+    use coordinator::service_mock::MockCoordinator;
+    use datafusion::arrow::datatypes::{IntervalMonthDayNanoType, TimeUnit};
+    use datafusion::config::ConfigOptions;
+    use datafusion::datasource::{provider_as_source, source_as_provider};
+    use datafusion::logical_expr::expr::ScalarFunction;
+    use datafusion::logical_expr::{BuiltinScalarFunction, LogicalPlan, LogicalPlanBuilder};
+    use datafusion::optimizer::analyzer::AnalyzerRule;
+    use datafusion::prelude::{avg, col, count, lit, max, Expr};
+    use datafusion::scalar::ScalarValue;
+    use meta::model::meta_tenant::TenantMeta;
+    use models::schema::materialized_view::{
+        MaterializedView, StaleRange, ViewAggregate, ViewAggregateFunction,
+    };
+    use models::schema::tskv_table_schema::{ColumnType, TableColumn, TskvTableSchema};
+    use models::ValueType;
+
+    use super::RewriteMaterializedView;
+    use crate::data_source::batch::tskv::ClusterTable;
+    use crate::data_source::split;
+
+    const MINUTE: i64 = 60_000_000_000;
+
+    fn cluster_table(name: &str, fields: &[(&str, ValueType)]) -> ClusterTable {
+        let mut schema = TskvTableSchema::default();
+        schema.name = name.to_string();
+        schema.add_column(TableColumn::new_time_column(0, TimeUnit::Nanosecond));
+        schema.add_column(TableColumn::new_with_default(
+            "host".to_string(),
+            ColumnType::Tag,
+        ));
+        for (field, value_type) in fields {
+            schema.add_column(TableColumn::new_with_default(
+                field.to_string(),
+                ColumnType::Field(*value_type),
+            ));
+        }
+        ClusterTable::new(
+            Arc::new(MockCoordinator::default()),
+            split::default_split_manager_ref_only_for_test(),
+            Arc::new(TenantMeta::mock()),
+            Arc::new(schema),
+        )
+    }
+
+    fn cpu_scan() -> LogicalPlanBuilder {
+        cpu_scan_with_stale(vec![])
+    }
+
+    fn cpu_scan_with_stale(stale: Vec<StaleRange>) -> LogicalPlanBuilder {
+        let view = MaterializedView {
+            name: "cpu_1m".to_string(),
+            source: "cpu".to_string(),
+            interval: MINUTE,
+            tags: vec!["host".to_string()],
+            aggregates: vec![
+                ViewAggregate {
+                    func: ViewAggregateFunction::Count,
+                    field: None,
+                    column: "cnt".to_string(),
+                },
+                ViewAggregate {
+                    func: ViewAggregateFunction::Max,
+                    field: Some("usage".to_string()),
+                    column: "max_usage".to_string(),
+                },
+            ],
+            owner: "root".to_string(),
+            stale,
+        };
+        let view_table = cluster_table(
+            "cpu_1m",
+            &[("cnt", ValueType::Integer), ("max_usage", ValueType::Float)],
+        );
+        let table = cluster_table(
+            "cpu",
+            &[("usage", ValueType::Float), ("idle", ValueType::Float)],
+        )
+        .with_materialized_views(vec![(view, Arc::new(view_table))]);
+        LogicalPlanBuilder::scan("cpu", provider_as_source(Arc::new(table)), None).unwrap()
+    }
+
+    fn date_bin(nanos: i64) -> Expr {
+        let interval = lit(ScalarValue::IntervalMonthDayNano(Some(
+            IntervalMonthDayNanoType::make_value(0, 0, nanos),
+        )));
+        Expr::ScalarFunction(ScalarFunction::new(
+            BuiltinScalarFunction::DateBin,
+            vec![interval, col("time")],
+        ))
+    }
+
+    fn ts(nanos: i64) -> Expr {
+        lit(ScalarValue::TimestampNanosecond(Some(nanos), None))
+    }
+
+    /// The name of the table scanned by the plan rewritten.
+    fn scanned_table(plan: &LogicalPlan) -> String {
+        match plan {
+            LogicalPlan::TableScan(scan) => source_as_provider(&scan.source)
+                .unwrap()
+                .as_any()
+                .downcast_ref::<ClusterTable>()
+                .unwrap()
+                .table_schema()
+                .name
+                .clone(),
+            plan => scanned_table(plan.inputs()[0]),
+        }
+    }
+
+    fn rewrite(plan: LogicalPlan) -> LogicalPlan {
+        let rewritten = RewriteMaterializedView
+            .analyze(plan.clone(), &ConfigOptions::default())
+            .unwrap();
+        assert_eq!(
+            rewritten.schema().field_names(),
+            plan.schema().field_names()
+        );
+        rewritten
+    }
+
+    #[test]
+    fn test_rewrite_materialized_view() {
+        let plan = cpu_scan()
+            .filter(
+                col("host")
+                    .eq(lit("a"))
+                    .and(col("time").gt_eq(ts(60 * MINUTE)))
+                    .and(ts(120 * MINUTE).gt(col("time"))),
+            )
+            .unwrap()
+            .aggregate(
+                vec![date_bin(60 * MINUTE)],
+                vec![count(lit(1_u8)), max(col("usage"))],
+            )
+            .unwrap()
+            .build()
+            .unwrap();
+        assert_eq!(scanned_table(&rewrite(plan)), "cpu_1m");
+
+        // no groups
+        let plan = cpu_scan()
+            .aggregate(Vec::<Expr>::new(), vec![max(col("usage"))])
+            .unwrap()
+            .build()
+            .unwrap();
+        assert_eq!(scanned_table(&rewrite(plan)), "cpu_1m");
+    }
+
+    #[test]
+    fn test_not_rewrite_materialized_view() {
+        let aggregates = |groups: Vec<Expr>, aggregates: Vec<Expr>, filter: Option<Expr>| {
+            let mut builder = cpu_scan();
+            if let Some(filter) = filter {
+                builder = builder.filter(filter).unwrap();
+            }
+            let plan = builder
+                .aggregate(groups, aggregates)
+                .unwrap()
+                .build()
+                .unwrap();
+            scanned_table(&rewrite(plan))
+        };
+
+        // the buckets are narrower than the view's
+        assert_eq!(
+            aggregates(vec![date_bin(MINUTE / 2)], vec![max(col("usage"))], None),
+            "cpu"
+        );
+        // the aggregates are not in the view
+        assert_eq!(
+            aggregates(vec![col("host")], vec![max(col("idle"))], None),
+            "cpu"
+        );
+        assert_eq!(
+            aggregates(vec![col("host")], vec![avg(col("usage"))], None),
+            "cpu"
+        );
+        // the time bound is not aligned to the buckets
+        assert_eq!(
+            aggregates(
+                vec![col("host")],
+                vec![max(col("usage"))],
+                Some(col("time").gt_eq(ts(MINUTE / 2)))
+            ),
+            "cpu"
+        );
+        // the bound includes the points at the start of a bucket
+        assert_eq!(
+            aggregates(
+                vec![col("host")],
+                vec![max(col("usage"))],
+                Some(col("time").gt(ts(MINUTE)))
+            ),
+            "cpu"
+        );
+        // filtered by a field
+        assert_eq!(
+            aggregates(
+                vec![col("host")],
+                vec![max(col("usage"))],
+                Some(col("idle").gt(lit(0.5)))
+            ),
+            "cpu"
+        );
+    }
+
+    #[test]
+    fn test_not_rewrite_stale_materialized_view() {
+        let stale = StaleRange {
+            start: 60 * MINUTE,
+            end: 61 * MINUTE,
+            marked_at: 0,
+        };
+        let aggregates = |filter: Option<Expr>| {
+            let mut builder = cpu_scan_with_stale(vec![stale]);
+            if let Some(filter) = filter {
+                builder = builder.filter(filter).unwrap();
+            }
+            let plan = builder
+                .aggregate(vec![col("host")], vec![max(col("usage"))])
+                .unwrap()
+                .build()
+                .unwrap();
+            scanned_table(&rewrite(plan))
+        };
+
+        assert_eq!(aggregates(None), "cpu");
+        assert_eq!(aggregates(Some(col("time").gt_eq(ts(30 * MINUTE)))), "cpu");
+        // the stale range is not filtered
+        assert_eq!(
+            aggregates(Some(
+                col("time")
+                    .gt_eq(ts(30 * MINUTE))
+                    .and(col("time").lt(ts(60 * MINUTE)))
+            )),
+            "cpu_1m"
+        );
+        assert_eq!(
+            aggregates(Some(ts(61 * MINUTE).lt_eq(col("time")))),
+            "cpu_1m"
+        );
+    }
+}
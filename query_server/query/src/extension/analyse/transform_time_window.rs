@@ -1,6 +1,6 @@
 use std::time::Duration;
 
-use datafusion::arrow::datatypes::{DataType, TimeUnit};
+use datafusion::arrow::datatypes::{DataType, IntervalMonthDayNanoType, TimeUnit};
 use datafusion::common::scalar::{dt_to_nano, mdn_to_nano, ym_to_nano};
 use datafusion::common::tree_node::{Transformed, TreeNode};
 use datafusion::common::DFSchemaRef;
@@ -21,7 +21,8 @@ use trace::debug;
 use crate::extension::expr::expr_fn::{ge, is_not_null, lt, minus, modulo, multiply, plus};
 use crate::extension::expr::expr_utils::find_exprs_in_exprs_deeply_nested;
 use crate::extension::expr::{
-    DEFAULT_TIME_WINDOW_START, TIME_WINDOW, WINDOW_COL_NAME, WINDOW_END, WINDOW_START,
+    DATE_BIN_TZ_UDF, DEFAULT_TIME_WINDOW_START, TIME_WINDOW, WINDOW_COL_NAME, WINDOW_END,
+    WINDOW_START,
 };
 use crate::extension::logical::logical_plan_builder::LogicalPlanBuilderExt;
 use crate::extension::logical::plan_node::LogicalPlanExt;
@@ -124,15 +125,17 @@ fn make_time_window(expr: Expr, schema: DFSchemaRef) -> Result<TimeWindow, Query
             // time_window(time, interval '10 seconds', interval '5 milliseconds')
             // third arg: slide_duration
             if let Some(slide_duration) = args.next() {
-                let slide_duration = simplify_expr(slide_duration, schema)?;
+                let slide_duration = simplify_expr(slide_duration, schema.clone())?;
                 let slide_duration = valid_duration(parse_duration_arg(&slide_duration)?)?;
                 time_window_builder.with_slide_duration(slide_duration);
 
-                args.next()
-                    .map(|start_time| time_window_builder.with_start_time(start_time));
+                if let Some(start_time) = args.next() {
+                    let start_time = simplify_expr(start_time, schema)?;
+                    time_window_builder.with_start_time(parse_start_time(start_time));
+                }
             }
 
-            Ok(time_window_builder.build())
+            time_window_builder.build()
         }
         _ => Err(QueryError::Internal {
             reason: format!("Expected TimeWindow, but found {expr}"),
@@ -140,20 +143,42 @@ fn make_time_window(expr: Expr, schema: DFSchemaRef) -> Result<TimeWindow, Query
     }
 }
 
-fn valid_duration(dur: Duration) -> Result<Duration, QueryError> {
-    if dur.as_millis() > (365 * DAY) as u128 || dur.as_millis() == 0 {
-        return Err(QueryError::InvalidTimeWindowParam {
-            reason: format!("Max duration is (0s, 365d], but found {}s", dur.as_secs()),
-        });
+fn valid_duration(dur: WindowDuration) -> Result<WindowDuration, QueryError> {
+    match dur {
+        WindowDuration::Fixed(d) if d.as_millis() > (365 * DAY) as u128 || d.as_millis() == 0 => {
+            Err(QueryError::InvalidTimeWindowParam {
+                reason: format!("Max duration is (0s, 365d], but found {}s", d.as_secs()),
+            })
+        }
+        WindowDuration::Months(months) if !(1..=12).contains(&months) => {
+            Err(QueryError::InvalidTimeWindowParam {
+                reason: format!("Max duration is (0, 12] months, but found {months} months"),
+            })
+        }
+        _ => Ok(dur),
     }
-
-    Ok(dur)
 }
 
-/// Convert string time duration to [`Duration`] \
+/// Convert string time duration to [`WindowDuration`] \
 /// Only support [`ScalarValue::IntervalYearMonth`] | [`ScalarValue::IntervalMonthDayNano`] | [`ScalarValue::IntervalDayTime`]
-fn parse_duration_arg(expr: &Expr) -> Result<Duration, QueryError> {
+///
+/// Intervals only made of months are calendar months instead of 30 days.
+fn parse_duration_arg(expr: &Expr) -> Result<WindowDuration, QueryError> {
     let nano = match expr {
+        Expr::Literal(ScalarValue::IntervalYearMonth(Some(months))) => {
+            return Ok(WindowDuration::Months(*months))
+        }
+        Expr::Literal(ScalarValue::IntervalMonthDayNano(Some(val))) => {
+            match IntervalMonthDayNanoType::to_parts(*val) {
+                (0, _, _) => mdn_to_nano(&Some(*val)),
+                (months, 0, 0) => return Ok(WindowDuration::Months(months)),
+                _ => {
+                    return Err(QueryError::InvalidTimeWindowParam {
+                        reason: format!("Can not mix months with days or time, but found {expr}"),
+                    })
+                }
+            }
+        }
         Expr::Literal(ScalarValue::IntervalYearMonth(val)) => ym_to_nano(val),
         Expr::Literal(ScalarValue::IntervalMonthDayNano(val)) => mdn_to_nano(val),
         Expr::Literal(ScalarValue::IntervalDayTime(val)) => dt_to_nano(val),
@@ -168,7 +193,44 @@ fn parse_duration_arg(expr: &Expr) -> Result<Duration, QueryError> {
         reason: format!("{expr}"),
     })?;
     debug!("duration str: {}", duration);
-    Ok(Duration::from_nanos(duration as u64))
+    Ok(WindowDuration::Fixed(Duration::from_nanos(duration as u64)))
+}
+
+/// Named anchors of time windows, which can be used as the start_time of [`TIME_WINDOW`]
+///
+/// - `epoch`: 1970-01-01T00:00:00Z, a Thursday
+/// - `iso_week`, `monday`: weeks start on Monday
+/// - `sunday`: weeks start on Sunday
+/// - `month`: the first day of month
+///
+/// Other strings are treated as timestamps.
+fn parse_start_time(expr: Expr) -> Expr {
+    let anchor = match &expr {
+        Expr::Literal(ScalarValue::Utf8(Some(s)))
+        | Expr::Literal(ScalarValue::LargeUtf8(Some(s))) => match s.to_ascii_lowercase().as_str() {
+            "epoch" | "month" => Some(0),
+            "iso_week" | "monday" => Some((4 * DAY * 1_000_000) as i64),
+            "sunday" => Some((3 * DAY * 1_000_000) as i64),
+            _ => None,
+        },
+        _ => return expr,
+    };
+
+    match anchor {
+        Some(ns) => Expr::Literal(ScalarValue::TimestampNanosecond(
+            Some(ns),
+            Some("+00:00".into()),
+        )),
+        None => cast(expr, DataType::Timestamp(TimeUnit::Nanosecond, None)),
+    }
+}
+
+/// Length of time window
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum WindowDuration {
+    Fixed(Duration),
+    /// Calendar months, starting at the first day of month
+    Months(i32),
 }
 
 #[derive(Debug)]
@@ -176,9 +238,9 @@ pub struct TimeWindow {
     window_alias: String,
     time_column: Expr,
     // interval, such as: '5s'
-    window_duration: Duration,
+    window_duration: WindowDuration,
     // interval
-    slide_duration: Duration,
+    slide_duration: WindowDuration,
     start_time: Expr,
 }
 
@@ -186,8 +248,8 @@ impl TimeWindow {
     pub fn new(
         window_alias: impl Into<String>,
         time_column: Expr,
-        window_duration: Duration,
-        slide_duration: Duration,
+        window_duration: WindowDuration,
+        slide_duration: WindowDuration,
         start_time: Expr,
     ) -> Self {
         Self {
@@ -202,18 +264,28 @@ impl TimeWindow {
     fn is_tumbling_window(&self) -> bool {
         self.window_duration == self.slide_duration
     }
+
+    /// Returns (window_duration, slide_duration) in the same unit, nanoseconds or months
+    fn window_and_slide(&self) -> (u128, u128) {
+        match (self.window_duration, self.slide_duration) {
+            (WindowDuration::Months(w), WindowDuration::Months(s)) => (w as u128, s as u128),
+            (WindowDuration::Fixed(w), WindowDuration::Fixed(s)) => (w.as_nanos(), s.as_nanos()),
+            // checked by TimeWindowBuilder
+            _ => unreachable!(),
+        }
+    }
 }
 
 struct TimeWindowBuilder {
     window_alias: String,
     time_column: Expr,
-    window_duration: Duration,
-    slide_duration: Option<Duration>,
+    window_duration: WindowDuration,
+    slide_duration: Option<WindowDuration>,
     start_time: Expr,
 }
 
 impl TimeWindowBuilder {
-    pub fn new(window_alias: String, time_column: Expr, window_duration: Duration) -> Self {
+    pub fn new(window_alias: String, time_column: Expr, window_duration: WindowDuration) -> Self {
         Self {
             window_alias,
             time_column,
@@ -224,7 +296,7 @@ impl TimeWindowBuilder {
         }
     }
 
-    pub fn with_slide_duration(&mut self, slide_duration: Duration) -> &mut Self {
+    pub fn with_slide_duration(&mut self, slide_duration: WindowDuration) -> &mut Self {
         self.slide_duration = Some(slide_duration);
         self
     }
@@ -234,14 +306,23 @@ impl TimeWindowBuilder {
         self
     }
 
-    pub fn build(self) -> TimeWindow {
-        TimeWindow {
+    pub fn build(self) -> Result<TimeWindow, QueryError> {
+        let slide_duration = self.slide_duration.unwrap_or(self.window_duration);
+        if matches!(self.window_duration, WindowDuration::Months(_))
+            != matches!(slide_duration, WindowDuration::Months(_))
+        {
+            return Err(QueryError::InvalidTimeWindowParam {
+                reason: "Window duration and slide duration must both be months or not".to_string(),
+            });
+        }
+
+        Ok(TimeWindow {
             window_alias: self.window_alias,
             time_column: self.time_column,
             window_duration: self.window_duration,
-            slide_duration: self.slide_duration.unwrap_or(self.window_duration),
+            slide_duration,
             start_time: self.start_time,
-        }
+        })
     }
 }
 
@@ -259,6 +340,23 @@ pub fn make_window_expr(i: i64, window: &TimeWindow) -> Expr {
 
     let ns_type = DataType::Timestamp(TimeUnit::Nanosecond, None);
 
+    let (window_duration, slide_duration) = match (window_duration, slide_duration) {
+        (WindowDuration::Months(window_months), WindowDuration::Months(slide_months)) => {
+            return make_calendar_window_expr(
+                i,
+                time_column,
+                *window_months,
+                *slide_months,
+                start_time,
+            )
+        }
+        (WindowDuration::Fixed(window_duration), WindowDuration::Fixed(slide_duration)) => {
+            (window_duration, slide_duration)
+        }
+        // checked by TimeWindowBuilder
+        _ => unreachable!(),
+    };
+
     // Convert interval to bigint
     let window_duration = lit(window_duration.as_nanos() as i64);
     let slide_duration = lit(slide_duration.as_nanos() as i64);
@@ -295,6 +393,41 @@ pub fn make_window_expr(i: i64, window: &TimeWindow) -> Expr {
     Expr::NamedStruct(Box::new(args)).alias(WINDOW_COL_NAME)
 }
 
+/// Same as [`make_window_expr`], but windows are aligned to calendar months
+fn make_calendar_window_expr(
+    i: i64,
+    time_column: &Expr,
+    window_months: i32,
+    slide_months: i32,
+    start_time: &Expr,
+) -> Expr {
+    let ns_type = DataType::Timestamp(TimeUnit::Nanosecond, None);
+    let months = |months: i32| {
+        lit(ScalarValue::IntervalMonthDayNano(Some(
+            IntervalMonthDayNanoType::make_value(months, 0, 0),
+        )))
+    };
+
+    let last_start = Expr::ScalarUDF(expr::ScalarUDF::new(
+        DATE_BIN_TZ_UDF.clone(),
+        vec![
+            months(slide_months),
+            cast(time_column.clone(), ns_type.clone()),
+            lit("UTC"),
+            cast(start_time.clone(), ns_type),
+        ],
+    ));
+    let window_start = minus(last_start, months(i as i32 * slide_months));
+    let window_end = plus(window_start.clone(), months(window_months));
+
+    let args = vec![
+        (WINDOW_START.to_string(), window_start),
+        (WINDOW_END.to_string(), window_end),
+    ];
+
+    Expr::NamedStruct(Box::new(args)).alias(WINDOW_COL_NAME)
+}
+
 /// Convert tumbling window to new plan
 ///
 /// Original Schema[c1, c2, c3]
@@ -330,17 +463,10 @@ fn build_sliding_window_plan(
     child: LogicalPlan,
     child_project_exprs: Vec<Expr>,
 ) -> Result<LogicalPlan> {
-    let TimeWindow {
-        time_column,
-        window_duration,
-        slide_duration,
-        ..
-    } = window;
-
-    let window_ns = window_duration.as_nanos();
-    let slide_ns = slide_duration.as_nanos();
+    let time_column = &window.time_column;
+    let (window_len, slide_len) = window.window_and_slide();
     // prevent window_duration + slide_duration from overflowing
-    let overlapping_windows = (window_ns + slide_ns - 1) / slide_ns;
+    let overlapping_windows = (window_len + slide_len - 1) / slide_len;
 
     // Do not allow windows to overlap too much
     if overlapping_windows > 100 {
@@ -354,7 +480,7 @@ fn build_sliding_window_plan(
         .map(|i| make_window_expr(i as i64, window))
         .collect::<Vec<_>>();
 
-    let filter = if window_ns % slide_ns == 0 {
+    let filter = if window_len % slide_len == 0 {
         // When the condition windowDuration % slideDuration = 0 is fulfilled,
         // the estimation of the number of windows becomes exact one,
         // which means all produced windows are valid.
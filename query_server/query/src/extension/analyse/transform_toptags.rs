@@ -0,0 +1,223 @@
+use std::sync::Arc;
+
+use datafusion::common::tree_node::{Transformed, TreeNode};
+use datafusion::common::Column;
+use datafusion::config::ConfigOptions;
+use datafusion::error::{DataFusionError, Result};
+use datafusion::logical_expr::expr::ScalarUDF;
+use datafusion::logical_expr::expr_rewriter::rewrite_preserving_name;
+use datafusion::logical_expr::{Aggregate, JoinType, LogicalPlan, LogicalPlanBuilder};
+use datafusion::optimizer::analyzer::AnalyzerRule;
+use datafusion::prelude::{col, count, lit, when, Expr};
+use datafusion::scalar::ScalarValue;
+
+use crate::extension::expr::expr_rewriter::ExprReplacer;
+use crate::extension::expr::expr_utils::find_exprs_in_exprs_deeply_nested;
+use crate::extension::expr::TOPTAGS;
+
+/// The group of the tag values out of the top n.
+const OTHER_TAGS: &str = "other";
+const TOP_TAG_COL_NAME: &str = "_top_tag";
+const TOP_TAG_COUNT_COL_NAME: &str = "_top_tag_count";
+
+/// Convert [`TOPTAGS`] in GROUP BY to the n tag values of the most rows, and
+/// [`OTHER_TAGS`] for the rest, e.g.
+///
+/// ```sql
+/// SELECT toptags(host, 10) AS host, avg(usage) FROM cpu GROUP BY host
+/// ```
+///
+/// returns at most 11 groups however many hosts there are. The rows of NULL
+/// tag are in [`OTHER_TAGS`].
+///
+/// ```text
+/// Aggregate: groupBy=[[toptags(host, n)]]
+///   input
+/// ->
+/// Aggregate: groupBy=[[CASE WHEN _top_tag IS NOT NULL THEN host ELSE 'other' END]]
+///   Left Join: host = _top_tag
+///     input
+///     Projection: host AS _top_tag
+///       Limit: fetch=n
+///         Sort: _top_tag_count DESC, host
+///           Aggregate: groupBy=[[host]], aggr=[[COUNT(1) AS _top_tag_count]]
+///             Filter: host IS NOT NULL
+///               input
+/// ```
+pub struct TransformTopTagsRule;
+
+impl AnalyzerRule for TransformTopTagsRule {
+    fn analyze(&self, plan: LogicalPlan, _config: &ConfigOptions) -> Result<LogicalPlan> {
+        plan.transform_up(&analyze_internal)
+    }
+
+    fn name(&self) -> &str {
+        "transform_toptags"
+    }
+}
+
+fn analyze_internal(plan: LogicalPlan) -> Result<Transformed<LogicalPlan>> {
+    let LogicalPlan::Aggregate(aggregate) = &plan else {
+        if !find_toptags_exprs(&plan.expressions()).is_empty() {
+            return Err(DataFusionError::Plan(format!(
+                "{TOPTAGS} can only be used in GROUP BY"
+            )));
+        }
+        return Ok(Transformed::No(plan));
+    };
+    if !find_toptags_exprs(&aggregate.aggr_expr).is_empty() {
+        return Err(DataFusionError::Plan(format!(
+            "{TOPTAGS} can only be used in GROUP BY"
+        )));
+    }
+
+    let mut toptags_exprs = find_toptags_exprs(&aggregate.group_expr);
+    if toptags_exprs.is_empty() {
+        return Ok(Transformed::No(plan));
+    }
+    // Only support a single toptags expression for now
+    if toptags_exprs.len() > 1 {
+        return Err(DataFusionError::Plan(format!(
+            "Only support a single {TOPTAGS} expression for now, but found: {toptags_exprs:?}"
+        )));
+    }
+    let (tag, n) = toptags_args(&toptags_exprs.remove(0))?;
+
+    let input = aggregate.input.as_ref().clone();
+    let top_tags = LogicalPlanBuilder::from(input.clone())
+        .filter(Expr::Column(tag.clone()).is_not_null())?
+        .aggregate(
+            vec![Expr::Column(tag.clone())],
+            vec![count(lit(1)).alias(TOP_TAG_COUNT_COL_NAME)],
+        )?
+        .sort(vec![
+            col(TOP_TAG_COUNT_COL_NAME).sort(false, false),
+            Expr::Column(tag.clone()).sort(true, false),
+        ])?
+        .limit(0, Some(n))?
+        .project(vec![Expr::Column(tag.clone()).alias(TOP_TAG_COL_NAME)])?
+        .build()?;
+    let input = LogicalPlanBuilder::from(input)
+        .join(
+            top_tags,
+            JoinType::Left,
+            (vec![tag.clone()], vec![Column::from_name(TOP_TAG_COL_NAME)]),
+            None,
+        )?
+        .build()?;
+
+    let group =
+        when(col(TOP_TAG_COL_NAME).is_not_null(), Expr::Column(tag)).otherwise(lit(OTHER_TAGS))?;
+    let replace = |expr: &Expr| is_toptags(expr).then(|| group.clone());
+    let mut replacer = ExprReplacer::new(&replace);
+    let group_expr = aggregate
+        .group_expr
+        .iter()
+        .map(|e| rewrite_preserving_name(e.clone(), &mut replacer))
+        .collect::<Result<Vec<_>>>()?;
+
+    Ok(Transformed::Yes(LogicalPlan::Aggregate(
+        Aggregate::try_new(Arc::new(input), group_expr, aggregate.aggr_expr.clone())?,
+    )))
+}
+
+fn is_toptags(expr: &Expr) -> bool {
+    matches!(expr, Expr::ScalarUDF(ScalarUDF { fun, .. }) if fun.name == TOPTAGS)
+}
+
+fn find_toptags_exprs(exprs: &[Expr]) -> Vec<Expr> {
+    find_exprs_in_exprs_deeply_nested(exprs, &is_toptags)
+}
+
+/// The tag column and the number of the tag values kept.
+fn toptags_args(expr: &Expr) -> Result<(Column, usize)> {
+    let Expr::ScalarUDF(ScalarUDF { args, .. }) = expr else {
+        return Err(DataFusionError::Internal(format!(
+            "Expected {TOPTAGS}, but found {expr}"
+        )));
+    };
+    let tag = match &args[0] {
+        Expr::Column(tag) => tag.clone(),
+        arg => {
+            return Err(DataFusionError::Plan(format!(
+                "{TOPTAGS} expect tag as the 1st argument, but found {arg}"
+            )))
+        }
+    };
+    let n = match &args[1] {
+        Expr::Literal(ScalarValue::Int64(Some(n))) if *n > 0 => *n as usize,
+        arg => {
+            return Err(DataFusionError::Plan(format!(
+                "{TOPTAGS} expect positive constant as the 2nd argument, but found {arg}"
+            )))
+        }
+    };
+
+    Ok((tag, n))
+}
+
+#[cfg(test)]
+mod tests {
+    use std::sync::Arc;
+
+    use datafusion::config::ConfigOptions;
+    use datafusion::datasource::MemTable;
+    use datafusion::optimizer::analyzer::AnalyzerRule;
+    use datafusion::prelude::SessionContext;
+    use models::arrow::{DataType, Field, Schema};
+
+    use super::TransformTopTagsRule;
+    use crate::extension::expr::func_manager::DFSessionContextFuncAdapter;
+    use crate::extension::expr::load_all_functions;
+
+    fn ctx() -> SessionContext {
+        let mut ctx = SessionContext::new();
+
+        let mem_table = MemTable::try_new(
+            Arc::new(Schema::new(vec![
+                Field::new("a", DataType::Int64, true),
+                Field::new("c", DataType::Utf8, true),
+            ])),
+            vec![],
+        )
+        .unwrap();
+        ctx.register_table("t", Arc::new(mem_table)).unwrap();
+
+        let mut func_manager = DFSessionContextFuncAdapter::new(&mut ctx);
+        load_all_functions(&mut func_manager).expect("load_all_functions");
+
+        ctx
+    }
+
+    #[tokio::test]
+    async fn test_transform_toptags() {
+        let df = ctx()
+            .sql("SELECT toptags(c, 2), count(a) FROM t GROUP BY toptags(c, 2)")
+            .await
+            .unwrap();
+        let plan = TransformTopTagsRule
+            .analyze(df.logical_plan().clone(), &ConfigOptions::default())
+            .unwrap();
+        assert_eq!(
+            format!("{plan:?}"),
+            "Projection: toptags(t.c,Int64(2)), COUNT(t.a)\
+                \n  Aggregate: groupBy=[[CASE WHEN _top_tag IS NOT NULL THEN t.c ELSE Utf8(\"other\") END AS toptags(t.c,Int64(2))]], aggr=[[COUNT(t.a)]]\
+                \n    Left Join: t.c = _top_tag\
+                \n      TableScan: t\
+                \n      Projection: t.c AS _top_tag\
+                \n        Limit: skip=0, fetch=2\
+                \n          Sort: _top_tag_count DESC NULLS LAST, t.c ASC NULLS LAST\
+                \n            Aggregate: groupBy=[[t.c]], aggr=[[COUNT(Int64(1)) AS _top_tag_count]]\
+                \n              Filter: t.c IS NOT NULL\
+                \n                TableScan: t"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_toptags_not_in_group_by() {
+        let df = ctx().sql("SELECT toptags(c, 2) FROM t").await.unwrap();
+        let result =
+            TransformTopTagsRule.analyze(df.logical_plan().clone(), &ConfigOptions::default());
+        assert!(result.is_err());
+    }
+}
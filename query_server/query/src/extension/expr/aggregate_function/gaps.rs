@@ -0,0 +1,283 @@
+use std::sync::Arc;
+
+use datafusion::arrow::array::{Array, ArrayRef, AsArray};
+use datafusion::arrow::compute::cast;
+use datafusion::arrow::datatypes::{
+    DataType, Field, Fields, Int64Type, IntervalDayTimeType, IntervalMonthDayNanoType, TimeUnit,
+};
+use datafusion::common::cast::as_list_array;
+use datafusion::common::{DataFusionError, Result as DFResult};
+use datafusion::logical_expr::{
+    AccumulatorFactoryFunction, AggregateUDF, ReturnTypeFunction, Signature, StateTypeFunction,
+    Volatility,
+};
+use datafusion::physical_plan::Accumulator;
+use datafusion::scalar::ScalarValue;
+use spi::query::function::FunctionMetadataManager;
+use spi::QueryResult;
+
+use super::GAPS_UDAF_NAME;
+use crate::extension::expr::INTERVALS;
+
+const NANOS_PER_DAY: i64 = 86_400_000_000_000;
+
+pub fn register_udaf(func_manager: &mut dyn FunctionMetadataManager) -> QueryResult<AggregateUDF> {
+    let udf = new();
+    func_manager.register_udaf(udf.clone())?;
+    Ok(udf)
+}
+
+/// gaps(time, field, threshold)
+///
+/// Returns the intervals longer than `threshold` between the consecutive points
+/// where `field` is not NULL, as a list of `{start, end}`, e.g. the periods a
+/// series stopped reporting:
+///
+/// ```sql
+/// SELECT station, gaps(time, temperature, interval '5 minutes') FROM air GROUP BY station
+/// ```
+///
+/// Only the gaps between two points are returned, restrict the time range of
+/// the query and compare with the last point to find a series that stopped.
+fn new() -> AggregateUDF {
+    let return_type_func: ReturnTypeFunction = Arc::new(move |input| {
+        if !matches!(input[0], DataType::Timestamp(_, _)) {
+            return Err(DataFusionError::Plan(format!(
+                "{GAPS_UDAF_NAME} expect Timestamp type as the 1st argument, but found {}",
+                &input[0]
+            )));
+        }
+        if !INTERVALS.iter().any(|t| t.eq(&input[2])) {
+            return Err(DataFusionError::Plan(format!(
+                "{GAPS_UDAF_NAME} expect Interval type as the 3rd argument, but found {}",
+                &input[2]
+            )));
+        }
+        Ok(Arc::new(gaps_type(&input[0])))
+    });
+
+    let state_type_func: StateTypeFunction = Arc::new(move |input, _| {
+        let times = DataType::List(Arc::new(Field::new("item", input[0].clone(), true)));
+        Ok(Arc::new(vec![times, DataType::Int64]))
+    });
+
+    let accumulator: AccumulatorFactoryFunction =
+        Arc::new(|input, _| Ok(Box::new(GapsAccumulator::try_new(input[0].clone())?)));
+
+    AggregateUDF::new(
+        GAPS_UDAF_NAME,
+        &Signature::any(3, Volatility::Immutable),
+        &return_type_func,
+        &accumulator,
+        &state_type_func,
+    )
+}
+
+fn gap_type(time_type: &DataType) -> DataType {
+    DataType::Struct(Fields::from([
+        Arc::new(Field::new("start", time_type.clone(), true)),
+        Arc::new(Field::new("end", time_type.clone(), true)),
+    ]))
+}
+
+fn gaps_type(time_type: &DataType) -> DataType {
+    DataType::List(Arc::new(Field::new("item", gap_type(time_type), true)))
+}
+
+#[derive(Debug)]
+struct GapsAccumulator {
+    time_type: DataType,
+    /// Timestamps of the points, in the unit of `time_type`.
+    times: Vec<i64>,
+    /// Nanoseconds, `None` until the first batch is read.
+    threshold: Option<i64>,
+}
+
+impl GapsAccumulator {
+    fn try_new(time_type: DataType) -> DFResult<Self> {
+        if !matches!(time_type, DataType::Timestamp(_, _)) {
+            return Err(DataFusionError::Internal(format!(
+                "{GAPS_UDAF_NAME} expect Timestamp type, but found {time_type}"
+            )));
+        }
+        Ok(Self {
+            time_type,
+            times: vec![],
+            threshold: None,
+        })
+    }
+
+    fn timestamp(&self, value: i64) -> ScalarValue {
+        match &self.time_type {
+            DataType::Timestamp(TimeUnit::Second, tz) => {
+                ScalarValue::TimestampSecond(Some(value), tz.clone())
+            }
+            DataType::Timestamp(TimeUnit::Millisecond, tz) => {
+                ScalarValue::TimestampMillisecond(Some(value), tz.clone())
+            }
+            DataType::Timestamp(TimeUnit::Microsecond, tz) => {
+                ScalarValue::TimestampMicrosecond(Some(value), tz.clone())
+            }
+            DataType::Timestamp(TimeUnit::Nanosecond, tz) => {
+                ScalarValue::TimestampNanosecond(Some(value), tz.clone())
+            }
+            _ => unreachable!("checked in GapsAccumulator::try_new"),
+        }
+    }
+
+    /// The threshold in the unit of the timestamps.
+    fn unit_threshold(&self, threshold: i64) -> i64 {
+        let nanos_per_unit = match &self.time_type {
+            DataType::Timestamp(TimeUnit::Second, _) => 1_000_000_000,
+            DataType::Timestamp(TimeUnit::Millisecond, _) => 1_000_000,
+            DataType::Timestamp(TimeUnit::Microsecond, _) => 1_000,
+            _ => 1,
+        };
+        threshold / nanos_per_unit
+    }
+}
+
+impl Accumulator for GapsAccumulator {
+    fn update_batch(&mut self, values: &[ArrayRef]) -> DFResult<()> {
+        if values[0].is_empty() {
+            return Ok(());
+        }
+        if self.threshold.is_none() {
+            let threshold = ScalarValue::try_from_array(values[2].as_ref(), 0)?;
+            self.threshold = Some(extract_threshold(&threshold)?);
+        }
+
+        let times = cast(values[0].as_ref(), &DataType::Int64)?;
+        let times = times.as_primitive::<Int64Type>();
+        let fields = values[1].as_ref();
+        for i in 0..times.len() {
+            if times.is_valid(i) && fields.is_valid(i) {
+                self.times.push(times.value(i));
+            }
+        }
+
+        Ok(())
+    }
+
+    fn merge_batch(&mut self, states: &[ArrayRef]) -> DFResult<()> {
+        let time_lists = as_list_array(states[0].as_ref())?;
+        let thresholds = states[1].as_primitive::<Int64Type>();
+
+        for (times, threshold) in time_lists.iter().zip(thresholds) {
+            if let Some(threshold) = threshold {
+                self.threshold.get_or_insert(threshold);
+            }
+            if let Some(times) = times {
+                let times = cast(times.as_ref(), &DataType::Int64)?;
+                self.times
+                    .extend(times.as_primitive::<Int64Type>().iter().flatten());
+            }
+        }
+
+        Ok(())
+    }
+
+    fn state(&self) -> DFResult<Vec<ScalarValue>> {
+        let times = self.times.iter().map(|t| self.timestamp(*t)).collect();
+        Ok(vec![
+            ScalarValue::new_list(Some(times), self.time_type.clone()),
+            ScalarValue::Int64(self.threshold),
+        ])
+    }
+
+    fn evaluate(&self) -> DFResult<ScalarValue> {
+        let gap_type = gap_type(&self.time_type);
+        let Some(threshold) = self.threshold else {
+            return Ok(ScalarValue::new_list(Some(vec![]), gap_type));
+        };
+        let DataType::Struct(fields) = &gap_type else {
+            unreachable!("gap_type is a struct");
+        };
+
+        let mut times = self.times.clone();
+        let gaps = find_gaps(&mut times, self.unit_threshold(threshold))
+            .into_iter()
+            .map(|(start, end)| {
+                ScalarValue::Struct(
+                    Some(vec![self.timestamp(start), self.timestamp(end)]),
+                    fields.clone(),
+                )
+            })
+            .collect();
+
+        Ok(ScalarValue::new_list(Some(gaps), gap_type))
+    }
+
+    fn size(&self) -> usize {
+        std::mem::size_of_val(self) + self.times.capacity() * std::mem::size_of::<i64>()
+    }
+}
+
+/// Returns the `(start, end)` of the intervals longer than `threshold`
+/// between the consecutive `times`.
+fn find_gaps(times: &mut [i64], threshold: i64) -> Vec<(i64, i64)> {
+    times.sort_unstable();
+    times
+        .windows(2)
+        .filter(|w| w[1] - w[0] > threshold)
+        .map(|w| (w[0], w[1]))
+        .collect()
+}
+
+/// The positive threshold in nanoseconds.
+fn extract_threshold(threshold: &ScalarValue) -> DFResult<i64> {
+    let nanos = match threshold {
+        ScalarValue::IntervalDayTime(Some(v)) => {
+            let (days, ms) = IntervalDayTimeType::to_parts(*v);
+            days as i64 * NANOS_PER_DAY + ms as i64 * 1_000_000
+        }
+        ScalarValue::IntervalMonthDayNano(Some(v)) => {
+            let (months, days, nanos) = IntervalMonthDayNanoType::to_parts(*v);
+            if months != 0 {
+                return Err(DataFusionError::Execution(format!(
+                    "{GAPS_UDAF_NAME} threshold can not contain months"
+                )));
+            }
+            days as i64 * NANOS_PER_DAY + nanos
+        }
+        v => {
+            return Err(DataFusionError::Execution(format!(
+                "{GAPS_UDAF_NAME} expect INTERVAL without months as threshold, but got {}",
+                v.get_datatype()
+            )))
+        }
+    };
+    if nanos <= 0 {
+        return Err(DataFusionError::Execution(format!(
+            "{GAPS_UDAF_NAME} threshold must be positive"
+        )));
+    }
+    Ok(nanos)
+}
+
+#[cfg(test)]
+mod test {
+    use datafusion::arrow::datatypes::IntervalDayTimeType;
+    use datafusion::scalar::ScalarValue;
+
+    use super::{extract_threshold, find_gaps};
+
+    #[test]
+    fn test_find_gaps() {
+        let mut times = vec![50, 0, 10, 20, 31, 51];
+        assert_eq!(find_gaps(&mut times, 10), vec![(20, 31), (31, 50)]);
+
+        assert!(find_gaps(&mut [], 10).is_empty());
+        assert!(find_gaps(&mut [0], 10).is_empty());
+    }
+
+    #[test]
+    fn test_extract_threshold() {
+        let minute = ScalarValue::IntervalDayTime(Some(IntervalDayTimeType::make_value(0, 60_000)));
+        assert_eq!(extract_threshold(&minute).unwrap(), 60_000_000_000);
+
+        let zero = ScalarValue::IntervalDayTime(Some(0));
+        assert!(extract_threshold(&zero).is_err());
+        assert!(extract_threshold(&ScalarValue::IntervalYearMonth(Some(1))).is_err());
+    }
+}
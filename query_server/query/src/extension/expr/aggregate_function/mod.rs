@@ -3,6 +3,7 @@ mod exact_count_agg;
 #[cfg(test)]
 mod example;
 mod first;
+mod gaps;
 mod gauge;
 mod increase;
 mod last;
@@ -33,6 +34,7 @@ pub const CONSISTENCY_UDF_NAME: &str = "consistency";
 pub const TIMELINESS_UDF_NAME: &str = "timeliness";
 pub const VALIDITY_UDF_NAME: &str = "validity";
 pub const EXACT_COUNT_UDAF_NAME: &str = "exact_count";
+pub const GAPS_UDAF_NAME: &str = "gaps";
 pub use gauge::GaugeData;
 pub use state_agg::StateAggData;
 
@@ -49,6 +51,7 @@ pub fn register_udafs(func_manager: &mut dyn FunctionMetadataManager) -> QueryRe
     increase::register_udaf(func_manager)?;
     data_quality::register_udafs(func_manager)?;
     exact_count_agg::register_udaf(func_manager)?;
+    gaps::register_udaf(func_manager)?;
     Ok(())
 }
 
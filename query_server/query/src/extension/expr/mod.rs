@@ -11,7 +11,10 @@ mod ts_gen_func;
 mod window;
 
 use datafusion::arrow::datatypes::{DataType, IntervalUnit};
-pub use scalar_function::{INTERPOLATE, LOCF, TIME_WINDOW_GAPFILL};
+pub use scalar_function::{
+    add_sample, is_sample, DATE_BIN_TZ, DATE_BIN_TZ_UDF, INTERPOLATE, LOCF, SAMPLE_PERCENT,
+    SAMPLE_SERIES, TIME_WINDOW_GAPFILL, TOPTAGS,
+};
 pub use selector_function::{BOTTOM, TOPK};
 pub use session_function::register_session_udfs;
 use spi::query::function::FunctionMetadataManager;
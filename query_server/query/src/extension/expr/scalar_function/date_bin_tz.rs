@@ -0,0 +1,401 @@
+use std::sync::Arc;
+
+use chrono::{
+    DateTime, Datelike, FixedOffset, LocalResult, NaiveDate, NaiveDateTime, Offset, TimeZone, Utc,
+};
+use datafusion::arrow::array::timezone::Tz;
+use datafusion::arrow::array::{Array, ArrayRef, TimestampNanosecondArray};
+use datafusion::arrow::compute::cast;
+use datafusion::arrow::datatypes::{
+    DataType, IntervalDayTimeType, IntervalMonthDayNanoType, TimeUnit,
+};
+use datafusion::error::{DataFusionError, Result as DFResult};
+use datafusion::logical_expr::type_coercion::aggregates::TIMESTAMPS;
+use datafusion::logical_expr::{
+    ReturnTypeFunction, ScalarFunctionImplementation, ScalarUDF, Signature, TypeSignature,
+    Volatility,
+};
+use datafusion::physical_plan::ColumnarValue;
+use datafusion::scalar::ScalarValue;
+use once_cell::sync::Lazy;
+use spi::query::function::FunctionMetadataManager;
+use spi::QueryResult;
+
+use super::DATE_BIN_TZ;
+use crate::extension::expr::INTERVALS;
+
+const NANOS_PER_DAY: i64 = 86_400_000_000_000;
+
+pub static DATE_BIN_TZ_UDF: Lazy<Arc<ScalarUDF>> = Lazy::new(|| Arc::new(new()));
+
+pub fn register_udf(func_manager: &mut dyn FunctionMetadataManager) -> QueryResult<ScalarUDF> {
+    let udf = new();
+    func_manager.register_udf(udf.clone())?;
+    Ok(udf)
+}
+
+/// date_bin_tz(stride, source, timezone[, origin])
+///
+/// Bins `source` into windows of `stride` aligned to the wall clock of `timezone`,
+/// so one day windows start at local midnight and month windows at the first day
+/// of the local month, also across DST transitions.
+///
+/// Windows are anchored at `origin`, the local unix epoch by default. Month windows
+/// only use the month of `origin`, e.g. quarters starting in February.
+fn new() -> ScalarUDF {
+    let return_type_fn: ReturnTypeFunction = Arc::new(|input| {
+        if !INTERVALS.iter().any(|t| t.eq(&input[0])) {
+            return Err(DataFusionError::Plan(format!(
+                "{DATE_BIN_TZ} expect Interval type as the 1st argument, but found {}",
+                &input[0]
+            )));
+        }
+        if !TIMESTAMPS.iter().any(|t| t.eq(&input[1])) {
+            return Err(DataFusionError::Plan(format!(
+                "{DATE_BIN_TZ} expect Timestamp type as the 2nd argument, but found {}",
+                &input[1]
+            )));
+        }
+        if !matches!(input[2], DataType::Utf8 | DataType::LargeUtf8) {
+            return Err(DataFusionError::Plan(format!(
+                "{DATE_BIN_TZ} expect String type as the 3rd argument, but found {}",
+                &input[2]
+            )));
+        }
+        if input.len() == 4 && !TIMESTAMPS.iter().any(|t| t.eq(&input[3])) {
+            return Err(DataFusionError::Plan(format!(
+                "{DATE_BIN_TZ} expect Timestamp type as the 4th argument, but found {}",
+                &input[3]
+            )));
+        }
+        Ok(Arc::new(input[1].clone()))
+    });
+
+    let fun: ScalarFunctionImplementation = Arc::new(date_bin_tz);
+
+    ScalarUDF::new(
+        DATE_BIN_TZ,
+        &Signature::one_of(
+            vec![TypeSignature::Any(3), TypeSignature::Any(4)],
+            Volatility::Immutable,
+        ),
+        &return_type_fn,
+        &fun,
+    )
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Stride {
+    Months(i64),
+    Nanos(i64),
+}
+
+fn date_bin_tz(args: &[ColumnarValue]) -> DFResult<ColumnarValue> {
+    let stride = extract_stride(&args[0])?;
+    let tz = extract_timezone(&args[2])?;
+    let origin = args.get(3).map(extract_origin).transpose()?;
+
+    let (source, is_scalar) = match &args[1] {
+        ColumnarValue::Array(array) => (array.clone(), false),
+        ColumnarValue::Scalar(scalar) => (scalar.to_array(), true),
+    };
+    let result = bin_array(stride, &tz, origin, &source)?;
+
+    if is_scalar {
+        Ok(ColumnarValue::Scalar(ScalarValue::try_from_array(
+            &result, 0,
+        )?))
+    } else {
+        Ok(ColumnarValue::Array(result))
+    }
+}
+
+fn bin_array(
+    stride: Stride,
+    tz: &Tz,
+    origin: Option<i64>,
+    source: &ArrayRef,
+) -> DFResult<ArrayRef> {
+    let nanos = cast(source, &DataType::Timestamp(TimeUnit::Nanosecond, None))?;
+    let nanos = nanos
+        .as_any()
+        .downcast_ref::<TimestampNanosecondArray>()
+        .ok_or_else(|| {
+            DataFusionError::Internal(format!("{DATE_BIN_TZ} failed to cast source timestamps"))
+        })?;
+
+    let binned = nanos
+        .iter()
+        .map(|ts| {
+            ts.map(|ts| bin_timestamp(stride, tz, origin, ts))
+                .transpose()
+        })
+        .collect::<DFResult<TimestampNanosecondArray>>()?;
+
+    Ok(cast(&(Arc::new(binned) as ArrayRef), source.data_type())?)
+}
+
+fn to_naive(ts: i64) -> DFResult<NaiveDateTime> {
+    NaiveDateTime::from_timestamp_opt(
+        ts.div_euclid(1_000_000_000),
+        ts.rem_euclid(1_000_000_000) as u32,
+    )
+    .ok_or_else(|| DataFusionError::Execution(format!("Timestamp {ts} is out of range")))
+}
+
+/// Returns the wall clock time of `ts` in `tz` and the offset used.
+fn to_local(tz: &Tz, ts: i64) -> DFResult<(NaiveDateTime, FixedOffset)> {
+    let utc = to_naive(ts)?;
+    let offset = tz.offset_from_utc_datetime(&utc).fix();
+    Ok((utc + offset, offset))
+}
+
+/// Months since 1970-01 of the wall clock time.
+fn month_index(local: &NaiveDateTime) -> i64 {
+    (local.year() as i64 - 1970) * 12 + local.month0() as i64
+}
+
+fn local_nanos(local: &NaiveDateTime) -> DFResult<i64> {
+    local
+        .timestamp_nanos_opt()
+        .ok_or_else(|| DataFusionError::Execution(format!("Timestamp {local} is out of range")))
+}
+
+/// Returns the UTC start, in nanoseconds, of the local window containing `ts`.
+fn bin_timestamp(stride: Stride, tz: &Tz, origin: Option<i64>, ts: i64) -> DFResult<i64> {
+    let (local, offset) = to_local(tz, ts)?;
+    let local_origin = origin.map(|origin| to_local(tz, origin)).transpose()?;
+
+    let local_start = match stride {
+        Stride::Months(months) => {
+            let total = month_index(&local);
+            let origin = local_origin.map(|(o, _)| month_index(&o)).unwrap_or(0);
+            let start = total - (total - origin).rem_euclid(months);
+            let year = 1970 + start.div_euclid(12);
+            let month = start.rem_euclid(12) + 1;
+            NaiveDate::from_ymd_opt(year as i32, month as u32, 1)
+                .and_then(|date| date.and_hms_opt(0, 0, 0))
+                .ok_or_else(|| {
+                    DataFusionError::Execution(format!("Timestamp {ts} is out of range"))
+                })?
+        }
+        Stride::Nanos(stride) => {
+            let local_ns = local_nanos(&local)?;
+            let origin = match local_origin {
+                Some((o, _)) => local_nanos(&o)?,
+                None => 0,
+            };
+            to_naive(local_ns - (local_ns - origin).rem_euclid(stride))?
+        }
+    };
+
+    let start: DateTime<Utc> = match tz.from_local_datetime(&local_start) {
+        LocalResult::Single(start) => start.with_timezone(&Utc),
+        // The window starts in a repeated hour (DST ends), keep the offset of the source
+        // when possible so that the window contains it.
+        LocalResult::Ambiguous(earliest, latest) => {
+            if latest.offset().fix() == offset && latest.timestamp_nanos_opt() <= Some(ts) {
+                latest.with_timezone(&Utc)
+            } else {
+                earliest.with_timezone(&Utc)
+            }
+        }
+        // The window starts in a skipped hour (DST starts), shift it by the offset before
+        // the transition.
+        LocalResult::None => {
+            let before = tz.offset_from_utc_datetime(&(local_start - offset)).fix();
+            Utc.from_utc_datetime(&(local_start - before))
+        }
+    };
+
+    start
+        .timestamp_nanos_opt()
+        .ok_or_else(|| DataFusionError::Execution(format!("Timestamp {ts} is out of range")))
+}
+
+fn extract_stride(stride: &ColumnarValue) -> DFResult<Stride> {
+    let (months, nanos) = match stride {
+        ColumnarValue::Scalar(ScalarValue::IntervalYearMonth(Some(months))) => (*months as i64, 0),
+        ColumnarValue::Scalar(ScalarValue::IntervalDayTime(Some(v))) => {
+            let (days, ms) = IntervalDayTimeType::to_parts(*v);
+            (0, days as i64 * NANOS_PER_DAY + ms as i64 * 1_000_000)
+        }
+        ColumnarValue::Scalar(ScalarValue::IntervalMonthDayNano(Some(v))) => {
+            let (months, days, nanos) = IntervalMonthDayNanoType::to_parts(*v);
+            (months as i64, days as i64 * NANOS_PER_DAY + nanos)
+        }
+        ColumnarValue::Scalar(v) => {
+            return Err(DataFusionError::Execution(format!(
+                "{DATE_BIN_TZ} expect INTERVAL as stride, but got {}",
+                v.get_datatype()
+            )))
+        }
+        ColumnarValue::Array(_) => {
+            return Err(DataFusionError::NotImplemented(format!(
+                "{DATE_BIN_TZ} only support constant stride"
+            )))
+        }
+    };
+
+    match (months, nanos) {
+        (months, 0) if months > 0 => Ok(Stride::Months(months)),
+        (0, nanos) if nanos > 0 => Ok(Stride::Nanos(nanos)),
+        _ => Err(DataFusionError::Execution(format!(
+            "{DATE_BIN_TZ} stride must be positive and can not mix months with days or time"
+        ))),
+    }
+}
+
+fn extract_origin(origin: &ColumnarValue) -> DFResult<i64> {
+    match origin {
+        ColumnarValue::Scalar(v @ ScalarValue::TimestampSecond(..))
+        | ColumnarValue::Scalar(v @ ScalarValue::TimestampMillisecond(..))
+        | ColumnarValue::Scalar(v @ ScalarValue::TimestampMicrosecond(..))
+        | ColumnarValue::Scalar(v @ ScalarValue::TimestampNanosecond(..)) => {
+            match v.cast_to(&DataType::Timestamp(TimeUnit::Nanosecond, None))? {
+                ScalarValue::TimestampNanosecond(Some(origin), _) => Ok(origin),
+                _ => Err(DataFusionError::Execution(format!(
+                    "{DATE_BIN_TZ} origin can not be NULL"
+                ))),
+            }
+        }
+        ColumnarValue::Scalar(v) => Err(DataFusionError::Execution(format!(
+            "{DATE_BIN_TZ} expect TIMESTAMP as origin, but got {}",
+            v.get_datatype()
+        ))),
+        ColumnarValue::Array(_) => Err(DataFusionError::NotImplemented(format!(
+            "{DATE_BIN_TZ} only support constant origin"
+        ))),
+    }
+}
+
+fn extract_timezone(timezone: &ColumnarValue) -> DFResult<Tz> {
+    match timezone {
+        ColumnarValue::Scalar(ScalarValue::Utf8(Some(tz)))
+        | ColumnarValue::Scalar(ScalarValue::LargeUtf8(Some(tz))) => tz
+            .parse::<Tz>()
+            .map_err(|e| DataFusionError::Execution(format!("Invalid timezone '{tz}': {e}"))),
+        ColumnarValue::Scalar(v) => Err(DataFusionError::Execution(format!(
+            "{DATE_BIN_TZ} expect STRING as timezone, but got {}",
+            v.get_datatype()
+        ))),
+        ColumnarValue::Array(_) => Err(DataFusionError::NotImplemented(format!(
+            "{DATE_BIN_TZ} only support constant timezone"
+        ))),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use chrono::{DateTime, Utc};
+    use datafusion::arrow::array::timezone::Tz;
+
+    use super::{bin_timestamp, Stride, NANOS_PER_DAY};
+
+    fn ns(rfc3339: &str) -> i64 {
+        DateTime::parse_from_rfc3339(rfc3339)
+            .unwrap()
+            .with_timezone(&Utc)
+            .timestamp_nanos_opt()
+            .unwrap()
+    }
+
+    #[test]
+    fn test_bin_by_day_across_dst() {
+        let tz: Tz = "America/New_York".parse().unwrap();
+        let day = Stride::Nanos(NANOS_PER_DAY);
+
+        // before DST starts, EST(-05:00)
+        assert_eq!(
+            bin_timestamp(day, &tz, None, ns("2023-03-11T12:00:00Z")).unwrap(),
+            ns("2023-03-11T05:00:00Z")
+        );
+        // DST starts at 2023-03-12T07:00:00Z, the day is only 23 hours long
+        assert_eq!(
+            bin_timestamp(day, &tz, None, ns("2023-03-12T12:00:00Z")).unwrap(),
+            ns("2023-03-12T05:00:00Z")
+        );
+        assert_eq!(
+            bin_timestamp(day, &tz, None, ns("2023-03-13T03:59:59Z")).unwrap(),
+            ns("2023-03-12T05:00:00Z")
+        );
+        // after DST starts, EDT(-04:00)
+        assert_eq!(
+            bin_timestamp(day, &tz, None, ns("2023-03-13T04:00:00Z")).unwrap(),
+            ns("2023-03-13T04:00:00Z")
+        );
+        // DST ends at 2023-11-05T06:00:00Z, the day is 25 hours long
+        assert_eq!(
+            bin_timestamp(day, &tz, None, ns("2023-11-06T04:59:59Z")).unwrap(),
+            ns("2023-11-05T04:00:00Z")
+        );
+    }
+
+    #[test]
+    fn test_bin_by_hour_in_repeated_hour() {
+        let tz: Tz = "America/New_York".parse().unwrap();
+        let hour = Stride::Nanos(3_600_000_000_000);
+
+        // 01:30 EDT
+        assert_eq!(
+            bin_timestamp(hour, &tz, None, ns("2023-11-05T05:30:00Z")).unwrap(),
+            ns("2023-11-05T05:00:00Z")
+        );
+        // 01:30 EST
+        assert_eq!(
+            bin_timestamp(hour, &tz, None, ns("2023-11-05T06:30:00Z")).unwrap(),
+            ns("2023-11-05T06:00:00Z")
+        );
+    }
+
+    #[test]
+    fn test_bin_by_month() {
+        let tz: Tz = "America/New_York".parse().unwrap();
+
+        assert_eq!(
+            bin_timestamp(Stride::Months(1), &tz, None, ns("2023-11-15T12:00:00Z")).unwrap(),
+            ns("2023-11-01T04:00:00Z")
+        );
+        // still October in local time
+        assert_eq!(
+            bin_timestamp(Stride::Months(1), &tz, None, ns("2023-11-01T03:00:00Z")).unwrap(),
+            ns("2023-10-01T04:00:00Z")
+        );
+        assert_eq!(
+            bin_timestamp(Stride::Months(3), &tz, None, ns("2023-02-15T00:00:00Z")).unwrap(),
+            ns("2023-01-01T05:00:00Z")
+        );
+        assert_eq!(
+            bin_timestamp(Stride::Months(12), &tz, None, ns("1969-07-01T00:00:00Z")).unwrap(),
+            ns("1969-01-01T05:00:00Z")
+        );
+    }
+
+    #[test]
+    fn test_bin_with_origin() {
+        let tz: Tz = "UTC".parse().unwrap();
+        let week = Stride::Nanos(7 * NANOS_PER_DAY);
+
+        // 1970-01-01 is a Thursday
+        assert_eq!(
+            bin_timestamp(week, &tz, None, ns("2024-01-03T12:00:00Z")).unwrap(),
+            ns("2023-12-28T00:00:00Z")
+        );
+        // ISO week, starts on Monday
+        let monday = Some(ns("1970-01-05T00:00:00Z"));
+        assert_eq!(
+            bin_timestamp(week, &tz, monday, ns("2024-01-03T12:00:00Z")).unwrap(),
+            ns("2024-01-01T00:00:00Z")
+        );
+        // quarters starting in February, the day of origin is ignored
+        let february = Some(ns("2000-02-15T00:00:00Z"));
+        assert_eq!(
+            bin_timestamp(Stride::Months(3), &tz, february, ns("2024-01-31T00:00:00Z")).unwrap(),
+            ns("2023-11-01T00:00:00Z")
+        );
+        assert_eq!(
+            bin_timestamp(Stride::Months(3), &tz, february, ns("2024-02-01T00:00:00Z")).unwrap(),
+            ns("2024-02-01T00:00:00Z")
+        );
+    }
+}
@@ -0,0 +1,130 @@
+use std::sync::Arc;
+
+use datafusion::arrow::array::{Array, ArrayRef, AsArray};
+use datafusion::arrow::compute::kernels::zip::zip;
+use datafusion::arrow::compute::{cast, prep_null_mask_filter};
+use datafusion::arrow::datatypes::DataType;
+use datafusion::error::{DataFusionError, Result as DFResult};
+use datafusion::logical_expr::type_coercion::binary::comparison_coercion;
+use datafusion::logical_expr::{
+    ReturnTypeFunction, ScalarFunctionImplementation, ScalarUDF, Signature, Volatility,
+};
+use datafusion::physical_plan::ColumnarValue;
+use datafusion::scalar::ScalarValue;
+use spi::query::function::FunctionMetadataManager;
+use spi::QueryResult;
+
+use super::IF;
+
+pub fn register_udf(func_manager: &mut dyn FunctionMetadataManager) -> QueryResult<ScalarUDF> {
+    let udf = new();
+    func_manager.register_udf(udf.clone())?;
+    Ok(udf)
+}
+
+/// if(condition, then, else)
+///
+/// Returns `then` if `condition` is true, otherwise `else`, the same as
+/// `CASE WHEN condition THEN then ELSE else END`. NULL condition is false.
+fn new() -> ScalarUDF {
+    let return_type_fn: ReturnTypeFunction =
+        Arc::new(|input| Ok(Arc::new(return_type(&input[0], &input[1], &input[2])?)));
+
+    let fun: ScalarFunctionImplementation = Arc::new(if_func);
+
+    ScalarUDF::new(
+        IF,
+        &Signature::any(3, Volatility::Immutable),
+        &return_type_fn,
+        &fun,
+    )
+}
+
+/// The type both `then` and `else` are coerced to.
+fn return_type(condition: &DataType, then: &DataType, otherwise: &DataType) -> DFResult<DataType> {
+    if !matches!(condition, DataType::Boolean | DataType::Null) {
+        return Err(DataFusionError::Plan(format!(
+            "{IF} expect Boolean type as the 1st argument, but found {condition}"
+        )));
+    }
+    comparison_coercion(then, otherwise).ok_or_else(|| {
+        DataFusionError::Plan(format!(
+            "{IF} can not coerce {then} and {otherwise} to a common type"
+        ))
+    })
+}
+
+fn if_func(args: &[ColumnarValue]) -> DFResult<ColumnarValue> {
+    let return_type = return_type(
+        &args[0].data_type(),
+        &args[1].data_type(),
+        &args[2].data_type(),
+    )?;
+
+    let len = args.iter().find_map(|arg| match arg {
+        ColumnarValue::Array(array) => Some(array.len()),
+        ColumnarValue::Scalar(_) => None,
+    });
+    let to_array = |arg: &ColumnarValue| match arg {
+        ColumnarValue::Array(array) => array.clone(),
+        ColumnarValue::Scalar(scalar) => scalar.to_array_of_size(len.unwrap_or(1)),
+    };
+
+    let condition = cast(&to_array(&args[0]), &DataType::Boolean)?;
+    let then = cast(&to_array(&args[1]), &return_type)?;
+    let otherwise = cast(&to_array(&args[2]), &return_type)?;
+    let result = select(&condition, &then, &otherwise)?;
+
+    match len {
+        Some(_) => Ok(ColumnarValue::Array(result)),
+        None => Ok(ColumnarValue::Scalar(ScalarValue::try_from_array(
+            &result, 0,
+        )?)),
+    }
+}
+
+/// Selects the rows of `then` where `condition` is true, the rows of `else`
+/// otherwise.
+fn select(condition: &ArrayRef, then: &ArrayRef, otherwise: &ArrayRef) -> DFResult<ArrayRef> {
+    let condition = condition.as_boolean();
+    let mask = if condition.null_count() > 0 {
+        prep_null_mask_filter(condition)
+    } else {
+        condition.clone()
+    };
+    Ok(zip(&mask, then.as_ref(), otherwise.as_ref())?)
+}
+
+#[cfg(test)]
+mod tests {
+    use std::sync::Arc;
+
+    use datafusion::arrow::array::{ArrayRef, BooleanArray, StringArray};
+    use datafusion::arrow::datatypes::DataType;
+
+    use super::{return_type, select};
+
+    #[test]
+    fn test_return_type() {
+        assert_eq!(
+            return_type(&DataType::Boolean, &DataType::Int64, &DataType::Float64).unwrap(),
+            DataType::Float64
+        );
+        assert_eq!(
+            return_type(&DataType::Boolean, &DataType::Utf8, &DataType::Null).unwrap(),
+            DataType::Utf8
+        );
+        assert!(return_type(&DataType::Int64, &DataType::Utf8, &DataType::Utf8).is_err());
+    }
+
+    #[test]
+    fn test_select() {
+        let condition: ArrayRef = Arc::new(BooleanArray::from(vec![Some(true), Some(false), None]));
+        let then: ArrayRef = Arc::new(StringArray::from(vec!["slow", "slow", "slow"]));
+        let otherwise: ArrayRef = Arc::new(StringArray::from(vec!["ok", "ok", "ok"]));
+
+        let result = select(&condition, &then, &otherwise).unwrap();
+        let expected: ArrayRef = Arc::new(StringArray::from(vec!["slow", "ok", "ok"]));
+        assert_eq!(&result, &expected);
+    }
+}
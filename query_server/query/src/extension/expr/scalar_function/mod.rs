@@ -1,12 +1,17 @@
+mod date_bin_tz;
 mod duration_in;
 #[cfg(test)]
 mod example;
 mod gapfill;
 mod gauge;
 mod gis;
+mod if_func;
 mod interpolate;
 mod locf;
+mod regexp_extract;
+mod sample;
 mod state_at;
+mod toptags;
 mod utils;
 
 use std::sync::Arc;
@@ -16,13 +21,21 @@ use datafusion::logical_expr::ScalarFunctionImplementation;
 use spi::query::function::FunctionMetadataManager;
 use spi::QueryResult;
 
+pub use self::date_bin_tz::DATE_BIN_TZ_UDF;
+pub use self::sample::{add_sample, is_sample};
 use super::ts_gen_func::TSGenFunc;
 
 pub const TIME_WINDOW_GAPFILL: &str = "time_window_gapfill";
 pub const LOCF: &str = "locf";
 pub const INTERPOLATE: &str = "interpolate";
 pub const DURATION_IN: &str = "duration_in";
+pub const DATE_BIN_TZ: &str = "date_bin_tz";
 pub const STATE_AT: &str = "state_at";
+pub const REGEXP_EXTRACT: &str = "regexp_extract";
+pub const IF: &str = "if";
+pub const TOPTAGS: &str = "toptags";
+pub const SAMPLE_PERCENT: &str = "sample_percent";
+pub const SAMPLE_SERIES: &str = "sample_series";
 
 pub fn register_udfs(func_manager: &mut dyn FunctionMetadataManager) -> QueryResult<()> {
     // extend function...
@@ -33,7 +46,12 @@ pub fn register_udfs(func_manager: &mut dyn FunctionMetadataManager) -> QueryRes
     interpolate::register_udf(func_manager)?;
     gauge::register_udfs(func_manager)?;
     duration_in::register_udf(func_manager)?;
+    date_bin_tz::register_udf(func_manager)?;
     state_at::register_udf(func_manager)?;
+    regexp_extract::register_udf(func_manager)?;
+    if_func::register_udf(func_manager)?;
+    toptags::register_udf(func_manager)?;
+    sample::register_udfs(func_manager)?;
     gis::register_udfs(func_manager)?;
     TSGenFunc::register_all_udf(func_manager)?;
     Ok(())
@@ -0,0 +1,143 @@
+use std::sync::Arc;
+
+use datafusion::arrow::array::{Array, ArrayRef, AsArray, StringArray};
+use datafusion::arrow::datatypes::DataType;
+use datafusion::error::{DataFusionError, Result as DFResult};
+use datafusion::logical_expr::{
+    ReturnTypeFunction, ScalarFunctionImplementation, ScalarUDF, Signature, TypeSignature,
+    Volatility,
+};
+use datafusion::physical_plan::ColumnarValue;
+use datafusion::scalar::ScalarValue;
+use regex::Regex;
+use spi::query::function::FunctionMetadataManager;
+use spi::QueryResult;
+
+use super::REGEXP_EXTRACT;
+
+pub fn register_udf(func_manager: &mut dyn FunctionMetadataManager) -> QueryResult<ScalarUDF> {
+    let udf = new();
+    func_manager.register_udf(udf.clone())?;
+    Ok(udf)
+}
+
+/// regexp_extract(str, pattern[, group])
+///
+/// Returns the capture group `group` of the first match of `pattern` in `str`,
+/// the 1st group by default and the whole match if `group` is 0. Returns NULL
+/// if `str` doesn't match.
+fn new() -> ScalarUDF {
+    let return_type_fn: ReturnTypeFunction = Arc::new(|_| Ok(Arc::new(DataType::Utf8)));
+
+    let fun: ScalarFunctionImplementation = Arc::new(regexp_extract);
+
+    ScalarUDF::new(
+        REGEXP_EXTRACT,
+        &Signature::one_of(
+            vec![
+                TypeSignature::Exact(vec![DataType::Utf8, DataType::Utf8]),
+                TypeSignature::Exact(vec![DataType::Utf8, DataType::Utf8, DataType::Int64]),
+            ],
+            Volatility::Immutable,
+        ),
+        &return_type_fn,
+        &fun,
+    )
+}
+
+fn regexp_extract(args: &[ColumnarValue]) -> DFResult<ColumnarValue> {
+    let regex = extract_pattern(&args[1])?;
+    let group = args.get(2).map(extract_group).transpose()?.unwrap_or(1);
+    if group >= regex.captures_len() {
+        return Err(DataFusionError::Execution(format!(
+            "{REGEXP_EXTRACT} pattern '{regex}' has {} groups, but got group {group}",
+            regex.captures_len() - 1
+        )));
+    }
+
+    match &args[0] {
+        ColumnarValue::Array(array) => {
+            Ok(ColumnarValue::Array(extract_array(&regex, group, array)?))
+        }
+        ColumnarValue::Scalar(ScalarValue::Utf8(value)) => Ok(ColumnarValue::Scalar(
+            ScalarValue::Utf8(value.as_deref().and_then(|v| extract(&regex, group, v))),
+        )),
+        ColumnarValue::Scalar(v) => Err(DataFusionError::Execution(format!(
+            "{REGEXP_EXTRACT} expect STRING as the 1st argument, but got {}",
+            v.get_datatype()
+        ))),
+    }
+}
+
+fn extract_array(regex: &Regex, group: usize, array: &ArrayRef) -> DFResult<ArrayRef> {
+    if array.data_type() != &DataType::Utf8 {
+        return Err(DataFusionError::Execution(format!(
+            "{REGEXP_EXTRACT} expect STRING as the 1st argument, but got {}",
+            array.data_type()
+        )));
+    }
+    let result = array
+        .as_string::<i32>()
+        .iter()
+        .map(|v| v.and_then(|v| extract(regex, group, v)))
+        .collect::<StringArray>();
+    Ok(Arc::new(result))
+}
+
+fn extract(regex: &Regex, group: usize, value: &str) -> Option<String> {
+    regex
+        .captures(value)
+        .and_then(|c| c.get(group))
+        .map(|m| m.as_str().to_string())
+}
+
+fn extract_pattern(pattern: &ColumnarValue) -> DFResult<Regex> {
+    match pattern {
+        ColumnarValue::Scalar(ScalarValue::Utf8(Some(pattern))) => Regex::new(pattern)
+            .map_err(|e| DataFusionError::Execution(format!("Invalid pattern '{pattern}': {e}"))),
+        ColumnarValue::Scalar(v) => Err(DataFusionError::Execution(format!(
+            "{REGEXP_EXTRACT} expect STRING as pattern, but got {}",
+            v.get_datatype()
+        ))),
+        ColumnarValue::Array(_) => Err(DataFusionError::NotImplemented(format!(
+            "{REGEXP_EXTRACT} only support constant pattern"
+        ))),
+    }
+}
+
+fn extract_group(group: &ColumnarValue) -> DFResult<usize> {
+    match group {
+        ColumnarValue::Scalar(ScalarValue::Int64(Some(group))) if *group >= 0 => {
+            Ok(*group as usize)
+        }
+        ColumnarValue::Scalar(v) => Err(DataFusionError::Execution(format!(
+            "{REGEXP_EXTRACT} expect non-negative BIGINT as group, but got {v}"
+        ))),
+        ColumnarValue::Array(_) => Err(DataFusionError::NotImplemented(format!(
+            "{REGEXP_EXTRACT} only support constant group"
+        ))),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use regex::Regex;
+
+    use super::extract;
+
+    #[test]
+    fn test_extract() {
+        let regex = Regex::new(r"(\w+)-(\d+)").unwrap();
+        assert_eq!(
+            extract(&regex, 0, "host: web-01"),
+            Some("web-01".to_string())
+        );
+        assert_eq!(extract(&regex, 1, "host: web-01"), Some("web".to_string()));
+        assert_eq!(extract(&regex, 2, "host: web-01"), Some("01".to_string()));
+        assert_eq!(extract(&regex, 1, "host: web"), None);
+
+        // the optional group doesn't participate in the match
+        let regex = Regex::new(r"(\w+)(-\d+)?").unwrap();
+        assert_eq!(extract(&regex, 2, "web"), None);
+    }
+}
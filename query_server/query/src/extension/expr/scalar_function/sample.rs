@@ -0,0 +1,107 @@
+use std::sync::Arc;
+
+use datafusion::arrow::datatypes::DataType;
+use datafusion::error::{DataFusionError, Result as DFResult};
+use datafusion::logical_expr::expr::ScalarUDF as ScalarUDFExpr;
+use datafusion::logical_expr::{
+    ReturnTypeFunction, ScalarFunctionImplementation, ScalarUDF, Signature, TypeSignature,
+    Volatility,
+};
+use datafusion::prelude::Expr;
+use datafusion::scalar::ScalarValue;
+use models::predicate::Sample;
+use spi::query::function::FunctionMetadataManager;
+use spi::QueryResult;
+
+use super::{SAMPLE_PERCENT, SAMPLE_SERIES};
+
+pub fn register_udfs(func_manager: &mut dyn FunctionMetadataManager) -> QueryResult<()> {
+    func_manager.register_udf(new(
+        SAMPLE_PERCENT,
+        Signature::one_of(
+            vec![
+                TypeSignature::Exact(vec![DataType::Int64]),
+                TypeSignature::Exact(vec![DataType::Float64]),
+            ],
+            Volatility::Volatile,
+        ),
+    ))?;
+    func_manager.register_udf(new(
+        SAMPLE_SERIES,
+        Signature::exact(vec![DataType::Int64], Volatility::Volatile),
+    ))?;
+    Ok(())
+}
+
+/// sample_percent(percent), sample_series(n)
+///
+/// Only used as the conditions of WHERE, taken by the scan of the tskv table
+/// while the rows are read, see [`Sample`].
+fn new(name: &'static str, signature: Signature) -> ScalarUDF {
+    let return_type_fn: ReturnTypeFunction = Arc::new(|_| Ok(Arc::new(DataType::Boolean)));
+    let fun: ScalarFunctionImplementation = Arc::new(move |_| {
+        Err(DataFusionError::Execution(format!(
+            "{name} can only be used as a condition of WHERE on a table of tskv"
+        )))
+    });
+
+    ScalarUDF::new(name, &signature, &return_type_fn, &fun)
+}
+
+/// Adds the sample of the condition to `sample`, returns false if the
+/// condition is not a sample function.
+pub fn add_sample(expr: &Expr, sample: &mut Sample) -> DFResult<bool> {
+    let Expr::ScalarUDF(ScalarUDFExpr { fun, args }) = expr else {
+        return Ok(false);
+    };
+    match (fun.name.as_str(), args.as_slice()) {
+        (SAMPLE_PERCENT, [arg]) => {
+            let percent = match arg {
+                Expr::Literal(ScalarValue::Int64(Some(v))) => *v as f64,
+                Expr::Literal(ScalarValue::Float64(Some(v))) => *v,
+                _ => f64::NAN,
+            };
+            if !(percent > 0.0 && percent <= 100.0) {
+                return Err(DataFusionError::Plan(format!(
+                    "{SAMPLE_PERCENT} expect a constant in (0, 100] as the argument, but found {arg}"
+                )));
+            }
+            // the rows are sampled by each condition
+            sample.percent = Some(sample.percent.map_or(percent, |p| p * percent / 100.0));
+            Ok(true)
+        }
+        (SAMPLE_SERIES, [arg]) => {
+            let Expr::Literal(ScalarValue::Int64(Some(n))) = arg else {
+                return Err(DataFusionError::Plan(format!(
+                    "{SAMPLE_SERIES} expect a positive constant as the argument, but found {arg}"
+                )));
+            };
+            if *n <= 0 {
+                return Err(DataFusionError::Plan(format!(
+                    "{SAMPLE_SERIES} expect a positive constant as the argument, but found {n}"
+                )));
+            }
+            // the series are sampled by each condition
+            let n = *n as u64;
+            sample.series_modulus = Some(sample.series_modulus.map_or(n, |m| lcm(m, n)));
+            Ok(true)
+        }
+        _ => Ok(false),
+    }
+}
+
+fn lcm(a: u64, b: u64) -> u64 {
+    let (mut x, mut y) = (a, b);
+    while y != 0 {
+        (x, y) = (y, x % y);
+    }
+    a / x * b
+}
+
+pub fn is_sample(expr: &Expr) -> bool {
+    matches!(
+        expr,
+        Expr::ScalarUDF(ScalarUDFExpr { fun, .. })
+            if fun.name == SAMPLE_PERCENT || fun.name == SAMPLE_SERIES
+    )
+}
@@ -0,0 +1,36 @@
+use std::sync::Arc;
+
+use datafusion::arrow::datatypes::DataType;
+use datafusion::error::DataFusionError;
+use datafusion::logical_expr::{ReturnTypeFunction, ScalarUDF, Signature, Volatility};
+use spi::query::function::FunctionMetadataManager;
+use spi::QueryResult;
+
+use super::{unimplemented_scalar_impl, TOPTAGS};
+
+pub fn register_udf(func_manager: &mut dyn FunctionMetadataManager) -> QueryResult<ScalarUDF> {
+    let udf = new();
+    func_manager.register_udf(udf.clone())?;
+    Ok(udf)
+}
+
+/// toptags(tag, n)
+///
+/// Only used in GROUP BY, replaced by the analyzer rule `TransformTopTagsRule`.
+fn new() -> ScalarUDF {
+    let return_type_fn: ReturnTypeFunction = Arc::new(|args| {
+        if args[0] != DataType::Utf8 {
+            return Err(DataFusionError::Plan(format!(
+                "{TOPTAGS} expect tag as the 1st argument, but found {}",
+                args[0]
+            )));
+        }
+        Ok(Arc::new(DataType::Utf8))
+    });
+    ScalarUDF::new(
+        TOPTAGS,
+        &Signature::exact(vec![DataType::Utf8, DataType::Int64], Volatility::Immutable),
+        &return_type_fn,
+        &unimplemented_scalar_impl(TOPTAGS),
+    )
+}
@@ -0,0 +1,255 @@
+use std::collections::VecDeque;
+
+use serde::Deserialize;
+use spi::DFResult;
+
+use crate::extension::expr::ts_gen_func::utils::get_arg;
+
+/// Scales the median absolute deviation to the standard deviation of the
+/// normal distribution.
+const MAD_SCALE: f64 = 1.4826;
+/// Scales the mean absolute deviation to the standard deviation of the normal
+/// distribution, used if more than half of the values are the median.
+const MEAN_AD_SCALE: f64 = 1.2533;
+
+/// `anomaly_score(time, value[, arg])` returns the score of each value, the
+/// number of the deviations from the center of the values, or of the
+/// `window` values before it. The score of an invalid value, or of a value
+/// without enough values before it, is NaN.
+pub fn anomaly_score(
+    timestamps: &mut Vec<i64>,
+    fields: &mut [Vec<f64>],
+    arg_str: Option<&str>,
+) -> DFResult<(Vec<i64>, Vec<f64>)> {
+    let arg: Arg = get_arg(arg_str)?;
+    if arg.threshold.is_some() {
+        return Err(datafusion::error::DataFusionError::Execution(
+            "threshold can only be set for detect_anomaly".to_string(),
+        ));
+    }
+    let method = get_method_from_arg(&arg)?;
+    let scores = scores(&fields[0], method, arg.window)?;
+    Ok((std::mem::take(timestamps), scores))
+}
+
+/// `detect_anomaly(time, value[, arg])` returns the values of which the
+/// absolute score of [`anomaly_score`] is greater than `threshold`.
+pub fn detect_anomaly(
+    timestamps: &mut [i64],
+    fields: &mut [Vec<f64>],
+    arg_str: Option<&str>,
+) -> DFResult<(Vec<i64>, Vec<f64>)> {
+    let arg: Arg = get_arg(arg_str)?;
+    let method = get_method_from_arg(&arg)?;
+    let threshold = match arg.threshold {
+        Some(threshold) if threshold.is_nan() || threshold <= 0.0 => {
+            return Err(datafusion::error::DataFusionError::Execution(
+                "threshold must be positive".to_string(),
+            ))
+        }
+        Some(threshold) => threshold,
+        None => method.default_threshold(),
+    };
+    let values = &fields[0];
+    let scores = scores(values, method, arg.window)?;
+    Ok(timestamps
+        .iter()
+        .zip(values)
+        .zip(scores)
+        .filter(|(_, score)| score.abs() > threshold)
+        .map(|((t, v), _)| (*t, *v))
+        .unzip())
+}
+
+#[derive(Debug, Deserialize, Default)]
+#[serde(deny_unknown_fields)]
+struct Arg {
+    method: Option<String>,
+    /// The number of the valid values before a value to score it by, all the
+    /// values if not set.
+    window: Option<usize>,
+    threshold: Option<f64>,
+}
+
+#[derive(Debug, Clone, Copy)]
+enum Method {
+    /// The center is the median, the deviation is the scaled median absolute
+    /// deviation, so the outliers don't hide themselves.
+    Mad,
+    /// The center is the mean, the deviation is the standard deviation.
+    ZScore,
+}
+
+impl Method {
+    pub fn from_str(method: &str) -> Option<Self> {
+        match method.to_ascii_lowercase().as_str() {
+            "mad" => Some(Self::Mad),
+            "zscore" => Some(Self::ZScore),
+            _ => None,
+        }
+    }
+
+    fn default_threshold(&self) -> f64 {
+        match self {
+            Method::Mad => 3.5,
+            Method::ZScore => 3.0,
+        }
+    }
+}
+
+fn get_method_from_arg(arg: &Arg) -> DFResult<Method> {
+    Ok(match &arg.method {
+        Some(method) => Method::from_str(method).ok_or_else(|| {
+            datafusion::error::DataFusionError::Execution(format!("Invalid method: {method}"))
+        })?,
+        None => Method::Mad,
+    })
+}
+
+fn scores(values: &[f64], method: Method, window: Option<usize>) -> DFResult<Vec<f64>> {
+    let Some(window) = window else {
+        let valid = values
+            .iter()
+            .copied()
+            .filter(|v| v.is_finite())
+            .collect::<Vec<_>>();
+        if valid.is_empty() {
+            return Ok(vec![f64::NAN; values.len()]);
+        }
+        let stats = Stats::new(&valid, method);
+        return Ok(values.iter().map(|v| stats.score(*v)).collect());
+    };
+    if window < 2 {
+        return Err(datafusion::error::DataFusionError::Execution(
+            "window must be greater than 1".to_string(),
+        ));
+    }
+
+    let mut scores = Vec::with_capacity(values.len());
+    let mut previous = VecDeque::with_capacity(window + 1);
+    for &value in values {
+        if !value.is_finite() {
+            scores.push(f64::NAN);
+            continue;
+        }
+        if previous.len() < window {
+            scores.push(f64::NAN);
+        } else {
+            let stats = Stats::new(previous.make_contiguous(), method);
+            scores.push(stats.score(value));
+        }
+        previous.push_back(value);
+        if previous.len() > window {
+            previous.pop_front();
+        }
+    }
+    Ok(scores)
+}
+
+struct Stats {
+    center: f64,
+    deviation: f64,
+}
+
+impl Stats {
+    /// `values` are finite and not empty.
+    fn new(values: &[f64], method: Method) -> Self {
+        match method {
+            Method::Mad => {
+                let center = median(values);
+                let deviations = values
+                    .iter()
+                    .map(|v| (v - center).abs())
+                    .collect::<Vec<_>>();
+                let mad = median(&deviations);
+                let deviation = if mad > 0.0 {
+                    MAD_SCALE * mad
+                } else {
+                    MEAN_AD_SCALE * deviations.iter().sum::<f64>() / deviations.len() as f64
+                };
+                Self { center, deviation }
+            }
+            Method::ZScore => {
+                let n = values.len() as f64;
+                let center = values.iter().sum::<f64>() / n;
+                let variance = values.iter().map(|v| (v - center).powi(2)).sum::<f64>() / n;
+                Self {
+                    center,
+                    deviation: variance.sqrt(),
+                }
+            }
+        }
+    }
+
+    /// A value other than the center is infinitely far from the values of no
+    /// deviation.
+    fn score(&self, value: f64) -> f64 {
+        if !value.is_finite() {
+            f64::NAN
+        } else if value == self.center {
+            0.0
+        } else {
+            (value - self.center) / self.deviation
+        }
+    }
+}
+
+fn median(values: &[f64]) -> f64 {
+    let mut values = values.to_vec();
+    values.sort_unstable_by(|a, b| a.total_cmp(b));
+    let mid = values.len() / 2;
+    if values.len() % 2 == 0 {
+        (values[mid - 1] + values[mid]) / 2.0
+    } else {
+        values[mid]
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use super::{anomaly_score, detect_anomaly};
+
+    #[test]
+    fn test_anomaly_score() {
+        let mut timestamps = (0..9).collect::<Vec<_>>();
+        let values = vec![2.0, 4.0, 4.0, 4.0, 5.0, 5.0, 7.0, 9.0, f64::NAN];
+        let (times, scores) = anomaly_score(
+            &mut timestamps,
+            &mut [values.clone()],
+            Some("method=zscore"),
+        )
+        .unwrap();
+        assert_eq!(times, (0..9).collect::<Vec<_>>());
+        assert_eq!(scores[..8], [-1.5, -0.5, -0.5, -0.5, 0.0, 0.0, 1.0, 2.0]);
+        assert!(scores[8].is_nan());
+
+        let mut timestamps = (0..5).collect::<Vec<_>>();
+        let values = vec![3.0, 3.0, 3.0, 3.0, 4.0];
+        let (_, scores) = anomaly_score(&mut timestamps, &mut [values], Some("window=3")).unwrap();
+        assert!(scores[..3].iter().all(|s| s.is_nan()));
+        assert_eq!(scores[3], 0.0);
+        assert_eq!(scores[4], f64::INFINITY);
+
+        assert!(anomaly_score(&mut timestamps, &mut [vec![1.0]], Some("threshold=1")).is_err());
+        assert!(anomaly_score(&mut timestamps, &mut [vec![1.0]], Some("window=1")).is_err());
+    }
+
+    #[test]
+    fn test_detect_anomaly() {
+        let mut timestamps = (0..9).collect::<Vec<_>>();
+        let values = vec![10.0, 11.0, 10.0, 12.0, 11.0, 10.0, 50.0, 11.0, 10.0];
+        for arg in [None, Some("method=zscore&window=5"), Some("threshold=3")] {
+            let result = detect_anomaly(&mut timestamps, &mut [values.clone()], arg).unwrap();
+            assert_eq!(result, (vec![6], vec![50.0]), "{arg:?}");
+        }
+        let (times, _) = detect_anomaly(
+            &mut timestamps,
+            &mut [values.clone()],
+            Some("threshold=0.5"),
+        )
+        .unwrap();
+        assert_eq!(times, vec![0, 2, 3, 5, 6, 8]);
+
+        assert!(detect_anomaly(&mut timestamps, &mut [values], Some("method=x")).is_err());
+    }
+}
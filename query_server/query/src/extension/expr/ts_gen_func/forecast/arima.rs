@@ -0,0 +1,38 @@
+/// The fitted values and the next `n` values of ARIMA(1,1,0), the difference
+/// of the values is forecasted by AR(1) around the mean difference, so the
+/// values keep the trend.
+pub fn forecast(values: &[f64], n: usize) -> (Vec<f64>, Vec<f64>) {
+    let diffs = values.windows(2).map(|w| w[1] - w[0]).collect::<Vec<_>>();
+    let mean = diffs.iter().sum::<f64>() / diffs.len() as f64;
+    let mut acf = 0.0;
+    let mut factor = 0.0;
+    for w in diffs.windows(2) {
+        acf += (w[0] - mean) * (w[1] - mean);
+        factor += (w[0] - mean) * (w[0] - mean);
+    }
+    // keeps the differences stationary
+    let phi = if factor == 0.0 {
+        0.0
+    } else {
+        (acf / factor).clamp(-0.99, 0.99)
+    };
+    let next_diff = |diff: f64| mean + phi * (diff - mean);
+
+    let mut fitted = Vec::with_capacity(values.len());
+    fitted.push(values[0]);
+    fitted.push(values[0] + mean);
+    for t in 2..values.len() {
+        fitted.push(values[t - 1] + next_diff(diffs[t - 2]));
+    }
+
+    let mut forecasts = Vec::with_capacity(n);
+    let mut value = values[values.len() - 1];
+    let mut diff = diffs[diffs.len() - 1];
+    for _ in 0..n {
+        diff = next_diff(diff);
+        value += diff;
+        forecasts.push(value);
+    }
+
+    (fitted, forecasts)
+}
@@ -0,0 +1,141 @@
+use spi::DFResult;
+
+/// The fitted values and the next `n` values of the additive Holt-Winters
+/// model, the seasonal component is left out if `season` is 0.
+///
+/// The smoothing parameters not set are chosen from 0.1, 0.2, ..., 0.9 by
+/// the least sum of the squared errors of the one-step forecasts.
+pub fn forecast(
+    values: &[f64],
+    n: usize,
+    season: usize,
+    alpha: Option<f64>,
+    beta: Option<f64>,
+    gamma: Option<f64>,
+) -> DFResult<(Vec<f64>, Vec<f64>)> {
+    if values.len() < 2 * season.max(1) {
+        return Err(datafusion::error::DataFusionError::Execution(format!(
+            "At least 2 seasons of values are required, but found {} values for season {season}",
+            values.len()
+        )));
+    }
+
+    let candidates = |param: Option<f64>| match param {
+        Some(param) => vec![param],
+        None => (1..10).map(|i| i as f64 / 10.0).collect(),
+    };
+    let gammas = if season == 0 {
+        vec![0.0]
+    } else {
+        candidates(gamma)
+    };
+    let mut best = None;
+    let mut best_sse = f64::INFINITY;
+    for &alpha in &candidates(alpha) {
+        for &beta in &candidates(beta) {
+            for &gamma in &gammas {
+                let sse = HoltWinters::new(values, season, alpha, beta, gamma).smooth(values, None);
+                if best.is_none() || sse < best_sse {
+                    best = Some((alpha, beta, gamma));
+                    best_sse = sse;
+                }
+            }
+        }
+    }
+    let (alpha, beta, gamma) = best.ok_or_else(|| {
+        datafusion::error::DataFusionError::Internal("No Holt-Winters model fitted".to_string())
+    })?;
+
+    let mut fitted = Vec::with_capacity(values.len());
+    let mut model = HoltWinters::new(values, season, alpha, beta, gamma);
+    model.smooth(values, Some(&mut fitted));
+    Ok((fitted, model.forecast(values.len(), n)))
+}
+
+struct HoltWinters {
+    alpha: f64,
+    beta: f64,
+    gamma: f64,
+    level: f64,
+    trend: f64,
+    /// The seasonal component of the index `i` is `seasonals[i % season]`.
+    seasonals: Vec<f64>,
+    /// The index of the first value smoothed, the values before it
+    /// initialize the components.
+    start: usize,
+}
+
+impl HoltWinters {
+    /// Initializes the components by the first value and the first trend, or
+    /// by the first two seasons.
+    fn new(values: &[f64], season: usize, alpha: f64, beta: f64, gamma: f64) -> Self {
+        let (level, trend, seasonals, start) = if season == 0 {
+            (values[0], values[1] - values[0], vec![], 1)
+        } else {
+            let mean = |values: &[f64]| values.iter().sum::<f64>() / values.len() as f64;
+            let first = mean(&values[..season]);
+            let trend = (mean(&values[season..2 * season]) - first) / season as f64;
+            let middle = (season - 1) as f64 / 2.0;
+            let seasonals = values[..season]
+                .iter()
+                .enumerate()
+                .map(|(i, v)| v - first - trend * (i as f64 - middle))
+                .collect();
+            // the level of the last value of the first season
+            (first + trend * middle, trend, seasonals, season)
+        };
+        Self {
+            alpha,
+            beta,
+            gamma,
+            level,
+            trend,
+            seasonals,
+            start,
+        }
+    }
+
+    fn seasonal(&self, i: usize) -> f64 {
+        if self.seasonals.is_empty() {
+            0.0
+        } else {
+            self.seasonals[i % self.seasonals.len()]
+        }
+    }
+
+    /// Smooths the values after `start`, returns the sum of the squared
+    /// errors of the one-step forecasts, which are pushed to `fitted` with
+    /// the values before `start`.
+    fn smooth(&mut self, values: &[f64], mut fitted: Option<&mut Vec<f64>>) -> f64 {
+        if let Some(fitted) = fitted.as_mut() {
+            fitted.extend_from_slice(&values[..self.start]);
+        }
+        let mut sse = 0.0;
+        for (i, &value) in values.iter().enumerate().skip(self.start) {
+            let seasonal = self.seasonal(i);
+            let forecast = self.level + self.trend + seasonal;
+            sse += (value - forecast) * (value - forecast);
+            if let Some(fitted) = fitted.as_mut() {
+                fitted.push(forecast);
+            }
+
+            let level =
+                self.alpha * (value - seasonal) + (1.0 - self.alpha) * (self.level + self.trend);
+            self.trend = self.beta * (level - self.level) + (1.0 - self.beta) * self.trend;
+            if !self.seasonals.is_empty() {
+                let season = self.seasonals.len();
+                self.seasonals[i % season] =
+                    self.gamma * (value - level) + (1.0 - self.gamma) * seasonal;
+            }
+            self.level = level;
+        }
+        sse
+    }
+
+    /// The `n` values after the `len` values smoothed.
+    fn forecast(&self, len: usize, n: usize) -> Vec<f64> {
+        (1..=n)
+            .map(|h| self.level + h as f64 * self.trend + self.seasonal(len + h - 1))
+            .collect()
+    }
+}
@@ -0,0 +1,26 @@
+/// The intercept and the slope of the least squares line of the values by
+/// their indexes.
+pub fn least_squares(values: &[f64]) -> (f64, f64) {
+    let n = values.len() as f64;
+    let mean_x = (n - 1.0) / 2.0;
+    let mean_y = values.iter().sum::<f64>() / n;
+    let mut sxy = 0.0;
+    let mut sxx = 0.0;
+    for (i, v) in values.iter().enumerate() {
+        let dx = i as f64 - mean_x;
+        sxy += dx * (v - mean_y);
+        sxx += dx * dx;
+    }
+    let slope = if sxx == 0.0 { 0.0 } else { sxy / sxx };
+    (mean_y - slope * mean_x, slope)
+}
+
+/// The fitted values and the next `n` values of the least squares line.
+pub fn forecast(values: &[f64], n: usize) -> (Vec<f64>, Vec<f64>) {
+    let (intercept, slope) = least_squares(values);
+    let line = |i: usize| intercept + slope * i as f64;
+    (
+        (0..values.len()).map(line).collect(),
+        (values.len()..values.len() + n).map(line).collect(),
+    )
+}
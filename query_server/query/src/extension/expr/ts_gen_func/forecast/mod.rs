@@ -0,0 +1,319 @@
+mod arima;
+mod holt_winters;
+mod linear;
+
+use serde::Deserialize;
+use spi::DFResult;
+
+use crate::extension::expr::ts_gen_func::utils::get_arg;
+
+/// The number of the values forecasted if `n` is not set.
+const DEFAULT_N: usize = 10;
+/// The least number of the valid values to fit a model.
+const MIN_VALUES: usize = 3;
+/// The least autocorrelation of the detrended values at the lag of a season.
+const SEASON_THRESHOLD: f64 = 0.3;
+
+/// `holt_winters(time, value[, arg])` returns the next `n` values forecasted
+/// by the Holt-Winters model, `holt_winters_with_fit` returns the fitted
+/// values of the input before them.
+pub fn holt_winters(
+    timestamps: &mut [i64],
+    fields: &mut [Vec<f64>],
+    arg_str: Option<&str>,
+    with_fit: bool,
+) -> DFResult<(Vec<i64>, Vec<f64>)> {
+    let arg: Arg = get_arg(arg_str)?;
+    if arg.model.is_some() {
+        return Err(datafusion::error::DataFusionError::Execution(
+            "model can't be set for holt_winters, use forecast instead".to_string(),
+        ));
+    }
+    forecast_values(timestamps, &fields[0], &arg, Model::HoltWinters, with_fit)
+}
+
+/// `forecast(time, value[, arg])` returns the next `n` values forecasted by
+/// the model `model`, Holt-Winters by default.
+pub fn forecast(
+    timestamps: &mut [i64],
+    fields: &mut [Vec<f64>],
+    arg_str: Option<&str>,
+) -> DFResult<(Vec<i64>, Vec<f64>)> {
+    let arg: Arg = get_arg(arg_str)?;
+    let model = match &arg.model {
+        Some(model) => Model::from_str(model).ok_or_else(|| {
+            datafusion::error::DataFusionError::Execution(format!("Invalid model: {model}"))
+        })?,
+        None => Model::HoltWinters,
+    };
+    forecast_values(timestamps, &fields[0], &arg, model, false)
+}
+
+#[derive(Debug, Deserialize, Default)]
+#[serde(deny_unknown_fields)]
+struct Arg {
+    model: Option<String>,
+    n: Option<usize>,
+    /// The interval of the forecasted timestamps in milliseconds, the median
+    /// interval of the input by default.
+    interval: Option<i64>,
+    /// `auto`, or the number of the values of a season, 0 for no season.
+    season: Option<String>,
+    alpha: Option<f64>,
+    beta: Option<f64>,
+    gamma: Option<f64>,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Model {
+    HoltWinters,
+    Linear,
+    /// ARIMA(1,1,0), the differences of the values are modeled by AR(1).
+    Arima,
+}
+
+impl Model {
+    pub fn from_str(model: &str) -> Option<Self> {
+        match model.to_ascii_lowercase().as_str() {
+            "holt_winters" => Some(Self::HoltWinters),
+            "linear" => Some(Self::Linear),
+            "arima" => Some(Self::Arima),
+            _ => None,
+        }
+    }
+}
+
+/// The models assume that the values are of the same interval, the invalid
+/// values are skipped.
+fn forecast_values(
+    timestamps: &[i64],
+    values: &[f64],
+    arg: &Arg,
+    model: Model,
+    with_fit: bool,
+) -> DFResult<(Vec<i64>, Vec<f64>)> {
+    let (timestamps, values): (Vec<i64>, Vec<f64>) = timestamps
+        .iter()
+        .zip(values)
+        .filter(|(_, v)| v.is_finite())
+        .map(|(t, v)| (*t, *v))
+        .unzip();
+    if values.len() < MIN_VALUES {
+        return Err(datafusion::error::DataFusionError::Execution(format!(
+            "At least {MIN_VALUES} valid values are required to forecast, but found {}",
+            values.len()
+        )));
+    }
+    check_smoothing_args(arg, model)?;
+
+    let n = arg.n.unwrap_or(DEFAULT_N);
+    let interval = match arg.interval {
+        Some(interval) if interval <= 0 => {
+            return Err(datafusion::error::DataFusionError::Execution(
+                "interval must be positive".to_string(),
+            ))
+        }
+        Some(interval) => interval * 1_000_000,
+        None => interval_median(&timestamps),
+    };
+    if interval <= 0 {
+        return Err(datafusion::error::DataFusionError::Execution(
+            "Cannot detect the interval of the timestamps, please set interval".to_string(),
+        ));
+    }
+
+    let (fitted, forecasts) = match model {
+        Model::HoltWinters => {
+            let season = get_season_from_arg(arg.season.as_deref(), &values)?;
+            holt_winters::forecast(&values, n, season, arg.alpha, arg.beta, arg.gamma)?
+        }
+        Model::Linear => linear::forecast(&values, n),
+        Model::Arima => arima::forecast(&values, n),
+    };
+
+    let last = timestamps[timestamps.len() - 1];
+    let forecast_timestamps = (1..=n as i64).map(|i| last + i * interval);
+    Ok(if with_fit {
+        (
+            timestamps.into_iter().chain(forecast_timestamps).collect(),
+            fitted.into_iter().chain(forecasts).collect(),
+        )
+    } else {
+        (forecast_timestamps.collect(), forecasts)
+    })
+}
+
+fn check_smoothing_args(arg: &Arg, model: Model) -> DFResult<()> {
+    let smoothing_args = [
+        ("alpha", arg.alpha),
+        ("beta", arg.beta),
+        ("gamma", arg.gamma),
+    ];
+    if model != Model::HoltWinters
+        && (arg.season.is_some() || smoothing_args.iter().any(|(_, v)| v.is_some()))
+    {
+        return Err(datafusion::error::DataFusionError::Execution(
+            "season, alpha, beta and gamma can only be set for holt_winters".to_string(),
+        ));
+    }
+    for (name, value) in smoothing_args {
+        if matches!(value, Some(v) if !(0.0..=1.0).contains(&v)) {
+            return Err(datafusion::error::DataFusionError::Execution(format!(
+                "{name} must be in [0, 1]"
+            )));
+        }
+    }
+    Ok(())
+}
+
+fn interval_median(timestamps: &[i64]) -> i64 {
+    let mut intervals = timestamps
+        .windows(2)
+        .map(|w| w[1] - w[0])
+        .collect::<Vec<_>>();
+    intervals.sort_unstable();
+    intervals[intervals.len() / 2]
+}
+
+fn get_season_from_arg(season: Option<&str>, values: &[f64]) -> DFResult<usize> {
+    let season = match season {
+        None => return Ok(detect_season(values)),
+        Some(s) if s.eq_ignore_ascii_case("auto") => return Ok(detect_season(values)),
+        Some(s) => s.parse::<usize>().map_err(|_| {
+            datafusion::error::DataFusionError::Execution(format!(
+                "Invalid season: {s}, expected auto or the number of the values of a season"
+            ))
+        })?,
+    };
+    if season == 1 {
+        return Err(datafusion::error::DataFusionError::Execution(
+            "season must be 0 or greater than 1".to_string(),
+        ));
+    }
+    Ok(season)
+}
+
+/// The lag of the highest peak of the autocorrelation of the detrended
+/// values, 0 if no peak reaches [`SEASON_THRESHOLD`].
+fn detect_season(values: &[f64]) -> usize {
+    let (intercept, slope) = linear::least_squares(values);
+    let residuals = values
+        .iter()
+        .enumerate()
+        .map(|(i, v)| v - intercept - slope * i as f64)
+        .collect::<Vec<_>>();
+    let variance = residuals.iter().map(|r| r * r).sum::<f64>();
+    let scale = values.iter().map(|v| v * v).sum::<f64>().max(1.0);
+    if variance <= scale * 1e-12 {
+        return 0;
+    }
+
+    let max_lag = values.len() / 2;
+    let acf = (0..=(max_lag + 1).min(values.len() - 1))
+        .map(|lag| {
+            residuals
+                .iter()
+                .zip(&residuals[lag..])
+                .map(|(a, b)| a * b)
+                .sum::<f64>()
+                / variance
+        })
+        .collect::<Vec<_>>();
+
+    let mut season = 0;
+    let mut season_acf = SEASON_THRESHOLD;
+    for lag in 2..=max_lag {
+        let is_peak = acf[lag] > acf[lag - 1] && acf.get(lag + 1).map_or(true, |a| acf[lag] >= *a);
+        if is_peak && acf[lag] >= season_acf {
+            season = lag;
+            season_acf = acf[lag];
+        }
+    }
+    season
+}
+
+#[cfg(test)]
+mod test {
+    use super::{detect_season, forecast, holt_winters};
+
+    fn seasonal_values(len: usize) -> Vec<f64> {
+        (0..len)
+            .map(|i| 10.0 + 0.5 * i as f64 + [0.0, 3.0, 0.0, -3.0][i % 4])
+            .collect()
+    }
+
+    #[test]
+    fn test_detect_season() {
+        assert_eq!(detect_season(&seasonal_values(24)), 4);
+        let linear = (0..24).map(|i| 2.0 * i as f64).collect::<Vec<_>>();
+        assert_eq!(detect_season(&linear), 0);
+    }
+
+    #[test]
+    fn test_holt_winters() {
+        let values = seasonal_values(28);
+        let mut timestamps = (0..28).map(|i| i * 10).collect::<Vec<_>>();
+        let (times, forecasts) = holt_winters(
+            &mut timestamps,
+            &mut [values[..24].to_vec()],
+            Some("n=4"),
+            false,
+        )
+        .unwrap();
+        assert_eq!(times, vec![240, 250, 260, 270]);
+        for (forecast, expected) in forecasts.iter().zip(&values[24..]) {
+            assert!((forecast - expected).abs() < 0.5, "{forecasts:?}");
+        }
+
+        let (times, values) = holt_winters(
+            &mut timestamps[..24],
+            &mut [values[..24].to_vec()],
+            Some("n=2"),
+            true,
+        )
+        .unwrap();
+        assert_eq!(times.len(), 26);
+        assert_eq!(values.len(), 26);
+
+        assert!(holt_winters(
+            &mut timestamps[..3],
+            &mut [vec![1.0, 2.0, 3.0]],
+            Some("model=linear"),
+            false
+        )
+        .is_err());
+    }
+
+    #[test]
+    fn test_forecast() {
+        let mut timestamps = vec![0, 10, 20, 30];
+        let mut values = vec![1.0, 3.0, 5.0, f64::NAN];
+        let (times, forecasts) = forecast(
+            &mut timestamps,
+            &mut [values.clone()],
+            Some("model=linear&n=2"),
+        )
+        .unwrap();
+        assert_eq!(times, vec![30, 40]);
+        assert_eq!(forecasts, vec![7.0, 9.0]);
+
+        values[3] = 7.0;
+        let (times, forecasts) = forecast(
+            &mut timestamps,
+            &mut [values.clone()],
+            Some("model=arima&n=2&interval=1"),
+        )
+        .unwrap();
+        assert_eq!(times, vec![1_000_030, 2_000_030]);
+        assert_eq!(forecasts, vec![9.0, 11.0]);
+
+        assert!(forecast(&mut timestamps, &mut [values.clone()], Some("model=x")).is_err());
+        assert!(forecast(
+            &mut timestamps,
+            &mut [values],
+            Some("model=linear&alpha=0.5")
+        )
+        .is_err());
+        assert!(forecast(&mut timestamps[..2], &mut [vec![1.0, 2.0]], None).is_err());
+    }
+}
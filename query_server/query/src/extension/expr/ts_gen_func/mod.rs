@@ -1,4 +1,6 @@
+mod anomaly;
 mod data_repair;
+mod forecast;
 mod utils;
 
 use data_repair::{timestamp_repair, value_fill, value_repair};
@@ -13,6 +15,11 @@ pub enum TSGenFunc {
     TimestampRepair,
     ValueFill,
     ValueRepair,
+    HoltWinters,
+    HoltWintersWithFit,
+    Forecast,
+    AnomalyScore,
+    DetectAnomaly,
 }
 
 impl TSGenFunc {
@@ -21,18 +28,41 @@ impl TSGenFunc {
             TSGenFunc::TimestampRepair => "timestamp_repair",
             TSGenFunc::ValueFill => "value_fill",
             TSGenFunc::ValueRepair => "value_repair",
+            TSGenFunc::HoltWinters => "holt_winters",
+            TSGenFunc::HoltWintersWithFit => "holt_winters_with_fit",
+            TSGenFunc::Forecast => "forecast",
+            TSGenFunc::AnomalyScore => "anomaly_score",
+            TSGenFunc::DetectAnomaly => "detect_anomaly",
         }
     }
 
+    /// Whether the timestamps of the output are not the timestamps of the
+    /// rows of the input one by one.
+    pub const fn generates_timestamps(&self) -> bool {
+        matches!(
+            self,
+            TSGenFunc::TimestampRepair
+                | TSGenFunc::HoltWinters
+                | TSGenFunc::HoltWintersWithFit
+                | TSGenFunc::Forecast
+                | TSGenFunc::DetectAnomaly
+        )
+    }
+
     pub fn from_str_opt(name: &str) -> Option<Self> {
         TSGenFunc::iter().find(|func| func.name() == name)
     }
 
     fn scalar_udf(&self) -> ScalarUDF {
         match self {
-            TSGenFunc::TimestampRepair | TSGenFunc::ValueFill | TSGenFunc::ValueRepair => {
-                utils::common_udf(self.name())
-            }
+            TSGenFunc::TimestampRepair
+            | TSGenFunc::ValueFill
+            | TSGenFunc::ValueRepair
+            | TSGenFunc::HoltWinters
+            | TSGenFunc::HoltWintersWithFit
+            | TSGenFunc::Forecast
+            | TSGenFunc::DetectAnomaly => utils::common_udf(self.name()),
+            TSGenFunc::AnomalyScore => utils::float64_udf(self.name()),
         }
     }
 
@@ -53,6 +83,13 @@ impl TSGenFunc {
             TSGenFunc::TimestampRepair => timestamp_repair::compute(timestamps, fields, arg_str),
             TSGenFunc::ValueFill => value_fill::compute(timestamps, fields, arg_str),
             TSGenFunc::ValueRepair => value_repair::compute(timestamps, fields, arg_str),
+            TSGenFunc::HoltWinters => forecast::holt_winters(timestamps, fields, arg_str, false),
+            TSGenFunc::HoltWintersWithFit => {
+                forecast::holt_winters(timestamps, fields, arg_str, true)
+            }
+            TSGenFunc::Forecast => forecast::forecast(timestamps, fields, arg_str),
+            TSGenFunc::AnomalyScore => anomaly::anomaly_score(timestamps, fields, arg_str),
+            TSGenFunc::DetectAnomaly => anomaly::detect_anomaly(timestamps, fields, arg_str),
         }
     }
 }
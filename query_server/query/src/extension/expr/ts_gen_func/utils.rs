@@ -10,18 +10,37 @@ use spi::DFResult;
 
 use crate::extension::expr::scalar_function::unimplemented_scalar_impl;
 
+/// The udf returning the values of the type of the input values.
 pub fn common_udf(name: &'static str) -> ScalarUDF {
     let return_type_func: ReturnTypeFunction = Arc::new(|args| {
-        if args.len() < 2 || args.len() > 3 {
-            Err(datafusion::error::DataFusionError::Plan(format!(
-                "Expected 2 or 3 arguments, got {}",
-                args.len()
-            )))
-        } else {
-            Ok(Arc::new(args[1].clone()))
-        }
+        check_args_len(args)?;
+        Ok(Arc::new(args[1].clone()))
     });
+    udf(name, return_type_func)
+}
+
+/// The udf returning the values of `Float64` whatever the type of the input
+/// values is.
+pub fn float64_udf(name: &'static str) -> ScalarUDF {
+    let return_type_func: ReturnTypeFunction = Arc::new(|args| {
+        check_args_len(args)?;
+        Ok(Arc::new(DataType::Float64))
+    });
+    udf(name, return_type_func)
+}
+
+fn check_args_len(args: &[DataType]) -> DFResult<()> {
+    if args.len() < 2 || args.len() > 3 {
+        Err(datafusion::error::DataFusionError::Plan(format!(
+            "Expected 2 or 3 arguments, got {}",
+            args.len()
+        )))
+    } else {
+        Ok(())
+    }
+}
 
+fn udf(name: &'static str, return_type_func: ReturnTypeFunction) -> ScalarUDF {
     let type_signatures = TIMESTAMPS
         .iter()
         .flat_map(|t| {
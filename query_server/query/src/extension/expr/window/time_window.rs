@@ -41,6 +41,7 @@ pub fn signature() -> Signature {
     // group by time_window(time, interval '10 second') => group by time_window(time, interval '10 second', interval '5 second', '1970-01-01T00:00:00.000Z')
     // group by time_window(time, interval '10 second', interval '5 second') => group by time_window(time, interval '10 second', interval '5 second', '1970-01-01T00:00:00.000Z')
     // group by time_window(time, interval '10 second', interval '5 second', '1999-12-31T00:00:00.000Z')
+    // group by time_window(time, interval '1 week', interval '1 week', 'iso_week')
     let type_signatures = TIMESTAMPS
         .iter()
         .flat_map(|first| {
@@ -60,6 +61,13 @@ pub fn signature() -> Signature {
                                 third.clone(),
                                 DataType::Timestamp(TimeUnit::Nanosecond, None),
                             ]),
+                            // named anchor, such as: 'iso_week'
+                            TypeSignature::Exact(vec![
+                                first.clone(),
+                                second.clone(),
+                                third.clone(),
+                                DataType::Utf8,
+                            ]),
                         ]
                     })
                     .chain([TypeSignature::Exact(vec![first.clone(), second.clone()])])
@@ -0,0 +1,219 @@
+//! Aligns the series of the tables joined without any condition, so that
+//! the fields of different tables can be computed in one query, e.g.
+//!
+//! ```sql
+//! SELECT p.time, p.station, p.power / t.temperature FROM power p, temperature t
+//! ```
+//!
+//! A cross join of the tables is rewritten into an inner join on the time
+//! and the tags of both tables, the rows of the same series at the same time
+//! are joined. The tables can be subqueries grouped by time and tags, to
+//! align the series whose points are written at different times.
+//!
+//! The rewrite changes the result of a standard cross join, so it is only
+//! enabled for the sessions passing the `x-cnosdb-align-series: true` header,
+//! see [`SeriesAlignment`](spi::query::config::SeriesAlignment).
+
+use datafusion::common::{Column, DFField, DFSchema};
+use datafusion::datasource::source_as_provider;
+use datafusion::error::Result;
+use datafusion::logical_expr::{CrossJoin, JoinType, LogicalPlan, LogicalPlanBuilder, TableScan};
+use datafusion::optimizer::optimizer::ApplyOrder;
+use datafusion::optimizer::{OptimizerConfig, OptimizerRule};
+use models::arrow::DataType;
+use models::schema::tskv_table_schema::{TskvTableSchema, TskvTableSchemaRef};
+
+use crate::data_source::batch::tskv::ClusterTable;
+
+/// Convert the cross join of tables to the join on time and tags
+///
+/// Triggering conditions:
+/// 1. The cross join is left after the join conditions are extracted
+/// 2. Both sides are read from a table, and output the time column
+/// 3. The session enables the alignment of the series
+pub struct AlignSeries {
+    enabled: bool,
+}
+
+impl AlignSeries {
+    pub fn new(enabled: bool) -> Self {
+        Self { enabled }
+    }
+}
+
+impl OptimizerRule for AlignSeries {
+    fn try_optimize(
+        &self,
+        plan: &LogicalPlan,
+        _optimizer_config: &dyn OptimizerConfig,
+    ) -> Result<Option<LogicalPlan>> {
+        if !self.enabled {
+            return Ok(None);
+        }
+        let LogicalPlan::CrossJoin(CrossJoin { left, right, .. }) = plan else {
+            return Ok(None);
+        };
+        let (Some(left_table), Some(right_table)) = (source_table(left)?, source_table(right)?)
+        else {
+            return Ok(None);
+        };
+        let Some(keys) = align_keys(left.schema(), &left_table, right.schema(), &right_table)
+        else {
+            return Ok(None);
+        };
+
+        let plan = LogicalPlanBuilder::from(left.as_ref().clone())
+            .join(right.as_ref().clone(), JoinType::Inner, keys, None)?
+            .build()?;
+
+        Ok(Some(plan))
+    }
+
+    fn name(&self) -> &str {
+        "align_series"
+    }
+
+    fn apply_order(&self) -> Option<ApplyOrder> {
+        Some(ApplyOrder::BottomUp)
+    }
+}
+
+/// The table the plan reads, through the nodes with a single input.
+fn source_table(plan: &LogicalPlan) -> Result<Option<TskvTableSchemaRef>> {
+    if let LogicalPlan::TableScan(TableScan { source, .. }) = plan {
+        return Ok(source_as_provider(source)?
+            .as_any()
+            .downcast_ref::<ClusterTable>()
+            .map(|t| t.table_schema()));
+    }
+    match plan.inputs().as_slice() {
+        [input] => source_table(input),
+        _ => Ok(None),
+    }
+}
+
+/// The time columns and the tags of both tables in the outputs of both
+/// sides, `None` if any side doesn't output its time column.
+fn align_keys(
+    left: &DFSchema,
+    left_table: &TskvTableSchema,
+    right: &DFSchema,
+    right_table: &TskvTableSchema,
+) -> Option<(Vec<Column>, Vec<Column>)> {
+    let time = |schema: &DFSchema, table: &TskvTableSchema| {
+        output_field(schema, &table.time_column().name)
+            .filter(|f| matches!(f.data_type(), DataType::Timestamp(_, _)))
+            .map(|f| f.qualified_column())
+    };
+    let mut left_keys = vec![time(left, left_table)?];
+    let mut right_keys = vec![time(right, right_table)?];
+
+    for tag in left_table
+        .columns()
+        .iter()
+        .filter(|c| c.column_type.is_tag())
+    {
+        if !right_table
+            .column(&tag.name)
+            .map_or(false, |c| c.column_type.is_tag())
+        {
+            continue;
+        }
+        if let (Some(l), Some(r)) = (
+            output_field(left, &tag.name),
+            output_field(right, &tag.name),
+        ) {
+            left_keys.push(l.qualified_column());
+            right_keys.push(r.qualified_column());
+        }
+    }
+
+    Some((left_keys, right_keys))
+}
+
+/// The only output field of the name.
+fn output_field<'a>(schema: &'a DFSchema, name: &str) -> Option<&'a DFField> {
+    let mut fields = schema.fields().iter().filter(|f| f.name() == name);
+    match (fields.next(), fields.next()) {
+        (Some(field), None) => Some(field),
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use datafusion::arrow::datatypes::TimeUnit;
+    use datafusion::common::Column;
+    use datafusion::error::Result;
+    use datafusion::logical_expr::logical_plan::table_scan;
+    use datafusion::optimizer::{OptimizerContext, OptimizerRule};
+    use models::schema::tskv_table_schema::{ColumnType, TableColumn, TskvTableSchema};
+    use models::ValueType;
+
+    use super::{align_keys, AlignSeries};
+
+    fn table(name: &str, tags: &[&str]) -> TskvTableSchema {
+        let mut columns = vec![TableColumn::new_time_column(0, TimeUnit::Nanosecond)];
+        for (i, tag) in tags.iter().enumerate() {
+            columns.push(TableColumn::new_tag_column(i as u32 + 1, tag.to_string()));
+        }
+        columns.push(TableColumn::new(
+            tags.len() as u32 + 1,
+            "value".to_string(),
+            ColumnType::Field(ValueType::Float),
+            Default::default(),
+        ));
+        TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            name.to_string(),
+            columns,
+        )
+    }
+
+    #[test]
+    fn test_align_keys() -> Result<()> {
+        let power = table("power", &["station", "phase"]);
+        let temperature = table("temperature", &["station"]);
+        let left = table_scan(Some("p"), &power.to_arrow_schema(), None)?.build()?;
+        let right = table_scan(Some("t"), &temperature.to_arrow_schema(), None)?.build()?;
+
+        let (left_keys, right_keys) =
+            align_keys(left.schema(), &power, right.schema(), &temperature).unwrap();
+        assert_eq!(
+            left_keys,
+            vec![
+                Column::from_qualified_name("p.time"),
+                Column::from_qualified_name("p.station")
+            ]
+        );
+        assert_eq!(
+            right_keys,
+            vec![
+                Column::from_qualified_name("t.time"),
+                Column::from_qualified_name("t.station")
+            ]
+        );
+
+        // the time column is not output
+        let tags = table_scan(Some("t"), &temperature.to_arrow_schema(), Some(vec![1]))?.build()?;
+        assert!(align_keys(left.schema(), &power, tags.schema(), &temperature).is_none());
+
+        Ok(())
+    }
+
+    #[test]
+    fn test_disabled() -> Result<()> {
+        let power = table("power", &["station"]);
+        let temperature = table("temperature", &["station"]);
+        let plan = table_scan(Some("p"), &power.to_arrow_schema(), None)?
+            .cross_join(table_scan(Some("t"), &temperature.to_arrow_schema(), None)?.build()?)?
+            .build()?;
+
+        // a standard cross join unless the session enables the alignment
+        let optimized = AlignSeries::new(false).try_optimize(&plan, &OptimizerContext::new())?;
+        assert!(optimized.is_none());
+
+        Ok(())
+    }
+}
@@ -1,3 +1,5 @@
+pub mod align_series;
 pub mod push_down_aggregation;
 pub mod reject_cross_join;
 pub mod rewrite_tag_scan;
+pub mod time_tolerance_join;
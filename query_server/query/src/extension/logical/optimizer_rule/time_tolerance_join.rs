@@ -0,0 +1,423 @@
+//! Joins the rows of two tables whose times are within a tolerance, e.g.
+//!
+//! ```sql
+//! SELECT * FROM temperature t JOIN power p
+//!     ON t.station = p.station
+//!     AND t.time BETWEEN p.time - INTERVAL '1' SECOND AND p.time + INTERVAL '1' SECOND
+//! ```
+//!
+//! Such a join is a hash join on the tags only, every row of a series is
+//! compared with all the rows of the series from the other table. The times
+//! are divided into buckets as wide as the tolerance, the rows within the
+//! tolerance are in the same or the adjacent buckets. So the bucket is added
+//! to the join keys, and each row of one side is copied to the adjacent
+//! buckets by [`ExpandNode`], a pair of rows still matches only once.
+
+use std::sync::Arc;
+
+use datafusion::arrow::datatypes::{
+    DataType, IntervalDayTimeType, IntervalMonthDayNanoType, TimeUnit,
+};
+use datafusion::common::{Column, DFSchema, ScalarValue};
+use datafusion::error::Result;
+use datafusion::logical_expr::expr::{Between, BinaryExpr, Cast};
+use datafusion::logical_expr::{Extension, JoinType, LogicalPlan, LogicalPlanBuilder, Operator};
+use datafusion::optimizer::optimizer::ApplyOrder;
+use datafusion::optimizer::utils::split_conjunction;
+use datafusion::optimizer::{OptimizerConfig, OptimizerRule};
+use datafusion::prelude::{cast, lit, Expr};
+
+use crate::extension::logical::plan_node::expand::ExpandNode;
+
+const LEFT_TIME_BUCKET: &str = "$left_time_bucket";
+const RIGHT_TIME_BUCKET: &str = "$right_time_bucket";
+const NANOS_PER_DAY: i64 = 86_400_000_000_000;
+
+/// Adds the time bucket to the join keys of the joins bounding the
+/// difference of the times from both sides.
+///
+/// Triggering conditions:
+/// 1. The join is an inner, left or right join
+/// 2. The filter of the join bounds `left.time - right.time` from both
+///    directions by interval literals
+pub struct TimeToleranceJoin {}
+
+impl OptimizerRule for TimeToleranceJoin {
+    fn try_optimize(
+        &self,
+        plan: &LogicalPlan,
+        _optimizer_config: &dyn OptimizerConfig,
+    ) -> Result<Option<LogicalPlan>> {
+        let LogicalPlan::Join(join) = plan else {
+            return Ok(None);
+        };
+        // the side whose rows may be output without a match is not copied
+        let expand_left = match join.join_type {
+            JoinType::Inner | JoinType::Left => false,
+            JoinType::Right => true,
+            _ => return Ok(None),
+        };
+        // already rewritten
+        if join
+            .on
+            .iter()
+            .any(|(l, r)| is_time_bucket(l) || is_time_bucket(r))
+        {
+            return Ok(None);
+        }
+        let Some(filter) = &join.filter else {
+            return Ok(None);
+        };
+        let Some((left_time, right_time, tolerance)) =
+            time_tolerance(filter, join.left.schema(), join.right.schema())
+        else {
+            return Ok(None);
+        };
+
+        let left_bucket = time_bucket(left_time, tolerance);
+        let right_bucket = time_bucket(right_time, tolerance);
+        let (left, right) = if expand_left {
+            (
+                expand(&join.left, left_bucket, LEFT_TIME_BUCKET)?,
+                with_bucket(&join.right, right_bucket, RIGHT_TIME_BUCKET)?,
+            )
+        } else {
+            (
+                with_bucket(&join.left, left_bucket, LEFT_TIME_BUCKET)?,
+                expand(&join.right, right_bucket, RIGHT_TIME_BUCKET)?,
+            )
+        };
+
+        let (mut left_keys, mut right_keys): (Vec<_>, Vec<_>) = join.on.iter().cloned().unzip();
+        left_keys.push(Expr::Column(Column::from_name(LEFT_TIME_BUCKET)));
+        right_keys.push(Expr::Column(Column::from_name(RIGHT_TIME_BUCKET)));
+
+        // drop the buckets
+        let output = columns(&join.schema);
+        let plan = LogicalPlanBuilder::from(left)
+            .join_with_expr_keys(
+                right,
+                join.join_type,
+                (left_keys, right_keys),
+                join.filter.clone(),
+            )?
+            .project(output)?
+            .build()?;
+
+        Ok(Some(plan))
+    }
+
+    fn name(&self) -> &str {
+        "time_tolerance_join"
+    }
+
+    fn apply_order(&self) -> Option<ApplyOrder> {
+        Some(ApplyOrder::BottomUp)
+    }
+}
+
+fn is_time_bucket(expr: &Expr) -> bool {
+    matches!(expr, Expr::Column(c) if c.name == LEFT_TIME_BUCKET || c.name == RIGHT_TIME_BUCKET)
+}
+
+fn columns(schema: &DFSchema) -> Vec<Expr> {
+    schema
+        .fields()
+        .iter()
+        .map(|f| Expr::Column(f.qualified_column()))
+        .collect()
+}
+
+/// The bucket of the time, the buckets around 0 are wider as the division
+/// truncates, it doesn't matter as no bucket is narrower than the tolerance.
+fn time_bucket(time: Column, tolerance: i64) -> Expr {
+    let nanos = cast(
+        cast(
+            Expr::Column(time),
+            DataType::Timestamp(TimeUnit::Nanosecond, None),
+        ),
+        DataType::Int64,
+    );
+    nanos / lit(tolerance)
+}
+
+fn with_bucket(input: &Arc<LogicalPlan>, bucket: Expr, name: &str) -> Result<LogicalPlan> {
+    let mut exprs = columns(input.schema());
+    exprs.push(bucket.alias(name));
+    LogicalPlanBuilder::from(input.as_ref().clone())
+        .project(exprs)?
+        .build()
+}
+
+/// Copies each row to its bucket and the adjacent ones.
+fn expand(input: &Arc<LogicalPlan>, bucket: Expr, name: &str) -> Result<LogicalPlan> {
+    let projections = [-1_i64, 0, 1]
+        .into_iter()
+        .map(|offset| {
+            let mut exprs = columns(input.schema());
+            exprs.push((bucket.clone() + lit(offset)).alias(name));
+            exprs
+        })
+        .collect::<Vec<_>>();
+    let node = ExpandNode::try_new(projections, input.clone())?;
+
+    Ok(LogicalPlan::Extension(Extension {
+        node: Arc::new(node),
+    }))
+}
+
+/// `left - right op nanos`
+struct TimeBound {
+    left: Column,
+    right: Column,
+    op: Operator,
+    nanos: i64,
+}
+
+/// Finds the time columns of both sides and the tolerance in nanoseconds,
+/// the time columns are the first pair bounded by the filter.
+fn time_tolerance(
+    filter: &Expr,
+    left: &DFSchema,
+    right: &DFSchema,
+) -> Option<(Column, Column, i64)> {
+    let bounds = split_conjunction(filter)
+        .into_iter()
+        .flat_map(|e| match e {
+            Expr::Between(Between {
+                expr,
+                negated: false,
+                low,
+                high,
+            }) => vec![
+                time_bound(expr, Operator::GtEq, low, left, right),
+                time_bound(expr, Operator::LtEq, high, left, right),
+            ],
+            Expr::BinaryExpr(BinaryExpr {
+                left: l,
+                op,
+                right: r,
+            }) => vec![time_bound(l, *op, r, left, right)],
+            _ => vec![],
+        })
+        .flatten()
+        .collect::<Vec<_>>();
+    let first = bounds.first()?;
+    let (left_time, right_time) = (first.left.clone(), first.right.clone());
+
+    let mut lower = None::<i64>;
+    let mut upper = None::<i64>;
+    for bound in bounds
+        .iter()
+        .filter(|b| b.left == left_time && b.right == right_time)
+    {
+        if matches!(bound.op, Operator::Gt | Operator::GtEq | Operator::Eq) {
+            lower = Some(lower.map_or(bound.nanos, |l| l.max(bound.nanos)));
+        }
+        if matches!(bound.op, Operator::Lt | Operator::LtEq | Operator::Eq) {
+            upper = Some(upper.map_or(bound.nanos, |u| u.min(bound.nanos)));
+        }
+    }
+
+    let tolerance = lower?.checked_abs()?.max(upper?.checked_abs()?);
+    if tolerance == 0 {
+        return None;
+    }
+    Some((left_time, right_time, tolerance))
+}
+
+/// Normalizes `a op b` to `left.time - right.time op nanos`.
+fn time_bound(
+    a: &Expr,
+    op: Operator,
+    b: &Expr,
+    left: &DFSchema,
+    right: &DFSchema,
+) -> Option<TimeBound> {
+    if !matches!(
+        op,
+        Operator::Lt | Operator::LtEq | Operator::Gt | Operator::GtEq | Operator::Eq
+    ) {
+        return None;
+    }
+    let (a, a_nanos) = time_operand(a)?;
+    let (b, b_nanos) = time_operand(b)?;
+    // a + a_nanos op b + b_nanos => a - b op b_nanos - a_nanos
+    let nanos = b_nanos.checked_sub(a_nanos)?;
+    if is_time_column(left, &a) && is_time_column(right, &b) {
+        Some(TimeBound {
+            left: a,
+            right: b,
+            op,
+            nanos,
+        })
+    } else if is_time_column(right, &a) && is_time_column(left, &b) {
+        Some(TimeBound {
+            left: b,
+            right: a,
+            op: op.swap()?,
+            nanos: nanos.checked_neg()?,
+        })
+    } else {
+        None
+    }
+}
+
+/// Matches `column`, `column + interval` and `column - interval`.
+fn time_operand(expr: &Expr) -> Option<(Column, i64)> {
+    match expr {
+        Expr::Column(c) => Some((c.clone(), 0)),
+        Expr::Cast(Cast {
+            expr,
+            data_type: DataType::Timestamp(_, _),
+        }) => match expr.as_ref() {
+            Expr::Column(c) => Some((c.clone(), 0)),
+            _ => None,
+        },
+        Expr::BinaryExpr(BinaryExpr { left, op, right }) => {
+            let (column, nanos) = time_operand(left)?;
+            let interval = match right.as_ref() {
+                Expr::Literal(value) => interval_nanos(value)?,
+                _ => return None,
+            };
+            match op {
+                Operator::Plus => Some((column, nanos.checked_add(interval)?)),
+                Operator::Minus => Some((column, nanos.checked_sub(interval)?)),
+                _ => None,
+            }
+        }
+        _ => None,
+    }
+}
+
+fn is_time_column(schema: &DFSchema, column: &Column) -> bool {
+    schema
+        .field_from_column(column)
+        .map(|f| matches!(f.data_type(), DataType::Timestamp(_, _)))
+        .unwrap_or(false)
+}
+
+/// Nanoseconds of the interval, the intervals of months are not fixed.
+fn interval_nanos(value: &ScalarValue) -> Option<i64> {
+    match value {
+        ScalarValue::IntervalDayTime(Some(v)) => {
+            let (days, millis) = IntervalDayTimeType::to_parts(*v);
+            (days as i64)
+                .checked_mul(NANOS_PER_DAY)?
+                .checked_add(millis as i64 * 1_000_000)
+        }
+        ScalarValue::IntervalMonthDayNano(Some(v)) => {
+            let (months, days, nanos) = IntervalMonthDayNanoType::to_parts(*v);
+            if months != 0 {
+                return None;
+            }
+            (days as i64).checked_mul(NANOS_PER_DAY)?.checked_add(nanos)
+        }
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use datafusion::arrow::datatypes::{DataType, Field, IntervalDayTimeType, Schema, TimeUnit};
+    use datafusion::common::ScalarValue;
+    use datafusion::error::Result;
+    use datafusion::logical_expr::logical_plan::table_scan;
+    use datafusion::logical_expr::{Join, JoinType, LogicalPlan, LogicalPlanBuilder, Projection};
+    use datafusion::optimizer::{OptimizerContext, OptimizerRule};
+    use datafusion::prelude::{col, lit, Expr};
+
+    use super::{time_tolerance, TimeToleranceJoin};
+
+    fn scan(name: &str) -> Result<LogicalPlan> {
+        let schema = Schema::new(vec![
+            Field::new(
+                "time",
+                DataType::Timestamp(TimeUnit::Nanosecond, None),
+                false,
+            ),
+            Field::new("station", DataType::Utf8, true),
+            Field::new("value", DataType::Float64, true),
+        ]);
+        table_scan(Some(name), &schema, None)?.build()
+    }
+
+    fn seconds(n: i32) -> Expr {
+        lit(ScalarValue::IntervalDayTime(Some(
+            IntervalDayTimeType::make_value(0, n * 1000),
+        )))
+    }
+
+    fn join(join_type: JoinType, filter: Expr) -> Result<LogicalPlan> {
+        LogicalPlanBuilder::from(scan("temperature")?)
+            .join_with_expr_keys(
+                scan("power")?,
+                join_type,
+                (vec![col("temperature.station")], vec![col("power.station")]),
+                Some(filter),
+            )?
+            .build()
+    }
+
+    #[test]
+    fn test_time_tolerance() -> Result<()> {
+        let (left, right) = (scan("temperature")?, scan("power")?);
+        let tolerance = |filter: Expr| {
+            time_tolerance(&filter, left.schema(), right.schema()).map(|(_, _, t)| t)
+        };
+
+        let between = col("temperature.time").between(
+            col("power.time") - seconds(1),
+            col("power.time") + seconds(2),
+        );
+        assert_eq!(tolerance(between), Some(2_000_000_000));
+
+        // the bounds can be written in any direction
+        let bounds = col("power.time")
+            .lt(col("temperature.time") + seconds(3))
+            .and((col("temperature.time") - seconds(1)).lt_eq(col("power.time")));
+        assert_eq!(tolerance(bounds), Some(3_000_000_000));
+
+        // only bounded from one direction
+        let lower = col("temperature.time").gt_eq(col("power.time") - seconds(1));
+        assert_eq!(tolerance(lower), None);
+        let values = col("temperature.value").lt(col("power.value"));
+        assert_eq!(tolerance(values), None);
+
+        Ok(())
+    }
+
+    #[test]
+    fn test_rewrite_join() -> Result<()> {
+        let filter = col("temperature.time").between(
+            col("power.time") - seconds(1),
+            col("power.time") + seconds(1),
+        );
+        let plan = join(JoinType::Left, filter.clone())?;
+        let rule = TimeToleranceJoin {};
+        let config = OptimizerContext::new();
+
+        let rewritten = rule.try_optimize(&plan, &config)?.unwrap();
+        assert_eq!(
+            rewritten.schema().field_names(),
+            plan.schema().field_names()
+        );
+        let LogicalPlan::Projection(Projection { input, .. }) = &rewritten else {
+            panic!("expect a projection, got {rewritten:?}");
+        };
+        let LogicalPlan::Join(Join { on, right, .. }) = input.as_ref() else {
+            panic!("expect a join, got {input:?}");
+        };
+        assert_eq!(on.len(), 2);
+        assert!(matches!(right.as_ref(), LogicalPlan::Extension(_)));
+
+        // the rewritten join is not rewritten again
+        assert!(rule.try_optimize(input, &config)?.is_none());
+        // the rows of both sides of a full join may be output without a match
+        assert!(rule
+            .try_optimize(&join(JoinType::Full, filter)?, &config)?
+            .is_none());
+
+        Ok(())
+    }
+}
@@ -3,3 +3,5 @@ pub mod add_assert;
 pub mod add_sort;
 pub mod add_state_store;
 pub mod add_traced_proxy;
+pub mod push_down_last_rows;
+pub mod push_down_top_k;
@@ -0,0 +1,117 @@
+use std::sync::Arc;
+
+use datafusion::common::tree_node::{Transformed, TreeNode};
+use datafusion::common::Result as DFResult;
+use datafusion::config::ConfigOptions;
+use datafusion::physical_expr::expressions::Column;
+use datafusion::physical_optimizer::PhysicalOptimizerRule;
+use datafusion::physical_plan::coalesce_batches::CoalesceBatchesExec;
+use datafusion::physical_plan::coalesce_partitions::CoalescePartitionsExec;
+use datafusion::physical_plan::repartition::RepartitionExec;
+use datafusion::physical_plan::sorts::sort::SortExec;
+use datafusion::physical_plan::ExecutionPlan;
+use models::schema::TIME_FIELD_NAME;
+
+use crate::extension::physical::plan_node::tskv_exec::TskvExec;
+use crate::extension::utils::downcast_execution_plan;
+
+/// For the queries of the latest data, like `ORDER BY time DESC LIMIT n`,
+/// only the latest n rows of each series need to be scanned, so that the
+/// older chunks of the series will not be read.
+///
+/// ```text
+/// SortExec: fetch=n, expr=[time DESC, ...]
+///   (CoalescePartitionsExec | RepartitionExec | CoalesceBatchesExec)*
+///     TskvExec
+/// ->
+/// SortExec: fetch=n, expr=[time DESC, ...]
+///   (CoalescePartitionsExec | RepartitionExec | CoalesceBatchesExec)*
+///     TskvExec: last_rows=n
+/// ```
+#[non_exhaustive]
+pub struct PushDownLastRows {}
+
+impl PushDownLastRows {
+    pub fn new() -> Self {
+        Self {}
+    }
+}
+
+impl Default for PushDownLastRows {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl PhysicalOptimizerRule for PushDownLastRows {
+    fn optimize(
+        &self,
+        plan: Arc<dyn ExecutionPlan>,
+        _config: &ConfigOptions,
+    ) -> DFResult<Arc<dyn ExecutionPlan>> {
+        plan.transform_down(&|plan| {
+            if let Some(sort_exec) = downcast_execution_plan::<SortExec>(plan.as_ref()) {
+                if let Some(fetch) = sort_exec.fetch() {
+                    if is_sorted_by_time_desc(sort_exec) {
+                        if let Some(new_child) = push_down_last_rows(sort_exec.input(), fetch)? {
+                            let new_plan = plan.with_new_children(vec![new_child])?;
+                            return Ok(Transformed::Yes(new_plan));
+                        }
+                    }
+                }
+            }
+
+            Ok(Transformed::No(plan))
+        })
+    }
+
+    fn name(&self) -> &str {
+        "push_down_last_rows"
+    }
+
+    fn schema_check(&self) -> bool {
+        true
+    }
+}
+
+fn is_sorted_by_time_desc(sort_exec: &SortExec) -> bool {
+    match sort_exec.expr().first() {
+        Some(sort_expr) => {
+            sort_expr.options.descending
+                && sort_expr
+                    .expr
+                    .as_any()
+                    .downcast_ref::<Column>()
+                    .map(|c| c.name() == TIME_FIELD_NAME)
+                    .unwrap_or(false)
+        }
+        None => false,
+    }
+}
+
+/// Returns the new plan if the TskvExec is reached only through the operators
+/// which neither filter nor rename the rows.
+fn push_down_last_rows(
+    plan: &Arc<dyn ExecutionPlan>,
+    last_rows: usize,
+) -> DFResult<Option<Arc<dyn ExecutionPlan>>> {
+    if let Some(tskv_exec) = downcast_execution_plan::<TskvExec>(plan.as_ref()) {
+        return Ok(Some(Arc::new(tskv_exec.with_last_rows(last_rows))));
+    }
+
+    let is_transparent = downcast_execution_plan::<CoalescePartitionsExec>(plan.as_ref()).is_some()
+        || downcast_execution_plan::<RepartitionExec>(plan.as_ref()).is_some()
+        || downcast_execution_plan::<CoalesceBatchesExec>(plan.as_ref()).is_some();
+    if !is_transparent {
+        return Ok(None);
+    }
+
+    let children = plan.children();
+    if children.len() != 1 {
+        return Ok(None);
+    }
+    match push_down_last_rows(&children[0], last_rows)? {
+        Some(new_child) => Ok(Some(plan.clone().with_new_children(vec![new_child])?)),
+        None => Ok(None),
+    }
+}
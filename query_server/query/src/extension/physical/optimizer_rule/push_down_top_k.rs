@@ -0,0 +1,125 @@
+use std::sync::Arc;
+
+use datafusion::common::tree_node::{Transformed, TreeNode};
+use datafusion::common::Result as DFResult;
+use datafusion::config::ConfigOptions;
+use datafusion::physical_expr::expressions::Column;
+use datafusion::physical_optimizer::PhysicalOptimizerRule;
+use datafusion::physical_plan::coalesce_batches::CoalesceBatchesExec;
+use datafusion::physical_plan::coalesce_partitions::CoalescePartitionsExec;
+use datafusion::physical_plan::repartition::RepartitionExec;
+use datafusion::physical_plan::sorts::sort::SortExec;
+use datafusion::physical_plan::ExecutionPlan;
+use models::predicate::TopK;
+use models::schema::TIME_FIELD_NAME;
+
+use crate::extension::physical::plan_node::tskv_exec::TskvExec;
+use crate::extension::utils::downcast_execution_plan;
+
+/// For the queries of the top rows ordered by a column, like
+/// `ORDER BY f DESC LIMIT n` (`TOP`/`BOTTOM`), each vnode only needs to send
+/// its first n rows ordered by the column, instead of all the rows of the
+/// split, to the node sorting the rows.
+///
+/// ```text
+/// SortExec: fetch=n, expr=[f DESC]
+///   (CoalescePartitionsExec | RepartitionExec | CoalesceBatchesExec)*
+///     TskvExec
+/// ->
+/// SortExec: fetch=n, expr=[f DESC]
+///   (CoalescePartitionsExec | RepartitionExec | CoalesceBatchesExec)*
+///     TskvExec: top_k=[f DESC, k=n]
+/// ```
+///
+/// Ordering by time is left to `PushDownLastRows`.
+#[non_exhaustive]
+pub struct PushDownTopK {}
+
+impl PushDownTopK {
+    pub fn new() -> Self {
+        Self {}
+    }
+}
+
+impl Default for PushDownTopK {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl PhysicalOptimizerRule for PushDownTopK {
+    fn optimize(
+        &self,
+        plan: Arc<dyn ExecutionPlan>,
+        _config: &ConfigOptions,
+    ) -> DFResult<Arc<dyn ExecutionPlan>> {
+        plan.transform_down(&|plan| {
+            if let Some(sort_exec) = downcast_execution_plan::<SortExec>(plan.as_ref()) {
+                if let Some(top_k) = top_k(sort_exec) {
+                    if let Some(new_child) = push_down_top_k(sort_exec.input(), &top_k)? {
+                        let new_plan = plan.with_new_children(vec![new_child])?;
+                        return Ok(Transformed::Yes(new_plan));
+                    }
+                }
+            }
+
+            Ok(Transformed::No(plan))
+        })
+    }
+
+    fn name(&self) -> &str {
+        "push_down_top_k"
+    }
+
+    fn schema_check(&self) -> bool {
+        true
+    }
+}
+
+/// The rows needed by the sort with fetch. Only a single column other than
+/// time is supported, the first rows by the first of several columns may miss
+/// the rows ordered by the next columns.
+fn top_k(sort_exec: &SortExec) -> Option<TopK> {
+    let k = sort_exec.fetch()?;
+    let [sort_expr] = sort_exec.expr() else {
+        return None;
+    };
+    let column = sort_expr.expr.as_any().downcast_ref::<Column>()?;
+    if column.name() == TIME_FIELD_NAME {
+        return None;
+    }
+
+    Some(TopK {
+        column: column.name().to_string(),
+        descending: sort_expr.options.descending,
+        nulls_first: sort_expr.options.nulls_first,
+        k,
+    })
+}
+
+/// Returns the new plan if the TskvExec is reached only through the operators
+/// which neither filter nor rename the rows.
+fn push_down_top_k(
+    plan: &Arc<dyn ExecutionPlan>,
+    top_k: &TopK,
+) -> DFResult<Option<Arc<dyn ExecutionPlan>>> {
+    if let Some(tskv_exec) = downcast_execution_plan::<TskvExec>(plan.as_ref()) {
+        return Ok(Some(Arc::new(tskv_exec.with_top_k(top_k.clone()))));
+    }
+
+    let is_transparent = downcast_execution_plan::<CoalescePartitionsExec>(plan.as_ref()).is_some()
+        || downcast_execution_plan::<RepartitionExec>(plan.as_ref()).is_some()
+        || downcast_execution_plan::<CoalesceBatchesExec>(plan.as_ref()).is_some();
+    if !is_transparent {
+        return Ok(None);
+    }
+
+    let children = plan.children();
+    if children.len() != 1 {
+        return Ok(None);
+    }
+    match push_down_top_k(&children[0], top_k)? {
+        Some(new_child) => Ok(Some(plan.clone().with_new_children(vec![new_child])?)),
+        None => Ok(None),
+    }
+}
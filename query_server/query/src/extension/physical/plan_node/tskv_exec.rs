@@ -19,7 +19,7 @@ use futures::{Stream, StreamExt};
 use models::codec::Encoding;
 use models::datafusion::limit_record_batch::limit_record_batch;
 use models::predicate::domain::PredicateRef;
-use models::predicate::PlacedSplit;
+use models::predicate::{PlacedSplit, TopK};
 use models::schema::tskv_table_schema::{
     ColumnType, TableColumn, TskvTableSchema, TskvTableSchemaRef,
 };
@@ -68,6 +68,42 @@ impl TskvExec {
     pub fn filter(&self) -> PredicateRef {
         self.filter.clone()
     }
+
+    /// Only scans the latest `last_rows` rows of each series.
+    pub fn with_last_rows(&self, last_rows: usize) -> Self {
+        let splits = self
+            .splits
+            .iter()
+            .map(|s| s.clone().with_last_rows(Some(last_rows)))
+            .collect();
+
+        Self {
+            table_schema: self.table_schema.clone(),
+            proj_schema: self.proj_schema.clone(),
+            filter: self.filter.clone(),
+            coord: self.coord.clone(),
+            splits,
+            metrics: ExecutionPlanMetricsSet::new(),
+        }
+    }
+
+    /// Only scans the first rows of each split ordered by `top_k.column`.
+    pub fn with_top_k(&self, top_k: TopK) -> Self {
+        let splits = self
+            .splits
+            .iter()
+            .map(|s| s.clone().with_top_k(Some(top_k.clone())))
+            .collect();
+
+        Self {
+            table_schema: self.table_schema.clone(),
+            proj_schema: self.proj_schema.clone(),
+            filter: self.filter.clone(),
+            coord: self.coord.clone(),
+            splits,
+            metrics: ExecutionPlanMetricsSet::new(),
+        }
+    }
 }
 
 impl ExecutionPlan for TskvExec {
@@ -163,7 +199,28 @@ impl ExecutionPlan for TskvExec {
                     PredicateDisplay(&filter),
                     self.splits.len(),
                     fields.join(","),
-                )
+                )?;
+                if let Some(last_rows) = self.splits.first().and_then(|s| s.last_rows()) {
+                    write!(f, ", last_rows={}", last_rows)?;
+                }
+                if let Some(top_k) = self.splits.first().and_then(|s| s.top_k()) {
+                    write!(
+                        f,
+                        ", top_k=[{} {}, k={}]",
+                        top_k.column,
+                        if top_k.descending { "DESC" } else { "ASC" },
+                        top_k.k
+                    )?;
+                }
+                if let Some(sample) = self.splits.first().and_then(|s| s.sample()) {
+                    if let Some(percent) = sample.percent {
+                        write!(f, ", sample_percent={}", percent)?;
+                    }
+                    if let Some(n) = sample.series_modulus {
+                        write!(f, ", sample_series={}", n)?;
+                    }
+                }
+                Ok(())
             }
         }
     }
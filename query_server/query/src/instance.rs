@@ -3,6 +3,7 @@ use std::time::Duration;
 
 use async_trait::async_trait;
 use coordinator::service::CoordinatorRef;
+use datafusion::execution::disk_manager::{DiskManager, DiskManagerConfig};
 use derive_builder::Builder;
 use memory_pool::MemoryPoolRef;
 use meta::error::MetaError;
@@ -22,7 +23,7 @@ use spi::query::logical_planner::Plan;
 use spi::query::session::SessionCtxFactory;
 use spi::server::dbms::DatabaseManagerSystem;
 use spi::service::protocol::{Query, QueryHandle};
-use spi::{AuthSnafu, MetaSnafu, QueryResult};
+use spi::{AuthSnafu, MetaSnafu, QueryResult, StdIoSnafu};
 use trace::{debug, SpanContext};
 use tskv::kv_option::Options;
 
@@ -67,6 +68,10 @@ where
         let auth_cache_key = AuthCacheKey::new(user_info, tenant_name);
         if let Some(user) = self.auth_cache.get(&auth_cache_key) {
             debug!("Hit auth cache for user: {}", user.desc().name());
+            if let Err(e) = self.access_control.verify_session(user_info).await {
+                self.auth_cache.remove(&auth_cache_key);
+                return Err(e).context(AuthSnafu);
+            }
             return Ok(user);
         }
 
@@ -200,11 +205,16 @@ pub async fn make_cnosdbms(
     load_all_system_vars(&mut var_manager, coord.clone())?;
 
     let split_manager = Arc::new(SplitManager::new(coord.clone()));
+    // all sessions share the same disk manager, which creates temporary spill files under spill_path
+    std::fs::create_dir_all(&options.query.spill_path).context(StdIoSnafu)?;
+    let spill_dirs = vec![options.query.spill_path.clone()];
+    let disk_manager = DiskManager::try_new(DiskManagerConfig::new_specified(spill_dirs))?;
     // TODO session config need load global system config
     let session_factory = Arc::new(SessionCtxFactory::new(
         Some(Arc::new(var_manager)),
         query_dedicated_hidden_dir.clone(),
         Some(register_session_udfs),
+        DiskManagerConfig::new_existing(disk_manager),
     ));
     let parser = Arc::new(DefaultParser::default());
     let optimizer = Arc::new(CascadeOptimizerBuilder::default().build());
@@ -266,9 +276,13 @@ pub async fn make_cnosdbms(
     let auth_cache: Arc<AuthCache<AuthCacheKey, User>> =
         Arc::new(AuthCache::new(1024, Some(Duration::from_secs(60 * 60))));
 
+    // the views of usage_schema read the metrics stored by the monitor
+    let usage_database = coord.get_config().monitor.database;
+    let session_secret = coord.get_config().security.session_secret;
     let query_dispatcher = SimpleQueryDispatcherBuilder::default()
         .with_coord(coord)
         .with_default_table_provider(default_table_provider)
+        .with_usage_database(usage_database)
         .with_split_manager(split_manager)
         .with_session_factory(session_factory)
         .with_memory_pool(memory_pool)
@@ -285,7 +299,10 @@ pub async fn make_cnosdbms(
     let access_control_no_check = AccessControlNoCheck::new(meta_manager);
     if options.query.auth_enabled {
         debug!("build access control");
-        builder.access_control(Arc::new(AccessControlImpl::new(access_control_no_check)))
+        builder.access_control(Arc::new(AccessControlImpl::new(
+            access_control_no_check,
+            session_secret,
+        )))
     } else {
         debug!("build access control without check");
         builder.access_control(Arc::new(access_control_no_check))
@@ -341,6 +358,7 @@ mod tests {
             user: DEFAULT_CATALOG.to_string(),
             password: "todo".to_string(),
             private_key: None,
+            session_token: None,
         };
 
         let user = db
@@ -6,7 +6,10 @@ use datafusion::datasource::listing::{ListingTable, ListingTableConfig, ListingT
 use datafusion::error::DataFusionError;
 use meta::error::MetaError;
 use meta::model::MetaClientRef;
+use models::schema::database_schema::DatabaseSchema;
+use models::schema::materialized_view::MaterializedView;
 use models::schema::table_schema::TableSchema;
+use models::schema::tskv_table_schema::TskvTableSchemaRef;
 use spi::query::datasource::stream::StreamProviderManagerRef;
 
 use super::TableHandleProvider;
@@ -37,6 +40,37 @@ impl BaseTableProvider {
     }
 }
 
+impl BaseTableProvider {
+    fn cluster_table(&self, schema: TskvTableSchemaRef) -> ClusterTable {
+        ClusterTable::new(
+            self.coord.clone(),
+            self.split_manager.clone(),
+            self.meta_client.clone(),
+            schema,
+        )
+    }
+
+    /// The views of the table, the widest buckets first.
+    fn materialized_views(
+        &self,
+        db_schema: &DatabaseSchema,
+        table_name: &str,
+    ) -> Vec<(MaterializedView, Arc<ClusterTable>)> {
+        let mut views = db_schema
+            .materialized_views_of(table_name)
+            .filter_map(|view| {
+                let schema = self
+                    .meta_client
+                    .get_tskv_table_schema(db_schema.database_name(), &view.name)
+                    .ok()??;
+                Some((view.clone(), Arc::new(self.cluster_table(schema))))
+            })
+            .collect::<Vec<_>>();
+        views.sort_by(|(a, _), (b, _)| b.interval.cmp(&a.interval));
+        views
+    }
+}
+
 impl TableHandleProvider for BaseTableProvider {
     fn build_table_handle(&self, database_name: &str, table_name: &str) -> DFResult<TableHandle> {
         let db_schema = self
@@ -73,12 +107,10 @@ impl TableHandleProvider for BaseTableProvider {
             .map_err(|e| DataFusionError::External(Box::new(e)))?
         {
             Some(table) => match table {
-                TableSchema::TsKvTableSchema(schema) => Arc::new(ClusterTable::new(
-                    self.coord.clone(),
-                    self.split_manager.clone(),
-                    self.meta_client.clone(),
-                    schema,
-                ))
+                TableSchema::TsKvTableSchema(schema) => Arc::new(
+                    self.cluster_table(schema)
+                        .with_materialized_views(self.materialized_views(&db_schema, table_name)),
+                )
                 .into(),
                 TableSchema::ExternalTableSchema(schema) => {
                     let table_path = ListingTableUrl::parse(&schema.location)?;
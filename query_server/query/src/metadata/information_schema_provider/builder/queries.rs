@@ -20,6 +20,7 @@ lazy_static! {
         Field::new("duration", DataType::Float64, false),
         Field::new("processed_count", DataType::UInt64, false),
         Field::new("error_count", DataType::UInt64, false),
+        Field::new("estimated_count", DataType::UInt64, true),
     ]));
 }
 
@@ -38,6 +39,7 @@ pub struct InformationSchemaQueriesBuilder {
     durations: Float64Builder,
     processed_counts: UInt64Builder,
     error_counts: UInt64Builder,
+    estimated_counts: UInt64Builder,
 }
 
 impl InformationSchemaQueriesBuilder {
@@ -56,6 +58,7 @@ impl InformationSchemaQueriesBuilder {
         duration: f64,
         processed_count: u64,
         error_count: u64,
+        estimated_count: Option<u64>,
     ) {
         // Note: append_value is actually infallable.
         self.query_ids.append_value(query_id.as_ref());
@@ -70,6 +73,7 @@ impl InformationSchemaQueriesBuilder {
         self.durations.append_value(duration);
         self.processed_counts.append_value(processed_count);
         self.error_counts.append_value(error_count);
+        self.estimated_counts.append_option(estimated_count);
     }
 }
 
@@ -90,6 +94,7 @@ impl TryFrom<InformationSchemaQueriesBuilder> for RecordBatch {
             mut durations,
             mut processed_counts,
             mut error_counts,
+            mut estimated_counts,
         } = value;
 
         let batch = RecordBatch::try_new(
@@ -107,6 +112,7 @@ impl TryFrom<InformationSchemaQueriesBuilder> for RecordBatch {
                 Arc::new(durations.finish()),
                 Arc::new(processed_counts.finish()),
                 Arc::new(error_counts.finish()),
+                Arc::new(estimated_counts.finish()),
             ],
         )?;
 
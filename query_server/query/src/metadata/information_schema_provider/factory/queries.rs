@@ -110,6 +110,7 @@ impl TableProvider for InformationQueriesTable {
             let duration = status.duration().as_secs_f64();
             let processed_count = status.processed_count();
             let error_count = status.error_count();
+            let estimated_count = status.estimated_count();
 
             builder.append_row(
                 query_id,
@@ -124,6 +125,7 @@ impl TableProvider for InformationQueriesTable {
                 duration,
                 processed_count,
                 error_count,
+                estimated_count,
             );
         }
         let rb: RecordBatch = builder.try_into()?;
@@ -104,6 +104,7 @@ impl MetadataProvider {
         meta_client: MetaClientRef,
         current_session_table_provider: TableHandleProviderRef,
         default_table_provider: TableHandleProviderRef,
+        usage_database: String,
         func_manager: FuncMetaManagerRef,
         query_tracker: Arc<QueryTracker>,
         session: SessionCtx,
@@ -118,7 +119,7 @@ impl MetadataProvider {
             func_manager,
             information_schema_provider: InformationSchemaProvider::new(query_tracker),
             cluster_schema_provider: ClusterSchemaProvider::new(),
-            usage_schema_provider: UsageSchemaProvider::new(default_table_provider),
+            usage_schema_provider: UsageSchemaProvider::new(default_table_provider, usage_database),
             access_databases: Default::default(),
         }
     }
@@ -251,11 +252,14 @@ impl ContextProviderExtension for MetadataProvider {
         let database_name = name.database();
         let tenant_name = name.tenant();
 
-        // Cannot query across tenants
+        // Cannot query across tenants, the databases of the tenant can be queried
+        // as `database.table`, the three parts are `tenant.database.table`
         if self.session.tenant() != tenant_name {
             return Err(DataFusionError::Plan(format!(
-                "Tenant conflict, the current connection's tenant is {}",
-                self.session.tenant()
+                "Tenant conflict, the current connection's tenant is {}, but {} is in {}",
+                self.session.tenant(),
+                table_ref,
+                tenant_name
             )));
         }
 
@@ -13,16 +13,21 @@ use super::TableHandleProviderRef;
 use crate::data_source::table_source::TableHandle;
 use crate::metadata::{DEFAULT_CATALOG, USAGE_SCHEMA};
 
+/// The views of the usage metrics of the tenant, over the tables of the
+/// database of the system tenant the metrics are stored in,
+/// `monitor.database`.
 pub struct UsageSchemaProvider {
     table_factories: HashMap<String, BoxUsageSchemaTableFactory>,
     default_table_provider: TableHandleProviderRef,
+    database: String,
 }
 
 impl UsageSchemaProvider {
-    pub fn new(default_table_provider: TableHandleProviderRef) -> Self {
+    pub fn new(default_table_provider: TableHandleProviderRef, database: String) -> Self {
         let mut provider = Self {
             table_factories: Default::default(),
             default_table_provider,
+            database,
         };
         use crate::generate_usage_schema_table_factory;
         macro_rules! register_table_factory {
@@ -66,7 +71,7 @@ impl UsageSchemaProvider {
             .get(name)
             .ok_or_else(|| MetaError::TableNotFound { table: name.into() })
             .context(MetaSnafu)?;
-        usage_schema_table.create(session, &self.default_table_provider)
+        usage_schema_table.create(session, &self.default_table_provider, &self.database)
     }
 }
 
@@ -78,16 +83,18 @@ pub trait UsageSchemaTableFactory {
         &self,
         session: &SessionCtx,
         base_table_provider: &TableHandleProviderRef,
+        database: &str,
     ) -> QueryResult<Arc<dyn TableProvider>>;
 }
 
 pub fn create_usage_schema_view_table(
     session: &SessionCtx,
     default_table_provider: &TableHandleProviderRef,
+    database: &str,
     view_table_name: &str,
 ) -> spi::QueryResult<Arc<dyn TableProvider>> {
     let tenant_name = session.tenant();
-    let table_handle = default_table_provider.build_table_handle(USAGE_SCHEMA, view_table_name)?;
+    let table_handle = default_table_provider.build_table_handle(database, view_table_name)?;
 
     let table_source = match table_handle {
         TableHandle::Tskv(table_provider) => provider_as_source(table_provider),
@@ -124,8 +131,9 @@ macro_rules! generate_usage_schema_table_factory {
                 &self,
                 session: &SessionCtx,
                 base_table_provider: &TableHandleProviderRef,
+                database: &str,
             ) -> QueryResult<Arc<dyn TableProvider>> {
-                create_usage_schema_view_table(session, base_table_provider, $measure)
+                create_usage_schema_view_table(session, base_table_provider, database, $measure)
             }
         }
     };
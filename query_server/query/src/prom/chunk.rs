@@ -0,0 +1,272 @@
+//! Encode the samples to the XOR chunks of Prometheus, the same as the
+//! `chunkenc` package of Prometheus:
+//!
+//! - 2 bytes of the number of samples, big endian.
+//! - The first sample: the timestamp as varint, the value as 64 bits.
+//! - The second sample: the delta of timestamp as uvarint, the XOR of value.
+//! - The others: the delta of the delta of timestamp, the XOR of value.
+
+use protos::prompb::prometheus::chunk::Encoding;
+use protos::prompb::prometheus::{Chunk, ChunkedSeries, Label, Sample, TimeSeries};
+
+/// Prometheus cuts the chunks at 120 samples.
+pub const MAX_SAMPLES_PER_CHUNK: usize = 120;
+
+#[derive(Debug, Default)]
+struct BitWriter {
+    bytes: Vec<u8>,
+    /// Bits not used in the last byte.
+    free: u8,
+}
+
+impl BitWriter {
+    fn write_bit(&mut self, bit: bool) {
+        if self.free == 0 {
+            self.bytes.push(0);
+            self.free = 8;
+        }
+        if bit {
+            let last = self.bytes.len() - 1;
+            self.bytes[last] |= 1 << (self.free - 1);
+        }
+        self.free -= 1;
+    }
+
+    /// Write the lowest `nbits` bits of `value`, the highest one first.
+    fn write_bits(&mut self, value: u64, nbits: u8) {
+        for i in (0..nbits).rev() {
+            self.write_bit((value >> i) & 1 == 1);
+        }
+    }
+
+    fn write_byte(&mut self, byte: u8) {
+        self.write_bits(byte as u64, 8);
+    }
+}
+
+fn write_uvarint(w: &mut BitWriter, mut value: u64) {
+    while value >= 0x80 {
+        w.write_byte(value as u8 | 0x80);
+        value >>= 7;
+    }
+    w.write_byte(value as u8);
+}
+
+fn write_varint(w: &mut BitWriter, value: i64) {
+    // zig-zag encoding
+    write_uvarint(w, ((value << 1) ^ (value >> 63)) as u64)
+}
+
+fn bit_range(x: i64, nbits: u8) -> bool {
+    -((1 << (nbits - 1)) - 1) <= x && x <= 1 << (nbits - 1)
+}
+
+#[derive(Debug)]
+pub struct XorChunkEncoder {
+    stream: BitWriter,
+    num_samples: u16,
+    t: i64,
+    v: f64,
+    t_delta: u64,
+    leading: u8,
+    trailing: u8,
+    min_time: i64,
+}
+
+impl Default for XorChunkEncoder {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl XorChunkEncoder {
+    pub fn new() -> Self {
+        let mut stream = BitWriter::default();
+        // the number of samples is filled at the end
+        stream.write_byte(0);
+        stream.write_byte(0);
+        Self {
+            stream,
+            num_samples: 0,
+            t: 0,
+            v: 0.0,
+            t_delta: 0,
+            leading: 0xff,
+            trailing: 0,
+            min_time: 0,
+        }
+    }
+
+    pub fn num_samples(&self) -> usize {
+        self.num_samples as usize
+    }
+
+    pub fn append(&mut self, t: i64, v: f64) {
+        let mut t_delta = 0;
+        match self.num_samples {
+            0 => {
+                write_varint(&mut self.stream, t);
+                self.stream.write_bits(v.to_bits(), 64);
+                self.min_time = t;
+            }
+            1 => {
+                t_delta = t.wrapping_sub(self.t) as u64;
+                write_uvarint(&mut self.stream, t_delta);
+                self.write_value(v);
+            }
+            _ => {
+                t_delta = t.wrapping_sub(self.t) as u64;
+                let dod = t_delta.wrapping_sub(self.t_delta) as i64;
+                if dod == 0 {
+                    self.stream.write_bit(false);
+                } else if bit_range(dod, 14) {
+                    self.stream.write_bits(0b10, 2);
+                    self.stream.write_bits(dod as u64, 14);
+                } else if bit_range(dod, 17) {
+                    self.stream.write_bits(0b110, 3);
+                    self.stream.write_bits(dod as u64, 17);
+                } else if bit_range(dod, 20) {
+                    self.stream.write_bits(0b1110, 4);
+                    self.stream.write_bits(dod as u64, 20);
+                } else {
+                    self.stream.write_bits(0b1111, 4);
+                    self.stream.write_bits(dod as u64, 64);
+                }
+                self.write_value(v);
+            }
+        }
+        self.t = t;
+        self.v = v;
+        self.t_delta = t_delta;
+        self.num_samples += 1;
+    }
+
+    fn write_value(&mut self, v: f64) {
+        let delta = v.to_bits() ^ self.v.to_bits();
+        if delta == 0 {
+            self.stream.write_bit(false);
+            return;
+        }
+        self.stream.write_bit(true);
+
+        let leading = (delta.leading_zeros() as u8).min(31);
+        let trailing = delta.trailing_zeros() as u8;
+        if self.leading != 0xff && leading >= self.leading && trailing >= self.trailing {
+            self.stream.write_bit(false);
+            self.stream
+                .write_bits(delta >> self.trailing, 64 - self.leading - self.trailing);
+            return;
+        }
+
+        self.leading = leading;
+        self.trailing = trailing;
+        self.stream.write_bit(true);
+        self.stream.write_bits(leading as u64, 5);
+        // 64 significant bits overflow to 0, the reader takes 0 as 64
+        let sigbits = 64 - leading - trailing;
+        self.stream.write_bits(sigbits as u64, 6);
+        self.stream.write_bits(delta >> trailing, sigbits);
+    }
+
+    pub fn finish(mut self) -> Chunk {
+        let num_samples = self.num_samples.to_be_bytes();
+        self.stream.bytes[..2].copy_from_slice(&num_samples);
+        Chunk {
+            min_time_ms: self.min_time,
+            max_time_ms: self.t,
+            r#type: Encoding::Xor as i32,
+            data: self.stream.bytes,
+        }
+    }
+}
+
+/// Encode the samples, sorted by time, to chunks.
+pub fn encode_chunks(samples: &[Sample]) -> Vec<Chunk> {
+    samples
+        .chunks(MAX_SAMPLES_PER_CHUNK)
+        .map(|samples| {
+            let mut encoder = XorChunkEncoder::new();
+            for sample in samples {
+                encoder.append(sample.timestamp, sample.value);
+            }
+            encoder.finish()
+        })
+        .collect()
+}
+
+/// Convert the series to chunked series, the labels are sorted by name.
+pub fn to_chunked_series(series: TimeSeries) -> ChunkedSeries {
+    let mut labels: Vec<Label> = series.labels;
+    labels.sort_by(|a, b| a.name.cmp(&b.name));
+    ChunkedSeries {
+        labels,
+        chunks: encode_chunks(&series.samples),
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use protos::prompb::prometheus::Sample;
+
+    use super::{encode_chunks, XorChunkEncoder, MAX_SAMPLES_PER_CHUNK};
+
+    #[test]
+    fn test_xor_chunk() {
+        let mut encoder = XorChunkEncoder::new();
+        encoder.append(1000, 1.0);
+        encoder.append(2000, 1.0);
+        encoder.append(3000, 2.0);
+        assert_eq!(encoder.num_samples(), 3);
+        let chunk = encoder.finish();
+        assert_eq!(chunk.min_time_ms, 1000);
+        assert_eq!(chunk.max_time_ms, 3000);
+        assert_eq!(
+            chunk.data,
+            vec![
+                // 3 samples
+                0x00,
+                0x03, //
+                // varint(1000)
+                0xd0,
+                0x0f, //
+                // 1.0
+                0x3f,
+                0xf0,
+                0x00,
+                0x00,
+                0x00,
+                0x00,
+                0x00,
+                0x00, //
+                // uvarint(1000)
+                0xe8,
+                0x07,
+                // 0: the same value, 0: dod is 0, the xor of 1.0 and 2.0:
+                // 1 1 00001(leading 1) 001011(11 significant bits) 11111111111
+                0b0011_0000,
+                0b1001_0111,
+                0b1111_1111,
+                0b1100_0000,
+            ]
+        );
+    }
+
+    #[test]
+    fn test_encode_chunks() {
+        let samples = (0..250)
+            .map(|i| Sample {
+                value: i as f64,
+                timestamp: i * 15_000,
+            })
+            .collect::<Vec<_>>();
+        let chunks = encode_chunks(&samples);
+        assert_eq!(chunks.len(), 3);
+        assert_eq!(chunks[0].min_time_ms, 0);
+        assert_eq!(
+            chunks[0].max_time_ms,
+            (MAX_SAMPLES_PER_CHUNK as i64 - 1) * 15_000
+        );
+        assert_eq!(chunks[2].min_time_ms, 240 * 15_000);
+        assert_eq!(chunks[2].max_time_ms, 249 * 15_000);
+    }
+}
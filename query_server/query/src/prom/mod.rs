@@ -1,4 +1,7 @@
+pub mod chunk;
+pub mod promql;
 pub mod remote_server;
+pub mod stream;
 pub mod time_series;
 
 pub const METRIC_NAME_LABEL: &str = "__name__";
@@ -6,3 +9,11 @@ pub const METRIC_NAME_LABEL: &str = "__name__";
 pub const METRIC_SAMPLE_COLUMN_NAME: &str = "value";
 
 pub const DEFAULT_PROM_TABLE_NAME: &str = "prom_metric_not_specified";
+
+/// The NaN written by Prometheus to mark a series stale, distinct from the
+/// NaN of the samples by its bits.
+pub const STALE_NAN_BITS: u64 = 0x7ff0000000000002;
+
+pub fn is_stale_nan(v: f64) -> bool {
+    v.to_bits() == STALE_NAN_BITS
+}
@@ -0,0 +1,221 @@
+use super::METRIC_NAME_LABEL;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum MatchOp {
+    Eq,
+    Neq,
+    Re,
+    Nre,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+pub struct Matcher {
+    pub name: String,
+    pub op: MatchOp,
+    pub value: String,
+}
+
+impl Matcher {
+    pub fn new(name: impl Into<String>, op: MatchOp, value: impl Into<String>) -> Self {
+        Self {
+            name: name.into(),
+            op,
+            value: value.into(),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq)]
+pub struct VectorSelector {
+    /// Index of the selector in the expression, the key of its series in
+    /// the storage.
+    pub id: usize,
+    pub matchers: Vec<Matcher>,
+    pub offset_ms: i64,
+}
+
+impl VectorSelector {
+    pub fn metric_name(&self) -> Option<&str> {
+        self.matchers
+            .iter()
+            .find(|m| m.name == METRIC_NAME_LABEL && m.op == MatchOp::Eq)
+            .map(|m| m.value.as_str())
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ValueType {
+    Scalar,
+    Vector,
+    Matrix,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum AggregateOp {
+    Sum,
+    Avg,
+    Min,
+    Max,
+    Count,
+    Group,
+    Stddev,
+    Stdvar,
+    Topk,
+    Bottomk,
+    Quantile,
+}
+
+impl AggregateOp {
+    pub fn from_name(name: &str) -> Option<Self> {
+        Some(match name {
+            "sum" => Self::Sum,
+            "avg" => Self::Avg,
+            "min" => Self::Min,
+            "max" => Self::Max,
+            "count" => Self::Count,
+            "group" => Self::Group,
+            "stddev" => Self::Stddev,
+            "stdvar" => Self::Stdvar,
+            "topk" => Self::Topk,
+            "bottomk" => Self::Bottomk,
+            "quantile" => Self::Quantile,
+            _ => return None,
+        })
+    }
+
+    pub fn has_param(&self) -> bool {
+        matches!(self, Self::Topk | Self::Bottomk | Self::Quantile)
+    }
+}
+
+#[derive(Debug, Clone, PartialEq)]
+pub enum Grouping {
+    By(Vec<String>),
+    Without(Vec<String>),
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum BinaryOp {
+    Add,
+    Sub,
+    Mul,
+    Div,
+    Mod,
+    Pow,
+    Eq,
+    Neq,
+    Gt,
+    Lt,
+    Gte,
+    Lte,
+    And,
+    Or,
+    Unless,
+}
+
+impl BinaryOp {
+    pub fn precedence(&self) -> u8 {
+        match self {
+            Self::Or => 1,
+            Self::And | Self::Unless => 2,
+            Self::Eq | Self::Neq | Self::Gt | Self::Lt | Self::Gte | Self::Lte => 3,
+            Self::Add | Self::Sub => 4,
+            Self::Mul | Self::Div | Self::Mod => 5,
+            Self::Pow => 6,
+        }
+    }
+
+    pub fn is_comparison(&self) -> bool {
+        matches!(
+            self,
+            Self::Eq | Self::Neq | Self::Gt | Self::Lt | Self::Gte | Self::Lte
+        )
+    }
+
+    pub fn is_set(&self) -> bool {
+        matches!(self, Self::And | Self::Or | Self::Unless)
+    }
+}
+
+/// Labels to match the samples of the two sides of a binary operation,
+/// all the labels but the metric name by default.
+#[derive(Debug, Clone, PartialEq)]
+pub enum VectorMatching {
+    On(Vec<String>),
+    Ignoring(Vec<String>),
+}
+
+#[derive(Debug, Clone, PartialEq)]
+pub enum Expr {
+    Number(f64),
+    Vector(VectorSelector),
+    Matrix {
+        selector: VectorSelector,
+        range_ms: i64,
+    },
+    Neg(Box<Expr>),
+    Call {
+        func: &'static str,
+        args: Vec<Expr>,
+    },
+    Aggregate {
+        op: AggregateOp,
+        param: Option<Box<Expr>>,
+        grouping: Grouping,
+        expr: Box<Expr>,
+    },
+    Binary {
+        op: BinaryOp,
+        lhs: Box<Expr>,
+        rhs: Box<Expr>,
+        return_bool: bool,
+        matching: Option<VectorMatching>,
+    },
+}
+
+impl Expr {
+    pub fn value_type(&self) -> ValueType {
+        match self {
+            Expr::Number(_) => ValueType::Scalar,
+            Expr::Vector(_) | Expr::Aggregate { .. } => ValueType::Vector,
+            Expr::Matrix { .. } => ValueType::Matrix,
+            Expr::Neg(expr) => expr.value_type(),
+            Expr::Call { func, .. } => super::functions::return_type(func),
+            Expr::Binary { lhs, rhs, .. } => {
+                if lhs.value_type() == ValueType::Scalar && rhs.value_type() == ValueType::Scalar {
+                    ValueType::Scalar
+                } else {
+                    ValueType::Vector
+                }
+            }
+        }
+    }
+
+    /// The selectors of the expression, and the range of the samples each
+    /// one reads before an evaluation time.
+    pub fn selectors(&self) -> Vec<(&VectorSelector, i64)> {
+        let mut selectors = vec![];
+        self.collect_selectors(&mut selectors);
+        selectors
+    }
+
+    fn collect_selectors<'a>(&'a self, selectors: &mut Vec<(&'a VectorSelector, i64)>) {
+        match self {
+            Expr::Number(_) => {}
+            Expr::Vector(selector) => selectors.push((selector, super::LOOKBACK_DELTA_MS)),
+            Expr::Matrix { selector, range_ms } => selectors.push((selector, *range_ms)),
+            Expr::Neg(expr) => expr.collect_selectors(selectors),
+            Expr::Call { args, .. } => args.iter().for_each(|a| a.collect_selectors(selectors)),
+            Expr::Aggregate { param, expr, .. } => {
+                if let Some(param) = param {
+                    param.collect_selectors(selectors);
+                }
+                expr.collect_selectors(selectors);
+            }
+            Expr::Binary { lhs, rhs, .. } => {
+                lhs.collect_selectors(selectors);
+                rhs.collect_selectors(selectors);
+            }
+        }
+    }
+}
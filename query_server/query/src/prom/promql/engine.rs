@@ -0,0 +1,829 @@
+use std::collections::{BTreeMap, HashMap, HashSet};
+
+use spi::server::prom::{PromQLData, PromQLPoint, PromQLSample, PromQLSeries};
+
+use super::ast::{
+    AggregateOp, BinaryOp, Expr, Grouping, ValueType, VectorMatching, VectorSelector,
+};
+use super::functions::{math_function, range_function, variance};
+use super::{LOOKBACK_DELTA_MS, METRIC_NAME_LABEL};
+use crate::prom::is_stale_nan;
+
+pub type Labels = BTreeMap<String, String>;
+
+#[derive(Debug, Clone, PartialEq)]
+pub struct Series {
+    pub labels: Labels,
+    /// `(timestamp in milliseconds, value)`, sorted by time.
+    pub samples: Vec<(i64, f64)>,
+}
+
+/// The series read for the selectors, by [`VectorSelector::id`].
+pub type Storage = HashMap<usize, Vec<Series>>;
+
+#[derive(Debug, Clone, PartialEq)]
+struct Sample {
+    labels: Labels,
+    /// Time of the sample selected, or the evaluation time if it is
+    /// calculated.
+    t: i64,
+    v: f64,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum Value {
+    Scalar(f64),
+    Vector(Vec<Sample>),
+    Matrix(Vec<Series>),
+}
+
+pub struct Evaluator<'a> {
+    storage: &'a Storage,
+}
+
+impl<'a> Evaluator<'a> {
+    pub fn new(storage: &'a Storage) -> Self {
+        Self { storage }
+    }
+
+    pub fn instant_query(&self, expr: &Expr, t: i64) -> Result<PromQLData, String> {
+        Ok(match self.eval(expr, t)? {
+            Value::Scalar(v) => PromQLData::Scalar(PromQLPoint::new(t, v)),
+            Value::Vector(samples) => {
+                check_unique(&samples)?;
+                PromQLData::Vector(
+                    samples
+                        .into_iter()
+                        .map(|s| PromQLSample {
+                            metric: s.labels,
+                            value: PromQLPoint::new(t, s.v),
+                        })
+                        .collect(),
+                )
+            }
+            Value::Matrix(series) => PromQLData::Matrix(
+                series
+                    .into_iter()
+                    .map(|s| PromQLSeries {
+                        metric: s.labels,
+                        values: s
+                            .samples
+                            .into_iter()
+                            .map(|(t, v)| PromQLPoint::new(t, v))
+                            .collect(),
+                    })
+                    .collect(),
+            ),
+        })
+    }
+
+    /// Evaluate the expression at `start`, `start + step`, ... until `end`,
+    /// the results are always a matrix.
+    pub fn range_query(
+        &self,
+        expr: &Expr,
+        start: i64,
+        end: i64,
+        step: i64,
+    ) -> Result<PromQLData, String> {
+        if expr.value_type() == ValueType::Matrix {
+            return Err(
+                "invalid expression type \"range vector\" for range query, must be scalar or instant vector"
+                    .to_string(),
+            );
+        }
+        if step <= 0 {
+            return Err("step must be positive".to_string());
+        }
+
+        let mut series = BTreeMap::<Labels, Vec<PromQLPoint>>::new();
+        let mut t = start;
+        while t <= end {
+            match self.eval(expr, t)? {
+                Value::Scalar(v) => series
+                    .entry(Labels::new())
+                    .or_default()
+                    .push(PromQLPoint::new(t, v)),
+                Value::Vector(samples) => {
+                    check_unique(&samples)?;
+                    for s in samples {
+                        series
+                            .entry(s.labels)
+                            .or_default()
+                            .push(PromQLPoint::new(t, s.v));
+                    }
+                }
+                Value::Matrix(_) => return Err("unexpected range vector".to_string()),
+            }
+            t += step;
+        }
+
+        Ok(PromQLData::Matrix(
+            series
+                .into_iter()
+                .map(|(metric, values)| PromQLSeries { metric, values })
+                .collect(),
+        ))
+    }
+
+    fn eval(&self, expr: &Expr, t: i64) -> Result<Value, String> {
+        match expr {
+            Expr::Number(n) => Ok(Value::Scalar(*n)),
+            Expr::Vector(selector) => Ok(Value::Vector(self.select_vector(selector, t))),
+            Expr::Matrix { selector, range_ms } => {
+                let end = t - selector.offset_ms;
+                let series = self
+                    .series(selector)
+                    .iter()
+                    .filter_map(|s| {
+                        let samples = range_samples(&s.samples, end - range_ms, end);
+                        (!samples.is_empty()).then(|| Series {
+                            labels: s.labels.clone(),
+                            samples,
+                        })
+                    })
+                    .collect();
+                Ok(Value::Matrix(series))
+            }
+            Expr::Neg(expr) => match self.eval(expr, t)? {
+                Value::Scalar(v) => Ok(Value::Scalar(-v)),
+                Value::Vector(samples) => Ok(Value::Vector(
+                    samples
+                        .into_iter()
+                        .map(|s| Sample {
+                            labels: drop_metric_name(s.labels),
+                            t,
+                            v: -s.v,
+                        })
+                        .collect(),
+                )),
+                Value::Matrix(_) => Err("unary expression on a range vector".to_string()),
+            },
+            Expr::Call { func, args } => self.eval_call(func, args, t),
+            Expr::Aggregate {
+                op,
+                param,
+                grouping,
+                expr,
+            } => self.eval_aggregate(*op, param.as_deref(), grouping, expr, t),
+            Expr::Binary {
+                op,
+                lhs,
+                rhs,
+                return_bool,
+                matching,
+            } => self.eval_binary(*op, lhs, rhs, *return_bool, matching.as_ref(), t),
+        }
+    }
+
+    fn eval_scalar(&self, expr: &Expr, t: i64) -> Result<f64, String> {
+        match self.eval(expr, t)? {
+            Value::Scalar(v) => Ok(v),
+            _ => Err("expected a scalar".to_string()),
+        }
+    }
+
+    fn eval_vector(&self, expr: &Expr, t: i64) -> Result<Vec<Sample>, String> {
+        match self.eval(expr, t)? {
+            Value::Vector(samples) => Ok(samples),
+            _ => Err("expected an instant vector".to_string()),
+        }
+    }
+
+    fn series(&self, selector: &VectorSelector) -> &[Series] {
+        self.storage
+            .get(&selector.id)
+            .map_or(&[], |series| series.as_slice())
+    }
+
+    /// The latest sample of each series in the lookback, none of a series
+    /// marked stale.
+    fn select_vector(&self, selector: &VectorSelector, t: i64) -> Vec<Sample> {
+        let end = t - selector.offset_ms;
+        self.series(selector)
+            .iter()
+            .filter_map(|s| {
+                let (ts, v) = *window(&s.samples, end - LOOKBACK_DELTA_MS, end).last()?;
+                if is_stale_nan(v) {
+                    return None;
+                }
+                Some(Sample {
+                    labels: s.labels.clone(),
+                    t: ts,
+                    v,
+                })
+            })
+            .collect()
+    }
+
+    fn eval_call(&self, func: &str, args: &[Expr], t: i64) -> Result<Value, String> {
+        if let Some(Expr::Matrix { selector, range_ms }) = args.first() {
+            let range_end = t - selector.offset_ms;
+            let range_start = range_end - range_ms;
+            let samples = self
+                .series(selector)
+                .iter()
+                .filter_map(|s| {
+                    let samples = range_samples(&s.samples, range_start, range_end);
+                    let v = range_function(func, &samples, range_start, range_end)?;
+                    // the same as Prometheus, `last_over_time` keeps the metric name
+                    let labels = if func == "last_over_time" {
+                        s.labels.clone()
+                    } else {
+                        drop_metric_name(s.labels.clone())
+                    };
+                    Some(Sample { labels, t, v })
+                })
+                .collect();
+            return Ok(Value::Vector(samples));
+        }
+
+        let map_vector = |f: &dyn Fn(&Sample) -> f64| -> Result<Value, String> {
+            let samples = self.eval_vector(&args[0], t)?;
+            Ok(Value::Vector(
+                samples
+                    .iter()
+                    .map(|s| Sample {
+                        labels: drop_metric_name(s.labels.clone()),
+                        t,
+                        v: f(s),
+                    })
+                    .collect(),
+            ))
+        };
+        match func {
+            "time" => Ok(Value::Scalar(t as f64 / 1000.0)),
+            "vector" => Ok(Value::Vector(vec![Sample {
+                labels: Labels::new(),
+                t,
+                v: self.eval_scalar(&args[0], t)?,
+            }])),
+            "scalar" => {
+                let samples = self.eval_vector(&args[0], t)?;
+                Ok(Value::Scalar(match samples.as_slice() {
+                    [s] => s.v,
+                    _ => f64::NAN,
+                }))
+            }
+            "timestamp" => map_vector(&|s| s.t as f64 / 1000.0),
+            "clamp_min" => {
+                let min = self.eval_scalar(&args[1], t)?;
+                map_vector(&|s| s.v.max(min))
+            }
+            "clamp_max" => {
+                let max = self.eval_scalar(&args[1], t)?;
+                map_vector(&|s| s.v.min(max))
+            }
+            _ => {
+                if math_function(func, 0.0).is_none() {
+                    return Err(format!("unknown function '{}'", func));
+                }
+                map_vector(&|s| math_function(func, s.v).unwrap_or(f64::NAN))
+            }
+        }
+    }
+
+    fn eval_aggregate(
+        &self,
+        op: AggregateOp,
+        param: Option<&Expr>,
+        grouping: &Grouping,
+        expr: &Expr,
+        t: i64,
+    ) -> Result<Value, String> {
+        let param = match param {
+            Some(param) => self.eval_scalar(param, t)?,
+            None => f64::NAN,
+        };
+        let mut groups = BTreeMap::<Labels, Vec<Sample>>::new();
+        for s in self.eval_vector(expr, t)? {
+            groups
+                .entry(group_labels(&s.labels, grouping))
+                .or_default()
+                .push(s);
+        }
+
+        let mut result = vec![];
+        for (labels, mut samples) in groups {
+            let values = samples.iter().map(|s| s.v);
+            let count = samples.len() as f64;
+            let v = match op {
+                AggregateOp::Sum => values.sum(),
+                AggregateOp::Avg => values.sum::<f64>() / count,
+                AggregateOp::Min => values.reduce(f64::min).unwrap_or(f64::NAN),
+                AggregateOp::Max => values.reduce(f64::max).unwrap_or(f64::NAN),
+                AggregateOp::Count => count,
+                AggregateOp::Group => 1.0,
+                AggregateOp::Stddev => variance(values).sqrt(),
+                AggregateOp::Stdvar => variance(values),
+                AggregateOp::Quantile => quantile(param, values.collect()),
+                AggregateOp::Topk | AggregateOp::Bottomk => {
+                    // NaN is the last of both
+                    let descending = op == AggregateOp::Topk;
+                    samples.sort_by(|a, b| match (a.v.is_nan(), b.v.is_nan()) {
+                        (false, false) if descending => b.v.total_cmp(&a.v),
+                        (false, false) => a.v.total_cmp(&b.v),
+                        (a_nan, b_nan) => a_nan.cmp(&b_nan),
+                    });
+                    let k = if param >= 1.0 { param as usize } else { 0 };
+                    result.extend(samples.into_iter().take(k).map(|s| Sample { t, ..s }));
+                    continue;
+                }
+            };
+            result.push(Sample { labels, t, v });
+        }
+        Ok(Value::Vector(result))
+    }
+
+    fn eval_binary(
+        &self,
+        op: BinaryOp,
+        lhs: &Expr,
+        rhs: &Expr,
+        return_bool: bool,
+        matching: Option<&VectorMatching>,
+        t: i64,
+    ) -> Result<Value, String> {
+        match (self.eval(lhs, t)?, self.eval(rhs, t)?) {
+            (Value::Scalar(l), Value::Scalar(r)) => {
+                let (v, keep) = binary_value(op, l, r);
+                Ok(Value::Scalar(if op.is_comparison() {
+                    bool_value(keep)
+                } else {
+                    v
+                }))
+            }
+            (Value::Vector(l), Value::Scalar(r)) => Ok(Value::Vector(vector_scalar(
+                op,
+                l,
+                r,
+                false,
+                return_bool,
+                t,
+            ))),
+            (Value::Scalar(l), Value::Vector(r)) => {
+                Ok(Value::Vector(vector_scalar(op, r, l, true, return_bool, t)))
+            }
+            (Value::Vector(l), Value::Vector(r)) => Ok(Value::Vector(vector_vector(
+                op,
+                l,
+                r,
+                return_bool,
+                matching,
+                t,
+            )?)),
+            _ => Err("binary expression must contain only scalar and instant vector types".into()),
+        }
+    }
+}
+
+/// The samples in `(start, end]`.
+fn window(samples: &[(i64, f64)], start: i64, end: i64) -> &[(i64, f64)] {
+    let from = samples.partition_point(|(t, _)| *t <= start);
+    let to = samples.partition_point(|(t, _)| *t <= end);
+    &samples[from..to.max(from)]
+}
+
+/// The samples of a range vector in `(start, end]`, without the staleness
+/// markers.
+fn range_samples(samples: &[(i64, f64)], start: i64, end: i64) -> Vec<(i64, f64)> {
+    window(samples, start, end)
+        .iter()
+        .filter(|(_, v)| !is_stale_nan(*v))
+        .copied()
+        .collect()
+}
+
+fn drop_metric_name(mut labels: Labels) -> Labels {
+    labels.remove(METRIC_NAME_LABEL);
+    labels
+}
+
+fn check_unique(samples: &[Sample]) -> Result<(), String> {
+    let mut seen = HashSet::with_capacity(samples.len());
+    for s in samples {
+        if !seen.insert(&s.labels) {
+            return Err(format!(
+                "vector cannot contain metrics with the same labelset {:?}",
+                s.labels
+            ));
+        }
+    }
+    Ok(())
+}
+
+fn group_labels(labels: &Labels, grouping: &Grouping) -> Labels {
+    match grouping {
+        Grouping::By(names) => labels
+            .iter()
+            .filter(|(k, _)| names.contains(k))
+            .map(|(k, v)| (k.clone(), v.clone()))
+            .collect(),
+        Grouping::Without(names) => labels
+            .iter()
+            .filter(|(k, _)| *k != METRIC_NAME_LABEL && !names.contains(k))
+            .map(|(k, v)| (k.clone(), v.clone()))
+            .collect(),
+    }
+}
+
+/// The φ-quantile of the values, interpolated linearly as Prometheus.
+fn quantile(q: f64, mut values: Vec<f64>) -> f64 {
+    if values.is_empty() || q.is_nan() {
+        return f64::NAN;
+    }
+    if q < 0.0 {
+        return f64::NEG_INFINITY;
+    }
+    if q > 1.0 {
+        return f64::INFINITY;
+    }
+    values.sort_by(f64::total_cmp);
+    let rank = q * (values.len() - 1) as f64;
+    let lower = rank.floor() as usize;
+    let upper = (lower + 1).min(values.len() - 1);
+    let weight = rank - rank.floor();
+    values[lower] * (1.0 - weight) + values[upper] * weight
+}
+
+fn bool_value(b: bool) -> f64 {
+    if b {
+        1.0
+    } else {
+        0.0
+    }
+}
+
+/// The value of the operation and whether a comparison is true, the value
+/// of a comparison is the left hand side.
+fn binary_value(op: BinaryOp, l: f64, r: f64) -> (f64, bool) {
+    match op {
+        BinaryOp::Add => (l + r, true),
+        BinaryOp::Sub => (l - r, true),
+        BinaryOp::Mul => (l * r, true),
+        BinaryOp::Div => (l / r, true),
+        BinaryOp::Mod => (l % r, true),
+        BinaryOp::Pow => (l.powf(r), true),
+        BinaryOp::Eq => (l, l == r),
+        BinaryOp::Neq => (l, l != r),
+        BinaryOp::Gt => (l, l > r),
+        BinaryOp::Lt => (l, l < r),
+        BinaryOp::Gte => (l, l >= r),
+        BinaryOp::Lte => (l, l <= r),
+        // the set operators match the series, not the values
+        BinaryOp::And | BinaryOp::Or | BinaryOp::Unless => (l, true),
+    }
+}
+
+/// `swapped` if the scalar is the left hand side.
+fn vector_scalar(
+    op: BinaryOp,
+    vector: Vec<Sample>,
+    scalar: f64,
+    swapped: bool,
+    return_bool: bool,
+    t: i64,
+) -> Vec<Sample> {
+    vector
+        .into_iter()
+        .filter_map(|s| {
+            let (l, r) = if swapped {
+                (scalar, s.v)
+            } else {
+                (s.v, scalar)
+            };
+            let (mut v, keep) = binary_value(op, l, r);
+            if op.is_comparison() {
+                // a comparison keeps the value of the vector
+                v = s.v;
+            }
+            if return_bool {
+                v = bool_value(keep);
+            } else if !keep {
+                return None;
+            }
+            let labels = if return_bool || !op.is_comparison() {
+                drop_metric_name(s.labels)
+            } else {
+                s.labels
+            };
+            Some(Sample { labels, t, v })
+        })
+        .collect()
+}
+
+/// The labels to match the samples of the two sides.
+fn signature(labels: &Labels, matching: Option<&VectorMatching>) -> Labels {
+    let include = |k: &String| match matching {
+        None => k != METRIC_NAME_LABEL,
+        Some(VectorMatching::On(names)) => names.contains(k),
+        Some(VectorMatching::Ignoring(names)) => k != METRIC_NAME_LABEL && !names.contains(k),
+    };
+    labels
+        .iter()
+        .filter(|(k, _)| include(k))
+        .map(|(k, v)| (k.clone(), v.clone()))
+        .collect()
+}
+
+fn vector_vector(
+    op: BinaryOp,
+    lhs: Vec<Sample>,
+    rhs: Vec<Sample>,
+    return_bool: bool,
+    matching: Option<&VectorMatching>,
+    t: i64,
+) -> Result<Vec<Sample>, String> {
+    match op {
+        BinaryOp::And | BinaryOp::Unless => {
+            let rhs_signatures = rhs
+                .iter()
+                .map(|s| signature(&s.labels, matching))
+                .collect::<HashSet<_>>();
+            let keep_matched = op == BinaryOp::And;
+            return Ok(lhs
+                .into_iter()
+                .filter(|s| {
+                    rhs_signatures.contains(&signature(&s.labels, matching)) == keep_matched
+                })
+                .collect());
+        }
+        BinaryOp::Or => {
+            let lhs_signatures = lhs
+                .iter()
+                .map(|s| signature(&s.labels, matching))
+                .collect::<HashSet<_>>();
+            let mut result = lhs;
+            result.extend(
+                rhs.into_iter()
+                    .filter(|s| !lhs_signatures.contains(&signature(&s.labels, matching))),
+            );
+            return Ok(result);
+        }
+        _ => {}
+    }
+
+    let mut rhs_by_signature = HashMap::with_capacity(rhs.len());
+    for s in rhs {
+        let key = signature(&s.labels, matching);
+        if let Some(duplicated) = rhs_by_signature.insert(key, s) {
+            return Err(format!(
+                "found duplicate series for the match group {:?} on the right hand-side of the operation",
+                duplicated.labels
+            ));
+        }
+    }
+
+    let mut matched = HashSet::new();
+    let mut result = vec![];
+    for s in lhs {
+        let key = signature(&s.labels, matching);
+        let r = match rhs_by_signature.get(&key) {
+            Some(r) => r,
+            None => continue,
+        };
+        let (mut v, keep) = binary_value(op, s.v, r.v);
+        if return_bool {
+            v = bool_value(keep);
+        } else if !keep {
+            continue;
+        }
+        if !matched.insert(key) {
+            return Err(
+                "multiple matches for labels: many-to-one matching must be explicit (group_left/group_right)"
+                    .to_string(),
+            );
+        }
+
+        let mut labels = s.labels;
+        if return_bool || !op.is_comparison() {
+            labels.remove(METRIC_NAME_LABEL);
+        }
+        match matching {
+            Some(VectorMatching::On(names)) => labels.retain(|k, _| names.contains(k)),
+            Some(VectorMatching::Ignoring(names)) => labels.retain(|k, _| !names.contains(k)),
+            None => {}
+        }
+        result.push(Sample { labels, t, v });
+    }
+    Ok(result)
+}
+
+#[cfg(test)]
+mod test {
+    use spi::server::prom::{PromQLData, PromQLPoint, PromQLSample, PromQLSeries};
+
+    use super::{quantile, Evaluator, Labels, Series, Storage};
+    use crate::prom::promql::ast::{Expr, MatchOp};
+    use crate::prom::promql::parse;
+    use crate::prom::STALE_NAN_BITS;
+
+    fn labels(pairs: &[(&str, &str)]) -> Labels {
+        pairs
+            .iter()
+            .map(|(k, v)| (k.to_string(), v.to_string()))
+            .collect()
+    }
+
+    /// The series of every selector of the expression are the ones of its
+    /// equality matchers, which are applied by SQL on the tables.
+    fn storage(expr: &Expr, series: &[Series]) -> Storage {
+        expr.selectors()
+            .into_iter()
+            .map(|(selector, _)| {
+                let series = series
+                    .iter()
+                    .filter(|s| {
+                        selector
+                            .matchers
+                            .iter()
+                            .filter(|m| m.op == MatchOp::Eq)
+                            .all(|m| s.labels.get(&m.name) == Some(&m.value))
+                    })
+                    .cloned()
+                    .collect();
+                (selector.id, series)
+            })
+            .collect()
+    }
+
+    fn test_series() -> Vec<Series> {
+        let counter = |job: &str, instance: &str, step: f64| Series {
+            labels: labels(&[
+                ("__name__", "requests"),
+                ("job", job),
+                ("instance", instance),
+            ]),
+            samples: (0..=20).map(|i| (i * 15_000, i as f64 * step)).collect(),
+        };
+        vec![
+            counter("api", "a", 15.0),
+            counter("api", "b", 30.0),
+            counter("web", "c", 150.0),
+            Series {
+                labels: labels(&[("__name__", "limit"), ("job", "api")]),
+                samples: (0..=20).map(|i| (i * 15_000, 100.0)).collect(),
+            },
+        ]
+    }
+
+    fn instant(query: &str, t: i64) -> PromQLData {
+        let expr = parse(query).unwrap();
+        let storage = storage(&expr, &test_series());
+        Evaluator::new(&storage).instant_query(&expr, t).unwrap()
+    }
+
+    fn vector(samples: &[(&[(&str, &str)], f64)], t: i64) -> PromQLData {
+        PromQLData::Vector(
+            samples
+                .iter()
+                .map(|(metric, v)| PromQLSample {
+                    metric: labels(metric),
+                    value: PromQLPoint::new(t, *v),
+                })
+                .collect(),
+        )
+    }
+
+    #[test]
+    fn test_instant_query() {
+        assert_eq!(
+            instant("1 + 2 * 3", 0),
+            PromQLData::Scalar(PromQLPoint(0.0, "7".to_string()))
+        );
+        assert_eq!(
+            instant(r#"requests{instance="a"}"#, 60_000),
+            vector(
+                &[(
+                    &[("__name__", "requests"), ("instance", "a"), ("job", "api")],
+                    60.0
+                )],
+                60_000
+            )
+        );
+        // the latest sample in the lookback
+        assert_eq!(
+            instant(r#"requests{instance="a"} offset 1m"#, 70_000),
+            vector(
+                &[(
+                    &[("__name__", "requests"), ("instance", "a"), ("job", "api")],
+                    0.0
+                )],
+                70_000
+            )
+        );
+        assert_eq!(instant("limit", 600_000), PromQLData::Vector(vec![]));
+
+        assert_eq!(
+            instant("sum by (job) (rate(requests[1m]))", 300_000),
+            vector(
+                &[(&[("job", "api")], 3.0), (&[("job", "web")], 10.0)],
+                300_000
+            )
+        );
+        assert_eq!(
+            instant("max without (instance) (requests) > 1000", 300_000),
+            vector(&[(&[("job", "web")], 3000.0)], 300_000)
+        );
+        assert_eq!(
+            instant("topk(1, requests)", 300_000),
+            vector(
+                &[(
+                    &[("__name__", "requests"), ("instance", "c"), ("job", "web")],
+                    3000.0
+                )],
+                300_000
+            )
+        );
+        assert_eq!(
+            instant(
+                "sum by (job) (requests) / on(job) limit unless requests",
+                300_000
+            ),
+            vector(&[(&[("job", "api")], 9.0)], 300_000)
+        );
+        assert_eq!(
+            instant(r#"requests{job="web"} > bool 100"#, 0),
+            vector(&[(&[("instance", "c"), ("job", "web")], 0.0)], 0)
+        );
+    }
+
+    #[test]
+    fn test_range_query() {
+        let expr = parse(r#"increase(requests{instance="a"}[1m]) or vector(1)"#).unwrap();
+        let storage = storage(&expr, &test_series());
+        let result = Evaluator::new(&storage)
+            .range_query(&expr, 60_000, 120_000, 30_000)
+            .unwrap();
+        let points = |values: &[(i64, f64)]| {
+            values
+                .iter()
+                .map(|(t, v)| PromQLPoint::new(*t, *v))
+                .collect()
+        };
+        assert_eq!(
+            result,
+            PromQLData::Matrix(vec![
+                PromQLSeries {
+                    metric: labels(&[]),
+                    values: points(&[(60_000, 1.0), (90_000, 1.0), (120_000, 1.0)]),
+                },
+                PromQLSeries {
+                    metric: labels(&[("instance", "a"), ("job", "api")]),
+                    values: points(&[(60_000, 60.0), (90_000, 60.0), (120_000, 60.0)]),
+                },
+            ])
+        );
+
+        let expr = parse("requests[1m]").unwrap();
+        assert!(Evaluator::new(&storage)
+            .range_query(&expr, 0, 60_000, 15_000)
+            .is_err());
+        // the same labels after dropping the metric name
+        let expr = parse(r#"abs({job="api"})"#).unwrap();
+        let series = |name: &str| Series {
+            labels: labels(&[("__name__", name), ("job", "api")]),
+            samples: vec![(0, 1.0)],
+        };
+        let storage = Storage::from([(0, vec![series("x"), series("y")])]);
+        assert!(Evaluator::new(&storage).instant_query(&expr, 0).is_err());
+    }
+
+    #[test]
+    fn test_staleness() {
+        let stale = f64::from_bits(STALE_NAN_BITS);
+        let series = Series {
+            labels: labels(&[("__name__", "up"), ("job", "api")]),
+            samples: vec![(0, 1.0), (15_000, 1.0), (30_000, stale), (45_000, f64::NAN)],
+        };
+        let storage = Storage::from([(0, vec![series])]);
+        let instant = |query: &str, t: i64| {
+            Evaluator::new(&storage)
+                .instant_query(&parse(query).unwrap(), t)
+                .unwrap()
+        };
+
+        // the series ends at the marker, unlike a sample of NaN
+        assert_eq!(
+            instant("up", 20_000),
+            vector(&[(&[("__name__", "up"), ("job", "api")], 1.0)], 20_000)
+        );
+        assert_eq!(instant("up", 40_000), PromQLData::Vector(vec![]));
+        assert_eq!(
+            instant("up", 50_000),
+            vector(&[(&[("__name__", "up"), ("job", "api")], f64::NAN)], 50_000)
+        );
+        assert_eq!(
+            instant("count_over_time(up[1m])", 40_000),
+            vector(&[(&[("job", "api")], 2.0)], 40_000)
+        );
+    }
+
+    #[test]
+    fn test_quantile() {
+        assert_eq!(quantile(0.5, vec![1.0, 3.0, 2.0, 4.0]), 2.5);
+        assert_eq!(quantile(1.0, vec![1.0, 3.0]), 3.0);
+        assert_eq!(quantile(2.0, vec![1.0]), f64::INFINITY);
+        assert!(quantile(0.5, vec![]).is_nan());
+    }
+}
@@ -0,0 +1,238 @@
+use super::ast::ValueType::{self, Matrix, Scalar, Vector};
+
+pub struct Function {
+    pub name: &'static str,
+    pub arg_types: &'static [ValueType],
+    pub return_type: ValueType,
+}
+
+const fn function(
+    name: &'static str,
+    arg_types: &'static [ValueType],
+    return_type: ValueType,
+) -> Function {
+    Function {
+        name,
+        arg_types,
+        return_type,
+    }
+}
+
+pub const FUNCTIONS: &[Function] = &[
+    function("abs", &[Vector], Vector),
+    function("ceil", &[Vector], Vector),
+    function("floor", &[Vector], Vector),
+    function("round", &[Vector], Vector),
+    function("exp", &[Vector], Vector),
+    function("ln", &[Vector], Vector),
+    function("log2", &[Vector], Vector),
+    function("log10", &[Vector], Vector),
+    function("sqrt", &[Vector], Vector),
+    function("clamp_min", &[Vector, Scalar], Vector),
+    function("clamp_max", &[Vector, Scalar], Vector),
+    function("timestamp", &[Vector], Vector),
+    function("time", &[], Scalar),
+    function("vector", &[Scalar], Vector),
+    function("scalar", &[Vector], Scalar),
+    function("rate", &[Matrix], Vector),
+    function("irate", &[Matrix], Vector),
+    function("increase", &[Matrix], Vector),
+    function("delta", &[Matrix], Vector),
+    function("idelta", &[Matrix], Vector),
+    function("avg_over_time", &[Matrix], Vector),
+    function("min_over_time", &[Matrix], Vector),
+    function("max_over_time", &[Matrix], Vector),
+    function("sum_over_time", &[Matrix], Vector),
+    function("count_over_time", &[Matrix], Vector),
+    function("last_over_time", &[Matrix], Vector),
+    function("stddev_over_time", &[Matrix], Vector),
+    function("stdvar_over_time", &[Matrix], Vector),
+];
+
+pub fn get_function(name: &str) -> Option<&'static Function> {
+    FUNCTIONS.iter().find(|f| f.name == name)
+}
+
+pub fn return_type(name: &str) -> ValueType {
+    get_function(name).map_or(Vector, |f| f.return_type)
+}
+
+/// Apply the function of an instant vector to a value, `None` if it is
+/// not such a function.
+pub fn math_function(name: &str, v: f64) -> Option<f64> {
+    Some(match name {
+        "abs" => v.abs(),
+        "ceil" => v.ceil(),
+        "floor" => v.floor(),
+        // rounds half up, as Prometheus
+        "round" => (v + 0.5).floor(),
+        "exp" => v.exp(),
+        "ln" => v.ln(),
+        "log2" => v.log2(),
+        "log10" => v.log10(),
+        "sqrt" => v.sqrt(),
+        _ => return None,
+    })
+}
+
+/// Apply the function of a range vector to the samples of a series in
+/// `(range_start, range_end]`, `None` if there is no result.
+pub fn range_function(
+    name: &str,
+    samples: &[(i64, f64)],
+    range_start: i64,
+    range_end: i64,
+) -> Option<f64> {
+    if samples.is_empty() {
+        return None;
+    }
+    let values = || samples.iter().map(|(_, v)| *v);
+    let count = samples.len() as f64;
+    match name {
+        "rate" => extrapolated_rate(samples, range_start, range_end, true, true),
+        "increase" => extrapolated_rate(samples, range_start, range_end, true, false),
+        "delta" => extrapolated_rate(samples, range_start, range_end, false, false),
+        "irate" => instant_value(samples, true),
+        "idelta" => instant_value(samples, false),
+        "avg_over_time" => Some(values().sum::<f64>() / count),
+        "min_over_time" => values().reduce(f64::min),
+        "max_over_time" => values().reduce(f64::max),
+        "sum_over_time" => Some(values().sum()),
+        "count_over_time" => Some(count),
+        "last_over_time" => samples.last().map(|(_, v)| *v),
+        "stddev_over_time" => Some(variance(values()).sqrt()),
+        "stdvar_over_time" => Some(variance(values())),
+        _ => None,
+    }
+}
+
+/// Population variance of the values.
+pub fn variance(values: impl Iterator<Item = f64> + Clone) -> f64 {
+    let count = values.clone().count() as f64;
+    let mean = values.clone().sum::<f64>() / count;
+    values.map(|v| (v - mean).powi(2)).sum::<f64>() / count
+}
+
+/// The rate or delta of the samples, extrapolated to the edges of the
+/// range the same as Prometheus, unless the samples are far from them.
+fn extrapolated_rate(
+    samples: &[(i64, f64)],
+    range_start: i64,
+    range_end: i64,
+    is_counter: bool,
+    is_rate: bool,
+) -> Option<f64> {
+    if samples.len() < 2 {
+        return None;
+    }
+    let (first_t, first_v) = samples[0];
+    let (last_t, last_v) = samples[samples.len() - 1];
+
+    let mut result = last_v - first_v;
+    if is_counter {
+        // a counter reset, the counter restarts from 0
+        for w in samples.windows(2) {
+            if w[1].1 < w[0].1 {
+                result += w[0].1;
+            }
+        }
+    }
+
+    let mut duration_to_start = (first_t - range_start) as f64 / 1000.0;
+    let duration_to_end = (range_end - last_t) as f64 / 1000.0;
+    let sampled_interval = (last_t - first_t) as f64 / 1000.0;
+    let average_interval = sampled_interval / (samples.len() - 1) as f64;
+
+    if is_counter && result > 0.0 && first_v >= 0.0 {
+        // a counter can't be extrapolated below 0
+        let duration_to_zero = sampled_interval * (first_v / result);
+        if duration_to_zero < duration_to_start {
+            duration_to_start = duration_to_zero;
+        }
+    }
+
+    let threshold = average_interval * 1.1;
+    let mut extrapolate_to_interval = sampled_interval;
+    extrapolate_to_interval += if duration_to_start < threshold {
+        duration_to_start
+    } else {
+        average_interval / 2.0
+    };
+    extrapolate_to_interval += if duration_to_end < threshold {
+        duration_to_end
+    } else {
+        average_interval / 2.0
+    };
+
+    result *= extrapolate_to_interval / sampled_interval;
+    if is_rate {
+        result /= (range_end - range_start) as f64 / 1000.0;
+    }
+    Some(result)
+}
+
+/// The rate or delta of the last two samples.
+fn instant_value(samples: &[(i64, f64)], is_rate: bool) -> Option<f64> {
+    if samples.len() < 2 {
+        return None;
+    }
+    let (prev_t, prev_v) = samples[samples.len() - 2];
+    let (last_t, last_v) = samples[samples.len() - 1];
+    if !is_rate {
+        return Some(last_v - prev_v);
+    }
+    if last_t == prev_t {
+        return None;
+    }
+    let result = if last_v < prev_v {
+        // a counter reset
+        last_v
+    } else {
+        last_v - prev_v
+    };
+    Some(result / ((last_t - prev_t) as f64 / 1000.0))
+}
+
+#[cfg(test)]
+mod test {
+    use super::range_function;
+
+    #[test]
+    fn test_range_function() {
+        // a counter increasing by 10 every 15s, with a reset
+        let samples = vec![
+            (15_000, 10.0),
+            (30_000, 20.0),
+            (45_000, 30.0),
+            (60_000, 5.0),
+        ];
+        let increase = range_function("increase", &samples, 0, 60_000).unwrap();
+        // 30 - 10 + 5 = 25 in 45s, extrapolated to 60s
+        assert!((increase - 25.0 * 60.0 / 45.0).abs() < 1e-9);
+        let rate = range_function("rate", &samples, 0, 60_000).unwrap();
+        assert!((rate - increase / 60.0).abs() < 1e-9);
+        assert_eq!(
+            range_function("irate", &samples, 0, 60_000),
+            Some(5.0 / 15.0)
+        );
+        assert_eq!(range_function("idelta", &samples, 0, 60_000), Some(-25.0));
+
+        assert_eq!(
+            range_function("avg_over_time", &samples, 0, 60_000),
+            Some(16.25)
+        );
+        assert_eq!(
+            range_function("max_over_time", &samples, 0, 60_000),
+            Some(30.0)
+        );
+        assert_eq!(
+            range_function("count_over_time", &samples, 0, 60_000),
+            Some(4.0)
+        );
+        assert_eq!(
+            range_function("last_over_time", &samples, 0, 60_000),
+            Some(5.0)
+        );
+        assert_eq!(range_function("rate", &samples[..1], 0, 60_000), None);
+    }
+}
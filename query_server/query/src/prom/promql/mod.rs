@@ -0,0 +1,25 @@
+//! PromQL of the `/api/v1/query` and `/api/v1/query_range` apis. The
+//! series of the selectors are read from the tables by SQL, the same as
+//! the remote read, then the expression is evaluated over them at each
+//! step.
+//!
+//! Supported are the selectors with offsets, the arithmetic, comparison
+//! and set operators with `on` and `ignoring`, the aggregations except
+//! `count_values`, and the functions in [`functions::FUNCTIONS`].
+//! Subqueries, the `@` modifier and `group_left`/`group_right` are not.
+
+pub mod ast;
+pub mod engine;
+pub mod functions;
+pub mod parser;
+
+pub use engine::{Evaluator, Labels, Series, Storage};
+pub use parser::{parse, parse_duration};
+
+use super::METRIC_NAME_LABEL;
+
+/// How far back an instant vector selector looks for the latest sample.
+pub const LOOKBACK_DELTA_MS: i64 = 5 * 60 * 1000;
+
+/// Max number of steps of a range query, the same as Prometheus.
+pub const MAX_POINTS_PER_SERIES: i64 = 11_000;
@@ -0,0 +1,759 @@
+//! A recursive descent parser of PromQL.
+
+use super::ast::{
+    AggregateOp, BinaryOp, Expr, Grouping, MatchOp, Matcher, ValueType, VectorMatching,
+    VectorSelector,
+};
+use super::functions::get_function;
+use super::METRIC_NAME_LABEL;
+
+#[derive(Debug, Clone, PartialEq)]
+enum Token {
+    Ident(String),
+    Number(f64),
+    Duration(i64),
+    Str(String),
+    LeftParen,
+    RightParen,
+    LeftBrace,
+    RightBrace,
+    LeftBracket,
+    RightBracket,
+    Comma,
+    Colon,
+    Assign,
+    Op(BinaryOp),
+    NotEqRegex,
+    EqRegex,
+    Eof,
+}
+
+struct Lexer<'a> {
+    input: &'a str,
+    pos: usize,
+}
+
+impl<'a> Lexer<'a> {
+    fn peek_char(&self) -> Option<char> {
+        self.input[self.pos..].chars().next()
+    }
+
+    fn peek_char_at(&self, n: usize) -> Option<char> {
+        self.input[self.pos..].chars().nth(n)
+    }
+
+    fn bump(&mut self) -> Option<char> {
+        let c = self.peek_char()?;
+        self.pos += c.len_utf8();
+        Some(c)
+    }
+
+    fn take_while(&mut self, f: impl Fn(char) -> bool) -> &'a str {
+        let start = self.pos;
+        while self.peek_char().map_or(false, &f) {
+            self.bump();
+        }
+        &self.input[start..self.pos]
+    }
+
+    fn next_token(&mut self) -> Result<Token, String> {
+        loop {
+            self.take_while(char::is_whitespace);
+            // comments
+            if self.peek_char() == Some('#') {
+                self.take_while(|c| c != '\n');
+                continue;
+            }
+            break;
+        }
+
+        let c = match self.peek_char() {
+            Some(c) => c,
+            None => return Ok(Token::Eof),
+        };
+        if c.is_ascii_alphabetic() || c == '_' || c == ':' {
+            let ident = self.take_while(|c| c.is_ascii_alphanumeric() || c == '_' || c == ':');
+            return Ok(Token::Ident(ident.to_string()));
+        }
+        if c.is_ascii_digit()
+            || (c == '.' && self.peek_char_at(1).map_or(false, |c| c.is_ascii_digit()))
+        {
+            return self.number_or_duration();
+        }
+        if c == '"' || c == '\'' || c == '`' {
+            return self.string(c);
+        }
+
+        self.bump();
+        let next = self.peek_char();
+        let token = match (c, next) {
+            ('(', _) => Token::LeftParen,
+            (')', _) => Token::RightParen,
+            ('{', _) => Token::LeftBrace,
+            ('}', _) => Token::RightBrace,
+            ('[', _) => Token::LeftBracket,
+            (']', _) => Token::RightBracket,
+            (',', _) => Token::Comma,
+            ('+', _) => Token::Op(BinaryOp::Add),
+            ('-', _) => Token::Op(BinaryOp::Sub),
+            ('*', _) => Token::Op(BinaryOp::Mul),
+            ('/', _) => Token::Op(BinaryOp::Div),
+            ('%', _) => Token::Op(BinaryOp::Mod),
+            ('^', _) => Token::Op(BinaryOp::Pow),
+            ('=', Some('=')) => {
+                self.bump();
+                Token::Op(BinaryOp::Eq)
+            }
+            ('=', Some('~')) => {
+                self.bump();
+                Token::EqRegex
+            }
+            ('=', _) => Token::Assign,
+            ('!', Some('=')) => {
+                self.bump();
+                Token::Op(BinaryOp::Neq)
+            }
+            ('!', Some('~')) => {
+                self.bump();
+                Token::NotEqRegex
+            }
+            ('>', Some('=')) => {
+                self.bump();
+                Token::Op(BinaryOp::Gte)
+            }
+            ('>', _) => Token::Op(BinaryOp::Gt),
+            ('<', Some('=')) => {
+                self.bump();
+                Token::Op(BinaryOp::Lte)
+            }
+            ('<', _) => Token::Op(BinaryOp::Lt),
+            (':', _) => Token::Colon,
+            _ => return Err(format!("unexpected character '{}'", c)),
+        };
+        Ok(token)
+    }
+
+    fn number_or_duration(&mut self) -> Result<Token, String> {
+        let start = self.pos;
+        let digits = self.take_while(|c| c.is_ascii_digit());
+        if !digits.is_empty()
+            && self.peek_char().map_or(false, |c| {
+                DURATION_UNITS.iter().any(|(u, _)| u.starts_with(c))
+            })
+        {
+            // e.g. `5m`, `1h30m`
+            self.take_while(|c| c.is_ascii_alphanumeric());
+            let text = &self.input[start..self.pos];
+            return parse_duration(text)
+                .map(Token::Duration)
+                .ok_or_else(|| format!("invalid duration '{}'", text));
+        }
+
+        self.take_while(|c| c.is_ascii_digit() || c == '.');
+        if matches!(self.peek_char(), Some('e' | 'E')) {
+            self.bump();
+            if matches!(self.peek_char(), Some('+' | '-')) {
+                self.bump();
+            }
+            self.take_while(|c| c.is_ascii_digit());
+        }
+        let text = &self.input[start..self.pos];
+        text.parse::<f64>()
+            .map(Token::Number)
+            .map_err(|_| format!("invalid number '{}'", text))
+    }
+
+    fn string(&mut self, quote: char) -> Result<Token, String> {
+        self.bump();
+        let mut s = String::new();
+        loop {
+            match self.bump() {
+                None => return Err("unterminated string".to_string()),
+                Some(c) if c == quote => return Ok(Token::Str(s)),
+                // raw strings have no escapes
+                Some('\\') if quote != '`' => match self.bump() {
+                    Some('n') => s.push('\n'),
+                    Some('t') => s.push('\t'),
+                    Some('r') => s.push('\r'),
+                    Some(c) => s.push(c),
+                    None => return Err("unterminated string".to_string()),
+                },
+                Some(c) => s.push(c),
+            }
+        }
+    }
+}
+
+const DURATION_UNITS: &[(&str, i64)] = &[
+    ("ms", 1),
+    ("s", 1000),
+    ("m", 60 * 1000),
+    ("h", 60 * 60 * 1000),
+    ("d", 24 * 60 * 60 * 1000),
+    ("w", 7 * 24 * 60 * 60 * 1000),
+    ("y", 365 * 24 * 60 * 60 * 1000),
+];
+
+/// Parse a duration of PromQL to milliseconds, e.g. `5m`, `1h30m`, `500ms`.
+pub fn parse_duration(s: &str) -> Option<i64> {
+    if s.is_empty() {
+        return None;
+    }
+    let mut rest = s;
+    let mut total = 0_i64;
+    while !rest.is_empty() {
+        let digits = rest
+            .find(|c: char| !c.is_ascii_digit())
+            .unwrap_or(rest.len());
+        if digits == 0 {
+            return None;
+        }
+        let value = rest[..digits].parse::<i64>().ok()?;
+        rest = &rest[digits..];
+        let unit_len = rest
+            .find(|c: char| c.is_ascii_digit())
+            .unwrap_or(rest.len());
+        let (_, unit_ms) = DURATION_UNITS
+            .iter()
+            .find(|(u, _)| *u == &rest[..unit_len])?;
+        total = total.checked_add(value.checked_mul(*unit_ms)?)?;
+        rest = &rest[unit_len..];
+    }
+    Some(total)
+}
+
+struct Parser<'a> {
+    lexer: Lexer<'a>,
+    token: Token,
+    next_selector_id: usize,
+}
+
+/// Parse the PromQL expression.
+pub fn parse(input: &str) -> Result<Expr, String> {
+    let mut parser = Parser {
+        lexer: Lexer { input, pos: 0 },
+        token: Token::Eof,
+        next_selector_id: 0,
+    };
+    parser.advance()?;
+    let expr = parser.parse_expr(0)?;
+    if parser.token != Token::Eof {
+        return Err(format!("unexpected {:?}", parser.token));
+    }
+    Ok(expr)
+}
+
+impl<'a> Parser<'a> {
+    fn advance(&mut self) -> Result<Token, String> {
+        let next = self.lexer.next_token()?;
+        Ok(std::mem::replace(&mut self.token, next))
+    }
+
+    fn expect(&mut self, token: Token) -> Result<(), String> {
+        if self.token != token {
+            return Err(format!("expected {:?}, found {:?}", token, self.token));
+        }
+        self.advance()?;
+        Ok(())
+    }
+
+    fn is_ident(&self, ident: &str) -> bool {
+        matches!(&self.token, Token::Ident(s) if s == ident)
+    }
+
+    fn eat_ident(&mut self, ident: &str) -> Result<bool, String> {
+        if self.is_ident(ident) {
+            self.advance()?;
+            return Ok(true);
+        }
+        Ok(false)
+    }
+
+    fn binary_op(&self) -> Option<BinaryOp> {
+        match &self.token {
+            Token::Op(op) => Some(*op),
+            Token::Ident(s) => match s.as_str() {
+                "and" => Some(BinaryOp::And),
+                "or" => Some(BinaryOp::Or),
+                "unless" => Some(BinaryOp::Unless),
+                _ => None,
+            },
+            _ => None,
+        }
+    }
+
+    fn parse_expr(&mut self, min_precedence: u8) -> Result<Expr, String> {
+        let mut lhs = self.parse_unary()?;
+        while let Some(op) = self.binary_op() {
+            let precedence = op.precedence();
+            if precedence < min_precedence {
+                break;
+            }
+            self.advance()?;
+            let return_bool = self.eat_ident("bool")?;
+            let matching = self.parse_vector_matching()?;
+            // `^` is right associative
+            let next_precedence = if op == BinaryOp::Pow {
+                precedence
+            } else {
+                precedence + 1
+            };
+            let rhs = self.parse_expr(next_precedence)?;
+            lhs = binary_expr(op, lhs, rhs, return_bool, matching)?;
+        }
+        Ok(lhs)
+    }
+
+    fn parse_unary(&mut self) -> Result<Expr, String> {
+        match self.token {
+            Token::Op(BinaryOp::Sub) => {
+                self.advance()?;
+                // binds tighter than the binary operators but `^`
+                match self.parse_expr(BinaryOp::Pow.precedence())? {
+                    Expr::Number(n) => Ok(Expr::Number(-n)),
+                    expr if expr.value_type() == ValueType::Matrix => {
+                        Err("unary expression only allowed on scalars or vectors".to_string())
+                    }
+                    expr => Ok(Expr::Neg(Box::new(expr))),
+                }
+            }
+            Token::Op(BinaryOp::Add) => {
+                self.advance()?;
+                self.parse_expr(BinaryOp::Pow.precedence())
+            }
+            _ => {
+                let expr = self.parse_primary()?;
+                self.parse_postfix(expr)
+            }
+        }
+    }
+
+    fn parse_primary(&mut self) -> Result<Expr, String> {
+        match self.advance()? {
+            Token::Number(n) => Ok(Expr::Number(n)),
+            Token::Duration(_) => Err("unexpected duration".to_string()),
+            Token::Str(_) => Err("string literals are not supported".to_string()),
+            Token::LeftParen => {
+                let expr = self.parse_expr(0)?;
+                self.expect(Token::RightParen)?;
+                Ok(expr)
+            }
+            Token::LeftBrace => {
+                let matchers = self.parse_matchers()?;
+                self.vector_selector(matchers)
+            }
+            Token::Ident(ident) => {
+                if let Some(op) = AggregateOp::from_name(&ident) {
+                    if matches!(self.token, Token::LeftParen)
+                        || self.is_ident("by")
+                        || self.is_ident("without")
+                    {
+                        return self.parse_aggregate(op);
+                    }
+                }
+                if self.token == Token::LeftParen {
+                    return self.parse_call(&ident);
+                }
+                match ident.to_ascii_lowercase().as_str() {
+                    "inf" => return Ok(Expr::Number(f64::INFINITY)),
+                    "nan" => return Ok(Expr::Number(f64::NAN)),
+                    _ => {}
+                }
+
+                let mut matchers = vec![Matcher::new(METRIC_NAME_LABEL, MatchOp::Eq, ident)];
+                if self.token == Token::LeftBrace {
+                    self.advance()?;
+                    for m in self.parse_matchers()? {
+                        if m.name == METRIC_NAME_LABEL {
+                            return Err("metric name must not be set twice".to_string());
+                        }
+                        matchers.push(m);
+                    }
+                }
+                self.vector_selector(matchers)
+            }
+            token => Err(format!("unexpected {:?}", token)),
+        }
+    }
+
+    fn vector_selector(&mut self, matchers: Vec<Matcher>) -> Result<Expr, String> {
+        if matchers.is_empty() {
+            return Err("vector selector must contain at least one matcher".to_string());
+        }
+        let id = self.next_selector_id;
+        self.next_selector_id += 1;
+        Ok(Expr::Vector(VectorSelector {
+            id,
+            matchers,
+            offset_ms: 0,
+        }))
+    }
+
+    /// Parse the matchers after `{`.
+    fn parse_matchers(&mut self) -> Result<Vec<Matcher>, String> {
+        let mut matchers = vec![];
+        loop {
+            let name = match self.advance()? {
+                Token::RightBrace => return Ok(matchers),
+                Token::Ident(name) => name,
+                token => return Err(format!("unexpected {:?} in label matching", token)),
+            };
+            let op = match self.advance()? {
+                Token::Assign => MatchOp::Eq,
+                Token::Op(BinaryOp::Neq) => MatchOp::Neq,
+                Token::EqRegex => MatchOp::Re,
+                Token::NotEqRegex => MatchOp::Nre,
+                token => return Err(format!("unexpected {:?} in label matching", token)),
+            };
+            let value = match self.advance()? {
+                Token::Str(value) => value,
+                token => return Err(format!("unexpected {:?} in label matching", token)),
+            };
+            if matches!(op, MatchOp::Re | MatchOp::Nre) {
+                regex::Regex::new(&value).map_err(|e| format!("invalid regex: {}", e))?;
+            }
+            matchers.push(Matcher::new(name, op, value));
+
+            match self.advance()? {
+                Token::Comma => continue,
+                Token::RightBrace => return Ok(matchers),
+                token => return Err(format!("unexpected {:?} in label matching", token)),
+            }
+        }
+    }
+
+    fn parse_postfix(&mut self, mut expr: Expr) -> Result<Expr, String> {
+        if self.token == Token::LeftBracket {
+            self.advance()?;
+            let range_ms = match self.advance()? {
+                Token::Duration(d) if d > 0 => d,
+                token => return Err(format!("expected a positive duration, found {:?}", token)),
+            };
+            if self.token == Token::Colon {
+                return Err("subqueries are not supported".to_string());
+            }
+            self.expect(Token::RightBracket)?;
+            expr = match expr {
+                Expr::Vector(selector) if selector.offset_ms == 0 => {
+                    Expr::Matrix { selector, range_ms }
+                }
+                _ => return Err("ranges only allowed for vector selectors".to_string()),
+            };
+        }
+
+        if self.eat_ident("offset")? {
+            let negative = matches!(self.token, Token::Op(BinaryOp::Sub));
+            if negative {
+                self.advance()?;
+            }
+            let offset_ms = match self.advance()? {
+                Token::Duration(d) if negative => -d,
+                Token::Duration(d) => d,
+                token => return Err(format!("expected a duration, found {:?}", token)),
+            };
+            match &mut expr {
+                Expr::Vector(selector) | Expr::Matrix { selector, .. }
+                    if selector.offset_ms == 0 =>
+                {
+                    selector.offset_ms = offset_ms
+                }
+                _ => return Err("offset modifier must be preceded by a selector".to_string()),
+            }
+        }
+        Ok(expr)
+    }
+
+    fn parse_label_list(&mut self) -> Result<Vec<String>, String> {
+        self.expect(Token::LeftParen)?;
+        let mut labels = vec![];
+        loop {
+            match self.advance()? {
+                Token::RightParen => return Ok(labels),
+                Token::Ident(label) => labels.push(label),
+                token => return Err(format!("unexpected {:?} in grouping", token)),
+            }
+            match self.advance()? {
+                Token::Comma => continue,
+                Token::RightParen => return Ok(labels),
+                token => return Err(format!("unexpected {:?} in grouping", token)),
+            }
+        }
+    }
+
+    fn parse_grouping(&mut self) -> Result<Option<Grouping>, String> {
+        if self.eat_ident("by")? {
+            return Ok(Some(Grouping::By(self.parse_label_list()?)));
+        }
+        if self.eat_ident("without")? {
+            return Ok(Some(Grouping::Without(self.parse_label_list()?)));
+        }
+        Ok(None)
+    }
+
+    fn parse_vector_matching(&mut self) -> Result<Option<VectorMatching>, String> {
+        let matching = if self.eat_ident("on")? {
+            Some(VectorMatching::On(self.parse_label_list()?))
+        } else if self.eat_ident("ignoring")? {
+            Some(VectorMatching::Ignoring(self.parse_label_list()?))
+        } else {
+            None
+        };
+        if self.is_ident("group_left") || self.is_ident("group_right") {
+            return Err("group_left and group_right are not supported".to_string());
+        }
+        Ok(matching)
+    }
+
+    fn parse_args(&mut self) -> Result<Vec<Expr>, String> {
+        self.expect(Token::LeftParen)?;
+        let mut args = vec![];
+        if self.token == Token::RightParen {
+            self.advance()?;
+            return Ok(args);
+        }
+        loop {
+            args.push(self.parse_expr(0)?);
+            match self.advance()? {
+                Token::Comma => continue,
+                Token::RightParen => return Ok(args),
+                token => return Err(format!("unexpected {:?} in arguments", token)),
+            }
+        }
+    }
+
+    fn parse_aggregate(&mut self, op: AggregateOp) -> Result<Expr, String> {
+        let before = self.parse_grouping()?;
+        let mut args = self.parse_args()?;
+        let after = self.parse_grouping()?;
+        if before.is_some() && after.is_some() {
+            return Err("grouping must not be set twice".to_string());
+        }
+        let grouping = before.or(after).unwrap_or(Grouping::By(vec![]));
+
+        let expected = if op.has_param() { 2 } else { 1 };
+        if args.len() != expected {
+            return Err(format!(
+                "wrong number of arguments for aggregate expression provided, expected {}, got {}",
+                expected,
+                args.len()
+            ));
+        }
+        let expr = args.pop().expect("checked");
+        if expr.value_type() != ValueType::Vector {
+            return Err("aggregation expression must be an instant vector".to_string());
+        }
+        let param = args.pop();
+        if let Some(param) = &param {
+            if param.value_type() != ValueType::Scalar {
+                return Err("aggregation parameter must be a scalar".to_string());
+            }
+        }
+        Ok(Expr::Aggregate {
+            op,
+            param: param.map(Box::new),
+            grouping,
+            expr: Box::new(expr),
+        })
+    }
+
+    fn parse_call(&mut self, name: &str) -> Result<Expr, String> {
+        let function = get_function(name).ok_or_else(|| format!("unknown function '{}'", name))?;
+        let args = self.parse_args()?;
+        if args.len() != function.arg_types.len() {
+            return Err(format!(
+                "expected {} argument(s) in call to '{}', got {}",
+                function.arg_types.len(),
+                name,
+                args.len()
+            ));
+        }
+        for (arg, expected) in args.iter().zip(function.arg_types) {
+            if arg.value_type() != *expected {
+                return Err(format!(
+                    "expected type {:?} in call to '{}', got {:?}",
+                    expected,
+                    name,
+                    arg.value_type()
+                ));
+            }
+        }
+        Ok(Expr::Call {
+            func: function.name,
+            args,
+        })
+    }
+}
+
+fn binary_expr(
+    op: BinaryOp,
+    lhs: Expr,
+    rhs: Expr,
+    return_bool: bool,
+    matching: Option<VectorMatching>,
+) -> Result<Expr, String> {
+    let (lhs_type, rhs_type) = (lhs.value_type(), rhs.value_type());
+    if lhs_type == ValueType::Matrix || rhs_type == ValueType::Matrix {
+        return Err("binary expression must contain only scalar and instant vector types".into());
+    }
+    let both_vectors = lhs_type == ValueType::Vector && rhs_type == ValueType::Vector;
+    if return_bool && !op.is_comparison() {
+        return Err("bool modifier can only be used on comparison operators".to_string());
+    }
+    if op.is_comparison()
+        && !return_bool
+        && lhs_type == ValueType::Scalar
+        && rhs_type == ValueType::Scalar
+    {
+        return Err("comparisons between scalars must use bool modifier".to_string());
+    }
+    if op.is_set() && !both_vectors {
+        return Err(format!(
+            "set operator {:?} not allowed in binary scalar expression",
+            op
+        ));
+    }
+    if matching.is_some() && !both_vectors {
+        return Err("vector matching only allowed between instant vectors".to_string());
+    }
+    Ok(Expr::Binary {
+        op,
+        lhs: Box::new(lhs),
+        rhs: Box::new(rhs),
+        return_bool,
+        matching,
+    })
+}
+
+#[cfg(test)]
+mod test {
+    use super::{parse, parse_duration};
+    use crate::prom::promql::ast::{
+        AggregateOp, BinaryOp, Expr, Grouping, MatchOp, Matcher, VectorMatching, VectorSelector,
+    };
+
+    fn selector(id: usize, matchers: Vec<Matcher>, offset_ms: i64) -> VectorSelector {
+        VectorSelector {
+            id,
+            matchers,
+            offset_ms,
+        }
+    }
+
+    fn name(metric: &str) -> Matcher {
+        Matcher::new("__name__", MatchOp::Eq, metric)
+    }
+
+    #[test]
+    fn test_parse_duration() {
+        assert_eq!(parse_duration("5m"), Some(300_000));
+        assert_eq!(parse_duration("1h30m"), Some(5_400_000));
+        assert_eq!(parse_duration("500ms"), Some(500));
+        assert_eq!(parse_duration("1d"), Some(86_400_000));
+        assert_eq!(parse_duration("5"), None);
+        assert_eq!(parse_duration("m"), None);
+        assert_eq!(parse_duration("5x"), None);
+    }
+
+    #[test]
+    fn test_parse_selector() {
+        assert_eq!(
+            parse(r#"http_requests_total{job="api", code=~"5..", method!="GET"}"#).unwrap(),
+            Expr::Vector(selector(
+                0,
+                vec![
+                    name("http_requests_total"),
+                    Matcher::new("job", MatchOp::Eq, "api"),
+                    Matcher::new("code", MatchOp::Re, "5.."),
+                    Matcher::new("method", MatchOp::Neq, "GET"),
+                ],
+                0
+            ))
+        );
+        assert_eq!(
+            parse(r#"{__name__=~"up|down"}[5m] offset 1h"#).unwrap(),
+            Expr::Matrix {
+                selector: selector(
+                    0,
+                    vec![Matcher::new("__name__", MatchOp::Re, "up|down")],
+                    3_600_000
+                ),
+                range_ms: 300_000,
+            }
+        );
+
+        assert!(parse("{}").is_err());
+        assert!(parse(r#"up{job="a""#).is_err());
+        assert!(parse(r#"up{__name__="down"}"#).is_err());
+        assert!(parse("rate(up[5m])[5m]").is_err());
+        assert!(parse("up[5m:1m]").is_err());
+    }
+
+    #[test]
+    fn test_parse_expr() {
+        assert_eq!(
+            parse("sum by (job) (rate(up[1m])) * 2 > bool 1").unwrap(),
+            Expr::Binary {
+                op: BinaryOp::Gt,
+                lhs: Box::new(Expr::Binary {
+                    op: BinaryOp::Mul,
+                    lhs: Box::new(Expr::Aggregate {
+                        op: AggregateOp::Sum,
+                        param: None,
+                        grouping: Grouping::By(vec!["job".to_string()]),
+                        expr: Box::new(Expr::Call {
+                            func: "rate",
+                            args: vec![Expr::Matrix {
+                                selector: selector(0, vec![name("up")], 0),
+                                range_ms: 60_000,
+                            }],
+                        }),
+                    }),
+                    rhs: Box::new(Expr::Number(2.0)),
+                    return_bool: false,
+                    matching: None,
+                }),
+                rhs: Box::new(Expr::Number(1.0)),
+                return_bool: true,
+                matching: None,
+            }
+        );
+        assert_eq!(
+            parse("topk(3, a) without (b)").unwrap(),
+            Expr::Aggregate {
+                op: AggregateOp::Topk,
+                param: Some(Box::new(Expr::Number(3.0))),
+                grouping: Grouping::Without(vec!["b".to_string()]),
+                expr: Box::new(Expr::Vector(selector(0, vec![name("a")], 0))),
+            }
+        );
+        assert_eq!(
+            parse("a / ignoring(code) b").unwrap(),
+            Expr::Binary {
+                op: BinaryOp::Div,
+                lhs: Box::new(Expr::Vector(selector(0, vec![name("a")], 0))),
+                rhs: Box::new(Expr::Vector(selector(1, vec![name("b")], 0))),
+                return_bool: false,
+                matching: Some(VectorMatching::Ignoring(vec!["code".to_string()])),
+            }
+        );
+        // `^` is right associative and binds tighter than unary minus
+        let pow = |lhs, rhs| Expr::Binary {
+            op: BinaryOp::Pow,
+            lhs: Box::new(Expr::Number(lhs)),
+            rhs: Box::new(rhs),
+            return_bool: false,
+            matching: None,
+        };
+        assert_eq!(
+            parse("-2 ^ 3 ^ 2").unwrap(),
+            Expr::Neg(Box::new(pow(2.0, pow(3.0, Expr::Number(2.0)))))
+        );
+
+        assert!(parse("1 > 2").is_err());
+        assert!(parse("1 and 2").is_err());
+        assert!(parse("rate(up)").is_err());
+        assert!(parse("unknown(up)").is_err());
+        assert!(parse("sum(up[5m])").is_err());
+        assert!(parse("a * on(b) group_left c").is_err());
+    }
+}
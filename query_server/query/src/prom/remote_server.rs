@@ -1,11 +1,14 @@
 use std::borrow::Cow;
-use std::collections::HashMap;
+use std::cmp::Ordering;
+use std::collections::{BTreeMap, BTreeSet, HashMap};
 
 use async_trait::async_trait;
 use bytes::Bytes;
 use coordinator::service::CoordinatorRef;
+use datafusion::arrow::array::StringArray;
 use datafusion::arrow::datatypes::ToByteSlice;
 use futures::future::join_all;
+use futures::StreamExt;
 use meta::error::MetaError;
 use meta::model::MetaClientRef;
 use models::schema::tskv_table_schema::TskvTableSchemaRef;
@@ -14,21 +17,27 @@ use models::snappy::SnappyCodec;
 use protocol_parser::Line;
 use protos::models_helper::{parse_prost_bytes, to_prost_bytes};
 use protos::prompb::prometheus::label_matcher::Type;
+use protos::prompb::prometheus::read_request::ResponseType;
 use protos::prompb::prometheus::{
-    Query as PromQuery, QueryResult as PromQueryResult, ReadRequest, ReadResponse, TimeSeries,
-    WriteRequest,
+    Label, LabelMatcher, Query as PromQuery, QueryResult as PromQueryResult, ReadHints,
+    ReadRequest, ReadResponse, TimeSeries, WriteRequest,
 };
 use protos::FieldValue;
 use regex::Regex;
 use snafu::ResultExt;
 use spi::server::dbms::DBMSRef;
-use spi::server::prom::PromRemoteServer;
+use spi::server::prom::{PromQLData, PromQLQuery, PromReadResponse, PromRemoteServer};
 use spi::service::protocol::{Context, Query, QueryHandle};
 use spi::{MetaSnafu, QueryError, QueryResult, SnappySnafu};
+use tokio::sync::mpsc;
 use tokio::task;
 use trace::span_ext::SpanExt;
 use trace::{debug, warn, Span, SpanContext};
 
+use super::chunk::to_chunked_series;
+use super::promql::ast::{Expr, MatchOp, Matcher};
+use super::promql::{Evaluator, Labels, Series, Storage, LOOKBACK_DELTA_MS};
+use super::stream::series_to_frames;
 use super::time_series::writer::WriterBuilder;
 use super::{METRIC_NAME_LABEL, METRIC_SAMPLE_COLUMN_NAME};
 use crate::prom::DEFAULT_PROM_TABLE_NAME;
@@ -46,71 +55,162 @@ impl PromRemoteServer for PromRemoteSqlServer {
         ctx: &Context,
         req: Bytes,
         span_ctx: Option<&SpanContext>,
-    ) -> QueryResult<Vec<u8>> {
-        let meta = self
-            .coord
-            .meta_manager()
-            .tenant_meta(ctx.tenant())
-            .await
-            .ok_or_else(|| MetaError::TenantNotFound {
-                tenant: ctx.tenant().to_string(),
-            })
-            .context(MetaSnafu)?;
+    ) -> QueryResult<PromReadResponse> {
+        let meta = self.tenant_meta(ctx).await?;
 
         let read_request = self.deserialize_read_request(req).await?;
 
         debug!("Received remote read request: {:?}", read_request);
 
         let span = Span::from_context("process read request", span_ctx);
-        let read_response = self
-            .process_read_requests(ctx, meta, read_request, span)
-            .await?;
+        match negotiate_response_type(&read_request.accepted_response_types)? {
+            ResponseType::Samples => {
+                let read_response = self
+                    .process_read_requests(ctx, meta, read_request, span)
+                    .await?;
 
-        debug!("Return remote read response: {:?}", read_response);
+                debug!("Return remote read response: {:?}", read_response);
 
-        self.serialize_read_response(read_response).await
+                let response = self.serialize_read_response(read_response).await?;
+                Ok(PromReadResponse::Samples(response))
+            }
+            ResponseType::StreamedXorChunks => {
+                let frames = self.stream_read_requests(ctx, meta, read_request, span);
+                Ok(PromReadResponse::StreamedXorChunks(frames))
+            }
+        }
     }
 
-    fn remote_write(&self, req: Bytes) -> QueryResult<WriteRequest> {
-        let prom_write_request = self.deserialize_write_request(req)?;
-        Ok(prom_write_request)
+    async fn query(
+        &self,
+        ctx: &Context,
+        query: PromQLQuery,
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<PromQLData> {
+        let expr = super::promql::parse(&query.query)
+            .map_err(|reason| QueryError::InvalidPromQL { reason })?;
+        let meta = self.tenant_meta(ctx).await?;
+
+        debug!("Received promql query: {:?}", query);
+
+        let span = Span::from_context("process promql query", span_ctx);
+        let storage = self
+            .read_selectors(ctx, meta, &expr, query.start, query.end, span)
+            .await?;
+        let evaluator = Evaluator::new(&storage);
+        let result = if query.is_instant() {
+            evaluator.instant_query(&expr, query.start)
+        } else {
+            evaluator.range_query(&expr, query.start, query.end, query.step)
+        };
+        result.map_err(|reason| QueryError::PromQLEvaluation { reason })
     }
 
-    fn prom_write_request_to_lines<'a>(&self, req: &'a WriteRequest) -> QueryResult<Vec<Line<'a>>> {
-        let mut lines = Vec::with_capacity(req.timeseries.len());
+    async fn label_names(
+        &self,
+        ctx: &Context,
+        selectors: &[String],
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<Vec<String>> {
+        let meta = self.tenant_meta(ctx).await?;
+        let span = Span::from_context("process prom label names", span_ctx);
 
-        for ts in req.timeseries.iter() {
-            let mut table_name = DEFAULT_PROM_TABLE_NAME;
-            let tags = ts
-                .labels
-                .iter()
-                .map(|label| {
-                    if label.name.eq(METRIC_NAME_LABEL) {
-                        table_name = label.value.as_ref()
-                    }
-                    (
-                        Cow::Borrowed(label.name.as_ref()),
-                        Cow::Borrowed(label.value.as_ref()),
-                    )
-                })
-                .collect::<Vec<(_, _)>>();
-
-            for sample in ts.samples.iter() {
-                let fields = vec![(
-                    Cow::Borrowed(METRIC_SAMPLE_COLUMN_NAME),
-                    FieldValue::F64(sample.value),
-                )];
-                let timestamp = sample.timestamp * 1000000;
-                lines.push(Line::new(
-                    Cow::Borrowed(table_name),
-                    tags.clone(),
-                    fields,
-                    timestamp,
-                ));
+        if selectors.is_empty() {
+            // the tags of all the tables, no series is looked up
+            let mut names = BTreeSet::from([METRIC_NAME_LABEL.to_string()]);
+            for table in table_schemas(ctx, &meta, |_| true)? {
+                names.extend(
+                    table
+                        .columns()
+                        .iter()
+                        .filter(|c| c.column_type.is_tag())
+                        .map(|c| c.name.clone()),
+                );
+            }
+            return Ok(names.into_iter().collect());
+        }
+
+        let names = self
+            .series_of_selectors(ctx, &meta, selectors, &span)
+            .await?
+            .into_iter()
+            .flat_map(|labels| labels.into_keys())
+            .collect::<BTreeSet<_>>();
+        Ok(names.into_iter().collect())
+    }
+
+    async fn label_values(
+        &self,
+        ctx: &Context,
+        name: &str,
+        selectors: &[String],
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<Vec<String>> {
+        let meta = self.tenant_meta(ctx).await?;
+        let span = Span::from_context("process prom label values", span_ctx);
+        let tables = metadata_tables(ctx, &meta, selectors)?;
+
+        let mut values = BTreeSet::new();
+        if name == METRIC_NAME_LABEL {
+            // the tables with any series matched
+            let tasks = tables.iter().map(|(table, filters)| async {
+                if filters.is_empty() {
+                    return Ok(true);
+                }
+                let series = self
+                    .show_series(ctx, table, filters, Some(1), &span)
+                    .await?;
+                QueryResult::Ok(!series.is_empty())
+            });
+            for ((table, _), matched) in tables.iter().zip(join_all(tasks).await) {
+                if matched? {
+                    values.insert(table.name.to_string());
+                }
             }
+            return Ok(values.into_iter().collect());
+        }
+
+        let tasks = tables
+            .iter()
+            .filter(|(table, _)| table.column(name).map_or(false, |c| c.column_type.is_tag()))
+            .map(|(table, filters)| {
+                let sql = format!(
+                    "SHOW TAG VALUES FROM \"{}\" WITH KEY = \"{}\"{}",
+                    table.name,
+                    name,
+                    where_clause(filters)
+                );
+                // the columns are the key and the value
+                self.query_strings(ctx, sql, 1, &span)
+            });
+        for result in join_all(tasks).await {
+            values.extend(result?.into_iter().filter(|v| !v.is_empty()));
         }
+        Ok(values.into_iter().collect())
+    }
 
-        Ok(lines)
+    async fn series(
+        &self,
+        ctx: &Context,
+        selectors: &[String],
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<Vec<BTreeMap<String, String>>> {
+        let meta = self.tenant_meta(ctx).await?;
+        let span = Span::from_context("process prom series", span_ctx);
+        self.series_of_selectors(ctx, &meta, selectors, &span).await
+    }
+
+    fn remote_write(&self, req: Bytes) -> QueryResult<WriteRequest> {
+        let prom_write_request = self.deserialize_write_request(req)?;
+        Ok(prom_write_request)
+    }
+
+    fn prom_write_request_to_lines<'a>(
+        &self,
+        req: &'a WriteRequest,
+        field_label: Option<&str>,
+    ) -> QueryResult<Vec<Line<'a>>> {
+        Ok(write_request_to_lines(req, field_label))
     }
 }
 
@@ -123,6 +223,17 @@ impl PromRemoteSqlServer {
         }
     }
 
+    async fn tenant_meta(&self, ctx: &Context) -> QueryResult<MetaClientRef> {
+        self.coord
+            .meta_manager()
+            .tenant_meta(ctx.tenant())
+            .await
+            .ok_or_else(|| MetaError::TenantNotFound {
+                tenant: ctx.tenant().to_string(),
+            })
+            .context(MetaSnafu)
+    }
+
     async fn deserialize_read_request(&self, req: Bytes) -> QueryResult<ReadRequest> {
         let mut decompressed = Vec::new();
         let compressed = req.to_byte_slice();
@@ -189,6 +300,60 @@ impl PromRemoteSqlServer {
         Ok(ReadResponse { results })
     }
 
+    /// Process the queries one by one, the series of a query are sorted by
+    /// labels and sent as frames, so only the series of a query are kept in
+    /// memory.
+    fn stream_read_requests(
+        &self,
+        ctx: &Context,
+        meta: MetaClientRef,
+        read_request: ReadRequest,
+        span: Span,
+    ) -> futures::stream::BoxStream<'static, QueryResult<Vec<u8>>> {
+        let (sender, receiver) = mpsc::channel(16);
+        let db = self.db.clone();
+        let ctx = ctx.clone();
+        task::spawn(async move {
+            for (idx, q) in read_request.queries.into_iter().enumerate() {
+                let span = Span::enter_with_parent(format!("process_read_request:{}", idx), &span);
+                let timeseries = match Self::process_read_request(
+                    q,
+                    db.clone(),
+                    ctx.clone(),
+                    meta.clone(),
+                    span,
+                )
+                .await
+                {
+                    Ok(timeseries) => timeseries,
+                    Err(e) => {
+                        let _ = sender.send(Err(e)).await;
+                        return;
+                    }
+                };
+
+                let mut series = timeseries
+                    .into_iter()
+                    .map(to_chunked_series)
+                    .collect::<Vec<_>>();
+                series.sort_by(|a, b| compare_labels(&a.labels, &b.labels));
+                for s in series {
+                    for frame in series_to_frames(s, idx as i64) {
+                        if sender.send(Ok(frame)).await.is_err() {
+                            // the client is gone
+                            return;
+                        }
+                    }
+                }
+            }
+        });
+
+        futures::stream::unfold(receiver, |mut receiver| async move {
+            receiver.recv().await.map(|frame| (frame, receiver))
+        })
+        .boxed()
+    }
+
     async fn process_read_request(
         q: protos::prompb::prometheus::Query,
         db: DBMSRef,
@@ -227,6 +392,158 @@ impl PromRemoteSqlServer {
         Ok(timeseries)
     }
 
+    /// Read the series of the selectors of the expression evaluated in
+    /// `[start, end]`, including the samples before `start` in the range or
+    /// the lookback of the selectors.
+    async fn read_selectors(
+        &self,
+        ctx: &Context,
+        meta: MetaClientRef,
+        expr: &Expr,
+        start: i64,
+        end: i64,
+        span: Span,
+    ) -> QueryResult<Storage> {
+        let selectors = expr.selectors();
+        let mut tasks = Vec::with_capacity(selectors.len());
+        for (selector, range_ms) in selectors {
+            let q = PromQuery {
+                start_timestamp_ms: start - selector.offset_ms - range_ms,
+                end_timestamp_ms: end - selector.offset_ms,
+                matchers: selector.matchers.iter().map(to_label_matcher).collect(),
+                hints: None,
+            };
+            let id = selector.id;
+            let db = self.db.clone();
+            let ctx = ctx.clone();
+            let meta = meta.clone();
+            let span = Span::enter_with_parent(format!("read_selector:{}", id), &span);
+            let task = task::spawn(async move {
+                Self::read_series(q, db, ctx, meta, span)
+                    .await
+                    .map(|series| (id, series))
+            });
+            tasks.push(task);
+        }
+
+        let mut storage = Storage::with_capacity(tasks.len());
+        for result in join_all(tasks).await {
+            match result {
+                Ok(Ok((id, series))) => {
+                    storage.insert(id, series);
+                }
+                Ok(Err(e)) => return Err(e),
+                Err(e) => {
+                    return Err(QueryError::Internal {
+                        reason: e.to_string(),
+                    })
+                }
+            }
+        }
+        Ok(storage)
+    }
+
+    async fn read_series(
+        q: PromQuery,
+        db: DBMSRef,
+        ctx: Context,
+        meta: MetaClientRef,
+        span: Span,
+    ) -> QueryResult<Vec<Series>> {
+        let sqls = build_sql_with_table(&ctx, &meta, q)?;
+        debug!("Prepare to execute: {:?}", sqls);
+
+        let mut series = vec![];
+        for (idx, sql) in sqls.into_iter().enumerate() {
+            let table = sql.table.name.to_string();
+            let span = Span::enter_with_parent(format!("process_single_sql:{}", idx), &span);
+            let timeseries = Self::process_single_sql(db.clone(), ctx.clone(), sql, span).await?;
+            series.extend(
+                timeseries
+                    .into_iter()
+                    .map(|ts| to_promql_series(ts, &table)),
+            );
+        }
+        Ok(series)
+    }
+
+    /// The labels of the series of the selectors, looked up in the index of
+    /// the tags by `SHOW SERIES`.
+    async fn series_of_selectors(
+        &self,
+        ctx: &Context,
+        meta: &MetaClientRef,
+        selectors: &[String],
+        span: &Span,
+    ) -> QueryResult<Vec<Labels>> {
+        let tables = metadata_tables(ctx, meta, selectors)?;
+        let tasks = tables
+            .iter()
+            .map(|(table, filters)| self.show_series(ctx, table, filters, None, span));
+
+        let mut series = BTreeSet::new();
+        for result in join_all(tasks).await {
+            series.extend(result?);
+        }
+        Ok(series.into_iter().collect())
+    }
+
+    async fn show_series(
+        &self,
+        ctx: &Context,
+        table: &TskvTableSchemaRef,
+        filters: &[String],
+        limit: Option<usize>,
+        span: &Span,
+    ) -> QueryResult<Vec<Labels>> {
+        let mut sql = format!(
+            "SHOW SERIES FROM \"{}\"{}",
+            table.name,
+            where_clause(filters)
+        );
+        if let Some(limit) = limit {
+            sql.push_str(&format!(" LIMIT {}", limit));
+        }
+        let keys = self.query_strings(ctx, sql, 0, span).await?;
+        Ok(keys
+            .iter()
+            .map(|key| parse_series_key(key, table))
+            .collect())
+    }
+
+    /// Execute the sql and collect the strings of a column of the result.
+    async fn query_strings(
+        &self,
+        ctx: &Context,
+        sql: String,
+        column: usize,
+        span: &Span,
+    ) -> QueryResult<Vec<String>> {
+        debug!("Prepare to execute: {:?}", sql);
+        let span = Span::enter_with_parent("query_strings", span);
+        let query = Query::new(ctx.clone(), sql);
+        let batches = self
+            .db
+            .execute(&query, span.context().as_ref())
+            .await?
+            .result()
+            .chunk_result()
+            .await?;
+
+        let mut strings = vec![];
+        for batch in batches {
+            let array = batch
+                .column(column)
+                .as_any()
+                .downcast_ref::<StringArray>()
+                .ok_or_else(|| QueryError::Internal {
+                    reason: format!("column {} of the metadata is not a string", column),
+                })?;
+            strings.extend(array.iter().flatten().map(|s| s.to_string()));
+        }
+        Ok(strings)
+    }
+
     async fn process_single_sql(
         db: DBMSRef,
         ctx: Context,
@@ -247,6 +564,13 @@ impl PromRemoteSqlServer {
                 column: TIME_FIELD_NAME.to_string(),
             }
         })?;
+        let (tag_name_indices, sample_value_idx, sample_time_idx) = if sql.downsampled {
+            // the time, the tags and the value, see `downsample_sql`
+            let num_tags = tag_name_indices.len();
+            ((1..=num_tags).collect(), num_tags + 1, 0)
+        } else {
+            (tag_name_indices, sample_value_idx, sample_time_idx)
+        };
 
         let inner_query = Query::new(ctx.clone(), sql.sql);
         let result = db.execute(&inner_query, span.context().as_ref()).await?;
@@ -266,6 +590,217 @@ impl PromRemoteSqlServer {
     }
 }
 
+/// The series are written to the table of the `__name__` label, and the
+/// samples to the field named by the value of `field_label`, the label is
+/// not stored as a tag.
+fn write_request_to_lines<'a>(req: &'a WriteRequest, field_label: Option<&str>) -> Vec<Line<'a>> {
+    let mut lines = Vec::with_capacity(req.timeseries.len());
+
+    for ts in req.timeseries.iter() {
+        let mut table_name = DEFAULT_PROM_TABLE_NAME;
+        let mut field_name = METRIC_SAMPLE_COLUMN_NAME;
+        let tags = ts
+            .labels
+            .iter()
+            .filter_map(|label| {
+                if label.name.eq(METRIC_NAME_LABEL) {
+                    table_name = label.value.as_ref()
+                }
+                if field_label == Some(label.name.as_str()) {
+                    if !label.value.is_empty() {
+                        field_name = label.value.as_ref();
+                    }
+                    return None;
+                }
+                Some((
+                    Cow::Borrowed(label.name.as_ref()),
+                    Cow::Borrowed(label.value.as_ref()),
+                ))
+            })
+            .collect::<Vec<(_, _)>>();
+
+        for sample in ts.samples.iter() {
+            // A staleness marker is written as it is, the NaN of its bits
+            // is kept by the storage, and ends the series in the queries.
+            let fields = vec![(Cow::Borrowed(field_name), FieldValue::F64(sample.value))];
+            let timestamp = sample.timestamp * 1000000;
+            lines.push(Line::new(
+                Cow::Borrowed(table_name),
+                tags.clone(),
+                fields,
+                timestamp,
+            ));
+        }
+    }
+
+    lines
+}
+
+/// The first response type accepted and implemented, `SAMPLES` if the
+/// request accepts any type.
+fn negotiate_response_type(accepted: &[i32]) -> QueryResult<ResponseType> {
+    if accepted.is_empty() {
+        return Ok(ResponseType::Samples);
+    }
+    accepted
+        .iter()
+        .find_map(|t| ResponseType::from_i32(*t))
+        .ok_or_else(|| QueryError::InvalidRemoteReadReq {
+            source: format!("none of the response types {:?} is implemented", accepted).into(),
+        })
+}
+
+/// The matcher of the remote read, the regular expressions of PromQL are
+/// fully anchored.
+fn to_label_matcher(m: &Matcher) -> LabelMatcher {
+    let (r#type, value) = match m.op {
+        MatchOp::Eq => (Type::Eq, m.value.clone()),
+        MatchOp::Neq => (Type::Neq, m.value.clone()),
+        MatchOp::Re => (Type::Re, format!("^(?:{})$", m.value)),
+        MatchOp::Nre => (Type::Nre, format!("^(?:{})$", m.value)),
+    };
+    LabelMatcher {
+        r#type: r#type as i32,
+        name: m.name.clone(),
+        value,
+    }
+}
+
+/// The series of PromQL, the empty labels are dropped and the metric name
+/// is the table if the series has no `__name__` label.
+fn to_promql_series(ts: TimeSeries, table: &str) -> Series {
+    let mut labels = ts
+        .labels
+        .into_iter()
+        .filter(|l| !l.value.is_empty())
+        .map(|l| (l.name, l.value))
+        .collect::<Labels>();
+    labels
+        .entry(METRIC_NAME_LABEL.to_string())
+        .or_insert_with(|| table.to_string());
+    let mut samples = ts
+        .samples
+        .into_iter()
+        .map(|s| (s.timestamp, s.value))
+        .collect::<Vec<_>>();
+    samples.sort_by_key(|(t, _)| *t);
+    Series { labels, samples }
+}
+
+/// Compare the labels sorted by name, as the labels of Prometheus.
+fn compare_labels(a: &[Label], b: &[Label]) -> Ordering {
+    for (a, b) in a.iter().zip(b) {
+        match a.name.cmp(&b.name).then_with(|| a.value.cmp(&b.value)) {
+            Ordering::Equal => continue,
+            other => return other,
+        }
+    }
+    a.len().cmp(&b.len())
+}
+
+/// Aggregation of the samples in a step, the result is the same as the raw
+/// samples for the function hinted.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Downsample {
+    Last,
+    Min,
+    Max,
+}
+
+impl Downsample {
+    /// Prometheus evaluates the expression at `start + k * step`, the
+    /// samples are downsampled only if the function gets the same result
+    /// from one sample per step.
+    fn from_hints(hints: &ReadHints) -> Option<Self> {
+        if hints.step_ms <= 0 {
+            return None;
+        }
+        // the range of a range vector must consist of whole steps
+        let whole_steps = hints.range_ms > 0 && hints.range_ms % hints.step_ms == 0;
+        match hints.func.as_str() {
+            // instant vector selectors, the latest sample before each step
+            "" | "sum" | "min" | "max" | "avg" | "count" | "group" | "stddev" | "stdvar"
+            | "topk" | "bottomk" | "quantile" | "count_values"
+                if hints.range_ms == 0 =>
+            {
+                Some(Self::Last)
+            }
+            "last_over_time" if whole_steps => Some(Self::Last),
+            "min_over_time" if whole_steps => Some(Self::Min),
+            "max_over_time" if whole_steps => Some(Self::Max),
+            _ => None,
+        }
+    }
+
+    /// The first evaluation time, the start of the hints is the first
+    /// evaluation time minus the range of the range vector, or minus the
+    /// lookback of the instant vector selector.
+    fn eval_start_ms(hints: &ReadHints) -> i64 {
+        if hints.range_ms > 0 {
+            hints.start_ms + hints.range_ms
+        } else {
+            hints.start_ms + LOOKBACK_DELTA_MS
+        }
+    }
+
+    fn value_expr(&self) -> String {
+        match self {
+            Self::Last => format!(
+                "last({}, \"{}\")",
+                TIME_FIELD_NAME, METRIC_SAMPLE_COLUMN_NAME
+            ),
+            Self::Min => format!("min(\"{}\")", METRIC_SAMPLE_COLUMN_NAME),
+            Self::Max => format!("max(\"{}\")", METRIC_SAMPLE_COLUMN_NAME),
+        }
+    }
+}
+
+/// Build the sql returning one sample per step and series, the time of a
+/// sample is the latest time in the step.
+fn downsample_sql(
+    table: &TskvTableSchemaRef,
+    filters: &str,
+    downsample: Downsample,
+    step_ms: i64,
+    eval_start_ms: i64,
+) -> String {
+    let tags = table
+        .columns()
+        .iter()
+        .filter(|c| c.column_type.is_tag())
+        .map(|c| format!("\"{}\"", c.name))
+        .collect::<Vec<_>>();
+    // The steps end at the evaluation times, (start + (k - 1) * step, start + k * step],
+    // which are [start + (k - 1) * step + 1ms, start + k * step + 1ms) for the samples
+    // in milliseconds, `start` is the first evaluation time, see `Downsample::eval_start_ms`.
+    let origin = chrono::DateTime::from_timestamp_millis(eval_start_ms + 1)
+        .unwrap_or_default()
+        .to_rfc3339_opts(chrono::SecondsFormat::Millis, true);
+    let window = format!(
+        "date_bin(INTERVAL '{} millisecond', {}, TIMESTAMP '{}')",
+        step_ms, TIME_FIELD_NAME, origin
+    );
+
+    let mut projection = vec![format!("max({0}) AS {0}", TIME_FIELD_NAME)];
+    projection.extend(tags.iter().cloned());
+    projection.push(format!(
+        "{} AS \"{}\"",
+        downsample.value_expr(),
+        METRIC_SAMPLE_COLUMN_NAME
+    ));
+    let mut group_by = vec![window];
+    group_by.extend(tags);
+
+    format!(
+        "SELECT {} FROM \"{}\" WHERE {} GROUP BY {} ORDER BY {}",
+        projection.join(", "),
+        table.name,
+        filters,
+        group_by.join(", "),
+        TIME_FIELD_NAME
+    )
+}
+
 fn build_sql_with_table(
     ctx: &Context,
     meta: &MetaClientRef,
@@ -275,11 +810,53 @@ fn build_sql_with_table(
         start_timestamp_ms,
         end_timestamp_ms,
         matchers,
-        hints: _,
+        hints,
     } = query;
+    let downsample = hints.as_ref().and_then(|h| {
+        Downsample::from_hints(h).map(|d| (d, h.step_ms, Downsample::eval_start_ms(h)))
+    });
+    let (tables, label_matchers) = matched_tables(ctx, meta, matchers)?;
+
+    let mut result = Vec::with_capacity(tables.as_ref().map_or(0, Vec::len));
+    for table in tables.unwrap_or_default() {
+        let mut filters = match label_filters(&table, &label_matchers)? {
+            Some(filters) => filters,
+            None => continue,
+        };
+        // Convert to ns timestamp
+        filters.push(format!("time >= {}", start_timestamp_ms * 1_000_000));
+        filters.push(format!("time <= {}", end_timestamp_ms * 1_000_000));
+
+        let filters = filters.join(" AND ");
+        let sql = match downsample {
+            Some((downsample, step_ms, eval_start_ms)) => {
+                downsample_sql(&table, &filters, downsample, step_ms, eval_start_ms)
+            }
+            None => format!(
+                "SELECT * FROM \"{}\" WHERE {} order by time",
+                table.name, filters
+            ),
+        };
+        result.push(SqlWithTable {
+            sql,
+            table,
+            downsampled: downsample.is_some(),
+        });
+    }
 
-    let mut tables = Vec::new();
-    let mut filters = Vec::with_capacity(matchers.len());
+    Ok(result)
+}
+
+/// The tables of the matchers on the metric name, `None` if there is no
+/// such matcher, and the other matchers.
+#[allow(clippy::type_complexity)]
+fn matched_tables(
+    ctx: &Context,
+    meta: &MetaClientRef,
+    matchers: Vec<LabelMatcher>,
+) -> QueryResult<(Option<Vec<TskvTableSchemaRef>>, Vec<LabelMatcher>)> {
+    let mut tables = None;
+    let mut label_matchers = Vec::with_capacity(matchers.len());
 
     for m in matchers {
         if METRIC_NAME_LABEL == m.name {
@@ -294,7 +871,7 @@ fn build_sql_with_table(
                             table: table_name.to_string(),
                         })
                         .context(MetaSnafu)?;
-                    tables = vec![table];
+                    tables = Some(vec![table]);
                 }
                 Type::Re => {
                     // Filter table names through regular expressions,
@@ -304,23 +881,7 @@ fn build_sql_with_table(
                             source: Box::new(err),
                         })?;
 
-                    tables = meta
-                        .list_tables(ctx.database())
-                        .context(MetaSnafu)?
-                        .iter()
-                        .filter(|e| pattern.is_match(e))
-                        .flat_map(|table_name| {
-                            if let Ok(s) = meta.get_tskv_table_schema(ctx.database(), table_name) {
-                                s
-                            } else {
-                                warn!(
-                                    "The table {} may have just been dropped, or it may be a bug.",
-                                    table_name
-                                );
-                                None
-                            }
-                        })
-                        .collect::<Vec<_>>();
+                    tables = Some(table_schemas(ctx, meta, |name| pattern.is_match(name))?);
                 }
                 _ => {
                     return Err(QueryError::InvalidRemoteReadReq { source: "non-equal or regex-non-equal matchers are not supported on the metric name yet".to_string().into() });
@@ -330,38 +891,180 @@ fn build_sql_with_table(
             continue;
         }
 
-        match m.r#type() {
-            Type::Eq => {
-                filters.push(format!("{} = '{}'", m.name, m.value));
+        label_matchers.push(m);
+    }
+
+    Ok((tables, label_matchers))
+}
+
+/// The tables of the `match[]` selectors of the metadata apis, and the
+/// filters of the label matchers on each one. All the tables without filter
+/// if there is no selector, or a selector doesn't match the metric name.
+fn metadata_tables(
+    ctx: &Context,
+    meta: &MetaClientRef,
+    selectors: &[String],
+) -> QueryResult<Vec<(TskvTableSchemaRef, Vec<String>)>> {
+    if selectors.is_empty() {
+        return Ok(table_schemas(ctx, meta, |_| true)?
+            .into_iter()
+            .map(|table| (table, vec![]))
+            .collect());
+    }
+
+    let mut result = vec![];
+    for selector in selectors {
+        let matchers = match super::promql::parse(selector)
+            .map_err(|reason| QueryError::InvalidPromQL { reason })?
+        {
+            Expr::Vector(selector) => selector.matchers,
+            _ => {
+                return Err(QueryError::InvalidPromQL {
+                    reason: format!("\"{}\" is not a series selector", selector),
+                })
             }
-            Type::Neq => {
-                filters.push(format!("{} != '{}'", m.name, m.value));
+        };
+        let (tables, label_matchers) =
+            matched_tables(ctx, meta, matchers.iter().map(to_label_matcher).collect())?;
+        let tables = match tables {
+            Some(tables) => tables,
+            None => table_schemas(ctx, meta, |_| true)?,
+        };
+        for table in tables {
+            if let Some(filters) = label_filters(&table, &label_matchers)? {
+                result.push((table, filters));
             }
-            Type::Re => {
-                filters.push(format!("{} ~ '{}'", m.name, m.value));
+        }
+    }
+    Ok(result)
+}
+
+fn where_clause(filters: &[String]) -> String {
+    if filters.is_empty() {
+        String::new()
+    } else {
+        format!(" WHERE {}", filters.join(" AND "))
+    }
+}
+
+/// The labels of a key of `SHOW SERIES`, the table and the non-null tags
+/// in the order of the table, as `table,tag1=a,tag2=b`. A value with `,`
+/// is taken as it is unless the rest looks like a following tag.
+fn parse_series_key(key: &str, table: &TskvTableSchemaRef) -> Labels {
+    let mut labels = Labels::new();
+    labels.insert(METRIC_NAME_LABEL.to_string(), table.name.to_string());
+    let rest = match key
+        .strip_prefix(table.name.as_str())
+        .and_then(|rest| rest.strip_prefix(','))
+    {
+        Some(rest) => rest,
+        None => return labels,
+    };
+
+    let tags = table
+        .columns()
+        .iter()
+        .filter(|c| c.column_type.is_tag())
+        .map(|c| c.name.as_str())
+        .collect::<Vec<_>>();
+    // the index of the next tag in `tags`, and the current tag
+    let mut next_tag = 0;
+    let mut current: Option<(&str, String)> = None;
+    for part in rest.split(',') {
+        let tag = tags[next_tag..].iter().position(|tag| {
+            part.strip_prefix(tag)
+                .map_or(false, |value| value.starts_with('='))
+        });
+        match tag {
+            Some(i) => {
+                if let Some((name, value)) = current.take() {
+                    labels.insert(name.to_string(), value);
+                }
+                let name = tags[next_tag + i];
+                next_tag += i + 1;
+                current = Some((name, part[name.len() + 1..].to_string()));
             }
-            Type::Nre => {
-                filters.push(format!("{} !~ '{}'", m.name, m.value));
+            None => {
+                if let Some((_, value)) = current.as_mut() {
+                    value.push(',');
+                    value.push_str(part);
+                }
             }
         }
     }
-    // Convert to ns timestamp
-    filters.push(format!("time >= {}", start_timestamp_ms * 1_000_000));
-    filters.push(format!("time <= {}", end_timestamp_ms * 1_000_000));
+    if let Some((name, value)) = current {
+        labels.insert(name.to_string(), value);
+    }
+    // the empty labels are the same as the missing ones
+    labels.retain(|_, v| !v.is_empty());
+    labels
+}
 
-    let result = tables
-        .into_iter()
-        .map(|table| SqlWithTable {
-            sql: format!(
-                "SELECT * FROM \"{}\" WHERE {} order by time",
-                table.name,
-                filters.join(" AND ")
-            ),
-            table,
+/// The schemas of the tables of the database whose names pass the filter.
+fn table_schemas(
+    ctx: &Context,
+    meta: &MetaClientRef,
+    filter: impl Fn(&str) -> bool,
+) -> QueryResult<Vec<TskvTableSchemaRef>> {
+    Ok(meta
+        .list_tables(ctx.database())
+        .context(MetaSnafu)?
+        .iter()
+        .filter(|e| filter(e))
+        .flat_map(|table_name| {
+            if let Ok(s) = meta.get_tskv_table_schema(ctx.database(), table_name) {
+                s
+            } else {
+                warn!(
+                    "The table {} may have just been dropped, or it may be a bug.",
+                    table_name
+                );
+                None
+            }
         })
-        .collect();
+        .collect::<Vec<_>>())
+}
 
-    Ok(result)
+/// The filters of the label matchers on the table, `None` if no series of
+/// the table could match. A label not in the table is taken as empty, the
+/// same as Prometheus.
+fn label_filters(
+    table: &TskvTableSchemaRef,
+    matchers: &[LabelMatcher],
+) -> QueryResult<Option<Vec<String>>> {
+    let mut filters = Vec::with_capacity(matchers.len() + 2);
+    for m in matchers {
+        if !table
+            .column(&m.name)
+            .map_or(false, |c| c.column_type.is_tag())
+        {
+            let matches_empty = match m.r#type() {
+                Type::Eq => m.value.is_empty(),
+                Type::Neq => !m.value.is_empty(),
+                Type::Re | Type::Nre => {
+                    let pattern =
+                        Regex::new(&m.value).map_err(|err| QueryError::InvalidRemoteReadReq {
+                            source: Box::new(err),
+                        })?;
+                    pattern.is_match("") == (m.r#type() == Type::Re)
+                }
+            };
+            if matches_empty {
+                continue;
+            }
+            return Ok(None);
+        }
+
+        let value = m.value.replace('\'', "''");
+        let filter = match m.r#type() {
+            Type::Eq => format!("\"{}\" = '{}'", m.name, value),
+            Type::Neq => format!("\"{}\" != '{}'", m.name, value),
+            Type::Re => format!("\"{}\" ~ '{}'", m.name, value),
+            Type::Nre => format!("\"{}\" !~ '{}'", m.name, value),
+        };
+        filters.push(filter);
+    }
+    Ok(Some(filters))
 }
 
 /// Convert the execution result of query to TimeSeries list of prometheus
@@ -393,10 +1096,13 @@ async fn transform_time_series(
 struct SqlWithTable {
     pub sql: String,
     pub table: TskvTableSchemaRef,
+    /// One sample per step, the columns are the time, the tags and the value.
+    pub downsampled: bool,
 }
 
 #[cfg(test)]
 mod test {
+    use std::collections::BTreeMap;
     use std::sync::Arc;
     use std::vec;
 
@@ -405,12 +1111,226 @@ mod test {
     use datafusion::arrow::record_batch::RecordBatch;
     use models::auth::user::{User, UserDesc, UserOptions};
     use models::schema::query_info::QueryId;
-    use protos::prompb::prometheus::{Label, Sample, TimeSeries};
+    use models::schema::tskv_table_schema::{TableColumn, TskvTableSchema};
+    use protos::prompb::prometheus::label_matcher::Type;
+    use protos::prompb::prometheus::{
+        Label, LabelMatcher, ReadHints, Sample, TimeSeries, WriteRequest,
+    };
+    use protos::FieldValue;
     use spi::query::execution::Output;
     use spi::query::recordbatch::RecordBatchStreamWrapper;
     use spi::service::protocol::{ContextBuilder, Query, QueryHandle};
 
-    use crate::prom::remote_server::transform_time_series;
+    use crate::prom::remote_server::{
+        downsample_sql, label_filters, negotiate_response_type, parse_series_key,
+        transform_time_series, write_request_to_lines, Downsample, ResponseType,
+    };
+
+    #[test]
+    fn test_label_filters() {
+        let table = Arc::new(TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            "up".to_string(),
+            vec![TableColumn::new_tag_column(1, "job".to_string())],
+        ));
+        let matcher = |name: &str, r#type: Type, value: &str| LabelMatcher {
+            r#type: r#type as i32,
+            name: name.to_string(),
+            value: value.to_string(),
+        };
+
+        assert_eq!(
+            label_filters(
+                &table,
+                &[
+                    matcher("job", Type::Eq, "it's"),
+                    matcher("instance", Type::Re, "^(?:.*)$"),
+                ]
+            )
+            .unwrap(),
+            Some(vec!["\"job\" = 'it''s'".to_string()])
+        );
+        // the label not in the table is empty
+        assert_eq!(
+            label_filters(&table, &[matcher("instance", Type::Neq, "a")]).unwrap(),
+            Some(vec![])
+        );
+        assert_eq!(
+            label_filters(&table, &[matcher("instance", Type::Eq, "a")]).unwrap(),
+            None
+        );
+    }
+
+    #[test]
+    fn test_parse_series_key() {
+        let table = Arc::new(TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            "up".to_string(),
+            vec![
+                TableColumn::new_tag_column(1, "job".to_string()),
+                TableColumn::new_tag_column(2, "instance".to_string()),
+                TableColumn::new_tag_column(3, "zone".to_string()),
+            ],
+        ));
+        let labels = |pairs: &[(&str, &str)]| {
+            pairs
+                .iter()
+                .map(|(k, v)| (k.to_string(), v.to_string()))
+                .collect::<BTreeMap<_, _>>()
+        };
+
+        assert_eq!(
+            parse_series_key("up,job=api,zone=a", &table),
+            labels(&[("__name__", "up"), ("job", "api"), ("zone", "a")])
+        );
+        assert_eq!(
+            parse_series_key("up,job=a,b=c,instance=", &table),
+            labels(&[("__name__", "up"), ("job", "a,b=c")])
+        );
+        assert_eq!(
+            parse_series_key("up", &table),
+            labels(&[("__name__", "up")])
+        );
+    }
+
+    #[test]
+    fn test_write_request_to_lines() {
+        let series = |labels: &[(&str, &str)]| TimeSeries {
+            labels: labels
+                .iter()
+                .map(|(name, value)| Label {
+                    name: name.to_string(),
+                    value: value.to_string(),
+                })
+                .collect(),
+            samples: vec![Sample {
+                value: 1.0,
+                timestamp: 1,
+            }],
+            ..Default::default()
+        };
+        let req = WriteRequest {
+            timeseries: vec![
+                series(&[("__name__", "cpu"), ("__field__", "usage"), ("host", "a")]),
+                series(&[("__name__", "cpu"), ("host", "a")]),
+            ],
+            ..Default::default()
+        };
+
+        let lines = write_request_to_lines(&req, Some("__field__"));
+        assert_eq!(lines.len(), 2);
+        assert_eq!(lines[0].table, "cpu");
+        assert_eq!(lines[0].tags, lines[1].tags);
+        assert!(!lines[0].tags.iter().any(|(k, _)| k == "__field__"));
+        assert_eq!(
+            lines[0].fields,
+            vec![("usage".into(), FieldValue::F64(1.0))]
+        );
+        assert_eq!(
+            lines[1].fields,
+            vec![("value".into(), FieldValue::F64(1.0))]
+        );
+
+        // The label is kept as a tag without the option.
+        let lines = write_request_to_lines(&req, None);
+        assert!(lines[0]
+            .tags
+            .iter()
+            .any(|(k, v)| k == "__field__" && v == "usage"));
+        assert_eq!(
+            lines[0].fields,
+            vec![("value".into(), FieldValue::F64(1.0))]
+        );
+    }
+
+    #[test]
+    fn test_negotiate_response_type() {
+        assert_eq!(negotiate_response_type(&[]).unwrap(), ResponseType::Samples);
+        assert_eq!(
+            negotiate_response_type(&[1, 0]).unwrap(),
+            ResponseType::StreamedXorChunks
+        );
+        assert_eq!(
+            negotiate_response_type(&[9, 0]).unwrap(),
+            ResponseType::Samples
+        );
+        assert!(negotiate_response_type(&[9]).is_err());
+    }
+
+    #[test]
+    fn test_downsample_from_hints() {
+        let hints = |func: &str, step_ms: i64, range_ms: i64| ReadHints {
+            step_ms,
+            func: func.to_string(),
+            range_ms,
+            ..Default::default()
+        };
+
+        assert_eq!(Downsample::from_hints(&hints("", 0, 0)), None);
+        assert_eq!(
+            Downsample::from_hints(&hints("", 15_000, 0)),
+            Some(Downsample::Last)
+        );
+        assert_eq!(
+            Downsample::from_hints(&hints("sum", 15_000, 0)),
+            Some(Downsample::Last)
+        );
+        assert_eq!(
+            Downsample::from_hints(&hints("max_over_time", 15_000, 60_000)),
+            Some(Downsample::Max)
+        );
+        assert_eq!(
+            Downsample::from_hints(&hints("min_over_time", 15_000, 60_000)),
+            Some(Downsample::Min)
+        );
+        // the range is not whole steps
+        assert_eq!(
+            Downsample::from_hints(&hints("max_over_time", 15_000, 20_000)),
+            None
+        );
+        // needs all the samples
+        assert_eq!(Downsample::from_hints(&hints("rate", 15_000, 60_000)), None);
+        assert_eq!(
+            Downsample::from_hints(&hints("avg_over_time", 15_000, 60_000)),
+            None
+        );
+    }
+
+    #[test]
+    fn test_downsample_eval_start() {
+        let table = Arc::new(TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            "up".to_string(),
+            vec![TableColumn::new_tag_column(1, "job".to_string())],
+        ));
+        // the step 7s doesn't divide the lookback 5m, the evaluation times
+        // are 1_000_000 + 300_000 + k * 7_000
+        let hints = ReadHints {
+            step_ms: 7_000,
+            start_ms: 1_000_000,
+            end_ms: 1_321_000,
+            ..Default::default()
+        };
+        let eval_start_ms = Downsample::eval_start_ms(&hints);
+        assert_eq!(eval_start_ms, 1_300_000);
+        let sql = downsample_sql(&table, "true", Downsample::Last, 7_000, eval_start_ms);
+        assert!(sql.contains(
+            "date_bin(INTERVAL '7000 millisecond', time, TIMESTAMP '1970-01-01T00:21:40.001Z')"
+        ));
+
+        // the range vector starts the range before the first evaluation time
+        let hints = ReadHints {
+            step_ms: 7_000,
+            range_ms: 70_000,
+            start_ms: 1_000_000,
+            end_ms: 1_091_000,
+            ..Default::default()
+        };
+        assert_eq!(Downsample::eval_start_ms(&hints), 1_070_000);
+    }
 
     #[tokio::test]
     async fn test_transform_time_series() {
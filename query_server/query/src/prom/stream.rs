@@ -0,0 +1,134 @@
+//! Frames of the streamed remote read response, each frame is
+//!
+//! ```text
+//! | uvarint(size of message) | crc32c(message), big endian | message |
+//! ```
+//!
+//! where the message is a `ChunkedReadResponse`.
+
+use protos::models_helper::to_prost_bytes;
+use protos::prompb::prometheus::{ChunkedReadResponse, ChunkedSeries};
+
+/// A series is split to several frames if its chunks are larger than this,
+/// the same as Prometheus.
+pub const FRAME_BYTES_LIMIT: usize = 1024 * 1024;
+
+const CASTAGNOLI: u32 = 0x82f6_3b78;
+
+const fn crc32c_table() -> [u32; 256] {
+    let mut table = [0_u32; 256];
+    let mut i = 0;
+    while i < 256 {
+        let mut crc = i as u32;
+        let mut j = 0;
+        while j < 8 {
+            crc = if crc & 1 == 1 {
+                (crc >> 1) ^ CASTAGNOLI
+            } else {
+                crc >> 1
+            };
+            j += 1;
+        }
+        table[i] = crc;
+        i += 1;
+    }
+    table
+}
+
+static CRC32C_TABLE: [u32; 256] = crc32c_table();
+
+pub fn crc32c(data: &[u8]) -> u32 {
+    let mut crc = !0_u32;
+    for b in data {
+        crc = CRC32C_TABLE[((crc ^ *b as u32) & 0xff) as usize] ^ (crc >> 8);
+    }
+    !crc
+}
+
+/// Encode the response to a frame.
+pub fn encode_frame(response: &ChunkedReadResponse) -> Vec<u8> {
+    let message = to_prost_bytes(response);
+    let mut frame = Vec::with_capacity(message.len() + 14);
+    let mut size = message.len() as u64;
+    while size >= 0x80 {
+        frame.push(size as u8 | 0x80);
+        size >>= 7;
+    }
+    frame.push(size as u8);
+    frame.extend_from_slice(&crc32c(&message).to_be_bytes());
+    frame.extend_from_slice(&message);
+    frame
+}
+
+/// Encode the series of the query to frames, the chunks of a large series
+/// are split to several frames.
+pub fn series_to_frames(series: ChunkedSeries, query_index: i64) -> Vec<Vec<u8>> {
+    let ChunkedSeries { labels, chunks } = series;
+    let mut frames = vec![];
+    let mut frame_chunks = vec![];
+    let mut frame_bytes = 0;
+    for chunk in chunks {
+        frame_bytes += chunk.data.len();
+        frame_chunks.push(chunk);
+        if frame_bytes >= FRAME_BYTES_LIMIT {
+            frames.push(encode_frame(&ChunkedReadResponse {
+                chunked_series: vec![ChunkedSeries {
+                    labels: labels.clone(),
+                    chunks: std::mem::take(&mut frame_chunks),
+                }],
+                query_index,
+            }));
+            frame_bytes = 0;
+        }
+    }
+    if !frame_chunks.is_empty() {
+        frames.push(encode_frame(&ChunkedReadResponse {
+            chunked_series: vec![ChunkedSeries {
+                labels,
+                chunks: frame_chunks,
+            }],
+            query_index,
+        }));
+    }
+    frames
+}
+
+#[cfg(test)]
+mod test {
+    use protos::models_helper::parse_prost_bytes;
+    use protos::prompb::prometheus::{ChunkedReadResponse, ChunkedSeries, Label};
+
+    use super::{crc32c, encode_frame};
+
+    #[test]
+    fn test_crc32c() {
+        assert_eq!(crc32c(b""), 0);
+        assert_eq!(crc32c(b"123456789"), 0xe306_9283);
+    }
+
+    #[test]
+    fn test_encode_frame() {
+        let response = ChunkedReadResponse {
+            chunked_series: vec![ChunkedSeries {
+                labels: vec![Label {
+                    name: "__name__".to_string(),
+                    value: "up".to_string(),
+                }],
+                chunks: vec![],
+            }],
+            query_index: 1,
+        };
+        let frame = encode_frame(&response);
+        let size = frame[0] as usize;
+        assert_eq!(frame.len(), 1 + 4 + size);
+        let message = &frame[5..];
+        assert_eq!(
+            u32::from_be_bytes(frame[1..5].try_into().unwrap()),
+            crc32c(message)
+        );
+        assert_eq!(
+            parse_prost_bytes::<ChunkedReadResponse>(message).unwrap(),
+            response
+        );
+    }
+}
@@ -1,18 +1,22 @@
 use std::sync::Arc;
 
 use datafusion::logical_expr::LogicalPlan;
-use datafusion::optimizer::analyzer::Analyzer as DFAnalyzer;
+use datafusion::optimizer::analyzer::{Analyzer as DFAnalyzer, AnalyzerRule};
 use spi::query::analyzer::Analyzer;
+use spi::query::config::MaxPoints;
 use spi::query::session::SessionCtx;
 use spi::QueryResult;
 
 use crate::extension::analyse::add_time_for_tsgenfunc::AddTimeForTSGenFunc;
+use crate::extension::analyse::auto_interval::AutoIntervalRule;
 use crate::extension::analyse::initial_plan_checker::InitialPlanChecker;
+use crate::extension::analyse::rewrite_materialized_view::RewriteMaterializedView;
 use crate::extension::analyse::transform_bottom_func_to_topk_node::TransformBottomFuncToTopkNodeRule;
 use crate::extension::analyse::transform_count_gen_time_col::TransformCountGenTimeColRule;
 use crate::extension::analyse::transform_exact_count_to_count::TransformExactCountToCountRule;
 use crate::extension::analyse::transform_time_window::TransformTimeWindowRule;
 use crate::extension::analyse::transform_topk_func_to_topk_node::TransformTopkFuncToTopkNodeRule;
+use crate::extension::analyse::transform_toptags::TransformTopTagsRule;
 use crate::extension::analyse::transform_ts_gen_func::TransformTSGenFunc;
 use crate::extension::analyse::transform_update::TransformUpdateRule;
 
@@ -29,11 +33,14 @@ impl DefaultAnalyzer {
         rules.push(Arc::new(InitialPlanChecker {}));
         rules.push(Arc::new(TransformBottomFuncToTopkNodeRule {}));
         rules.push(Arc::new(TransformTopkFuncToTopkNodeRule {}));
+        rules.push(Arc::new(TransformTopTagsRule));
         rules.push(Arc::new(TransformTimeWindowRule {}));
         rules.push(Arc::new(TransformTSGenFunc));
         rules.push(Arc::new(AddTimeForTSGenFunc {}));
         rules.push(Arc::new(TransformExactCountToCountRule {}));
         rules.push(Arc::new(TransformCountGenTimeColRule {}));
+        // after the aggregates are transformed
+        rules.push(Arc::new(RewriteMaterializedView));
 
         Self { inner: analyzer }
     }
@@ -47,9 +54,15 @@ impl Default for DefaultAnalyzer {
 
 impl Analyzer for DefaultAnalyzer {
     fn analyze(&self, plan: &LogicalPlan, session: &SessionCtx) -> QueryResult<LogicalPlan> {
-        let plan =
-            self.inner
-                .execute_and_check(plan, session.inner().config_options(), |_, _| {})?;
+        let config = session.inner().config_options();
+        // the intervals are widened before the time windows are transformed
+        let plan = match session.inner().config().get_extension::<MaxPoints>() {
+            Some(max_points) => {
+                AutoIntervalRule::new(max_points.0).analyze(plan.clone(), config)?
+            }
+            None => plan.clone(),
+        };
+        let plan = self.inner.execute_and_check(&plan, config, |_, _| {})?;
         Ok(plan)
     }
 }
@@ -25,17 +25,21 @@ use datafusion::optimizer::single_distinct_to_groupby::SingleDistinctToGroupBy;
 use datafusion::optimizer::unwrap_cast_in_comparison::UnwrapCastInComparison;
 use datafusion::optimizer::OptimizerRule;
 use spi::query::analyzer::AnalyzerRef;
+use spi::query::config::SeriesAlignment;
 use spi::query::logical_planner::QueryPlan;
 use spi::query::session::SessionCtx;
 use spi::QueryResult;
 use trace::debug;
 use trace::span_ext::SpanExt;
 
+use crate::extension::logical::optimizer_rule::align_series::AlignSeries;
 use crate::extension::logical::optimizer_rule::push_down_aggregation::PushDownAggregation;
 use crate::extension::logical::optimizer_rule::rewrite_tag_scan::RewriteTagScan;
+use crate::extension::logical::optimizer_rule::time_tolerance_join::TimeToleranceJoin;
 use crate::sql::analyzer::DefaultAnalyzer;
 
-const PUSH_DOWN_PROJECTION_INDEX: usize = 24; // index of PushDownProjection in rules
+const ALIGN_SERIES_INDEX: usize = 13; // index of AlignSeries in rules
+const PUSH_DOWN_PROJECTION_INDEX: usize = 25; // index of PushDownProjection in rules
 
 pub trait LogicalOptimizer: Send + Sync {
     fn optimize(&self, plan: &QueryPlan, session: &SessionCtx) -> QueryResult<LogicalPlan>;
@@ -81,6 +85,8 @@ impl Default for DefaultLogicalOptimizer {
             Arc::new(EliminateDuplicatedExpr::new()),
             Arc::new(EliminateFilter::new()),
             Arc::new(EliminateCrossJoin::new()),
+            // cnosdb rule, before the projections and filters are pushed down to the tables
+            Arc::new(AlignSeries::new(false)),
             Arc::new(CommonSubexprEliminate::new()),
             Arc::new(EliminateLimit::new()),
             Arc::new(PropagateEmptyRelation::new()),
@@ -103,6 +109,7 @@ impl Default for DefaultLogicalOptimizer {
             // df default rules end
             // cnosdb rules
             Arc::new(RewriteTagScan {}),
+            Arc::new(TimeToleranceJoin {}),
         ];
 
         Self { analyzer, rules }
@@ -137,9 +144,16 @@ impl LogicalOptimizer for DefaultLogicalOptimizer {
             plan.df_plan.display_indent_schema(),
         );
 
-        let rules: Vec<Arc<dyn OptimizerRule + Send + Sync>> = if plan.is_tag_scan {
+        let align_series = session
+            .inner()
+            .config()
+            .get_extension::<SeriesAlignment>()
+            .map(|align| align.0)
+            .unwrap_or_default();
+        let rules: Vec<Arc<dyn OptimizerRule + Send + Sync>> = if plan.is_tag_scan || align_series {
             let mut rules = self.rules.clone();
             rules[PUSH_DOWN_PROJECTION_INDEX] = Arc::new(PushDownProjection::new(plan.is_tag_scan));
+            rules[ALIGN_SERIES_INDEX] = Arc::new(AlignSeries::new(align_series));
             rules
         } else {
             self.rules.clone()
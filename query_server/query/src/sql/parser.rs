@@ -1,3 +1,4 @@
+use std::borrow::Cow;
 use std::collections::{HashMap, VecDeque};
 use std::fmt::Display;
 use std::ops::Not;
@@ -20,11 +21,11 @@ use spi::query::ast::{
     self, parse_string_value, Action, AlterDatabase, AlterTable, AlterTableAction, AlterTenant,
     AlterTenantOperation, AlterUser, AlterUserOperation, ChecksumGroup, ColumnOption,
     CompactDatabase, CompactVnode, CopyIntoLocation, CopyIntoTable, CopyTarget, CopyVnode,
-    CreateDatabase, CreateRole, CreateStream, CreateTable, CreateTenant, CreateUser,
-    DatabaseConfig, DatabaseOptions, DescribeDatabase, DescribeTable, DropDatabaseObject,
-    DropGlobalObject, DropTenantObject, DropVnode, Explain, ExtStatement, GrantRevoke, MoveVnode,
-    OutputMode, Privilege, RecoverDatabase, RecoverTenant, ShowSeries, ShowTagBody, ShowTagValues,
-    Trigger, UriLocation, With,
+    CreateDatabase, CreateMaterializedView, CreateRole, CreateStream, CreateTable, CreateTenant,
+    CreateUser, DatabaseConfig, DatabaseOptions, DatabasePlacement, DescribeDatabase,
+    DescribeTable, DropDatabaseObject, DropGlobalObject, DropTenantObject, DropVnode, Explain,
+    ExtStatement, GrantRevoke, MoveVnode, OutputMode, Privilege, RecoverDatabase, RecoverTenant,
+    ShowSeries, ShowTagBody, ShowTagValues, SplitDatabase, Trigger, UriLocation, With,
 };
 use spi::query::logical_planner::{DatabaseObjectType, GlobalObjectType, TenantObjectType};
 use spi::query::parser::Parser as CnosdbParser;
@@ -93,6 +94,8 @@ enum CnosKeyWord {
     #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
     COMPACT,
     #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    SPLIT,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
     CHECKSUM,
     #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
     STREAM,
@@ -126,6 +129,22 @@ enum CnosKeyWord {
     DESTORY,
     #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
     REPLICAS,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    USERS,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    FREEZE,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    UNFREEZE,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    REBUILD,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    DECOMMISSION,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    REPLACE,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    NODES,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    ZONE,
 
     #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
     MAX_MEMCACHE_SIZE,
@@ -139,6 +158,27 @@ enum CnosKeyWord {
     STRICT_WRITE,
     #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
     MAX_CACHE_READERS,
+
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    MAX_DISK_SIZE,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    MAX_SERIES,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    MAX_WRITES_PER_SEC,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    FUTURE_LIMIT,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    PAST_LIMIT,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    MAX_BUCKET_SIZE,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    INGEST_RULES,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    CARDINALITY,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    STATS,
+    #[allow(non_camel_case_types, clippy::upper_case_acronyms)]
+    DERIVATIVE,
 }
 
 impl FromStr for CnosKeyWord {
@@ -170,6 +210,7 @@ impl FromStr for CnosKeyWord {
             "NODE" => Ok(CnosKeyWord::NODE),
             "MOVE" => Ok(CnosKeyWord::MOVE),
             "COMPACT" => Ok(CnosKeyWord::COMPACT),
+            "SPLIT" => Ok(CnosKeyWord::SPLIT),
             "CHECKSUM" => Ok(CnosKeyWord::CHECKSUM),
             "STREAM" => Ok(CnosKeyWord::STREAM),
             "STREAMS" => Ok(CnosKeyWord::STREAMS),
@@ -187,12 +228,30 @@ impl FromStr for CnosKeyWord {
             "PROMOTE" => Ok(CnosKeyWord::PROMOTE),
             "DESTORY" => Ok(CnosKeyWord::DESTORY),
             "REPLICAS" => Ok(CnosKeyWord::REPLICAS),
+            "USERS" => Ok(CnosKeyWord::USERS),
+            "FREEZE" => Ok(CnosKeyWord::FREEZE),
+            "UNFREEZE" => Ok(CnosKeyWord::UNFREEZE),
+            "REBUILD" => Ok(CnosKeyWord::REBUILD),
+            "DECOMMISSION" => Ok(CnosKeyWord::DECOMMISSION),
+            "REPLACE" => Ok(CnosKeyWord::REPLACE),
+            "NODES" => Ok(CnosKeyWord::NODES),
+            "ZONE" => Ok(CnosKeyWord::ZONE),
             "MAX_MEMCACHE_SIZE" => Ok(CnosKeyWord::MAX_MEMCACHE_SIZE),
             "MEMCACHE_PARTITIONS" => Ok(CnosKeyWord::MEMCACHE_PARTITIONS),
             "WAL_MAX_FILE_SIZE" => Ok(CnosKeyWord::WAL_MAX_FILE_SIZE),
             "WAL_SYNC" => Ok(CnosKeyWord::WAL_SYNC),
             "STRICT_WRITE" => Ok(CnosKeyWord::STRICT_WRITE),
             "MAX_CACHE_READERS" => Ok(CnosKeyWord::MAX_CACHE_READERS),
+            "MAX_DISK_SIZE" => Ok(CnosKeyWord::MAX_DISK_SIZE),
+            "MAX_SERIES" => Ok(CnosKeyWord::MAX_SERIES),
+            "MAX_WRITES_PER_SEC" => Ok(CnosKeyWord::MAX_WRITES_PER_SEC),
+            "FUTURE_LIMIT" => Ok(CnosKeyWord::FUTURE_LIMIT),
+            "PAST_LIMIT" => Ok(CnosKeyWord::PAST_LIMIT),
+            "MAX_BUCKET_SIZE" => Ok(CnosKeyWord::MAX_BUCKET_SIZE),
+            "INGEST_RULES" => Ok(CnosKeyWord::INGEST_RULES),
+            "CARDINALITY" => Ok(CnosKeyWord::CARDINALITY),
+            "STATS" => Ok(CnosKeyWord::STATS),
+            "DERIVATIVE" => Ok(CnosKeyWord::DERIVATIVE),
             _ => Err(ParserError::ParserError(format!(
                 "fail parse {} to CnosKeyWord",
                 s
@@ -232,7 +291,8 @@ impl<'a> ExtParser<'a> {
     }
     /// Parse the specified tokens with dialect
     fn new_with_dialect(sql: &str, dialect: &'a dyn Dialect) -> Result<Self> {
-        let mut tokenizer = Tokenizer::new(dialect, sql);
+        let sql = rewrite_regex_match(sql);
+        let mut tokenizer = Tokenizer::new(dialect, &sql);
         let tokens = tokenizer.tokenize()?;
         Ok(ExtParser {
             parser: Parser::new(dialect).with_tokens(tokens),
@@ -321,6 +381,10 @@ impl<'a> ExtParser<'a> {
                     let update_ast = self.parser.parse_update()?;
                     Ok(ExtStatement::SqlStatement(Box::new(update_ast)))
                 }
+                Keyword::SET => {
+                    self.parser.next_token();
+                    self.parse_set_runtime_limit()
+                }
                 _ => {
                     if let Ok(word) = CnosKeyWord::from_str(&w.to_string()) {
                         return match word {
@@ -332,6 +396,10 @@ impl<'a> ExtParser<'a> {
                                 self.parser.next_token();
                                 self.parse_compact()
                             }
+                            CnosKeyWord::SPLIT => {
+                                self.parser.next_token();
+                                self.parse_split()
+                            }
                             CnosKeyWord::CHECKSUM => {
                                 self.parser.next_token();
                                 self.parse_checksum()
@@ -344,6 +412,14 @@ impl<'a> ExtParser<'a> {
                                 self.parser.next_token();
                                 self.parse_replica()
                             }
+                            CnosKeyWord::DECOMMISSION => {
+                                self.parser.next_token();
+                                self.parse_decommission()
+                            }
+                            CnosKeyWord::REPLACE => {
+                                self.parser.next_token();
+                                self.parse_replace()
+                            }
                             _ => Ok(ExtStatement::SqlStatement(Box::new(
                                 self.parser.parse_statement()?,
                             ))),
@@ -393,6 +469,14 @@ impl<'a> ExtParser<'a> {
             Ok(ExtStatement::ShowStreams(ast::ShowStreams { verbose }))
         } else if self.parse_cnos_keyword(CnosKeyWord::REPLICAS) {
             self.parse_show_replicas()
+        } else if self.parse_cnos_keyword(CnosKeyWord::USERS) {
+            Ok(ExtStatement::ShowUsers)
+        } else if self.parse_cnos_keyword(CnosKeyWord::STATS) {
+            if self.parse_cnos_keyword(CnosKeyWord::DERIVATIVE) {
+                Ok(ExtStatement::ShowStatsDerivative)
+            } else {
+                self.expected("DERIVATIVE", self.parser.peek_token())
+            }
         } else {
             parser_err!(format!("nonsupport: {}", self.parser.peek_token()))
         }
@@ -472,6 +556,9 @@ impl<'a> ExtParser<'a> {
     }
 
     fn parse_show_series(&mut self) -> Result<ExtStatement> {
+        if self.parse_cnos_keyword(CnosKeyWord::CARDINALITY) {
+            return self.parse_show_series_cardinality();
+        }
         let database_name = self.parse_on_database()?;
         self.parser.expect_keyword(Keyword::FROM)?;
         let table = self.parser.parse_identifier()?;
@@ -491,6 +578,23 @@ impl<'a> ExtParser<'a> {
         })))
     }
 
+    /// Parse `SHOW SERIES CARDINALITY [ON database] [FROM table]`
+    fn parse_show_series_cardinality(&mut self) -> Result<ExtStatement> {
+        let database_name = self.parse_on_database()?;
+        let table = if self.parser.parse_keyword(Keyword::FROM) {
+            Some(self.parser.parse_identifier()?)
+        } else {
+            None
+        };
+
+        Ok(ExtStatement::ShowSeriesCardinality(
+            ast::ShowSeriesCardinality {
+                database_name,
+                table,
+            },
+        ))
+    }
+
     fn parse_show_tag_values(&mut self) -> Result<ExtStatement> {
         let database_name = self.parse_on_database()?;
         self.parser.expect_keyword(Keyword::FROM)?;
@@ -677,7 +781,9 @@ impl<'a> ExtParser<'a> {
         self.parser.expect_keyword(Keyword::SET)?;
         let mut options = DatabaseOptions::default();
         let mut config = DatabaseConfig::default();
-        if !self.parse_database_option_or_config(&mut options, &mut config)? {
+        if !self.parse_database_option_or_config(&mut options, &mut config)?
+            && !self.parse_database_placement(&mut options)?
+        {
             return parser_err!(format!(
                 "expected database option, but found {}",
                 self.parser.peek_token()
@@ -1093,6 +1199,27 @@ impl<'a> ExtParser<'a> {
                 return parser_err!("replica number should be greater than 0");
             }
             options.replica = Some(replica);
+        } else if self.parse_cnos_keyword(CnosKeyWord::MAX_DISK_SIZE) {
+            let _ = self.parser.expect_token(&Token::Eq);
+            options.max_disk_size = Some(self.parse_string_value()?);
+        } else if self.parse_cnos_keyword(CnosKeyWord::MAX_SERIES) {
+            let _ = self.parser.expect_token(&Token::Eq);
+            options.max_series = Some(self.parse_number::<u64>()?);
+        } else if self.parse_cnos_keyword(CnosKeyWord::MAX_WRITES_PER_SEC) {
+            let _ = self.parser.expect_token(&Token::Eq);
+            options.max_writes_per_sec = Some(self.parse_number::<u64>()?);
+        } else if self.parse_cnos_keyword(CnosKeyWord::FUTURE_LIMIT) {
+            let _ = self.parser.expect_token(&Token::Eq);
+            options.future_limit = Some(self.parse_string_value()?);
+        } else if self.parse_cnos_keyword(CnosKeyWord::PAST_LIMIT) {
+            let _ = self.parser.expect_token(&Token::Eq);
+            options.past_limit = Some(self.parse_string_value()?);
+        } else if self.parse_cnos_keyword(CnosKeyWord::MAX_BUCKET_SIZE) {
+            let _ = self.parser.expect_token(&Token::Eq);
+            options.max_bucket_size = Some(self.parse_string_value()?);
+        } else if self.parse_cnos_keyword(CnosKeyWord::INGEST_RULES) {
+            let _ = self.parser.expect_token(&Token::Eq);
+            options.ingest_rules = Some(self.parse_string_value()?);
         } else if self.parse_cnos_keyword(CnosKeyWord::PRECISION) {
             let _ = self.parser.expect_token(&Token::Eq);
             config.precision = Some(self.parse_string_value()?);
@@ -1120,6 +1247,38 @@ impl<'a> ExtParser<'a> {
         Ok(true)
     }
 
+    /// Parses `ON [NODES (id, ...)] [ZONE 'zone'] [TAGS ('tag', ...)]`,
+    /// returns false if the placement is absent.
+    fn parse_database_placement(&mut self, options: &mut DatabaseOptions) -> Result<bool> {
+        if !self.parser.parse_keyword(Keyword::ON) {
+            return Ok(false);
+        }
+        let mut placement = DatabasePlacement::default();
+        let mut parsed = false;
+        loop {
+            if self.parse_cnos_keyword(CnosKeyWord::NODES) {
+                self.parser.expect_token(&Token::LParen)?;
+                placement.nodes = self.parse_comma_separated(ExtParser::parse_number::<u64>)?;
+                self.parser.expect_token(&Token::RParen)?;
+            } else if self.parse_cnos_keyword(CnosKeyWord::ZONE) {
+                placement.zone = Some(self.parse_string_value()?);
+            } else if self.parse_cnos_keyword(CnosKeyWord::TAGS) {
+                self.parser.expect_token(&Token::LParen)?;
+                placement.tags =
+                    self.parse_comma_separated(|parser| parser.parser.parse_literal_string())?;
+                self.parser.expect_token(&Token::RParen)?;
+            } else {
+                break;
+            }
+            parsed = true;
+        }
+        if !parsed {
+            return self.expected("NODES, ZONE or TAGS", self.parser.peek_token());
+        }
+        options.placement = Some(placement);
+        Ok(true)
+    }
+
     fn parse_number<T: FromStr>(&mut self) -> Result<T> {
         let num = self.parser.parse_number_value()?.to_string();
         match num.parse::<T>() {
@@ -1195,7 +1354,8 @@ impl<'a> ExtParser<'a> {
         let database_name = self.parser.parse_identifier()?;
         let name_vec = ObjectName(vec![database_name.clone()]);
         check_name_not_contain_illegal_character(&name_vec)?;
-        let (options, config) = self.parse_database_options_and_config()?;
+        let (mut options, config) = self.parse_database_options_and_config()?;
+        self.parse_database_placement(&mut options)?;
         Ok(ExtStatement::CreateDatabase(
             CreateDatabase {
                 name: database_name,
@@ -1676,11 +1836,38 @@ impl<'a> ExtParser<'a> {
             self.parse_create_role()
         } else if self.parse_cnos_keyword(CnosKeyWord::STREAM) {
             self.parse_create_stream()
+        } else if self
+            .parser
+            .parse_keywords(&[Keyword::MATERIALIZED, Keyword::VIEW])
+        {
+            self.parse_create_materialized_view()
         } else {
             self.expected("an object type after CREATE", self.parser.peek_token())
         }
     }
 
+    /// e.g.
+    /// CREATE MATERIALIZED VIEW IF NOT EXISTS cpu_1m AS
+    /// SELECT date_bin(INTERVAL '1 minute', time) AS time, host, max(usage) AS max_usage
+    /// FROM cpu GROUP BY date_bin(INTERVAL '1 minute', time), host
+    fn parse_create_materialized_view(&mut self) -> Result<ExtStatement> {
+        let if_not_exists =
+            self.parser
+                .parse_keywords(&[Keyword::IF, Keyword::NOT, Keyword::EXISTS]);
+        let name = self.parser.parse_object_name()?;
+        check_name_not_contain_illegal_character(&name)?;
+        self.parser.expect_keyword(Keyword::AS)?;
+        let query = Box::new(self.parser.parse_query()?);
+
+        Ok(ExtStatement::CreateMaterializedView(
+            CreateMaterializedView {
+                if_not_exists,
+                name,
+                query,
+            },
+        ))
+    }
+
     /// Parse a copy statement
     fn parse_copy(&mut self) -> Result<ExtStatement> {
         if self.parse_cnos_keyword(CnosKeyWord::VNODE) {
@@ -1939,9 +2126,20 @@ impl<'a> ExtParser<'a> {
             let if_exist = self.parser.parse_keywords(&[Keyword::IF, Keyword::EXISTS]);
             let name = self.parser.parse_identifier()?;
             ExtStatement::DropStream(ast::DropStream { if_exist, name })
+        } else if self
+            .parser
+            .parse_keywords(&[Keyword::MATERIALIZED, Keyword::VIEW])
+        {
+            let if_exist = self.parser.parse_keywords(&[Keyword::IF, Keyword::EXISTS]);
+            let object_name = self.parser.parse_object_name()?;
+            ExtStatement::DropDatabaseObject(DropDatabaseObject {
+                object_name,
+                if_exist,
+                obj_type: DatabaseObjectType::MaterializedView,
+            })
         } else {
             return self.expected(
-                "TABLE,DATABASE,TENANT,USER,ROLE,VNODE,STREAM after DROP",
+                "TABLE,DATABASE,TENANT,USER,ROLE,VNODE,STREAM,MATERIALIZED VIEW after DROP",
                 self.parser.peek_token(),
             );
         };
@@ -1963,6 +2161,35 @@ impl<'a> ExtParser<'a> {
         }
     }
 
+    /// Parse `DECOMMISSION NODE <node_id>`
+    fn parse_decommission(&mut self) -> Result<ExtStatement> {
+        if self.parse_cnos_keyword(CnosKeyWord::NODE).not() {
+            return parser_err!("expected NODE, after DECOMMISSION");
+        }
+        let node_id = self.parse_number::<NodeId>()?;
+        Ok(ExtStatement::DecommissionNode(ast::DecommissionNode {
+            node_id,
+            replacement: None,
+        }))
+    }
+
+    /// Parse `REPLACE NODE <node_id> WITH NODE <node_id>`
+    fn parse_replace(&mut self) -> Result<ExtStatement> {
+        if self.parse_cnos_keyword(CnosKeyWord::NODE).not() {
+            return parser_err!("expected NODE, after REPLACE");
+        }
+        let node_id = self.parse_number::<NodeId>()?;
+        self.parser.expect_keyword(Keyword::WITH)?;
+        if self.parse_cnos_keyword(CnosKeyWord::NODE).not() {
+            return parser_err!("expected NODE, after WITH");
+        }
+        let replacement = self.parse_number::<NodeId>()?;
+        Ok(ExtStatement::DecommissionNode(ast::DecommissionNode {
+            node_id,
+            replacement: Some(replacement),
+        }))
+    }
+
     fn parse_compact(&mut self) -> Result<ExtStatement> {
         if self.parse_cnos_keyword(CnosKeyWord::VNODE) {
             let mut vnode_ids = Vec::new();
@@ -1983,6 +2210,25 @@ impl<'a> ExtParser<'a> {
         }
     }
 
+    fn parse_split(&mut self) -> Result<ExtStatement> {
+        if self.parser.parse_keyword(Keyword::DATABASE) {
+            let database_name = self.parser.parse_identifier()?;
+            Ok(ExtStatement::SplitDatabase(SplitDatabase { database_name }))
+        } else {
+            parser_err!("Expected DATABASE, after SPLIT")
+        }
+    }
+
+    /// Parse `SET <limit> { = | TO } <value>`
+    fn parse_set_runtime_limit(&mut self) -> Result<ExtStatement> {
+        let name = self.parser.parse_identifier()?;
+        if !self.consume_token(&Token::Eq) && !self.parser.parse_keyword(Keyword::TO) {
+            return parser_err!(format!("Expected = or TO after SET {}", name));
+        }
+        let value = self.parser.parse_value()?;
+        Ok(ExtStatement::SetRuntimeLimit(SqlOption { name, value }))
+    }
+
     fn parse_checksum(&mut self) -> Result<ExtStatement> {
         if self.parser.parse_keyword(Keyword::GROUP) {
             let replication_set_id = self.parse_number::<ReplicationSetId>()?;
@@ -2051,6 +2297,34 @@ impl<'a> ExtParser<'a> {
             Ok(ExtStatement::ReplicaDestory(ast::ReplicaDestory {
                 replica_id,
             }))
+        } else if self.parse_cnos_keyword(CnosKeyWord::REBUILD) {
+            if !self.parse_cnos_keyword(CnosKeyWord::REPLICA_ID) {
+                return parser_err!("expected REPLICA_ID, after REBUILD");
+            }
+            let replica_id = self.parse_number::<ReplicationSetId>()?;
+            if !self.parse_cnos_keyword(CnosKeyWord::NODE_ID) {
+                return parser_err!("expected NODE_ID, after REPLICA_ID");
+            }
+            let node_id = self.parse_number::<NodeId>()?;
+            Ok(ExtStatement::ReplicaRebuild(ast::ReplicaRebuild {
+                replica_id,
+                node_id,
+            }))
+        } else if self.peek_cnos_keyword() == Ok(CnosKeyWord::FREEZE)
+            || self.peek_cnos_keyword() == Ok(CnosKeyWord::UNFREEZE)
+        {
+            let frozen = self.parse_cnos_keyword(CnosKeyWord::FREEZE);
+            if !frozen {
+                self.parser.next_token();
+            }
+            if !self.parse_cnos_keyword(CnosKeyWord::REPLICA_ID) {
+                return parser_err!("expected REPLICA_ID, after FREEZE or UNFREEZE");
+            }
+            let replica_id = self.parse_number::<ReplicationSetId>()?;
+            Ok(ExtStatement::ReplicaFreeze(ast::ReplicaFreeze {
+                replica_id,
+                frozen,
+            }))
         } else {
             parser_err!("expected VNODE, after MOVE")
         }
@@ -2203,6 +2477,84 @@ fn check_name_not_contain_illegal_character(object_name: &ObjectName) -> Result<
     Ok(())
 }
 
+/// Rewrites the regular expressions of InfluxQL, `f =~ /pattern/` and
+/// `f !~ /pattern/`, to the `~` and `!~` operators on a string pattern. `\/`
+/// in the pattern is a `/`.
+fn rewrite_regex_match(sql: &str) -> Cow<'_, str> {
+    let bytes = sql.as_bytes();
+    let mut result = String::new();
+    let mut copied = 0;
+    let mut i = 0;
+    while i < bytes.len() {
+        match bytes[i] {
+            // skip the strings and the quoted identifiers
+            quote @ (b'\'' | b'"') => {
+                i += 1;
+                while i < bytes.len() && bytes[i] != quote {
+                    i += 1;
+                }
+            }
+            b'-' if bytes.get(i + 1) == Some(&b'-') => {
+                while i < bytes.len() && bytes[i] != b'\n' {
+                    i += 1;
+                }
+            }
+            b'/' if bytes.get(i + 1) == Some(&b'*') => {
+                i = sql[i + 2..]
+                    .find("*/")
+                    .map_or(bytes.len(), |p| i + 2 + p + 1);
+            }
+            b'=' | b'!' if bytes.get(i + 1) == Some(&b'~') => {
+                if let Some((pattern, end)) = regex_literal(sql, i + 2) {
+                    result.push_str(&sql[copied..i]);
+                    result.push_str(if bytes[i] == b'=' { "~ '" } else { "!~ '" });
+                    result.push_str(&pattern.replace('\'', "''"));
+                    result.push('\'');
+                    copied = end;
+                    i = end;
+                    continue;
+                }
+            }
+            _ => {}
+        }
+        i += 1;
+    }
+
+    if copied == 0 {
+        return Cow::Borrowed(sql);
+    }
+    result.push_str(&sql[copied..]);
+    Cow::Owned(result)
+}
+
+/// The pattern of `/pattern/` after the whitespaces from `start`, and the
+/// position after it.
+fn regex_literal(sql: &str, start: usize) -> Option<(String, usize)> {
+    let rest = &sql[start..];
+    let open = start + rest.len() - rest.trim_start().len();
+    if !sql[open..].starts_with('/') {
+        return None;
+    }
+
+    let mut pattern = String::new();
+    let mut chars = sql[open + 1..].char_indices();
+    while let Some((i, c)) = chars.next() {
+        match c {
+            '/' => return Some((pattern, open + 1 + i + 1)),
+            '\\' => match chars.next() {
+                Some((_, '/')) => pattern.push('/'),
+                Some((_, c)) => {
+                    pattern.push('\\');
+                    pattern.push(c);
+                }
+                None => return None,
+            },
+            c => pattern.push(c),
+        }
+    }
+    None
+}
+
 /// This is a copy of the equivalent implementation in Datafusion.
 fn parse_file_type(s: &str) -> Result<String, ParserError> {
     Ok(s.to_uppercase())
@@ -2240,6 +2592,22 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_rewrite_regex_match() {
+        assert_eq!(
+            rewrite_regex_match(r"SELECT * FROM t WHERE f =~ /^err.*\d+$/ AND g !~ /a\/b'c/"),
+            r"SELECT * FROM t WHERE f ~ '^err.*\d+$' AND g !~ 'a/b''c'"
+        );
+        // not in the strings or comments
+        let sql = "SELECT 'f =~ /a/', \"g !~ /b/\" FROM t -- h =~ /c/";
+        assert!(matches!(rewrite_regex_match(sql), Cow::Borrowed(s) if s == sql));
+        // the pattern is not closed
+        let sql = "SELECT * FROM t WHERE f =~ /a";
+        assert_eq!(rewrite_regex_match(sql), sql);
+
+        assert!(ExtParser::parse_sql("SELECT * FROM t WHERE f =~ /^a/").is_ok());
+    }
+
     #[test]
     fn test_drop() {
         let sql = "drop database if exists test_db";
@@ -2679,6 +3047,14 @@ mod tests {
                         shard_num: Some(5),
                         vnode_duration: Some("3d".to_string()),
                         replica: Some(10),
+                        max_disk_size: None,
+                        max_series: None,
+                        max_writes_per_sec: None,
+                        future_limit: None,
+                        past_limit: None,
+                        max_bucket_size: None,
+                        ingest_rules: None,
+                        placement: None,
                     },
                     config: DatabaseConfig {
                         precision: Some("us".to_string()),
@@ -2714,6 +3090,14 @@ mod tests {
                         shard_num: Some(6),
                         vnode_duration: Some("730.5d".to_string()),
                         replica: Some(1),
+                        max_disk_size: None,
+                        max_series: None,
+                        max_writes_per_sec: None,
+                        future_limit: None,
+                        past_limit: None,
+                        max_bucket_size: None,
+                        ingest_rules: None,
+                        placement: None,
                     },
                     config: DatabaseConfig {
                         precision: Some("us".to_string()),
@@ -2730,6 +3114,149 @@ mod tests {
             _ => panic!("impossible"),
         }
     }
+
+    #[test]
+    fn test_create_database_placement() {
+        let sql = "CREATE DATABASE test WITH TTL '10d' ON NODES (1, 2) ZONE 'eu-west' TAGS ('ssd', 'nvme');";
+        let statements = ExtParser::parse_sql(sql).unwrap();
+        match statements[0] {
+            ExtStatement::CreateDatabase(ref stmt) => {
+                assert_eq!(stmt.options.ttl, Some("10d".to_string()));
+                assert_eq!(
+                    stmt.options.placement,
+                    Some(DatabasePlacement {
+                        nodes: vec![1, 2],
+                        zone: Some("eu-west".to_string()),
+                        tags: vec!["ssd".to_string(), "nvme".to_string()],
+                    })
+                );
+            }
+            _ => panic!("impossible"),
+        }
+
+        let sql = "ALTER DATABASE test SET ON ZONE 'eu-west';";
+        let statements = ExtParser::parse_sql(sql).unwrap();
+        match statements[0] {
+            ExtStatement::AlterDatabase(ref stmt) => {
+                assert_eq!(
+                    stmt.options.placement,
+                    Some(DatabasePlacement {
+                        zone: Some("eu-west".to_string()),
+                        ..Default::default()
+                    })
+                );
+            }
+            _ => panic!("impossible"),
+        }
+
+        assert!(ExtParser::parse_sql("CREATE DATABASE test ON;").is_err());
+    }
+
+    #[test]
+    fn test_alter_database_quota() {
+        let sql = "alter database test set max_disk_size '10GiB';
+            alter database test set max_series 100000;
+            alter database test set max_writes_per_sec 0;";
+        let statements = ExtParser::parse_sql(sql).unwrap();
+        let expected = [
+            DatabaseOptions {
+                max_disk_size: Some("10GiB".to_string()),
+                ..Default::default()
+            },
+            DatabaseOptions {
+                max_series: Some(100000),
+                ..Default::default()
+            },
+            DatabaseOptions {
+                max_writes_per_sec: Some(0),
+                ..Default::default()
+            },
+        ];
+        assert_eq!(statements.len(), expected.len());
+        for (statement, options) in statements.into_iter().zip(expected) {
+            assert_eq!(
+                statement,
+                ExtStatement::AlterDatabase(
+                    AlterDatabase {
+                        name: Ident::new("test"),
+                        options,
+                    }
+                    .into()
+                )
+            );
+        }
+    }
+
+    #[test]
+    fn test_create_database_time_limit() {
+        let sql = "CREATE DATABASE test WITH FUTURE_LIMIT '1h' PAST_LIMIT '30d';";
+        let statement = parse_sql(sql);
+        assert_eq!(
+            statement,
+            ExtStatement::CreateDatabase(CreateDatabase {
+                name: Ident::new("test"),
+                if_not_exists: false,
+                options: DatabaseOptions {
+                    future_limit: Some("1h".to_string()),
+                    past_limit: Some("30d".to_string()),
+                    ..Default::default()
+                },
+                config: DatabaseConfig::default(),
+            })
+        );
+    }
+
+    #[test]
+    fn test_create_database_max_bucket_size() {
+        let sql = "CREATE DATABASE test WITH VNODE_DURATION '7d' MAX_BUCKET_SIZE '10GiB';";
+        let statement = parse_sql(sql);
+        assert_eq!(
+            statement,
+            ExtStatement::CreateDatabase(CreateDatabase {
+                name: Ident::new("test"),
+                if_not_exists: false,
+                options: DatabaseOptions {
+                    vnode_duration: Some("7d".to_string()),
+                    max_bucket_size: Some("10GiB".to_string()),
+                    ..Default::default()
+                },
+                config: DatabaseConfig::default(),
+            })
+        );
+    }
+
+    #[test]
+    fn test_alter_database_ingest_rules() {
+        let sql = "ALTER DATABASE test SET INGEST_RULES 'rename_tag hostname host; drop_tag dc';";
+        let statement = parse_sql(sql);
+        assert_eq!(
+            statement,
+            ExtStatement::AlterDatabase(
+                AlterDatabase {
+                    name: Ident::new("test"),
+                    options: DatabaseOptions {
+                        ingest_rules: Some("rename_tag hostname host; drop_tag dc".to_string()),
+                        ..Default::default()
+                    },
+                }
+                .into()
+            )
+        );
+    }
+
+    #[test]
+    fn test_split_database() {
+        let statement = parse_sql("SPLIT DATABASE test;");
+        assert_eq!(
+            statement,
+            ExtStatement::SplitDatabase(SplitDatabase {
+                database_name: Ident::new("test"),
+            })
+        );
+
+        assert!(ExtParser::parse_sql("SPLIT test;").is_err());
+    }
+
     #[test]
     #[should_panic]
     fn test_create_table_without_fields() {
@@ -2881,11 +3408,101 @@ mod tests {
             ExtStatement::ReplicaDestory(ast::ReplicaDestory { replica_id: 111 })
         );
 
+        let sql1 = "replica rebuild replica_id 111 node_id 2001;";
+        let statement = ExtParser::parse_sql(sql1).unwrap();
+        assert_eq!(
+            statement[0],
+            ExtStatement::ReplicaRebuild(ast::ReplicaRebuild {
+                replica_id: 111,
+                node_id: 2001,
+            })
+        );
+
+        let sql1 = "replica freeze replica_id 111;";
+        let statement = ExtParser::parse_sql(sql1).unwrap();
+        assert_eq!(
+            statement[0],
+            ExtStatement::ReplicaFreeze(ast::ReplicaFreeze {
+                replica_id: 111,
+                frozen: true,
+            })
+        );
+
+        let sql1 = "replica unfreeze replica_id 111;";
+        let statement = ExtParser::parse_sql(sql1).unwrap();
+        assert_eq!(
+            statement[0],
+            ExtStatement::ReplicaFreeze(ast::ReplicaFreeze {
+                replica_id: 111,
+                frozen: false,
+            })
+        );
+
         let sql1 = "show replicas;";
         let statement = ExtParser::parse_sql(sql1).unwrap();
         assert_eq!(statement[0], ExtStatement::ShowReplicas);
     }
 
+    #[test]
+    fn test_show_series_cardinality() {
+        let statement = ExtParser::parse_sql("show series cardinality;").unwrap();
+        assert_eq!(
+            statement[0],
+            ExtStatement::ShowSeriesCardinality(ast::ShowSeriesCardinality {
+                database_name: None,
+                table: None,
+            })
+        );
+
+        let statement = ExtParser::parse_sql("show series cardinality on db from air;").unwrap();
+        assert_eq!(
+            statement[0],
+            ExtStatement::ShowSeriesCardinality(ast::ShowSeriesCardinality {
+                database_name: Some(Ident::new("db")),
+                table: Some(Ident::new("air")),
+            })
+        );
+    }
+
+    #[test]
+    fn test_show_users() {
+        let statement = ExtParser::parse_sql("show users;").unwrap();
+        assert_eq!(statement[0], ExtStatement::ShowUsers);
+    }
+
+    #[test]
+    fn test_show_stats_derivative() {
+        let statement = ExtParser::parse_sql("show stats derivative;").unwrap();
+        assert_eq!(statement[0], ExtStatement::ShowStatsDerivative);
+        assert!(ExtParser::parse_sql("show stats;").is_err());
+    }
+
+    #[test]
+    fn test_decommission_node_sql() {
+        let sql1 = "decommission node 2001;";
+        let statement = ExtParser::parse_sql(sql1).unwrap();
+        assert_eq!(
+            statement[0],
+            ExtStatement::DecommissionNode(ast::DecommissionNode {
+                node_id: 2001,
+                replacement: None,
+            })
+        );
+
+        let sql1 = "replace node 2001 with node 2002;";
+        let statement = ExtParser::parse_sql(sql1).unwrap();
+        assert_eq!(
+            statement[0],
+            ExtStatement::DecommissionNode(ast::DecommissionNode {
+                node_id: 2001,
+                replacement: Some(2002),
+            })
+        );
+
+        assert!(ExtParser::parse_sql("decommission 2001;").is_err());
+        assert!(ExtParser::parse_sql("replace node 2001 node 2002;").is_err());
+    }
+
     #[test]
     fn test_vnode_sql() {
         let sql1 = "move vnode 1 to node 2;";
@@ -2930,6 +3547,27 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_set_runtime_limit() {
+        let statement = parse_sql("set max_concurrent_queries = 20;");
+        assert_eq!(
+            statement,
+            ExtStatement::SetRuntimeLimit(SqlOption {
+                name: Ident::new("max_concurrent_queries"),
+                value: Value::Number("20".to_string(), false),
+            })
+        );
+        let statement = parse_sql("SET write_timeout TO '30s'");
+        assert_eq!(
+            statement,
+            ExtStatement::SetRuntimeLimit(SqlOption {
+                name: Ident::new("write_timeout"),
+                value: Value::SingleQuotedString("30s".to_string()),
+            })
+        );
+        assert!(ExtParser::parse_sql("set max_concurrent_queries 20").is_err());
+    }
+
     #[test]
     fn test_parse_copy_into_table_no_error() {
         let sql = r#"
@@ -3027,6 +3665,43 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_create_materialized_view() {
+        let statement = parse_sql(
+            "create materialized view if not exists db.cpu_1m as \
+            select date_bin(interval '1 minute', time) as time, host, max(usage) as max_usage \
+            from cpu group by date_bin(interval '1 minute', time), host;",
+        );
+
+        match statement {
+            ExtStatement::CreateMaterializedView(CreateMaterializedView {
+                if_not_exists,
+                name,
+                query,
+            }) => {
+                assert!(if_not_exists);
+                assert_eq!(name.to_string(), "db.cpu_1m");
+                assert!(matches!(query.body.as_ref(), SetExpr::Select(_)));
+            }
+            _ => panic!("expect CreateMaterializedView"),
+        }
+
+        assert!(ExtParser::parse_sql("create materialized view v select 1").is_err());
+    }
+
+    #[test]
+    fn test_drop_materialized_view() {
+        let result = parse_sql("drop materialized view if exists cpu_1m;");
+
+        let expected = ExtStatement::DropDatabaseObject(DropDatabaseObject {
+            object_name: ObjectName(vec![Ident::new("cpu_1m")]),
+            if_exist: true,
+            obj_type: DatabaseObjectType::MaterializedView,
+        });
+
+        assert_eq!(expected, result);
+    }
+
     #[test]
     fn test_drop_stream() {
         let result = parse_sql("drop stream if exists test_s;");
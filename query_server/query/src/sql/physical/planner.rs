@@ -25,6 +25,8 @@ use spi::QueryResult;
 use super::optimizer::PhysicalOptimizer;
 use crate::extension::physical::optimizer_rule::add_assert::AddAssertExec;
 use crate::extension::physical::optimizer_rule::add_sort::AddSortExec;
+use crate::extension::physical::optimizer_rule::push_down_last_rows::PushDownLastRows;
+use crate::extension::physical::optimizer_rule::push_down_top_k::PushDownTopK;
 use crate::extension::physical::transform_rule::expand::ExpandPlanner;
 use crate::extension::physical::transform_rule::table_writer::TableWriterPlanner;
 use crate::extension::physical::transform_rule::tag_scan::TagScanPlanner;
@@ -117,6 +119,8 @@ impl Default for DefaultPhysicalPlanner {
             // CnosDB
             Arc::new(AddAssertExec::new()),
             Arc::new(AddSortExec::new()),
+            Arc::new(PushDownLastRows::new()),
+            Arc::new(PushDownTopK::new()),
         ];
 
         Self {
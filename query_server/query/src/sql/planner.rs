@@ -42,9 +42,9 @@ use datafusion::scalar::ScalarValue;
 use datafusion::sql::parser::CreateExternalTable as AstCreateExternalTable;
 use datafusion::sql::planner::{object_name_to_table_reference, PlannerContext, SqlToRel};
 use datafusion::sql::sqlparser::ast::{
-    Assignment, DataType as SQLDataType, Expr as SQLExpr, Expr as ASTExpr, Ident, ObjectName,
-    Offset, OrderByExpr, Query, SqlOption, Statement, TableAlias, TableFactor, TableWithJoins,
-    TimezoneInfo,
+    Assignment, BinaryOperator, DataType as SQLDataType, Expr as SQLExpr, Expr as ASTExpr, Ident,
+    ObjectName, Offset, OrderByExpr, Query, SelectItem, SetExpr, SqlOption, Statement, TableAlias,
+    TableFactor, TableWithJoins, TimezoneInfo,
 };
 use datafusion::sql::sqlparser::parser::ParserError;
 use datafusion::sql::TableReference;
@@ -55,18 +55,23 @@ use models::auth::privilege::{
     DatabasePrivilege, GlobalPrivilege, Privilege, TenantObjectPrivilege,
 };
 use models::auth::role::{SystemTenantRole, TenantRoleIdentifier};
-use models::auth::user::User;
+use models::auth::user::{DeniedStatement, DeniedStatements, User};
+use models::codec::Encoding;
 use models::gis::data_type::{Geometry, GeometryType};
 use models::object_reference::{Resolve, ResolvedTable};
 use models::oid::{Identifier, Oid};
-use models::schema::database_schema::{DatabaseConfigBuilder, DatabaseOptionsBuilder};
+use models::schema::database_schema::{
+    DatabaseConfigBuilder, DatabaseOptionsBuilder, DatabasePlacement,
+};
+use models::schema::ingest_rule::IngestRules;
+use models::schema::materialized_view::{MaterializedView, ViewAggregate, ViewAggregateFunction};
 use models::schema::stream_table_schema::Watermark;
 use models::schema::tenant::Tenant;
 use models::schema::tskv_table_schema::{
     ColumnType, TableColumn, TskvTableSchema, TskvTableSchemaRef,
 };
 use models::schema::{DEFAULT_CATALOG, TIME_FIELD_NAME};
-use models::utils::SeqIdGenerator;
+use models::utils::{now_timestamp_millis, SeqIdGenerator};
 use models::{ColumnId, ValueType};
 use object_store::ObjectStore;
 use snafu::ResultExt;
@@ -78,25 +83,29 @@ use spi::query::ast::{
     CompactVnode as ASTCompactVnode, CopyIntoTable, CopyTarget, CopyVnode as ASTCopyVnode,
     CreateDatabase as ASTCreateDatabase, CreateTable as ASTCreateTable,
     DatabaseConfig as ASTDatabaseConfig, DatabaseOptions as ASTDatabaseOptions,
-    DescribeDatabase as DescribeDatabaseOptions, DescribeTable as DescribeTableOptions,
-    DropVnode as ASTDropVnode, ExtStatement, MoveVnode as ASTMoveVnode,
-    ReplicaAdd as ASTReplicaAdd, ReplicaDestory as ASTReplicaDestory,
-    ReplicaPromote as ASTReplicaPromote, ReplicaRemove as ASTReplicaRemove,
-    ShowSeries as ASTShowSeries, ShowTagBody, ShowTagValues as ASTShowTagValues, UriLocation, With,
+    DecommissionNode as ASTDecommissionNode, DescribeDatabase as DescribeDatabaseOptions,
+    DescribeTable as DescribeTableOptions, DropVnode as ASTDropVnode, ExtStatement,
+    MoveVnode as ASTMoveVnode, ReplicaAdd as ASTReplicaAdd, ReplicaDestory as ASTReplicaDestory,
+    ReplicaFreeze as ASTReplicaFreeze, ReplicaPromote as ASTReplicaPromote,
+    ReplicaRebuild as ASTReplicaRebuild, ReplicaRemove as ASTReplicaRemove,
+    ShowSeries as ASTShowSeries, ShowSeriesCardinality as ASTShowSeriesCardinality, ShowTagBody,
+    ShowTagValues as ASTShowTagValues, SplitDatabase as ASTSplitDatabase, UriLocation, With,
 };
 use spi::query::datasource::{self, UriSchema};
 use spi::query::logical_planner::{
     normalize_sql_object_name_to_string, parse_connection_options,
-    sql_option_to_alter_tenant_action, sql_options_to_map, sql_options_to_tenant_options,
-    sql_options_to_user_options, unset_option_to_alter_tenant_action, AlterDatabase, AlterTable,
-    AlterTableAction, AlterTenant, AlterTenantAction, AlterTenantAddUser, AlterTenantSetUser,
-    AlterUser, AlterUserAction, ChecksumGroup, CompactVnode, CopyOptions, CopyOptionsBuilder,
-    CopyVnode, CreateDatabase, CreateRole, CreateStreamTable, CreateTable, CreateTenant,
-    CreateUser, DDLPlan, DMLPlan, DatabaseObjectType, DeleteFromTable, DropDatabaseObject,
+    sql_option_to_alter_tenant_action, sql_option_to_runtime_limit, sql_options_to_map,
+    sql_options_to_tenant_options, sql_options_to_user_options,
+    unset_option_to_alter_tenant_action, AlterDatabase, AlterTable, AlterTableAction, AlterTenant,
+    AlterTenantAction, AlterTenantAddUser, AlterTenantSetUser, AlterUser, AlterUserAction,
+    ChecksumGroup, CompactVnode, CopyOptions, CopyOptionsBuilder, CopyVnode, CreateDatabase,
+    CreateMaterializedView, CreateRole, CreateStreamTable, CreateTable, CreateTenant, CreateUser,
+    DDLPlan, DMLPlan, DatabaseObjectType, DecommissionNode, DeleteFromTable, DropDatabaseObject,
     DropGlobalObject, DropTenantObject, DropVnode, FileFormatOptions, FileFormatOptionsBuilder,
     GlobalObjectType, GrantRevoke, LogicalPlanner, MoveVnode, Plan, PlanWithPrivileges, QueryPlan,
-    RecoverDatabase, RecoverTenant, ReplicaAdd, ReplicaDestory, ReplicaPromote, ReplicaRemove,
-    SYSPlan, TenantObjectType, TENANT_OPTION_LIMITER,
+    RecoverDatabase, RecoverTenant, ReplicaAdd, ReplicaDestory, ReplicaFreeze, ReplicaPromote,
+    ReplicaRebuild, ReplicaRemove, SYSPlan, SetRuntimeLimit, ShowSeriesCardinality, SplitBuckets,
+    TenantObjectType, TENANT_OPTION_LIMITER,
 };
 use spi::query::session::SessionCtx;
 use spi::{
@@ -112,6 +121,7 @@ use utils::precision::Precision;
 use crate::data_source::source_downcast_adapter;
 use crate::data_source::stream::{get_event_time_column, get_watermark_delay};
 use crate::data_source::table_source::{TableHandle, TableSourceAdapter, TEMP_LOCATION_TABLE_NAME};
+use crate::extension::analyse::rewrite_materialized_view::{time_bucket, view_aggregate};
 use crate::extension::logical::logical_plan_builder::LogicalPlanBuilderExt;
 use crate::extension::logical::plan_node::update::UpdateNode;
 use crate::metadata::{
@@ -173,7 +183,7 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         auth_enable: bool,
     ) -> QueryResult<PlanWithPrivileges> {
         let user_option = session.user().desc().options();
-        if auth_enable && user_option.must_change_password().is_some_and(|x| x) {
+        if auth_enable && user_option.need_change_password(now_timestamp_millis()) {
             match statement {
                 ExtStatement::AlterUser(stmt) => {
                     return self.alter_user_to_plan(stmt, session.user(), true).await
@@ -185,6 +195,11 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
                 }
             }
         }
+        if auth_enable {
+            if let Some(denied_statements) = user_option.denied_statements() {
+                check_denied_statement(&statement, denied_statements)?;
+            }
+        }
         match statement {
             ExtStatement::SqlStatement(stmt) => self.df_sql_to_plan(*stmt, session).await,
             ExtStatement::CreateExternalTable(stmt) => self.external_table_to_plan(stmt, session),
@@ -193,6 +208,9 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
             ExtStatement::CreateTenant(stmt) => self.create_tenant_to_plan(stmt),
             ExtStatement::CreateUser(stmt) => self.create_user_to_plan(stmt),
             ExtStatement::CreateRole(stmt) => self.create_role_to_plan(stmt, session),
+            ExtStatement::CreateMaterializedView(stmt) => {
+                self.create_materialized_view_to_plan(stmt, session)
+            }
             ExtStatement::DropDatabaseObject(s) => self.drop_database_object_to_plan(s, session),
             ExtStatement::DropTenantObject(s) => self.drop_tenant_object_to_plan(s, session),
             ExtStatement::DropGlobalObject(s) => self.drop_global_object_to_plan(s),
@@ -202,6 +220,9 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
             ExtStatement::ShowTables(stmt) => self.show_tables_to_plan(stmt, session),
             ExtStatement::AlterDatabase(stmt) => self.database_to_alter(*stmt, session),
             ExtStatement::ShowSeries(stmt) => self.show_series_to_plan(*stmt, session),
+            ExtStatement::ShowSeriesCardinality(stmt) => {
+                self.show_series_cardinality_to_plan(stmt, session)
+            }
             ExtStatement::Explain(stmt) => {
                 self.explain_statement_to_plan(
                     stmt.analyze,
@@ -218,14 +239,18 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
             ExtStatement::AlterUser(stmt) => {
                 self.alter_user_to_plan(stmt, session.user(), false).await
             }
+            ExtStatement::SetRuntimeLimit(stmt) => self.set_runtime_limit_to_plan(stmt),
             ExtStatement::GrantRevoke(stmt) => self.grant_revoke_to_plan(stmt, session),
             ExtStatement::ShowQueries => self.show_queries_to_plan(session),
+            ExtStatement::ShowUsers => self.show_users_to_plan(),
+            ExtStatement::ShowStatsDerivative => self.show_stats_derivative_to_plan(),
             ExtStatement::Copy(stmt) => self.copy_to_plan(stmt, session).await,
             ExtStatement::DropVnode(stmt) => self.drop_vnode_to_plan(stmt),
             ExtStatement::CopyVnode(stmt) => self.copy_vnode_to_plan(stmt),
             ExtStatement::MoveVnode(stmt) => self.move_vnode_to_plan(stmt),
             ExtStatement::CompactVnode(stmt) => self.compact_vnode_to_plan(stmt),
             ExtStatement::CompactDatabase(stmt) => self.compact_database_to_plan(stmt),
+            ExtStatement::SplitDatabase(stmt) => self.split_database_to_plan(stmt),
             ExtStatement::ChecksumGroup(stmt) => self.checksum_group_to_plan(stmt),
             ExtStatement::CreateStream(_) => Err(QueryError::NotImplemented {
                 err: "CreateStream Planner.".to_string(),
@@ -243,9 +268,12 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
             ExtStatement::RecoverDatabase(stmt) => self.recoverdatabase_to_plan(stmt, session),
             ExtStatement::ShowReplicas => self.show_replicas_to_plan(),
             ExtStatement::ReplicaDestory(stmt) => self.replica_destory_to_plan(stmt),
+            ExtStatement::ReplicaFreeze(stmt) => self.replica_freeze_to_plan(stmt),
+            ExtStatement::ReplicaRebuild(stmt) => self.replica_rebuild_to_plan(stmt),
             ExtStatement::ReplicaAdd(stmt) => self.replica_add_to_plan(stmt),
             ExtStatement::ReplicaRemove(stmt) => self.replica_remove_to_plan(stmt),
             ExtStatement::ReplicaPromote(stmt) => self.replica_promote_to_plan(stmt),
+            ExtStatement::DecommissionNode(stmt) => self.decommission_node_to_plan(stmt),
         }
     }
 
@@ -621,14 +649,14 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         let tenant_id = *session.tenant_id();
 
         let (plan, privilege) = match obj_type {
-            DatabaseObjectType::Table => {
+            DatabaseObjectType::Table | DatabaseObjectType::MaterializedView => {
                 let table = object_name_to_resolved_table(session, object_name)?;
                 let database_name = table.database().to_string();
                 (
                     DDLPlan::DropDatabaseObject(DropDatabaseObject {
                         if_exist,
                         object_name: table,
-                        obj_type: DatabaseObjectType::Table,
+                        obj_type: obj_type.clone(),
                     }),
                     Privilege::TenantObject(
                         TenantObjectPrivilege::Database(
@@ -968,6 +996,50 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         })
     }
 
+    fn create_materialized_view_to_plan(
+        &self,
+        statement: ast::CreateMaterializedView,
+        session: &SessionCtx,
+    ) -> QueryResult<PlanWithPrivileges> {
+        let ast::CreateMaterializedView {
+            if_not_exists,
+            name,
+            query,
+        } = statement;
+        let resolved_table = object_name_to_resolved_table(session, name)?;
+        let database_name = resolved_table.database().to_string();
+        let unit: TimeUnit = self.get_db_precision(&database_name)?.into();
+
+        let df_plan = self
+            .df_planner
+            .sql_statement_to_plan(Statement::Query(query))?;
+        // the view is in the database of the table aggregated
+        let _ = self.schema_provider.reset_access_databases();
+        let (view, schema) = materialized_view_of_plan(
+            &df_plan,
+            &resolved_table,
+            unit,
+            session.user().desc().name(),
+        )?;
+
+        let plan = Plan::DDL(DDLPlan::CreateMaterializedView(CreateMaterializedView {
+            table: CreateTable {
+                schema,
+                name: resolved_table,
+                if_not_exists,
+            },
+            view,
+        }));
+
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::TenantObject(
+                TenantObjectPrivilege::Database(DatabasePrivilege::Full, Some(database_name)),
+                Some(*session.tenant_id()),
+            )],
+        })
+    }
+
     fn column_opt_to_table_column(
         &self,
         column_opt: ColumnOption,
@@ -1406,6 +1478,30 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         self.show_tag_body(session, stmt.body, show_series_projection)
     }
 
+    fn show_series_cardinality_to_plan(
+        &self,
+        stmt: ASTShowSeriesCardinality,
+        session: &SessionCtx,
+    ) -> QueryResult<PlanWithPrivileges> {
+        let database = stmt
+            .database_name
+            .map(normalize_ident)
+            .unwrap_or_else(|| session.default_database().to_string());
+        let table = stmt.table.map(normalize_ident);
+
+        let plan = Plan::DDL(DDLPlan::ShowSeriesCardinality(ShowSeriesCardinality {
+            database: database.clone(),
+            table,
+        }));
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::TenantObject(
+                TenantObjectPrivilege::Database(DatabasePrivilege::Read, Some(database)),
+                Some(*session.tenant_id()),
+            )],
+        })
+    }
+
     fn show_tag_values(
         &self,
         stmt: ASTShowTagValues,
@@ -1442,6 +1538,8 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
 
         let options = self.make_database_option(options)?;
         let config = self.make_database_config(config)?;
+        // only the system admin can place a database on the nodes
+        let has_placement = options.has_placement();
         let plan = Plan::DDL(DDLPlan::CreateDatabase(CreateDatabase {
             name,
             if_not_exists,
@@ -1450,14 +1548,14 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         }));
         // privileges
         let tenant_id = *session.tenant_id();
-        let privilege = Privilege::TenantObject(
+        let mut privileges = vec![Privilege::TenantObject(
             TenantObjectPrivilege::Database(DatabasePrivilege::Write, None),
             Some(tenant_id),
-        );
-        Ok(PlanWithPrivileges {
-            plan,
-            privileges: vec![privilege],
-        })
+        )];
+        if has_placement {
+            privileges.push(Privilege::Global(GlobalPrivilege::System));
+        }
+        Ok(PlanWithPrivileges { plan, privileges })
     }
 
     fn order_by(
@@ -1556,20 +1654,22 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         let ASTAlterDatabase { name, options } = stmt;
         let options = self.make_database_option(options)?;
         let database_name = normalize_ident(name);
+        // only the system admin can change the quotas and the placement of a database
+        let has_quota = options.has_quota() || options.has_placement();
         let plan = Plan::DDL(DDLPlan::AlterDatabase(AlterDatabase {
             database_name: database_name.clone(),
             database_options: options,
         }));
         // privileges
         let tenant_id = *session.tenant_id();
-        let privilege = Privilege::TenantObject(
+        let mut privileges = vec![Privilege::TenantObject(
             TenantObjectPrivilege::Database(DatabasePrivilege::Full, Some(database_name)),
             Some(tenant_id),
-        );
-        Ok(PlanWithPrivileges {
-            plan,
-            privileges: vec![privilege],
-        })
+        )];
+        if has_quota {
+            privileges.push(Privilege::Global(GlobalPrivilege::System));
+        }
+        Ok(PlanWithPrivileges { plan, privileges })
     }
 
     fn make_database_option(
@@ -1589,6 +1689,38 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         if let Some(vnode_duration) = options.vnode_duration {
             plan_options.with_vnode_duration(self.str_to_duration(&vnode_duration)?);
         }
+        if let Some(max_disk_size) = options.max_disk_size {
+            plan_options.with_max_disk_size(self.str_to_bytes(&max_disk_size)?);
+        }
+        if let Some(max_series) = options.max_series {
+            plan_options.with_max_series(max_series);
+        }
+        if let Some(max_writes_per_sec) = options.max_writes_per_sec {
+            plan_options.with_max_writes_per_sec(max_writes_per_sec);
+        }
+        if let Some(future_limit) = options.future_limit {
+            plan_options.with_future_limit(self.str_to_duration(&future_limit)?);
+        }
+        if let Some(past_limit) = options.past_limit {
+            plan_options.with_past_limit(self.str_to_duration(&past_limit)?);
+        }
+        if let Some(max_bucket_size) = options.max_bucket_size {
+            plan_options.with_max_bucket_size(self.str_to_bytes(&max_bucket_size)?);
+        }
+        if let Some(placement) = options.placement {
+            plan_options.with_placement(DatabasePlacement {
+                nodes: placement.nodes,
+                zone: placement.zone,
+                tags: placement.tags,
+            });
+        }
+        if let Some(ingest_rules) = options.ingest_rules {
+            plan_options.with_ingest_rules(IngestRules::from_str(&ingest_rules).map_err(|e| {
+                QueryError::Parser {
+                    source: ParserError::ParserError(e),
+                }
+            })?);
+        }
         Ok(plan_options)
     }
 
@@ -1988,7 +2120,9 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
                 let (mut sql_user_option, password) =
                     sql_options_to_user_options(vec![sql_option]).context(ParserSnafu)?;
                 let user_desc = user.desc();
-                if sql_user_option.must_change_password().is_some() {
+                if sql_user_option.must_change_password().is_some()
+                    || sql_user_option.password_max_age().is_some()
+                {
                     privileges = vec![Privilege::Global(GlobalPrivilege::System)];
                 }
 
@@ -2024,6 +2158,10 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
                     // 修改admin参数需要系统管理权限
                     privileges = vec![Privilege::Global(GlobalPrivilege::System)];
                 }
+                if sql_user_option.denied_statements().is_some() {
+                    // users can't lift the restrictions on themselves
+                    privileges = vec![Privilege::Global(GlobalPrivilege::System)];
+                }
                 AlterUserAction::Set(sql_user_option)
             }
         };
@@ -2148,6 +2286,16 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         })
     }
 
+    fn set_runtime_limit_to_plan(&self, stmt: SqlOption) -> QueryResult<PlanWithPrivileges> {
+        let limit = sql_option_to_runtime_limit(stmt)?;
+
+        let plan = Plan::DDL(DDLPlan::SetRuntimeLimit(SetRuntimeLimit { limit }));
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::Global(GlobalPrivilege::System)],
+        })
+    }
+
     fn compact_vnode_to_plan(&self, stmt: ASTCompactVnode) -> QueryResult<PlanWithPrivileges> {
         let ASTCompactVnode { vnode_ids } = stmt;
 
@@ -2191,6 +2339,40 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         })
     }
 
+    fn split_database_to_plan(&self, stmt: ASTSplitDatabase) -> QueryResult<PlanWithPrivileges> {
+        let ASTSplitDatabase { database_name } = stmt;
+
+        let database_name = normalize_ident(database_name);
+        let db = self
+            .schema_provider
+            .get_db_info(&database_name)
+            .context(MetaSnafu)?
+            .ok_or_else(|| QueryError::DatabaseNotFound {
+                name: database_name.clone(),
+            })?;
+
+        let vnode_duration = db
+            .schema
+            .options()
+            .vnode_duration()
+            .to_precision(*db.schema.config.precision());
+        let bucket_ids = db
+            .buckets
+            .iter()
+            .filter(|bucket| bucket.end_time.saturating_sub(bucket.start_time) > vnode_duration)
+            .map(|bucket| bucket.id)
+            .collect::<Vec<_>>();
+
+        let plan = Plan::DDL(DDLPlan::SplitBuckets(SplitBuckets {
+            database: database_name,
+            bucket_ids,
+        }));
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::Global(GlobalPrivilege::System)],
+        })
+    }
+
     fn checksum_group_to_plan(&self, stmt: ASTChecksumGroup) -> QueryResult<PlanWithPrivileges> {
         let ASTChecksumGroup { replication_set_id } = stmt;
 
@@ -2201,6 +2383,22 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         })
     }
 
+    fn show_users_to_plan(&self) -> QueryResult<PlanWithPrivileges> {
+        let plan = Plan::DDL(DDLPlan::ShowUsers);
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::Global(GlobalPrivilege::System)],
+        })
+    }
+
+    fn show_stats_derivative_to_plan(&self) -> QueryResult<PlanWithPrivileges> {
+        let plan = Plan::DDL(DDLPlan::ShowStatsDerivative);
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::Global(GlobalPrivilege::System)],
+        })
+    }
+
     fn show_replicas_to_plan(&self) -> QueryResult<PlanWithPrivileges> {
         let plan = Plan::DDL(DDLPlan::ShowReplicas);
         Ok(PlanWithPrivileges {
@@ -2219,6 +2417,16 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         })
     }
 
+    fn replica_freeze_to_plan(&self, stmt: ASTReplicaFreeze) -> QueryResult<PlanWithPrivileges> {
+        let ASTReplicaFreeze { replica_id, frozen } = stmt;
+
+        let plan = Plan::DDL(DDLPlan::ReplicaFreeze(ReplicaFreeze { replica_id, frozen }));
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::Global(GlobalPrivilege::System)],
+        })
+    }
+
     fn replica_add_to_plan(&self, stmt: ASTReplicaAdd) -> QueryResult<PlanWithPrivileges> {
         let ASTReplicaAdd {
             replica_id,
@@ -2251,6 +2459,22 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         })
     }
 
+    fn replica_rebuild_to_plan(&self, stmt: ASTReplicaRebuild) -> QueryResult<PlanWithPrivileges> {
+        let ASTReplicaRebuild {
+            replica_id,
+            node_id,
+        } = stmt;
+
+        let plan = Plan::DDL(DDLPlan::ReplicaRebuild(ReplicaRebuild {
+            replica_id,
+            node_id,
+        }));
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::Global(GlobalPrivilege::System)],
+        })
+    }
+
     fn replica_promote_to_plan(&self, stmt: ASTReplicaPromote) -> QueryResult<PlanWithPrivileges> {
         let ASTReplicaPromote {
             replica_id,
@@ -2267,6 +2491,25 @@ impl<'a, S: ContextProviderExtension + Send + Sync + 'a> SqlPlanner<'a, S> {
         })
     }
 
+    fn decommission_node_to_plan(
+        &self,
+        stmt: ASTDecommissionNode,
+    ) -> QueryResult<PlanWithPrivileges> {
+        let ASTDecommissionNode {
+            node_id,
+            replacement,
+        } = stmt;
+
+        let plan = Plan::DDL(DDLPlan::DecommissionNode(DecommissionNode {
+            node_id,
+            replacement,
+        }));
+        Ok(PlanWithPrivileges {
+            plan,
+            privileges: vec![Privilege::Global(GlobalPrivilege::System)],
+        })
+    }
+
     fn create_stream_table_to_plan(
         &self,
         stmt: Statement,
@@ -3005,6 +3248,78 @@ pub fn merge_object_name(db: Option<ObjectName>, table: Option<ObjectName>) -> O
 }
 
 // Normalize an identifier to a lowercase string unless the identifier is quoted.
+fn check_denied_statement(
+    statement: &ExtStatement,
+    denied_statements: &DeniedStatements,
+) -> QueryResult<()> {
+    match denied_statement_kind(statement) {
+        Some(kind) if denied_statements.contains(kind) => Err(QueryError::InsufficientPrivileges {
+            privilege: format!("{} statement, which is denied for the user", kind),
+        }),
+        _ => Ok(()),
+    }
+}
+
+fn denied_statement_kind(statement: &ExtStatement) -> Option<DeniedStatement> {
+    match statement {
+        ExtStatement::DropDatabaseObject(_)
+        | ExtStatement::DropTenantObject(_)
+        | ExtStatement::DropGlobalObject(_)
+        | ExtStatement::DropStream(_)
+        | ExtStatement::DropVnode(_) => Some(DeniedStatement::Drop),
+        ExtStatement::AlterTable(ASTAlterTable {
+            alter_action: ASTAlterTableAction::DropColumn { .. },
+            ..
+        }) => Some(DeniedStatement::Drop),
+        ExtStatement::SqlStatement(stmt) => match stmt.as_ref() {
+            Statement::Drop { .. } => Some(DeniedStatement::Drop),
+            Statement::Delete { .. } => Some(DeniedStatement::Delete),
+            Statement::Query(query) if is_unbounded_select(&query.body) => {
+                Some(DeniedStatement::UnboundedSelect)
+            }
+            _ => None,
+        },
+        _ => None,
+    }
+}
+
+/// Whether the query contains a `SELECT *` whose condition doesn't bound the time column.
+fn is_unbounded_select(body: &SetExpr) -> bool {
+    match body {
+        SetExpr::Select(select) => {
+            let is_wildcard = select.projection.iter().any(|e| {
+                matches!(
+                    e,
+                    SelectItem::Wildcard(_) | SelectItem::QualifiedWildcard(_, _)
+                )
+            });
+            is_wildcard && !select.selection.as_ref().is_some_and(bounds_time)
+        }
+        SetExpr::Query(query) => is_unbounded_select(&query.body),
+        SetExpr::SetOperation { left, right, .. } => {
+            is_unbounded_select(left) || is_unbounded_select(right)
+        }
+        _ => false,
+    }
+}
+
+fn bounds_time(expr: &ASTExpr) -> bool {
+    match expr {
+        ASTExpr::Identifier(ident) => normalize_ident(ident.clone()) == TIME_FIELD_NAME,
+        ASTExpr::CompoundIdentifier(idents) => idents
+            .last()
+            .is_some_and(|ident| normalize_ident(ident.clone()) == TIME_FIELD_NAME),
+        ASTExpr::BinaryOp { left, op, right } => match op {
+            BinaryOperator::Or => bounds_time(left) && bounds_time(right),
+            _ => bounds_time(left) || bounds_time(right),
+        },
+        ASTExpr::Nested(expr) | ASTExpr::Between { expr, .. } | ASTExpr::InList { expr, .. } => {
+            bounds_time(expr)
+        }
+        _ => false,
+    }
+}
+
 pub fn normalize_ident(id: Ident) -> String {
     match id.quote_style {
         Some(_) => id.value,
@@ -3072,6 +3387,178 @@ fn make_geometry_data_type(params: &[String]) -> std::result::Result<ColumnType,
 /// 合法性检查
 ///
 /// - 只能对tskv表执行delete操作
+/// The view of the aggregation planned and the columns of the table storing
+/// it. The aggregation groups a tskv table of the database of the view by
+/// `date_bin(<fixed interval>, time) AS time` and some tags selected as is,
+/// without filters, and the aggregates are `count`, `sum`, `min` and `max`
+/// of the fields or `count(*)`, each named by an alias.
+fn materialized_view_of_plan(
+    plan: &LogicalPlan,
+    name: &ResolvedTable,
+    unit: TimeUnit,
+    owner: &str,
+) -> QueryResult<(MaterializedView, Vec<TableColumn>)> {
+    let invalid = |reason: String| QueryError::Semantic {
+        err: format!("materialized view {} {}", name, reason),
+    };
+
+    let LogicalPlan::Projection(projection) = plan else {
+        return Err(invalid("must select an aggregation".to_string()));
+    };
+    let LogicalPlan::Aggregate(aggregate) = projection.input.as_ref() else {
+        return Err(invalid("must select an aggregation".to_string()));
+    };
+    let LogicalPlan::TableScan(scan) = aggregate.input.as_ref() else {
+        return Err(invalid(
+            "must aggregate a table without filters or joins".to_string(),
+        ));
+    };
+    let adapter = source_downcast_adapter(&scan.source)?;
+    let TableHandle::Tskv(table) = adapter.table_handle() else {
+        return Err(invalid("must aggregate a tskv table".to_string()));
+    };
+    if adapter.database_name() != name.database() {
+        return Err(invalid(format!(
+            "must aggregate a table of database {}",
+            name.database()
+        )));
+    }
+    let source = table.table_schema();
+
+    let fields = aggregate.schema.fields();
+    if projection.expr.len() != fields.len() {
+        return Err(invalid(
+            "must select each group and aggregate once".to_string(),
+        ));
+    }
+    // the alias selected of the output of the aggregation
+    let alias = |field: &DFField| {
+        let column = field.qualified_column();
+        projection.expr.iter().find_map(|expr| match expr {
+            Expr::Alias(expr, alias) if matches!(expr.as_ref(), Expr::Column(c) if c == &column) => {
+                Some(alias.as_str())
+            }
+            _ => None,
+        })
+    };
+    let output_name = |field: &DFField| {
+        let column = field.qualified_column();
+        alias(field).or_else(|| {
+            projection
+                .expr
+                .iter()
+                .any(|expr| matches!(expr, Expr::Column(c) if c == &column))
+                .then(|| field.name().as_str())
+        })
+    };
+    let (group_fields, aggr_fields) = fields.split_at(aggregate.group_expr.len());
+
+    let mut interval = None;
+    let mut tags = vec![];
+    for (expr, field) in aggregate.group_expr.iter().zip(group_fields) {
+        let output = output_name(field);
+        match expr {
+            Expr::Column(c)
+                if source
+                    .column(&c.name)
+                    .is_some_and(|c| c.column_type.is_tag()) =>
+            {
+                if output != Some(c.name.as_str()) {
+                    return Err(invalid(format!("must select the tag {} as is", c.name)));
+                }
+                tags.push(c.name.clone());
+            }
+            _ => match time_bucket(expr) {
+                Some(nanos) if interval.is_none() && output == Some(TIME_FIELD_NAME) => {
+                    interval = Some(nanos)
+                }
+                _ => {
+                    return Err(invalid(format!(
+                        "must be grouped by the tags and date_bin(..) AS time, not {}",
+                        expr
+                    )))
+                }
+            },
+        }
+    }
+    let Some(interval) = interval else {
+        return Err(invalid(
+            "must be grouped by date_bin(<interval>, time) AS time".to_string(),
+        ));
+    };
+
+    let id_generator = SeqIdGenerator::default();
+    let mut schema = vec![TableColumn::new_time_column(
+        id_generator.next_id() as ColumnId,
+        unit,
+    )];
+    for tag in &tags {
+        schema.push(TableColumn::new_tag_column(
+            id_generator.next_id() as ColumnId,
+            tag.clone(),
+        ));
+    }
+    let mut aggregates = vec![];
+    for (expr, field) in aggregate.aggr_expr.iter().zip(aggr_fields) {
+        let Some((func, field_name)) = view_aggregate(expr) else {
+            return Err(invalid(format!(
+                "only supports count, sum, min and max, not {}",
+                expr
+            )));
+        };
+        let column = alias(field)
+            .ok_or_else(|| invalid(format!("must name the aggregate {} by an alias", expr)))?;
+
+        let value_type = match field_name {
+            // count(*)
+            None => ValueType::Integer,
+            Some(field_name) => {
+                let value_type = match source.column(field_name).map(|c| &c.column_type) {
+                    Some(ColumnType::Field(value_type)) => *value_type,
+                    _ => {
+                        return Err(invalid(format!(
+                            "must aggregate the fields, {} is not a field of {}",
+                            field_name, source.name
+                        )))
+                    }
+                };
+                match (func, value_type) {
+                    (ViewAggregateFunction::Count, _) => ValueType::Integer,
+                    (_, ValueType::Float | ValueType::Integer | ValueType::Unsigned) => value_type,
+                    _ => {
+                        return Err(invalid(format!(
+                            "can't {} the field {}, which is not numeric",
+                            func, field_name
+                        )))
+                    }
+                }
+            }
+        };
+        schema.push(TableColumn::new(
+            id_generator.next_id() as ColumnId,
+            column.to_string(),
+            ColumnType::Field(value_type),
+            Encoding::Default,
+        ));
+        aggregates.push(ViewAggregate {
+            func,
+            field: field_name.map(|f| f.to_string()),
+            column: column.to_string(),
+        });
+    }
+
+    let view = MaterializedView {
+        name: name.table().to_string(),
+        source: source.name.clone(),
+        interval,
+        tags,
+        aggregates,
+        owner: owner.to_string(),
+        stale: vec![],
+    };
+    Ok((view, schema))
+}
+
 /// - 过滤条件中不能包含field列
 fn valid_delete(schema: &TskvTableSchema, selection: &Option<Expr>) -> QueryResult<()> {
     if let Some(expr) = selection {
@@ -3117,6 +3604,7 @@ mod tests {
     use datafusion::sql::TableReference;
     use lazy_static::__Deref;
     use meta::error::MetaError;
+    use meta::model::meta_tenant::TenantMeta;
     use models::auth::user::{User, UserDesc, UserOptions};
     use models::codec::Encoding;
     use models::meta_data::DatabaseInfo;
@@ -3126,6 +3614,8 @@ mod tests {
     use utils::precision::Precision;
 
     use super::*;
+    use crate::data_source::batch::tskv::ClusterTable;
+    use crate::data_source::split;
     use crate::data_source::table_source::TableSourceAdapter;
     use crate::extension::logical::plan_node::table_writer::TableWriterPlanNode;
     use crate::metadata::ContextProviderExtension;
@@ -3160,6 +3650,14 @@ mod tests {
             &self,
             name: TableReference,
         ) -> datafusion::common::Result<Arc<TableSourceAdapter>> {
+            if name.table() == "cpu" {
+                return Ok(Arc::new(TableSourceAdapter::try_new(
+                    name.to_owned_reference(),
+                    "public",
+                    name.table(),
+                    cpu_table(),
+                )?));
+            }
             let schema = match name.table() {
                 "test_tb" => Ok(Schema::new(vec![
                     Field::new("field_int", DataType::Int32, false),
@@ -3185,6 +3683,9 @@ mod tests {
 
     impl ContextProvider for MockContext {
         fn get_table_provider(&self, name: TableReference) -> Result<Arc<dyn TableSource>> {
+            if name.table() == "cpu" {
+                return Ok(ContextProviderExtension::get_table_source(self, name)?);
+            }
             let schema = match name.table() {
                 "test_tb" => Ok(Schema::new(vec![
                     Field::new("field_int", DataType::Int32, false),
@@ -3201,11 +3702,11 @@ mod tests {
         }
 
         fn get_function_meta(&self, _name: &str) -> Option<Arc<ScalarUDF>> {
-            unimplemented!()
+            None
         }
 
         fn get_aggregate_meta(&self, _name: &str) -> Option<Arc<AggregateUDF>> {
-            unimplemented!()
+            None
         }
 
         fn get_variable_type(&self, _: &[String]) -> Option<DataType> {
@@ -3221,6 +3722,35 @@ mod tests {
         }
     }
 
+    // cpu(time, host tag, usage double, status string)
+    fn cpu_table() -> Arc<ClusterTable> {
+        let mut schema = TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            "cpu".to_string(),
+            vec![],
+        );
+        schema.add_column(TableColumn::new_time_column(0, TimeUnit::Nanosecond));
+        schema.add_column(TableColumn::new_with_default(
+            "host".to_string(),
+            ColumnType::Tag,
+        ));
+        schema.add_column(TableColumn::new_with_default(
+            "usage".to_string(),
+            ColumnType::Field(ValueType::Float),
+        ));
+        schema.add_column(TableColumn::new_with_default(
+            "status".to_string(),
+            ColumnType::Field(ValueType::String),
+        ));
+        Arc::new(ClusterTable::new(
+            Arc::new(MockCoordinator {}),
+            split::default_split_manager_ref_only_for_test(),
+            Arc::new(TenantMeta::mock()),
+            Arc::new(schema),
+        ))
+    }
+
     struct TestTable {
         table_schema: SchemaRef,
     }
@@ -3307,6 +3837,91 @@ mod tests {
         }
     }
 
+    async fn plan_sql(sql: &str) -> QueryResult<Plan> {
+        let mut statements = ExtParser::parse_sql(sql).unwrap();
+        let test = MockContext {};
+        let planner = SqlPlanner::new(&test);
+        planner
+            .statement_to_plan(statements.pop_back().unwrap(), &session(), false)
+            .await
+            .map(|plan| plan.plan)
+    }
+
+    #[tokio::test]
+    async fn test_create_materialized_view() {
+        let sql = "CREATE MATERIALIZED VIEW cpu_1m AS \
+            SELECT date_bin(INTERVAL '1 minute', time) AS time, host, \
+            count(*) AS cnt, max(usage) AS max_usage \
+            FROM cpu GROUP BY date_bin(INTERVAL '1 minute', time), host";
+        let Plan::DDL(DDLPlan::CreateMaterializedView(create)) = plan_sql(sql).await.unwrap()
+        else {
+            panic!("expected create materialized view plan")
+        };
+        assert_eq!(
+            create.view,
+            MaterializedView {
+                name: "cpu_1m".to_string(),
+                source: "cpu".to_string(),
+                interval: 60_000_000_000,
+                tags: vec!["host".to_string()],
+                aggregates: vec![
+                    ViewAggregate {
+                        func: ViewAggregateFunction::Count,
+                        field: None,
+                        column: "cnt".to_string(),
+                    },
+                    ViewAggregate {
+                        func: ViewAggregateFunction::Max,
+                        field: Some("usage".to_string()),
+                        column: "max_usage".to_string(),
+                    },
+                ],
+                owner: "test_name".to_string(),
+                stale: vec![],
+            }
+        );
+        let columns = create
+            .table
+            .schema
+            .iter()
+            .map(|column| (column.name.as_str(), column.column_type.clone()))
+            .collect::<Vec<_>>();
+        assert_eq!(
+            columns,
+            vec![
+                ("time", ColumnType::Time(TimeUnit::Nanosecond)),
+                ("host", ColumnType::Tag),
+                ("cnt", ColumnType::Field(ValueType::Integer)),
+                ("max_usage", ColumnType::Field(ValueType::Float)),
+            ]
+        );
+
+        let invalid = [
+            // not aliased
+            "CREATE MATERIALIZED VIEW v AS SELECT date_bin(INTERVAL '1 minute', time) AS time, \
+                max(usage) FROM cpu GROUP BY date_bin(INTERVAL '1 minute', time)",
+            // filtered
+            "CREATE MATERIALIZED VIEW v AS SELECT date_bin(INTERVAL '1 minute', time) AS time, \
+                max(usage) AS m FROM cpu WHERE host = 'a' \
+                GROUP BY date_bin(INTERVAL '1 minute', time)",
+            // not mergeable
+            "CREATE MATERIALIZED VIEW v AS SELECT date_bin(INTERVAL '1 minute', time) AS time, \
+                avg(usage) AS a FROM cpu GROUP BY date_bin(INTERVAL '1 minute', time)",
+            // not numeric
+            "CREATE MATERIALIZED VIEW v AS SELECT date_bin(INTERVAL '1 minute', time) AS time, \
+                max(status) AS m FROM cpu GROUP BY date_bin(INTERVAL '1 minute', time)",
+            // not bucketed by time
+            "CREATE MATERIALIZED VIEW v AS SELECT host, max(usage) AS m FROM cpu GROUP BY host",
+            // grouped by a field
+            "CREATE MATERIALIZED VIEW v AS SELECT date_bin(INTERVAL '1 minute', time) AS time, \
+                status, max(usage) AS m FROM cpu \
+                GROUP BY date_bin(INTERVAL '1 minute', time), status",
+        ];
+        for sql in invalid {
+            assert!(plan_sql(sql).await.is_err(), "{}", sql);
+        }
+    }
+
     #[tokio::test]
     async fn test_create_table() {
         let sql = "CREATE TABLE IF NOT EXISTS default_schema.test\
@@ -3551,4 +4166,50 @@ mod tests {
             _ => panic!(),
         }
     }
+
+    #[test]
+    fn test_denied_statement_kind() {
+        let cases = [
+            ("drop table test_tb", Some(DeniedStatement::Drop)),
+            ("drop database test_db", Some(DeniedStatement::Drop)),
+            (
+                "alter table test_tb drop column_a",
+                Some(DeniedStatement::Drop),
+            ),
+            (
+                "delete from test_tb where time < 100",
+                Some(DeniedStatement::Delete),
+            ),
+            (
+                "select * from test_tb",
+                Some(DeniedStatement::UnboundedSelect),
+            ),
+            (
+                "select * from test_tb where column_a = 1 or time > 100",
+                Some(DeniedStatement::UnboundedSelect),
+            ),
+            (
+                "select * from test_tb where time > 100 and column_a = 1",
+                None,
+            ),
+            ("select * from test_tb where time between 1 and 100", None),
+            ("select column_a from test_tb", None),
+            ("show databases", None),
+        ];
+        for (sql, expected) in cases {
+            let mut statements = ExtParser::parse_sql(sql).unwrap();
+            let statement = statements.pop_back().unwrap();
+            assert_eq!(denied_statement_kind(&statement), expected, "{}", sql);
+        }
+
+        let denied_statements = DeniedStatements::from_str("drop,delete").unwrap();
+        let mut statements = ExtParser::parse_sql("drop table test_tb").unwrap();
+        assert!(
+            check_denied_statement(&statements.pop_back().unwrap(), &denied_statements).is_err()
+        );
+        let mut statements = ExtParser::parse_sql("select * from test_tb").unwrap();
+        assert!(
+            check_denied_statement(&statements.pop_back().unwrap(), &denied_statements).is_ok()
+        );
+    }
 }
@@ -590,6 +590,18 @@ pub enum QueryError {
     Models {
         source: ModelError,
     },
+
+    #[snafu(display("Invalid PromQL: {}", reason))]
+    #[error_code(code = 80)]
+    InvalidPromQL {
+        reason: String,
+    },
+
+    #[snafu(display("Failed to evaluate PromQL: {}", reason))]
+    #[error_code(code = 81)]
+    PromQLEvaluation {
+        reason: String,
+    },
 }
 
 impl From<DataFusionError> for QueryError {
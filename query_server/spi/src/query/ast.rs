@@ -2,8 +2,8 @@ use std::fmt;
 
 use datafusion::sql::parser::CreateExternalTable;
 use datafusion::sql::sqlparser::ast::{
-    AnalyzeFormat, DataType, Expr, Ident, ObjectName, Offset, OrderByExpr, SqlOption, Statement,
-    TableFactor, Value,
+    AnalyzeFormat, DataType, Expr, Ident, ObjectName, Offset, OrderByExpr, Query, SqlOption,
+    Statement, TableFactor, Value,
 };
 use datafusion::sql::sqlparser::parser::ParserError;
 use models::codec::Encoding;
@@ -27,6 +27,7 @@ pub enum ExtStatement {
     CreateTenant(CreateTenant),
     CreateUser(CreateUser),
     CreateRole(CreateRole),
+    CreateMaterializedView(CreateMaterializedView),
 
     CreateStream(CreateStream),
     DropStream(DropStream),
@@ -43,15 +44,19 @@ pub enum ExtStatement {
     ShowDatabases(),
     ShowTables(Option<Ident>),
     ShowSeries(Box<ShowSeries>),
+    ShowSeriesCardinality(ShowSeriesCardinality),
     ShowTagValues(Box<ShowTagValues>),
     Explain(Explain),
 
     // system cmd
     ShowQueries,
+    ShowUsers,
+    ShowStatsDerivative,
     AlterDatabase(Box<AlterDatabase>),
     AlterTable(AlterTable),
     AlterTenant(AlterTenant),
     AlterUser(AlterUser),
+    SetRuntimeLimit(SqlOption),
 
     // vnode cmd
     DropVnode(DropVnode),
@@ -59,6 +64,7 @@ pub enum ExtStatement {
     MoveVnode(MoveVnode),
     CompactVnode(CompactVnode),
     CompactDatabase(CompactDatabase),
+    SplitDatabase(SplitDatabase),
     ChecksumGroup(ChecksumGroup),
 
     // recover cmd
@@ -71,6 +77,11 @@ pub enum ExtStatement {
     ReplicaAdd(ReplicaAdd),
     ReplicaRemove(ReplicaRemove),
     ReplicaPromote(ReplicaPromote),
+    ReplicaFreeze(ReplicaFreeze),
+    ReplicaRebuild(ReplicaRebuild),
+
+    // node cmd
+    DecommissionNode(DecommissionNode),
 }
 
 #[derive(Debug, Clone, PartialEq, Eq)]
@@ -96,6 +107,24 @@ pub struct ReplicaPromote {
     pub node_id: NodeId,
 }
 
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ReplicaRebuild {
+    pub replica_id: ReplicationSetId,
+    pub node_id: NodeId,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ReplicaFreeze {
+    pub replica_id: ReplicationSetId,
+    pub frozen: bool,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DecommissionNode {
+    pub node_id: NodeId,
+    pub replacement: Option<NodeId>,
+}
+
 #[derive(Debug, Clone, PartialEq, Eq)]
 pub struct ChecksumGroup {
     pub replication_set_id: ReplicationSetId,
@@ -111,6 +140,11 @@ pub struct CompactDatabase {
     pub database_name: Ident,
 }
 
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SplitDatabase {
+    pub database_name: Ident,
+}
+
 #[derive(Debug, Clone, PartialEq, Eq)]
 pub struct MoveVnode {
     pub vnode_id: VnodeId,
@@ -217,6 +251,14 @@ pub enum AlterTenantOperation {
     UnSet(Ident),
 }
 
+/// CREATE MATERIALIZED VIEW [IF NOT EXISTS] name AS query
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CreateMaterializedView {
+    pub if_not_exists: bool,
+    pub name: ObjectName,
+    pub query: Box<Query>,
+}
+
 #[derive(Debug, Clone, PartialEq, Eq)]
 pub struct DropDatabaseObject {
     pub object_name: ObjectName,
@@ -370,6 +412,27 @@ pub struct DatabaseOptions {
     // shard coverage time range
     pub vnode_duration: Option<String>,
     pub replica: Option<u64>,
+    // quotas
+    pub max_disk_size: Option<String>,
+    pub max_series: Option<u64>,
+    pub max_writes_per_sec: Option<u64>,
+    // bounds of written timestamp relative to now
+    pub future_limit: Option<String>,
+    pub past_limit: Option<String>,
+    // target max size of a bucket
+    pub max_bucket_size: Option<String>,
+    // rules to rewrite the written points
+    pub ingest_rules: Option<String>,
+    // the nodes to place the data on
+    pub placement: Option<DatabasePlacement>,
+}
+
+/// ON [NODES (id, ...)] [ZONE 'zone'] [TAGS ('tag', ...)]
+#[derive(Default, Debug, Clone, PartialEq, Eq)]
+pub struct DatabasePlacement {
+    pub nodes: Vec<u64>,
+    pub zone: Option<String>,
+    pub tags: Vec<String>,
 }
 
 #[derive(Default, Debug, Clone, PartialEq, Eq)]
@@ -431,6 +494,13 @@ pub struct ShowSeries {
     pub body: ShowTagBody,
 }
 
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+pub struct ShowSeriesCardinality {
+    pub database_name: Option<Ident>,
+    // all the tables of the database if not set
+    pub table: Option<Ident>,
+}
+
 #[derive(Debug, Clone, PartialEq, Eq, Hash)]
 pub enum With {
     Equal(Ident),
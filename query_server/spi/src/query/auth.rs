@@ -13,5 +13,11 @@ pub type AccessControlRef = Arc<dyn AccessControl + Send + Sync>;
 pub trait AccessControl {
     async fn access_check(&self, user_info: &UserInfo, tenant_name: &str) -> Result<User>;
 
+    /// Checks the session of a user authenticated before is still valid, e.g.
+    /// not revoked by a logout, as the authenticated users are cached.
+    async fn verify_session(&self, _user_info: &UserInfo) -> Result<()> {
+        Ok(())
+    }
+
     async fn tenant_id(&self, tenant_name: &str) -> Result<Oid>;
 }
@@ -1,6 +1,13 @@
 use std::str::FromStr;
+use std::sync::Mutex;
 use std::time::Duration;
 
+use models::consistency_level::WriteToken;
+use models::meta_data::ReplicationSetId;
+use models::predicate::series_cursor::SeriesCursor;
+use models::predicate::SeriesRange;
+use models::SeriesId;
+
 #[derive(Debug, Clone, PartialEq)]
 pub enum StreamTriggerInterval {
     Once,
@@ -74,6 +81,77 @@ impl FromStr for StreamTriggerInterval {
     }
 }
 
+/// Whether the queries of the session can scan a time range larger than
+/// `query.max_query_time_range`.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct UnboundedTimeRange(pub bool);
+
+/// The token of the writes passed by the session, the queries read the
+/// replication sets written from the vnodes acknowledged the writes.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct ReadYourWrites(pub WriteToken);
+
+/// The number of points the queries of the session should return at most
+/// per series, the intervals of the time buckets are widened to fit the time
+/// range of the query in it.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct MaxPoints(pub u64);
+
+/// Whether the cross joins of the tables of the session are rewritten into
+/// inner joins on the time and the shared tags, see the `AlignSeries` rule.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct SeriesAlignment(pub bool);
+
+/// Whether the `INSERT INTO ... SELECT` of the session runs as an
+/// asynchronous job, the id of the job is returned at once and its progress
+/// is shown in `information_schema.queries`.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct AsyncJob(pub bool);
+
+/// The series cursor passed by the session, the queries selecting more
+/// series than `query.max_select_series` return a page of the series
+/// instead of being rejected.
+#[derive(Debug, Default)]
+pub struct SeriesPaging {
+    cursor: SeriesCursor,
+    // the cursor of the next page, and whether there are series left
+    next: Mutex<(SeriesCursor, bool)>,
+}
+
+impl SeriesPaging {
+    pub fn new(cursor: SeriesCursor) -> Self {
+        Self {
+            next: Mutex::new((cursor.clone(), false)),
+            cursor,
+        }
+    }
+
+    /// The last series id of the shard read by the former pages.
+    pub fn after(&self, table: &str, replica_id: ReplicationSetId) -> Option<SeriesId> {
+        self.cursor.after(table, replica_id)
+    }
+
+    /// Splits the page of the series of the table, see [`SeriesCursor::page`].
+    pub fn page(
+        &self,
+        table: &str,
+        series: &[(ReplicationSetId, Vec<SeriesId>)],
+        max_series: usize,
+    ) -> Vec<SeriesRange> {
+        let (ranges, has_more) = self.cursor.page(table, series, max_series);
+        let mut next = self.next.lock().unwrap();
+        next.0.advance(table, series, &ranges);
+        next.1 |= has_more;
+        ranges
+    }
+
+    /// The cursor of the next page, `None` if it's the last page.
+    pub fn next_cursor(&self) -> Option<SeriesCursor> {
+        let next = self.next.lock().unwrap();
+        next.1.then(|| next.0.clone())
+    }
+}
+
 #[cfg(test)]
 mod test {
     use std::str::FromStr;
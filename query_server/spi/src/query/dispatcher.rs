@@ -65,6 +65,7 @@ pub struct QueryStatus {
     duration: Duration,
     processed_count: u64,
     error_count: u64,
+    estimated_count: Option<u64>,
 }
 
 impl QueryStatus {
@@ -74,6 +75,7 @@ impl QueryStatus {
             duration,
             processed_count: 0,
             error_count: 0,
+            estimated_count: None,
         }
     }
 
@@ -92,6 +94,11 @@ impl QueryStatus {
     pub fn error_count(&self) -> u64 {
         self.error_count
     }
+
+    /// The estimated count to process, `None` if unknown.
+    pub fn estimated_count(&self) -> Option<u64> {
+        self.estimated_count
+    }
 }
 
 pub struct QueryStatusBuilder {
@@ -99,6 +106,7 @@ pub struct QueryStatusBuilder {
     duration: Duration,
     processed_count: u64,
     error_count: u64,
+    estimated_count: Option<u64>,
 }
 
 impl QueryStatusBuilder {
@@ -108,6 +116,7 @@ impl QueryStatusBuilder {
             duration,
             processed_count: 0,
             error_count: 0,
+            estimated_count: None,
         }
     }
 
@@ -121,12 +130,18 @@ impl QueryStatusBuilder {
         self
     }
 
+    pub fn with_estimated_count(mut self, estimated_count: Option<u64>) -> Self {
+        self.estimated_count = estimated_count;
+        self
+    }
+
     pub fn build(self) -> QueryStatus {
         QueryStatus {
             state: self.state,
             duration: self.duration,
             processed_count: self.processed_count,
             error_count: self.error_count,
+            estimated_count: self.estimated_count,
         }
     }
 }
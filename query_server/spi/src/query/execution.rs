@@ -34,6 +34,7 @@ pub type QueryExecutionRef = Arc<dyn QueryExecution>;
 pub enum QueryType {
     Batch,
     Stream,
+    Job,
 }
 
 impl Display for QueryType {
@@ -41,6 +42,7 @@ impl Display for QueryType {
         match self {
             Self::Batch => write!(f, "batch"),
             Self::Stream => write!(f, "stream"),
+            Self::Job => write!(f, "job"),
         }
     }
 }
@@ -212,11 +214,12 @@ impl QueryStateMachine {
     /// only for test
     pub fn test(query: Query, span_context: Option<SpanContext>) -> Self {
         use coordinator::service_mock::MockCoordinator;
+        use datafusion::execution::disk_manager::DiskManagerConfig;
         use datafusion::execution::memory_pool::UnboundedMemoryPool;
 
         use super::session::SessionCtxFactory;
 
-        let factory = SessionCtxFactory::new(None, "/tmp".into(), None);
+        let factory = SessionCtxFactory::new(None, "/tmp".into(), None, DiskManagerConfig::NewOs);
         let ctx = query.context().clone();
         QueryStateMachine::begin(
             QueryId::next_id(),
@@ -1,5 +1,6 @@
 use std::collections::HashMap;
 use std::io::Write;
+use std::str::FromStr;
 use std::sync::Arc;
 
 use async_trait::async_trait;
@@ -21,11 +22,12 @@ use datafusion::sql::sqlparser::parser::ParserError;
 use lazy_static::lazy_static;
 use models::auth::privilege::{DatabasePrivilege, GlobalPrivilege, Privilege};
 use models::auth::role::{SystemTenantRole, TenantRoleIdentifier};
-use models::auth::user::{UserOptions, UserOptionsBuilder};
-use models::meta_data::{NodeId, ReplicationSetId, VnodeId};
+use models::auth::user::{DeniedStatements, UserOptions, UserOptionsBuilder};
+use models::meta_data::{NodeId, ReplicationSetId, RuntimeLimit, VnodeId};
 use models::object_reference::ResolvedTable;
 use models::oid::{Identifier, Oid};
 use models::schema::database_schema::{DatabaseConfigBuilder, DatabaseOptionsBuilder};
+use models::schema::materialized_view::MaterializedView;
 use models::schema::query_info::QueryId;
 use models::schema::stream_table_schema::Watermark;
 use models::schema::tenant::{Tenant, TenantOptions, TenantOptionsBuilder};
@@ -51,6 +53,9 @@ pub const TENANT_OPTION_LIMITER: &str = "_limiter";
 pub const TENANT_OPTION_COMMENT: &str = "comment";
 pub const TENANT_OPTION_DROP_AFTER: &str = "drop_after";
 
+pub const RUNTIME_LIMIT_MAX_CONCURRENT_QUERIES: &str = "max_concurrent_queries";
+pub const RUNTIME_LIMIT_WRITE_TIMEOUT: &str = "write_timeout";
+
 lazy_static! {
     static ref TABLE_WRITE_UDF: Arc<ScalarUDF> = Arc::new(ScalarUDF::new(
         "rows",
@@ -126,6 +131,8 @@ pub enum DDLPlan {
 
     CreateTable(CreateTable),
 
+    CreateMaterializedView(CreateMaterializedView),
+
     CreateStreamTable(CreateStreamTable),
 
     CreateDatabase(CreateDatabase),
@@ -144,6 +151,12 @@ pub enum DDLPlan {
 
     AlterUser(AlterUser),
 
+    ShowUsers,
+
+    ShowStatsDerivative,
+
+    SetRuntimeLimit(SetRuntimeLimit),
+
     GrantRevoke(GrantRevoke),
 
     DropVnode(DropVnode),
@@ -154,6 +167,8 @@ pub enum DDLPlan {
 
     CompactVnode(CompactVnode),
 
+    SplitBuckets(SplitBuckets),
+
     ChecksumGroup(ChecksumGroup),
 
     RecoverDatabase(RecoverDatabase),
@@ -162,6 +177,8 @@ pub enum DDLPlan {
 
     ShowReplicas,
 
+    ShowSeriesCardinality(ShowSeriesCardinality),
+
     ReplicaDestory(ReplicaDestory),
 
     ReplicaAdd(ReplicaAdd),
@@ -169,6 +186,12 @@ pub enum DDLPlan {
     ReplicaRemove(ReplicaRemove),
 
     ReplicaPromote(ReplicaPromote),
+
+    ReplicaFreeze(ReplicaFreeze),
+
+    ReplicaRebuild(ReplicaRebuild),
+
+    DecommissionNode(DecommissionNode),
 }
 
 impl DDLPlan {
@@ -178,21 +201,50 @@ impl DDLPlan {
                 Field::new("vnode_id", DataType::UInt32, false),
                 Field::new("check_sum", DataType::Utf8, false),
             ])),
+            DDLPlan::ShowSeriesCardinality(_) => Arc::new(Schema::new(vec![
+                Field::new("table_name", DataType::Utf8, false),
+                Field::new("series_cardinality", DataType::UInt64, false),
+                Field::new("complete", DataType::Boolean, false),
+            ])),
+            DDLPlan::ShowStatsDerivative => Arc::new(Schema::new(vec![
+                Field::new("name", DataType::Utf8, false),
+                Field::new("labels", DataType::Utf8, false),
+                Field::new("value", DataType::Float64, false),
+                Field::new("rate", DataType::Float64, false),
+            ])),
             _ => Arc::new(Schema::empty()),
         }
     }
 }
 
+#[derive(Debug, Clone)]
+pub struct ShowSeriesCardinality {
+    pub database: String,
+    // all the tables of the database if not set
+    pub table: Option<String>,
+}
+
 #[derive(Debug, Clone)]
 pub struct ChecksumGroup {
     pub replication_set_id: ReplicationSetId,
 }
 
+#[derive(Debug, Clone)]
+pub struct SetRuntimeLimit {
+    pub limit: RuntimeLimit,
+}
+
 #[derive(Debug, Clone)]
 pub struct CompactVnode {
     pub vnode_ids: Vec<VnodeId>,
 }
 
+#[derive(Debug, Clone)]
+pub struct SplitBuckets {
+    pub database: String,
+    pub bucket_ids: Vec<u32>,
+}
+
 #[derive(Debug, Clone)]
 pub struct MoveVnode {
     pub vnode_id: VnodeId,
@@ -253,6 +305,7 @@ pub struct DropDatabaseObject {
 #[derive(Debug, Clone, PartialEq, Eq)]
 pub enum DatabaseObjectType {
     Table,
+    MaterializedView,
 }
 
 #[derive(Debug, Clone)]
@@ -321,6 +374,13 @@ pub struct CreateTable {
     pub if_not_exists: bool,
 }
 
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CreateMaterializedView {
+    /// The table storing the view, named after the view
+    pub table: CreateTable,
+    pub view: MaterializedView,
+}
+
 #[derive(Debug, Clone, PartialEq, Eq)]
 pub struct CreateStreamTable {
     /// Option to not error if table already exists
@@ -374,6 +434,25 @@ pub struct ReplicaPromote {
     pub node_id: NodeId,
 }
 
+#[derive(Debug, Clone)]
+pub struct ReplicaRebuild {
+    pub replica_id: ReplicationSetId,
+    pub node_id: NodeId,
+}
+
+#[derive(Debug, Clone)]
+pub struct ReplicaFreeze {
+    pub replica_id: ReplicationSetId,
+    pub frozen: bool,
+}
+
+#[derive(Debug, Clone)]
+pub struct DecommissionNode {
+    pub node_id: NodeId,
+    /// move the vnodes to this node instead of spreading them
+    pub replacement: Option<NodeId>,
+}
+
 pub fn unset_option_to_alter_tenant_action(
     tenant: Tenant,
     ident: Ident,
@@ -459,6 +538,49 @@ pub fn sql_option_to_alter_tenant_action(
     ))
 }
 
+pub fn sql_option_to_runtime_limit(option: SqlOption) -> QueryResult<RuntimeLimit> {
+    let SqlOption { name, value } = option;
+
+    let limit = match normalize_ident(&name).as_str() {
+        RUNTIME_LIMIT_MAX_CONCURRENT_QUERIES => {
+            let limit = match &value {
+                Value::Number(n, _) => n.parse::<u32>().ok().filter(|n| *n > 0),
+                _ => None,
+            }
+            .ok_or_else(|| QueryError::Parser {
+                source: ParserError::ParserError(format!(
+                    "{} is not a valid positive integer",
+                    value
+                )),
+            })?;
+            RuntimeLimit::MaxConcurrentQueries(limit)
+        }
+        RUNTIME_LIMIT_WRITE_TIMEOUT => {
+            let timeout_str = parse_string_value(value).context(ParserSnafu)?;
+            let timeout = CnosDuration::new(&timeout_str)
+                .map(|d| d.duration)
+                .filter(|d| !d.is_zero())
+                .ok_or_else(|| QueryError::Parser {
+                    source: ParserError::ParserError(format!(
+                        "{} is not a valid duration",
+                        timeout_str
+                    )),
+                })?;
+            RuntimeLimit::WriteTimeout(timeout)
+        }
+        _ => {
+            return Err(QueryError::Parser {
+                source: ParserError::ParserError(format!(
+                "Expected limit [{RUNTIME_LIMIT_MAX_CONCURRENT_QUERIES}], [{RUNTIME_LIMIT_WRITE_TIMEOUT}] found [{}]",
+                name
+            )),
+            })
+        }
+    };
+
+    Ok(limit)
+}
+
 pub fn sql_options_to_tenant_options(options: Vec<SqlOption>) -> QueryResult<TenantOptions> {
     let mut builder = TenantOptionsBuilder::default();
 
@@ -532,9 +654,24 @@ pub fn sql_options_to_user_options(
             "hash_password" => {
                 builder.hash_password(parse_string_value(value)?);
             }
+            "denied_statements" => {
+                let denied_statements = DeniedStatements::from_str(&parse_string_value(value)?)
+                    .map_err(ParserError::ParserError)?;
+                builder.denied_statements(denied_statements);
+            }
+            "password_max_age" => {
+                let max_age_str = parse_string_value(value)?;
+                let max_age = CnosDuration::new(&max_age_str).ok_or_else(|| {
+                    ParserError::ParserError(format!(
+                        "{} is not a valid duration or duration overflow",
+                        max_age_str
+                    ))
+                })?;
+                builder.password_max_age(max_age);
+            }
             _ => {
                 return Err(ParserError::ParserError(format!(
-                "Expected option [password | rsa_public_key | comment | granted_admin], found [{}]",
+                "Expected option [password | rsa_public_key | comment | granted_admin | denied_statements | password_max_age], found [{}]",
                 name
             )))
             }
@@ -6,16 +6,22 @@ use coordinator::Coordinator;
 use datafusion::common::extensions_options;
 use datafusion::config::ConfigExtension;
 use datafusion::execution::context::SessionState;
+use datafusion::execution::disk_manager::DiskManagerConfig;
 use datafusion::execution::memory_pool::MemoryPool;
 use datafusion::execution::runtime_env::{RuntimeConfig, RuntimeEnv};
 use datafusion::prelude::{SessionConfig, SessionContext};
 use datafusion::variable::VarType;
 use models::auth::user::User;
+use models::consistency_level::WriteToken;
 use models::oid::Oid;
+use models::predicate::series_cursor::SeriesCursor;
 use trace::span_ext::SpanExt;
 use trace::{Span, SpanContext};
 
-use super::config::StreamTriggerInterval;
+use super::config::{
+    AsyncJob, MaxPoints, ReadYourWrites, SeriesAlignment, SeriesPaging, StreamTriggerInterval,
+    UnboundedTimeRange,
+};
 use super::variable::VarProviderRef;
 use crate::service::protocol::Context;
 use crate::QueryResult;
@@ -97,6 +103,7 @@ pub struct SessionCtxFactory {
     sys_var_provider: Option<VarProviderRef>,
     query_dedicated_hidden_dir: PathBuf,
     session_function_register: Option<fn(df_session_ctx: &SessionContext, context: &Context)>,
+    disk_manager_config: DiskManagerConfig,
 }
 
 impl SessionCtxFactory {
@@ -104,11 +111,13 @@ impl SessionCtxFactory {
         sys_var_provider: Option<VarProviderRef>,
         query_dedicated_hidden_dir: PathBuf,
         session_function_register: Option<fn(df_session_ctx: &SessionContext, context: &Context)>,
+        disk_manager_config: DiskManagerConfig,
     ) -> Self {
         Self {
             sys_var_provider,
             query_dedicated_hidden_dir,
             session_function_register,
+            disk_manager_config,
         }
     }
 
@@ -160,7 +169,11 @@ impl SessionCtxFactory {
             coord.get_config().storage.copyinto_trigger_flush_size,
         );
 
-        let rt_config = RuntimeConfig::new().with_memory_pool(memory_pool);
+        // sort operators spill to disk instead of failing when the memory pool is exhausted,
+        // the hash aggregations of datafusion 27 don't spill and still fail
+        let rt_config = RuntimeConfig::new()
+            .with_memory_pool(memory_pool)
+            .with_disk_manager(self.disk_manager_config.clone());
         let rt = RuntimeEnv::new(rt_config)?;
         let df_session_state =
             SessionState::with_config_rt(config, Arc::new(rt)).with_session_id(session_id.into());
@@ -212,4 +225,45 @@ impl CnosSessionConfig {
         self.inner = self.inner.with_extension(Arc::new(interval));
         self
     }
+
+    pub fn with_unbounded_time_range(mut self, unbounded: bool) -> Self {
+        self.inner = self
+            .inner
+            .with_extension(Arc::new(UnboundedTimeRange(unbounded)));
+        self
+    }
+
+    pub fn with_write_token(mut self, token: WriteToken) -> Self {
+        self.inner = self.inner.with_extension(Arc::new(ReadYourWrites(token)));
+        self
+    }
+
+    pub fn with_max_points(mut self, max_points: u64) -> Self {
+        self.inner = self.inner.with_extension(Arc::new(MaxPoints(max_points)));
+        self
+    }
+
+    pub fn with_align_series(mut self, align: bool) -> Self {
+        self.inner = self.inner.with_extension(Arc::new(SeriesAlignment(align)));
+        self
+    }
+
+    pub fn with_async_job(mut self, async_job: bool) -> Self {
+        self.inner = self.inner.with_extension(Arc::new(AsyncJob(async_job)));
+        self
+    }
+
+    pub fn with_series_cursor(mut self, cursor: SeriesCursor) -> Self {
+        self.inner = self
+            .inner
+            .with_extension(Arc::new(SeriesPaging::new(cursor)));
+        self
+    }
+
+    /// The cursor of the next page of the query, see [`SeriesPaging`].
+    pub fn next_series_cursor(&self) -> Option<SeriesCursor> {
+        self.inner
+            .get_extension::<SeriesPaging>()
+            .and_then(|paging| paging.next_cursor())
+    }
 }
@@ -1,9 +1,12 @@
+use std::collections::BTreeMap;
 use std::sync::Arc;
 
 use async_trait::async_trait;
 use bytes::Bytes;
+use futures::stream::BoxStream;
 use protocol_parser::Line;
 use protos::prompb::prometheus::WriteRequest;
+use serde::Serialize;
 use trace::SpanContext;
 
 use crate::service::protocol::Context;
@@ -11,6 +14,90 @@ use crate::QueryResult;
 
 pub type PromRemoteServerRef = Arc<dyn PromRemoteServer + Send + Sync>;
 
+/// Response of the remote read, of the type negotiated by the
+/// `accepted_response_types` of the request.
+pub enum PromReadResponse {
+    /// A snappy compressed `ReadResponse`.
+    Samples(Vec<u8>),
+    /// Frames of `ChunkedReadResponse`, sent as they are encoded.
+    StreamedXorChunks(BoxStream<'static, QueryResult<Vec<u8>>>),
+}
+
+/// A PromQL query, the times are unix milliseconds. An instant query is
+/// evaluated only at `start`, its `step` is 0.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct PromQLQuery {
+    pub query: String,
+    pub start: i64,
+    pub end: i64,
+    pub step: i64,
+}
+
+impl PromQLQuery {
+    pub fn instant(query: String, time: i64) -> Self {
+        Self {
+            query,
+            start: time,
+            end: time,
+            step: 0,
+        }
+    }
+
+    pub fn range(query: String, start: i64, end: i64, step: i64) -> Self {
+        Self {
+            query,
+            start,
+            end,
+            step,
+        }
+    }
+
+    pub fn is_instant(&self) -> bool {
+        self.step == 0
+    }
+}
+
+/// The `data` of the response of a PromQL query, in the format of the
+/// Prometheus http api.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(tag = "resultType", content = "result", rename_all = "lowercase")]
+pub enum PromQLData {
+    Scalar(PromQLPoint),
+    Vector(Vec<PromQLSample>),
+    Matrix(Vec<PromQLSeries>),
+}
+
+/// `[<unix seconds>, "<value>"]`
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct PromQLPoint(pub f64, pub String);
+
+impl PromQLPoint {
+    pub fn new(timestamp_ms: i64, value: f64) -> Self {
+        let value = if value.is_nan() {
+            "NaN".to_string()
+        } else if value == f64::INFINITY {
+            "+Inf".to_string()
+        } else if value == f64::NEG_INFINITY {
+            "-Inf".to_string()
+        } else {
+            value.to_string()
+        };
+        Self(timestamp_ms as f64 / 1000.0, value)
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct PromQLSample {
+    pub metric: BTreeMap<String, String>,
+    pub value: PromQLPoint,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct PromQLSeries {
+    pub metric: BTreeMap<String, String>,
+    pub values: Vec<PromQLPoint>,
+}
+
 #[async_trait]
 pub trait PromRemoteServer {
     async fn remote_read(
@@ -18,9 +105,53 @@ pub trait PromRemoteServer {
         ctx: &Context,
         req: Bytes,
         span_ctx: Option<&SpanContext>,
-    ) -> QueryResult<Vec<u8>>;
+    ) -> QueryResult<PromReadResponse>;
+
+    /// Evaluate the PromQL query of `/api/v1/query` or `/api/v1/query_range`.
+    async fn query(
+        &self,
+        ctx: &Context,
+        query: PromQLQuery,
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<PromQLData>;
+
+    /// The label names of the series of the `match[]` selectors, or of all
+    /// the series if there is no selector, for `/api/v1/labels`.
+    async fn label_names(
+        &self,
+        ctx: &Context,
+        selectors: &[String],
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<Vec<String>>;
+
+    /// The values of a label of the series of the `match[]` selectors, or of
+    /// all the series if there is no selector, for
+    /// `/api/v1/label/<name>/values`.
+    async fn label_values(
+        &self,
+        ctx: &Context,
+        name: &str,
+        selectors: &[String],
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<Vec<String>>;
+
+    /// The labels of the series of the `match[]` selectors, for
+    /// `/api/v1/series`.
+    async fn series(
+        &self,
+        ctx: &Context,
+        selectors: &[String],
+        span_ctx: Option<&SpanContext>,
+    ) -> QueryResult<Vec<BTreeMap<String, String>>>;
 
     fn remote_write(&self, req: Bytes) -> QueryResult<WriteRequest>;
 
-    fn prom_write_request_to_lines<'a>(&self, req: &'a WriteRequest) -> QueryResult<Vec<Line<'a>>>;
+    /// Converts the samples to lines, the samples are written to the field
+    /// named by the value of `field_label` if the series has the label, or
+    /// to the field `value`.
+    fn prom_write_request_to_lines<'a>(
+        &self,
+        req: &'a WriteRequest,
+        field_label: Option<&str>,
+    ) -> QueryResult<Vec<Line<'a>>>;
 }
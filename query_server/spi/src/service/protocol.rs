@@ -1,4 +1,6 @@
 use models::auth::user::User;
+use models::consistency_level::WriteToken;
+use models::predicate::series_cursor::SeriesCursor;
 use models::schema::query_info::QueryId;
 use models::schema::{DEFAULT_CATALOG, DEFAULT_DATABASE, DEFAULT_PRECISION};
 
@@ -109,6 +111,48 @@ impl ContextBuilder {
         self
     }
 
+    pub fn with_unbounded_time_range(mut self, unbounded: Option<bool>) -> Self {
+        if let Some(unbounded) = unbounded {
+            self.session_config = self.session_config.with_unbounded_time_range(unbounded);
+        }
+        self
+    }
+
+    pub fn with_write_token(mut self, token: Option<WriteToken>) -> Self {
+        if let Some(token) = token {
+            self.session_config = self.session_config.with_write_token(token);
+        }
+        self
+    }
+
+    pub fn with_max_points(mut self, max_points: Option<u64>) -> Self {
+        if let Some(max_points) = max_points {
+            self.session_config = self.session_config.with_max_points(max_points);
+        }
+        self
+    }
+
+    pub fn with_align_series(mut self, align: Option<bool>) -> Self {
+        if let Some(align) = align {
+            self.session_config = self.session_config.with_align_series(align);
+        }
+        self
+    }
+
+    pub fn with_async_job(mut self, async_job: Option<bool>) -> Self {
+        if let Some(async_job) = async_job {
+            self.session_config = self.session_config.with_async_job(async_job);
+        }
+        self
+    }
+
+    pub fn with_series_cursor(mut self, cursor: Option<SeriesCursor>) -> Self {
+        if let Some(cursor) = cursor {
+            self.session_config = self.session_config.with_series_cursor(cursor);
+        }
+        self
+    }
+
     pub fn with_chunked(mut self, chunked: Option<bool>) -> Self {
         if let Some(chunked) = chunked {
             self.chunked = chunked;
@@ -207,6 +207,7 @@ pub async fn run_query(
         tenant,
         db,
         target_partitions,
+        align_series,
         ..
     } = options;
 
@@ -216,6 +217,9 @@ pub async fn run_query(
     client.set_header("TENANT", tenant);
     client.set_header("DB", db);
     client.set_header("target_partitions", &target_partitions.to_string());
+    if let Some(align_series) = align_series {
+        client.set_header("x-cnosdb-align-series", &align_series.to_string());
+    }
 
     // 1. handshake, basic authentication
     let _ = client.handshake(username, password).await?;
@@ -420,6 +424,7 @@ pub struct SqlClientOptions {
     pub timeout: Option<Duration>,
     pub precision: Option<String>,
     pub chunked: Option<bool>,
+    pub align_series: Option<bool>,
 }
 
 impl SqlClientOptions {
@@ -467,6 +472,10 @@ impl SqlClientOptions {
         if let Ok((_, chunked)) = instruction_parse_to::<bool>("CHUNKED")(line) {
             self.chunked = Some(chunked)
         }
+
+        if let Ok((_, align_series)) = instruction_parse_to::<bool>("ALIGN_SERIES")(line) {
+            self.align_series = Some(align_series)
+        }
     }
 }
 #[cfg(test)]
@@ -491,6 +500,7 @@ mod test {
             timeout: None,
             precision: None,
             chunked: None,
+            align_series: None,
         };
 
         let line = r##"--#DATABASE = _abc_"##;
@@ -505,5 +515,9 @@ mod test {
         let line = r##"--#TIMEOUT = 10ms"##;
         instruction.parse_and_change(line);
         assert_eq!(instruction.timeout, Some(Duration::from_millis(10)));
+
+        let line = r##"--#ALIGN_SERIES = true"##;
+        instruction.parse_and_change(line);
+        assert_eq!(instruction.align_series, Some(true));
     }
 }
@@ -54,6 +54,7 @@ pub async fn main() -> Result<(), Box<dyn Error>> {
         timeout: None,
         precision: None,
         chunked: None,
+        align_series: None,
     };
 
     let create_options = CreateOptions {
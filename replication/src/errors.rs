@@ -124,6 +124,10 @@ pub enum ReplicationError {
     #[snafu(display("models error: {}", source))]
     #[error_code(code = 18)]
     ModelError { source: models::ModelError },
+
+    #[snafu(display("Log before {} is purged, can't read from {}", first, index))]
+    #[error_code(code = 19)]
+    LogPurged { index: u64, first: u64 },
 }
 
 impl ReplicationError {
@@ -92,6 +92,23 @@ pub struct EntriesMetrics {
     pub avg_write_time: u64,
 }
 
+/// A write committed and applied by a raft group.
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize, PartialEq, Eq)]
+pub struct CommittedEntry {
+    pub index: u64,
+    pub data: Request,
+}
+
+/// The writes of a raft group in log order, read by the replicas catching up.
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize, PartialEq, Eq, Default)]
+pub struct CommittedLog {
+    pub entries: Vec<CommittedEntry>,
+    /// Index to read from next time.
+    pub next_index: u64,
+    /// Last index applied when read, the entries after it are not returned.
+    pub last_applied: u64,
+}
+
 #[derive(Debug, Clone, serde::Serialize, serde::Deserialize, PartialEq, Eq, Default)]
 pub struct ApplyContext {
     pub index: u64,
@@ -110,6 +127,13 @@ pub trait ApplyStorage: Send + Sync + Any {
 }
 pub type ApplyStorageRef = Arc<RwLock<dyn ApplyStorage + Send + Sync>>;
 
+/// Checks whether the raft nodes on this node accept the entries and the
+/// snapshots of their leaders, e.g. rejects them while the disk is full.
+pub trait AppendGuard: Send + Sync {
+    fn check_append(&self) -> Result<(), String>;
+}
+pub type AppendGuardRef = Arc<dyn AppendGuard>;
+
 #[async_trait]
 pub trait EntryStorage: Send + Sync {
     // Get the entry by index
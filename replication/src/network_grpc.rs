@@ -8,16 +8,33 @@ use trace::debug;
 
 use crate::multi_raft::MultiRaft;
 use crate::raft_node::RaftNode;
-use crate::{RaftNodeId, TypeConfig};
+use crate::{AppendGuardRef, RaftNodeId, TypeConfig};
 
 #[derive(Clone)]
 pub struct RaftCBServer {
     nodes: Arc<RwLock<MultiRaft>>,
+    append_guard: Option<AppendGuardRef>,
 }
 
 impl RaftCBServer {
     pub fn new(nodes: Arc<RwLock<MultiRaft>>) -> Self {
-        Self { nodes }
+        Self {
+            nodes,
+            append_guard: None,
+        }
+    }
+
+    pub fn with_append_guard(mut self, guard: AppendGuardRef) -> Self {
+        self.append_guard = Some(guard);
+        self
+    }
+
+    /// The leader retries the rejected entries until they are accepted.
+    fn check_append(&self) -> std::result::Result<(), tonic::Status> {
+        match &self.append_guard {
+            Some(guard) => guard.check_append().map_err(tonic::Status::unavailable),
+            None => Ok(()),
+        }
     }
 
     async fn get_node(&self, group_id: u32) -> std::result::Result<Arc<RaftNode>, tonic::Status> {
@@ -76,6 +93,7 @@ impl RaftService for RaftCBServer {
             "Network callback recv raft_snapshot  req: {:?}",
             snapshot.meta
         );
+        self.check_append()?;
 
         let node = self.get_node(inner.group_id).await?;
         let res = node.raw_raft().install_snapshot(snapshot).await;
@@ -102,6 +120,11 @@ impl RaftService for RaftCBServer {
         //     begin, end
         // );
 
+        // the heartbeats are accepted, or the follower starts an election
+        if !entries.entries.is_empty() {
+            self.check_append()?;
+        }
+
         let node = self.get_node(inner.group_id).await?;
         let res = node.raw_raft().append_entries(entries).await;
         let data = serde_json::to_string(&res).unwrap_or_else(|_| "encode vote rsp failed".into());
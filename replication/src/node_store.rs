@@ -12,11 +12,11 @@ use serde::{Deserialize, Serialize};
 use trace::info;
 use tracing::debug;
 
-use crate::errors::ReplicationResult;
+use crate::errors::{EntryNotFoundSnafu, ReplicationError, ReplicationResult};
 use crate::state_store::StateStorage;
 use crate::{
-    ApplyContext, ApplyStorageRef, EngineMetrics, EntriesMetrics, EntryStorageRef, RaftNodeId,
-    RaftNodeInfo, Response, TypeConfig,
+    ApplyContext, ApplyStorageRef, CommittedEntry, CommittedLog, EngineMetrics, EntriesMetrics,
+    EntryStorageRef, RaftNodeId, RaftNodeInfo, Response, TypeConfig,
 };
 
 #[derive(Serialize, Deserialize, Debug, Clone)]
@@ -75,6 +75,70 @@ impl NodeStorage {
         self.raft_logs.write().await.metrics().await
     }
 
+    /// Read at most `limit` entries applied from `from` in log order, the
+    /// same index always reads the same writes whichever replica serves it.
+    pub async fn committed_log(&self, from: u64, limit: usize) -> ReplicationResult<CommittedLog> {
+        let last_applied = self
+            .state
+            .get_last_applied_log(self.group_id())?
+            .map_or(0, |id| id.index);
+        let first = self
+            .state
+            .get_last_purged(self.group_id())?
+            .map_or(0, |id| id.index + 1);
+        if from < first {
+            return Err(ReplicationError::LogPurged { index: from, first });
+        }
+
+        let end = last_applied
+            .saturating_add(1)
+            .min(from.saturating_add(limit as u64));
+        if from >= end {
+            return Ok(CommittedLog {
+                entries: vec![],
+                next_index: from,
+                last_applied,
+            });
+        }
+
+        let entries = self.raft_logs.write().await.entries(from, end).await?;
+        let mut log = CommittedLog {
+            entries: Vec::with_capacity(entries.len()),
+            next_index: from,
+            last_applied,
+        };
+        for entry in entries {
+            if entry.log_id.index != log.next_index {
+                // the log files before the snapshot are removed
+                if log.next_index == from {
+                    return Err(ReplicationError::LogPurged {
+                        index: from,
+                        first: entry.log_id.index,
+                    });
+                }
+                return EntryNotFoundSnafu {
+                    index: log.next_index,
+                }
+                .fail();
+            }
+            log.next_index += 1;
+            if let EntryPayload::Normal(data) = entry.payload {
+                log.entries.push(CommittedEntry {
+                    index: entry.log_id.index,
+                    data,
+                });
+            }
+        }
+        if log.next_index != end {
+            return EntryNotFoundSnafu {
+                index: log.next_index,
+            }
+            .fail();
+        }
+
+        Ok(log)
+    }
+
     // term-raftid-index
     fn get_snapshot_id(&self, log_id: &Option<LogId<u64>>) -> ReplicationResult<String> {
         if let Some(log_id) = log_id {
@@ -525,13 +589,15 @@ impl RaftStorage<TypeConfig> for Arc<NodeStorage> {
 mod test {
     use std::sync::Arc;
 
+    use openraft::{CommittedLeaderId, Entry, EntryPayload, LogId};
     use tokio::sync::RwLock;
 
     use super::NodeStorage;
     use crate::apply_store::HeedApplyStorage;
     use crate::entry_store::HeedEntryStorage;
+    use crate::errors::ReplicationError;
     use crate::state_store::StateStorage;
-    use crate::{ApplyStorageRef, EntryStorageRef, RaftNodeInfo};
+    use crate::{ApplyStorageRef, CommittedEntry, EntryStorageRef, RaftNodeInfo, TypeConfig};
 
     #[test]
     pub fn test_node_store() {
@@ -543,6 +609,73 @@ mod test {
         let _ = std::fs::remove_dir_all(path);
     }
 
+    #[tokio::test]
+    async fn test_committed_log() {
+        let _ = std::fs::create_dir_all("/tmp/cnosdb/test_raft_store");
+        let storage = get_node_store().await;
+        let group_id = storage.group_id();
+        let log_id = |index| LogId::new(CommittedLeaderId::new(1, 1000), index);
+
+        let entries = (1..=5)
+            .map(|index| Entry::<TypeConfig> {
+                log_id: log_id(index),
+                payload: if index == 1 {
+                    EntryPayload::Blank
+                } else {
+                    EntryPayload::Normal(vec![index as u8])
+                },
+            })
+            .collect::<Vec<_>>();
+        storage
+            .raft_logs
+            .write()
+            .await
+            .append(&entries)
+            .await
+            .unwrap();
+        storage
+            .state
+            .set_last_applied_log(group_id, log_id(4))
+            .unwrap();
+
+        // the blank entry is skipped, the entries not applied are not read
+        let log = storage.committed_log(1, 10).await.unwrap();
+        assert_eq!(log.last_applied, 4);
+        assert_eq!(log.next_index, 5);
+        assert_eq!(
+            log.entries,
+            vec![
+                CommittedEntry {
+                    index: 2,
+                    data: vec![2]
+                },
+                CommittedEntry {
+                    index: 3,
+                    data: vec![3]
+                },
+                CommittedEntry {
+                    index: 4,
+                    data: vec![4]
+                },
+            ]
+        );
+
+        let log = storage.committed_log(3, 1).await.unwrap();
+        assert_eq!(log.next_index, 4);
+        assert_eq!(log.entries.len(), 1);
+        assert_eq!(log.entries[0].index, 3);
+
+        let log = storage.committed_log(5, 10).await.unwrap();
+        assert!(log.entries.is_empty());
+        assert_eq!(log.next_index, 5);
+
+        storage.state.set_last_purged(group_id, log_id(2)).unwrap();
+        assert!(matches!(
+            storage.committed_log(2, 10).await,
+            Err(ReplicationError::LogPurged { index: 2, first: 3 })
+        ));
+    }
+
     #[allow(dead_code)]
     pub async fn get_node_store() -> Arc<NodeStorage> {
         let path = tempfile::tempdir_in("/tmp/cnosdb/test_raft_store").unwrap();
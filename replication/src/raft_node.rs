@@ -10,7 +10,8 @@ use crate::errors::{RaftInternalErrSnafu, ReplicationError, ReplicationResult};
 use crate::network_client::NetworkConn;
 use crate::node_store::NodeStorage;
 use crate::{
-    EngineMetrics, EntriesMetrics, OpenRaftNode, RaftNodeId, RaftNodeInfo, ReplicationConfig,
+    CommittedLog, EngineMetrics, EntriesMetrics, OpenRaftNode, RaftNodeId, RaftNodeInfo,
+    ReplicationConfig,
 };
 
 #[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
@@ -208,6 +209,12 @@ impl RaftNode {
         self.storage.engine_metrics().await
     }
 
+    /// Read the writes applied by the group from `from`, see
+    /// [`NodeStorage::committed_log`].
+    pub async fn committed_log(&self, from: u64, limit: usize) -> ReplicationResult<CommittedLog> {
+        self.storage.committed_log(from, limit).await
+    }
+
     pub async fn sync_wal_writer(&self) {
         let _ = self.storage.sync_wal_writer().await;
     }
@@ -89,6 +89,8 @@ fn big_write(c: &mut Criterion) {
                 let request = WriteDataRequest {
                     data: points,
                     precision: Precision::NS as u32,
+
+                    copied: false,
                 };
 
                 tskv_write(
@@ -118,6 +120,8 @@ fn run(c: &mut Criterion) {
     let request = WriteDataRequest {
         data: points,
         precision: Precision::NS as u32,
+
+        copied: false,
     };
 
     // maybe 500 us
@@ -1,15 +1,48 @@
 use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+
+use cache::ShardedAsyncCache;
+
+use crate::tsm::reader::TsmReader;
+
+pub type TsmReaderCache = ShardedAsyncCache<String, Arc<TsmReader>>;
 
 #[derive(Default, Debug)]
 pub struct GlobalContext {
     /// Database file id
     file_id: AtomicU64,
+    /// Readers of the tsm files shared by all the vnodes if the number of
+    /// the open tsm files is limited.
+    tsm_reader_cache: Option<Arc<TsmReaderCache>>,
 }
 
 impl GlobalContext {
     pub fn new() -> Self {
         Self {
             file_id: AtomicU64::new(0),
+            tsm_reader_cache: None,
+        }
+    }
+
+    /// Creates the context keeping at most `max_open_tsm_files` tsm files
+    /// open, the least recently used ones are closed beyond it, 0 for no
+    /// limit.
+    pub fn with_max_open_tsm_files(max_open_tsm_files: usize) -> Self {
+        let tsm_reader_cache = (max_open_tsm_files > 0)
+            .then(|| Arc::new(TsmReaderCache::create_lru_sharded_cache(max_open_tsm_files)));
+        Self {
+            file_id: AtomicU64::new(0),
+            tsm_reader_cache,
+        }
+    }
+
+    /// Cache of the readers of the tsm files of a vnode, the one shared by
+    /// all the vnodes if the open tsm files are limited, otherwise a cache
+    /// of `max_cache_readers` readers of the vnode.
+    pub fn tsm_reader_cache(&self, max_cache_readers: usize) -> Arc<TsmReaderCache> {
+        match &self.tsm_reader_cache {
+            Some(cache) => cache.clone(),
+            None => Arc::new(TsmReaderCache::create_lru_sharded_cache(max_cache_readers)),
         }
     }
 }
@@ -43,3 +76,25 @@ impl GlobalContext {
         }
     }
 }
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use super::GlobalContext;
+
+    #[test]
+    fn test_tsm_reader_cache() {
+        let ctx = GlobalContext::new();
+        assert!(!Arc::ptr_eq(
+            &ctx.tsm_reader_cache(16),
+            &ctx.tsm_reader_cache(16)
+        ));
+
+        let ctx = GlobalContext::with_max_open_tsm_files(1024);
+        assert!(Arc::ptr_eq(
+            &ctx.tsm_reader_cache(16),
+            &ctx.tsm_reader_cache(32)
+        ));
+    }
+}
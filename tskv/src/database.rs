@@ -139,9 +139,9 @@ impl Database {
         tsf_id: VnodeId,
         ctx: Arc<TsKvContext>,
     ) -> TskvResult<Arc<RwLock<TseriesFamily>>> {
-        let tsm_reader_cache = Arc::new(cache::ShardedAsyncCache::create_lru_sharded_cache(
-            self.config.max_cache_readers() as usize,
-        ));
+        let tsm_reader_cache = ctx
+            .global_ctx
+            .tsm_reader_cache(self.config.max_cache_readers() as usize);
         let levels = LevelInfo::init_levels(self.owner.clone(), tsf_id, self.opt.storage.clone());
         let version_edit = VersionEdit::new_add_vnode(tsf_id, self.owner.as_ref().clone(), 0);
 
@@ -198,9 +198,9 @@ impl Database {
 
         let levels =
             LevelInfo::init_levels(self.owner.clone(), ve.tsf_id, self.opt.storage.clone());
-        let tsm_reader_cache = Arc::new(cache::ShardedAsyncCache::create_lru_sharded_cache(
-            self.config.max_cache_readers() as usize,
-        ));
+        let tsm_reader_cache = ctx
+            .global_ctx
+            .tsm_reader_cache(self.config.max_cache_readers() as usize);
         let ver = Arc::new(Version::new(
             ve.tsf_id,
             self.owner.clone(),
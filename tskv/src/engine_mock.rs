@@ -1,19 +1,22 @@
 #![allow(dead_code, unused_variables)]
 
+use std::collections::HashMap;
 use std::fmt::Debug;
+use std::path::PathBuf;
 use std::sync::Arc;
 
 use async_trait::async_trait;
 use datafusion::arrow::record_batch::RecordBatch;
-use models::meta_data::VnodeId;
+use models::meta_data::{DatabaseUsage, VnodeId, VnodeStatus, VnodeSummary};
 use models::predicate::domain::ColumnDomains;
 use models::{SeriesId, SeriesKey};
+use utils::HyperLogLog;
 
 use crate::error::TskvResult;
 use crate::kv_option::StorageOptions;
 use crate::tsfamily::super_version::SuperVersion;
 use crate::vnode_store::VnodeStorage;
-use crate::Engine;
+use crate::{Engine, VnodeSnapshot, VnodeTagValues};
 
 #[derive(Debug, Default)]
 pub struct MockEngine {}
@@ -33,6 +36,15 @@ impl Engine for MockEngine {
         Ok(())
     }
 
+    async fn quarantine_tsfamily(
+        &self,
+        _tenant: &str,
+        _database: &str,
+        _id: u32,
+    ) -> TskvResult<PathBuf> {
+        Ok(PathBuf::new())
+    }
+
     async fn flush_tsfamily(
         &self,
         tenant: &str,
@@ -110,5 +122,35 @@ impl Engine for MockEngine {
         todo!()
     }
 
+    async fn get_database_usages(&self) -> HashMap<String, DatabaseUsage> {
+        HashMap::new()
+    }
+
+    async fn set_vnode_status(&self, vnode_id: VnodeId, status: VnodeStatus) -> TskvResult<()> {
+        Ok(())
+    }
+
+    async fn get_vnode_summaries(&self, vnode_ids: &[VnodeId]) -> Vec<VnodeSummary> {
+        vec![]
+    }
+
+    async fn get_series_sketches(
+        &self,
+        vnode_ids: &[VnodeId],
+        tables: &[String],
+    ) -> TskvResult<HashMap<String, HyperLogLog>> {
+        Ok(HashMap::new())
+    }
+
+    async fn get_tag_values(&self, tag: &str) -> TskvResult<Vec<VnodeTagValues>> {
+        Ok(vec![])
+    }
+
+    async fn create_backup_snapshot(&self, vnode_id: VnodeId) -> TskvResult<VnodeSnapshot> {
+        todo!()
+    }
+
+    async fn release_backup_snapshot(&self, vnode_id: VnodeId, create_time: &str) {}
+
     async fn close(&self) {}
 }
@@ -16,7 +16,7 @@ use crate::file_system::error::FileSystemError;
 use crate::index::IndexError;
 use crate::record_file;
 use crate::record_file::Record;
-use crate::schema::error::SchemaError;
+pub use crate::schema::error::SchemaError;
 use crate::tsm::page::Page;
 
 pub type TskvResult<T, E = TskvError> = std::result::Result<T, E>;
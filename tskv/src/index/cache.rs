@@ -5,6 +5,7 @@ use std::sync::Arc;
 use cache::{ShardedSyncCache, SyncCache};
 use maplit::{btreemap, hashmap};
 use models::{SeriesId, SeriesKey};
+use parking_lot::Mutex;
 
 use super::ts_index::{encode_inverted_index_key, encode_series_key};
 use super::{IndexResult, IndexStorageSnafu};
@@ -14,6 +15,9 @@ use crate::index::ts_index::encode_series_id_key;
 pub struct IndexCache {
     pub read_cache: ForwardCache,
     pub write_cache: IndexMemCache,
+    // table -> ids of all series of the table, used by metadata queries such as
+    // SHOW SERIES and SHOW TAG VALUES without tag filters
+    table_series: Mutex<HashMap<String, roaring::RoaringBitmap>>,
 }
 
 impl IndexCache {
@@ -21,10 +25,12 @@ impl IndexCache {
         Self {
             read_cache: ForwardCache::new(read_cache_size),
             write_cache: IndexMemCache::new(),
+            table_series: Mutex::new(HashMap::new()),
         }
     }
 
     pub fn write(&mut self, id: SeriesId, key: SeriesKey) {
+        self.table_series.get_mut().remove(key.table());
         self.write_cache.add(id, key);
     }
 
@@ -34,10 +40,19 @@ impl IndexCache {
 
     pub fn del(&mut self, id: SeriesId, key: &SeriesKey) {
         let hash = key.hash();
+        self.table_series.get_mut().remove(key.table());
         self.write_cache.del(id, key);
         self.read_cache.del(id, hash);
     }
 
+    pub fn get_table_series(&self, table: &str) -> Option<roaring::RoaringBitmap> {
+        self.table_series.lock().get(table).cloned()
+    }
+
+    pub fn cache_table_series(&self, table: &str, ids: roaring::RoaringBitmap) {
+        self.table_series.lock().insert(table.to_string(), ids);
+    }
+
     pub fn get_series_id_by_key(&self, key: &SeriesKey) -> Option<SeriesId> {
         if let Some(id) = self.write_cache.get_series_id_by_key(key) {
             return Some(id);
@@ -50,6 +65,11 @@ impl IndexCache {
         None
     }
 
+    /// Whether the series is written and not flushed to the storage yet.
+    pub fn is_unflushed(&self, id: SeriesId) -> bool {
+        self.write_cache.get_series_key_by_id(id).is_some()
+    }
+
     pub fn get_series_key_by_id(&self, id: SeriesId) -> Option<SeriesKey> {
         if let Some(key) = self.write_cache.get_series_key_by_id(id) {
             return Some(key);
@@ -236,6 +256,20 @@ impl IndexMemCache {
         bitmap
     }
 
+    pub fn get_tag_values<'a>(
+        &'a self,
+        tab: &str,
+        tag_key: &[u8],
+    ) -> impl Iterator<Item = &'a Vec<u8>> + 'a {
+        self.inverted
+            .get(tab)
+            .and_then(|item| item.get(tag_key))
+            .into_iter()
+            .flat_map(|values| values.iter())
+            .filter(|(_, rb)| !rb.is_empty())
+            .map(|(value, _)| value)
+    }
+
     pub fn get_inverted_by_tags(&self, tab: &str, tags: &[models::Tag]) -> roaring::RoaringBitmap {
         if tags.is_empty() {
             let mut bitmap = roaring::RoaringBitmap::new();
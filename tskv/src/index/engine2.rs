@@ -1,3 +1,4 @@
+use std::collections::BTreeSet;
 use std::fs;
 use std::ops::{BitAnd, BitOr, Bound, RangeBounds};
 use std::path::Path;
@@ -244,6 +245,59 @@ impl IndexEngine2 {
         Ok(bitmap)
     }
 
+    /// The keys and the values starting with the prefix.
+    pub fn get_prefix(&self, prefix: &[u8]) -> IndexResult<Vec<(Vec<u8>, Vec<u8>)>> {
+        let reader = self.reader_txn()?;
+        let it = self
+            .db
+            .prefix_iter(&reader, prefix)
+            .map_err(|e| IndexStorageSnafu { msg: e.to_string() }.build())?;
+        let mut pairs = vec![];
+        for val in it {
+            let val = val.map_err(|e| IndexStorageSnafu { msg: e.to_string() }.build())?;
+            pairs.push((val.0.to_vec(), val.1.to_vec()));
+        }
+
+        Ok(pairs)
+    }
+
+    /// Number of the keys starting with the prefix.
+    pub fn count_prefix(&self, prefix: &[u8]) -> IndexResult<u64> {
+        let reader = self.reader_txn()?;
+        let it = self
+            .db
+            .prefix_iter(&reader, prefix)
+            .map_err(|e| IndexStorageSnafu { msg: e.to_string() }.build())?;
+        let mut count = 0;
+        for val in it {
+            val.map_err(|e| IndexStorageSnafu { msg: e.to_string() }.build())?;
+            count += 1;
+        }
+
+        Ok(count)
+    }
+
+    /// The values of the tag of the live series of the table.
+    pub fn get_tag_values(&self, tab: &str, tag_key: &[u8]) -> IndexResult<BTreeSet<Vec<u8>>> {
+        let prefix = super::ts_index::encode_inverted_index_key(tab, tag_key, &[]);
+        let reader = self.reader_txn()?;
+        let it = self
+            .db
+            .prefix_iter(&reader, prefix.as_slice())
+            .map_err(|e| IndexStorageSnafu { msg: e.to_string() }.build())?;
+        let mut values = BTreeSet::new();
+        for val in it {
+            let val = val.map_err(|e| IndexStorageSnafu { msg: e.to_string() }.build())?;
+            let rb = RoaringBitmap::deserialize_from(&*val.1).context(RoaringBitmapSnafu)?;
+            // the series deleted are removed from the bitmaps
+            if !rb.is_empty() {
+                values.insert(val.0[prefix.len()..].to_vec());
+            }
+        }
+
+        Ok(values)
+    }
+
     pub fn get_series_id_by_tags(
         &self,
         tab: &str,
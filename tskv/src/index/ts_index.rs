@@ -1,4 +1,4 @@
-use std::collections::{HashMap, HashSet};
+use std::collections::{BTreeSet, HashMap, HashSet};
 use std::ops::{BitAnd, BitOr, Bound, RangeBounds};
 use std::path::Path;
 use std::sync::atomic::{AtomicU32, Ordering};
@@ -9,13 +9,15 @@ use datafusion::scalar::ScalarValue;
 use models::predicate::domain::{utf8_from, ColumnDomains, Domain, Range};
 use models::schema::tskv_table_schema::TskvTableSchema;
 use models::{tag, SeriesId, SeriesKey, Tag, TagKey, TagValue};
+use parking_lot::Mutex;
 use snafu::{OptionExt, ResultExt};
 use tokio::sync::RwLock;
 use trace::info;
+use utils::HyperLogLog;
 
 use super::cache::IndexCache;
 use super::engine2::IndexEngine2;
-use super::{DecodeSeriesKeySnafu, IndexResult};
+use super::{DecodeSeriesKeySnafu, IndexResult, IndexStorageSnafu};
 use crate::error::{ColumnNotFoundSnafu, IndexErrSnafu};
 use crate::index::{IndexEngine, SeriesAlreadyExistsSnafu};
 use crate::{byte_utils, TskvError, UpdateSetValue};
@@ -24,6 +26,7 @@ const SERIES_ID_PREFIX: &str = "_id_";
 const SERIES_KEY_PREFIX: &str = "_key_";
 const TOMBSTONE_PREFIX: &str = "_tomb_";
 const AUTO_INCR_ID_KEY: &str = "_auto_incr_id";
+const SERIES_SKETCH_PREFIX: &str = "_sketch_";
 
 /// Used to maintain forward and inverted indexes
 ///
@@ -84,9 +87,17 @@ const AUTO_INCR_ID_KEY: &str = "_auto_incr_id";
 pub struct TSIndex {
     incr_id: AtomicU32,
     write_count: AtomicU32,
+    /// Number of the series not deleted, counted from the forward index
+    /// when the index is opened.
+    live_series: u64,
 
     cache: IndexCache,
     storage: IndexEngine2,
+    /// Sketches of the series keys of the tables, built on the first request
+    /// and updated as the series are added, the sketch of a table is dropped
+    /// if any series of it is deleted, a sketch can't remove a key. The
+    /// sketches are stored with the index when it is flushed.
+    sketches: Mutex<HashMap<String, HyperLogLog>>,
 }
 
 impl TSIndex {
@@ -111,11 +122,27 @@ impl TSIndex {
             None => 0,
         };
 
+        let live_series = storage.count_prefix(SERIES_ID_PREFIX.as_bytes())?;
+
+        let mut sketches = HashMap::new();
+        for (key, value) in storage.get_prefix(SERIES_SKETCH_PREFIX.as_bytes())? {
+            let tab = String::from_utf8_lossy(&key[SERIES_SKETCH_PREFIX.len()..]).to_string();
+            match bincode::deserialize::<HyperLogLog>(&value) {
+                Ok(sketch) => {
+                    sketches.insert(tab, sketch);
+                }
+                // rebuilt on the next request
+                Err(e) => trace::warn!("Index drop invalid series sketch of {}: {}", tab, e),
+            }
+        }
+
         let ts_index = Self {
             storage,
             incr_id: AtomicU32::new(incr_id),
             write_count: AtomicU32::new(0),
+            live_series,
             cache: IndexCache::new(cap as usize),
+            sketches: Mutex::new(sketches),
         };
 
         trace::info!(
@@ -141,6 +168,14 @@ impl TSIndex {
             self.incr_id.store(id + 1, Ordering::Relaxed);
         }
 
+        if let Some(sketch) = self.sketches.get_mut().get_mut(key.table()) {
+            sketch.insert(&key_buf);
+        }
+        // the read cache may have evicted a series counted, only the series
+        // neither flushed nor written since are new
+        if !self.cache.is_unflushed(id) && !self.storage.exist(&encode_series_id_key(id))? {
+            self.live_series += 1;
+        }
         self.cache.write(id, key.clone());
         Ok(())
     }
@@ -167,6 +202,10 @@ impl TSIndex {
 
             // write index memcache
             trace::debug!("Index add new series id:{}, key: {}", id, series_key);
+            if let Some(sketch) = self.sketches.get_mut().get_mut(series_key.table()) {
+                sketch.insert(&key_buf);
+            }
+            self.live_series += 1;
             self.cache.write(id, series_key);
 
             let _ = self.check_to_flush(false).await;
@@ -175,6 +214,29 @@ impl TSIndex {
         Ok(ids)
     }
 
+    /// Number of the series not deleted.
+    pub fn series_count(&self) -> u64 {
+        self.live_series
+    }
+
+    /// The sketch of the series keys of the table, the series of the table
+    /// are scanned if it is not built yet. The series can't be changed while
+    /// the index is read, so the sketch built is not missing any series.
+    pub async fn series_sketch(&self, tab: &str) -> IndexResult<HyperLogLog> {
+        if let Some(sketch) = self.sketches.lock().get(tab) {
+            return Ok(sketch.clone());
+        }
+
+        let mut sketch = HyperLogLog::new();
+        for sid in self.get_series_id_list(tab, &[]).await? {
+            if let Some(key) = self.get_series_key(sid).await? {
+                sketch.insert(&encode_series_key(key.table(), key.tags()));
+            }
+        }
+        self.sketches.lock().insert(tab.to_string(), sketch.clone());
+        Ok(sketch)
+    }
+
     pub async fn get_series_id(&self, series_key: &SeriesKey) -> IndexResult<Option<u32>> {
         if let Some(id) = self.cache.get_series_id_by_key(series_key) {
             return Ok(Some(id));
@@ -241,6 +303,8 @@ impl TSIndex {
         let series_key = self.get_series_key(sid).await?;
         let _ = self.storage.delete(&encode_series_id_key(sid));
         if let Some(series_key) = series_key {
+            self.live_series = self.live_series.saturating_sub(1);
+            self.drop_series_sketch(series_key.table())?;
             self.cache.del(sid, &series_key);
             let key_buf = encode_series_key(series_key.table(), series_key.tags());
             let _ = self.storage.delete(&key_buf);
@@ -280,9 +344,13 @@ impl TSIndex {
                 old_series,
                 new_series
             );
+            // the series is renamed, not deleted
+            let live_series = self.live_series;
             self.del_series_info(*sid).await?;
+            self.live_series = live_series;
             self.add_tombstone_series(*sid, old_series).await?;
 
+            self.drop_series_sketch(new_series.table())?;
             self.cache.write(*sid, new_series.clone());
 
             let _ = self.check_to_flush(false).await;
@@ -291,6 +359,13 @@ impl TSIndex {
         Ok(())
     }
 
+    fn drop_series_sketch(&mut self, tab: &str) -> IndexResult<()> {
+        if self.sketches.get_mut().remove(tab).is_some() {
+            self.storage.delete(&encode_series_sketch_key(tab))?;
+        }
+        Ok(())
+    }
+
     async fn check_to_flush(&mut self, force: bool) -> IndexResult<()> {
         let count = self.write_count.fetch_add(1, Ordering::Relaxed);
         if !force && count < 10000 {
@@ -300,12 +375,30 @@ impl TSIndex {
         let id_bytes = self.incr_id.load(Ordering::Relaxed).to_be_bytes();
         self.storage.set(AUTO_INCR_ID_KEY.as_bytes(), &id_bytes)?;
         self.cache.write_cache.flush(&self.storage).await?;
+        for (tab, sketch) in self.sketches.get_mut().iter() {
+            let data = bincode::serialize(sketch)
+                .map_err(|e| IndexStorageSnafu { msg: e.to_string() }.build())?;
+            self.storage.set(&encode_series_sketch_key(tab), &data)?;
+        }
 
         self.write_count.store(0, Ordering::Relaxed);
 
         Ok(())
     }
 
+    /// The values of the tag of the series of the table, `tag_key` is the
+    /// id of the tag column.
+    pub fn get_tag_values(&self, tab: &str, tag_key: &str) -> IndexResult<BTreeSet<Vec<u8>>> {
+        let mut values = self.storage.get_tag_values(tab, tag_key.as_bytes())?;
+        values.extend(
+            self.cache
+                .write_cache
+                .get_tag_values(tab, tag_key.as_bytes())
+                .cloned(),
+        );
+        Ok(values)
+    }
+
     /// if tags == [] return all
     pub async fn get_series_id_list(&self, tab: &str, tags: &[Tag]) -> IndexResult<Vec<u32>> {
         let rb = self.get_series_id_bitmap(tab, tags).await?;
@@ -318,10 +411,21 @@ impl TSIndex {
         tab: &str,
         tags: &[Tag],
     ) -> IndexResult<roaring::RoaringBitmap> {
+        if tags.is_empty() {
+            if let Some(rb) = self.cache.get_table_series(tab) {
+                return Ok(rb);
+            }
+        }
+
         let cache_rb = self.cache.write_cache.get_inverted_by_tags(tab, tags);
         let engine_rb = self.storage.get_series_id_by_tags(tab, tags)?;
+        let rb = cache_rb.bitor(&engine_rb);
+
+        if tags.is_empty() {
+            self.cache.cache_table_series(tab, rb.clone());
+        }
 
-        Ok(cache_rb.bitor(&engine_rb))
+        Ok(rb)
     }
 
     /// 获取所有匹配的旧的series key及其更新后的series key，以及对应的series id
@@ -587,6 +691,10 @@ pub fn encode_series_id_key(id: u32) -> Vec<u8> {
     buf
 }
 
+fn encode_series_sketch_key(tab: &str) -> Vec<u8> {
+    [SERIES_SKETCH_PREFIX.as_bytes(), tab.as_bytes()].concat()
+}
+
 pub fn encode_inverted_max_index_key(tab: &str, tag_key: &[u8]) -> Vec<u8> {
     tab.as_bytes()
         .iter()
@@ -956,4 +1064,105 @@ mod test {
             }
         }
     }
+
+    #[tokio::test]
+    async fn test_table_series_cache() {
+        let table_name = "table";
+        let dir = "/tmp/test/cnosdb/ts_index/table_series_cache";
+        let _ = std::fs::remove_dir_all(dir);
+
+        let ts_index = TSIndex::new(dir, 10000).await.unwrap();
+        let mut ts_index = ts_index.write().await;
+
+        let series_keys = ["a0", "a1", "a2"]
+            .into_iter()
+            .map(|v| SeriesKey {
+                tags: vec![Tag::new(
+                    "station".as_bytes().to_vec(),
+                    v.as_bytes().to_vec(),
+                )],
+                table: table_name.to_string(),
+            })
+            .collect::<Vec<_>>();
+
+        let sids = ts_index
+            .add_series_if_not_exists(series_keys[..2].to_vec())
+            .await
+            .unwrap();
+        let list = ts_index.get_series_id_list(table_name, &[]).await.unwrap();
+        assert_eq!(list, vec![sids[0].0, sids[1].0]);
+
+        // Adding a series invalidates the cached series of the table.
+        let sid = ts_index
+            .add_series_if_not_exists(series_keys[2..].to_vec())
+            .await
+            .unwrap();
+        let list = ts_index.get_series_id_list(table_name, &[]).await.unwrap();
+        assert_eq!(list, vec![sids[0].0, sids[1].0, sid[0].0]);
+
+        // Deleting a series invalidates the cached series of the table.
+        ts_index.del_series_info(sids[0].0).await.unwrap();
+        let list = ts_index.get_series_id_list(table_name, &[]).await.unwrap();
+        assert_eq!(list, vec![sids[1].0, sid[0].0]);
+    }
+
+    #[tokio::test]
+    async fn test_series_count() {
+        let table_name = "table";
+        let dir = "/tmp/test/cnosdb/ts_index/series_count";
+        let _ = std::fs::remove_dir_all(dir);
+
+        let series_keys = ["a0", "a1", "a2"]
+            .into_iter()
+            .map(|v| SeriesKey {
+                tags: vec![Tag::new(
+                    "station".as_bytes().to_vec(),
+                    v.as_bytes().to_vec(),
+                )],
+                table: table_name.to_string(),
+            })
+            .collect::<Vec<_>>();
+
+        {
+            let ts_index = TSIndex::new(dir, 10000).await.unwrap();
+            let mut ts_index = ts_index.write().await;
+            let sids = ts_index
+                .add_series_if_not_exists(series_keys.clone())
+                .await
+                .unwrap();
+            assert_eq!(ts_index.series_count(), 3);
+
+            // The series existing are not counted again.
+            ts_index
+                .add_series_if_not_exists(series_keys[..1].to_vec())
+                .await
+                .unwrap();
+            assert_eq!(ts_index.series_count(), 3);
+
+            // The series deleted are not counted.
+            ts_index.check_to_flush(true).await.unwrap();
+            ts_index.del_series_info(sids[0].0).await.unwrap();
+            assert_eq!(ts_index.series_count(), 2);
+            ts_index.check_to_flush(true).await.unwrap();
+        }
+
+        // Counted from the series stored when the index is opened.
+        {
+            let ts_index = TSIndex::new(dir, 10000).await.unwrap();
+            assert_eq!(ts_index.read().await.series_count(), 2);
+        }
+
+        // The series rebuilt are counted once, even if not cached.
+        let ts_index = TSIndex::new(dir, 1).await.unwrap();
+        let mut ts_index = ts_index.write().await;
+        let series_key = SeriesKey {
+            tags: vec![Tag::new(b"station".to_vec(), b"a3".to_vec())],
+            table: table_name.to_string(),
+        };
+        for key in [&series_keys[1], &series_key, &series_key] {
+            let id = ts_index.get_series_id(key).await.unwrap().unwrap_or(10);
+            ts_index.add_series_for_rebuild(id, key).await.unwrap();
+        }
+        assert_eq!(ts_index.series_count(), 3);
+    }
 }
@@ -10,6 +10,7 @@ use models::meta_data::{NodeId, VnodeId};
 const SUMMARY_PATH: &str = "summary";
 pub const INDEX_PATH: &str = "index";
 pub const DATA_PATH: &str = "data";
+const QUARANTINE_PATH: &str = "quarantine";
 pub const TSM_PATH: &str = "tsm";
 pub const DELTA_PATH: &str = "delta";
 
@@ -47,6 +48,8 @@ pub struct StorageOptions {
     pub max_datablock_size: u64,
     pub index_cache_capacity: u64,
     pub tsm_meta_compress: Encoding,
+    pub max_read_ahead_column_groups: usize,
+    pub max_open_tsm_files: usize,
 }
 
 // database/data/ts_family_id/tsm
@@ -85,6 +88,10 @@ impl StorageOptions {
     pub fn delta_dir(&self, owner: &str, ts_family_id: VnodeId) -> PathBuf {
         self.ts_family_dir(owner, ts_family_id).join(DELTA_PATH)
     }
+
+    pub fn quarantine_dir(&self, owner: &str) -> PathBuf {
+        self.path.join(QUARANTINE_PATH).join(owner)
+    }
 }
 
 impl From<&Config> for StorageOptions {
@@ -111,6 +118,8 @@ impl From<&Config> for StorageOptions {
             max_datablock_size: config.storage.max_datablock_size,
             index_cache_capacity: config.storage.index_cache_capacity,
             tsm_meta_compress,
+            max_read_ahead_column_groups: config.storage.max_read_ahead_column_groups,
+            max_open_tsm_files: config.storage.max_open_tsm_files,
         }
     }
 }
@@ -125,6 +134,7 @@ pub struct QueryOptions {
     pub write_timeout: Duration,
     pub stream_trigger_cpu: usize,
     pub stream_executor_cpu: usize,
+    pub spill_path: PathBuf,
 }
 
 impl From<&Config> for QueryOptions {
@@ -138,6 +148,7 @@ impl From<&Config> for QueryOptions {
             write_timeout: config.query.write_timeout,
             stream_trigger_cpu: config.query.stream_trigger_cpu,
             stream_executor_cpu: config.query.stream_executor_cpu,
+            spill_path: PathBuf::from(config.query.spill_path.clone()),
         }
     }
 }
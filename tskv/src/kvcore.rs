@@ -1,6 +1,7 @@
 use std::collections::HashMap;
+use std::path::PathBuf;
 use std::sync::Arc;
-use std::time::Duration;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
 
 use cache::AsyncCache;
 use datafusion::arrow::record_batch::RecordBatch;
@@ -8,9 +9,10 @@ use memory_pool::{MemoryPool, MemoryPoolRef};
 use meta::error::MetaError;
 use meta::model::MetaRef;
 use metrics::metric_register::MetricsRegister;
-use models::meta_data::VnodeId;
+use models::meta_data::{DatabaseUsage, VnodeId, VnodeStatus, VnodeSummary};
 use models::predicate::domain::ColumnDomains;
 use models::schema::database_schema::{make_owner, split_owner};
+use models::utils::now_timestamp_secs;
 use models::{SeriesId, SeriesKey};
 use snafu::ResultExt;
 use tokio::runtime::Runtime;
@@ -18,12 +20,13 @@ use tokio::sync::broadcast::{self, Sender as BroadcastSender};
 use tokio::sync::mpsc::{self, Receiver, Sender};
 use tokio::sync::{oneshot, RwLock};
 use trace::{debug, error, info, warn};
+use utils::HyperLogLog;
 
 use crate::compaction::job::CompactJob;
 use crate::compaction::metrics::{CompactionType, VnodeCompactionMetrics};
 use crate::compaction::{self, check, pick_compaction, CompactTask};
 use crate::database::Database;
-use crate::error::{IndexErrSnafu, MetaSnafu, TskvResult};
+use crate::error::{IOSnafu, IndexErrSnafu, MetaSnafu, TskvResult, VnodeNotFoundSnafu};
 use crate::file_system::async_filesystem::LocalFileSystem;
 use crate::file_system::FileSystem;
 use crate::index::IndexResult;
@@ -33,7 +36,7 @@ use crate::tsfamily::super_version::SuperVersion;
 use crate::tsfamily::tseries_family::TseriesFamily;
 use crate::version_set::VersionSet;
 use crate::vnode_store::VnodeStorage;
-use crate::{file_utils, Engine, TsKvContext};
+use crate::{file_utils, Engine, TsKvContext, VnodeSnapshot, VnodeTagValues};
 
 // TODO: A small summay channel capacity can cause a block
 pub const COMPACT_REQ_CHANNEL_CAP: usize = 1024;
@@ -45,6 +48,9 @@ pub struct TsKv {
     compact_job: CompactJob,
     runtime: Arc<Runtime>,
     vnodes: Arc<RwLock<HashMap<VnodeId, VnodeStorage>>>,
+    /// Snapshots of the backups, keep the files from being deleted until
+    /// they are downloaded.
+    backup_snapshots: Arc<parking_lot::Mutex<Vec<VnodeSnapshot>>>,
     metrics: Arc<MetricsRegister>,
     _memory_pool: Arc<dyn MemoryPool>,
     close_sender: BroadcastSender<Sender<()>>,
@@ -91,10 +97,12 @@ impl TsKv {
             metrics,
             runtime,
             vnodes: Default::default(),
+            backup_snapshots: Default::default(),
         };
 
         core.run_summary_job(summary, summary_task_receiver);
         core.run_flush_cold_vnode_job();
+        core.run_expire_backup_snapshots_job();
         core.compact_job
             .start_merge_compact_task_job(compact_task_receiver)
             .await;
@@ -161,6 +169,28 @@ impl TsKv {
         info!("Summary task handler started");
     }
 
+    /// Releases the snapshots of the backups not released after the snapshot
+    /// holding time, e.g. the node backing up failed before releasing them.
+    fn run_expire_backup_snapshots_job(&self) {
+        let holding_time = self.ctx.options.storage.snapshot_holding_time;
+        let backup_snapshots = self.backup_snapshots.clone();
+        self.runtime.spawn(async move {
+            let period = Duration::from_secs(holding_time.max(1) as u64);
+            let mut check_interval = tokio::time::interval(period);
+            loop {
+                check_interval.tick().await;
+                let now = now_timestamp_secs();
+                backup_snapshots.lock().retain(|s| {
+                    let expired = now - s.active_time >= holding_time;
+                    if expired {
+                        info!("Expire backup snapshot: {}", s);
+                    }
+                    !expired
+                });
+            }
+        });
+    }
+
     fn run_flush_cold_vnode_job(&self) {
         let tskv_ctx = self.ctx.clone();
         let compact_trigger_cold_duration = tskv_ctx.options.storage.compact_trigger_cold_duration;
@@ -285,6 +315,17 @@ impl Engine for TsKv {
             .get_tsfamily_or_else_create(vnode_id, database.clone())
             .await?;
 
+        // Keep the vnode frozen after restarting.
+        let status = self
+            .meta_manager
+            .tenant_meta(tenant)
+            .await
+            .and_then(|client| client.get_vnode_all_info(vnode_id))
+            .map(|info| info.status);
+        if status == Some(VnodeStatus::Frozen) {
+            ts_family.write().await.update_status(VnodeStatus::Frozen);
+        }
+
         let vnode = VnodeStorage::new(vnode_id, database, ts_index, ts_family, self.ctx.clone());
         self.vnodes.write().await.insert(vnode_id, vnode.clone());
 
@@ -315,6 +356,9 @@ impl Engine for TsKv {
                 Ok(()) => {
                     info!("Removed TsFamily directory '{}'", ts_dir.display());
                 }
+                Err(e) if e.kind() == std::io::ErrorKind::NotFound => {
+                    // Already moved away, e.g. by quarantine_tsfamily().
+                }
                 Err(e) => {
                     error!(
                         "Failed to remove TsFamily directory '{}': {}",
@@ -328,6 +372,43 @@ impl Engine for TsKv {
         Ok(())
     }
 
+    async fn quarantine_tsfamily(
+        &self,
+        tenant: &str,
+        database: &str,
+        vnode_id: VnodeId,
+    ) -> TskvResult<PathBuf> {
+        self.vnodes.write().await.remove(&vnode_id);
+
+        let owner = make_owner(tenant, database);
+        if let Some(db) = self.ctx.version_set.read().await.get_db(tenant, database) {
+            let mut db_wlock = db.write().await;
+            db_wlock.del_ts_index(vnode_id);
+            db_wlock
+                .del_tsfamily(vnode_id, self.ctx.summary_task_sender.clone())
+                .await;
+        }
+
+        let storage = &self.ctx.options.storage;
+        let ts_dir = storage.ts_family_dir(&owner, vnode_id);
+        let quarantine_dir = storage.quarantine_dir(&owner).join(format!(
+            "{}_{}",
+            vnode_id,
+            models::utils::now_timestamp_millis()
+        ));
+        if let Some(parent) = quarantine_dir.parent() {
+            std::fs::create_dir_all(parent).context(IOSnafu)?;
+        }
+        std::fs::rename(&ts_dir, &quarantine_dir).context(IOSnafu)?;
+        warn!(
+            "Quarantined TsFamily directory '{}' to '{}'",
+            ts_dir.display(),
+            quarantine_dir.display()
+        );
+
+        Ok(quarantine_dir)
+    }
+
     async fn flush_tsfamily(
         &self,
         _tenant: &str,
@@ -515,6 +596,178 @@ impl Engine for TsKv {
         Ok(RecordBatch::new_empty(check::vnode_table_checksum_schema()))
     }
 
+    async fn get_database_usages(&self) -> HashMap<String, DatabaseUsage> {
+        let mut usages = HashMap::new();
+        for (owner, database) in self.ctx.version_set.read().await.get_all_db() {
+            let db = database.read().await;
+            let mut usage = DatabaseUsage::default();
+            for ts_family in db.ts_families().values() {
+                usage.disk_size += ts_family.read().await.disk_storage();
+            }
+            for ts_index in db.ts_indexes().values() {
+                usage.series += ts_index.read().await.series_count();
+            }
+            usages.insert(owner.clone(), usage);
+        }
+
+        usages
+    }
+
+    async fn set_vnode_status(&self, vnode_id: VnodeId, status: VnodeStatus) -> TskvResult<()> {
+        match self
+            .ctx
+            .version_set
+            .read()
+            .await
+            .get_tsfamily_by_tf_id(vnode_id)
+            .await
+        {
+            Some(ts_family) => {
+                ts_family.write().await.update_status(status);
+                info!("Set status of vnode {} to {:?}", vnode_id, status);
+                Ok(())
+            }
+            None => Err(VnodeNotFoundSnafu { vnode_id }.build()),
+        }
+    }
+
+    async fn get_vnode_summaries(&self, vnode_ids: &[VnodeId]) -> Vec<VnodeSummary> {
+        let cold_duration = self.ctx.options.storage.compact_trigger_cold_duration;
+        let now = SystemTime::now();
+
+        let mut summaries = Vec::with_capacity(vnode_ids.len());
+        for database in self.ctx.version_set.read().await.get_all_db().values() {
+            let db = database.read().await;
+            for vnode_id in vnode_ids {
+                let ts_family = match db.get_tsfamily(*vnode_id) {
+                    Some(ts_family) => ts_family,
+                    None => continue,
+                };
+                let (disk_size, cache_size, last_modified) = {
+                    let ts_family = ts_family.read().await;
+                    (
+                        ts_family.disk_storage(),
+                        ts_family.cache_size(),
+                        ts_family.get_last_modified().await,
+                    )
+                };
+                let series = match db.get_ts_index(*vnode_id) {
+                    Some(ts_index) => ts_index.read().await.series_count(),
+                    None => 0,
+                };
+
+                let last_write_time = last_modified
+                    .and_then(|instant| now.checked_sub(instant.elapsed()))
+                    .and_then(|time| time.duration_since(UNIX_EPOCH).ok())
+                    .map(|duration| duration.as_nanos() as i64);
+                let cold = cache_size == 0
+                    && last_modified.map_or(true, |instant| instant.elapsed() >= cold_duration);
+
+                summaries.push(VnodeSummary {
+                    vnode_id: *vnode_id,
+                    disk_size,
+                    series,
+                    last_write_time,
+                    cold,
+                });
+            }
+        }
+
+        summaries
+    }
+
+    async fn get_series_sketches(
+        &self,
+        vnode_ids: &[VnodeId],
+        tables: &[String],
+    ) -> TskvResult<HashMap<String, HyperLogLog>> {
+        let mut sketches = HashMap::<String, HyperLogLog>::new();
+        for database in self.ctx.version_set.read().await.get_all_db().values() {
+            let db = database.read().await;
+            for vnode_id in vnode_ids {
+                let Some(ts_index) = db.get_ts_index(*vnode_id) else {
+                    continue;
+                };
+                let ts_index = ts_index.read().await;
+                for table in tables {
+                    let sketch = ts_index.series_sketch(table).await.context(IndexErrSnafu)?;
+                    sketches.entry(table.clone()).or_default().merge(&sketch);
+                }
+            }
+        }
+
+        Ok(sketches)
+    }
+
+    async fn get_tag_values(&self, tag: &str) -> TskvResult<Vec<VnodeTagValues>> {
+        let mut tag_values = vec![];
+        for database in self.ctx.version_set.read().await.get_all_db().values() {
+            let db = database.read().await;
+            let schemas = db.get_schemas();
+            let mut tag_columns = vec![];
+            for table in schemas.list_tables().await? {
+                let Some(schema) = schemas.get_table_schema(&table).await? else {
+                    continue;
+                };
+                if let Some(column) = schema.column(tag).filter(|c| c.column_type.is_tag()) {
+                    tag_columns.push((table, column.id.to_string()));
+                }
+            }
+            if tag_columns.is_empty() {
+                continue;
+            }
+
+            for (vnode_id, ts_index) in db.ts_indexes() {
+                let ts_index = ts_index.read().await;
+                for (table, tag_id) in &tag_columns {
+                    let values = ts_index
+                        .get_tag_values(table, tag_id)
+                        .context(IndexErrSnafu)?;
+                    if values.is_empty() {
+                        continue;
+                    }
+                    tag_values.push(VnodeTagValues {
+                        tenant: schemas.tenant_name().to_string(),
+                        database: schemas.database_name().to_string(),
+                        vnode_id,
+                        table: table.clone(),
+                        values: values
+                            .into_iter()
+                            .map(|v| String::from_utf8_lossy(&v).to_string())
+                            .collect(),
+                    });
+                }
+            }
+        }
+
+        Ok(tag_values)
+    }
+
+    async fn create_backup_snapshot(&self, vnode_id: VnodeId) -> TskvResult<VnodeSnapshot> {
+        let vnode_opt = self.vnodes.read().await.get(&vnode_id).cloned();
+        let Some(mut vnode) = vnode_opt else {
+            return Err(VnodeNotFoundSnafu { vnode_id }.build());
+        };
+        vnode.flush(true, true, false).await?;
+        let mut snapshot = vnode.create_snapshot().await?;
+        snapshot.active_time = now_timestamp_secs();
+
+        self.backup_snapshots.lock().push(snapshot.clone());
+        info!("Create backup snapshot: {}", snapshot);
+
+        Ok(snapshot)
+    }
+
+    async fn release_backup_snapshot(&self, vnode_id: VnodeId, create_time: &str) {
+        self.backup_snapshots.lock().retain(|s| {
+            let release = s.vnode_id == vnode_id && s.create_time == create_time;
+            if release {
+                info!("Release backup snapshot: {}", s);
+            }
+            !release
+        });
+    }
+
     async fn close(&self) {
         let (tx, mut rx) = mpsc::channel(1);
         if let Err(e) = self.close_sender.send(tx) {
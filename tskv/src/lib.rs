@@ -1,6 +1,8 @@
 #![recursion_limit = "256"]
 
+use std::collections::{BTreeSet, HashMap};
 use std::fmt::{Debug, Display, Formatter};
+use std::path::PathBuf;
 use std::sync::Arc;
 
 use async_trait::async_trait;
@@ -8,7 +10,7 @@ pub use compaction::check::vnode_table_checksum_schema;
 use compaction::CompactTask;
 use context::GlobalContext;
 use datafusion::arrow::record_batch::RecordBatch;
-use models::meta_data::{NodeId, VnodeId};
+use models::meta_data::{DatabaseUsage, NodeId, VnodeId, VnodeStatus, VnodeSummary};
 use models::predicate::domain::ColumnDomains;
 use models::{SeriesId, SeriesKey};
 use serde::{Deserialize, Serialize};
@@ -17,6 +19,7 @@ use tokio::runtime::Runtime;
 use tokio::sync::mpsc::Sender;
 use tokio::sync::RwLock;
 use tsfamily::version::Version;
+use utils::HyperLogLog;
 use version_set::VersionSet;
 use vnode_store::VnodeStorage;
 
@@ -67,6 +70,16 @@ pub struct UpdateSetValue<K, V> {
     pub value: Option<V>,
 }
 
+/// The values of a tag of the series of a table in a vnode.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct VnodeTagValues {
+    pub tenant: String,
+    pub database: String,
+    pub vnode_id: VnodeId,
+    pub table: String,
+    pub values: BTreeSet<String>,
+}
+
 #[async_trait]
 pub trait Engine: Send + Sync + Debug {
     /// open a tsfamily, if already exist just return.
@@ -86,6 +99,16 @@ pub trait Engine: Send + Sync + Debug {
         vnode_id: VnodeId,
     ) -> TskvResult<()>;
 
+    /// Remove the storage unit from engine like `remove_tsfamily`, but move
+    /// its directory into the quarantine directory instead of deleting it,
+    /// returns the quarantined path.
+    async fn quarantine_tsfamily(
+        &self,
+        tenant: &str,
+        database: &str,
+        vnode_id: VnodeId,
+    ) -> TskvResult<PathBuf>;
+
     /// Flush all caches of the storage unit into a file.
     async fn flush_tsfamily(
         &self,
@@ -134,6 +157,37 @@ pub trait Engine: Send + Sync + Debug {
     /// Get a compressed hash_tree(ID and checksum of each vnode) of engine.
     async fn get_vnode_hash_tree(&self, vnode_id: VnodeId) -> TskvResult<RecordBatch>;
 
+    /// Get the resource usage of all databases on this node, keyed by the owner of database.
+    async fn get_database_usages(&self) -> HashMap<String, DatabaseUsage>;
+
+    /// Set status of the storage unit, frozen storage unit rejects writes and compactions.
+    async fn set_vnode_status(&self, vnode_id: VnodeId, status: VnodeStatus) -> TskvResult<()>;
+
+    /// Get the storage state of the specified vnodes on this node,
+    /// vnodes not found are ignored.
+    async fn get_vnode_summaries(&self, vnode_ids: &[VnodeId]) -> Vec<VnodeSummary>;
+
+    /// Get the sketches of the series of the tables merged from the specified
+    /// vnodes on this node, vnodes not found are ignored.
+    async fn get_series_sketches(
+        &self,
+        vnode_ids: &[VnodeId],
+        tables: &[String],
+    ) -> TskvResult<HashMap<String, HyperLogLog>>;
+
+    /// Get the values of the tag of the series in the vnodes on this node
+    /// from the indexes, the tables without the tag are omitted.
+    async fn get_tag_values(&self, tag: &str) -> TskvResult<Vec<VnodeTagValues>>;
+
+    /// Flush the caches of the storage unit, then create a snapshot of its
+    /// files to backup, the files are kept until the snapshot is released or
+    /// the snapshot holding time passed.
+    async fn create_backup_snapshot(&self, vnode_id: VnodeId) -> TskvResult<VnodeSnapshot>;
+
+    /// Release the snapshot of the backup once its files are downloaded,
+    /// the snapshots not found are ignored.
+    async fn release_backup_snapshot(&self, vnode_id: VnodeId, create_time: &str);
+
     /// Close all background jobs of engine.
     async fn close(&self);
 }
@@ -7,7 +7,7 @@ use models::meta_data::VnodeId;
 use models::predicate::domain::{TimeRange, TimeRanges};
 use models::schema::tskv_table_schema::TableColumn;
 use models::{ColumnId, RwLockRef, SeriesId, SeriesKey, Timestamp};
-use parking_lot::RwLock;
+use parking_lot::{Mutex, RwLock};
 
 use super::series_data::{RowGroup, SeriesData};
 use crate::error::{MemoryExhaustedSnafu, TskvResult};
@@ -26,6 +26,22 @@ impl MemCacheStatistics {
     }
 }
 
+/// Statistics of a partition of the cache, to see how the writes spread.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct MemCachePartitionStatistics {
+    pub series_count: usize,
+    pub write_count: u64,
+    pub size: u64,
+}
+
+/// The memory and the statistics of a partition, kept apart from the series
+/// map so that writing the existing series of a partition doesn't lock it.
+#[derive(Debug)]
+struct PartitionState {
+    memory: Mutex<MemoryReservation>,
+    write_count: AtomicU64,
+}
+
 #[derive(Debug)]
 pub struct MemCache {
     tf_id: VnodeId,
@@ -38,10 +54,12 @@ pub struct MemCache {
 
     // wal seq number
     seq_no: AtomicU64,
-    memory: RwLock<MemoryReservation>,
+    // the sum of the memory of the partitions
+    size: AtomicU64,
 
     part_count: usize,
     partions: Vec<RwLock<HashMap<SeriesId, RwLockRef<SeriesData>>>>,
+    part_states: Vec<PartitionState>,
 }
 
 pub struct MemCacheSeriesScanIterator {
@@ -93,11 +111,15 @@ impl MemCache {
         pool: &MemoryPoolRef,
     ) -> Self {
         let mut partions = Vec::with_capacity(part_count);
-        for _i in 0..part_count {
+        let mut part_states = Vec::with_capacity(part_count);
+        for i in 0..part_count {
             partions.push(RwLock::new(HashMap::new()));
+            let memory = MemoryConsumer::new(format!("memcache-{}-{}-{}", tf_id, seq, i));
+            part_states.push(PartitionState {
+                memory: Mutex::new(memory.register(pool)),
+                write_count: AtomicU64::new(0),
+            });
         }
-        let res =
-            RwLock::new(MemoryConsumer::new(format!("memcache-{}-{}", tf_id, seq)).register(pool));
         Self {
             tf_id,
             file_id,
@@ -109,9 +131,10 @@ impl MemCache {
 
             part_count,
             partions,
+            part_states,
 
             seq_no: AtomicU64::new(seq),
-            memory: res,
+            size: AtomicU64::new(0),
         }
     }
 
@@ -123,22 +146,28 @@ impl MemCache {
         group: RowGroup,
     ) -> TskvResult<()> {
         self.seq_no.store(seq, Ordering::Relaxed);
-        self.memory
-            .write()
+        let index = (sid as usize) % self.part_count;
+        let part_state = &self.part_states[index];
+        part_state
+            .memory
+            .lock()
             .try_grow(group.size)
             .map_err(|_| MemoryExhaustedSnafu.build())?;
-        let index = (sid as usize) % self.part_count;
-        let mut series_map = self.partions[index].write();
-        if let Some(series_data) = series_map.get(&sid) {
-            let series_data_ptr = series_data.clone();
-            let mut series_data_ptr_w = series_data_ptr.write();
-            drop(series_map);
-            series_data_ptr_w.write(group);
-        } else {
-            let mut series_data = SeriesData::new(sid, series_key);
-            series_data.write(group);
-            series_map.insert(sid, Arc::new(RwLock::new(series_data)));
-        }
+        self.size.fetch_add(group.size as u64, Ordering::Relaxed);
+        part_state.write_count.fetch_add(1, Ordering::Relaxed);
+
+        // most of the writes are to the existing series, only lock the
+        // partition for write to insert a new series
+        let series_data = self.partions[index].read().get(&sid).cloned();
+        let series_data = match series_data {
+            Some(series_data) => series_data,
+            None => self.partions[index]
+                .write()
+                .entry(sid)
+                .or_insert_with(|| Arc::new(RwLock::new(SeriesData::new(sid, series_key))))
+                .clone(),
+        };
+        series_data.write().write(group);
         Ok(())
     }
 
@@ -289,7 +318,7 @@ impl MemCache {
     }
 
     pub fn is_full(&self) -> bool {
-        self.memory.read().size() >= self.max_size as usize
+        self.cache_size() >= self.max_size
     }
 
     pub fn tf_id(&self) -> VnodeId {
@@ -313,7 +342,19 @@ impl MemCache {
     }
 
     pub fn cache_size(&self) -> u64 {
-        self.memory.read().size() as u64
+        self.size.load(Ordering::Relaxed)
+    }
+
+    pub fn partition_statistics(&self) -> Vec<MemCachePartitionStatistics> {
+        self.partions
+            .iter()
+            .zip(self.part_states.iter())
+            .map(|(series, state)| MemCachePartitionStatistics {
+                series_count: series.read().len(),
+                write_count: state.write_count.load(Ordering::Relaxed),
+                size: state.memory.lock().size() as u64,
+            })
+            .collect()
     }
 }
 
@@ -411,6 +452,7 @@ mod test_memcache {
     use models::schema::tskv_table_schema::{ColumnType, TableColumn, TskvTableSchema};
     use models::{SeriesId, SeriesKey, ValueType};
 
+    use super::test::put_rows_to_cache;
     use super::MemCache;
     use crate::mem_cache::row_data::{OrderedRowsData, RowData, RowDataRef};
     use crate::mem_cache::series_data::{RowGroup, SeriesData, SeriesDedupMergeSortIterator};
@@ -1146,4 +1188,46 @@ mod test_memcache {
 
         assert_eq!(iter.next(), None);
     }
+
+    #[test]
+    fn test_mem_cache_concurrent_write() {
+        let memory_pool: Arc<dyn MemoryPool> = Arc::new(GreedyMemoryPool::new(1024 * 1024 * 1024));
+        let mem_cache = MemCache::new(1, 0, u64::MAX, 4, 1, &memory_pool);
+        #[rustfmt::skip]
+        let schema = TskvTableSchema::new(
+            "test_tenant".to_string(), "test_db".to_string(), "test_table".to_string(),
+            vec![
+                TableColumn::new_time_column(1, TimeUnit::Nanosecond),
+                TableColumn::new(2, "f_col_1".to_string(), ColumnType::Field(ValueType::Float), Default::default()),
+            ],
+        );
+
+        // 8 threads write series 0..16, every series twice
+        std::thread::scope(|s| {
+            for t in 0..8 {
+                let mem_cache = &mem_cache;
+                let schema = schema.clone();
+                s.spawn(move || {
+                    for sid in 0..16 {
+                        if sid % 4 == t % 4 {
+                            put_rows_to_cache(mem_cache, sid, 1, schema.clone(), (1, 10), false);
+                        }
+                    }
+                });
+            }
+        });
+
+        let statistics = mem_cache.partition_statistics();
+        assert_eq!(statistics.len(), 4);
+        for part in statistics.iter() {
+            assert_eq!(part.series_count, 4);
+            assert_eq!(part.write_count, 8);
+        }
+        let size: u64 = statistics.iter().map(|p| p.size).sum();
+        assert_eq!(size, mem_cache.cache_size());
+        for sid in 0..16 {
+            let series_data = mem_cache.read_series_data_by_id(sid).unwrap();
+            assert_eq!(series_data.read().groups.len(), 2);
+        }
+    }
 }
@@ -55,7 +55,7 @@ mod tests {
     use arrow::datatypes::{DataType, Field, Schema, SchemaRef, TimeUnit};
     use datafusion::logical_expr::{BuiltinScalarFunction, Operator};
     use datafusion::physical_expr::execution_props::ExecutionProps;
-    use datafusion::physical_plan::expressions::{lit, BinaryExpr, Column};
+    use datafusion::physical_plan::expressions::{lit, BinaryExpr, Column, IsNullExpr};
     use datafusion::physical_plan::functions::create_physical_expr;
     use datafusion::scalar::ScalarValue;
     use models::schema::tskv_table_schema::{ColumnType, TableColumn};
@@ -123,8 +123,8 @@ mod tests {
             Default::default(),
         );
         let field_statistics = vec![
-            PageStatistics::I64(ValueStatistics::new(Some(0), Some(5), None, 1)),
-            PageStatistics::I64(ValueStatistics::new(Some(4), Some(6), None, 1)),
+            PageStatistics::I64(ValueStatistics::new(Some(0), Some(5), None, 0)),
+            PageStatistics::I64(ValueStatistics::new(Some(4), Some(6), None, 0)),
             PageStatistics::I64(ValueStatistics::new(None, Some(4), None, 1)),
             PageStatistics::I64(ValueStatistics::new(Some(3), None, None, 1)),
         ];
@@ -280,6 +280,33 @@ mod tests {
         assert_eq!(cgs, vec![true, true, true, true]);
     }
 
+    #[test]
+    fn test_filter_field_value_column_groups_indices() {
+        let schema = schema();
+        let data = data();
+        let expr = Arc::new(BinaryExpr::new(
+            Arc::new(Column::new("field1", 0)),
+            Operator::Gt,
+            lit(ScalarValue::Int64(Some(5))),
+        ));
+        let predicate = Arc::new(Predicate::new(Some(expr), schema.clone(), None));
+
+        let cgs = filter_column_groups_indices(&data, &Some(predicate), schema.clone())
+            .unwrap()
+            .unwrap();
+
+        assert_eq!(cgs, vec![false, true, false, true]);
+
+        let expr = Arc::new(IsNullExpr::new(Arc::new(Column::new("field1", 0))));
+        let predicate = Arc::new(Predicate::new(Some(expr), schema.clone(), None));
+
+        let cgs = filter_column_groups_indices(&data, &Some(predicate), schema)
+            .unwrap()
+            .unwrap();
+
+        assert_eq!(cgs, vec![false, false, true, true]);
+    }
+
     #[test]
     fn test_filter_not_exists_column_groups_indices() {
         let schema = schema();
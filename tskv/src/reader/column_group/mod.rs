@@ -20,11 +20,13 @@ use super::{
 use crate::tsm::column_group::ColumnGroup;
 use crate::tsm::page::PageWriteSpec;
 use crate::tsm::reader::{decode_pages, TsmReader};
+use crate::tsm::tombstone::TsmTombstoneCache;
 use crate::TskvResult;
 
 pub struct ColumnGroupReader {
     column_group: Arc<ColumnGroup>,
     reader: Arc<TsmReader>,
+    tombstone: Arc<TsmTombstoneCache>,
     series_id: SeriesId,
     pages_meta: Vec<PageWriteSpec>,
     schema: SchemaRef,
@@ -33,6 +35,7 @@ pub struct ColumnGroupReader {
 impl ColumnGroupReader {
     pub fn try_new(
         reader: Arc<TsmReader>,
+        tombstone: Arc<TsmTombstoneCache>,
         series_id: SeriesId,
         column_group: Arc<ColumnGroup>,
         projection: &[ColumnId],
@@ -62,6 +65,7 @@ impl ColumnGroupReader {
         Ok(Self {
             column_group,
             reader,
+            tombstone,
             series_id,
             pages_meta,
             schema,
@@ -74,6 +78,7 @@ impl BatchReader for ColumnGroupReader {
     fn process(&self) -> TskvResult<SendableSchemableTskvRecordBatchStream> {
         let stream = Box::pin(futures::stream::once(read(
             self.reader.clone(),
+            self.tombstone.clone(),
             self.series_id,
             self.pages_meta.clone(),
             self.schema.metadata().clone(),
@@ -194,6 +199,7 @@ impl ColumnGroupReaderMetrics {
 
 async fn read(
     reader: Arc<TsmReader>,
+    tombstone: Arc<TsmTombstoneCache>,
     series_id: SeriesId,
     pages_meta: Vec<PageWriteSpec>,
     schema_meta: HashMap<String, String>,
@@ -215,7 +221,7 @@ async fn read(
     }
 
     let _timer = metrics.elapsed_pages_to_record_batch_time().timer();
-    let record_batch = decode_pages(pages, schema_meta, Some((reader.tombstone(), series_id)))?;
+    let record_batch = decode_pages(pages, schema_meta, Some((tombstone, series_id)))?;
     Ok(record_batch)
 }
 
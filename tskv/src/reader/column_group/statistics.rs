@@ -1,7 +1,7 @@
 use std::sync::Arc;
 
 use arrow::datatypes::DataType;
-use arrow_array::ArrayRef;
+use arrow_array::{ArrayRef, UInt64Array};
 use datafusion::physical_optimizer::pruning::PruningStatistics;
 use datafusion::scalar::ScalarValue;
 
@@ -75,7 +75,15 @@ impl<'a> PruningStatistics for ColumnGroupsStatisticsWrapper<'a> {
         self.0.len()
     }
 
-    fn null_counts(&self, _column: &datafusion::prelude::Column) -> Option<ArrayRef> {
-        None
+    fn null_counts(&self, column: &datafusion::prelude::Column) -> Option<ArrayRef> {
+        let values = self.0.iter().map(|cg| {
+            cg.pages()
+                .iter()
+                .find(|e| e.meta.column.name == column.name)
+                // all the values are null if the column group has no such column
+                .map_or(cg.row_len() as u64, |e| e.meta().statistics.null_count())
+        });
+
+        Some(Arc::new(UInt64Array::from_iter_values(values)))
     }
 }
@@ -39,8 +39,12 @@ use crate::reader::chunk::filter_column_groups;
 use crate::reader::column_group::ColumnGroupReader;
 use crate::reader::filter::DataFilter;
 use crate::reader::function_register::NoRegistry;
+use crate::reader::last_rows::LastRowsBatchReader;
 use crate::reader::paralle_merge::ParallelMergeAdapter;
+use crate::reader::prefetch::PrefetchBatchReader;
+use crate::reader::sample::SampleBatchReader;
 use crate::reader::schema_alignmenter::SchemaAlignmenter;
+use crate::reader::top_k::TopKBatchReader;
 use crate::reader::trace::TraceCollectorBatcherReaderProxy;
 use crate::reader::utils::group_overlapping_segments;
 use crate::reader::{BatchReaderRef, CombinedBatchReader};
@@ -49,12 +53,14 @@ use crate::tsfamily::cache_group::CacheGroup;
 use crate::tsfamily::column_file::ColumnFile;
 use crate::tsfamily::super_version::SuperVersion;
 use crate::tsm::reader::TsmReader;
+use crate::tsm::tombstone::TsmTombstoneCache;
 use crate::EngineRef;
 
 pub struct SeriesGroupBatchReaderFactory {
     engine: EngineRef,
     query_option: QueryOption,
     super_version: Arc<SuperVersion>,
+    read_ahead: usize,
 
     span: Span,
     metrics_set: ExecutionPlanMetricsSet,
@@ -73,10 +79,12 @@ impl SeriesGroupBatchReaderFactory {
         span: Span,
         metrics_set: ExecutionPlanMetricsSet,
     ) -> Self {
+        let read_ahead = engine.get_storage_options().max_read_ahead_column_groups;
         Self {
             engine,
             query_option,
             super_version,
+            read_ahead,
             span,
             metrics_set,
             series_reader_metrics_set: Arc::new(ExecutionPlanMetricsSet::new()),
@@ -137,6 +145,27 @@ impl SeriesGroupBatchReaderFactory {
             return Ok(None);
         }
 
+        let super_version = &self.super_version;
+        let vnode_id = super_version.ts_family_id;
+        // 通过sid获取serieskey
+        let sid_keys = {
+            let _timer = metrics.elapsed_get_series_keys_time().timer();
+            self.series_keys(vnode_id, series_ids).await?
+        };
+        // 按 series key 的哈希值采样时，只读取采样到的 series
+        let (series_ids, sid_keys): (Vec<_>, Vec<_>) = match self.query_option.split.sample() {
+            Some(sample) => series_ids
+                .iter()
+                .copied()
+                .zip(sid_keys)
+                .filter(|(_, key)| sample.contains_series(key.hash()))
+                .unzip(),
+            None => (series_ids.to_vec(), sid_keys),
+        };
+        if series_ids.is_empty() {
+            return Ok(None);
+        }
+
         // 采集读取的 series 数量
         metrics.series_nums().set(series_ids.len());
 
@@ -150,13 +179,11 @@ impl SeriesGroupBatchReaderFactory {
             schema.clone()
         };
 
-        let super_version = &self.super_version;
-        let vnode_id = super_version.ts_family_id;
         // TODO time column id 需要从上面传下来，当前schema中一定包含time列，所以这里写死为0
         let projection = Projection::from_schema(kv_schema.as_ref(), 0);
         let time_ranges = self.query_option.split.time_ranges();
         let column_files = super_version
-            .column_files_by_sid_and_time(series_ids, time_ranges.as_ref())
+            .column_files_by_sid_and_time(&series_ids, time_ranges.as_ref())
             .await?;
 
         // 采集过滤后的文件数量
@@ -170,16 +197,12 @@ impl SeriesGroupBatchReaderFactory {
             let _timer = metrics.elapsed_get_tsm_readers_time().timer();
             for f in column_files {
                 let reader = super_version.version.get_tsm_reader(f.file_path()).await?;
-                column_files_with_reader.push((f, reader));
+                // a delta compaction may replace the tombstones while reading
+                let tombstone = reader.tombstone().snapshot();
+                column_files_with_reader.push((f, reader, tombstone));
             }
         }
 
-        // 通过sid获取serieskey
-        let sid_keys = {
-            let _timer = metrics.elapsed_get_series_keys_time().timer();
-            self.series_keys(vnode_id, series_ids).await?
-        };
-
         // 获取所有的符合条件的chunk Vec<(SeriesKey, Vec<DataReference>)>
         let mut series_chunk_readers = Vec::with_capacity(series_ids.len());
         for (sid, series_key) in series_ids.iter().zip(sid_keys) {
@@ -286,19 +309,19 @@ impl SeriesGroupBatchReaderFactory {
 
     /// 从给定的文件列表中选择含有指定series的所有chunk及其对应的TsmReader
     async fn filter_chunks(
-        column_files: &[(Arc<ColumnFile>, Arc<TsmReader>)],
+        column_files: &[(Arc<ColumnFile>, Arc<TsmReader>, Arc<TsmTombstoneCache>)],
         sid: SeriesId,
     ) -> TskvResult<Vec<DataReference>> {
         // 选择含有series的所有文件
         let mut files = Vec::new();
-        for (cf, reader) in column_files {
+        for (cf, reader, tombstone) in column_files {
             if cf.maybe_contains_series_id(sid).await? {
-                files.push((cf.clone(), reader.clone()));
+                files.push((cf.clone(), reader.clone(), tombstone.clone()));
             }
         }
         // 选择含有series的所有chunk
         let mut chunks = Vec::with_capacity(files.len());
-        for (cf, reader) in files {
+        for (cf, reader, tombstone) in files {
             let chunk = reader.chunk().get(&sid);
             match chunk {
                 None => continue,
@@ -307,6 +330,7 @@ impl SeriesGroupBatchReaderFactory {
                         chunk.clone(),
                         reader.clone(),
                         cf.clone(),
+                        tombstone,
                     ));
                 }
             }
@@ -359,7 +383,7 @@ impl SeriesGroupBatchReaderFactory {
             )?)))
         } else {
             let chunk_reader: Option<BatchReaderRef> = match chunk {
-                DataReference::Chunk(chunk, reader, _) => {
+                DataReference::Chunk(chunk, reader, _, tombstone) => {
                     let chunk_schema =
                         chunk.schema_with_metadata(self.query_option.schema_meta.clone());
                     let cgs = chunk.column_group().values().cloned().collect::<Vec<_>>();
@@ -369,12 +393,17 @@ impl SeriesGroupBatchReaderFactory {
                     let cgs = filter_column_groups(cgs, predicate, chunk_schema.clone())?;
                     debug!("Filtered column group nums: {}", cgs.len());
                     metrics.filtered_column_group_nums().add(cgs.len());
+                    if cgs.is_empty() {
+                        // no value of the chunk matches the predicate
+                        return Ok(None);
+                    }
 
                     let batch_readers = cgs
                         .into_iter()
                         .map(|e| {
                             let column_group_reader = ColumnGroupReader::try_new(
                                 reader.clone(),
+                                tombstone.clone(),
                                 chunk.series_id(),
                                 e,
                                 projection,
@@ -386,7 +415,10 @@ impl SeriesGroupBatchReaderFactory {
                         })
                         .collect::<TskvResult<Vec<_>>>()?;
 
-                    Some(Arc::new(CombinedBatchReader::new(batch_readers)))
+                    Some(Arc::new(PrefetchBatchReader::new(
+                        batch_readers,
+                        self.read_ahead,
+                    )))
                 }
                 DataReference::Memcache(series_data, time_ranges, _) => MemCacheReader::try_new(
                     series_data,
@@ -436,7 +468,7 @@ impl SeriesGroupBatchReaderFactory {
                 DataReference::Memcache(..) => {
                     only_tsm = false;
                 }
-                DataReference::Chunk(.., ref file) if file.is_delta() => {
+                DataReference::Chunk(_, _, ref file, _) if file.is_delta() => {
                     only_tsm = false;
                 }
                 _ => {}
@@ -542,19 +574,35 @@ impl SeriesGroupBatchReaderFactory {
         let limit = predicate.as_ref().and_then(|p| p.limit());
         // 根据 series key 补齐对应的 tag 列
         if self.query_option.aggregates.is_none() {
+            let reader: BatchReaderRef = match self.query_option.split.last_rows() {
+                // 只需要每个 series 最新的若干行时，从最新的 chunk 开始倒序读取
+                Some(last_rows) => Arc::new(LastRowsBatchReader::new(readers, last_rows)),
+                None => Arc::new(CombinedBatchReader::new(readers)),
+            };
+            // 只需要部分采样的行时，在补齐 tag 列之前按比例丢弃其余的行
+            let reader: BatchReaderRef =
+                match self.query_option.split.sample().and_then(|s| s.percent) {
+                    Some(percent) => Arc::new(SampleBatchReader::new(reader, percent)),
+                    None => reader,
+                };
             let series_reader = Arc::new(SeriesReader::new(
                 series_key,
-                Arc::new(CombinedBatchReader::new(readers)),
+                reader,
                 query_schema,
                 self.series_reader_metrics_set.clone(),
                 limit,
             ));
             // 用 Null 值补齐缺失的 tag 列
-            let reader = Arc::new(SchemaAlignmenter::new(
+            let reader: BatchReaderRef = Arc::new(SchemaAlignmenter::new(
                 series_reader,
                 schema,
                 self.schema_align_reader_metrics_set.clone(),
             ));
+            // 只需要排序后的前若干行时，每个 series 只保留其中的前若干行
+            let reader: BatchReaderRef = match self.query_option.split.top_k() {
+                Some(top_k) => Arc::new(TopKBatchReader::new(reader, top_k.clone())),
+                None => reader,
+            };
 
             Ok(Some(reader))
         } else {
@@ -858,6 +906,10 @@ impl Drop for RowIterator {
     }
 }
 
+/// Times to build the stream of a vnode again if its version changes meanwhile,
+/// the query fails if the version still changes after that.
+const MAX_BUILD_STREAM_RETRIES: usize = 3;
+
 pub async fn execute(
     runtime: Arc<Runtime>,
     engine: EngineRef,
@@ -865,33 +917,45 @@ pub async fn execute(
     vnode_id: VnodeId,
     span: Span,
 ) -> TskvResult<SendableTskvRecordBatchStream> {
-    let super_version = {
-        let span = Span::enter_with_parent("get super version", &span);
-        engine
-            .get_db_version(
-                &query_option.table_schema.tenant,
-                &query_option.table_schema.db,
-                vnode_id,
-            )
-            .await
-            .map_err(|err| {
-                span.error(err.to_string());
-                err
-            })?
-    };
-
     let schema = query_option.df_schema.clone();
 
-    if let Some(super_version) = super_version {
-        return build_stream(
-            runtime,
-            super_version,
-            engine,
-            query_option,
+    let mut super_version = get_super_version(&engine, &query_option, vnode_id, &span).await?;
+    let mut retries = 0;
+    while let Some(version) = super_version {
+        let version_number = version.version_number;
+        let stream = build_stream(
+            runtime.clone(),
+            version,
+            engine.clone(),
+            query_option.clone(),
             vnode_id,
             Span::enter_with_parent("build stream", &span),
         )
-        .await;
+        .await?;
+
+        // The tombstones of the files are taken after the version, build the
+        // stream again if a compaction replaced them with a new version between.
+        super_version = get_super_version(&engine, &query_option, vnode_id, &span).await?;
+        let current_version_number = super_version.as_ref().map(|v| v.version_number);
+        if current_version_number == Some(version_number) {
+            return Ok(stream);
+        }
+        // the stream may read the old files with the tombstones of the new
+        // version, it's never returned
+        drop(stream);
+        if retries >= MAX_BUILD_STREAM_RETRIES {
+            return Err(CommonSnafu {
+                reason: format!(
+                    "version of vnode {vnode_id} keeps changing while building stream, \
+                    retried {retries} times, please retry the query later"
+                ),
+            }
+            .build());
+        }
+        retries += 1;
+        debug!(
+            "Version of vnode {vnode_id} changed from {version_number} to {current_version_number:?} while building stream, retry {retries}"
+        );
     }
 
     if query_option.aggregates.is_some() {
@@ -905,6 +969,26 @@ pub async fn execute(
     }
 }
 
+async fn get_super_version(
+    engine: &EngineRef,
+    query_option: &QueryOption,
+    vnode_id: VnodeId,
+    span: &Span,
+) -> TskvResult<Option<Arc<SuperVersion>>> {
+    let span = Span::enter_with_parent("get super version", span);
+    engine
+        .get_db_version(
+            &query_option.table_schema.tenant,
+            &query_option.table_schema.db,
+            vnode_id,
+        )
+        .await
+        .map_err(|err| {
+            span.error(err.to_string());
+            err
+        })
+}
+
 async fn build_stream(
     _runtime: Arc<Runtime>,
     super_version: Arc<SuperVersion>,
@@ -913,7 +997,7 @@ async fn build_stream(
     vnode_id: VnodeId,
     span: Span,
 ) -> TskvResult<SendableTskvRecordBatchStream> {
-    let series_ids = {
+    let mut series_ids = {
         let span = Span::enter_with_parent("get series ids by filter", &span);
         engine
             .get_series_id_by_filter(
@@ -929,6 +1013,9 @@ async fn build_stream(
                 err
             })?
     };
+    if let Some(series_range) = query_option.split.series_range() {
+        series_ids = series_range.apply(series_ids);
+    }
 
     // TODO 这里需要验证table schema是否正确
     let expr = query_option.split.filter();
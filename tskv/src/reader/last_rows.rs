@@ -0,0 +1,120 @@
+use futures::{future, StreamExt, TryStreamExt};
+
+use super::utils::BoxedSchemableRecordBatchStream;
+use super::{
+    BatchReader, BatchReaderRef, CombinedBatchReader, SchemableTskvRecordBatchStream,
+    SendableSchemableTskvRecordBatchStream,
+};
+use crate::TskvResult;
+
+/// Reads the inputs from the last one backwards, and stops once `last_rows`
+/// rows are read, the inputs must be ordered by time and not overlapped.
+///
+/// The output is not ordered by time, it contains at least the latest
+/// `last_rows` rows of the inputs.
+pub struct LastRowsBatchReader {
+    readers: Vec<BatchReaderRef>,
+    last_rows: usize,
+}
+
+impl LastRowsBatchReader {
+    pub fn new(readers: Vec<BatchReaderRef>, last_rows: usize) -> Self {
+        Self { readers, last_rows }
+    }
+}
+
+impl BatchReader for LastRowsBatchReader {
+    fn process(&self) -> TskvResult<SendableSchemableTskvRecordBatchStream> {
+        if self.readers.is_empty() {
+            return CombinedBatchReader::new(vec![]).process();
+        }
+
+        let streams = self
+            .readers
+            .iter()
+            .rev()
+            .map(|e| e.process())
+            .collect::<TskvResult<Vec<_>>>()?;
+        let schema = streams[0].schema();
+
+        let last_rows = self.last_rows;
+        let stream = futures::stream::iter(streams)
+            .then(|s| s.try_collect::<Vec<_>>())
+            .scan(0_usize, move |num_rows, batches| {
+                if *num_rows >= last_rows {
+                    return future::ready(None);
+                }
+                if let Ok(batches) = &batches {
+                    *num_rows += batches.iter().map(|b| b.num_rows()).sum::<usize>();
+                }
+                future::ready(Some(batches))
+            })
+            .map_ok(|batches| futures::stream::iter(batches.into_iter().map(Ok)))
+            .try_flatten();
+
+        Ok(Box::pin(BoxedSchemableRecordBatchStream::new(
+            schema,
+            Box::pin(stream),
+        )))
+    }
+
+    fn fmt_as(&self, f: &mut std::fmt::Formatter) -> std::fmt::Result {
+        write!(
+            f,
+            "LastRowsBatchReader: size={}, last_rows={}",
+            self.readers.len(),
+            self.last_rows
+        )
+    }
+
+    fn children(&self) -> Vec<BatchReaderRef> {
+        self.readers.clone()
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use arrow::datatypes::{DataType, Field, Schema};
+    use arrow_array::{Int64Array, RecordBatch};
+    use futures::TryStreamExt;
+
+    use super::LastRowsBatchReader;
+    use crate::reader::{BatchReader, BatchReaderRef, MemoryBatchReader};
+
+    #[tokio::test]
+    async fn test_last_rows_batch_reader() {
+        let schema = Arc::new(Schema::new(vec![Field::new(
+            "time",
+            DataType::Int64,
+            false,
+        )]));
+        let readers = [vec![1, 2, 3], vec![4, 5], vec![6, 7]]
+            .into_iter()
+            .map(|times| {
+                let batch =
+                    RecordBatch::try_new(schema.clone(), vec![Arc::new(Int64Array::from(times))])
+                        .unwrap();
+                Arc::new(MemoryBatchReader::new(schema.clone(), vec![batch])) as BatchReaderRef
+            })
+            .collect::<Vec<_>>();
+
+        let reader = LastRowsBatchReader::new(readers, 3);
+        let batches = reader
+            .process()
+            .unwrap()
+            .try_collect::<Vec<_>>()
+            .await
+            .unwrap();
+
+        let times = batches
+            .iter()
+            .flat_map(|b| {
+                let array = b.column(0).as_any().downcast_ref::<Int64Array>().unwrap();
+                array.values().to_vec()
+            })
+            .collect::<Vec<_>>();
+        assert_eq!(times, vec![6, 7, 4, 5]);
+    }
+}
@@ -26,6 +26,7 @@ use crate::mem_cache::series_data::SeriesData;
 use crate::tsfamily::column_file::ColumnFile;
 use crate::tsm::chunk::Chunk;
 use crate::tsm::reader::TsmReader;
+use crate::tsm::tombstone::TsmTombstoneCache;
 use crate::{ColumnFileId, TskvError, TskvResult};
 
 mod batch_builder;
@@ -36,14 +37,18 @@ pub mod filter;
 mod function_register;
 
 mod iterator;
+mod last_rows;
 mod memcache_reader;
 mod merge;
 mod metrics;
 mod paralle_merge;
 mod partitioned_stream;
+mod prefetch;
 mod pushdown_agg_reader;
+mod sample;
 mod schema_alignmenter;
 mod series;
+mod top_k;
 mod trace;
 mod utils;
 mod visitor;
@@ -280,7 +285,14 @@ impl Stream for SchemableMemoryBatchReaderStream {
 
 #[derive(Clone)]
 pub enum DataReference {
-    Chunk(Arc<Chunk>, Arc<TsmReader>, Arc<ColumnFile>),
+    /// A chunk of a file, read with the tombstones of the file when the query
+    /// started.
+    Chunk(
+        Arc<Chunk>,
+        Arc<TsmReader>,
+        Arc<ColumnFile>,
+        Arc<TsmTombstoneCache>,
+    ),
     Memcache(Arc<RwLock<SeriesData>>, Arc<TimeRanges>, ColumnFileId),
 }
 
@@ -289,9 +301,9 @@ impl Eq for DataReference {}
 impl PartialEq<Self> for DataReference {
     fn eq(&self, other: &Self) -> bool {
         match (self, other) {
-            (DataReference::Chunk(_, _, _), DataReference::Memcache(_, _, _)) => false,
-            (DataReference::Memcache(_, _, _), DataReference::Chunk(_, _, _)) => false,
-            (DataReference::Chunk(_, _, f1), DataReference::Chunk(_, _, f2)) => {
+            (DataReference::Chunk(..), DataReference::Memcache(..)) => false,
+            (DataReference::Memcache(..), DataReference::Chunk(..)) => false,
+            (DataReference::Chunk(_, _, f1, _), DataReference::Chunk(_, _, f2, _)) => {
                 f1.file_id() == f2.file_id() && f1.level() == f2.level()
             }
             (DataReference::Memcache(_, _, c1), DataReference::Memcache(_, _, c2)) => c1 == c2,
@@ -321,7 +333,7 @@ impl DataReference {
 
     pub fn file_id(&self) -> ColumnFileId {
         match self {
-            DataReference::Chunk(_, _, cf) => cf.file_id(),
+            DataReference::Chunk(_, _, cf, _) => cf.file_id(),
             DataReference::Memcache(_, _, cf_id) => *cf_id,
         }
     }
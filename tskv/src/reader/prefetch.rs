@@ -0,0 +1,111 @@
+use futures::{StreamExt, TryStreamExt};
+
+use super::utils::BoxedSchemableRecordBatchStream;
+use super::{
+    BatchReader, BatchReaderRef, CombinedBatchReader, SchemableTskvRecordBatchStream,
+    SendableSchemableTskvRecordBatchStream,
+};
+use crate::TskvResult;
+
+/// Reads the inputs in order the same as [`CombinedBatchReader`], but reads
+/// ahead up to `read_ahead` inputs concurrently, so that the I/O of the next
+/// inputs overlaps with decoding the current one.
+///
+/// The batches of an input are buffered until it is returned, it's meant for
+/// the inputs of a few batches, such as the column groups of a chunk.
+pub struct PrefetchBatchReader {
+    readers: Vec<BatchReaderRef>,
+    read_ahead: usize,
+}
+
+impl PrefetchBatchReader {
+    pub fn new(readers: Vec<BatchReaderRef>, read_ahead: usize) -> Self {
+        Self {
+            readers,
+            read_ahead,
+        }
+    }
+}
+
+impl BatchReader for PrefetchBatchReader {
+    fn process(&self) -> TskvResult<SendableSchemableTskvRecordBatchStream> {
+        if self.readers.len() <= 1 || self.read_ahead <= 1 {
+            return CombinedBatchReader::new(self.readers.clone()).process();
+        }
+
+        let streams = self
+            .readers
+            .iter()
+            .map(|e| e.process())
+            .collect::<TskvResult<Vec<_>>>()?;
+        let schema = streams[0].schema();
+
+        let stream = futures::stream::iter(streams)
+            .map(|s| s.try_collect::<Vec<_>>())
+            .buffered(self.read_ahead)
+            .map_ok(|batches| futures::stream::iter(batches.into_iter().map(Ok)))
+            .try_flatten();
+
+        Ok(Box::pin(BoxedSchemableRecordBatchStream::new(
+            schema,
+            Box::pin(stream),
+        )))
+    }
+
+    fn fmt_as(&self, f: &mut std::fmt::Formatter) -> std::fmt::Result {
+        write!(
+            f,
+            "PrefetchBatchReader: size={}, read_ahead={}",
+            self.readers.len(),
+            self.read_ahead
+        )
+    }
+
+    fn children(&self) -> Vec<BatchReaderRef> {
+        self.readers.clone()
+    }
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use arrow::datatypes::{DataType, Field, Schema};
+    use arrow_array::{Int64Array, RecordBatch};
+    use futures::TryStreamExt;
+
+    use super::PrefetchBatchReader;
+    use crate::reader::{BatchReader, BatchReaderRef, MemoryBatchReader};
+
+    #[tokio::test]
+    async fn test_prefetch_batch_reader() {
+        let schema = Arc::new(Schema::new(vec![Field::new("a", DataType::Int64, true)]));
+        let readers = (0..5)
+            .map(|i| {
+                let batch = RecordBatch::try_new(
+                    schema.clone(),
+                    vec![Arc::new(Int64Array::from(vec![i, i + 10]))],
+                )
+                .unwrap();
+                Arc::new(MemoryBatchReader::new(schema.clone(), vec![batch])) as BatchReaderRef
+            })
+            .collect::<Vec<_>>();
+
+        let reader = PrefetchBatchReader::new(readers, 2);
+        let batches = reader
+            .process()
+            .unwrap()
+            .try_collect::<Vec<_>>()
+            .await
+            .unwrap();
+
+        let values = batches
+            .iter()
+            .flat_map(|b| {
+                let array = b.column(0).as_any().downcast_ref::<Int64Array>().unwrap();
+                array.values().to_vec()
+            })
+            .collect::<Vec<_>>();
+        assert_eq!(values, vec![0, 10, 1, 11, 2, 12, 3, 13, 4, 14]);
+    }
+}
@@ -0,0 +1,103 @@
+use arrow::compute::filter_record_batch;
+use arrow_array::BooleanArray;
+use datafusion::arrow::record_batch::RecordBatch;
+use futures::{future, StreamExt, TryStreamExt};
+use rand::Rng;
+use snafu::ResultExt;
+
+use super::utils::BoxedSchemableRecordBatchStream;
+use super::{
+    BatchReader, BatchReaderRef, SchemableTskvRecordBatchStream,
+    SendableSchemableTskvRecordBatchStream,
+};
+use crate::error::ArrowSnafu;
+use crate::TskvResult;
+
+/// Keeps each row of the input with the probability `percent / 100`, so
+/// that the sampled rows are not read by the upper readers.
+pub struct SampleBatchReader {
+    reader: BatchReaderRef,
+    percent: f64,
+}
+
+impl SampleBatchReader {
+    pub fn new(reader: BatchReaderRef, percent: f64) -> Self {
+        Self { reader, percent }
+    }
+}
+
+impl BatchReader for SampleBatchReader {
+    fn process(&self) -> TskvResult<SendableSchemableTskvRecordBatchStream> {
+        let input = self.reader.process()?;
+        let schema = input.schema();
+        let probability = (self.percent / 100.0).clamp(0.0, 1.0);
+        let stream = input
+            .map(move |batch| batch.and_then(|batch| sample_rows(&batch, probability)))
+            .try_filter(|batch| future::ready(batch.num_rows() > 0));
+
+        Ok(Box::pin(BoxedSchemableRecordBatchStream::new(
+            schema,
+            Box::pin(stream),
+        )))
+    }
+
+    fn fmt_as(&self, f: &mut std::fmt::Formatter) -> std::fmt::Result {
+        write!(f, "SampleBatchReader: percent={}", self.percent)
+    }
+
+    fn children(&self) -> Vec<BatchReaderRef> {
+        vec![self.reader.clone()]
+    }
+}
+
+fn sample_rows(batch: &RecordBatch, probability: f64) -> TskvResult<RecordBatch> {
+    if probability >= 1.0 {
+        return Ok(batch.clone());
+    }
+    let mut rng = rand::thread_rng();
+    let predicate = (0..batch.num_rows())
+        .map(|_| Some(rng.gen_bool(probability)))
+        .collect::<BooleanArray>();
+    filter_record_batch(batch, &predicate).context(ArrowSnafu)
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use arrow::datatypes::{DataType, Field, Schema};
+    use arrow_array::{Int64Array, RecordBatch};
+    use futures::TryStreamExt;
+
+    use super::SampleBatchReader;
+    use crate::reader::{BatchReader, MemoryBatchReader};
+
+    async fn sampled_rows(percent: f64) -> usize {
+        let schema = Arc::new(Schema::new(vec![Field::new("f", DataType::Int64, true)]));
+        let batches = (0..10)
+            .map(|i| {
+                let values = Int64Array::from_iter_values(i * 1000..(i + 1) * 1000);
+                RecordBatch::try_new(schema.clone(), vec![Arc::new(values)]).unwrap()
+            })
+            .collect::<Vec<_>>();
+        let reader = Arc::new(MemoryBatchReader::new(schema, batches));
+
+        SampleBatchReader::new(reader, percent)
+            .process()
+            .unwrap()
+            .try_collect::<Vec<_>>()
+            .await
+            .unwrap()
+            .iter()
+            .map(|b| b.num_rows())
+            .sum()
+    }
+
+    #[tokio::test]
+    async fn test_sample_batch_reader() {
+        assert_eq!(sampled_rows(100.0).await, 10_000);
+        assert_eq!(sampled_rows(0.0).await, 0);
+        let rows = sampled_rows(10.0).await;
+        assert!((500..1500).contains(&rows), "sampled {rows} rows");
+    }
+}
@@ -3,15 +3,15 @@ use std::sync::Arc;
 use std::task::{Context, Poll};
 
 use arrow_schema::{Fields, Schema};
-use datafusion::arrow::array::StringBuilder;
+use datafusion::arrow::array::{StringBuilder, UInt32Array};
 use datafusion::arrow::datatypes::{DataType, SchemaRef};
 use datafusion::arrow::error::ArrowError;
 use datafusion::arrow::record_batch::RecordBatch;
 use futures::future::BoxFuture;
 use futures::{ready, Stream, StreamExt, TryFutureExt};
-use models::arrow::stream::MemoryRecordBatchStream;
 use models::arrow_array::build_arrow_array_builders;
 use models::meta_data::VnodeId;
+use models::predicate::SERIES_ID_COLUMN;
 use models::schema::tskv_table_schema::TskvTableSchemaRef;
 use models::SeriesKey;
 use snafu::{OptionExt, ResultExt};
@@ -51,24 +51,59 @@ impl LocalTskvTagScanStream {
                 option.table_schema.name.as_str(),
             );
 
-            let series_ids = kv
+            let mut series_ids = kv
                 .get_series_id_by_filter(tenant, db, table, vnode_id, option.split.tags_filter())
                 .await?;
-            let keys = kv
-                .get_series_key(tenant, db, table, vnode_id, &series_ids)
-                .await?;
+            if let Some(series_range) = option.split.series_range() {
+                series_ids = series_range.apply(series_ids);
+            }
+            // the tags filter is exact, so the limit can be applied to the series directly
+            if let Some(limit) = option.split.limit() {
+                series_ids.truncate(limit);
+            }
 
-            let mut batches = vec![];
-            for chunk in keys.chunks(option.batch_size) {
-                let record_batch = series_keys_to_record_batch(
-                    option.table_schema.clone(),
-                    option.df_schema.clone(),
-                    chunk,
-                )?;
-                batches.push(record_batch)
+            // only the series ids are scanned, e.g. to page the series
+            if is_series_id_scan(&option.df_schema) {
+                let schema = option.df_schema.clone();
+                let batches = series_ids
+                    .chunks(option.batch_size)
+                    .map(|c| {
+                        RecordBatch::try_new(
+                            schema.clone(),
+                            vec![Arc::new(UInt32Array::from(c.to_vec()))],
+                        )
+                        .context(ArrowSnafu)
+                    })
+                    .collect::<Vec<_>>();
+                return Ok(
+                    Box::pin(futures::stream::iter(batches)) as SendableTskvRecordBatchStream
+                );
             }
 
-            Ok(Box::pin(MemoryRecordBatchStream::new(batches)) as SendableTskvRecordBatchStream)
+            // series keys are read batch by batch, rather than all at once
+            let chunks = series_ids
+                .chunks(option.batch_size)
+                .map(|c| c.to_vec())
+                .collect::<Vec<_>>();
+            let stream = futures::stream::iter(chunks).then(move |chunk| {
+                let kv = kv.clone();
+                let option = option.clone();
+                async move {
+                    let table_schema = option.table_schema.clone();
+                    let keys = kv
+                        .get_series_key(
+                            &table_schema.tenant,
+                            &table_schema.db,
+                            &table_schema.name,
+                            vnode_id,
+                            &chunk,
+                        )
+                        .await?;
+                    series_keys_to_record_batch(table_schema, option.df_schema.clone(), &keys)
+                }
+            });
+
+            Ok(Box::pin(stream) as SendableTskvRecordBatchStream)
         };
 
         let state = StreamState::Open(Box::pin(futrue));
@@ -99,6 +134,13 @@ impl Stream for LocalTskvTagScanStream {
     }
 }
 
+fn is_series_id_scan(schema: &SchemaRef) -> bool {
+    match schema.fields().as_ref() {
+        [field] => field.name() == SERIES_ID_COLUMN && field.data_type() == &DataType::UInt32,
+        _ => false,
+    }
+}
+
 pub type StreamFuture = BoxFuture<'static, TskvResult<SendableTskvRecordBatchStream>>;
 
 enum StreamState {
@@ -0,0 +1,149 @@
+use arrow::compute::{concat_batches, sort_to_indices, take, SortOptions};
+use datafusion::arrow::record_batch::RecordBatch;
+use futures::{stream, TryStreamExt};
+use models::predicate::TopK;
+use snafu::ResultExt;
+
+use super::utils::BoxedSchemableRecordBatchStream;
+use super::{
+    BatchReader, BatchReaderRef, SchemableTskvRecordBatchStream,
+    SendableSchemableTskvRecordBatchStream,
+};
+use crate::error::ArrowSnafu;
+use crate::TskvResult;
+
+/// Reads the first `k` rows of the input ordered by a column, the candidates
+/// of `ORDER BY column LIMIT k` of the vnode, so that the other rows are not
+/// sent to the querying node.
+///
+/// The output is not ordered, the rows of the same value of the column may be
+/// any of them.
+pub struct TopKBatchReader {
+    reader: BatchReaderRef,
+    top_k: TopK,
+}
+
+impl TopKBatchReader {
+    pub fn new(reader: BatchReaderRef, top_k: TopK) -> Self {
+        Self { reader, top_k }
+    }
+}
+
+impl BatchReader for TopKBatchReader {
+    fn process(&self) -> TskvResult<SendableSchemableTskvRecordBatchStream> {
+        let input = self.reader.process()?;
+        let schema = input.schema();
+        let Ok(column) = schema.index_of(&self.top_k.column) else {
+            return Ok(input);
+        };
+
+        let options = SortOptions {
+            descending: self.top_k.descending,
+            nulls_first: self.top_k.nulls_first,
+        };
+        let k = self.top_k.k;
+        let stream = stream::once(
+            input.try_fold(None, move |top: Option<RecordBatch>, batch| {
+                let top = match top {
+                    Some(top) => {
+                        concat_batches(&batch.schema(), [&top, &batch]).context(ArrowSnafu)
+                    }
+                    None => Ok(batch),
+                }
+                .and_then(|batch| first_rows(&batch, column, options, k));
+                async move { top.map(Some) }
+            }),
+        )
+        .try_filter_map(|top| async move { Ok(top.filter(|b| b.num_rows() > 0)) });
+
+        Ok(Box::pin(BoxedSchemableRecordBatchStream::new(
+            schema,
+            Box::pin(stream),
+        )))
+    }
+
+    fn fmt_as(&self, f: &mut std::fmt::Formatter) -> std::fmt::Result {
+        write!(
+            f,
+            "TopKBatchReader: column={}, descending={}, k={}",
+            self.top_k.column, self.top_k.descending, self.top_k.k
+        )
+    }
+
+    fn children(&self) -> Vec<BatchReaderRef> {
+        vec![self.reader.clone()]
+    }
+}
+
+/// The first `k` rows of the batch ordered by the column.
+fn first_rows(
+    batch: &RecordBatch,
+    column: usize,
+    options: SortOptions,
+    k: usize,
+) -> TskvResult<RecordBatch> {
+    if batch.num_rows() <= k {
+        return Ok(batch.clone());
+    }
+    let indices =
+        sort_to_indices(batch.column(column), Some(options), Some(k)).context(ArrowSnafu)?;
+    let columns = batch
+        .columns()
+        .iter()
+        .map(|c| take(c.as_ref(), &indices, None))
+        .collect::<Result<Vec<_>, _>>()
+        .context(ArrowSnafu)?;
+    RecordBatch::try_new(batch.schema(), columns).context(ArrowSnafu)
+}
+
+#[cfg(test)]
+mod test {
+    use std::sync::Arc;
+
+    use arrow::datatypes::{DataType, Field, Schema};
+    use arrow_array::{Int64Array, RecordBatch};
+    use futures::TryStreamExt;
+    use models::predicate::TopK;
+
+    use super::TopKBatchReader;
+    use crate::reader::{BatchReader, MemoryBatchReader};
+
+    #[tokio::test]
+    async fn test_top_k_batch_reader() {
+        let schema = Arc::new(Schema::new(vec![Field::new("f", DataType::Int64, true)]));
+        let batches = [
+            vec![Some(3), Some(9), None],
+            vec![Some(7), Some(1)],
+            vec![Some(8)],
+        ]
+        .into_iter()
+        .map(|values| {
+            RecordBatch::try_new(schema.clone(), vec![Arc::new(Int64Array::from(values))]).unwrap()
+        })
+        .collect::<Vec<_>>();
+        let reader = Arc::new(MemoryBatchReader::new(schema.clone(), batches));
+
+        let top_k = TopK {
+            column: "f".to_string(),
+            descending: true,
+            nulls_first: false,
+            k: 3,
+        };
+        let batches = TopKBatchReader::new(reader, top_k)
+            .process()
+            .unwrap()
+            .try_collect::<Vec<_>>()
+            .await
+            .unwrap();
+
+        assert_eq!(batches.len(), 1);
+        let values = batches[0]
+            .column(0)
+            .as_any()
+            .downcast_ref::<Int64Array>()
+            .unwrap();
+        let mut values = values.iter().collect::<Vec<_>>();
+        values.sort();
+        assert_eq!(values, vec![Some(7), Some(8), Some(9)]);
+    }
+}
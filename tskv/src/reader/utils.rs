@@ -13,6 +13,7 @@ use datafusion::physical_plan::expressions::{BinaryExpr, Column, Literal};
 use datafusion::physical_plan::metrics::ExecutionPlanMetricsSet;
 use datafusion::physical_plan::PhysicalExpr;
 use datafusion::scalar::ScalarValue;
+use futures::stream::BoxStream;
 use futures::{Stream, StreamExt};
 use models::predicate::domain::TimeRange;
 
@@ -189,6 +190,32 @@ impl Stream for CombinedRecordBatchStream {
     }
 }
 
+/// Attaches the schema to a boxed stream of record batches.
+pub struct BoxedSchemableRecordBatchStream {
+    schema: SchemaRef,
+    stream: BoxStream<'static, TskvResult<RecordBatch>>,
+}
+
+impl BoxedSchemableRecordBatchStream {
+    pub fn new(schema: SchemaRef, stream: BoxStream<'static, TskvResult<RecordBatch>>) -> Self {
+        Self { schema, stream }
+    }
+}
+
+impl SchemableTskvRecordBatchStream for BoxedSchemableRecordBatchStream {
+    fn schema(&self) -> SchemaRef {
+        self.schema.clone()
+    }
+}
+
+impl Stream for BoxedSchemableRecordBatchStream {
+    type Item = TskvResult<RecordBatch>;
+
+    fn poll_next(mut self: Pin<&mut Self>, cx: &mut Context<'_>) -> Poll<Option<Self::Item>> {
+        self.stream.poll_next_unpin(cx)
+    }
+}
+
 /// Re-assign column indices referenced in predicate according to given schema.
 /// If a column is not found in the schema, it will be replaced.
 ///
@@ -4,7 +4,6 @@ use std::fmt::Display;
 use std::path::{Path, PathBuf};
 use std::sync::Arc;
 
-use cache::ShardedAsyncCache;
 use memory_pool::MemoryPoolRef;
 use meta::model::MetaRef;
 use metrics::metric_register::MetricsRegister;
@@ -375,7 +374,9 @@ impl Summary {
             )
             .await?;
         w.sync().await?;
-        let ctx = Arc::new(GlobalContext::default());
+        let ctx = Arc::new(GlobalContext::with_max_open_tsm_files(
+            opt.storage.max_open_tsm_files,
+        ));
 
         Ok(Self {
             _meta: meta.clone(),
@@ -411,7 +412,9 @@ impl Summary {
         let summary_path = opt.storage.summary_dir();
         let path = file_utils::make_summary_file(&summary_path, 0);
         let writer = Writer::open(path, SUMMARY_BUFFER_SIZE).await.unwrap();
-        let ctx = Arc::new(GlobalContext::default());
+        let ctx = Arc::new(GlobalContext::with_max_open_tsm_files(
+            opt.storage.max_open_tsm_files,
+        ));
         let rd = Box::new(
             Reader::open(&file_utils::make_summary_file(&summary_path, 0))
                 .await
@@ -513,9 +516,8 @@ impl Summary {
                 },
             };
             // Recover levels_info according to `CompactMeta`s;
-            let tsm_reader_cache = Arc::new(ShardedAsyncCache::create_lru_sharded_cache(
-                db_schema.config.max_cache_readers() as usize,
-            ));
+            let tsm_reader_cache =
+                ctx.tsm_reader_cache(db_schema.config.max_cache_readers() as usize);
             let weak_tsm_reader_cache = Arc::downgrade(&tsm_reader_cache);
             let mut levels = LevelInfo::init_levels(owner.clone(), tsf_id, opt.storage.clone());
             for meta in files.into_values() {
@@ -595,6 +597,10 @@ impl Summary {
             .copy_apply_version_edits(request.version_edit.clone(), &mut file_metas);
         let new_version = Arc::new(new_version);
 
+        // Replace the tombstones and install the new version while holding the lock,
+        // a query checks the version after taking tombstones snapshots, so that
+        // it never reads the old files with the tombstones of the new version.
+        let mut ts_family = request.ts_family.write().await;
         let _ = install_tombstones_for_tsm_readers(
             self.runtime.clone(),
             partly_deleted_file_paths.clone(),
@@ -607,11 +613,8 @@ impl Summary {
             .unmark_compacting_files(&partly_deleted_files)
             .await;
 
-        request
-            .ts_family
-            .write()
-            .await
-            .new_version(new_version, request.mem_caches.as_ref());
+        ts_family.new_version(new_version, request.mem_caches.as_ref());
+        drop(ts_family);
         trace::info!("Applied new version for ts_family {}.", tsf_id);
 
         Ok(())
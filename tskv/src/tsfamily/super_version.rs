@@ -13,6 +13,9 @@ use crate::tsm::page::PageMeta;
 use crate::tsm::ColumnGroupID;
 use crate::ColumnFileId;
 
+/// The caches and files of a vnode at some moment, a query reads from it
+/// from start to end. The files compacted meanwhile are removed once all
+/// the queries reading them are finished.
 #[derive(Debug)]
 pub struct SuperVersion {
     pub ts_family_id: u32,
@@ -247,6 +247,12 @@ impl TseriesFamily {
             }
             .build());
         }
+        if self.status == VnodeStatus::Frozen {
+            return Err(CommonSnafu {
+                reason: format!("vnode {} is frozen, writes are rejected", self.tf_id),
+            }
+            .build());
+        }
         let mut res = 0;
         for (sid, (series_key, group)) in points {
             let mem = self.mut_cache.read();
@@ -189,7 +189,18 @@ impl Version {
         let mut result = BTreeMap::new();
         for level in self.levels_info.iter() {
             for file in level.files.iter() {
-                if file.is_deleted() || !file.overlap(&time_predicate) {
+                // the files of a version are kept until it's dropped, even if
+                // they are compacted into other files of the newer versions
+                if !file.overlap(&time_predicate) {
+                    continue;
+                }
+                // check the series bloom filter of the file before opening it
+                if !series_ids.is_empty()
+                    && !file
+                        .contains_any_series_id(series_ids)
+                        .await
+                        .unwrap_or(true)
+                {
                     continue;
                 }
                 let reader = self.get_tsm_reader(file.file_path()).await.unwrap();
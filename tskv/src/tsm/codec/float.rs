@@ -1,12 +1,12 @@
 use std::sync::Arc;
 
 use arrow::buffer::NullBuffer;
-use arrow_array::builder::Float64Builder;
+use arrow_array::types::Float64Type;
 use arrow_array::{ArrayRef, Float64Array};
 use pco::standalone::{simple_decompress, simpler_compress};
 use pco::DEFAULT_COMPRESSION_LEVEL;
 
-use super::CodecError;
+use super::{valid_count, values_to_array, CodecError};
 use crate::byte_utils::decode_be_f64;
 use crate::tsm::codec::Encoding;
 
@@ -367,20 +367,7 @@ pub fn f64_pco_decode(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, Code
 
     let src = &src[1..];
     let decode: Vec<f64> = simple_decompress(src)?;
-    let mut builder = Float64Builder::with_capacity(bit_set.len());
-    let mut iter = decode.into_iter();
-
-    for is_valid in bit_set.iter() {
-        if is_valid {
-            match iter.next() {
-                Some(value) => builder.append_value(value),
-                None => return Err("Mismatch between bit set and decoded values".into()),
-            }
-        } else {
-            builder.append_null();
-        }
-    }
-    let array = builder.finish();
+    let array = values_to_array::<Float64Type>(decode, bit_set)?;
     Ok(Arc::new(array))
 }
 
@@ -394,21 +381,13 @@ pub fn f64_without_compress_decode(
         return Ok(Arc::new(array));
     }
 
-    let mut builder = Float64Builder::with_capacity(bit_set.len());
     let src = &src[1..];
-    let mut iter = src.chunks(8);
-
-    for is_valid in bit_set.iter() {
-        if is_valid {
-            match iter.next() {
-                Some(value) => builder.append_value(decode_be_f64(value)),
-                None => return Err("Mismatch between bit set and decoded values".into()),
-            }
-        } else {
-            builder.append_null();
-        }
-    }
-    let array = builder.finish();
+    let values = src
+        .chunks_exact(8)
+        .take(valid_count(bit_set))
+        .map(decode_be_f64)
+        .collect::<Vec<_>>();
+    let array = values_to_array::<Float64Type>(values, bit_set)?;
     Ok(Arc::new(array))
 }
 
@@ -424,8 +403,7 @@ fn decode_with_sentinel(
         return Ok(Arc::new(Float64Array::from(vec![] as Vec<f64>)));
     }
 
-    let mut dst: Vec<f64> = Vec::new();
-    let mut builder = Float64Builder::with_capacity(bit_set.len());
+    let mut dst: Vec<f64> = Vec::with_capacity(valid_count(bit_set));
 
     let mut i = 1; // skip first byte as it's the encoding, which is always gorilla
     let mut buf: [u8; 8] = [0; 8];
@@ -590,18 +568,7 @@ fn decode_with_sentinel(
         dst.push(f64::from_bits(val));
     }
 
-    let mut iter = dst.into_iter();
-    for is_valid in bit_set.iter() {
-        if is_valid {
-            match iter.next() {
-                Some(value) => builder.append_value(value),
-                None => return Err("Mismatch between bit set and decoded values".into()),
-            }
-        } else {
-            builder.append_null();
-        }
-    }
-    let array = builder.finish();
+    let array = values_to_array::<Float64Type>(dst, bit_set)?;
     Ok(Arc::new(array))
 }
 
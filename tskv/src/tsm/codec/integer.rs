@@ -1,11 +1,11 @@
 use std::sync::Arc;
 
 use arrow::buffer::NullBuffer;
-use arrow_array::builder::Int64Builder;
+use arrow_array::types::Int64Type;
 use arrow_array::{ArrayRef, Int64Array};
 use integer_encoding::*;
 
-use super::{simple8b, CodecError};
+use super::{simple8b, valid_count, values_to_array, CodecError};
 use crate::tsm::codec::timestamp::{
     ts_pco_decode_to_array, ts_pco_encode, ts_without_compress_decode_to_array,
     ts_without_compress_encode,
@@ -166,21 +166,18 @@ fn decode_uncompressed_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<Arra
     if src.is_empty() || src.len() & 0x7 != 0 {
         return Err(From::from("invalid uncompressed block length"));
     }
-    let mut i = 0;
     let mut prev: i64 = 0;
     let mut buf: [u8; 8] = [0; 8];
-    let mut builder = Int64Builder::with_capacity(bit_set.len());
-    for is_valid in bit_set.iter() {
-        if !is_valid {
-            builder.append_null();
-            continue;
-        }
-        buf.copy_from_slice(&src[i..i + 8]);
-        prev = prev.wrapping_add(zig_zag_decode(u64::from_be_bytes(buf)));
-        builder.append_value(prev); // N.B - signed integer...
-        i += 8;
-    }
-    Ok(Arc::new(builder.finish()))
+    let values = src
+        .chunks_exact(8)
+        .take(valid_count(bit_set))
+        .map(|v| {
+            buf.copy_from_slice(v);
+            prev = prev.wrapping_add(zig_zag_decode(u64::from_be_bytes(buf)));
+            prev // N.B - signed integer...
+        })
+        .collect::<Vec<_>>();
+    Ok(Arc::new(values_to_array::<Int64Type>(values, bit_set)?))
 }
 
 fn decode_rle_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, CodecError> {
@@ -192,25 +189,13 @@ fn decode_rle_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, Cod
 
     let mut a: [u8; 8] = [0; 8];
     a.copy_from_slice(&src[0..8]);
-    let mut first = zig_zag_decode(u64::from_be_bytes(a));
+    // first values stored raw
+    let first = zig_zag_decode(u64::from_be_bytes(a));
     let delta_z = zig_zag_decode(delta);
-    let mut is_first = true;
-    let mut builder = Int64Builder::with_capacity(bit_set.len());
-    for is_valid in bit_set.iter() {
-        if !is_valid {
-            builder.append_null();
-            continue;
-        }
-        if is_first {
-            // first values stored raw
-            builder.append_value(first);
-            is_first = false;
-            continue;
-        }
-        first = first.wrapping_add(delta_z);
-        builder.append_value(first);
-    }
-    Ok(Arc::new(builder.finish()))
+    let values = (0..valid_count(bit_set) as i64)
+        .map(|n| first.wrapping_add(delta_z.wrapping_mul(n)))
+        .collect::<Vec<_>>();
+    Ok(Arc::new(values_to_array::<Int64Type>(values, bit_set)?))
 }
 
 fn decode_simple8b_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, CodecError> {
@@ -218,33 +203,23 @@ fn decode_simple8b_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef
         return Err(From::from("not enough data to decode packed integer."));
     }
 
-    // TODO(edd): pre-allocate res by counting bytes in encoded slice?
-    let mut res = vec![];
+    let valid_count = valid_count(bit_set);
+    if valid_count == 0 {
+        return Ok(Arc::new(Int64Array::new_null(bit_set.len())));
+    }
+    let mut deltas = Vec::with_capacity(valid_count);
+    simple8b::decode(&src[8..], &mut deltas);
+
     let mut buf: [u8; 8] = [0; 8];
     buf.copy_from_slice(&src[0..8]);
-    let mut first_val = true;
-    let mut next = 0;
-    let mut iter = res.iter();
-    let mut builder = Int64Builder::with_capacity(bit_set.len());
-    for is_valid in bit_set.iter() {
-        if !is_valid {
-            builder.append_null();
-            continue;
-        }
-        if first_val {
-            next = zig_zag_decode(u64::from_be_bytes(buf));
-            builder.append_value(next);
-            simple8b::decode(&src[8..], &mut res);
-            first_val = false;
-            iter = res.iter();
-            continue;
-        }
-        if let Some(v) = iter.next() {
-            next += zig_zag_decode(*v);
-            builder.append_value(next);
-        }
+    let mut next = zig_zag_decode(u64::from_be_bytes(buf));
+    let mut values = Vec::with_capacity(valid_count);
+    values.push(next);
+    for delta in deltas.into_iter().take(valid_count - 1) {
+        next += zig_zag_decode(delta);
+        values.push(next);
     }
-    Ok(Arc::new(builder.finish()))
+    Ok(Arc::new(values_to_array::<Int64Type>(values, bit_set)?))
 }
 
 pub fn i64_without_compress_decode_to_array(
@@ -9,6 +9,8 @@ mod unsigned;
 
 use std::error::Error;
 
+use arrow::buffer::NullBuffer;
+use arrow_array::{ArrowPrimitiveType, PrimitiveArray};
 pub use instance::*;
 use models::codec::Encoding;
 
@@ -19,3 +21,61 @@ const MAX_VAR_INT_32: usize = 5;
 const MAX_VAR_INT_64: usize = 10;
 
 pub type CodecError = Box<dyn Error + Send + Sync>;
+
+/// Build the array of a page from the decoded values of the valid slots in
+/// `bit_set`. The values are moved into the array buffer, spread in place
+/// to their slots if there are nulls, rather than appended one by one.
+fn values_to_array<T: ArrowPrimitiveType>(
+    mut values: Vec<T::Native>,
+    bit_set: &NullBuffer,
+) -> Result<PrimitiveArray<T>, CodecError> {
+    let valid_count = valid_count(bit_set);
+    if values.len() < valid_count {
+        return Err(From::from("Mismatch between bit set and decoded values"));
+    }
+    values.truncate(valid_count);
+    if bit_set.null_count() == 0 {
+        return Ok(PrimitiveArray::new(values.into(), None));
+    }
+
+    // from the back, the value of a slot is never before its source
+    values.resize(bit_set.len(), T::Native::default());
+    let mut src = valid_count;
+    for dst in (0..bit_set.len()).rev() {
+        if bit_set.is_valid(dst) {
+            src -= 1;
+            values[dst] = values[src];
+        }
+    }
+    Ok(PrimitiveArray::new(values.into(), Some(bit_set.clone())))
+}
+
+/// The number of the values of the valid slots in `bit_set`.
+fn valid_count(bit_set: &NullBuffer) -> usize {
+    bit_set.len() - bit_set.null_count()
+}
+
+#[cfg(test)]
+mod test {
+    use arrow::buffer::NullBuffer;
+    use arrow_array::types::Int64Type;
+    use arrow_array::Int64Array;
+
+    use super::values_to_array;
+
+    #[test]
+    fn test_values_to_array() {
+        let bit_set = NullBuffer::from(vec![true, true, true]);
+        let array = values_to_array::<Int64Type>(vec![1, 2, 3], &bit_set).unwrap();
+        assert_eq!(array, Int64Array::from(vec![1, 2, 3]));
+
+        let bit_set = NullBuffer::from(vec![false, true, false, true, true, false]);
+        let array = values_to_array::<Int64Type>(vec![1, 2, 3], &bit_set).unwrap();
+        assert_eq!(
+            array,
+            Int64Array::from(vec![None, Some(1), None, Some(2), Some(3), None])
+        );
+
+        assert!(values_to_array::<Int64Type>(vec![1, 2], &bit_set).is_err());
+    }
+}
@@ -1,13 +1,13 @@
 use std::sync::Arc;
 
 use arrow::buffer::NullBuffer;
-use arrow_array::builder::Int64Builder;
+use arrow_array::types::Int64Type;
 use arrow_array::{ArrayRef, Int64Array};
 use integer_encoding::*;
 use pco::standalone::{simple_decompress, simpler_compress};
 use pco::DEFAULT_COMPRESSION_LEVEL;
 
-use super::{simple8b, CodecError};
+use super::{simple8b, valid_count, values_to_array, CodecError};
 use crate::byte_utils::decode_be_i64;
 use crate::tsm::codec::Encoding;
 
@@ -203,24 +203,16 @@ fn decode_uncompressed_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<Arra
         return Err(From::from("invalid uncompressed block length"));
     }
 
-    let mut i = 0;
-    let mut prev = 0;
-    let mut buf: [u8; 8] = [0; 8];
-
-    let mut builder = Int64Builder::new();
-    for is_valid in bit_set.iter() {
-        if !is_valid {
-            builder.append_null();
-            continue;
-        }
-        if i < src.len() {
-            buf.copy_from_slice(&src[i..i + 8]);
-            prev += i64::from_be_bytes(buf);
-            builder.append_value(prev);
-            i += 8;
-        }
-    }
-    Ok(Arc::new(builder.finish()))
+    let mut prev = 0_i64;
+    let values = src
+        .chunks_exact(8)
+        .take(valid_count(bit_set))
+        .map(|v| {
+            prev += decode_be_i64(v);
+            prev
+        })
+        .collect::<Vec<_>>();
+    Ok(Arc::new(values_to_array::<Int64Type>(values, bit_set)?))
 }
 
 fn decode_rle_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, CodecError> {
@@ -238,24 +230,12 @@ fn decode_rle_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, Cod
     let (mut delta, _n) = u64::decode_var(&src[i..]).ok_or("unable to decode delta")?;
     delta *= scaler;
 
-    let mut is_first = true;
-    let mut first = 0;
-    let mut builder = Int64Builder::with_capacity(bit_set.len());
-    for is_valid in bit_set.iter() {
-        if !is_valid {
-            builder.append_null();
-            continue;
-        }
-        if is_first {
-            first = i64::from_be_bytes(a);
-            builder.append_value(first);
-            is_first = false;
-            continue;
-        }
-        first = first.wrapping_add(delta as i64);
-        builder.append_value(first);
-    }
-    Ok(Arc::new(builder.finish()))
+    // first values stored raw
+    let first = i64::from_be_bytes(a);
+    let values = (0..valid_count(bit_set) as i64)
+        .map(|n| first.wrapping_add((delta as i64).wrapping_mul(n)))
+        .collect::<Vec<_>>();
+    Ok(Arc::new(values_to_array::<Int64Type>(values, bit_set)?))
 }
 
 fn decode_simple8b_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, CodecError> {
@@ -265,37 +245,18 @@ fn decode_simple8b_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef
 
     let scaler = 10_u64.pow((src[0] & 0b0000_1111) as u32);
 
-    let mut res = vec![];
-    let mut buf: [u8; 8] = [0; 8];
-    buf.copy_from_slice(&src[1..9]);
-    let mut next = i64::from_be_bytes(buf);
-    let mut builder = Int64Builder::with_capacity(bit_set.len());
-    let mut idx = 0;
-    if bit_set.is_valid(idx) {
-        builder.append_value(next);
-    } else {
-        builder.append_null();
-    }
-    idx += 1;
-    simple8b::decode(&src[9..], &mut res);
-
-    let mut value_iter = res.into_iter();
-    while idx < bit_set.len() {
-        if bit_set.is_valid(idx) {
-            if let Some(value) = value_iter.next() {
-                next += if scaler > 1 {
-                    (value * scaler) as i64
-                } else {
-                    value as i64
-                };
-                builder.append_value(next);
-            }
-        } else {
-            builder.append_null();
-        }
-        idx += 1;
+    let valid_count = valid_count(bit_set);
+    let mut deltas = Vec::with_capacity(valid_count);
+    simple8b::decode(&src[9..], &mut deltas);
+
+    let mut next = decode_be_i64(&src[1..9]);
+    let mut values = Vec::with_capacity(valid_count);
+    values.push(next);
+    for delta in deltas.into_iter().take(valid_count.saturating_sub(1)) {
+        next += (delta * scaler) as i64;
+        values.push(next);
     }
-    Ok(Arc::new(builder.finish()))
+    Ok(Arc::new(values_to_array::<Int64Type>(values, bit_set)?))
 }
 
 pub fn ts_without_compress_decode_to_array(
@@ -308,18 +269,12 @@ pub fn ts_without_compress_decode_to_array(
         return Ok(Arc::new(array));
     }
     let src = &src[1..];
-    let mut iter = src.chunks(8);
-    let mut builder = Int64Builder::with_capacity(bit_set.len());
-    for is_valid in bit_set.iter() {
-        if !is_valid {
-            builder.append_null();
-            continue;
-        }
-        if let Some(i) = iter.next() {
-            builder.append_value(decode_be_i64(i));
-        }
-    }
-    Ok(Arc::new(builder.finish()))
+    let values = src
+        .chunks_exact(8)
+        .take(valid_count(bit_set))
+        .map(decode_be_i64)
+        .collect::<Vec<_>>();
+    Ok(Arc::new(values_to_array::<Int64Type>(values, bit_set)?))
 }
 
 pub fn ts_pco_decode_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayRef, CodecError> {
@@ -331,18 +286,7 @@ pub fn ts_pco_decode_to_array(src: &[u8], bit_set: &NullBuffer) -> Result<ArrayR
 
     let src = &src[1..];
     let decode: Vec<i64> = simple_decompress(src)?;
-    let mut iter = decode.iter();
-    let mut builder = Int64Builder::with_capacity(bit_set.len());
-    for is_valid in bit_set.iter() {
-        if !is_valid {
-            builder.append_null();
-            continue;
-        }
-        if let Some(val) = iter.next() {
-            builder.append_value(*val);
-        }
-    }
-    Ok(Arc::new(builder.finish()))
+    Ok(Arc::new(values_to_array::<Int64Type>(decode, bit_set)?))
 }
 
 #[cfg(test)]
@@ -354,7 +354,6 @@ impl Page {
     }
 
     pub fn col_to_page(column: &MutableColumn) -> TskvResult<Page> {
-        let null_count = 1;
         let len_bitset = ((column.valid().len() + 7) >> 3) as u32;
         let data_len = column.valid().len() as u64;
         let mut buf = vec![];
@@ -380,7 +379,7 @@ impl Page {
                     Some(*min),
                     Some(*max),
                     None,
-                    null_count,
+                    data_len - target_array.len() as u64,
                 ))
             }
             PrimaryColumnData::I64(array, min, max) => {
@@ -410,7 +409,7 @@ impl Page {
                     Some(*min),
                     Some(*max),
                     None,
-                    null_count,
+                    data_len - target_array.len() as u64,
                 ))
             }
             PrimaryColumnData::U64(array, min, max) => {
@@ -434,7 +433,7 @@ impl Page {
                     Some(*min),
                     Some(*max),
                     None,
-                    null_count,
+                    data_len - target_array.len() as u64,
                 ))
             }
             PrimaryColumnData::String(array, min, max) => {
@@ -458,7 +457,7 @@ impl Page {
                     Some(min.as_bytes().to_vec()),
                     Some(max.as_bytes().to_vec()),
                     None,
-                    null_count,
+                    data_len - target_array.len() as u64,
                 ))
             }
             PrimaryColumnData::Bool(array, min, max) => {
@@ -482,7 +481,7 @@ impl Page {
                     Some(*min),
                     Some(*max),
                     None,
-                    null_count,
+                    data_len - target_array.len() as u64,
                 ))
             }
         };
@@ -613,6 +612,18 @@ pub enum PageStatistics {
     Bytes(ValueStatistics<Vec<u8>>),
 }
 
+impl PageStatistics {
+    pub fn null_count(&self) -> u64 {
+        match self {
+            PageStatistics::Bool(v) => v.null_count(),
+            PageStatistics::F64(v) => v.null_count(),
+            PageStatistics::I64(v) => v.null_count(),
+            PageStatistics::U64(v) => v.null_count(),
+            PageStatistics::Bytes(v) => v.null_count(),
+        }
+    }
+}
+
 #[derive(Clone, Debug, Serialize, Deserialize)]
 pub struct PageWriteSpec {
     pub(crate) offset: u64,
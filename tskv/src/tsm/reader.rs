@@ -35,6 +35,7 @@ use crate::tsm::codec::{
 };
 use crate::tsm::footer::{Footer, TsmVersion};
 use crate::tsm::page::{Page, PageMeta, PageStatistics, PageWriteSpec};
+use crate::tsm::tombstone::TsmTombstoneCache;
 use crate::tsm::{ColumnGroupID, TsmTombstone, FOOTER_SIZE};
 use crate::{file_utils, ColumnFileId, TskvError};
 
@@ -233,6 +234,21 @@ impl TsmReader {
         read_page(&self.reader, page_spec).await
     }
 
+    /// Reads all the pages of the file to validate their crc, returns the
+    /// number of the pages.
+    pub async fn verify(&self) -> TskvResult<usize> {
+        let mut pages = 0;
+        for chunk in self.chunk().values() {
+            for column_group in chunk.column_group().values() {
+                for page in column_group.pages() {
+                    read_page(&self.reader, page).await?;
+                    pages += 1;
+                }
+            }
+        }
+        Ok(pages)
+    }
+
     pub async fn read_adjacent_pages(
         &self,
         pages_specs: &[PageWriteSpec],
@@ -328,7 +344,7 @@ impl TsmReader {
         let record_batch = decode_pages(
             column_group,
             schema.meta(),
-            Some((self.tombstone.clone(), series_id)),
+            Some((self.tombstone.snapshot(), series_id)),
         )?;
         Ok(record_batch)
     }
@@ -494,7 +510,7 @@ async fn read_page(reader: &FileStreamReader, page_spec: &PageWriteSpec) -> Tskv
 pub fn decode_pages(
     pages: Vec<Page>,
     schema_meta: HashMap<String, String>,
-    tomb: Option<(Arc<TsmTombstone>, SeriesId)>,
+    tomb: Option<(Arc<TsmTombstoneCache>, SeriesId)>,
 ) -> TskvResult<RecordBatch> {
     let mut target_arrays = Vec::with_capacity(pages.len());
 
@@ -658,7 +674,7 @@ fn update_nullbits_by_time_range(
 pub fn data_buf_to_arrow_array(page: &Page) -> TskvResult<ArrayRef> {
     let data_buffer = page.data_buffer();
     let encoding = get_encoding(data_buffer);
-    let page_null_buffer = NullBuffer::new(page.null_bitset().finish_cloned());
+    let page_null_buffer = NullBuffer::new(page.null_bitset().finish());
 
     let array = match page.meta().column.column_type.to_physical_type() {
         PhysicalCType::Time(precision) => {
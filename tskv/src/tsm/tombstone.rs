@@ -70,8 +70,8 @@ pub struct Tombstone {
 }
 
 pub struct TsmTombstone {
-    /// Tombstone caches.
-    cache: RwLock<TsmTombstoneCache>,
+    /// Tombstone caches, copied on write if a query holds a snapshot of it.
+    cache: RwLock<Arc<TsmTombstoneCache>>,
 
     path: PathBuf,
     /// Async record file writer.
@@ -99,7 +99,7 @@ impl TsmTombstone {
         };
 
         Ok(Self {
-            cache: RwLock::new(cache),
+            cache: RwLock::new(Arc::new(cache)),
             path,
             writer: Arc::new(AsyncMutex::new(writer)),
         })
@@ -213,6 +213,12 @@ impl TsmTombstone {
         self.cache.read().is_empty()
     }
 
+    /// The tombstones at this moment, not changed by the tombstones added
+    /// or replaced later.
+    pub fn snapshot(&self) -> Arc<TsmTombstoneCache> {
+        self.cache.read().clone()
+    }
+
     pub async fn add_range(
         &self,
         columns: &[(SeriesId, ColumnId)],
@@ -252,7 +258,7 @@ impl TsmTombstone {
         if !write_buf.is_empty() {
             write_tombstone_record(writer, &write_buf).await?;
         }
-        self.cache.write().insert_batch(tomb_tmp);
+        Arc::make_mut(&mut self.cache.write()).insert_batch(tomb_tmp);
         Ok(())
     }
 
@@ -273,7 +279,7 @@ impl TsmTombstone {
         let mut write_buf = Vec::with_capacity(MAX_RECORD_LEN);
         Self::encode_field_time_ranges(&mut write_buf, &TombstoneField::All, &[time_range]);
         write_tombstone_record(writer, &write_buf).await.unwrap();
-        self.cache.write().insert(TombstoneField::All, time_range);
+        Arc::make_mut(&mut self.cache.write()).insert(TombstoneField::All, time_range);
     }
 
     /// Add a time range to `all_excluded` and then compact tombstones,
@@ -284,7 +290,7 @@ impl TsmTombstone {
     ) -> TskvResult<TimeRanges> {
         let tmp_path = tombstone_compact_tmp_path(&self.path)?;
         let mut writer = record_file::Writer::open(&tmp_path, TOMBSTONE_BUFFER_SIZE).await?;
-        let mut cache = self.cache.write().clone();
+        let mut cache = TsmTombstoneCache::clone(&self.cache.read());
         cache.insert(TombstoneField::All, time_range);
         cache.compact();
         trace::info!(
@@ -317,7 +323,7 @@ impl TsmTombstone {
             file_utils::rename(tmp_path, &self.path).await?;
             let mut reader = record_file::Reader::open(&self.path).await?;
             let cache = TsmTombstoneCache::load_from(&mut reader, false).await?;
-            *self.cache.write() = cache;
+            *self.cache.write() = Arc::new(cache);
         } else {
             debug!("No compact_tmp tombstone file to convert to real tombstone file");
         }
@@ -819,4 +825,39 @@ mod test {
             }
         ));
     }
+
+    #[tokio::test]
+    async fn test_snapshot() {
+        let dir = PathBuf::from("/tmp/test/tombstone/snapshot".to_string());
+        let _ = std::fs::remove_dir_all(&dir);
+        std::fs::create_dir_all(&dir).unwrap();
+
+        let tombstone = TsmTombstone::open(&dir, 1).await.unwrap();
+        tombstone
+            .add_range(&[(0, 1)], TimeRange::new(1, 10), None)
+            .await
+            .unwrap();
+        let snapshot = tombstone.snapshot();
+
+        tombstone
+            .add_range(&[(0, 1)], TimeRange::new(20, 30), None)
+            .await
+            .unwrap();
+        tombstone
+            .add_range_and_compact_to_tmp(TimeRange::new(40, 50))
+            .await
+            .unwrap();
+        tombstone.replace_with_compact_tmp().await.unwrap();
+
+        // the snapshot is not changed by the tombstones added later
+        assert_eq!(
+            snapshot.get_column_overlapped_time_ranges(0, 1, &TimeRange::new(0, 100)),
+            vec![TimeRange::new(1, 10)]
+        );
+        assert!(snapshot
+            .get_all_fields_excluded_time_range(&TimeRange::new(0, 100))
+            .is_empty());
+        assert!(tombstone.overlaps_column_time_range(0, 1, &TimeRange::new(20, 30)));
+        assert!(tombstone.check_all_fields_excluded_time_range(&TimeRange::new(40, 50)));
+    }
 }
@@ -607,6 +607,58 @@ pub mod test {
         assert_eq!(data1, data2);
     }
 
+    #[tokio::test]
+    async fn test_verify() {
+        let schema = TskvTableSchema::new(
+            "cnosdb".to_string(),
+            "public".to_string(),
+            "test0".to_string(),
+            vec![
+                TableColumn::new(
+                    0,
+                    "time".to_string(),
+                    ColumnType::Time(TimeUnit::Nanosecond),
+                    Encoding::default(),
+                ),
+                TableColumn::new(
+                    1,
+                    "f1".to_string(),
+                    ColumnType::Field(ValueType::Integer),
+                    Encoding::default(),
+                ),
+            ],
+        );
+        let schema = Arc::new(schema);
+        let data = RecordBatch::try_new(
+            schema.to_record_data_schema(),
+            vec![ts_column(vec![1, 2, 3]), i64_column(vec![1, 2, 3])],
+        )
+        .unwrap();
+
+        let path = "/tmp/test/tsm_verify";
+        let _ = std::fs::remove_dir_all(path);
+        let mut tsm_writer = TsmWriter::open(&PathBuf::from(path), 1, 0, false, Encoding::Null)
+            .await
+            .unwrap();
+        tsm_writer
+            .write_record_batch(1, SeriesKey::default(), schema.clone(), data)
+            .await
+            .unwrap();
+        tsm_writer.finish().await.unwrap();
+        let tsm_path = tsm_writer.path.clone();
+        let tsm_reader = TsmReader::open(&tsm_path).await.unwrap();
+        assert_eq!(tsm_reader.verify().await.unwrap(), 2);
+
+        // flip the last byte of the data of the last page
+        let page = &tsm_reader.chunk()[&1].column_group()[&0].pages()[1];
+        let last = (page.offset() + page.size() - 1) as usize;
+        let mut bytes = std::fs::read(&tsm_path).unwrap();
+        bytes[last] ^= 0xff;
+        std::fs::write(&tsm_path, bytes).unwrap();
+        let tsm_reader = TsmReader::open(&tsm_path).await.unwrap();
+        assert!(tsm_reader.verify().await.is_err());
+    }
+
     #[tokio::test]
     async fn test_write_and_read_2() {
         let schema = TskvTableSchema::new(
@@ -162,6 +162,8 @@ mod tests {
         let request = WriteDataRequest {
             data: points,
             precision: Precision::NS as u32,
+
+            copied: false,
         };
 
         tskv_write(rt.clone(), &tskv, "cnosdb", "public", 0, 1, request);
@@ -199,6 +201,8 @@ mod tests {
         let request = WriteDataRequest {
             data: points,
             precision: Precision::NS as u32,
+
+            copied: false,
         };
 
         tskv_write(rt.clone(), &tskv, "cnosdb", "db", 0, 1, request.clone());
@@ -218,7 +222,17 @@ mod tests {
                 .ts_family();
 
             let last_seq = ts_family.read().await.version().last_seq();
-            assert_eq!(last_seq, 4)
+            assert_eq!(last_seq, 4);
+
+            let summaries = tskv.get_vnode_summaries(&[0, 1]).await;
+            assert_eq!(summaries.len(), 1);
+            let summary = &summaries[0];
+            assert_eq!(summary.vnode_id, 0);
+            assert!(summary.disk_size > 0);
+            assert!(summary.series > 0);
+            assert!(summary.last_write_time.is_some());
+            // just written
+            assert!(!summary.cold);
         });
 
         assert!(LocalFileSystem::try_exists(
@@ -245,6 +259,8 @@ mod tests {
             let request = WriteDataRequest {
                 data: points,
                 precision: Precision::NS as u32,
+
+                copied: false,
             };
 
             tskv_write(rt.clone(), &tskv, "cnosdb", "public", 0, i, request.clone());
@@ -270,6 +286,8 @@ mod tests {
         let request = WriteDataRequest {
             data: points,
             precision: Precision::NS as u32,
+
+            copied: false,
         };
 
         tskv_write(rt.clone(), &tskv, "cnosdb", database, 0, 1, request.clone());
@@ -336,6 +354,8 @@ mod tests {
         let request = WriteDataRequest {
             data: points,
             precision: Precision::NS as u32,
+
+            copied: false,
         };
 
         tskv_write(rt.clone(), &tskv, "cnosdb", "public", 0, 1, request.clone());
@@ -372,6 +392,8 @@ mod tests {
             let request = WriteDataRequest {
                 data: fbb.finished_data().to_vec(),
                 precision: Precision::NS as u32,
+
+                copied: false,
             };
 
             tskv_write(